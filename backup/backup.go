@@ -29,8 +29,19 @@ func DoInit(cmd *cobra.Command) {
 	CleanupGroup.Add(1)
 	gplog.InitializeLogging("gpbackup", "")
 	SetCmdFlags(cmd.Flags())
-	_ = cmd.MarkFlagRequired(options.DBNAME)
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		// --dbname is required unless --all-databases is used instead
+		if !cmd.Flags().Changed(options.DBNAME) && !cmd.Flags().Changed(options.ALL_DATABASES) {
+			return errors.New(`required flag(s) "dbname" not set`)
+		}
+		if MustGetFlagBool(options.MACHINE_OUTPUT) {
+			machineOutput = utils.RedirectOutputToStderr("gpbackup")
+		}
+		return nil
+	}
 	utils.InitializeSignalHandler(DoCleanup, "backup process", &wasTerminated)
+	dataCopyPause = utils.InitializePauseSignalHandler("backup process", func(paused bool) { runStatus.SetPaused(paused) })
+	logLevelControl = utils.InitializeLogLevelHandler("backup process")
 	objectCounts = make(map[string]int)
 }
 
@@ -42,11 +53,15 @@ func DoFlagValidation(cmd *cobra.Command) {
 // This function handles setup that must be done after parsing flags.
 func DoSetup() {
 	SetLoggerVerbosity()
+	utils.SetProgressMode(MustGetFlagString(options.PROGRESS))
 	gplog.Verbose("Backup Command: %s", os.Args)
 	gplog.Info("gpbackup version = %s", GetVersion())
 
 	utils.CheckGpexpandRunning(utils.BackupPreventedByGpexpandMessage)
 	timestamp := history.CurrentTimestamp()
+	if resumeTimestamp := MustGetFlagString(options.RESUME); resumeTimestamp != "" {
+		timestamp = resumeTimestamp
+	}
 	createBackupLockFile(timestamp)
 	initializeConnectionPool(timestamp)
 	gplog.Info("Greenplum Database Version = %s", connectionPool.Version.VersionString)
@@ -54,6 +69,10 @@ func DoSetup() {
 	gplog.Info("Starting backup of database %s", MustGetFlagString(options.DBNAME))
 	opts, err := options.NewOptions(cmdFlags)
 	gplog.FatalOnError(err)
+	if slaFile := MustGetFlagString(options.SLA_FILE); slaFile != "" {
+		slaTargets, err = report.ReadSLATargets(slaFile, MustGetFlagString(options.DBNAME))
+		gplog.FatalOnError(err)
+	}
 
 	validateFilterLists(opts)
 
@@ -61,20 +80,41 @@ func DoSetup() {
 	gplog.FatalOnError(err)
 
 	segConfig := cluster.MustGetSegmentConfiguration(connectionPool)
+	mirrorSubstitutions := []string{}
+	if MustGetFlagBool(options.MIRROR_FAILOVER) {
+		segConfig, mirrorSubstitutions = failOverUnreachableSegmentHosts(segConfig)
+	}
 	globalCluster = cluster.NewCluster(segConfig)
+	if MustGetFlagBool(options.NO_SEGMENTS) {
+		globalCluster.Executor = &masterOnlyExecutor{globalCluster.Executor}
+	}
 	segPrefix := filepath.GetSegPrefix(connectionPool)
 	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), timestamp, segPrefix)
-	if MustGetFlagBool(options.METADATA_ONLY) {
+	useClientMasterDir(&globalFPInfo)
+	if MustGetFlagBool(options.CLIENT_MODE) {
+		createBackupDirectoriesFromClient()
+	} else if MustGetFlagBool(options.METADATA_ONLY) {
 		_, err = globalCluster.ExecuteLocalCommand(fmt.Sprintf("mkdir -p %s", globalFPInfo.GetDirForContent(-1)))
 		gplog.FatalOnError(err)
 	} else {
 		createBackupDirectoriesOnAllHosts()
 	}
+	lockBackupDirectory()
+	runStatus = utils.NewStatusTracker(globalFPInfo.GetBackupStatusFilePath(), "gpbackup", timestamp, MustGetFlagString(options.DBNAME))
+	logLevelControl.SetControlFile(globalFPInfo.GetBackupLogLevelFilePath())
 	globalTOC = &toc.TOC{}
 	globalTOC.InitializeMetadataEntryMap()
 	utils.InitializePipeThroughParameters(!MustGetFlagBool(options.NO_COMPRESSION), MustGetFlagString(options.COMPRESSION_TYPE), MustGetFlagInt(options.COMPRESSION_LEVEL))
+	if compressionWorkers := MustGetFlagInt(options.COMPRESSION_WORKERS); compressionWorkers > 1 {
+		utils.SetPipeThroughProgram(utils.NewParallelPipeThroughProgram(MustGetFlagString(options.COMPRESSION_TYPE), MustGetFlagInt(options.COMPRESSION_LEVEL), compressionWorkers))
+	}
+	compressionOverrides = getCompressionOverrides()
+	if handlerFile := MustGetFlagString(options.OBJECT_HANDLER_FILE); handlerFile != "" {
+		registerObjectHandlersFromFile(handlerFile)
+	}
 	getQuotedRoleNames(connectionPool)
 
+	configureS3Storage()
 	pluginConfigFlag := MustGetFlagString(options.PLUGIN_CONFIG)
 
 	if pluginConfigFlag != "" {
@@ -88,6 +128,10 @@ func DoSetup() {
 	}
 
 	initializeBackupReport(*opts)
+	backupReport.MirrorSubstitutions = mirrorSubstitutions
+	if MustGetFlagString(options.RESUME) != "" {
+		prepareToResumeBackup()
+	}
 
 	if pluginConfigFlag != "" {
 		backupReport.PluginVersion = pluginConfig.CheckPluginExistsOnAllHosts(globalCluster)
@@ -105,6 +149,9 @@ func DoBackup() {
 	targetBackupTimestamp := ""
 	var targetBackupFPInfo filepath.FilePathInfo
 	if MustGetFlagBool(options.INCREMENTAL) {
+		if MustGetFlagBool(options.DIFFERENTIAL) {
+			ValidateTrackCountsEnabled(connectionPool, "take a differential backup")
+		}
 		targetBackupTimestamp = GetTargetBackupTimestamp()
 		targetBackupFPInfo = filepath.NewFilePathInfo(globalCluster, globalFPInfo.UserSpecifiedBackupDir,
 			targetBackupTimestamp, globalFPInfo.UserSpecifiedSegPrefix)
@@ -117,61 +164,60 @@ func DoBackup() {
 		}
 	}
 
+	if MustGetFlagBool(options.SKIP_IF_UNCHANGED) {
+		ValidateTrackCountsEnabled(connectionPool, "use --skip-if-unchanged")
+	}
+
 	gplog.Info("Gathering table state information")
+	runStatus.SetPhase("Gathering table state")
 	metadataTables, dataTables := RetrieveAndProcessTables()
 	if !(MustGetFlagBool(options.METADATA_ONLY) || MustGetFlagBool(options.DATA_ONLY)) {
 		backupIncrementalMetadata()
 	}
 	CheckTablesContainData(dataTables)
+	openTOCProgressFile()
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
 	gplog.Info("Metadata will be written to %s", metadataFilename)
 	metadataFile := utils.NewFileWithByteCountFromFile(metadataFilename)
 
 	backupSessionGUC(metadataFile)
-	if !MustGetFlagBool(options.DATA_ONLY) {
-		isFullBackup := len(MustGetFlagStringArray(options.INCLUDE_RELATION)) == 0
-		if isFullBackup && !MustGetFlagBool(options.WITHOUT_GLOBALS) {
-			backupGlobals(metadataFile)
+	if canBackupDataDuringMetadata() {
+		backupDataDuringMetadata(getBackupSetTables(dataTables, targetBackupTimestamp, targetBackupFPInfo), func() {
+			backupMetadata(metadataFile, metadataTables)
+		})
+	} else {
+		backupMetadata(metadataFile, metadataTables)
+
+		if MustGetFlagBool(options.SKIP_IF_UNCHANGED) && !backupReport.MetadataOnly {
+			if previousConfig := getUnchangedSinceBackup(); previousConfig != nil {
+				finishUnchangedBackup(metadataFile, previousConfig)
+				return
+			}
 		}
 
-		isFilteredBackup := !isFullBackup
-		backupPredata(metadataFile, metadataTables, isFilteredBackup)
-		backupPostdata(metadataFile)
+		/*
+		 * We check this in the backup report rather than the flag because we
+		 * perform a metadata only backup if the database contains no tables
+		 * or only external tables
+		 */
+		if !backupReport.MetadataOnly {
+			backupSetTables := getBackupSetTables(dataTables, targetBackupTimestamp, targetBackupFPInfo)
+			globalTOC.SyncProgressFile()
+			backupData(backupSetTables)
+		}
 	}
-
-	/*
-	 * We check this in the backup report rather than the flag because we
-	 * perform a metadata only backup if the database contains no tables
-	 * or only external tables
-	 */
 	if !backupReport.MetadataOnly {
-		backupSetTables := dataTables
-
-		targetBackupRestorePlan := make([]history.RestorePlanEntry, 0)
-		if targetBackupTimestamp != "" {
-			gplog.Info("Basing incremental backup off of backup with timestamp = %s", targetBackupTimestamp)
-
-			targetBackupTOC := toc.NewTOC(targetBackupFPInfo.GetTOCFilePath())
-			targetBackupRestorePlan = history.ReadConfigFile(targetBackupFPInfo.GetConfigFilePath()).RestorePlan
-			backupSetTables = FilterTablesForIncremental(targetBackupTOC, globalTOC, dataTables)
-		}
-
-		backupReport.RestorePlan = PopulateRestorePlan(backupSetTables, targetBackupRestorePlan, dataTables)
-		backupData(backupSetTables)
+		backupSequenceValues()
 	}
 	if MustGetFlagBool(options.WITH_STATS) {
+		runStatus.SetPhase("Statistics")
+		globalTOC.SyncProgressFile()
 		backupStatistics(metadataTables)
 	}
 
+	globalTOC.CloseProgressFile()
 	globalTOC.WriteToFileAndMakeReadOnly(globalFPInfo.GetTOCFilePath())
-	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
-		// COMMIT TRANSACTION
-		// The transaction could have been rollbacked already
-		// during COPY step due to deadlock handling.
-		if connectionPool.Tx[connNum] != nil {
-			connectionPool.MustCommit(connNum)
-		}
-	}
+	commitTransactions()
 	metadataFile.Close()
 	if pluginConfigFlag != "" {
 		pluginConfig.MustBackupFile(metadataFilename)
@@ -179,19 +225,89 @@ func DoBackup() {
 		if MustGetFlagBool(options.WITH_STATS) {
 			pluginConfig.MustBackupFile(globalFPInfo.GetStatisticsFilePath())
 		}
+		if MustGetFlagBool(options.WITH_GLOBALS) {
+			pluginConfig.MustBackupFile(globalFPInfo.GetGlobalsFilePath())
+		}
+		if backupReport.CredentialsFile {
+			pluginConfig.MustBackupFile(globalFPInfo.GetCredentialsFilePath())
+		}
 		_ = utils.CopyFile(pluginConfigFlag, globalFPInfo.GetPluginConfigPath())
 		pluginConfig.MustBackupFile(globalFPInfo.GetPluginConfigPath())
 	}
 }
 
+func backupMetadata(metadataFile *utils.FileWithByteCount, metadataTables []Table) {
+	if MustGetFlagBool(options.DATA_ONLY) {
+		return
+	}
+	runStatus.SetPhase("Metadata")
+	if MustGetFlagBool(options.REDACT_CREDENTIALS) {
+		redactedCredentials = make(map[string]string)
+	}
+	isFullBackup := len(MustGetFlagStringArray(options.INCLUDE_RELATION)) == 0
+	if isFullBackup && !MustGetFlagBool(options.WITHOUT_GLOBALS) {
+		backupGlobals(metadataFile)
+	}
+
+	isFilteredBackup := !isFullBackup
+	backupReport.PXFReferences = GetPXFReferences(metadataTables)
+	backupPredata(metadataFile, metadataTables, isFilteredBackup)
+	backupCustomObjects(metadataFile, "predata", metadataTables)
+	backupPostdata(metadataFile)
+	backupCustomObjects(metadataFile, "postdata", metadataTables)
+	writeRedactedCredentials()
+
+	checksum, err := GetMetadataChecksum(globalFPInfo.GetMetadataFilePath())
+	if err != nil {
+		gplog.Warn("Unable to compute the checksum of the metadata file: %v", err)
+	}
+	backupReport.MetadataChecksum = checksum
+}
+
+/*
+ * Returns the tables whose data is backed up, which for an incremental
+ * backup are those changed since the backup it is based on, and records
+ * the restore plan for them.
+ */
+func getBackupSetTables(dataTables []Table, targetBackupTimestamp string, targetBackupFPInfo filepath.FilePathInfo) []Table {
+	backupSetTables := dataTables
+
+	targetBackupRestorePlan := make([]history.RestorePlanEntry, 0)
+	if targetBackupTimestamp != "" {
+		gplog.Info("Basing incremental backup off of backup with timestamp = %s", targetBackupTimestamp)
+
+		targetBackupTOC := toc.NewTOC(targetBackupFPInfo.GetTOCFilePath())
+		targetBackupRestorePlan = history.ReadConfigFile(targetBackupFPInfo.GetConfigFilePath()).RestorePlan
+		backupSetTables = FilterTablesForIncremental(targetBackupTOC, globalTOC, dataTables, MustGetFlagBool(options.DIFFERENTIAL))
+	}
+
+	backupReport.RestorePlan = PopulateRestorePlan(backupSetTables, targetBackupRestorePlan, dataTables)
+	return backupSetTables
+}
+
+func commitTransactions() {
+	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
+		// COMMIT TRANSACTION
+		// The transaction could have been rollbacked already
+		// during COPY step due to deadlock handling.
+		if connectionPool.Tx[connNum] != nil {
+			connectionPool.MustCommit(connNum)
+		}
+	}
+}
+
 func backupGlobals(metadataFile *utils.FileWithByteCount) {
 	gplog.Info("Writing global database metadata")
 
-	backupResourceQueues(metadataFile)
-	backupResourceGroups(metadataFile)
-	backupRoles(metadataFile)
-	backupRoleGrants(metadataFile)
-	backupTablespaces(metadataFile)
+	if MustGetFlagBool(options.WITH_GLOBALS) {
+		backupClusterGlobals()
+	} else {
+		backupResourceQueues(metadataFile)
+		backupResourceGroups(metadataFile)
+		backupRoles(metadataFile)
+		backupRoleGrants(metadataFile)
+		backupTablespaces(metadataFile)
+	}
 	backupCreateDatabase(metadataFile)
 	backupDatabaseGUCs(metadataFile)
 	backupRoleGUCs(metadataFile)
@@ -199,6 +315,29 @@ func backupGlobals(metadataFile *utils.FileWithByteCount) {
 	logCompletionMessage("Global database metadata backup")
 }
 
+/*
+ * Writes the objects that belong to the cluster rather than to the database
+ * to a separate globals file, so that they can be restored once before any
+ * of the databases of the cluster.  They are printed in the same way as when
+ * they are written to the metadata file, so their TOC entries are moved from
+ * the global section to the cluster section afterward.
+ */
+func backupClusterGlobals() {
+	globalsFilename := globalFPInfo.GetGlobalsFilePath()
+	gplog.Info("Cluster-level global metadata will be written to %s", globalsFilename)
+	globalsFile := utils.NewFileWithByteCountFromFile(globalsFilename)
+	defer globalsFile.Close()
+
+	numGlobalEntries := len(globalTOC.GlobalEntries)
+	backupResourceQueues(globalsFile)
+	backupResourceGroups(globalsFile)
+	backupRoles(globalsFile)
+	backupRoleGrants(globalsFile)
+	backupTablespaces(globalsFile)
+	globalTOC.ClusterEntries = append(globalTOC.ClusterEntries, globalTOC.GlobalEntries[numGlobalEntries:]...)
+	globalTOC.GlobalEntries = globalTOC.GlobalEntries[:numGlobalEntries]
+}
+
 func backupPredata(metadataFile *utils.FileWithByteCount, tables []Table, tableOnly bool) {
 	if wasTerminated {
 		return
@@ -256,7 +395,17 @@ func backupData(tables []Table) {
 		gplog.Info("Data backup complete")
 		return
 	}
+	tablesToCopy, resumedRows := prepareDataBackup(tables)
+	defer stopDataBackup()
+	copyTableData(tables, tablesToCopy, resumedRows, nil)
+}
 
+/*
+ * Starts the helpers and the journal for the data backup and decides which
+ * tables to copy, and in what order.  The caller must call stopDataBackup
+ * once the data is copied.
+ */
+func prepareDataBackup(tables []Table) ([]Table, map[uint32]int64) {
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
 		gplog.Verbose("Initializing pipes and gpbackup_helper on segments for single data file backup")
 		utils.VerifyHelperVersionOnSegments(version, globalCluster)
@@ -271,14 +420,96 @@ func backupData(tables []Table) {
 		compressStr := fmt.Sprintf(" --compression-level %d --compression-type %s", MustGetFlagInt(options.COMPRESSION_LEVEL), MustGetFlagString(options.COMPRESSION_TYPE))
 		if MustGetFlagBool(options.NO_COMPRESSION) {
 			compressStr = " --compression-level 0"
+		} else if compressionWorkers := MustGetFlagInt(options.COMPRESSION_WORKERS); compressionWorkers > 1 {
+			compressStr += fmt.Sprintf(" --compression-workers %d", compressionWorkers)
+		}
+		/*
+		 * The agents can only be restarted if they checkpoint the data file,
+		 * which cannot be truncated once it is streamed to a plugin.
+		 */
+		canRestartHelpers := MustGetFlagString(options.PLUGIN_CONFIG) == ""
+		agentFlagsStr := compressStr + " --heartbeat"
+		if canRestartHelpers {
+			agentFlagsStr += " --checkpoint"
 		}
 		// Do not pass through the --on-error-continue flag because it does not apply to gpbackup
 		utils.StartGpbackupHelpers(globalCluster, globalFPInfo, "--backup-agent",
-			MustGetFlagString(options.PLUGIN_CONFIG), compressStr, false, false, &wasTerminated)
+			MustGetFlagString(options.PLUGIN_CONFIG), agentFlagsStr, false, false, &wasTerminated)
+		helperMonitor = NewHelperMonitor(canRestartHelpers, agentFlagsStr)
+		helperMonitor.Start()
+	}
+	if MustGetFlagBool(options.DEDUP) {
+		utils.VerifyHelperVersionOnSegments(version, globalCluster)
+	}
+	setDataFiles(tables)
+	tablesToCopy := tables
+	resumedRows := make(map[uint32]int64)
+	if isResumableBackup() {
+		journalFilename := globalFPInfo.GetBackupJournalFilePath()
+		if MustGetFlagString(options.RESUME) != "" {
+			journaledRows, err := ReadBackupJournal(journalFilename)
+			gplog.FatalOnError(err)
+			resumedRows = GetResumedTables(tables, journaledRows)
+			gplog.Info("Data for %d tables was backed up before the interruption and will not be backed up again", len(resumedRows))
+			tablesToCopy = make([]Table, 0, len(tables))
+			for _, table := range tables {
+				if _, ok := resumedRows[table.Oid]; !ok {
+					tablesToCopy = append(tablesToCopy, table)
+				}
+			}
+		}
+		var err error
+		backupJournal, err = NewBackupJournal(journalFilename)
+		gplog.FatalOnError(err)
+	}
+	checkBackupDiskSpace(tablesToCopy)
+	/*
+	 * The total size of the tables is recorded in the backup history so that
+	 * a later --dry-run can estimate how long a backup will take.
+	 */
+	relations := make([]Relation, 0, len(tables))
+	for _, table := range tables {
+		relations = append(relations, table.Relation)
+	}
+	tableSizes = GetRelationSizes(connectionPool, relations)
+	backupReport.BackupConfig.DataSize = GetTotalDataSize(tables, tableSizes)
+	splitTables = retrieveSplitTables(tablesToCopy)
+	if len(splitPartitionRoots) > 0 || len(splitTables) > 0 {
+		tablesToCopy = SortTablesBySize(tablesToCopy, tableSizes)
+	}
+	if MustGetFlagBool(options.CONTENDED_TABLES_FIRST) {
+		lockWaiters := GetRelationLockWaiters(connectionPool, relations)
+		gplog.Verbose("Backing up the data of %d table(s) with waiting lock requests first", len(lockWaiters))
+		tablesToCopy = SortTablesByLockWaiters(tablesToCopy, lockWaiters)
+	}
+	writePreflightSummary(tables)
+	if MustGetFlagBool(options.TABLE_TIMINGS) {
+		tableTimings = NewTableTimingRecorder()
+	}
+	return tablesToCopy, resumedRows
+}
+
+func stopDataBackup() {
+	helperMonitor.Stop()
+	if backupJournal != nil {
+		backupJournal.Close()
 	}
+}
+
+/*
+ * If mainWorkerReady is not nil, worker 0 does not start copying data until
+ * it is closed.
+ */
+func copyTableData(tables []Table, tablesToCopy []Table, resumedRows map[uint32]int64, mainWorkerReady <-chan struct{}) {
 	gplog.Info("Writing data to file")
-	rowsCopiedMaps := backupDataForAllTables(tables)
-	AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
+	rowsCopiedMaps := backupDataForAllTables(tablesToCopy, mainWorkerReady)
+	AddTableDataEntriesToTOC(tables, append(rowsCopiedMaps, resumedRows))
+	if !wasTerminated {
+		writeTableTimings()
+	}
+	if MustGetFlagBool(options.DEDUP) && !wasTerminated {
+		backupReport.DedupStats = writeChunkIndexes()
+	}
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) && MustGetFlagString(options.PLUGIN_CONFIG) != "" {
 		pluginConfig.BackupSegmentTOCs(globalCluster, globalFPInfo)
 	}
@@ -295,7 +526,11 @@ func backupPostdata(metadataFile *utils.FileWithByteCount) {
 	backupIndexes(metadataFile)
 	backupRules(metadataFile)
 	backupTriggers(metadataFile)
+	if connectionPool.Version.AtLeast("7") {
+		backupRowSecurity(metadataFile)
+	}
 	if connectionPool.Version.AtLeast("6") {
+		backupMaterializedViewRefreshes(metadataFile)
 		backupDefaultPrivileges(metadataFile)
 		if len(MustGetFlagStringArray(options.INCLUDE_SCHEMA)) == 0 {
 			backupEventTriggers(metadataFile)
@@ -318,15 +553,42 @@ func backupStatistics(tables []Table) {
 	logCompletionMessage("Query planner statistics backup")
 }
 
+/*
+ * Records the value of each sequence once the data has been copied, as rows
+ * copied after the metadata was written may have used more of the sequence.
+ */
+func backupSequenceValues() {
+	if wasTerminated {
+		return
+	}
+	gplog.Verbose("Recording sequence values")
+	for _, sequence := range GetAllSequences(connectionPool) {
+		globalTOC.SequenceValues = append(globalTOC.SequenceValues, toc.SequenceValue{
+			Schema:   sequence.Schema,
+			Name:     sequence.Name,
+			LastVal:  sequence.Definition.LastVal,
+			IsCalled: sequence.Definition.IsCalled,
+		})
+	}
+}
+
 func DoTeardown() {
 	backupFailed := false
+	var runSummary *report.RunSummary
+	errMsg := ""
 	defer func() {
+		runStatus.Finish(backupFailed)
 		DoCleanup(backupFailed)
 
 		errorCode := gplog.GetErrorCode()
-		if errorCode == 0 {
+		if errorCode == 0 && globalFPInfo.Timestamp != "" {
 			gplog.Info("Backup completed successfully")
 		}
+		if errorCode == 0 && len(slaViolations) > 0 {
+			gplog.Warn("Backup missed %d SLA target(s)", len(slaViolations))
+			errorCode = report.SLAViolationExitCode
+		}
+		logRunSummary(runSummary, errorCode, errMsg)
 		os.Exit(errorCode)
 	}()
 
@@ -341,6 +603,9 @@ func DoTeardown() {
 		}
 		backupFailed = true
 	}
+	if globalTOC != nil {
+		globalTOC.CloseProgressFile()
+	}
 	if wasTerminated {
 		/*
 		 * Don't print an error or create a report file if the backup was canceled,
@@ -355,7 +620,7 @@ func DoTeardown() {
 	if errStr != "" {
 		fmt.Println(errStr)
 	}
-	errMsg := report.ParseErrorMessage(errStr)
+	errMsg = report.ParseErrorMessage(errStr)
 
 	/*
 	 * Only create a report file if we fail after the cluster is initialized
@@ -375,19 +640,40 @@ func DoTeardown() {
 		if backupReport != nil {
 			if !backupFailed {
 				backupReport.BackupConfig.Status = history.BackupStatusSucceed
+				// The journal and TOC progress file are only needed for a backup that did not complete
+				_ = os.Remove(globalFPInfo.GetBackupJournalFilePath())
+				_ = os.Remove(globalFPInfo.GetTOCProgressFilePath())
 			}
 			backupReport.ConstructBackupParamsString()
+			if size := getBackupSize(); size > 0 {
+				backupReport.BackupConfig.BackupSize = size
+			}
 			err := history.WriteBackupHistory(historyFilename, &backupReport.BackupConfig)
 			if err != nil {
 				gplog.Error(fmt.Sprintf("%v", err))
 			}
+			if isHistoryDBRun() {
+				err = writeBackupHistoryToDB([]history.BackupConfig{backupReport.BackupConfig})
+				if err != nil {
+					gplog.Error("Unable to record backup in history database: %v", err)
+				}
+			}
 			history.WriteConfigFile(&backupReport.BackupConfig, configFilename)
 			if backupReport.BackupConfig.EndTime == "" {
 				backupReport.BackupConfig.EndTime = history.CurrentTimestamp()
 			}
 			endtime, _ := time.ParseInLocation("20060102150405", backupReport.BackupConfig.EndTime, operating.System.Local)
+			if !backupFailed {
+				slaViolations = getSLAViolations(endtime, historyFilename)
+				backupReport.SLAViolations = slaViolations
+			}
+			backupReport.ResourceUsage = getResourceUsage()
 			backupReport.WriteBackupReportFile(reportFilename, globalFPInfo.Timestamp, endtime, objectCounts, errMsg)
-			report.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gpbackup", !backupFailed)
+			summary := getRunSummary(gplog.GetErrorCode())
+			summary.ReportFile = reportFilename
+			runSummary = &summary
+			report.EmailReport(globalCluster, reportFilename, summary)
+			report.SendWebhookNotifications(globalCluster, reportFilename, summary, errMsg)
 			if pluginConfig != nil {
 				err = pluginConfig.BackupFile(configFilename)
 				if err != nil {
@@ -408,6 +694,164 @@ func DoTeardown() {
 	}
 }
 
+/*
+ * Checks the backup against the SLA targets for the database, if any, and
+ * logs a warning for each target that was missed.  The age of a backup is the
+ * time between it and the previous successful backup of the database.
+ */
+func getSLAViolations(endTime time.Time, historyFilename string) []string {
+	if slaTargets == nil {
+		return nil
+	}
+	startTime, _ := time.ParseInLocation("20060102150405", globalFPInfo.Timestamp, operating.System.Local)
+	numBytes := int64(-1)
+	if backupReport.BackupConfig.BackupSize > 0 {
+		numBytes = backupReport.BackupConfig.BackupSize
+	}
+	age := time.Duration(-1)
+	if backupHistory, err := history.NewHistory(historyFilename); err == nil {
+		if previousTimestamp := GetPreviousBackupTimestamp(backupHistory, backupReport.BackupConfig.DatabaseName, globalFPInfo.Timestamp); previousTimestamp != "" {
+			previousTime, _ := time.ParseInLocation("20060102150405", previousTimestamp, operating.System.Local)
+			age = startTime.Sub(previousTime)
+		}
+	}
+	violations := slaTargets.GetViolations(endTime.Sub(startTime), numBytes, age)
+	for _, violation := range violations {
+		gplog.Warn("SLA violation: %s", violation)
+	}
+	return violations
+}
+
+/*
+ * Returns the timestamp of the most recent successful backup of the database
+ * taken before the given timestamp, or an empty string if there is none.
+ */
+func GetPreviousBackupTimestamp(backupHistory *history.History, dbName string, timestamp string) string {
+	previousTimestamp := ""
+	for _, backupConfig := range backupHistory.BackupConfigs {
+		if backupConfig.DatabaseName != dbName || backupConfig.Failed() || backupConfig.DateDeleted != "" {
+			continue
+		}
+		if backupConfig.Timestamp < timestamp && backupConfig.Timestamp > previousTimestamp {
+			previousTimestamp = backupConfig.Timestamp
+		}
+	}
+	return previousTimestamp
+}
+
+/*
+ * If the summary was already gathered for the email report, only the final
+ * exit status is updated so that the backup size is not calculated twice.
+ */
+func logRunSummary(summary *report.RunSummary, errorCode int, errMsg string) {
+	defer func() {
+		if err := recover(); err != nil {
+			gplog.Warn("Unable to write run summary: %v", err)
+		}
+	}()
+
+	if summary == nil {
+		newSummary := getRunSummary(errorCode)
+		summary = &newSummary
+	}
+	summary.ExitCode = errorCode
+	summary.Status = report.GetRunStatus(errorCode, wasTerminated)
+	if errMsg != "" {
+		summary.Errors = []string{errMsg}
+	}
+	report.LogRunSummary(*summary)
+	if machineOutput != nil {
+		err := report.WriteMachineOutput(machineOutput, *summary)
+		if err != nil {
+			gplog.Warn("Unable to write machine output: %v", err)
+		}
+	}
+}
+
+func getRunSummary(errorCode int) report.RunSummary {
+	summary := report.RunSummary{
+		Utility:       "gpbackup",
+		RunID:         globalFPInfo.Timestamp,
+		Type:          "full",
+		Status:        report.GetRunStatus(errorCode, wasTerminated),
+		Bytes:         -1,
+		ObjectCounts:  objectCounts,
+		ExitCode:      errorCode,
+		SLAViolations: slaViolations,
+	}
+	if connectionPool != nil {
+		summary.Database = connectionPool.DBName
+	}
+	if MustGetFlagBool(options.DIFFERENTIAL) {
+		summary.Type = "differential"
+	} else if MustGetFlagBool(options.INCREMENTAL) {
+		summary.Type = "incremental"
+	} else if MustGetFlagBool(options.DATA_ONLY) {
+		summary.Type = "data-only"
+	} else if MustGetFlagBool(options.METADATA_ONLY) {
+		summary.Type = "metadata-only"
+	} else if IsExpireRun() {
+		summary.Type = "expire"
+	} else if MustGetFlagString(options.LIST) != "" || MustGetFlagBool(options.LIST_BACKUPS) || MustGetFlagBool(options.LIST_RESTORES) {
+		summary.Type = "list"
+	} else if MustGetFlagBool(options.MIGRATE_HISTORY) {
+		summary.Type = "migrate-history"
+	} else if MustGetFlagBool(options.DRY_RUN) {
+		summary.Type = "dry-run"
+	} else if MustGetFlagBool(options.ESTIMATE) {
+		summary.Type = "estimate"
+	} else if len(MustGetFlagStringSlice(options.DIFF)) > 0 {
+		summary.Type = "diff"
+	}
+	// gpbackup stops at the first error, so there is at most one to report
+	if errorCode != 0 {
+		summary.ErrorCount = 1
+	}
+	if globalFPInfo.Timestamp != "" {
+		startTime, _ := time.ParseInLocation("20060102150405", globalFPInfo.Timestamp, operating.System.Local)
+		summary.Duration = operating.System.Now().Sub(startTime)
+		if backupReport != nil && backupReport.BackupConfig.BackupSize > 0 {
+			summary.Bytes = backupReport.BackupConfig.BackupSize
+		} else {
+			summary.Bytes = getBackupSize()
+		}
+	}
+	return summary
+}
+
+/*
+ * Returns -1 if the size cannot be determined, as is the case for plugin
+ * backups where the data files are not stored locally and for client mode
+ * where the segment hosts cannot be reached over ssh.  A metadata-only backup
+ * only writes files on the master, so the segment hosts are not contacted to
+ * measure it.
+ */
+func getBackupSize() int64 {
+	if pluginConfig != nil || globalCluster == nil || MustGetFlagBool(options.CLIENT_MODE) {
+		return -1
+	}
+	var size int64
+	var err error
+	if MustGetFlagBool(options.METADATA_ONLY) {
+		size, err = utils.GetBackupSizeOnMaster(globalCluster, globalFPInfo)
+	} else {
+		size, err = utils.GetBackupSizeOnAllHosts(globalCluster, globalFPInfo)
+	}
+	if err != nil {
+		gplog.Verbose(err.Error())
+		return -1
+	}
+	return size
+}
+
+func getResourceUsage() *report.ResourceUsage {
+	resourceUsage := report.NewResourceUsage(utils.GetPeakMemoryUsage(), false)
+	if MustGetFlagBool(options.SINGLE_DATA_FILE) && !MustGetFlagBool(options.METADATA_ONLY) {
+		resourceUsage.AddHelperUsage(globalCluster, utils.GetHelperResourceUsageOnSegments(globalCluster, globalFPInfo))
+	}
+	return resourceUsage
+}
+
 func DoCleanup(backupFailed bool) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -431,6 +875,7 @@ func DoCleanup(backupFailed bool) {
 			utils.CleanUpHelperFilesOnAllHosts(globalCluster, globalFPInfo)
 		}
 	}
+	backupDirectoryLock.Release()
 	err := backupLockFile.Unlock()
 	if err != nil && backupLockFile != "" {
 		gplog.Warn("Failed to remove lock file %s.", backupLockFile)
@@ -439,6 +884,12 @@ func DoCleanup(backupFailed bool) {
 		cancelBlockedQueries(globalFPInfo.Timestamp)
 		connectionPool.Close()
 	}
+	if backupFailed && globalFPInfo.Timestamp != "" {
+		cleanUpFailedBackup()
+	}
+	if s3PluginConfigFile != "" {
+		_ = utils.RemoveFileIfExists(s3PluginConfigFile)
+	}
 }
 
 // Cancel blocked gpbackup queries waiting for locks.
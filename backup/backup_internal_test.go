@@ -1,7 +1,21 @@
 package backup
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -22,4 +36,127 @@ var _ = Describe("backup internal tests", func() {
 			Expect(string(log.Contents())).To(ContainSubstring("Data backup complete"))
 		})
 	})
+	Describe("GetPreviousBackupTimestamp", func() {
+		backupHistory := &history.History{BackupConfigs: []history.BackupConfig{
+			{DatabaseName: "testdb", Timestamp: "20170105010101", Status: history.BackupStatusSucceed},
+			{DatabaseName: "testdb", Timestamp: "20170104010101", Status: history.BackupStatusFailed},
+			{DatabaseName: "otherdb", Timestamp: "20170103020202", Status: history.BackupStatusSucceed},
+			{DatabaseName: "testdb", Timestamp: "20170103010101", Status: history.BackupStatusSucceed},
+			{DatabaseName: "testdb", Timestamp: "20170102010101", Status: history.BackupStatusSucceed, DateDeleted: "20170106010101"},
+		}}
+		It("returns the most recent successful backup of the database before the given timestamp", func() {
+			Expect(GetPreviousBackupTimestamp(backupHistory, "testdb", "20170105010101")).To(Equal("20170103010101"))
+		})
+		It("returns an empty string if there is no earlier backup", func() {
+			Expect(GetPreviousBackupTimestamp(backupHistory, "testdb", "20170103010101")).To(Equal(""))
+		})
+	})
+	Describe("getDatabaseBackupArgs", func() {
+		It("replaces the options that select several databases with those of a single database", func() {
+			args := []string{"--dbname", "sales,hr", "--consistent-snapshot", "--jobs", "4"}
+
+			dbArgs := getDatabaseBackupArgs(args, "sales", "20170101010101", "00000003-00000002-1")
+
+			Expect(dbArgs).To(Equal([]string{"--jobs", "4", "--dbname", "sales", "--database-group", "20170101010101", "--import-snapshot", "00000003-00000002-1"}))
+		})
+		It("returns arguments that pass the flag validation of the backup of the database", func() {
+			args := []string{"--all-databases", "--consistent-snapshot=true", "--backup-dir", "/tmp/backups", "--jobs", "4"}
+
+			dbArgs := getDatabaseBackupArgs(args, "sales", "20170101010101", "00000003-00000002-1")
+
+			dbFlags := pflag.NewFlagSet("gpbackup", pflag.ContinueOnError)
+			SetCmdFlags(dbFlags)
+			Expect(dbFlags.Parse(dbArgs)).To(Succeed())
+			validateFlagCombinations(dbFlags)
+			validateFlagValues()
+			Expect(MustGetFlagString(options.DBNAME)).To(Equal("sales"))
+			Expect(MustGetFlagBool(options.CONSISTENT_SNAPSHOT)).To(BeFalse())
+			Expect(MustGetFlagString(options.IMPORT_SNAPSHOT)).To(Equal("00000003-00000002-1"))
+		})
+	})
+	Describe("metadata-only backups", func() {
+		var testExecutor *testhelper.TestExecutor
+		BeforeEach(func() {
+			testExecutor = &testhelper.TestExecutor{LocalOutput: "1024\n", ClusterOutput: &cluster.RemoteOutput{}}
+			globalCluster = cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"},
+				{ContentID: 0, Hostname: "sdw1", DataDir: "/data/gpseg0"}, {ContentID: 1, Hostname: "sdw2", DataDir: "/data/gpseg1"}})
+			globalCluster.Executor = &masterOnlyExecutor{testExecutor}
+			globalFPInfo = filepath.NewFilePathInfo(globalCluster, "", "20170101010101", "gpseg")
+			pluginConfig = nil
+			backupReport = nil
+			_ = cmdFlags.Set(options.METADATA_ONLY, "true")
+			_ = cmdFlags.Set(options.NO_SEGMENTS, "true")
+		})
+		AfterEach(func() {
+			globalFPInfo = filepath.FilePathInfo{}
+		})
+		It("refuses to run commands on the segment hosts with --no-segments", func() {
+			defer testhelper.ShouldPanicWithMessage("Cannot run commands on the segment hosts with --no-segments")
+			globalCluster.GenerateAndExecuteCommand("Listing backup directories", cluster.ON_SEGMENTS, func(contentID int) string {
+				return "ls"
+			})
+		})
+		It("measures the backup size without contacting the segment hosts", func() {
+			summary := getRunSummary(0)
+
+			Expect(summary.Bytes).To(Equal(int64(1024)))
+			Expect(testExecutor.LocalCommands).To(Equal([]string{"du -sb /data/gpseg-1/backups/20170101/20170101010101 | cut -f1"}))
+			Expect(testExecutor.ClusterCommands).To(BeEmpty())
+		})
+		It("deletes the backup without contacting the segment hosts", func() {
+			err := deleteBackup(history.BackupConfig{Timestamp: "20170101010101", MetadataOnly: true}, "gpseg")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testExecutor.LocalCommands).To(Equal([]string{"rm -rf /data/gpseg-1/backups/20170101/20170101010101"}))
+			Expect(testExecutor.ClusterCommands).To(BeEmpty())
+		})
+		It("sends the email report and webhook notifications without contacting the segment hosts", func() {
+			testExecutor.LocalError = errors.New("not found")
+			summary := report.RunSummary{Utility: "gpbackup", Status: "success"}
+
+			report.EmailReport(globalCluster, "/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_report", summary)
+			report.SendWebhookNotifications(globalCluster, "/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_report", summary, "")
+
+			Expect(testExecutor.LocalCommands).ToNot(BeEmpty())
+			Expect(testExecutor.ClusterCommands).To(BeEmpty())
+		})
+	})
+	Describe("pruneChunks", func() {
+		var backupDir string
+		var lockFilename string
+		var fpInfo filepath.FilePathInfo
+		var testExecutor *testhelper.TestExecutor
+		BeforeEach(func() {
+			var err error
+			backupDir, err = ioutil.TempDir("", "prune_chunks")
+			Expect(err).ToNot(HaveOccurred())
+			testExecutor = &testhelper.TestExecutor{ClusterOutput: &cluster.RemoteOutput{Commands: []cluster.ShellCommand{{Content: 0, Stdout: "3"}}}}
+			globalCluster = cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"}, {ContentID: 0, Hostname: "localhost", DataDir: "/data/gpseg0"}})
+			globalCluster.Executor = testExecutor
+			fpInfo = filepath.NewFilePathInfo(globalCluster, backupDir, "20170101010101", "gpseg")
+			Expect(os.MkdirAll(fpInfo.GetBackupRootDirForContent(-1), 0755)).To(Succeed())
+			lockFilename = path.Join(fpInfo.GetBackupRootDirForContent(-1), utils.DirectoryLockFilename)
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(backupDir)
+		})
+		It("removes the unused chunks while holding the lock on the backup directory", func() {
+			pruneChunks(fpInfo)
+
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+			Expect(testExecutor.ClusterCommands[0][0].CommandString).To(ContainSubstring("gpbackup_helper --dedup-prune --content 0"))
+			Expect(utils.FileExists(lockFilename)).To(BeFalse())
+		})
+		It("does not remove chunks while a backup holds the lock on the backup directory", func() {
+			heartbeat := operating.System.Now().Format("20060102150405")
+			lockContents := fmt.Sprintf("utility: gpbackup\ntimestamp: \"20170102010101\"\nhost: otherhost\npid: 1\nstart_time: \"%s\"\nheartbeat: \"%s\"\n", heartbeat, heartbeat)
+			Expect(ioutil.WriteFile(lockFilename, []byte(lockContents), 0644)).To(Succeed())
+
+			pruneChunks(fpInfo)
+
+			Expect(testExecutor.NumExecutions).To(Equal(0))
+			Expect(string(log.Contents())).To(ContainSubstring("Unused chunks were not removed"))
+			Expect(utils.FileExists(lockFilename)).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,159 @@
+package backup
+
+/*
+ * This file contains functions for removing the partial files that a failed
+ * or terminated backup leaves in the backup directories of every host, either
+ * as the backup fails, as set by --cleanup-on-failure, or later with
+ * --cleanup.
+ */
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	CLEANUP_ON_FAILURE_ASK    = "ask"
+	CLEANUP_ON_FAILURE_ALWAYS = "always"
+	CLEANUP_ON_FAILURE_NEVER  = "never"
+)
+
+func ValidateCleanupOnFailureMode(mode string) error {
+	if mode != CLEANUP_ON_FAILURE_ASK && mode != CLEANUP_ON_FAILURE_ALWAYS && mode != CLEANUP_ON_FAILURE_NEVER {
+		return errors.Errorf("Invalid value '%s' for --cleanup-on-failure.  Valid values are '%s', '%s', and '%s'.", mode,
+			CLEANUP_ON_FAILURE_ASK, CLEANUP_ON_FAILURE_ALWAYS, CLEANUP_ON_FAILURE_NEVER)
+	}
+	return nil
+}
+
+func DoCleanupBackup() {
+	SetLoggerVerbosity()
+	timestamp := MustGetFlagString(options.CLEANUP)
+	// Keeps the backup from being resumed while its files are removed
+	createBackupLockFile(timestamp)
+	fpInfo := getMasterFPInfo(MustGetFlagString(options.DBNAME))
+	historyFilename := fpInfo.GetBackupHistoryFilePath()
+	backupConfig, err := FindFailedBackupConfig(readBackupHistory(historyFilename), timestamp)
+	gplog.FatalOnError(err)
+
+	backupDir := MustGetFlagString(options.BACKUP_DIR)
+	if backupConfig != nil && backupDir == "" {
+		backupDir = backupConfig.BackupDir
+	}
+	segPrefix, err := filepath.ParseSegPrefix(backupDir, timestamp)
+	gplog.FatalOnError(err)
+	fpInfo = filepath.NewFilePathInfo(globalCluster, backupDir, timestamp, segPrefix)
+	if _, statErr := os.Stat(fpInfo.GetDirForContent(-1)); statErr != nil && backupConfig == nil {
+		gplog.Fatal(errors.Errorf("Backup %s not found in %s", timestamp, fpInfo.GetDirForContent(-1)), "")
+	}
+
+	configureS3Storage()
+	if pluginConfigFlag := MustGetFlagString(options.PLUGIN_CONFIG); pluginConfigFlag != "" {
+		pluginConfig, err = utils.ReadPluginConfig(pluginConfigFlag)
+		gplog.FatalOnError(err)
+		pluginConfig.CheckPluginExistsOnAllHosts(globalCluster)
+		pluginConfig.CopyPluginConfigToAllHosts(globalCluster)
+		defer pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
+	}
+
+	err = removeFailedBackup(historyFilename, history.BackupConfig{Timestamp: timestamp, BackupDir: backupDir}, segPrefix)
+	gplog.FatalOnError(err)
+	gplog.Info("Removed the files of backup %s", timestamp)
+}
+
+/*
+ * Called once a backup that had chosen its timestamp has failed or been
+ * terminated and its connections are closed, so that no COPY is still
+ * writing to the files being removed.  Plugin backups are not removed here,
+ * as the plugin has already been cleaned up.
+ */
+func cleanUpFailedBackup() {
+	timestamp := globalFPInfo.Timestamp
+	keptMessage := fmt.Sprintf("The files of backup %s were kept.  Run gpbackup --cleanup %s to remove them from all hosts.", timestamp, timestamp)
+	switch MustGetFlagString(options.CLEANUP_ON_FAILURE) {
+	case CLEANUP_ON_FAILURE_NEVER:
+		gplog.Info(keptMessage)
+		return
+	case CLEANUP_ON_FAILURE_ASK:
+		if !utils.IsInteractive() {
+			gplog.Info(keptMessage)
+			return
+		}
+		fmt.Printf("Remove the files of failed backup %s from all hosts? [y/N] ", timestamp)
+		if !utils.Confirm(os.Stdin) {
+			gplog.Info(keptMessage)
+			return
+		}
+	}
+
+	gplog.Info("Removing the files of failed backup %s", timestamp)
+	fallbackConfig := history.BackupConfig{Timestamp: timestamp, BackupDir: MustGetFlagString(options.BACKUP_DIR), MetadataOnly: MustGetFlagBool(options.METADATA_ONLY)}
+	if backupReport != nil {
+		fallbackConfig = backupReport.BackupConfig
+	}
+	err := removeFailedBackup(globalFPInfo.GetBackupHistoryFilePath(), fallbackConfig, globalFPInfo.UserSpecifiedSegPrefix)
+	if err != nil {
+		gplog.Warn("Unable to remove the files of backup %s: %v", timestamp, err)
+	}
+}
+
+/*
+ * Removes the backup directories of the backup on every host, and marks the
+ * backup deleted in the backup history if it was recorded there.  A backup
+ * that was terminated is not recorded, so the given configuration is used to
+ * find its files instead.
+ */
+func removeFailedBackup(historyFilename string, fallbackConfig history.BackupConfig, segPrefix string) error {
+	backupConfig, err := FindFailedBackupConfig(readBackupHistory(historyFilename), fallbackConfig.Timestamp)
+	if err != nil {
+		return err
+	}
+	recorded := backupConfig != nil
+	if !recorded {
+		backupConfig = &fallbackConfig
+	}
+	err = deleteBackup(*backupConfig, segPrefix)
+	if err != nil || !recorded {
+		return err
+	}
+	dateDeleted := history.CurrentTimestamp()
+	err = history.MarkBackupsDeleted(historyFilename, []string{backupConfig.Timestamp}, dateDeleted)
+	if err != nil {
+		return err
+	}
+	if isHistoryDBRun() {
+		backupConfig.DateDeleted = dateDeleted
+		return writeBackupHistoryToDB([]history.BackupConfig{*backupConfig})
+	}
+	return nil
+}
+
+/*
+ * Returns the failed backup with the given timestamp, or nil if it is not in
+ * the history, as is the case for a backup that was terminated.  A backup that
+ * completed is never returned, as it is deleted with --delete-before or
+ * --retention-count instead.
+ */
+func FindFailedBackupConfig(backupHistory *history.History, timestamp string) (*history.BackupConfig, error) {
+	var failedConfig *history.BackupConfig
+	for i, backupConfig := range backupHistory.BackupConfigs {
+		if backupConfig.Timestamp != timestamp {
+			continue
+		}
+		if !backupConfig.Failed() {
+			return nil, errors.Errorf("Backup %s completed successfully and cannot be removed with --cleanup.  Use --delete-before or --retention-count to delete it.", timestamp)
+		}
+		if backupConfig.DateDeleted != "" {
+			return nil, errors.Errorf("Backup %s was already removed on %s", timestamp, backupConfig.DateDeleted)
+		}
+		failedConfig = &backupHistory.BackupConfigs[i]
+	}
+	return failedConfig, nil
+}
@@ -0,0 +1,50 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/history"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/cleanup tests", func() {
+	Describe("ValidateCleanupOnFailureMode", func() {
+		It("accepts the valid modes", func() {
+			Expect(backup.ValidateCleanupOnFailureMode("ask")).To(Succeed())
+			Expect(backup.ValidateCleanupOnFailureMode("always")).To(Succeed())
+			Expect(backup.ValidateCleanupOnFailureMode("never")).To(Succeed())
+		})
+		It("rejects an invalid mode", func() {
+			Expect(backup.ValidateCleanupOnFailureMode("sometimes")).To(MatchError("Invalid value 'sometimes' for --cleanup-on-failure.  Valid values are 'ask', 'always', and 'never'."))
+		})
+	})
+	Describe("FindFailedBackupConfig", func() {
+		var backupHistory *history.History
+		BeforeEach(func() {
+			backupHistory = &history.History{BackupConfigs: []history.BackupConfig{
+				{Timestamp: "20170103010101", Status: history.BackupStatusFailed, BackupDir: "/tmp/backups"},
+				{Timestamp: "20170102010101", Status: history.BackupStatusSucceed},
+				{Timestamp: "20170101010101", Status: history.BackupStatusFailed, DateDeleted: "20170104010101"},
+			}}
+		})
+		It("returns a failed backup", func() {
+			backupConfig, err := backup.FindFailedBackupConfig(backupHistory, "20170103010101")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupConfig.BackupDir).To(Equal("/tmp/backups"))
+		})
+		It("returns nothing for a backup that is not in the history", func() {
+			backupConfig, err := backup.FindFailedBackupConfig(backupHistory, "20170105010101")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupConfig).To(BeNil())
+		})
+		It("returns an error for a backup that completed", func() {
+			_, err := backup.FindFailedBackupConfig(backupHistory, "20170102010101")
+			Expect(err).To(MatchError(ContainSubstring("Backup 20170102010101 completed successfully and cannot be removed with --cleanup")))
+		})
+		It("returns an error for a backup that was already removed", func() {
+			_, err := backup.FindFailedBackupConfig(backupHistory, "20170101010101")
+			Expect(err).To(MatchError("Backup 20170101010101 was already removed on 20170104010101"))
+		})
+	})
+})
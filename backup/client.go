@@ -0,0 +1,72 @@
+package backup
+
+/*
+ * This file contains functions for --client-mode, in which gpbackup runs on a
+ * host other than the master, such as a workstation or a CI runner, and
+ * reaches the cluster only through its database connection.  The metadata and
+ * other master files of the backup are written to --backup-dir on the local
+ * host, while the segments write their data files to --backup-dir on their
+ * own hosts through COPY ... ON SEGMENT, as they do in any backup.
+ */
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+/*
+ * Options that run commands on the segment hosts over ssh, or that read or
+ * remove files in the backup directories of the segments, cannot be used in
+ * client mode.
+ */
+func validateClientModeFlags(flags *pflag.FlagSet) {
+	if !MustGetFlagBool(options.CLIENT_MODE) {
+		return
+	}
+	if MustGetFlagString(options.BACKUP_DIR) == "" {
+		gplog.Fatal(errors.Errorf("--backup-dir must be specified with --client-mode"), "")
+	}
+	for _, flagName := range []string{options.SINGLE_DATA_FILE, options.PLUGIN_CONFIG, options.DEDUP, options.RESUME,
+		options.MIRROR_FAILOVER, options.THROTTLE_CPU, options.THROTTLE_IOWAIT, options.DELETE_BEFORE,
+		options.RETENTION_COUNT, options.TEST_RESTORE} {
+		options.CheckExclusiveFlags(flags, options.CLIENT_MODE, flagName)
+	}
+}
+
+/*
+ * The history file is kept in the master data directory, which is not on
+ * this host in client mode, so the local backup directory is used instead.
+ */
+func useClientMasterDir(fpInfo *filepath.FilePathInfo) {
+	if MustGetFlagBool(options.CLIENT_MODE) {
+		fpInfo.SegDirMap[-1] = MustGetFlagString(options.BACKUP_DIR)
+	}
+}
+
+/*
+ * The segment directories are created by a COPY ON SEGMENT whose program makes
+ * the directory and discards the rows, as the segment hosts cannot be reached
+ * over ssh.
+ */
+func createBackupDirectoriesFromClient() {
+	err := os.MkdirAll(globalFPInfo.GetDirForContent(-1), 0755)
+	gplog.FatalOnError(err)
+	gplog.Info("Writing backup metadata to %s on this host", globalFPInfo.GetDirForContent(-1))
+	if MustGetFlagBool(options.METADATA_ONLY) {
+		return
+	}
+	if connectionPool.Version.Before("5") {
+		gplog.Fatal(errors.Errorf("--client-mode requires GPDB 5 or later to back up data"), "")
+	}
+	query := fmt.Sprintf("COPY (SELECT * FROM gp_dist_random('gp_id')) TO PROGRAM 'mkdir -p %s && cat > /dev/null' ON SEGMENT;", globalFPInfo.GetDirForCopyCommand())
+	_, err = connectionPool.Exec(query)
+	if err != nil {
+		gplog.Fatal(errors.Errorf("Unable to create backup directories on segments: %v", err), "")
+	}
+}
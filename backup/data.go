@@ -6,13 +6,18 @@ package backup
 
 import (
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/jackc/pgconn"
 	"gopkg.in/cheggaaa/pb.v1"
@@ -36,28 +41,64 @@ func ConstructTableAttributesList(columnDefs []ColumnDefinition) string {
 func AddTableDataEntriesToTOC(tables []Table, rowsCopiedMaps []map[uint32]int64) {
 	for _, table := range tables {
 		if !table.SkipDataBackup() {
+			// The streams of a split table may be copied by different connections
 			var rowsCopied int64
 			for _, rowsCopiedMap := range rowsCopiedMaps {
-				if val, ok := rowsCopiedMap[table.Oid]; ok {
-					rowsCopied = val
-					break
-				}
+				rowsCopied += rowsCopiedMap[table.Oid]
 			}
 			attributes := ConstructTableAttributesList(table.ColumnDefs)
-			globalTOC.AddMasterDataEntry(table.Schema, table.Name, table.Oid, attributes, rowsCopied, table.PartitionLevelInfo.RootName)
+			globalTOC.AddDataEntry(toc.MasterDataEntry{
+				Schema:          table.Schema,
+				Name:            table.Name,
+				Oid:             table.Oid,
+				AttributeString: attributes,
+				RowsCopied:      rowsCopied,
+				PartitionRoot:   table.PartitionLevelInfo.RootName,
+				Uncompressed:    getPipeThroughProgramForTable(table).Name == "cat" && utils.GetPipeThroughProgram().Name != "cat",
+				Size:            tableSizes[table.Oid],
+				Streams:         splitTables[table.Oid],
+				DataFile:        globalFPInfo.DataFiles[table.Oid],
+			})
 		}
 	}
 }
 
+/*
+ * In the directory layout, the data file of each table is named for the table
+ * rather than its oid, and the name is recorded in the TOC for gprestore.
+ */
+func setDataFiles(tables []Table) {
+	if MustGetFlagString(options.DATA_LAYOUT) != filepath.DataLayoutDirectory {
+		return
+	}
+	globalFPInfo.DataFiles = make(map[uint32]string, len(tables))
+	for _, table := range tables {
+		globalFPInfo.DataFiles[table.Oid] = filepath.GetDirectoryLayoutDataFile(utils.UnquoteIdent(table.Schema), utils.UnquoteIdent(table.Name))
+	}
+}
+
+/*
+ * TableSizes is set when progress is shown in bytes, in which case the
+ * progress bar is advanced by the size of each table as it is backed up.
+ */
 type BackupProgressCounters struct {
 	NumRegTables   int64
 	TotalRegTables int64
+	TableSizes     map[uint32]int64
 	ProgressBar    utils.ProgressBar
+	splitProgress  *splitTableProgress
 }
 
-func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite string, connNum int) (int64, error) {
-	checkPipeExistsCommand := ""
-	customPipeThroughCommand := utils.GetPipeThroughProgram().OutputCommand
+func getPipeThroughProgramForTable(table Table) utils.PipeThroughProgram {
+	if program, ok := compressionOverrides[table.FQN()]; ok {
+		return program
+	}
+	return utils.GetPipeThroughProgram()
+}
+
+func getCopyOutProgram(table Table, destinationToWrite string) string {
+	prepareCommand := ""
+	customPipeThroughCommand := getPipeThroughProgramForTable(table).OutputCommand
 	sendToDestinationCommand := ">"
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
 		/*
@@ -66,15 +107,38 @@ func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite
 		 * drive.  It will be copied to a user-specified directory, if any, once all
 		 * of the data is backed up.
 		 */
-		checkPipeExistsCommand = fmt.Sprintf("(test -p \"%s\" || (echo \"Pipe not found %s\">&2; exit 1)) && ", destinationToWrite, destinationToWrite)
+		prepareCommand = fmt.Sprintf("(test -p \"%s\" || (echo \"Pipe not found %s\">&2; exit 1)) && ", destinationToWrite, destinationToWrite)
 		customPipeThroughCommand = "cat -"
 	} else if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
 		sendToDestinationCommand = fmt.Sprintf("| %s backup_data %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath)
+	} else if MustGetFlagBool(options.DEDUP) {
+		// gpbackup_helper compresses each chunk itself
+		customPipeThroughCommand = GetDedupWriteCommand(&globalFPInfo)
+		sendToDestinationCommand = "--data-file"
+	} else if _, ok := globalFPInfo.DataFiles[table.Oid]; ok {
+		// Each table creates the directory of its schema if it does not exist yet
+		prepareCommand = fmt.Sprintf("mkdir -p %s && ", path.Dir(destinationToWrite))
 	}
 
-	copyCommand := fmt.Sprintf("PROGRAM '%s%s %s %s'", checkPipeExistsCommand, customPipeThroughCommand, sendToDestinationCommand, destinationToWrite)
+	return fmt.Sprintf("PROGRAM '%s%s %s %s'", prepareCommand, customPipeThroughCommand, sendToDestinationCommand, destinationToWrite)
+}
 
-	query := fmt.Sprintf("COPY %s TO %s WITH CSV DELIMITER '%s' ON SEGMENT IGNORE EXTERNAL PARTITIONS;", table.FQN(), copyCommand, tableDelim)
+func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite string, connNum int) (int64, error) {
+	query := fmt.Sprintf("COPY %s TO %s WITH CSV DELIMITER '%s' ON SEGMENT IGNORE EXTERNAL PARTITIONS;", table.FQN(), getCopyOutProgram(table, destinationToWrite), tableDelim)
+	return copyOut(connectionPool, query, connNum)
+}
+
+/*
+ * Copies the rows of one stream of a split table.  The columns are selected
+ * in the order in which COPY of the whole table would write them.
+ */
+func CopyTableStreamOut(connectionPool *dbconn.DBConn, table Table, stream int, numStreams int, destinationToWrite string, connNum int) (int64, error) {
+	query := fmt.Sprintf("COPY (SELECT * FROM %s WHERE %s) TO %s WITH CSV DELIMITER '%s' ON SEGMENT;",
+		table.FQN(), SplitTableStreamCondition(stream, numStreams), getCopyOutProgram(table, destinationToWrite), tableDelim)
+	return copyOut(connectionPool, query, connNum)
+}
+
+func copyOut(connectionPool *dbconn.DBConn, query string, connNum int) (int64, error) {
 	gplog.Verbose("Worker %d: %s", connNum, query)
 	result, err := connectionPool.Exec(query, connNum)
 	if err != nil {
@@ -85,6 +149,14 @@ func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite
 }
 
 func BackupSingleTableData(table Table, rowsCopiedMap map[uint32]int64, counters *BackupProgressCounters, whichConn int) error {
+	return backupTableData(DataCopyTask{Table: table, NumStreams: 1}, rowsCopiedMap, counters, whichConn)
+}
+
+func backupTableData(task DataCopyTask, rowsCopiedMap map[uint32]int64, counters *BackupProgressCounters, whichConn int) error {
+	if task.NumStreams > 1 {
+		return backupTableStreamData(task, rowsCopiedMap, counters, whichConn)
+	}
+	table := task.Table
 	atomic.AddInt64(&counters.NumRegTables, 1)
 	numTables := counters.NumRegTables //We save this so it won't be modified before we log it
 	if gplog.GetVerbosity() > gplog.LOGINFO {
@@ -97,19 +169,97 @@ func BackupSingleTableData(table Table, rowsCopiedMap map[uint32]int64, counters
 	destinationToWrite := ""
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
 		destinationToWrite = fmt.Sprintf("%s_%d", globalFPInfo.GetSegmentPipePathForCopyCommand(), table.Oid)
+	} else if MustGetFlagBool(options.DEDUP) {
+		destinationToWrite = globalFPInfo.GetTableBackupFilePathForCopyCommand(table.Oid, filepath.DedupDataFileExtension, false)
 	} else {
-		destinationToWrite = globalFPInfo.GetTableBackupFilePathForCopyCommand(table.Oid, utils.GetPipeThroughProgram().Extension, false)
+		destinationToWrite = globalFPInfo.GetTableBackupFilePathForCopyCommand(table.Oid, getPipeThroughProgramForTable(table).Extension, false)
 	}
+	start := time.Now()
 	rowsCopied, err := CopyTableOut(connectionPool, table, destinationToWrite, whichConn)
 	if err != nil {
 		return err
 	}
+	return recordTableData(table, start, rowsCopied, rowsCopiedMap, counters)
+}
+
+func recordTableData(table Table, start time.Time, rowsCopied int64, rowsCopiedMap map[uint32]int64, counters *BackupProgressCounters) error {
+	tableTimings.RecordCopy(table, start, time.Now(), rowsCopied)
 	rowsCopiedMap[table.Oid] = rowsCopied
-	counters.ProgressBar.Increment()
+	runStatus.AddTableCompleted(tableSizes[table.Oid])
+	if backupJournal != nil {
+		err := backupJournal.RecordTable(table.Oid, rowsCopied)
+		if err != nil {
+			return err
+		}
+	}
+	if counters.TableSizes != nil {
+		counters.ProgressBar.Add(int(counters.TableSizes[table.Oid]))
+	} else {
+		counters.ProgressBar.Increment()
+	}
 	return nil
 }
 
-func backupDataForAllTables(tables []Table) []map[uint32]int64 {
+/*
+ * Split tables are not recorded in the backup journal, as their files are not
+ * checked when resuming, so their data is always backed up again.
+ */
+func backupTableStreamData(task DataCopyTask, rowsCopiedMap map[uint32]int64, counters *BackupProgressCounters, whichConn int) error {
+	table := task.Table
+	if task.Stream == 0 {
+		atomic.AddInt64(&counters.NumRegTables, 1)
+	}
+	gplog.Verbose("Writing data for stream %d of %d of table %s to file", task.Stream+1, task.NumStreams, table.FQN())
+
+	destinationToWrite := globalFPInfo.GetTableStreamBackupFilePathForCopyCommand(table.Oid, task.Stream, getPipeThroughProgramForTable(table).Extension)
+	start := time.Now()
+	rowsCopied, err := CopyTableStreamOut(connectionPool, table, task.Stream, task.NumStreams, destinationToWrite, whichConn)
+	if err != nil {
+		return err
+	}
+	tableTimings.RecordCopy(table, start, time.Now(), rowsCopied)
+	rowsCopiedMap[table.Oid] += rowsCopied
+	if counters.TableSizes != nil {
+		counters.ProgressBar.Add(int(counters.TableSizes[table.Oid] / int64(task.NumStreams)))
+	}
+	if counters.splitProgress.finishStream(table.Oid) {
+		runStatus.AddTableCompleted(tableSizes[table.Oid])
+		if counters.TableSizes == nil {
+			counters.ProgressBar.Increment()
+		}
+	}
+	return nil
+}
+
+/*
+ * Orders the tables from largest to smallest.  As each worker takes the next
+ * table when it finishes the last one, this balances the largest tables, such
+ * as the leaf partitions of a large partitioned table, across the connections.
+ */
+func SortTablesBySize(tables []Table, sizes map[uint32]int64) []Table {
+	sortedTables := make([]Table, len(tables))
+	copy(sortedTables, tables)
+	sort.SliceStable(sortedTables, func(i int, j int) bool {
+		return sizes[sortedTables[i].Oid] > sizes[sortedTables[j].Oid]
+	})
+	return sortedTables
+}
+
+/*
+ * Orders the tables with the most waiting lock requests first, keeping the
+ * order of tables with the same number, so that the tables that sessions are
+ * waiting on are copied before the rest.
+ */
+func SortTablesByLockWaiters(tables []Table, lockWaiters map[uint32]int64) []Table {
+	sortedTables := make([]Table, len(tables))
+	copy(sortedTables, tables)
+	sort.SliceStable(sortedTables, func(i int, j int) bool {
+		return lockWaiters[sortedTables[i].Oid] > lockWaiters[sortedTables[j].Oid]
+	})
+	return sortedTables
+}
+
+func backupDataForAllTables(tables []Table, mainWorkerReady <-chan struct{}) []map[uint32]int64 {
 	var numExtOrForeignTables int64
 	for _, table := range tables {
 		if table.SkipDataBackup() {
@@ -117,24 +267,44 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 		}
 	}
 	counters := BackupProgressCounters{NumRegTables: 0, TotalRegTables: int64(len(tables)) - numExtOrForeignTables}
-	counters.ProgressBar = utils.NewProgressBar(int(counters.TotalRegTables), "Tables backed up: ", utils.PB_INFO)
+	var totalBytes int64
+	for _, table := range tables {
+		if !table.SkipDataBackup() {
+			totalBytes += tableSizes[table.Oid]
+		}
+	}
+	runStatus.StartData(counters.TotalRegTables, totalBytes)
+	if utils.UseByteProgress() {
+		counters.TableSizes = tableSizes
+		counters.ProgressBar = utils.NewByteProgressBar(totalBytes, "Data backed up: ", utils.PB_INFO)
+	} else {
+		counters.ProgressBar = utils.NewProgressBar(int(counters.TotalRegTables), "Tables backed up: ", utils.PB_INFO)
+	}
 	counters.ProgressBar.Start()
+	counters.splitProgress = newSplitTableProgress(splitTables)
 	rowsCopiedMaps := make([]map[uint32]int64, connectionPool.NumConns)
 	/*
 	 * We break when an interrupt is received and rely on
 	 * TerminateHangingCopySessions to kill any COPY statements
 	 * in progress if they don't finish on their own.
 	 */
-	tasks := make(chan Table, len(tables))
-	deferredTables := []Table{}
+	copyTasks := GetDataCopyTasks(tables, splitTables)
+	tasks := make(chan DataCopyTask, len(copyTasks))
+	deferredTables := []DataCopyTask{}
 	deferredTablesMutex := &sync.Mutex{}
 	var workerPool sync.WaitGroup
 	var copyErr error
+	throttle := startLoadThrottle()
+	queue := newCopyQueue()
 	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
 		rowsCopiedMaps[connNum] = make(map[uint32]int64)
 		workerPool.Add(1)
 		go func(whichConn int) {
 			defer workerPool.Done()
+			if whichConn == 0 && mainWorkerReady != nil {
+				// Connection 0 is in use by the metadata backup until then
+				<-mainWorkerReady
+			}
 			for table := range tasks {
 				if wasTerminated || copyErr != nil {
 					counters.ProgressBar.(*pb.ProgressBar).NotPrint = true
@@ -154,7 +324,9 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 				// aborted state. We do not need to do this with the main worker thread because it has
 				// already acquired AccessShareLocks on all tables before the metadata dumping part.
 				if whichConn != 0 {
-					err := LockTableNoWait(table, whichConn)
+					lockStart := time.Now()
+					err := LockTableNoWait(table.Table, whichConn)
+					tableTimings.RecordLockWait(table.Table, time.Since(lockStart))
 					if err != nil {
 						// Postgres Error Code 55P03 translates to LOCK_NOT_AVAILABLE
 						if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code != "55P03" {
@@ -183,18 +355,25 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 					}
 				}
 
-				err := BackupSingleTableData(table, rowsCopiedMaps[whichConn], &counters, whichConn)
+				dataCopyPause.WaitWhilePaused()
+				queue.acquire()
+				throttle.acquire()
+				err := helperMonitor.BackupTableData(table, rowsCopiedMaps[whichConn], &counters, whichConn)
+				throttle.release()
+				queue.release()
 				if err != nil {
+					runStatus.AddError()
 					copyErr = err
 				}
 			}
 		}(connNum)
 	}
-	for _, table := range tables {
-		tasks <- table
+	for _, task := range copyTasks {
+		tasks <- task
 	}
 	close(tasks)
 	workerPool.Wait()
+	throttle.stop()
 
 	// Handle all tables deferred by the deadlock detection. This can only
 	// be done with the main worker thread, worker 0, because it has
@@ -204,7 +383,7 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 			counters.ProgressBar.(*pb.ProgressBar).NotPrint = true
 			break
 		}
-		err := BackupSingleTableData(table, rowsCopiedMaps[0], &counters, 0)
+		err := backupTableData(table, rowsCopiedMaps[0], &counters, 0)
 		if err != nil {
 			copyErr = err
 		}
@@ -5,7 +5,10 @@ import (
 	"regexp"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/report"
@@ -57,6 +60,32 @@ var _ = Describe("backup/data tests", func() {
 			expectedDataEntries := []toc.MasterDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)"}}
 			Expect(tocfile.DataEntries).To(Equal(expectedDataEntries))
 		})
+		It("marks an entry as uncompressed if compression is disabled for the table", func() {
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -1", InputCommand: "gzip -d -c", Extension: ".gz"})
+			backup.SetCompressionOverrides(map[string]utils.PipeThroughProgram{"public.table": {Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""}})
+			defer backup.SetCompressionOverrides(nil)
+			tables := []backup.Table{table}
+			backup.AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
+			expectedDataEntries := []toc.MasterDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)", Uncompressed: true}}
+			Expect(tocfile.DataEntries).To(Equal(expectedDataEntries))
+		})
+		It("records the size of the table if table sizes were collected", func() {
+			backup.SetTableSizes(map[uint32]int64{1: 8192})
+			defer backup.SetTableSizes(nil)
+			tables := []backup.Table{table}
+			backup.AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
+			expectedDataEntries := []toc.MasterDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)", Size: 8192}}
+			Expect(tocfile.DataEntries).To(Equal(expectedDataEntries))
+		})
+		It("records the streams of a split table with the rows copied by all of them", func() {
+			backup.SetSplitTables(map[uint32]int{1: 2})
+			defer backup.SetSplitTables(nil)
+			rowsCopiedMaps = []map[uint32]int64{{1: 10}, {1: 15}}
+			tables := []backup.Table{table}
+			backup.AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
+			expectedDataEntries := []toc.MasterDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)", RowsCopied: 25, Streams: 2}}
+			Expect(tocfile.DataEntries).To(Equal(expectedDataEntries))
+		})
 		It("does not add an entry for an external table to the TOC", func() {
 			table.IsExternal = true
 			tables := []backup.Table{table}
@@ -71,6 +100,29 @@ var _ = Describe("backup/data tests", func() {
 			Expect(tocfile.DataEntries).To(BeNil())
 		})
 	})
+	Describe("SortTablesBySize", func() {
+		It("orders the tables from largest to smallest, keeping the order of tables of the same size", func() {
+			small := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "small"}}
+			large := backup.Table{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "large"}}
+			unknown := backup.Table{Relation: backup.Relation{Oid: 3, Schema: "public", Name: "unknown"}}
+			alsoSmall := backup.Table{Relation: backup.Relation{Oid: 4, Schema: "public", Name: "also_small"}}
+			tables := []backup.Table{small, large, unknown, alsoSmall}
+			sorted := backup.SortTablesBySize(tables, map[uint32]int64{1: 10, 2: 1000, 4: 10})
+			Expect(sorted).To(Equal([]backup.Table{large, small, alsoSmall, unknown}))
+			Expect(tables).To(Equal([]backup.Table{small, large, unknown, alsoSmall}))
+		})
+	})
+	Describe("SortTablesByLockWaiters", func() {
+		It("orders the tables with the most lock waiters first, keeping the order of the others", func() {
+			first := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "first"}}
+			contended := backup.Table{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "contended"}}
+			mostContended := backup.Table{Relation: backup.Relation{Oid: 3, Schema: "public", Name: "most_contended"}}
+			last := backup.Table{Relation: backup.Relation{Oid: 4, Schema: "public", Name: "last"}}
+			tables := []backup.Table{first, contended, mostContended, last}
+			sorted := backup.SortTablesByLockWaiters(tables, map[uint32]int64{2: 1, 3: 5})
+			Expect(sorted).To(Equal([]backup.Table{mostContended, contended, first, last}))
+		})
+	})
 	Describe("CopyTableOut", func() {
 		testTable := backup.Table{Relation: backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo"}}
 		It("will back up a table to its own file with gzip compression", func() {
@@ -83,6 +135,18 @@ var _ = Describe("backup/data tests", func() {
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
+		It("will back up a table to its own file with its overridden compression level", func() {
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -8", InputCommand: "gzip -d -c", Extension: ".gz"})
+			backup.SetCompressionOverrides(map[string]utils.PipeThroughProgram{"public.foo": {Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""}})
+			defer backup.SetCompressionOverrides(nil)
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'cat - > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+
+			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
 		It("will back up a table to its own file with gzip compression using a plugin", func() {
 			_ = cmdFlags.Set(options.PLUGIN_CONFIG, "/tmp/plugin_config")
 			pluginConfig := utils.PluginConfig{ExecutablePath: "/tmp/fake-plugin.sh", ConfigPath: "/tmp/plugin_config"}
@@ -153,6 +217,57 @@ var _ = Describe("backup/data tests", func() {
 			Expect(err).ShouldNot(HaveOccurred())
 		})
 	})
+	Describe("CopyTableStreamOut", func() {
+		It("backs up the rows of one stream of a table to its own file", func() {
+			testTable := backup.Table{Relation: backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo"}}
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -8", InputCommand: "gzip -d -c", Extension: ".gz"})
+			execStr := regexp.QuoteMeta("COPY (SELECT * FROM public.foo WHERE (ctid::text::point)[0]::bigint % 4 = 1) TO PROGRAM 'gzip -c -8 > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456_1.gz' WITH CSV DELIMITER ',' ON SEGMENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456_1.gz"
+
+			_, err := backup.CopyTableStreamOut(connectionPool, testTable, 1, 4, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+	Describe("CopyTableOut with deduplication", func() {
+		testTable := backup.Table{Relation: backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo"}}
+		BeforeEach(func() {
+			_ = cmdFlags.Set(options.DEDUP, "true")
+			backup.SetFPInfo(filepath.NewFilePathInfo(cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, DataDir: "/data/gpseg-1"}}), "", "20170101010101", "gpseg"))
+			operating.System.Getenv = func(key string) string { return "/usr/local/greenplum-db" }
+		})
+		AfterEach(func() {
+			operating.InitializeSystemFunctions()
+		})
+		It("will back up a table as chunks with gzip compression", func() {
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM '/usr/local/greenplum-db/bin/gpbackup_helper --dedup-write --content <SEGID> --chunk-dir <SEG_DATA_DIR>/backups/chunks --compression-type gzip --compression-level 1 --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.chunks' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.chunks"
+
+			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("will back up a table as chunks without compression", func() {
+			_ = cmdFlags.Set(options.NO_COMPRESSION, "true")
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM '/usr/local/greenplum-db/bin/gpbackup_helper --dedup-write --content <SEGID> --chunk-dir <SEG_DATA_DIR>/backups/chunks --compression-type gzip --compression-level 0 --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.chunks' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.chunks"
+
+			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+	Describe("ParseDedupStats", func() {
+		It("parses the bytes of new and reused chunks", func() {
+			Expect(backup.ParseDedupStats("1024 3072\n")).To(Equal(report.DedupStats{NewBytes: 1024, ReusedBytes: 3072}))
+		})
+		It("treats output that cannot be parsed as no bytes", func() {
+			Expect(backup.ParseDedupStats("")).To(Equal(report.DedupStats{}))
+		})
+	})
 	Describe("BackupSingleTableData", func() {
 		var (
 			testTable     backup.Table
@@ -0,0 +1,114 @@
+package backup
+
+/*
+ * This file contains functions for backing up data with --dedup, which has
+ * gpbackup_helper store the data of each table as chunks shared with the
+ * other deduplicated backups in the same backup directory.
+ */
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Returns the COPY program that stores the data of a table as chunks, to
+ * which --data-file and the path of the data file are appended.
+ */
+func GetDedupWriteCommand(fpInfo *filepath.FilePathInfo) string {
+	compressionType := MustGetFlagString(options.COMPRESSION_TYPE)
+	compressionLevel := MustGetFlagInt(options.COMPRESSION_LEVEL)
+	if MustGetFlagBool(options.NO_COMPRESSION) {
+		compressionLevel = 0
+	}
+	return fmt.Sprintf("%s/bin/gpbackup_helper --dedup-write --content <SEGID> --chunk-dir %s --compression-type %s --compression-level %d",
+		operating.System.Getenv("GPHOME"), fpInfo.GetChunkDirForCopyCommand(), compressionType, compressionLevel)
+}
+
+/*
+ * Writes the chunk index of the backup on each segment, listing every chunk
+ * that the backup uses, and returns the bytes of chunks that the backup
+ * stored and reused across all segments.
+ */
+func writeChunkIndexes() *report.DedupStats {
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Writing chunk indexes", cluster.ON_SEGMENTS, func(contentID int) string {
+		return GetChunkIndexCommand(globalFPInfo.GetDirForContent(contentID), globalFPInfo.GetSegmentChunkIndexFilePath(contentID))
+	})
+	globalCluster.CheckClusterError(remoteOutput, "Unable to write chunk indexes", func(contentID int) string {
+		return fmt.Sprintf("Unable to write chunk index %s", globalFPInfo.GetSegmentChunkIndexFilePath(contentID))
+	})
+
+	stats := &report.DedupStats{}
+	for _, command := range remoteOutput.Commands {
+		stats.Add(ParseDedupStats(command.Stdout))
+	}
+	gplog.Info("Deduplication stored %d new bytes of chunks and reused %d bytes (%.1f%% saved)", stats.NewBytes, stats.ReusedBytes, stats.SavedPercent())
+	return stats
+}
+
+func GetChunkIndexCommand(backupDir string, indexFile string) string {
+	return fmt.Sprintf(`find %[1]s -name "*%[3]s" -exec cut -d" " -f1 {} + | sort -u > %[2]s && find %[1]s -name "*%[3]s" -exec cat {} + | awk '{if ($3 == "new") n += $2; else d += $2} END {printf "%%d %%d\n", n, d}'`,
+		backupDir, indexFile, filepath.DedupDataFileExtension)
+}
+
+/*
+ * Parses the "<new bytes> <reused bytes>" output of the chunk index command,
+ * treating output that cannot be parsed as no bytes.
+ */
+func ParseDedupStats(output string) report.DedupStats {
+	stats := report.DedupStats{}
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return stats
+	}
+	stats.NewBytes, _ = strconv.ParseInt(fields[0], 10, 64)
+	stats.ReusedBytes, _ = strconv.ParseInt(fields[1], 10, 64)
+	return stats
+}
+
+/*
+ * Removes the chunks that no remaining backup uses from the chunk directory
+ * of each segment, once a deduplicated backup has been deleted.  The chunks
+ * are only removed while holding the lock on the backup directory, as a
+ * deduplicated backup running in the same directory writes chunks that no
+ * manifest lists until it completes.  If the lock cannot be taken, the
+ * unused chunks are left for the next deletion to remove.
+ */
+func pruneChunks(fpInfo filepath.FilePathInfo) {
+	wait := time.Duration(MustGetFlagInt(options.WAIT_FOR_DIR_LOCK)) * time.Second
+	lock, err := utils.AcquireDirectoryLock(fpInfo.GetBackupRootDirForContent(-1), "gpbackup", history.CurrentTimestamp(), wait)
+	if err != nil {
+		gplog.Warn("Unused chunks were not removed: %v", err)
+		return
+	}
+	defer lock.Release()
+
+	gphome := operating.System.Getenv("GPHOME")
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Removing unused chunks", cluster.ON_SEGMENTS, func(contentID int) string {
+		return fmt.Sprintf("%s/bin/gpbackup_helper --dedup-prune --content %d --chunk-dir %s", gphome, contentID, fpInfo.GetChunkDirForContent(contentID))
+	})
+	if remoteOutput.NumErrors > 0 {
+		for _, failedCommand := range remoteOutput.FailedCommands {
+			gplog.Verbose("Command %s failed on segment %d: %v", failedCommand.CommandString, failedCommand.Content, failedCommand.Error)
+		}
+		gplog.Warn("Unable to remove unused chunks on %d segments", remoteOutput.NumErrors)
+		return
+	}
+	numRemoved := 0
+	for _, command := range remoteOutput.Commands {
+		numChunks, _ := strconv.Atoi(strings.TrimSpace(command.Stdout))
+		numRemoved += numChunks
+	}
+	gplog.Verbose("Removed %d unused chunks", numRemoved)
+}
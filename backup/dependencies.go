@@ -60,6 +60,7 @@ var (
 	PG_OPCLASS_OID              uint32 = 2616
 	PG_OPERATOR_OID             uint32 = 2617
 	PG_OPFAMILY_OID             uint32 = 2753
+	PG_POLICY_OID               uint32 = 3256
 	PG_PROC_OID                 uint32 = 1255
 	PG_RESGROUP_OID             uint32 = 6436
 	PG_RESQUEUE_OID             uint32 = 6026
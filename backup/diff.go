@@ -0,0 +1,219 @@
+package backup
+
+/*
+ * This file contains functions for --diff, which compares the metadata of
+ * two backups and reports the objects added, removed, and changed between
+ * them.
+ */
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	DIFF_ADDED   = "added"
+	DIFF_REMOVED = "removed"
+	DIFF_CHANGED = "changed"
+)
+
+/*
+ * OldStatement and NewStatement are empty for objects that were added and
+ * removed, respectively.
+ */
+type MetadataDiffEntry struct {
+	Change          string `json:"change"`
+	ObjectType      string `json:"object_type"`
+	Schema          string `json:"schema"`
+	Name            string `json:"name"`
+	ReferenceObject string `json:"reference_object,omitempty"`
+	OldStatement    string `json:"old_statement,omitempty"`
+	NewStatement    string `json:"new_statement,omitempty"`
+}
+
+func DoDiff() {
+	SetLoggerVerbosity()
+	timestamps := MustGetFlagStringSlice(options.DIFF)
+	fpInfo := getMasterFPInfo(MustGetFlagString(options.DBNAME))
+	backupHistory := readBackupHistory(fpInfo.GetBackupHistoryFilePath())
+
+	oldStatements := readBackupMetadataStatements(getBackupFPInfo(backupHistory, timestamps[0]))
+	newStatements := readBackupMetadataStatements(getBackupFPInfo(backupHistory, timestamps[1]))
+	entries := DiffMetadata(oldStatements, newStatements)
+	var err error
+	if MustGetFlagString(options.DIFF_FORMAT) == "json" {
+		err = PrintListJSON(operating.System.Stdout, entries)
+	} else {
+		err = PrintMetadataDiff(operating.System.Stdout, entries)
+	}
+	gplog.FatalOnError(err)
+}
+
+/*
+ * Backups are looked for in the directory given by --backup-dir, if any, or
+ * else in the directory recorded for them in the backup history.
+ */
+func getBackupFPInfo(backupHistory *history.History, timestamp string) filepath.FilePathInfo {
+	backupDir := MustGetFlagString(options.BACKUP_DIR)
+	if backupConfig := backupHistory.FindBackupConfig(timestamp); backupConfig != nil && backupDir == "" {
+		backupDir = backupConfig.BackupDir
+	}
+	segPrefix, err := filepath.ParseSegPrefix(backupDir, timestamp)
+	gplog.FatalOnError(err)
+	return filepath.NewFilePathInfo(globalCluster, backupDir, timestamp, segPrefix)
+}
+
+func readBackupMetadataStatements(fpInfo filepath.FilePathInfo) []toc.StatementWithType {
+	tocFilename := fpInfo.GetTOCFilePath()
+	metadataFilename := fpInfo.GetMetadataFilePath()
+	if !iohelper.FileExistsAndIsReadable(tocFilename) || !iohelper.FileExistsAndIsReadable(metadataFilename) {
+		gplog.Fatal(errors.Errorf("Metadata of backup %s not found in %s", fpInfo.Timestamp, fpInfo.GetDirForContent(-1)), "")
+	}
+	tocfile := toc.NewTOC(tocFilename)
+	tocfile.InitializeMetadataEntryMap()
+	metadataFile, err := os.Open(metadataFilename)
+	gplog.FatalOnError(err)
+	defer metadataFile.Close()
+
+	statements := make([]toc.StatementWithType, 0)
+	for _, section := range []string{"global", "predata", "postdata"} {
+		statements = append(statements, tocfile.GetSQLStatementForObjectTypes(section, metadataFile, []string{}, []string{}, []string{}, []string{}, []string{}, []string{})...)
+	}
+	return statements
+}
+
+/*
+ * Objects are matched by type, schema, name, and reference object.  An object
+ * with several statements, such as a table and the comments on its columns,
+ * is compared using all of them.
+ */
+func DiffMetadata(oldStatements []toc.StatementWithType, newStatements []toc.StatementWithType) []MetadataDiffEntry {
+	oldObjects, oldKeys := groupStatementsByObject(oldStatements)
+	newObjects, newKeys := groupStatementsByObject(newStatements)
+
+	entries := make([]MetadataDiffEntry, 0)
+	for _, key := range oldKeys {
+		object := oldObjects[key]
+		newObject, ok := newObjects[key]
+		if !ok {
+			entries = append(entries, newMetadataDiffEntry(DIFF_REMOVED, object.statement, object.text, ""))
+		} else if newObject.text != object.text {
+			entries = append(entries, newMetadataDiffEntry(DIFF_CHANGED, object.statement, object.text, newObject.text))
+		}
+	}
+	for _, key := range newKeys {
+		if _, ok := oldObjects[key]; !ok {
+			object := newObjects[key]
+			entries = append(entries, newMetadataDiffEntry(DIFF_ADDED, object.statement, "", object.text))
+		}
+	}
+	sort.SliceStable(entries, func(i int, j int) bool {
+		if entries[i].Schema != entries[j].Schema {
+			return entries[i].Schema < entries[j].Schema
+		}
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].ObjectType < entries[j].ObjectType
+	})
+	return entries
+}
+
+type metadataObject struct {
+	statement toc.StatementWithType
+	text      string
+}
+
+func groupStatementsByObject(statements []toc.StatementWithType) (map[string]*metadataObject, []string) {
+	objects := make(map[string]*metadataObject)
+	keys := make([]string, 0)
+	for _, statement := range statements {
+		key := strings.Join([]string{statement.ObjectType, statement.Schema, statement.Name, statement.ReferenceObject}, "\x00")
+		text := strings.TrimSpace(statement.Statement)
+		if object, ok := objects[key]; ok {
+			object.text += "\n" + text
+			continue
+		}
+		objects[key] = &metadataObject{statement: statement, text: text}
+		keys = append(keys, key)
+	}
+	return objects, keys
+}
+
+func newMetadataDiffEntry(change string, statement toc.StatementWithType, oldStatement string, newStatement string) MetadataDiffEntry {
+	return MetadataDiffEntry{
+		Change:          change,
+		ObjectType:      statement.ObjectType,
+		Schema:          statement.Schema,
+		Name:            statement.Name,
+		ReferenceObject: statement.ReferenceObject,
+		OldStatement:    oldStatement,
+		NewStatement:    newStatement,
+	}
+}
+
+/*
+ * Prints a line for each object prefixed with "+", "-", or "~" for objects
+ * that were added, removed, or changed, followed for changed objects by the
+ * lines of their statements that were removed and added.
+ */
+func PrintMetadataDiff(writer io.Writer, entries []MetadataDiffEntry) error {
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(writer, "No metadata differences")
+		return err
+	}
+	prefixes := map[string]string{DIFF_ADDED: "+", DIFF_REMOVED: "-", DIFF_CHANGED: "~"}
+	for _, entry := range entries {
+		objectName := entry.Name
+		if entry.Schema != "" {
+			objectName = utils.MakeFQN(entry.Schema, entry.Name)
+		}
+		if entry.ReferenceObject != "" {
+			objectName = fmt.Sprintf("%s on %s", objectName, entry.ReferenceObject)
+		}
+		_, err := fmt.Fprintf(writer, "%s %s %s\n", prefixes[entry.Change], entry.ObjectType, objectName)
+		if err != nil {
+			return err
+		}
+		if entry.Change != DIFF_CHANGED {
+			continue
+		}
+		oldLines := strings.Split(entry.OldStatement, "\n")
+		newLines := strings.Split(entry.NewStatement, "\n")
+		for _, line := range subtractLines(oldLines, newLines) {
+			_, _ = fmt.Fprintf(writer, "    - %s\n", line)
+		}
+		for _, line := range subtractLines(newLines, oldLines) {
+			_, _ = fmt.Fprintf(writer, "    + %s\n", line)
+		}
+	}
+	return nil
+}
+
+// Returns the lines of the first list that do not appear in the second
+func subtractLines(lines []string, otherLines []string) []string {
+	otherSet := make(map[string]bool, len(otherLines))
+	for _, line := range otherLines {
+		otherSet[line] = true
+	}
+	difference := make([]string, 0)
+	for _, line := range lines {
+		if !otherSet[line] {
+			difference = append(difference, line)
+		}
+	}
+	return difference
+}
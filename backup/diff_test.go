@@ -0,0 +1,61 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("backup/diff tests", func() {
+	table := toc.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED BY (i);\n"}
+	changedTable := toc.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (\n\ti bigint\n) DISTRIBUTED BY (i);\n"}
+	view := toc.StatementWithType{Schema: "public", Name: "bar", ObjectType: "VIEW", Statement: "\n\nCREATE VIEW public.bar AS SELECT 1;\n"}
+	index := toc.StatementWithType{Schema: "public", Name: "foo_idx", ObjectType: "INDEX", ReferenceObject: "public.foo", Statement: "\n\nCREATE INDEX foo_idx ON public.foo USING btree (i);\n"}
+
+	Describe("DiffMetadata", func() {
+		It("returns nothing for identical metadata", func() {
+			Expect(backup.DiffMetadata([]toc.StatementWithType{table, view}, []toc.StatementWithType{table, view})).To(BeEmpty())
+		})
+		It("returns the objects added, removed, and changed", func() {
+			entries := backup.DiffMetadata([]toc.StatementWithType{table, view}, []toc.StatementWithType{changedTable, index})
+			Expect(entries).To(Equal([]backup.MetadataDiffEntry{
+				{Change: backup.DIFF_REMOVED, ObjectType: "VIEW", Schema: "public", Name: "bar", OldStatement: "CREATE VIEW public.bar AS SELECT 1;"},
+				{Change: backup.DIFF_CHANGED, ObjectType: "TABLE", Schema: "public", Name: "foo",
+					OldStatement: "CREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED BY (i);",
+					NewStatement: "CREATE TABLE public.foo (\n\ti bigint\n) DISTRIBUTED BY (i);"},
+				{Change: backup.DIFF_ADDED, ObjectType: "INDEX", Schema: "public", Name: "foo_idx", ReferenceObject: "public.foo",
+					NewStatement: "CREATE INDEX foo_idx ON public.foo USING btree (i);"},
+			}))
+		})
+		It("compares all of the statements of an object", func() {
+			comment := toc.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCOMMENT ON TABLE public.foo IS 'old';\n"}
+			newComment := toc.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCOMMENT ON TABLE public.foo IS 'new';\n"}
+			entries := backup.DiffMetadata([]toc.StatementWithType{table, comment}, []toc.StatementWithType{table, newComment})
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Change).To(Equal(backup.DIFF_CHANGED))
+		})
+	})
+	Describe("PrintMetadataDiff", func() {
+		It("prints each object with the lines of changed statements", func() {
+			buffer := NewBuffer()
+			entries := backup.DiffMetadata([]toc.StatementWithType{table, view}, []toc.StatementWithType{changedTable, index})
+			err := backup.PrintMetadataDiff(buffer, entries)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buffer.Contents())).To(Equal(`- VIEW public.bar
+~ TABLE public.foo
+    - 	i integer
+    + 	i bigint
++ INDEX public.foo_idx on public.foo
+`))
+		})
+		It("prints a message when there are no differences", func() {
+			buffer := NewBuffer()
+			err := backup.PrintMetadataDiff(buffer, []backup.MetadataDiffEntry{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buffer.Contents())).To(Equal("No metadata differences\n"))
+		})
+	})
+})
@@ -0,0 +1,79 @@
+package backup
+
+/*
+ * This file contains functions for checking that the backup directories of
+ * the segments have enough free space for the data of a backup before any of
+ * it is copied.
+ */
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Estimates the size of the backup files of each segment from the size of
+ * its data and the ratio of backup size to data size of previous backups.
+ */
+func EstimateSegmentBackupSizes(segmentDataSizes map[int]int64, ratio float64) map[int]int64 {
+	segmentBackupSizes := make(map[int]int64, len(segmentDataSizes))
+	for contentID, dataSize := range segmentDataSizes {
+		segmentBackupSizes[contentID] = int64(float64(dataSize) * ratio)
+	}
+	return segmentBackupSizes
+}
+
+/*
+ * Fails the backup if a filesystem holding the backup directories of the
+ * segments on a host cannot fit their share of the estimated backup size.
+ * Without previous backups to estimate from, the uncompressed data size is
+ * used instead, which overestimates compressed and deduplicated backups, so a
+ * shortfall is only a warning for those.  Plugin backups are not checked, as
+ * their data files are not written to the backup directories, nor are backups
+ * in client mode, as the segment hosts cannot be reached over ssh.
+ */
+func checkBackupDiskSpace(tables []Table) {
+	if MustGetFlagBool(options.SKIP_DISK_SPACE_CHECK) || MustGetFlagString(options.PLUGIN_CONFIG) != "" || MustGetFlagBool(options.CLIENT_MODE) {
+		return
+	}
+	relations := make([]Relation, 0, len(tables))
+	for _, table := range tables {
+		if !table.SkipDataBackup() {
+			relations = append(relations, table.Relation)
+		}
+	}
+	segmentDataSizes := GetSegmentRelationSizes(connectionPool, relations)
+	var dataSize int64
+	for _, size := range segmentDataSizes {
+		dataSize += size
+	}
+	if dataSize == 0 {
+		return
+	}
+
+	backupHistory := readBackupHistory(globalFPInfo.GetBackupHistoryFilePath())
+	estimatedSize, numBackups := EstimateBackupSize(backupHistory, connectionPool.DBName, dataSize)
+	ratio := 1.0
+	if numBackups > 0 {
+		ratio = float64(estimatedSize) / float64(dataSize)
+	}
+	required := EstimateSegmentBackupSizes(segmentDataSizes, ratio)
+	freeSpace := utils.GetFreeSpaceOnSegments(globalCluster, globalFPInfo.GetDirForContent)
+	shortfalls := utils.GetDiskSpaceShortfalls(globalCluster, freeSpace, required)
+	if len(shortfalls) == 0 {
+		gplog.Verbose("Segment hosts have enough free space for the backup")
+		return
+	}
+
+	shortfallTable := utils.FormatDiskSpaceShortfalls(shortfalls)
+	if numBackups == 0 && (!MustGetFlagBool(options.NO_COMPRESSION) || MustGetFlagBool(options.DEDUP)) {
+		gplog.Warn("Segment hosts may not have enough free space for the backup, whose size is estimated "+
+			"from the uncompressed data size of %s as there are no previous backups of the database to estimate from:\n%s",
+			utils.FormatSize(dataSize), shortfallTable)
+		return
+	}
+	gplog.Fatal(errors.Errorf("Segment hosts do not have enough free space for the backup, estimated at %s:\n%s\n"+
+		"Free up space or use --%s to back up anyway.", utils.FormatSize(int64(float64(dataSize)*ratio)), shortfallTable, options.SKIP_DISK_SPACE_CHECK), "")
+}
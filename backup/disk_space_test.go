@@ -0,0 +1,17 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/disk_space tests", func() {
+	Describe("EstimateSegmentBackupSizes", func() {
+		It("scales the data size of each segment by the ratio of backup size to data size", func() {
+			sizes := backup.EstimateSegmentBackupSizes(map[int]int64{0: 1000, 1: 3000}, 0.25)
+			Expect(sizes).To(Equal(map[int]int64{0: 250, 1: 750}))
+		})
+	})
+})
@@ -0,0 +1,194 @@
+package backup
+
+/*
+ * This file contains functions for --dry-run, which reports what a backup
+ * would contain and estimates how long it would take, without locking any
+ * tables or writing any files.
+ */
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+// The number of most recent backups used to estimate the backup throughput
+const numEstimateBackups = 5
+
+/*
+ * Size is -1 for external and foreign tables, whose data is not backed up.
+ */
+type DryRunTable struct {
+	Name string
+	Size int64
+}
+
+type DryRunPlan struct {
+	Database          string
+	NumSchemas        int
+	NumTables         int
+	DataTables        []DryRunTable
+	DataSize          int64
+	EstimatedDuration time.Duration
+	NumPastBackups    int
+}
+
+func DoDryRun() {
+	SetLoggerVerbosity()
+	dbName := MustGetFlagString(options.DBNAME)
+	gplog.Info("Starting dry run of backup of database %s", dbName)
+
+	numSchemas, metadataTables, dataTables, sizes := retrieveDryRunTables(dbName)
+	plan := NewDryRunPlan(dbName, numSchemas, metadataTables, dataTables, sizes)
+	fpInfo := getMasterFPInfo(dbName)
+	backupHistory := readBackupHistory(fpInfo.GetBackupHistoryFilePath())
+	plan.EstimatedDuration, plan.NumPastBackups = EstimateBackupDuration(backupHistory, dbName, plan.DataSize)
+
+	err := PrintDryRunPlan(operating.System.Stdout, plan)
+	gplog.FatalOnError(err)
+}
+
+/*
+ * Returns the number of schemas, the tables whose metadata and data would be
+ * backed up, and the sizes of the data tables, without locking any tables.
+ */
+func retrieveDryRunTables(dbName string) (int, []Table, []Table, map[uint32]int64) {
+	// A single connection outside of a transaction is used, as no tables are locked
+	connectionPool = dbconn.NewDBConnFromEnvironment(dbName)
+	connectionPool.MustConnect(1)
+	utils.ValidateGPDBVersionCompatibility(connectionPool)
+	InitializeMetadataParams(connectionPool)
+	SetSessionGUCs(0)
+
+	opts, err := options.NewOptions(cmdFlags)
+	gplog.FatalOnError(err)
+	validateFilterLists(opts)
+	err = opts.ExpandIncludesForPartitions(connectionPool, cmdFlags)
+	gplog.FatalOnError(err)
+
+	// Tables skipped by the table size filters or whose data is excluded are recorded in the report
+	backupReport = &report.Report{}
+	tableRelations, quotedIncludeRelations := retrieveTableRelations()
+	metadataTables, dataTables := processTableRelations(tableRelations, quotedIncludeRelations)
+	dataTables, _ = excludeTableData(dataTables)
+	if MustGetFlagBool(options.METADATA_ONLY) {
+		dataTables = []Table{}
+	}
+	schemas := GetAllUserSchemas(connectionPool, map[string]bool{})
+	relations := make([]Relation, 0, len(dataTables))
+	for _, table := range dataTables {
+		relations = append(relations, table.Relation)
+	}
+	return len(schemas), metadataTables, dataTables, GetRelationSizes(connectionPool, relations)
+}
+
+/*
+ * Data tables are listed largest first, as they dominate the backup time.
+ */
+func NewDryRunPlan(dbName string, numSchemas int, metadataTables []Table, dataTables []Table, sizes map[uint32]int64) DryRunPlan {
+	plan := DryRunPlan{
+		Database:   dbName,
+		NumSchemas: numSchemas,
+		NumTables:  len(metadataTables),
+		DataTables: make([]DryRunTable, 0, len(dataTables)),
+	}
+	for _, table := range dataTables {
+		entry := DryRunTable{Name: table.FQN(), Size: -1}
+		if !table.SkipDataBackup() {
+			entry.Size = sizes[table.Oid]
+			plan.DataSize += entry.Size
+		}
+		plan.DataTables = append(plan.DataTables, entry)
+	}
+	sort.SliceStable(plan.DataTables, func(i int, j int) bool {
+		if plan.DataTables[i].Size != plan.DataTables[j].Size {
+			return plan.DataTables[i].Size > plan.DataTables[j].Size
+		}
+		return plan.DataTables[i].Name < plan.DataTables[j].Name
+	})
+	return plan
+}
+
+/*
+ * Returns the total size of the tables whose data will be backed up.
+ */
+func GetTotalDataSize(tables []Table, sizes map[uint32]int64) int64 {
+	var totalSize int64
+	for _, table := range tables {
+		if !table.SkipDataBackup() {
+			totalSize += sizes[table.Oid]
+		}
+	}
+	return totalSize
+}
+
+/*
+ * Estimates how long backing up the given amount of data will take from the
+ * rate at which the most recent successful backups of the database backed up
+ * their data, and returns the number of backups the estimate is based on.
+ * Backups taken before the size of their data was recorded are not used.
+ */
+func EstimateBackupDuration(backupHistory *history.History, dbName string, dataSize int64) (time.Duration, int) {
+	var totalSize int64
+	var totalDuration time.Duration
+	numBackups := 0
+	for _, backupConfig := range backupHistory.BackupConfigs {
+		if numBackups == numEstimateBackups {
+			break
+		}
+		if backupConfig.DatabaseName != dbName || backupConfig.Status != history.BackupStatusSucceed ||
+			backupConfig.DataSize <= 0 || backupConfig.EndTime == "" {
+			continue
+		}
+		startTime, _ := time.ParseInLocation("20060102150405", backupConfig.Timestamp, operating.System.Local)
+		endTime, _ := time.ParseInLocation("20060102150405", backupConfig.EndTime, operating.System.Local)
+		if !endTime.After(startTime) {
+			continue
+		}
+		totalSize += backupConfig.DataSize
+		totalDuration += endTime.Sub(startTime)
+		numBackups++
+	}
+	if numBackups == 0 {
+		return 0, 0
+	}
+	return time.Duration(float64(totalDuration) * float64(dataSize) / float64(totalSize)), numBackups
+}
+
+func PrintDryRunPlan(writer io.Writer, plan DryRunPlan) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	estimate := "unknown (no previous backups with a recorded data size)"
+	if plan.NumPastBackups > 0 {
+		estimate = fmt.Sprintf("%s (based on %d previous backups)", report.FormatDuration(plan.EstimatedDuration.Round(time.Second)), plan.NumPastBackups)
+	}
+	_, _ = fmt.Fprintf(tabWriter, "Backup plan for database %s\n", plan.Database)
+	_, _ = fmt.Fprintf(tabWriter, "schemas:\t%d\n", plan.NumSchemas)
+	_, _ = fmt.Fprintf(tabWriter, "tables:\t%d\n", plan.NumTables)
+	_, _ = fmt.Fprintf(tabWriter, "tables with data:\t%d\n", len(plan.DataTables))
+	_, _ = fmt.Fprintf(tabWriter, "estimated data size:\t%s\n", utils.FormatSize(plan.DataSize))
+	_, _ = fmt.Fprintf(tabWriter, "estimated duration:\t%s\n", estimate)
+	err := tabWriter.Flush()
+	if err != nil || len(plan.DataTables) == 0 {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(tabWriter, "\nTABLE\tSIZE")
+	for _, table := range plan.DataTables {
+		size := "external"
+		if table.Size >= 0 {
+			size = utils.FormatSize(table.Size)
+		}
+		_, _ = fmt.Fprintf(tabWriter, "%s\t%s\n", table.Name, size)
+	}
+	return tabWriter.Flush()
+}
@@ -0,0 +1,102 @@
+package backup_test
+
+import (
+	"time"
+
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/history"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("backup/dry_run tests", func() {
+	regularTable := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "small"}}
+	largeTable := backup.Table{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "large"}}
+	externalTable := backup.Table{
+		Relation:        backup.Relation{Oid: 3, Schema: "public", Name: "ext"},
+		TableDefinition: backup.TableDefinition{IsExternal: true},
+	}
+	sizes := map[uint32]int64{1: 1024, 2: 3 * 1024 * 1024, 3: 4096}
+
+	Describe("NewDryRunPlan", func() {
+		It("lists the data tables largest first and totals the size of their data", func() {
+			tables := []backup.Table{regularTable, externalTable, largeTable}
+			plan := backup.NewDryRunPlan("testdb", 2, tables, tables, sizes)
+			Expect(plan).To(Equal(backup.DryRunPlan{
+				Database:   "testdb",
+				NumSchemas: 2,
+				NumTables:  3,
+				DataTables: []backup.DryRunTable{
+					{Name: "public.large", Size: 3 * 1024 * 1024},
+					{Name: "public.small", Size: 1024},
+					{Name: "public.ext", Size: -1},
+				},
+				DataSize: 3*1024*1024 + 1024,
+			}))
+		})
+	})
+	Describe("GetTotalDataSize", func() {
+		It("does not count external tables", func() {
+			Expect(backup.GetTotalDataSize([]backup.Table{regularTable, externalTable}, sizes)).To(Equal(int64(1024)))
+		})
+	})
+	Describe("EstimateBackupDuration", func() {
+		It("estimates the duration from the data backed up per second by previous backups", func() {
+			backupHistory := &history.History{BackupConfigs: []history.BackupConfig{
+				{DatabaseName: "testdb", Timestamp: "20170101030000", EndTime: "20170101030100", Status: history.BackupStatusSucceed, DataSize: 1000},
+				{DatabaseName: "otherdb", Timestamp: "20170101020000", EndTime: "20170101023000", Status: history.BackupStatusSucceed, DataSize: 1000},
+				{DatabaseName: "testdb", Timestamp: "20170101013000", EndTime: "20170101014000", Status: history.BackupStatusFailed, DataSize: 1000},
+				{DatabaseName: "testdb", Timestamp: "20170101010000", EndTime: "20170101010300", Status: history.BackupStatusSucceed, DataSize: 2000},
+			}}
+			duration, numBackups := backup.EstimateBackupDuration(backupHistory, "testdb", 6000)
+			Expect(numBackups).To(Equal(2))
+			Expect(duration).To(Equal(8 * time.Minute))
+		})
+		It("returns no estimate when no backup recorded the size of its data", func() {
+			backupHistory := &history.History{BackupConfigs: []history.BackupConfig{
+				{DatabaseName: "testdb", Timestamp: "20170101010000", EndTime: "20170101010300", Status: history.BackupStatusSucceed},
+			}}
+			duration, numBackups := backup.EstimateBackupDuration(backupHistory, "testdb", 6000)
+			Expect(numBackups).To(Equal(0))
+			Expect(duration).To(Equal(time.Duration(0)))
+		})
+	})
+	Describe("PrintDryRunPlan", func() {
+		It("prints the totals and the size of each data table", func() {
+			buffer := NewBuffer()
+			plan := backup.DryRunPlan{
+				Database:   "testdb",
+				NumSchemas: 2,
+				NumTables:  3,
+				DataTables: []backup.DryRunTable{
+					{Name: "public.large", Size: 3 * 1024 * 1024},
+					{Name: "public.ext", Size: -1},
+				},
+				DataSize:          3 * 1024 * 1024,
+				EstimatedDuration: 90 * time.Second,
+				NumPastBackups:    2,
+			}
+			err := backup.PrintDryRunPlan(buffer, plan)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buffer.Contents())).To(Equal(`Backup plan for database testdb
+schemas:              2
+tables:               3
+tables with data:     2
+estimated data size:  3.0 MB
+estimated duration:   0:01:30 (based on 2 previous backups)
+
+TABLE         SIZE
+public.large  3.0 MB
+public.ext    external
+`))
+		})
+		It("prints that the duration is unknown without previous backups", func() {
+			buffer := NewBuffer()
+			err := backup.PrintDryRunPlan(buffer, backup.DryRunPlan{Database: "testdb"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buffer.Contents())).To(ContainSubstring("estimated duration:   unknown (no previous backups with a recorded data size)\n"))
+		})
+	})
+})
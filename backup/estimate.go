@@ -0,0 +1,93 @@
+package backup
+
+/*
+ * This file contains functions for --estimate, which reports the expected
+ * size of the data of each table before and after compression, for capacity
+ * planning, without locking any tables or writing any files.
+ */
+
+import (
+	"math"
+	"sort"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+)
+
+/*
+ * CompressedSize is -1 when there are no previous backups of the database
+ * with a recorded backup size to estimate it from.
+ */
+type TableSizeEstimate struct {
+	Name             string `json:"name"`
+	UncompressedSize int64  `json:"uncompressed_size"`
+	CompressedSize   int64  `json:"compressed_size"`
+}
+
+/*
+ * CompressionRatio is the ratio of backup size to data size of the previous
+ * backups the compressed sizes are estimated from, so it reflects the
+ * compression settings of those backups rather than of this one.
+ */
+type BackupSizeEstimate struct {
+	Database         string              `json:"database"`
+	UncompressedSize int64               `json:"uncompressed_size"`
+	CompressedSize   int64               `json:"compressed_size"`
+	CompressionRatio float64             `json:"compression_ratio"`
+	NumPastBackups   int                 `json:"num_past_backups"`
+	Tables           []TableSizeEstimate `json:"tables"`
+}
+
+func DoEstimate() {
+	SetLoggerVerbosity()
+	dbName := MustGetFlagString(options.DBNAME)
+	gplog.Info("Estimating the size of a backup of database %s", dbName)
+
+	_, _, dataTables, sizes := retrieveDryRunTables(dbName)
+	fpInfo := getMasterFPInfo(dbName)
+	backupHistory := readBackupHistory(fpInfo.GetBackupHistoryFilePath())
+	estimate := NewBackupSizeEstimate(dbName, dataTables, sizes, backupHistory)
+
+	err := PrintListJSON(operating.System.Stdout, estimate)
+	gplog.FatalOnError(err)
+}
+
+/*
+ * Estimates the uncompressed size of each table from its on-disk size and its
+ * compressed size from the compression ratio of the most recent successful
+ * backups of the database.  External and foreign tables are not listed, as
+ * their data is not backed up, and tables are listed largest first.
+ */
+func NewBackupSizeEstimate(dbName string, dataTables []Table, sizes map[uint32]int64, backupHistory *history.History) BackupSizeEstimate {
+	ratio, numBackups := EstimateCompressionRatio(backupHistory, dbName)
+	estimate := BackupSizeEstimate{
+		Database:         dbName,
+		CompressionRatio: ratio,
+		NumPastBackups:   numBackups,
+		Tables:           make([]TableSizeEstimate, 0, len(dataTables)),
+	}
+	for _, table := range dataTables {
+		if table.SkipDataBackup() {
+			continue
+		}
+		entry := TableSizeEstimate{Name: table.FQN(), UncompressedSize: sizes[table.Oid], CompressedSize: -1}
+		if numBackups > 0 {
+			entry.CompressedSize = int64(math.Round(float64(entry.UncompressedSize) * ratio))
+		}
+		estimate.UncompressedSize += entry.UncompressedSize
+		estimate.CompressedSize += entry.CompressedSize
+		estimate.Tables = append(estimate.Tables, entry)
+	}
+	if numBackups == 0 {
+		estimate.CompressedSize = -1
+	}
+	sort.SliceStable(estimate.Tables, func(i int, j int) bool {
+		if estimate.Tables[i].UncompressedSize != estimate.Tables[j].UncompressedSize {
+			return estimate.Tables[i].UncompressedSize > estimate.Tables[j].UncompressedSize
+		}
+		return estimate.Tables[i].Name < estimate.Tables[j].Name
+	})
+	return estimate
+}
@@ -0,0 +1,55 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/history"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/estimate tests", func() {
+	regularTable := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "small"}}
+	largeTable := backup.Table{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "large"}}
+	externalTable := backup.Table{
+		Relation:        backup.Relation{Oid: 3, Schema: "public", Name: "ext"},
+		TableDefinition: backup.TableDefinition{IsExternal: true},
+	}
+	sizes := map[uint32]int64{1: 1000, 2: 4000, 3: 4096}
+	tables := []backup.Table{regularTable, externalTable, largeTable}
+
+	Describe("NewBackupSizeEstimate", func() {
+		It("estimates the compressed size of each table from the compression ratio of previous backups", func() {
+			backupHistory := &history.History{BackupConfigs: []history.BackupConfig{
+				{DatabaseName: "testdb", Status: history.BackupStatusSucceed, DataSize: 1000, BackupSize: 300},
+				{DatabaseName: "otherdb", Status: history.BackupStatusSucceed, DataSize: 1000, BackupSize: 900},
+				{DatabaseName: "testdb", Status: history.BackupStatusSucceed, DataSize: 3000, BackupSize: 500},
+			}}
+			estimate := backup.NewBackupSizeEstimate("testdb", tables, sizes, backupHistory)
+			Expect(estimate).To(Equal(backup.BackupSizeEstimate{
+				Database:         "testdb",
+				UncompressedSize: 5000,
+				CompressedSize:   1000,
+				CompressionRatio: 0.2,
+				NumPastBackups:   2,
+				Tables: []backup.TableSizeEstimate{
+					{Name: "public.large", UncompressedSize: 4000, CompressedSize: 800},
+					{Name: "public.small", UncompressedSize: 1000, CompressedSize: 200},
+				},
+			}))
+		})
+		It("does not estimate compressed sizes when no backup recorded its size", func() {
+			backupHistory := &history.History{BackupConfigs: []history.BackupConfig{
+				{DatabaseName: "testdb", Status: history.BackupStatusSucceed, DataSize: 1000},
+			}}
+			estimate := backup.NewBackupSizeEstimate("testdb", tables, sizes, backupHistory)
+			Expect(estimate.UncompressedSize).To(Equal(int64(5000)))
+			Expect(estimate.CompressedSize).To(Equal(int64(-1)))
+			Expect(estimate.NumPastBackups).To(Equal(0))
+			Expect(estimate.Tables).To(Equal([]backup.TableSizeEstimate{
+				{Name: "public.large", UncompressedSize: 4000, CompressedSize: -1},
+				{Name: "public.small", UncompressedSize: 1000, CompressedSize: -1},
+			}))
+		})
+	})
+})
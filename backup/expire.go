@@ -0,0 +1,200 @@
+package backup
+
+/*
+ * This file contains functions for deleting old backup sets and recording
+ * their deletion in the backup history.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func IsExpireRun() bool {
+	return MustGetFlagString(options.DELETE_BEFORE) != "" || MustGetFlagInt(options.RETENTION_COUNT) > 0
+}
+
+func IsValidDeleteBeforeDate(date string) bool {
+	dateFormat := regexp.MustCompile(`^[0-9]{8}([0-9]{6})?$`)
+	return dateFormat.MatchString(date)
+}
+
+func DoExpire() {
+	SetLoggerVerbosity()
+	gplog.Info("gpbackup version = %s", GetVersion())
+
+	dbName := MustGetFlagString(options.DBNAME)
+	conn := dbconn.NewDBConnFromEnvironment(dbName)
+	conn.MustConnect(1)
+	segConfig := cluster.MustGetSegmentConfiguration(conn)
+	segPrefix := filepath.GetSegPrefix(conn)
+	conn.Close()
+	globalCluster = cluster.NewCluster(segConfig)
+
+	fpInfo := filepath.NewFilePathInfo(globalCluster, "", "", segPrefix)
+	historyFilename := fpInfo.GetBackupHistoryFilePath()
+	if !iohelper.FileExistsAndIsReadable(historyFilename) {
+		gplog.Info("No backup history found at %s, no backups will be deleted", historyFilename)
+		return
+	}
+	backupHistory, err := history.NewHistory(historyFilename)
+	gplog.FatalOnError(err)
+
+	expiredBackups, dependentBackups := GetExpiredBackups(backupHistory, dbName,
+		MustGetFlagString(options.DELETE_BEFORE), MustGetFlagInt(options.RETENTION_COUNT))
+	retainedTimestamps := make([]string, 0, len(dependentBackups))
+	for timestamp := range dependentBackups {
+		retainedTimestamps = append(retainedTimestamps, timestamp)
+	}
+	sort.Strings(retainedTimestamps)
+	for _, timestamp := range retainedTimestamps {
+		gplog.Warn("Backup %s will not be deleted, as incremental backup %s depends on it", timestamp, dependentBackups[timestamp])
+	}
+	if len(expiredBackups) == 0 {
+		gplog.Info("No backups of database %s need to be deleted", dbName)
+		return
+	}
+
+	configureS3Storage()
+	if pluginConfigFlag := MustGetFlagString(options.PLUGIN_CONFIG); pluginConfigFlag != "" {
+		pluginConfig, err = utils.ReadPluginConfig(pluginConfigFlag)
+		gplog.FatalOnError(err)
+		pluginConfig.CheckPluginExistsOnAllHosts(globalCluster)
+		pluginConfig.CopyPluginConfigToAllHosts(globalCluster)
+		defer pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
+	}
+
+	deletedTimestamps := make([]string, 0)
+	for _, backupConfig := range expiredBackups {
+		err = deleteBackup(backupConfig, segPrefix)
+		if err != nil {
+			gplog.Error(err.Error())
+			continue
+		}
+		deletedTimestamps = append(deletedTimestamps, backupConfig.Timestamp)
+	}
+	if len(deletedTimestamps) > 0 {
+		dateDeleted := history.CurrentTimestamp()
+		err = history.MarkBackupsDeleted(historyFilename, deletedTimestamps, dateDeleted)
+		gplog.FatalOnError(err)
+		if isHistoryDBRun() {
+			deletedBackups := make([]history.BackupConfig, 0, len(deletedTimestamps))
+			for _, backupConfig := range expiredBackups {
+				if utils.Exists(deletedTimestamps, backupConfig.Timestamp) {
+					backupConfig.DateDeleted = dateDeleted
+					deletedBackups = append(deletedBackups, backupConfig)
+				}
+			}
+			err = writeBackupHistoryToDB(deletedBackups)
+			gplog.FatalOnError(err)
+		}
+	}
+	gplog.Info("Deleted %d of %d expired backups of database %s", len(deletedTimestamps), len(expiredBackups), dbName)
+}
+
+/*
+ * Returns the backups of the given database that are older than deleteBefore,
+ * or older than the retentionCount most recent successful backups, newest
+ * first.  A backup that a retained incremental backup depends on is never
+ * returned; such backups are instead returned in a map from their timestamp
+ * to the timestamp of a dependent backup so that the caller can report them.
+ */
+func GetExpiredBackups(backupHistory *history.History, dbName string, deleteBefore string, retentionCount int) ([]history.BackupConfig, map[string]string) {
+	if len(deleteBefore) == 8 {
+		deleteBefore += "000000"
+	}
+	backups := make([]history.BackupConfig, 0)
+	for _, backupConfig := range backupHistory.BackupConfigs {
+		if backupConfig.DatabaseName == dbName && backupConfig.DateDeleted == "" {
+			backups = append(backups, backupConfig)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Timestamp > backups[j].Timestamp
+	})
+
+	expired := make([]history.BackupConfig, 0)
+	requiredBy := make(map[string]string)
+	numSucceeded := 0
+	for _, backupConfig := range backups {
+		isExpired := (deleteBefore != "" && backupConfig.Timestamp < deleteBefore) ||
+			(retentionCount > 0 && numSucceeded >= retentionCount)
+		if !backupConfig.Failed() {
+			numSucceeded++
+		}
+		if isExpired {
+			expired = append(expired, backupConfig)
+			continue
+		}
+		if backupConfig.Failed() {
+			continue
+		}
+		for _, entry := range backupConfig.RestorePlan {
+			if _, ok := requiredBy[entry.Timestamp]; !ok && entry.Timestamp != backupConfig.Timestamp {
+				requiredBy[entry.Timestamp] = backupConfig.Timestamp
+			}
+		}
+	}
+
+	expiredBackups := make([]history.BackupConfig, 0)
+	dependentBackups := make(map[string]string)
+	for _, backupConfig := range expired {
+		if dependent, ok := requiredBy[backupConfig.Timestamp]; ok {
+			dependentBackups[backupConfig.Timestamp] = dependent
+			continue
+		}
+		expiredBackups = append(expiredBackups, backupConfig)
+	}
+	return expiredBackups, dependentBackups
+}
+
+func deleteBackup(backupConfig history.BackupConfig, segPrefix string) error {
+	timestamp := backupConfig.Timestamp
+	if backupConfig.Plugin != "" {
+		if pluginConfig == nil {
+			return errors.Errorf("Backup %s was taken with plugin %s; --plugin-config must be specified to delete it", timestamp, backupConfig.Plugin)
+		}
+		gplog.Info("Deleting backup %s using plugin %s", timestamp, pluginConfig.ExecutablePath)
+		err := pluginConfig.DeleteBackup(timestamp)
+		if err != nil {
+			return err
+		}
+	}
+
+	gplog.Info("Deleting backup %s from local backup directories", timestamp)
+	fpInfo := filepath.NewFilePathInfo(globalCluster, backupConfig.BackupDir, timestamp, segPrefix)
+	if backupConfig.MetadataOnly {
+		// A metadata-only backup has no backup directories on the segment hosts
+		_, err := globalCluster.ExecuteLocalCommand(fmt.Sprintf("rm -rf %s", fpInfo.GetDirForContent(-1)))
+		if err != nil {
+			return errors.Errorf("Unable to delete backup directory for backup %s: %v", timestamp, err)
+		}
+		return nil
+	}
+	remoteOutput := globalCluster.GenerateAndExecuteCommand(fmt.Sprintf("Deleting backup directories for backup %s", timestamp),
+		cluster.ON_SEGMENTS|cluster.INCLUDE_MASTER,
+		func(contentID int) string {
+			return fmt.Sprintf("rm -rf %s", fpInfo.GetDirForContent(contentID))
+		})
+	if remoteOutput.NumErrors > 0 {
+		for _, failedCommand := range remoteOutput.FailedCommands {
+			gplog.Verbose("Command %s failed on segment %d: %v", failedCommand.CommandString, failedCommand.Content, failedCommand.Error)
+		}
+		return errors.Errorf("Unable to delete backup directories for backup %s on %d segments", timestamp, remoteOutput.NumErrors)
+	}
+	if backupConfig.Dedup {
+		pruneChunks(fpInfo)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/history"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/expire tests", func() {
+	Describe("IsValidDeleteBeforeDate", func() {
+		It("accepts a date or a full timestamp", func() {
+			Expect(backup.IsValidDeleteBeforeDate("20170101")).To(BeTrue())
+			Expect(backup.IsValidDeleteBeforeDate("20170101010101")).To(BeTrue())
+		})
+		It("rejects anything else", func() {
+			Expect(backup.IsValidDeleteBeforeDate("2017-01-01")).To(BeFalse())
+			Expect(backup.IsValidDeleteBeforeDate("201701010101")).To(BeFalse())
+			Expect(backup.IsValidDeleteBeforeDate("")).To(BeFalse())
+		})
+	})
+	Describe("GetExpiredBackups", func() {
+		newConfig := func(timestamp string, status string, restorePlan ...string) history.BackupConfig {
+			config := history.BackupConfig{
+				DatabaseName: "testdb",
+				Timestamp:    timestamp,
+				Status:       status,
+				Incremental:  len(restorePlan) > 0,
+				RestorePlan:  []history.RestorePlanEntry{},
+			}
+			for _, planTimestamp := range append(restorePlan, timestamp) {
+				config.RestorePlan = append(config.RestorePlan, history.RestorePlanEntry{Timestamp: planTimestamp})
+			}
+			return config
+		}
+		getTimestamps := func(configs []history.BackupConfig) []string {
+			timestamps := make([]string, 0)
+			for _, config := range configs {
+				timestamps = append(timestamps, config.Timestamp)
+			}
+			return timestamps
+		}
+		var backupHistory *history.History
+		BeforeEach(func() {
+			backupHistory = &history.History{BackupConfigs: []history.BackupConfig{
+				newConfig("20170105010101", history.BackupStatusSucceed),
+				newConfig("20170104010101", history.BackupStatusFailed),
+				newConfig("20170103010101", history.BackupStatusSucceed),
+				newConfig("20170102010101", history.BackupStatusSucceed),
+				newConfig("20170101010101", history.BackupStatusSucceed),
+			}}
+		})
+		It("returns backups taken before the given date", func() {
+			expired, dependents := backup.GetExpiredBackups(backupHistory, "testdb", "20170103", 0)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170102010101", "20170101010101"}))
+			Expect(dependents).To(BeEmpty())
+		})
+		It("returns backups taken before the given timestamp", func() {
+			expired, _ := backup.GetExpiredBackups(backupHistory, "testdb", "20170103010101", 0)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170102010101", "20170101010101"}))
+		})
+		It("keeps only the given number of successful backups", func() {
+			expired, _ := backup.GetExpiredBackups(backupHistory, "testdb", "", 2)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170102010101", "20170101010101"}))
+		})
+		It("expires failed backups older than the retained backups", func() {
+			expired, _ := backup.GetExpiredBackups(backupHistory, "testdb", "", 1)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170104010101", "20170103010101", "20170102010101", "20170101010101"}))
+		})
+		It("ignores backups of other databases and backups that are already deleted", func() {
+			backupHistory.BackupConfigs[3].DatabaseName = "otherdb"
+			backupHistory.BackupConfigs[4].DateDeleted = "20170106010101"
+			expired, _ := backup.GetExpiredBackups(backupHistory, "testdb", "20170103", 0)
+			Expect(expired).To(BeEmpty())
+		})
+		It("does not expire backups that a retained incremental backup depends on", func() {
+			backupHistory.BackupConfigs[0] = newConfig("20170105010101", history.BackupStatusSucceed, "20170101010101", "20170102010101")
+			expired, dependents := backup.GetExpiredBackups(backupHistory, "testdb", "", 1)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170104010101", "20170103010101"}))
+			Expect(dependents).To(Equal(map[string]string{
+				"20170102010101": "20170105010101",
+				"20170101010101": "20170105010101",
+			}))
+		})
+		It("expires an entire incremental chain if every backup in it is expired", func() {
+			backupHistory.BackupConfigs[3] = newConfig("20170102010101", history.BackupStatusSucceed, "20170101010101")
+			expired, dependents := backup.GetExpiredBackups(backupHistory, "testdb", "20170103", 0)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170102010101", "20170101010101"}))
+			Expect(dependents).To(BeEmpty())
+		})
+	})
+})
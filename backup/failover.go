@@ -0,0 +1,95 @@
+package backup
+
+/*
+ * This file contains functions for performing the file operations of segments
+ * whose hosts cannot be reached on the hosts of their mirrors instead.
+ */
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/pkg/errors"
+)
+
+/*
+ * The segment processes themselves still write their data files to the backup
+ * directory, so this only works if that directory is on storage shared by the
+ * primary and mirror hosts; --mirror-failover therefore requires --backup-dir.
+ */
+func failOverUnreachableSegmentHosts(segConfigs []cluster.SegConfig) ([]cluster.SegConfig, []string) {
+	allSegConfigs := cluster.MustGetSegmentConfiguration(connectionPool, true)
+	allHostsCluster := cluster.NewCluster(allSegConfigs)
+	unreachableHosts := GetUnreachableHosts(allHostsCluster)
+	if len(unreachableHosts) == 0 {
+		return segConfigs, []string{}
+	}
+	for _, host := range unreachableHosts {
+		gplog.Warn("Unable to reach host %s", host)
+	}
+	segConfigs, substitutions, err := SubstituteMirrorHosts(segConfigs, allSegConfigs, unreachableHosts)
+	gplog.FatalOnError(err)
+	for _, substitution := range substitutions {
+		gplog.Warn("Using mirror host for %s", substitution)
+	}
+	return segConfigs, substitutions
+}
+
+/*
+ * Returns the hosts in the cluster on which a trivial command cannot be run,
+ * in sorted order.
+ */
+func GetUnreachableHosts(c *cluster.Cluster) []string {
+	remoteOutput := c.GenerateAndExecuteCommand("Checking that all hosts can be reached",
+		cluster.ON_HOSTS|cluster.INCLUDE_MASTER|cluster.INCLUDE_MIRRORS,
+		func(host string) string {
+			return "true"
+		})
+	unreachableHosts := make([]string, 0)
+	for _, failedCommand := range remoteOutput.FailedCommands {
+		gplog.Verbose("Unable to reach host %s with error %s: %s", failedCommand.Host, failedCommand.Error, failedCommand.Stderr)
+		unreachableHosts = append(unreachableHosts, failedCommand.Host)
+	}
+	sort.Strings(unreachableHosts)
+	return unreachableHosts
+}
+
+/*
+ * Returns a copy of segConfigs in which each primary segment on an unreachable
+ * host has been given the hostname of its mirror, along with a description of
+ * each substitution.  A segment on an unreachable host with no mirror, or with
+ * a mirror on another unreachable host, is an error.
+ */
+func SubstituteMirrorHosts(segConfigs []cluster.SegConfig, allSegConfigs []cluster.SegConfig, unreachableHosts []string) ([]cluster.SegConfig, []string, error) {
+	isUnreachable := make(map[string]bool, len(unreachableHosts))
+	for _, host := range unreachableHosts {
+		isUnreachable[host] = true
+	}
+	mirrorHosts := make(map[int]string)
+	for _, segConfig := range allSegConfigs {
+		if segConfig.Role == "m" {
+			mirrorHosts[segConfig.ContentID] = segConfig.Hostname
+		}
+	}
+
+	newSegConfigs := make([]cluster.SegConfig, len(segConfigs))
+	substitutions := make([]string, 0)
+	for i, segConfig := range segConfigs {
+		newSegConfigs[i] = segConfig
+		if !isUnreachable[segConfig.Hostname] {
+			continue
+		}
+		mirrorHost, hasMirror := mirrorHosts[segConfig.ContentID]
+		if !hasMirror {
+			return nil, nil, errors.Errorf("Host %s of segment %d cannot be reached and the segment has no mirror", segConfig.Hostname, segConfig.ContentID)
+		}
+		if isUnreachable[mirrorHost] {
+			return nil, nil, errors.Errorf("Neither host %s of segment %d nor host %s of its mirror can be reached", segConfig.Hostname, segConfig.ContentID, mirrorHost)
+		}
+		newSegConfigs[i].Hostname = mirrorHost
+		substitutions = append(substitutions, fmt.Sprintf("segment %d: %s replaced by %s", segConfig.ContentID, segConfig.Hostname, mirrorHost))
+	}
+	return newSegConfigs, substitutions, nil
+}
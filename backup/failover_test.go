@@ -0,0 +1,82 @@
+package backup_test
+
+import (
+	"errors"
+	"os/user"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/failover tests", func() {
+	masterSeg := cluster.SegConfig{DbID: 1, ContentID: -1, Role: "p", Hostname: "mdw", DataDir: "/data/gpseg-1"}
+	primaryOne := cluster.SegConfig{DbID: 2, ContentID: 0, Role: "p", Hostname: "sdw1", DataDir: "/data/gpseg0"}
+	primaryTwo := cluster.SegConfig{DbID: 3, ContentID: 1, Role: "p", Hostname: "sdw2", DataDir: "/data/gpseg1"}
+	mirrorOne := cluster.SegConfig{DbID: 4, ContentID: 0, Role: "m", Hostname: "sdw2", DataDir: "/mirror/gpseg0"}
+	mirrorTwo := cluster.SegConfig{DbID: 5, ContentID: 1, Role: "m", Hostname: "sdw3", DataDir: "/mirror/gpseg1"}
+	primaries := []cluster.SegConfig{masterSeg, primaryOne, primaryTwo}
+	allSegments := []cluster.SegConfig{masterSeg, primaryOne, mirrorOne, primaryTwo, mirrorTwo}
+
+	Describe("GetUnreachableHosts", func() {
+		var testCluster *cluster.Cluster
+		var testExecutor *testhelper.TestExecutor
+		BeforeEach(func() {
+			operating.System.CurrentUser = func() (*user.User, error) { return &user.User{Username: "testUser"}, nil }
+			testExecutor = &testhelper.TestExecutor{}
+			testCluster = cluster.NewCluster(allSegments)
+			testCluster.Executor = testExecutor
+		})
+		AfterEach(func() {
+			operating.InitializeSystemFunctions()
+		})
+		It("returns no hosts when all hosts can be reached", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{NumErrors: 0}
+
+			Expect(backup.GetUnreachableHosts(testCluster)).To(BeEmpty())
+		})
+		It("returns the hosts on which the command failed in sorted order", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				NumErrors: 2,
+				FailedCommands: []*cluster.ShellCommand{
+					{Host: "sdw3", Error: errors.New("exit status 255")},
+					{Host: "sdw1", Error: errors.New("exit status 255")},
+				},
+			}
+
+			Expect(backup.GetUnreachableHosts(testCluster)).To(Equal([]string{"sdw1", "sdw3"}))
+		})
+	})
+	Describe("SubstituteMirrorHosts", func() {
+		It("replaces the host of each segment on an unreachable host with the host of its mirror", func() {
+			segConfigs, substitutions, err := backup.SubstituteMirrorHosts(primaries, allSegments, []string{"sdw1"})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(segConfigs[0].Hostname).To(Equal("mdw"))
+			Expect(segConfigs[1].Hostname).To(Equal("sdw2"))
+			Expect(segConfigs[1].DataDir).To(Equal("/data/gpseg0"))
+			Expect(segConfigs[2].Hostname).To(Equal("sdw2"))
+			Expect(substitutions).To(Equal([]string{"segment 0: sdw1 replaced by sdw2"}))
+		})
+		It("does not modify the segment configuration passed in", func() {
+			_, _, err := backup.SubstituteMirrorHosts(primaries, allSegments, []string{"sdw1"})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(primaries[1].Hostname).To(Equal("sdw1"))
+		})
+		It("returns an error if a segment on an unreachable host has no mirror", func() {
+			_, _, err := backup.SubstituteMirrorHosts(primaries, primaries, []string{"sdw1"})
+
+			Expect(err).To(MatchError("Host sdw1 of segment 0 cannot be reached and the segment has no mirror"))
+		})
+		It("returns an error if the mirror of a segment on an unreachable host is also unreachable", func() {
+			_, _, err := backup.SubstituteMirrorHosts(primaries, allSegments, []string{"sdw2", "sdw3"})
+
+			Expect(err).To(MatchError("Neither host sdw2 of segment 1 nor host sdw3 of its mirror can be reached"))
+		})
+	})
+})
@@ -1,6 +1,7 @@
 package backup
 
 import (
+	"os"
 	"sync"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
@@ -33,8 +34,25 @@ var (
 	version              string
 	wasTerminated        bool
 	backupLockFile       lockfile.Lockfile
+	backupDirectoryLock  *utils.DirectoryLock
 	filterRelationClause string
 	quotedRoleNames      map[string]string
+	compressionOverrides map[string]utils.PipeThroughProgram
+	slaTargets           *report.SLATargets
+	slaViolations        []string
+	backupJournal        *BackupJournal
+	runStatus            *utils.StatusTracker
+	dataCopyPause        *utils.DataCopyPause
+	logLevelControl      *utils.LogLevelControl
+	objectHandlers       []ObjectHandler
+	tableSizes           map[uint32]int64
+	splitPartitionRoots  map[uint32]bool
+	splitTables          map[uint32]int
+	tableTimings         *TableTimingRecorder
+	helperMonitor        *HelperMonitor
+	redactedCredentials  map[string]string
+	s3PluginConfigFile   string
+	machineOutput        *os.File
 	/*
 	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
 	 * and then wait for at least one DoCleanup to finish, either in DoTeardown
@@ -97,6 +115,26 @@ func SetQuotedRoleNames(quotedRoles map[string]string) {
 	quotedRoleNames = quotedRoles
 }
 
+func SetCompressionOverrides(overrides map[string]utils.PipeThroughProgram) {
+	compressionOverrides = overrides
+}
+
+func SetTableSizes(sizes map[uint32]int64) {
+	tableSizes = sizes
+}
+
+func SetSplitPartitionRoots(roots map[uint32]bool) {
+	splitPartitionRoots = roots
+}
+
+func SetSplitTables(tables map[uint32]int) {
+	splitTables = tables
+}
+
+func SetRedactedCredentials(credentials map[string]string) {
+	redactedCredentials = credentials
+}
+
 // Util functions to enable ease of access to global flag values
 
 func MustGetFlagString(flagName string) string {
@@ -118,3 +156,7 @@ func MustGetFlagStringSlice(flagName string) []string {
 func MustGetFlagStringArray(flagName string) []string {
 	return options.MustGetFlagStringArray(cmdFlags, flagName)
 }
+
+func SetObjectHandlers(handlers []ObjectHandler) {
+	objectHandlers = handlers
+}
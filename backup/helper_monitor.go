@@ -0,0 +1,253 @@
+package backup
+
+/*
+ * This file contains functions for monitoring the gpbackup_helper agents of a
+ * single data file backup through their heartbeats, so that an agent that
+ * dies mid-copy is detected within seconds and restarted, instead of the
+ * backup failing late without saying which segment was at fault.
+ */
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+var (
+	helperMonitorInterval  = 5 * time.Second
+	helperHeartbeatTimeout = 15
+)
+
+const helperRestartSavepoint = "gpbackup_helper_restart"
+
+/*
+ * Tracks the agents found dead, and the tables copied so far so that they can
+ * be copied again to an agent that resumes from an earlier table.  Agents can
+ * only be restarted if they checkpoint their data files, which they cannot do
+ * through a plugin; otherwise a dead agent fails the backup right away.  All
+ * methods may be called on a nil monitor.
+ */
+type HelperMonitor struct {
+	mutex       sync.Mutex
+	canRestart  bool
+	agentFlags  string
+	deadHelpers map[int]utils.HelperHeartbeat
+	copiedTasks []DataCopyTask
+	retriedOids map[uint32]bool
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+func NewHelperMonitor(canRestart bool, agentFlags string) *HelperMonitor {
+	return &HelperMonitor{
+		canRestart:  canRestart,
+		agentFlags:  agentFlags,
+		deadHelpers: make(map[int]utils.HelperHeartbeat),
+		copiedTasks: make([]DataCopyTask, 0),
+		retriedOids: make(map[uint32]bool),
+	}
+}
+
+/*
+ * Checks the heartbeats of the agents every interval until stopped.  The pipe
+ * of a dead agent is drained, as the COPY to it may otherwise wait forever.
+ */
+func (monitor *HelperMonitor) Start() {
+	monitor.done = make(chan struct{})
+	monitor.stopped = make(chan struct{})
+	go func() {
+		defer close(monitor.stopped)
+		ticker := time.NewTicker(helperMonitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-monitor.done:
+				return
+			case <-ticker.C:
+				monitor.mutex.Lock()
+				deadHelpers := monitor.checkHeartbeats()
+				if len(deadHelpers) > 0 {
+					utils.DrainSegmentPipes(globalCluster, globalFPInfo, deadHelpers)
+				}
+				monitor.mutex.Unlock()
+			}
+		}
+	}()
+}
+
+func (monitor *HelperMonitor) Stop() {
+	if monitor == nil || monitor.done == nil {
+		return
+	}
+	close(monitor.done)
+	<-monitor.stopped
+}
+
+/*
+ * Records the agents found dead since the last check, returning the new ones.
+ * Must be called with the mutex held.
+ */
+func (monitor *HelperMonitor) checkHeartbeats() []utils.HelperHeartbeat {
+	newlyDead := make([]utils.HelperHeartbeat, 0)
+	for _, heartbeat := range utils.CheckHelperHeartbeatsOnSegments(globalCluster, globalFPInfo, helperHeartbeatTimeout) {
+		if _, ok := monitor.deadHelpers[heartbeat.ContentID]; heartbeat.IsDead() && !ok {
+			gplog.Warn("%s", describeDeadHelper(heartbeat))
+			monitor.deadHelpers[heartbeat.ContentID] = heartbeat
+			newlyDead = append(newlyDead, heartbeat)
+		}
+	}
+	return newlyDead
+}
+
+/*
+ * Returns the agents found dead, checking the heartbeats first if a COPY
+ * failed, as an agent that just died may cause the failure before the next
+ * interval.
+ */
+func (monitor *HelperMonitor) takeDeadHelpers(checkNow bool) []utils.HelperHeartbeat {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	if checkNow {
+		monitor.checkHeartbeats()
+	}
+	deadHelpers := make([]utils.HelperHeartbeat, 0, len(monitor.deadHelpers))
+	for _, heartbeat := range monitor.deadHelpers {
+		deadHelpers = append(deadHelpers, heartbeat)
+	}
+	monitor.deadHelpers = make(map[int]utils.HelperHeartbeat)
+	return deadHelpers
+}
+
+func describeDeadHelper(heartbeat utils.HelperHeartbeat) string {
+	what := "stopped unexpectedly"
+	if heartbeat.Status == utils.HELPER_UNRESPONSIVE {
+		what = fmt.Sprintf("stopped responding for more than %d seconds", helperHeartbeatTimeout)
+	}
+	return fmt.Sprintf("gpbackup_helper on segment %d on host %s %s", heartbeat.ContentID, globalCluster.GetHostForContent(heartbeat.ContentID), what)
+}
+
+func describeDeadHelpers(deadHelpers []utils.HelperHeartbeat) string {
+	descriptions := make([]string, 0, len(deadHelpers))
+	for _, heartbeat := range deadHelpers {
+		descriptions = append(descriptions, describeDeadHelper(heartbeat))
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+/*
+ * Backs up the data of the table, restarting the agents if any of them died
+ * during the copy.  The COPY runs in a savepoint, as a failed COPY would
+ * otherwise abort the transaction that holds the snapshot of the backup.
+ */
+func (monitor *HelperMonitor) BackupTableData(task DataCopyTask, rowsCopiedMap map[uint32]int64, counters *BackupProgressCounters, whichConn int) error {
+	if monitor == nil {
+		return backupTableData(task, rowsCopiedMap, counters, whichConn)
+	}
+	if monitor.canRestart {
+		connectionPool.MustExec(fmt.Sprintf("SAVEPOINT %s", helperRestartSavepoint), whichConn)
+	}
+	err := backupTableData(task, rowsCopiedMap, counters, whichConn)
+	if monitor.canRestart {
+		if err != nil {
+			connectionPool.MustExec(fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", helperRestartSavepoint), whichConn)
+		} else {
+			connectionPool.MustExec(fmt.Sprintf("RELEASE SAVEPOINT %s", helperRestartSavepoint), whichConn)
+		}
+	}
+	deadHelpers := monitor.takeDeadHelpers(err != nil)
+	if len(deadHelpers) == 0 {
+		if err == nil && monitor.canRestart {
+			monitor.copiedTasks = append(monitor.copiedTasks, task)
+		}
+		return err
+	}
+	return monitor.restartHelpers(deadHelpers, task, err == nil, rowsCopiedMap, counters, whichConn)
+}
+
+/*
+ * The agents resume from the earliest table any of them is working on, as a
+ * COPY that fails on one segment is canceled on the others, possibly before
+ * their agents finished the previous table.  An agent records a checkpoint
+ * before it moves on to the next table, so every table before the one in its
+ * heartbeat is checkpointed.  The tables from that one up to the table whose
+ * copy failed are copied again.
+ */
+func GetHelperRetryTasks(copiedTasks []DataCopyTask, task DataCopyTask, heartbeats []utils.HelperHeartbeat) []DataCopyTask {
+	resumeOid := task.Table.Oid
+	for _, heartbeat := range heartbeats {
+		if heartbeat.Oid < resumeOid {
+			resumeOid = heartbeat.Oid
+		}
+	}
+	retryTasks := make([]DataCopyTask, 0)
+	for _, copiedTask := range copiedTasks {
+		if copiedTask.Table.Oid >= resumeOid {
+			retryTasks = append(retryTasks, copiedTask)
+		}
+	}
+	return append(retryTasks, task)
+}
+
+/*
+ * Restarts the agents on all segments from the checkpoints before the first
+ * table to copy again, as the COPY of a table runs on every segment at once,
+ * and copies the tables again.  Each table is retried once before the backup
+ * fails.
+ */
+func (monitor *HelperMonitor) restartHelpers(deadHelpers []utils.HelperHeartbeat, task DataCopyTask, taskRecorded bool,
+	rowsCopiedMap map[uint32]int64, counters *BackupProgressCounters, whichConn int) error {
+	table := task.Table
+	failure := fmt.Sprintf("%s while backing up table %s", describeDeadHelpers(deadHelpers), table.FQN())
+	if !monitor.canRestart || monitor.retriedOids[table.Oid] {
+		backupReport.HelperFailures = append(backupReport.HelperFailures, failure)
+		return errors.New(failure)
+	}
+	heartbeats := append(utils.CheckHelperHeartbeatsOnSegments(globalCluster, globalFPInfo, helperHeartbeatTimeout), deadHelpers...)
+	for _, heartbeat := range heartbeats {
+		if heartbeat.Status == utils.HELPER_ERROR {
+			// The agents that report errors would most likely fail again
+			backupReport.HelperFailures = append(backupReport.HelperFailures, failure)
+			return errors.New(failure)
+		}
+	}
+	monitor.retriedOids[table.Oid] = true
+	backupReport.HelperFailures = append(backupReport.HelperFailures, failure+", restarted")
+
+	retryTasks := GetHelperRetryTasks(monitor.copiedTasks, task, heartbeats)
+	resumeOid := fmt.Sprintf("%d", retryTasks[0].Table.Oid)
+	gplog.Warn("Restarting gpbackup_helper on all segments and backing up %d table(s) again, starting with table %s", len(retryTasks), retryTasks[0].Table.FQN())
+	utils.StopGpbackupHelpersForRestart(globalCluster, globalFPInfo)
+	utils.CreateFirstSegmentPipeOnAllHosts(resumeOid, globalCluster, globalFPInfo)
+	utils.StartGpbackupHelpers(globalCluster, globalFPInfo, "--backup-agent", "",
+		fmt.Sprintf("%s --resume-from-oid %s", monitor.agentFlags, resumeOid), false, false, &wasTerminated)
+
+	for _, retryTask := range retryTasks {
+		destinationToWrite := fmt.Sprintf("%s_%d", globalFPInfo.GetSegmentPipePathForCopyCommand(), retryTask.Table.Oid)
+		start := time.Now()
+		rowsCopied, err := CopyTableOut(connectionPool, retryTask.Table, destinationToWrite, whichConn)
+		if restartedDead := monitor.takeDeadHelpers(err != nil); len(restartedDead) > 0 {
+			failure = fmt.Sprintf("%s while backing up table %s after a restart", describeDeadHelpers(restartedDead), retryTask.Table.FQN())
+			backupReport.HelperFailures = append(backupReport.HelperFailures, failure)
+			return errors.New(failure)
+		}
+		if err != nil {
+			return err
+		}
+		if retryTask.Table.Oid == table.Oid && !taskRecorded {
+			err = recordTableData(table, start, rowsCopied, rowsCopiedMap, counters)
+			if err != nil {
+				return err
+			}
+		} else {
+			rowsCopiedMap[retryTask.Table.Oid] = rowsCopied
+		}
+	}
+	monitor.copiedTasks = append(monitor.copiedTasks, task)
+	gplog.Info("Backed up table %s after restarting gpbackup_helper", table.FQN())
+	return nil
+}
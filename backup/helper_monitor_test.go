@@ -0,0 +1,31 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/helper_monitor tests", func() {
+	Describe("GetHelperRetryTasks", func() {
+		task := func(oid uint32) backup.DataCopyTask {
+			return backup.DataCopyTask{Table: backup.Table{Relation: backup.Relation{Oid: oid, Schema: "public", Name: "foo"}}, NumStreams: 1}
+		}
+		copiedTasks := []backup.DataCopyTask{task(1), task(2), task(3)}
+
+		It("retries only the failed table if every agent is working on it", func() {
+			heartbeats := []utils.HelperHeartbeat{{ContentID: 0, Status: utils.HELPER_STOPPED, Oid: 4}, {ContentID: 1, Status: utils.HELPER_RUNNING, Oid: 4}}
+			Expect(backup.GetHelperRetryTasks(copiedTasks, task(4), heartbeats)).To(Equal([]backup.DataCopyTask{task(4)}))
+		})
+		It("retries the tables from the earliest table an agent is working on", func() {
+			heartbeats := []utils.HelperHeartbeat{{ContentID: 0, Status: utils.HELPER_STOPPED, Oid: 4}, {ContentID: 1, Status: utils.HELPER_RUNNING, Oid: 3}}
+			Expect(backup.GetHelperRetryTasks(copiedTasks, task(4), heartbeats)).To(Equal([]backup.DataCopyTask{task(3), task(4)}))
+		})
+		It("retries every table if an agent died before starting on any table", func() {
+			heartbeats := []utils.HelperHeartbeat{{ContentID: 0, Status: utils.HELPER_STOPPED, Oid: 0}}
+			Expect(backup.GetHelperRetryTasks(copiedTasks, task(4), heartbeats)).To(Equal([]backup.DataCopyTask{task(1), task(2), task(3), task(4)}))
+		})
+	})
+})
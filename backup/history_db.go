@@ -0,0 +1,60 @@
+package backup
+
+/*
+ * This file contains functions for --history-db, which records the backup
+ * history in a table of the given database as well as in the history file,
+ * and for --migrate-history, which copies the history file into the table.
+ * The history file is still written, as gprestore, incremental backups, and
+ * --delete-before and --retention-count read the backups from it.
+ */
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/pkg/errors"
+)
+
+func isHistoryDBRun() bool {
+	return MustGetFlagString(options.HISTORY_DB) != ""
+}
+
+func writeBackupHistoryToDB(backupConfigs []history.BackupConfig) error {
+	conn := dbconn.NewDBConnFromEnvironment(MustGetFlagString(options.HISTORY_DB))
+	err := conn.Connect(1)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return history.WriteBackupHistoryToDB(conn, backupConfigs)
+}
+
+func readBackupHistoryFromDB() *history.History {
+	conn := dbconn.NewDBConnFromEnvironment(MustGetFlagString(options.HISTORY_DB))
+	conn.MustConnect(1)
+	defer conn.Close()
+	backupHistory, err := history.NewHistoryFromDB(conn)
+	gplog.FatalOnError(err)
+	return backupHistory
+}
+
+/*
+ * Backups already in the table are replaced by those in the history file, so
+ * that the migration can be run again if it is interrupted.
+ */
+func DoMigrateHistory() {
+	SetLoggerVerbosity()
+	historyDB := MustGetFlagString(options.HISTORY_DB)
+	fpInfo := getMasterFPInfo(MustGetFlagString(options.DBNAME))
+	historyFilename := fpInfo.GetBackupHistoryFilePath()
+	if !iohelper.FileExistsAndIsReadable(historyFilename) {
+		gplog.Fatal(errors.Errorf("No backup history found at %s", historyFilename), "")
+	}
+	backupHistory, err := history.NewHistory(historyFilename)
+	gplog.FatalOnError(err)
+	err = writeBackupHistoryToDB(backupHistory.BackupConfigs)
+	gplog.FatalOnError(err)
+	gplog.Info("Migrated %d backup(s) from %s to table %s of database %s", len(backupHistory.BackupConfigs), historyFilename, history.HISTORY_TABLE, historyDB)
+}
@@ -12,12 +12,19 @@ import (
 	"github.com/pkg/errors"
 )
 
-func FilterTablesForIncremental(lastBackupTOC, currentTOC *toc.TOC, tables []Table) []Table {
+/*
+ * Heap tables are only filtered out if trackHeapChanges is set, as their
+ * modification counts come from the statistics collector, which does not
+ * guarantee that every change is counted.
+ */
+func FilterTablesForIncremental(lastBackupTOC, currentTOC *toc.TOC, tables []Table, trackHeapChanges bool) []Table {
 	var filteredTables []Table
 	for _, table := range tables {
 		currentAOEntry, isAOTable := currentTOC.IncrementalMetadata.AO[table.FQN()]
 		if !isAOTable {
-			filteredTables = append(filteredTables, table)
+			if !trackHeapChanges || isHeapTableModified(lastBackupTOC, currentTOC, table.FQN()) {
+				filteredTables = append(filteredTables, table)
+			}
 			continue
 		}
 		previousAOEntry := lastBackupTOC.IncrementalMetadata.AO[table.FQN()]
@@ -30,6 +37,15 @@ func FilterTablesForIncremental(lastBackupTOC, currentTOC *toc.TOC, tables []Tab
 	return filteredTables
 }
 
+func isHeapTableModified(lastBackupTOC, currentTOC *toc.TOC, tableFQN string) bool {
+	currentHeapEntry, isHeapTable := currentTOC.IncrementalMetadata.Heap[tableFQN]
+	if !isHeapTable {
+		return true
+	}
+	previousHeapEntry, ok := lastBackupTOC.IncrementalMetadata.Heap[tableFQN]
+	return !ok || previousHeapEntry != currentHeapEntry
+}
+
 func GetTargetBackupTimestamp() string {
 	targetTimestamp := ""
 	if fromTimestamp := MustGetFlagString(options.FROM_TIMESTAMP); fromTimestamp != "" {
@@ -62,9 +78,18 @@ func GetLatestMatchingBackupTimestamp() string {
 	return latestTimestamp
 }
 
+/*
+ * A differential backup is always based off a full backup, so that only the
+ * full backup and the differential backup are needed to restore it.  Backups
+ * recorded as unchanged have no files of their own to base a backup on.
+ */
 func GetLatestMatchingBackupConfig(history *history.History, currentBackupConfig *history.BackupConfig) *history.BackupConfig {
 	for _, backupConfig := range history.BackupConfigs {
-		if matchesIncrementalFlags(&backupConfig, currentBackupConfig) && !backupConfig.Failed() {
+		if currentBackupConfig.Differential && backupConfig.Incremental {
+			continue
+		}
+		if matchesIncrementalFlags(&backupConfig, currentBackupConfig) && !backupConfig.Failed() && backupConfig.DateDeleted == "" &&
+			backupConfig.UnchangedSince == "" {
 			return &backupConfig
 		}
 	}
@@ -80,6 +105,7 @@ func matchesIncrementalFlags(backupConfig *history.BackupConfig, currentBackupCo
 		pluginBinaryName == currentBackupConfig.Plugin &&
 		backupConfig.SingleDataFile == MustGetFlagBool(options.SINGLE_DATA_FILE) &&
 		backupConfig.Compressed == currentBackupConfig.Compressed &&
+		backupConfig.Dedup == currentBackupConfig.Dedup &&
 		// Expanding of the include list happens before this now so we must compare again current backup config
 		utils.NewIncludeSet(backupConfig.IncludeRelations).Equals(utils.NewIncludeSet(currentBackupConfig.IncludeRelations)) &&
 		utils.NewIncludeSet(backupConfig.IncludeSchemas).Equals(utils.NewIncludeSet(MustGetFlagStringArray(options.INCLUDE_SCHEMA))) &&
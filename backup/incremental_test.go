@@ -59,7 +59,7 @@ var _ = Describe("backup/incremental tests", func() {
 			tblAOUnchanged,
 		}
 
-		filteredTables := backup.FilterTablesForIncremental(&prevTOC, &currTOC, tables)
+		filteredTables := backup.FilterTablesForIncremental(&prevTOC, &currTOC, tables, false)
 
 		It("Should include the heap table in the filtered list", func() {
 			Expect(filteredTables).To(ContainElement(tblHeap))
@@ -76,6 +76,58 @@ var _ = Describe("backup/incremental tests", func() {
 		It("Should NOT include the unmodified AO table", func() {
 			Expect(filteredTables).To(Not(ContainElement(tblAOUnchanged)))
 		})
+
+		Context("When tracking heap table changes", func() {
+			defaultHeapEntry := toc.HeapEntry{
+				Modcount:         10,
+				RelFileNode:      16384,
+				LastDDLTimestamp: "00000",
+			}
+			prevTOC.IncrementalMetadata.Heap = map[string]toc.HeapEntry{
+				"public.heap_changed_modcount":    defaultHeapEntry,
+				"public.heap_changed_relfilenode": defaultHeapEntry,
+				"public.heap_unchanged":           defaultHeapEntry,
+			}
+			currTOC.IncrementalMetadata.Heap = map[string]toc.HeapEntry{
+				"public.heap_changed_modcount": {
+					Modcount:         11,
+					RelFileNode:      16384,
+					LastDDLTimestamp: "00000",
+				},
+				"public.heap_changed_relfilenode": {
+					Modcount:         10,
+					RelFileNode:      16385,
+					LastDDLTimestamp: "00000",
+				},
+				"public.heap_unchanged": defaultHeapEntry,
+				"public.heap_new":       defaultHeapEntry,
+			}
+
+			tblHeapChangedModcount := backup.Table{Relation: backup.Relation{Schema: "public", Name: "heap_changed_modcount"}}
+			tblHeapChangedRelfilenode := backup.Table{Relation: backup.Relation{Schema: "public", Name: "heap_changed_relfilenode"}}
+			tblHeapUnchanged := backup.Table{Relation: backup.Relation{Schema: "public", Name: "heap_unchanged"}}
+			tblHeapNew := backup.Table{Relation: backup.Relation{Schema: "public", Name: "heap_new"}}
+			heapTables := append([]backup.Table{tblHeapChangedModcount, tblHeapChangedRelfilenode, tblHeapUnchanged, tblHeapNew}, tables...)
+
+			filteredHeapTables := backup.FilterTablesForIncremental(&prevTOC, &currTOC, heapTables, true)
+
+			It("Should include the heap tables having a modified modcount or relfilenode", func() {
+				Expect(filteredHeapTables).To(ContainElement(tblHeapChangedModcount))
+				Expect(filteredHeapTables).To(ContainElement(tblHeapChangedRelfilenode))
+			})
+
+			It("Should include a heap table that was not in the previous backup", func() {
+				Expect(filteredHeapTables).To(ContainElement(tblHeapNew))
+			})
+
+			It("Should include a heap table with no incremental metadata", func() {
+				Expect(filteredHeapTables).To(ContainElement(tblHeap))
+			})
+
+			It("Should NOT include the unmodified heap table", func() {
+				Expect(filteredHeapTables).To(Not(ContainElement(tblHeapUnchanged)))
+			})
+		})
 	})
 
 	Describe("GetLatestMatchingBackupConfig", func() {
@@ -99,6 +151,40 @@ var _ = Describe("backup/incremental tests", func() {
 
 			structmatcher.ExpectStructsToMatch(contents.BackupConfigs[2], latestBackupHistoryEntry)
 		})
+		It("Should skip incremental backups when taking a differential backup", func() {
+			differentialContents := history.History{BackupConfigs: []history.BackupConfig{
+				{DatabaseName: "test1", Timestamp: "timestamp3", Incremental: true},
+				{DatabaseName: "test1", Timestamp: "timestamp2", Incremental: true, Differential: true},
+				{DatabaseName: "test1", Timestamp: "timestamp1"},
+			}}
+			currentBackupConfig := history.BackupConfig{DatabaseName: "test1", Incremental: true, Differential: true}
+
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(&differentialContents, &currentBackupConfig)
+
+			structmatcher.ExpectStructsToMatch(differentialContents.BackupConfigs[2], latestBackupHistoryEntry)
+		})
+		It("should skip backups that were recorded as unchanged since another backup", func() {
+			unchangedContents := history.History{BackupConfigs: []history.BackupConfig{
+				{DatabaseName: "test1", Timestamp: "timestamp2", UnchangedSince: "timestamp1"},
+				{DatabaseName: "test1", Timestamp: "timestamp1"},
+			}}
+			currentBackupConfig := history.BackupConfig{DatabaseName: "test1"}
+
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(&unchangedContents, &currentBackupConfig)
+
+			structmatcher.ExpectStructsToMatch(unchangedContents.BackupConfigs[1], latestBackupHistoryEntry)
+		})
+		It("should skip backups that do not match the current backup's deduplication", func() {
+			dedupContents := history.History{BackupConfigs: []history.BackupConfig{
+				{DatabaseName: "test1", Timestamp: "timestamp2"},
+				{DatabaseName: "test1", Timestamp: "timestamp1", Dedup: true},
+			}}
+			currentBackupConfig := history.BackupConfig{DatabaseName: "test1", Dedup: true}
+
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(&dedupContents, &currentBackupConfig)
+
+			structmatcher.ExpectStructsToMatch(dedupContents.BackupConfigs[1], latestBackupHistoryEntry)
+		})
 		It("should return nil with no matching Dbname", func() {
 			currentBackupConfig := history.BackupConfig{DatabaseName: "test3"}
 
@@ -0,0 +1,263 @@
+package backup
+
+/*
+ * This file contains structs and functions for recording which tables have
+ * had their data backed up, so that an interrupted backup can be resumed
+ * with --resume instead of being started over.
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/pkg/errors"
+)
+
+/*
+ * The journal has one line per table of the form "<oid> <rows copied>",
+ * appended once the COPY for that table has completed on all segments.  A
+ * table that is backed up again after a resume has a second line, and the
+ * last line for a table takes precedence.
+ */
+type BackupJournal struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+func NewBackupJournal(filename string) (*BackupJournal, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupJournal{file: file}, nil
+}
+
+func (journal *BackupJournal) RecordTable(oid uint32, rowsCopied int64) error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	_, err := fmt.Fprintf(journal.file, "%d %d\n", oid, rowsCopied)
+	if err != nil {
+		return err
+	}
+	return journal.file.Sync()
+}
+
+func (journal *BackupJournal) Close() {
+	_ = journal.file.Close()
+}
+
+func ReadBackupJournal(filename string) (map[uint32]int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	journaledRows := make(map[uint32]int64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, errors.Errorf("Invalid line in backup journal %s: %s", filename, scanner.Text())
+		}
+		oid, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("Invalid line in backup journal %s: %s", filename, scanner.Text())
+		}
+		rowsCopied, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("Invalid line in backup journal %s: %s", filename, scanner.Text())
+		}
+		journaledRows[uint32(oid)] = rowsCopied
+	}
+	return journaledRows, scanner.Err()
+}
+
+/*
+ * Journals are only kept for backups that write one file per table to the
+ * backup directories, as those are the only files that can be checked when
+ * resuming.
+ */
+func isResumableBackup() bool {
+	return !MustGetFlagBool(options.SINGLE_DATA_FILE) && MustGetFlagString(options.PLUGIN_CONFIG) == ""
+}
+
+/*
+ * Checks that the backup being resumed did not complete and was taken with
+ * the same options, then removes the files on the master that will be written
+ * again, along with its history entry.
+ */
+func prepareToResumeBackup() {
+	journalFilename := globalFPInfo.GetBackupJournalFilePath()
+	if _, err := os.Stat(journalFilename); err != nil {
+		gplog.Fatal(errors.Errorf("No backup journal found at %s; backup %s cannot be resumed", journalFilename, globalFPInfo.Timestamp), "")
+	}
+	if configFilename := globalFPInfo.GetConfigFilePath(); iohelper.FileExistsAndIsReadable(configFilename) {
+		previousConfig := history.ReadConfigFile(configFilename)
+		if !matchesIncrementalFlags(previousConfig, &backupReport.BackupConfig) || previousConfig.Incremental != backupReport.Incremental ||
+			previousConfig.DataOnly != backupReport.DataOnly {
+			gplog.Fatal(errors.Errorf("Backup %s was taken with different options and cannot be resumed with the options provided", globalFPInfo.Timestamp), "")
+		}
+	}
+
+	historyFilename := globalFPInfo.GetBackupHistoryFilePath()
+	if backupHistory, err := history.NewHistory(historyFilename); err == nil {
+		backupConfigs := make([]history.BackupConfig, 0)
+		for _, backupConfig := range backupHistory.BackupConfigs {
+			if backupConfig.Timestamp != globalFPInfo.Timestamp {
+				backupConfigs = append(backupConfigs, backupConfig)
+			} else if !backupConfig.Failed() {
+				gplog.Fatal(errors.Errorf("Backup %s completed successfully and cannot be resumed", globalFPInfo.Timestamp), "")
+			}
+		}
+		if len(backupConfigs) != len(backupHistory.BackupConfigs) {
+			backupHistory.BackupConfigs = backupConfigs
+			err = backupHistory.RewriteHistoryFile(historyFilename)
+			gplog.FatalOnError(err)
+		}
+	}
+
+	logPreviousTOCProgress()
+	for _, filename := range []string{globalFPInfo.GetConfigFilePath(), globalFPInfo.GetBackupReportFilePath(),
+		globalFPInfo.GetTOCFilePath(), globalFPInfo.GetTOCProgressFilePath(), globalFPInfo.GetMetadataFilePath(),
+		globalFPInfo.GetStatisticsFilePath()} {
+		err := os.Remove(filename)
+		if err != nil && !os.IsNotExist(err) {
+			gplog.FatalOnError(err)
+		}
+	}
+	backupReport.Resumed = true
+	gplog.Warn("Resuming backup %s.  Data backed up before the interruption was copied in a different transaction than the remaining data, so the backup is not a consistent snapshot of the database.", globalFPInfo.Timestamp)
+}
+
+/*
+ * The TOC entries of a backup are appended to the TOC progress file as they
+ * are added, so that a backup that does not complete shows how far it got.
+ */
+func openTOCProgressFile() {
+	progressFile, err := toc.NewProgressFile(globalFPInfo.GetTOCProgressFilePath(), toc.ProgressBatchSize)
+	if err != nil {
+		gplog.Warn("Unable to create TOC progress file: %v", err)
+		return
+	}
+	globalTOC.SetProgressFile(progressFile)
+}
+
+func logPreviousTOCProgress() {
+	progressFilename := globalFPInfo.GetTOCProgressFilePath()
+	entries, err := toc.ReadProgressFile(progressFilename)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		gplog.Warn("Unable to read TOC progress file: %v", err)
+		return
+	}
+	counts := toc.CountProgressEntries(entries)
+	gplog.Info("Before the interruption, backup %s added %d global, %d predata, %d postdata, and %d statistics entries and the data entries of %d tables to its TOC",
+		globalFPInfo.Timestamp, counts["global"], counts["predata"], counts["postdata"], counts["statistics"], counts["data"])
+	if len(entries) > 0 {
+		gplog.Verbose("The last TOC entry added was the %s", entries[len(entries)-1].Description())
+	}
+}
+
+/*
+ * Returns the number of rows copied for each table in the journal whose data
+ * files are intact on all segments, and removes every other data file from
+ * the segment backup directories so that the data of the remaining tables can
+ * be backed up again and no files of dropped tables are left behind.
+ */
+func GetResumedTables(tables []Table, journaledRows map[uint32]int64) map[uint32]int64 {
+	journaledTables := make([]Table, 0)
+	for _, table := range tables {
+		if _, ok := journaledRows[table.Oid]; ok && !table.SkipDataBackup() {
+			journaledTables = append(journaledTables, table)
+		}
+	}
+
+	invalidOids := make(map[uint32]bool)
+	if len(journaledTables) > 0 {
+		remoteOutput := globalCluster.GenerateAndExecuteCommand("Checking data files of previously backed up tables", cluster.ON_SEGMENTS, func(contentID int) string {
+			return getDataFileCheckCommand(contentID, journaledTables)
+		})
+		globalCluster.CheckClusterError(remoteOutput, "Unable to check data files of previously backed up tables", func(contentID int) string {
+			return "Unable to check data files"
+		})
+		for _, command := range remoteOutput.Commands {
+			for _, line := range strings.Fields(command.Stdout) {
+				oid, err := strconv.ParseUint(line, 10, 32)
+				if err == nil {
+					invalidOids[uint32(oid)] = true
+				}
+			}
+		}
+	}
+
+	resumedRows := make(map[uint32]int64)
+	resumedTables := make([]Table, 0)
+	for _, table := range journaledTables {
+		if invalidOids[table.Oid] {
+			gplog.Verbose("Data files for table %s are missing or damaged; its data will be backed up again", table.FQN())
+			continue
+		}
+		resumedRows[table.Oid] = journaledRows[table.Oid]
+		resumedTables = append(resumedTables, table)
+	}
+
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Removing incomplete data files", cluster.ON_SEGMENTS, func(contentID int) string {
+		return getDataFileCleanupCommand(contentID, resumedTables)
+	})
+	globalCluster.CheckClusterError(remoteOutput, "Unable to remove incomplete data files", func(contentID int) string {
+		return "Unable to remove incomplete data files"
+	})
+	return resumedRows
+}
+
+/*
+ * Prints the oid of each table whose data file is missing or, for compressed
+ * files, fails the integrity check of its compression program.
+ */
+func getDataFileCheckCommand(contentID int, tables []Table) string {
+	checks := make([]string, 0, len(tables))
+	for _, table := range tables {
+		extension := getPipeThroughProgramForTable(table).Extension
+		filename := globalFPInfo.GetTableBackupFilePath(contentID, table.Oid, extension, false)
+		checkCommand := "test -f"
+		switch extension {
+		case ".gz":
+			checkCommand = "gzip -t"
+		case ".zst":
+			checkCommand = "zstd -t -q"
+		}
+		checks = append(checks, fmt.Sprintf("(%s %s > /dev/null 2>&1 || echo %d)", checkCommand, filename, table.Oid))
+	}
+	return strings.Join(checks, "; ")
+}
+
+func getDataFileCleanupCommand(contentID int, keptTables []Table) string {
+	keptFilenames := make([]string, 0, len(keptTables))
+	for _, table := range keptTables {
+		extension := getPipeThroughProgramForTable(table).Extension
+		keptFilenames = append(keptFilenames, fmt.Sprintf("gpbackup_%d_%s_%d%s", contentID, globalFPInfo.Timestamp, table.Oid, extension))
+	}
+	sort.Strings(keptFilenames)
+	removeCommand := fmt.Sprintf(`for f in gpbackup_%d_%s_*; do rm -f "$f"; done`, contentID, globalFPInfo.Timestamp)
+	if len(keptFilenames) > 0 {
+		removeCommand = fmt.Sprintf(`for f in gpbackup_%d_%s_*; do case "$f" in %s) ;; *) rm -f "$f";; esac; done`,
+			contentID, globalFPInfo.Timestamp, strings.Join(keptFilenames, "|"))
+	}
+	return fmt.Sprintf("cd %s && %s", globalFPInfo.GetDirForContent(contentID), removeCommand)
+}
@@ -0,0 +1,102 @@
+package backup_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/journal tests", func() {
+	Describe("BackupJournal", func() {
+		var journalFilename string
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("/tmp", "gpbackup_test_journal*")
+			Expect(err).To(Not(HaveOccurred()))
+			_ = file.Close()
+			journalFilename = file.Name()
+		})
+		AfterEach(func() {
+			_ = os.Remove(journalFilename)
+		})
+		It("reads back the tables recorded in the journal", func() {
+			journal, err := backup.NewBackupJournal(journalFilename)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(journal.RecordTable(16384, 10)).To(Succeed())
+			Expect(journal.RecordTable(16390, 0)).To(Succeed())
+			journal.Close()
+
+			journaledRows, err := backup.ReadBackupJournal(journalFilename)
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(journaledRows).To(Equal(map[uint32]int64{16384: 10, 16390: 0}))
+		})
+		It("appends to an existing journal, with later lines taking precedence", func() {
+			Expect(ioutil.WriteFile(journalFilename, []byte("16384 10\n16390 5\n"), 0644)).To(Succeed())
+			journal, err := backup.NewBackupJournal(journalFilename)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(journal.RecordTable(16390, 7)).To(Succeed())
+			journal.Close()
+
+			journaledRows, err := backup.ReadBackupJournal(journalFilename)
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(journaledRows).To(Equal(map[uint32]int64{16384: 10, 16390: 7}))
+		})
+		It("returns an error for a malformed journal", func() {
+			Expect(ioutil.WriteFile(journalFilename, []byte("16384 10\nnot a table\n"), 0644)).To(Succeed())
+
+			_, err := backup.ReadBackupJournal(journalFilename)
+
+			Expect(err).To(MatchError("Invalid line in backup journal " + journalFilename + ": not a table"))
+		})
+	})
+	Describe("GetResumedTables", func() {
+		var testExecutor *testhelper.TestExecutor
+		tableOne := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "one"}}
+		tableTwo := backup.Table{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "two"}}
+		tableThree := backup.Table{Relation: backup.Relation{Oid: 3, Schema: "public", Name: "three"}}
+		tables := []backup.Table{tableOne, tableTwo, tableThree}
+		journaledRows := map[uint32]int64{1: 10, 2: 20, 4: 40}
+		BeforeEach(func() {
+			testExecutor = &testhelper.TestExecutor{}
+			testCluster := testutils.SetDefaultSegmentConfiguration()
+			testCluster.Executor = testExecutor
+			backup.SetCluster(testCluster)
+			backup.SetFPInfo(filepath.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg"))
+			utils.SetPipeThroughProgram(utils.NewPipeThroughProgram(true, "gzip", 1))
+		})
+		It("returns the journaled tables whose data files are intact on all segments", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Commands: []cluster.ShellCommand{{Content: 0, Stdout: ""}, {Content: 1, Stdout: "2\n"}},
+			}
+
+			resumedRows := backup.GetResumedTables(tables, journaledRows)
+
+			Expect(resumedRows).To(Equal(map[uint32]int64{1: 10}))
+		})
+		It("checks the data files of the journaled tables and removes all other data files", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Commands: []cluster.ShellCommand{{Content: 0, Stdout: ""}, {Content: 1, Stdout: ""}},
+			}
+
+			backup.GetResumedTables(tables, journaledRows)
+
+			Expect(testExecutor.ClusterCommands).To(HaveLen(2))
+			checkCommand := testExecutor.ClusterCommands[0][0].CommandString
+			Expect(checkCommand).To(ContainSubstring("(gzip -t gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_1.gz > /dev/null 2>&1 || echo 1)"))
+			Expect(checkCommand).To(ContainSubstring("(gzip -t gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_2.gz > /dev/null 2>&1 || echo 2)"))
+			Expect(checkCommand).To(Not(ContainSubstring("_3.gz")))
+			cleanupCommand := testExecutor.ClusterCommands[1][0].CommandString
+			Expect(cleanupCommand).To(ContainSubstring(`cd gpseg0/backups/20170101/20170101010101 && for f in gpbackup_0_20170101010101_*; do case "$f" in gpbackup_0_20170101010101_1.gz|gpbackup_0_20170101010101_2.gz) ;; *) rm -f "$f";; esac; done`))
+		})
+	})
+})
@@ -0,0 +1,267 @@
+package backup
+
+/*
+ * This file contains functions for listing the backups and restores recorded
+ * in the backup and restore history files.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Size is -1 if the size of the backup was not recorded, as is the case for
+ * plugin backups and backups taken by older versions of gpbackup.
+ */
+type BackupListEntry struct {
+	Timestamp string   `json:"timestamp"`
+	Type      string   `json:"type"`
+	Database  string   `json:"database"`
+	Size      int64    `json:"size"`
+	Status    string   `json:"status"`
+	Flags     []string `json:"flags"`
+}
+
+type RestoreListEntry struct {
+	Timestamp       string   `json:"timestamp"`
+	BackupTimestamp string   `json:"backup_timestamp"`
+	SourceDatabase  string   `json:"source_database"`
+	TargetDatabase  string   `json:"target_database"`
+	TargetCluster   string   `json:"target_cluster"`
+	Duration        string   `json:"duration"`
+	Status          string   `json:"status"`
+	Filters         []string `json:"filters"`
+}
+
+func DoListBackups() {
+	SetLoggerVerbosity()
+	dbName := MustGetFlagString(options.DBNAME)
+	fpInfo := getMasterFPInfo(dbName)
+	backupHistory := readBackupHistory(fpInfo.GetBackupHistoryFilePath())
+
+	entries := GetBackupList(backupHistory, dbName)
+	var err error
+	if MustGetFlagString(options.LIST_FORMAT) == "json" {
+		err = PrintListJSON(operating.System.Stdout, entries)
+	} else {
+		err = PrintBackupListTable(operating.System.Stdout, entries)
+	}
+	gplog.FatalOnError(err)
+}
+
+func DoListRestores() {
+	SetLoggerVerbosity()
+	dbName := MustGetFlagString(options.DBNAME)
+	fpInfo := getMasterFPInfo(dbName)
+	historyFilename := fpInfo.GetRestoreHistoryFilePath()
+	restoreHistory := &history.RestoreHistory{RestoreConfigs: make([]history.RestoreConfig, 0)}
+	if iohelper.FileExistsAndIsReadable(historyFilename) {
+		var err error
+		restoreHistory, err = history.NewRestoreHistory(historyFilename)
+		gplog.FatalOnError(err)
+	} else {
+		gplog.Verbose("No restore history found at %s", historyFilename)
+	}
+
+	entries := GetRestoreList(restoreHistory, dbName)
+	var err error
+	if MustGetFlagString(options.LIST_FORMAT) == "json" {
+		err = PrintListJSON(operating.System.Stdout, entries)
+	} else {
+		err = PrintRestoreListTable(operating.System.Stdout, entries)
+	}
+	gplog.FatalOnError(err)
+}
+
+func readBackupHistory(historyFilename string) *history.History {
+	if isHistoryDBRun() {
+		return readBackupHistoryFromDB()
+	}
+	backupHistory := &history.History{BackupConfigs: make([]history.BackupConfig, 0)}
+	if iohelper.FileExistsAndIsReadable(historyFilename) {
+		var err error
+		backupHistory, err = history.NewHistory(historyFilename)
+		gplog.FatalOnError(err)
+	} else {
+		gplog.Verbose("No backup history found at %s", historyFilename)
+	}
+	return backupHistory
+}
+
+func getMasterFPInfo(dbName string) filepath.FilePathInfo {
+	conn := dbconn.NewDBConnFromEnvironment(dbName)
+	conn.MustConnect(1)
+	segConfig := cluster.MustGetSegmentConfiguration(conn)
+	conn.Close()
+	globalCluster = cluster.NewCluster(segConfig)
+	fpInfo := filepath.NewFilePathInfo(globalCluster, "", "", "")
+	useClientMasterDir(&fpInfo)
+	return fpInfo
+}
+
+/*
+ * Returns an entry for each backup of the given database, newest first.
+ * Backups that have been deleted are included with a status of "Deleted".
+ */
+func GetBackupList(backupHistory *history.History, dbName string) []BackupListEntry {
+	entries := make([]BackupListEntry, 0)
+	for _, backupConfig := range backupHistory.BackupConfigs {
+		if backupConfig.DatabaseName != dbName {
+			continue
+		}
+		entry := BackupListEntry{
+			Timestamp: backupConfig.Timestamp,
+			Type:      "full",
+			Database:  backupConfig.DatabaseName,
+			Size:      -1,
+			Status:    backupConfig.Status,
+			Flags:     getBackupConfigFlags(backupConfig),
+		}
+		if backupConfig.Differential {
+			entry.Type = "differential"
+		} else if backupConfig.Incremental {
+			entry.Type = "incremental"
+		}
+		if backupConfig.BackupSize > 0 {
+			entry.Size = backupConfig.BackupSize
+		}
+		if backupConfig.DateDeleted != "" {
+			entry.Status = "Deleted"
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func getBackupConfigFlags(backupConfig history.BackupConfig) []string {
+	flags := make([]string, 0)
+	addFlag := func(isSet bool, flag string) {
+		if isSet {
+			flags = append(flags, fmt.Sprintf("--%s", flag))
+		}
+	}
+	addListFlag := func(values []string, flag string) {
+		for _, value := range values {
+			flags = append(flags, fmt.Sprintf("--%s %s", flag, value))
+		}
+	}
+	if backupConfig.BackupDir != "" {
+		flags = append(flags, fmt.Sprintf("--%s %s", options.BACKUP_DIR, backupConfig.BackupDir))
+	}
+	if backupConfig.Compressed && backupConfig.CompressionType != "" && backupConfig.CompressionType != "gzip" {
+		flags = append(flags, fmt.Sprintf("--%s %s", options.COMPRESSION_TYPE, backupConfig.CompressionType))
+	}
+	addFlag(backupConfig.DataOnly, options.DATA_ONLY)
+	addFlag(backupConfig.Differential, options.DIFFERENTIAL)
+	addListFlag(backupConfig.ExcludeRelations, options.EXCLUDE_RELATION)
+	addListFlag(backupConfig.ExcludeSchemas, options.EXCLUDE_SCHEMA)
+	addListFlag(backupConfig.IncludeRelations, options.INCLUDE_RELATION)
+	addListFlag(backupConfig.IncludeSchemas, options.INCLUDE_SCHEMA)
+	addFlag(backupConfig.Incremental, options.INCREMENTAL)
+	addFlag(backupConfig.LeafPartitionData, options.LEAF_PARTITION_DATA)
+	addFlag(backupConfig.MetadataOnly, options.METADATA_ONLY)
+	addFlag(!backupConfig.Compressed, options.NO_COMPRESSION)
+	addFlag(backupConfig.Plugin != "", options.PLUGIN_CONFIG)
+	addFlag(backupConfig.SingleDataFile, options.SINGLE_DATA_FILE)
+	addFlag(backupConfig.WithStatistics, options.WITH_STATS)
+	addFlag(backupConfig.WithoutGlobals, options.WITHOUT_GLOBALS)
+	return flags
+}
+
+func PrintBackupListTable(writer io.Writer, entries []BackupListEntry) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tabWriter, "TIMESTAMP\tTYPE\tDATABASE\tSIZE\tSTATUS\tFLAGS")
+	for _, entry := range entries {
+		size := "unknown"
+		if entry.Size >= 0 {
+			size = utils.FormatSize(entry.Size)
+		}
+		_, _ = fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Timestamp, entry.Type,
+			entry.Database, size, entry.Status, strings.Join(entry.Flags, " "))
+	}
+	return tabWriter.Flush()
+}
+
+/*
+ * Returns an entry for each restore into the given database, newest first.
+ */
+func GetRestoreList(restoreHistory *history.RestoreHistory, dbName string) []RestoreListEntry {
+	entries := make([]RestoreListEntry, 0)
+	for _, restoreConfig := range restoreHistory.RestoreConfigs {
+		if restoreConfig.TargetDatabase != dbName {
+			continue
+		}
+		entry := RestoreListEntry{
+			Timestamp:       restoreConfig.Timestamp,
+			BackupTimestamp: restoreConfig.BackupTimestamp,
+			SourceDatabase:  restoreConfig.SourceDatabase,
+			TargetDatabase:  restoreConfig.TargetDatabase,
+			TargetCluster:   restoreConfig.TargetCluster,
+			Status:          restoreConfig.Status,
+			Filters:         getRestoreConfigFilters(restoreConfig),
+		}
+		if restoreConfig.EndTime != "" {
+			endTime, _ := time.ParseInLocation("20060102150405", restoreConfig.EndTime, operating.System.Local)
+			_, _, entry.Duration = report.GetDurationInfo(restoreConfig.Timestamp, endTime)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func getRestoreConfigFilters(restoreConfig history.RestoreConfig) []string {
+	filters := make([]string, 0)
+	addFilter := func(isSet bool, flag string) {
+		if isSet {
+			filters = append(filters, fmt.Sprintf("--%s", flag))
+		}
+	}
+	addListFilter := func(values []string, flag string) {
+		for _, value := range values {
+			filters = append(filters, fmt.Sprintf("--%s %s", flag, value))
+		}
+	}
+	addFilter(restoreConfig.DataOnly, options.DATA_ONLY)
+	addListFilter(restoreConfig.ExcludeRelations, options.EXCLUDE_RELATION)
+	addListFilter(restoreConfig.ExcludeSchemas, options.EXCLUDE_SCHEMA)
+	addListFilter(restoreConfig.IncludeRelations, options.INCLUDE_RELATION)
+	addListFilter(restoreConfig.IncludeSchemas, options.INCLUDE_SCHEMA)
+	addFilter(restoreConfig.Incremental, options.INCREMENTAL)
+	addFilter(restoreConfig.MetadataOnly, options.METADATA_ONLY)
+	if restoreConfig.RedirectSchema != "" {
+		filters = append(filters, fmt.Sprintf("--%s %s", options.REDIRECT_SCHEMA, restoreConfig.RedirectSchema))
+	}
+	return filters
+}
+
+func PrintRestoreListTable(writer io.Writer, entries []RestoreListEntry) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tabWriter, "TIMESTAMP\tBACKUP TIMESTAMP\tSOURCE DATABASE\tTARGET DATABASE\tTARGET CLUSTER\tDURATION\tSTATUS\tFILTERS")
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Timestamp, entry.BackupTimestamp,
+			entry.SourceDatabase, entry.TargetDatabase, entry.TargetCluster, entry.Duration, entry.Status, strings.Join(entry.Filters, " "))
+	}
+	return tabWriter.Flush()
+}
+
+func PrintListJSON(writer io.Writer, entries interface{}) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
@@ -0,0 +1,179 @@
+package backup
+
+/*
+ * This file contains functions for --list, which prints the objects in a
+ * backup from its TOC, so that a backup can be checked for an object without
+ * restoring it.
+ */
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const LIST_TABLE_DATA = "TABLE DATA"
+
+/*
+ * Size is the size of the statement of a metadata object, and the size of
+ * the table for table data, or -1 if the size of the table was not recorded.
+ * Dependencies are the objects that must be restored before this one.
+ */
+type BackupContentsEntry struct {
+	Section      string   `json:"section"`
+	Type         string   `json:"type"`
+	Schema       string   `json:"schema"`
+	Name         string   `json:"name"`
+	Size         int64    `json:"size"`
+	Dependencies []string `json:"dependencies"`
+}
+
+/*
+ * The schema and table filters work as they do for a restore, so that the
+ * objects listed are those that a restore with the same filters would
+ * restore.  An empty ObjectTypes matches every type.
+ */
+type BackupContentsFilter struct {
+	ObjectTypes      []string
+	IncludeSchemas   []string
+	ExcludeSchemas   []string
+	IncludeRelations []string
+	ExcludeRelations []string
+}
+
+func DoListBackupContents() {
+	SetLoggerVerbosity()
+	timestamp := MustGetFlagString(options.LIST)
+	fpInfo := getMasterFPInfo(MustGetFlagString(options.DBNAME))
+	backupHistory := readBackupHistory(fpInfo.GetBackupHistoryFilePath())
+	backupFPInfo := getBackupFPInfo(backupHistory, timestamp)
+	tocFilename := backupFPInfo.GetTOCFilePath()
+	if !iohelper.FileExistsAndIsReadable(tocFilename) {
+		gplog.Fatal(errors.Errorf("TOC of backup %s not found in %s", timestamp, backupFPInfo.GetDirForContent(-1)), "")
+	}
+	tocfile := toc.NewTOC(tocFilename)
+	tocfile.InitializeMetadataEntryMap()
+
+	/*
+	 * The data of an incremental backup includes the tables backed up by the
+	 * earlier backups in its restore plan.
+	 */
+	dataEntries := tocfile.DataEntries
+	if configFilename := backupFPInfo.GetConfigFilePath(); iohelper.FileExistsAndIsReadable(configFilename) {
+		dataEntries = make([]toc.MasterDataEntry, 0)
+		for _, planEntry := range history.ReadConfigFile(configFilename).RestorePlan {
+			planTOC := tocfile
+			if planEntry.Timestamp != timestamp {
+				planFPInfo := getBackupFPInfo(backupHistory, planEntry.Timestamp)
+				planTOC = toc.NewTOC(planFPInfo.GetTOCFilePath())
+			}
+			dataEntries = append(dataEntries, planTOC.GetDataEntriesMatching([]string{}, []string{}, []string{}, []string{}, planEntry.TableFQNs)...)
+		}
+	}
+
+	objectTypes := make([]string, 0)
+	for _, objectType := range MustGetFlagStringSlice(options.LIST_OBJECT_TYPE) {
+		objectTypes = append(objectTypes, strings.ToUpper(strings.TrimSpace(objectType)))
+	}
+	filter := BackupContentsFilter{
+		ObjectTypes:      objectTypes,
+		IncludeSchemas:   MustGetFlagStringArray(options.INCLUDE_SCHEMA),
+		ExcludeSchemas:   MustGetFlagStringArray(options.EXCLUDE_SCHEMA),
+		IncludeRelations: MustGetFlagStringArray(options.INCLUDE_RELATION),
+		ExcludeRelations: MustGetFlagStringArray(options.EXCLUDE_RELATION),
+	}
+	entries := GetBackupContents(tocfile, dataEntries, filter)
+	var err error
+	if MustGetFlagString(options.LIST_FORMAT) == "json" {
+		err = PrintListJSON(operating.System.Stdout, entries)
+	} else {
+		err = PrintBackupContentsTable(operating.System.Stdout, entries)
+	}
+	gplog.FatalOnError(err)
+}
+
+/*
+ * Returns the objects in the backup that match the filter, in the order in
+ * which they are restored.
+ */
+func GetBackupContents(tocfile *toc.TOC, dataEntries []toc.MasterDataEntry, filter BackupContentsFilter) []BackupContentsEntry {
+	entries := make([]BackupContentsEntry, 0)
+	for _, section := range []string{"cluster", "global", "predata", "data", "postdata", "statistics"} {
+		if section == "data" {
+			entries = append(entries, getDataContents(dataEntries, filter)...)
+			continue
+		}
+		for _, entry := range tocfile.GetMetadataEntriesMatching(section, filter.ObjectTypes, []string{},
+			filter.IncludeSchemas, filter.ExcludeSchemas, filter.IncludeRelations, filter.ExcludeRelations) {
+			dependencies := make([]string, 0)
+			if entry.ReferenceObject != "" {
+				dependencies = append(dependencies, entry.ReferenceObject)
+			}
+			entries = append(entries, BackupContentsEntry{
+				Section:      section,
+				Type:         entry.ObjectType,
+				Schema:       entry.Schema,
+				Name:         entry.Name,
+				Size:         int64(entry.EndByte - entry.StartByte),
+				Dependencies: dependencies,
+			})
+		}
+	}
+	return entries
+}
+
+func getDataContents(dataEntries []toc.MasterDataEntry, filter BackupContentsFilter) []BackupContentsEntry {
+	entries := make([]BackupContentsEntry, 0)
+	if len(filter.ObjectTypes) > 0 && !utils.Exists(filter.ObjectTypes, LIST_TABLE_DATA) {
+		return entries
+	}
+	tableFQNs := make([]string, 0, len(dataEntries))
+	for _, entry := range dataEntries {
+		tableFQNs = append(tableFQNs, utils.MakeFQN(entry.Schema, entry.Name))
+	}
+	dataTOC := &toc.TOC{DataEntries: dataEntries}
+	for _, entry := range dataTOC.GetDataEntriesMatching(filter.IncludeSchemas, filter.ExcludeSchemas,
+		filter.IncludeRelations, filter.ExcludeRelations, tableFQNs) {
+		dependencies := []string{utils.MakeFQN(entry.Schema, entry.Name)}
+		if entry.PartitionRoot != "" {
+			dependencies = append(dependencies, utils.MakeFQN(entry.Schema, entry.PartitionRoot))
+		}
+		size := entry.Size
+		if size == 0 && entry.RowsCopied > 0 {
+			size = -1
+		}
+		entries = append(entries, BackupContentsEntry{
+			Section:      "data",
+			Type:         LIST_TABLE_DATA,
+			Schema:       entry.Schema,
+			Name:         entry.Name,
+			Size:         size,
+			Dependencies: dependencies,
+		})
+	}
+	return entries
+}
+
+func PrintBackupContentsTable(writer io.Writer, entries []BackupContentsEntry) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tabWriter, "SECTION\tTYPE\tSCHEMA\tNAME\tSIZE\tDEPENDENCIES")
+	for _, entry := range entries {
+		size := "unknown"
+		if entry.Size >= 0 {
+			size = utils.FormatSize(entry.Size)
+		}
+		_, _ = fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Section, entry.Type,
+			entry.Schema, entry.Name, size, strings.Join(entry.Dependencies, ", "))
+	}
+	return tabWriter.Flush()
+}
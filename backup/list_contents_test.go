@@ -0,0 +1,72 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("backup/list_contents tests", func() {
+	var contentsTOC *toc.TOC
+	var dataEntries []toc.MasterDataEntry
+	BeforeEach(func() {
+		contentsTOC = &toc.TOC{}
+		contentsTOC.InitializeMetadataEntryMap()
+		contentsTOC.AddMetadataEntry("global", toc.MetadataEntry{Name: "testrole", ObjectType: "ROLE"}, 0, 20)
+		contentsTOC.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "public", Name: "foo", ObjectType: "TABLE"}, 20, 70)
+		contentsTOC.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "other", Name: "bar", ObjectType: "TABLE"}, 70, 120)
+		contentsTOC.AddMetadataEntry("postdata", toc.MetadataEntry{Schema: "public", Name: "foo_idx", ObjectType: "INDEX", ReferenceObject: "public.foo"}, 120, 150)
+		dataEntries = []toc.MasterDataEntry{
+			{Schema: "public", Name: "foo", Oid: 1, RowsCopied: 10, Size: 2048},
+			{Schema: "other", Name: "bar", Oid: 2, RowsCopied: 5},
+		}
+	})
+	Describe("GetBackupContents", func() {
+		It("lists every object in the order in which it is restored", func() {
+			entries := backup.GetBackupContents(contentsTOC, dataEntries, backup.BackupContentsFilter{})
+
+			Expect(entries).To(Equal([]backup.BackupContentsEntry{
+				{Section: "global", Type: "ROLE", Name: "testrole", Size: 20, Dependencies: []string{}},
+				{Section: "predata", Type: "TABLE", Schema: "public", Name: "foo", Size: 50, Dependencies: []string{}},
+				{Section: "predata", Type: "TABLE", Schema: "other", Name: "bar", Size: 50, Dependencies: []string{}},
+				{Section: "data", Type: "TABLE DATA", Schema: "public", Name: "foo", Size: 2048, Dependencies: []string{"public.foo"}},
+				{Section: "data", Type: "TABLE DATA", Schema: "other", Name: "bar", Size: -1, Dependencies: []string{"other.bar"}},
+				{Section: "postdata", Type: "INDEX", Schema: "public", Name: "foo_idx", Size: 30, Dependencies: []string{"public.foo"}},
+			}))
+		})
+		It("lists only the objects of a table and those depending on it", func() {
+			entries := backup.GetBackupContents(contentsTOC, dataEntries, backup.BackupContentsFilter{IncludeRelations: []string{"public.foo"}})
+
+			Expect(entries).To(HaveLen(3))
+			Expect(entries[0].Type).To(Equal("TABLE"))
+			Expect(entries[1].Type).To(Equal("TABLE DATA"))
+			Expect(entries[2].Type).To(Equal("INDEX"))
+		})
+		It("lists only the objects of the given types", func() {
+			entries := backup.GetBackupContents(contentsTOC, dataEntries, backup.BackupContentsFilter{ObjectTypes: []string{"TABLE DATA"}, ExcludeSchemas: []string{"other"}})
+
+			Expect(entries).To(Equal([]backup.BackupContentsEntry{
+				{Section: "data", Type: "TABLE DATA", Schema: "public", Name: "foo", Size: 2048, Dependencies: []string{"public.foo"}},
+			}))
+		})
+	})
+	Describe("PrintBackupContentsTable", func() {
+		It("prints the objects with their sizes and dependencies", func() {
+			buffer := NewBuffer()
+			entries := []backup.BackupContentsEntry{
+				{Section: "data", Type: "TABLE DATA", Schema: "other", Name: "bar", Size: -1, Dependencies: []string{"other.bar"}},
+				{Section: "postdata", Type: "INDEX", Schema: "public", Name: "foo_idx", Size: 30, Dependencies: []string{"public.foo"}},
+			}
+
+			Expect(backup.PrintBackupContentsTable(buffer, entries)).To(Succeed())
+
+			Expect(string(buffer.Contents())).To(Equal(`SECTION   TYPE        SCHEMA  NAME     SIZE     DEPENDENCIES
+data      TABLE DATA  other   bar      unknown  other.bar
+postdata  INDEX       public  foo_idx  30 B     public.foo
+`))
+		})
+	})
+})
@@ -0,0 +1,202 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/history"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("backup/list tests", func() {
+	fullEntry := backup.BackupListEntry{
+		Timestamp: "20170102010101",
+		Type:      "full",
+		Database:  "testdb",
+		Size:      1536,
+		Status:    history.BackupStatusSucceed,
+		Flags:     []string{"--include-schema public", "--with-stats"},
+	}
+	incrementalEntry := backup.BackupListEntry{
+		Timestamp: "20170101010101",
+		Type:      "incremental",
+		Database:  "testdb",
+		Size:      -1,
+		Status:    "Deleted",
+		Flags:     []string{"--incremental", "--leaf-partition-data", "--plugin-config"},
+	}
+	Describe("GetBackupList", func() {
+		It("returns the backups of the given database with their types, sizes, and flags", func() {
+			backupHistory := &history.History{BackupConfigs: []history.BackupConfig{
+				{
+					DatabaseName:   "testdb",
+					Timestamp:      "20170102010101",
+					Status:         history.BackupStatusSucceed,
+					Compressed:     true,
+					IncludeSchemas: []string{"public"},
+					WithStatistics: true,
+					BackupSize:     1536,
+				},
+				{
+					DatabaseName: "otherdb",
+					Timestamp:    "20170101020202",
+					Status:       history.BackupStatusSucceed,
+				},
+				{
+					DatabaseName:      "testdb",
+					Timestamp:         "20170101010101",
+					Status:            history.BackupStatusSucceed,
+					Compressed:        true,
+					Incremental:       true,
+					LeafPartitionData: true,
+					Plugin:            "/usr/local/bin/gpbackup_s3_plugin",
+					DateDeleted:       "20170103010101",
+				},
+			}}
+			entries := backup.GetBackupList(backupHistory, "testdb")
+			Expect(entries).To(Equal([]backup.BackupListEntry{fullEntry, incrementalEntry}))
+		})
+		It("lists the flags that differ from the defaults", func() {
+			backupHistory := &history.History{BackupConfigs: []history.BackupConfig{
+				{
+					DatabaseName:    "testdb",
+					Timestamp:       "20170101010101",
+					BackupDir:       "/backups",
+					Compressed:      true,
+					CompressionType: "zstd",
+					DataOnly:        true,
+					SingleDataFile:  true,
+				},
+				{
+					DatabaseName:     "testdb",
+					Timestamp:        "20170101010102",
+					ExcludeRelations: []string{"public.foo"},
+					MetadataOnly:     true,
+					WithoutGlobals:   true,
+				},
+			}}
+			entries := backup.GetBackupList(backupHistory, "testdb")
+			Expect(entries[0].Flags).To(Equal([]string{"--backup-dir /backups", "--compression-type zstd", "--data-only", "--single-data-file"}))
+			Expect(entries[1].Flags).To(Equal([]string{"--exclude-table public.foo", "--metadata-only", "--no-compression", "--without-globals"}))
+		})
+	})
+	Describe("PrintBackupListTable", func() {
+		It("prints a table with a header row", func() {
+			buffer := NewBuffer()
+			err := backup.PrintBackupListTable(buffer, []backup.BackupListEntry{fullEntry, incrementalEntry})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buffer.Contents())).To(Equal(
+				`TIMESTAMP       TYPE         DATABASE  SIZE     STATUS   FLAGS
+20170102010101  full         testdb    1.5 kB   Success  --include-schema public --with-stats
+20170101010101  incremental  testdb    unknown  Deleted  --incremental --leaf-partition-data --plugin-config
+`))
+		})
+	})
+	Describe("PrintListJSON", func() {
+		It("prints the entries as a JSON array", func() {
+			buffer := NewBuffer()
+			err := backup.PrintListJSON(buffer, []backup.BackupListEntry{fullEntry})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buffer.Contents())).To(Equal(`[
+  {
+    "timestamp": "20170102010101",
+    "type": "full",
+    "database": "testdb",
+    "size": 1536,
+    "status": "Success",
+    "flags": [
+      "--include-schema public",
+      "--with-stats"
+    ]
+  }
+]
+`))
+		})
+		It("prints an empty array when there are no backups", func() {
+			buffer := NewBuffer()
+			err := backup.PrintListJSON(buffer, []backup.BackupListEntry{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buffer.Contents())).To(Equal("[]\n"))
+		})
+	})
+	Describe("GetRestoreList", func() {
+		It("returns the restores into the given database with their durations and filters", func() {
+			restoreHistory := &history.RestoreHistory{RestoreConfigs: []history.RestoreConfig{
+				{
+					Timestamp:       "20170103010101",
+					EndTime:         "20170103011631",
+					BackupTimestamp: "20170102010101",
+					SourceDatabase:  "proddb",
+					TargetDatabase:  "devdb",
+					TargetCluster:   "mdw:5432",
+					IncludeSchemas:  []string{"public"},
+					RedirectSchema:  "staging",
+					DataOnly:        true,
+					Status:          history.BackupStatusSucceed,
+				},
+				{
+					Timestamp:       "20170102020202",
+					EndTime:         "20170102020302",
+					BackupTimestamp: "20170101010101",
+					SourceDatabase:  "proddb",
+					TargetDatabase:  "proddb",
+					TargetCluster:   "mdw:5432",
+					Status:          history.BackupStatusSucceed,
+				},
+				{
+					Timestamp:       "20170101020202",
+					BackupTimestamp: "20170101010101",
+					SourceDatabase:  "proddb",
+					TargetDatabase:  "devdb",
+					TargetCluster:   "mdw:5432",
+					Status:          history.BackupStatusFailed,
+				},
+			}}
+			entries := backup.GetRestoreList(restoreHistory, "devdb")
+			Expect(entries).To(Equal([]backup.RestoreListEntry{
+				{
+					Timestamp:       "20170103010101",
+					BackupTimestamp: "20170102010101",
+					SourceDatabase:  "proddb",
+					TargetDatabase:  "devdb",
+					TargetCluster:   "mdw:5432",
+					Duration:        "0:15:30",
+					Status:          history.BackupStatusSucceed,
+					Filters:         []string{"--data-only", "--include-schema public", "--redirect-schema staging"},
+				},
+				{
+					Timestamp:       "20170101020202",
+					BackupTimestamp: "20170101010101",
+					SourceDatabase:  "proddb",
+					TargetDatabase:  "devdb",
+					TargetCluster:   "mdw:5432",
+					Status:          history.BackupStatusFailed,
+					Filters:         []string{},
+				},
+			}))
+		})
+	})
+	Describe("PrintRestoreListTable", func() {
+		It("prints a table with a header row", func() {
+			buffer := NewBuffer()
+			err := backup.PrintRestoreListTable(buffer, []backup.RestoreListEntry{
+				{
+					Timestamp:       "20170103010101",
+					BackupTimestamp: "20170102010101",
+					SourceDatabase:  "proddb",
+					TargetDatabase:  "devdb",
+					TargetCluster:   "mdw:5432",
+					Duration:        "0:15:30",
+					Status:          history.BackupStatusSucceed,
+					Filters:         []string{"--include-schema public"},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buffer.Contents())).To(Equal(
+				`TIMESTAMP       BACKUP TIMESTAMP  SOURCE DATABASE  TARGET DATABASE  TARGET CLUSTER  DURATION  STATUS   FILTERS
+20170103010101  20170102010101    proddb           devdb            mdw:5432        0:15:30   Success  --include-schema public
+`))
+		})
+	})
+})
@@ -0,0 +1,126 @@
+package backup
+
+/*
+ * This file contains functions for monitoring the sessions that block
+ * gpbackup while it waits for the locks on the tables to be backed up.
+ */
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+)
+
+var lockWaitMonitorInterval = 10 * time.Second
+
+type BlockingSession struct {
+	SessionID int
+	Pid       int
+	Username  string
+	Relation  string
+	Query     string
+}
+
+func (session BlockingSession) String() string {
+	return fmt.Sprintf("Session %d (pid %d, user %s) is blocking the lock on %s with query: %s", session.SessionID, session.Pid, session.Username, session.Relation, session.Query)
+}
+
+/*
+ * Returns the sessions holding locks that the sessions of the given
+ * application are waiting for, on the master or any segment.
+ */
+func GetLockBlockingSessions(connectionPool *dbconn.DBConn, applicationName string) ([]BlockingSession, error) {
+	pidColumn, queryColumn := "procpid", "current_query"
+	if connectionPool.Version.AtLeast("6") {
+		pidColumn, queryColumn = "pid", "query"
+	}
+	query := fmt.Sprintf(`
+	SELECT DISTINCT blocker.sess_id AS sessionid,
+		blocker.%[1]s AS pid,
+		coalesce(blocker.usename, '') AS username,
+		coalesce(quote_ident(n.nspname) || '.' || quote_ident(c.relname), w.locktype) AS relation,
+		coalesce(blocker.%[2]s, '') AS query
+	FROM pg_locks w
+		JOIN pg_stat_activity waiter ON waiter.sess_id = w.mppsessionid
+		JOIN pg_locks b ON b.locktype = w.locktype
+			AND b.database IS NOT DISTINCT FROM w.database
+			AND b.relation IS NOT DISTINCT FROM w.relation
+			AND b.gp_segment_id = w.gp_segment_id
+			AND b.mppsessionid <> w.mppsessionid
+		JOIN pg_stat_activity blocker ON blocker.sess_id = b.mppsessionid
+		LEFT JOIN pg_class c ON c.oid = w.relation
+		LEFT JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE waiter.application_name = '%[3]s'
+		AND NOT w.granted
+		AND b.granted
+	ORDER BY sessionid, relation`, pidColumn, queryColumn, applicationName)
+
+	results := make([]BlockingSession, 0)
+	err := connectionPool.Select(&results, query)
+	return results, err
+}
+
+/*
+ * Logs each blocking session once, as the same sessions may block the backup
+ * for many intervals.
+ */
+func logBlockingSessions(sessions []BlockingSession, loggedSessions map[BlockingSession]bool) {
+	for _, session := range sessions {
+		if !loggedSessions[session] {
+			gplog.Warn(session.String())
+			loggedSessions[session] = true
+		}
+	}
+}
+
+/*
+ * Starts logging the sessions that block the backup while locks are being
+ * acquired, and returns a function that stops it.  The monitor only connects
+ * to the database once the backup has been waiting for a full interval, so
+ * backups that are not blocked do not use another connection.  Errors are
+ * only logged, as the monitor must never stop the backup.
+ */
+func startLockWaitMonitor(timestamp string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var conn *dbconn.DBConn
+		defer func() {
+			if conn != nil {
+				conn.Close()
+			}
+		}()
+		loggedSessions := make(map[BlockingSession]bool)
+		ticker := time.NewTicker(lockWaitMonitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if conn == nil {
+					conn = dbconn.NewDBConnFromEnvironment(MustGetFlagString(options.DBNAME))
+					if err := conn.Connect(1); err != nil {
+						gplog.Verbose("Unable to connect to monitor lock waits: %v", err)
+						conn = nil
+						return
+					}
+				}
+				sessions, err := GetLockBlockingSessions(conn, fmt.Sprintf("gpbackup_%s", timestamp))
+				if err != nil {
+					gplog.Verbose("Unable to query the sessions blocking the backup: %v", err)
+					continue
+				}
+				logBlockingSessions(sessions, loggedSessions)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,195 @@
+package backup
+
+/*
+ * This file contains functions for backing up several databases in one
+ * invocation, with --all-databases or a comma-separated --dbname.  Each
+ * database is backed up by a separate gpbackup process with its own
+ * timestamp, and every backup records the timestamp of the invocation as its
+ * database group so that the databases can be restored together.  With
+ * --consistent-snapshot, every database is backed up as of the same point in
+ * time.
+ */
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+const consistentSnapshotAttempts = 10
+
+func IsMultiDatabaseRun() bool {
+	return MustGetFlagBool(options.ALL_DATABASES) || len(utils.SplitDatabaseNames(MustGetFlagString(options.DBNAME))) > 1
+}
+
+/*
+ * Options that name objects in, or backups of, a single database cannot be
+ * used when backing up several databases.
+ */
+func validateMultiDatabaseFlags(flags *pflag.FlagSet) {
+	options.CheckExclusiveFlags(flags, options.ALL_DATABASES, options.DBNAME)
+	if !IsMultiDatabaseRun() {
+		if flags.Changed(options.CONSISTENT_SNAPSHOT) {
+			gplog.Fatal(errors.Errorf("Cannot use --consistent-snapshot without --all-databases or multiple databases in --dbname"), "")
+		}
+		return
+	}
+	for _, flagName := range []string{options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE, options.FROM_TIMESTAMP,
+		options.RESUME, options.DELETE_BEFORE, options.RETENTION_COUNT, options.LIST, options.LIST_BACKUPS, options.LIST_RESTORES,
+		options.DATABASE_GROUP, options.DRY_RUN, options.ESTIMATE, options.DIFF, options.IMPORT_SNAPSHOT, options.MIGRATE_HISTORY, options.CLEANUP, options.MACHINE_OUTPUT} {
+		if flags.Changed(flagName) {
+			gplog.Fatal(errors.Errorf("Cannot use --%s when backing up multiple databases", flagName), "")
+		}
+	}
+}
+
+func DoMultiDatabaseBackup() {
+	SetLoggerVerbosity()
+	gplog.Info("gpbackup version = %s", GetVersion())
+
+	groupTimestamp := history.CurrentTimestamp()
+	dbNames := getDatabasesToBackUp()
+	gplog.Info("Backing up %d databases with database group timestamp = %s", len(dbNames), groupTimestamp)
+	args := options.HandleSingleDashes(os.Args[1:])
+
+	snapshotIDs := make(map[string]string)
+	if MustGetFlagBool(options.CONSISTENT_SNAPSHOT) {
+		var snapshotConns []*dbconn.DBConn
+		snapshotConns, snapshotIDs = holdConsistentSnapshot(dbNames)
+		defer func() {
+			for _, conn := range snapshotConns {
+				conn.Close()
+			}
+		}()
+	}
+
+	exitCodes := make(map[string]int, len(dbNames))
+	for i, dbName := range dbNames {
+		if wasTerminated {
+			break
+		}
+		gplog.Info("Backing up database %s (%d of %d)", dbName, i+1, len(dbNames))
+		exitCodes[dbName] = utils.RunSelfWithArgs(getDatabaseBackupArgs(args, dbName, groupTimestamp, snapshotIDs[dbName]))
+	}
+
+	fpInfo := getMasterFPInfo(dbNames[0])
+	historyFilename := fpInfo.GetBackupHistoryFilePath()
+	backupHistory := &history.History{BackupConfigs: make([]history.BackupConfig, 0)}
+	if iohelper.FileExistsAndIsReadable(historyFilename) {
+		var err error
+		backupHistory, err = history.NewHistory(historyFilename)
+		gplog.FatalOnError(err)
+	}
+	results := GetDatabaseGroupResults(backupHistory, groupTimestamp, dbNames, exitCodes)
+	reportFilename := path.Join(path.Dir(gplog.GetLogFilePath()), fmt.Sprintf("gpbackup_%s_group_report", groupTimestamp))
+	report.WriteDatabaseGroupReportFile(reportFilename, "gpbackup", groupTimestamp, groupTimestamp, operating.System.Now(), results)
+
+	numFailed := 0
+	for _, result := range results {
+		if result.ExitCode > gplog.GetErrorCode() {
+			gplog.SetErrorCode(result.ExitCode)
+		}
+		if report.GetRunStatus(result.ExitCode, false) == "failure" {
+			numFailed++
+		}
+	}
+	if numFailed > 0 {
+		gplog.Error("Backup of %d of %d databases failed; see %s for details", numFailed, len(dbNames), reportFilename)
+	} else {
+		gplog.Info("Backed up %d databases; see %s for details", len(dbNames), reportFilename)
+	}
+}
+
+/*
+ * Returns the arguments of the gpbackup process that backs up one database.
+ * The options that select several databases are removed, as the process
+ * backs up a single database and would otherwise reject them, and the
+ * snapshot exported for the database, if any, is passed in their place.
+ */
+func getDatabaseBackupArgs(args []string, dbName string, groupTimestamp string, snapshotID string) []string {
+	dbArgs := utils.RemoveFlagsFromArgs(args, []string{options.ALL_DATABASES, options.CONSISTENT_SNAPSHOT}, []string{options.DBNAME})
+	dbArgs = append(dbArgs, "--dbname", dbName, "--database-group", groupTimestamp)
+	if snapshotID != "" {
+		dbArgs = append(dbArgs, "--import-snapshot", snapshotID)
+	}
+	return dbArgs
+}
+
+/*
+ * The transactions of the snapshots are held open until every database has
+ * been backed up, so vacuum cannot remove rows deleted after the snapshot in
+ * any of the databases for the whole multi-database backup.
+ */
+func holdConsistentSnapshot(dbNames []string) ([]*dbconn.DBConn, map[string]string) {
+	conns := make([]*dbconn.DBConn, 0, len(dbNames))
+	for _, dbName := range dbNames {
+		conn := dbconn.NewDBConnFromEnvironment(dbName)
+		conn.MustConnect(1)
+		conns = append(conns, conn)
+	}
+	if conns[0].Version.Before("7") {
+		gplog.Fatal(errors.Errorf("Cannot use --consistent-snapshot with GPDB version %s, as snapshots can only be shared with the segments from GPDB 7 on", conns[0].Version.VersionString), "")
+	}
+	exportedIDs, sharedSnapshot, err := TakeConsistentSnapshot(conns, consistentSnapshotAttempts)
+	gplog.FatalOnError(err)
+	snapshotIDs := make(map[string]string, len(dbNames))
+	for i, dbName := range dbNames {
+		snapshotIDs[dbName] = exportedIDs[i]
+	}
+	gplog.Info("Backing up all databases as of shared snapshot %s", sharedSnapshot)
+	return conns, snapshotIDs
+}
+
+func getDatabasesToBackUp() []string {
+	if !MustGetFlagBool(options.ALL_DATABASES) {
+		return utils.SplitDatabaseNames(MustGetFlagString(options.DBNAME))
+	}
+	conn := dbconn.NewDBConnFromEnvironment("template1")
+	conn.MustConnect(1)
+	defer conn.Close()
+	dbNames := dbconn.MustSelectStringSlice(conn, `
+	SELECT datname AS string
+	FROM pg_database
+	WHERE datallowconn
+		AND datname NOT IN ('template0', 'template1')
+	ORDER BY datname`)
+	if len(dbNames) == 0 {
+		gplog.Fatal(errors.Errorf("There are no databases to back up"), "")
+	}
+	return dbNames
+}
+
+/*
+ * Returns the result of the backup of each database, in the order in which
+ * they were backed up.  Databases whose backup failed before it was recorded
+ * in the backup history have no timestamp.
+ */
+func GetDatabaseGroupResults(backupHistory *history.History, groupTimestamp string, dbNames []string, exitCodes map[string]int) []report.DatabaseRunResult {
+	timestamps := make(map[string]string)
+	for _, backupConfig := range backupHistory.BackupConfigs {
+		if backupConfig.DatabaseGroup == groupTimestamp {
+			timestamps[utils.UnquoteIdent(backupConfig.DatabaseName)] = backupConfig.Timestamp
+		}
+	}
+	results := make([]report.DatabaseRunResult, 0, len(dbNames))
+	for _, dbName := range dbNames {
+		exitCode, ok := exitCodes[dbName]
+		if !ok {
+			// The backup was canceled before this database was backed up
+			exitCode = 2
+		}
+		results = append(results, report.DatabaseRunResult{Database: dbName, Timestamp: timestamps[dbName], ExitCode: exitCode})
+	}
+	return results
+}
@@ -0,0 +1,33 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/report"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/multi_database tests", func() {
+	Describe("GetDatabaseGroupResults", func() {
+		backupHistory := &history.History{BackupConfigs: []history.BackupConfig{
+			{DatabaseName: `"Sales"`, Timestamp: "20170101010103", DatabaseGroup: "20170101010101", Status: history.BackupStatusSucceed},
+			{DatabaseName: "hr", Timestamp: "20170101010102", DatabaseGroup: "20170101010101", Status: history.BackupStatusFailed},
+			{DatabaseName: "hr", Timestamp: "20161231010101", Status: history.BackupStatusSucceed},
+		}}
+		It("returns the timestamp and exit code of the backup of each database in the group", func() {
+			results := backup.GetDatabaseGroupResults(backupHistory, "20170101010101", []string{"hr", "Sales"}, map[string]int{"hr": 2, "Sales": 0})
+
+			Expect(results).To(Equal([]report.DatabaseRunResult{
+				{Database: "hr", Timestamp: "20170101010102", ExitCode: 2},
+				{Database: "Sales", Timestamp: "20170101010103", ExitCode: 0},
+			}))
+		})
+		It("returns a failure without a timestamp for databases that were not backed up", func() {
+			results := backup.GetDatabaseGroupResults(backupHistory, "20170101010101", []string{"hr", "Sales", "finance"}, map[string]int{"hr": 2, "Sales": 0, "finance": 2})
+
+			Expect(results[2]).To(Equal(report.DatabaseRunResult{Database: "finance", ExitCode: 2}))
+		})
+	})
+})
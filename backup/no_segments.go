@@ -0,0 +1,49 @@
+package backup
+
+/*
+ * This file contains functions for --no-segments, in which a metadata-only
+ * backup is taken without contacting the segment hosts at all.  A metadata-only
+ * backup only writes files on the master, so nothing is lost, and the backup
+ * does not wait on ssh to every host of the cluster, which keeps quick schema
+ * snapshots, such as those taken in CI pipelines, fast.
+ */
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+/*
+ * Options that run commands on the segment hosts over ssh, or that store the
+ * backup anywhere but the backup directory of the master, cannot be used with
+ * --no-segments.
+ */
+func validateNoSegmentsFlags(flags *pflag.FlagSet) {
+	if !MustGetFlagBool(options.NO_SEGMENTS) {
+		return
+	}
+	if !MustGetFlagBool(options.METADATA_ONLY) {
+		gplog.Fatal(errors.Errorf("--metadata-only must be specified with --no-segments"), "")
+	}
+	for _, flagName := range []string{options.PLUGIN_CONFIG, options.STORAGE, options.MIRROR_FAILOVER, options.THROTTLE_CPU,
+		options.THROTTLE_IOWAIT, options.DELETE_BEFORE, options.RETENTION_COUNT, options.TEST_RESTORE} {
+		options.CheckExclusiveFlags(flags, options.NO_SEGMENTS, flagName)
+	}
+}
+
+/*
+ * Runs local commands as usual but refuses to run commands on the segment
+ * hosts, so that no code path of a --no-segments backup, including its
+ * cleanup and reports, can reach them over ssh.
+ */
+type masterOnlyExecutor struct {
+	cluster.Executor
+}
+
+func (executor *masterOnlyExecutor) ExecuteClusterCommand(scope cluster.Scope, commandList []cluster.ShellCommand) *cluster.RemoteOutput {
+	gplog.Fatal(errors.Errorf("Cannot run commands on the segment hosts with --no-segments"), "")
+	return nil
+}
@@ -0,0 +1,203 @@
+package backup
+
+/*
+ * This file contains structs and functions for backing up objects that
+ * gpbackup does not otherwise know about, such as objects created by
+ * extensions that are not members of the extension and so are not recreated
+ * by CREATE EXTENSION.
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * Schema, Name, and ReferenceObject are used for filtering on restore in the
+ * same way as for built-in objects, so they must be quoted.  An object with a
+ * ReferenceObject is backed up and restored only along with that table.
+ */
+type CustomObject struct {
+	Schema          string
+	Name            string
+	ReferenceObject string
+	Statement       string
+}
+
+/*
+ * An ObjectHandler retrieves a set of custom objects and the statements that
+ * recreate them.  Each object is written to the given section of the metadata
+ * file with a TOC entry of the given ObjectType, after all built-in objects of
+ * that section, and is restored along with the rest of that section.
+ */
+type ObjectHandler struct {
+	Name       string
+	Section    string
+	ObjectType string
+	GetObjects func(connectionPool *dbconn.DBConn) ([]CustomObject, error)
+}
+
+/*
+ * Handlers may be registered by code embedding gpbackup before DoSetup is
+ * called, or declared in the file passed to --object-handler-file.
+ */
+func RegisterObjectHandler(handler ObjectHandler) error {
+	if handler.Name == "" || handler.ObjectType == "" || handler.GetObjects == nil {
+		return errors.Errorf("Object handler %s must have a name, an object type, and a function to retrieve objects", handler.Name)
+	}
+	if handler.Section != "predata" && handler.Section != "postdata" {
+		return errors.Errorf("Invalid section '%s' for object handler %s.  Valid values are 'predata' and 'postdata'.", handler.Section, handler.Name)
+	}
+	for _, registeredHandler := range objectHandlers {
+		if registeredHandler.Name == handler.Name {
+			return errors.Errorf("An object handler named %s is already registered", handler.Name)
+		}
+	}
+	objectHandlers = append(objectHandlers, handler)
+	return nil
+}
+
+type ObjectHandlerSpec struct {
+	Name       string
+	Extension  string
+	Section    string
+	ObjectType string
+	Query      string
+}
+
+type ObjectHandlerFile struct {
+	Handlers []ObjectHandlerSpec
+}
+
+func ReadObjectHandlerFile(filename string) ([]ObjectHandlerSpec, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	handlerFile := &ObjectHandlerFile{}
+	err = yaml.Unmarshal(contents, handlerFile)
+	if err != nil {
+		return nil, errors.Errorf("Unable to parse object handler file %s: %v", filename, err)
+	}
+	for _, spec := range handlerFile.Handlers {
+		if spec.Query == "" {
+			return nil, errors.Errorf("Object handler %s in %s has no query", spec.Name, filename)
+		}
+	}
+	return handlerFile.Handlers, nil
+}
+
+/*
+ * The query of a declared handler must return one row per object, with
+ * columns named schema, name, statement, and optionally referenceobject.
+ */
+func NewObjectHandlerFromSpec(spec ObjectHandlerSpec) ObjectHandler {
+	return ObjectHandler{
+		Name:       spec.Name,
+		Section:    spec.Section,
+		ObjectType: spec.ObjectType,
+		GetObjects: func(connectionPool *dbconn.DBConn) ([]CustomObject, error) {
+			results := make([]CustomObject, 0)
+			err := connectionPool.Select(&results, spec.Query)
+			if err != nil {
+				return nil, errors.Errorf("Query for object handler %s failed: %v", spec.Name, err)
+			}
+			return results, nil
+		},
+	}
+}
+
+/*
+ * Handlers declared for an extension are only registered if that extension
+ * is installed in the database being backed up.
+ */
+func registerObjectHandlersFromFile(filename string) {
+	specs, err := ReadObjectHandlerFile(filename)
+	gplog.FatalOnError(err)
+	for _, spec := range specs {
+		if spec.Extension != "" && !isExtensionInstalled(connectionPool, spec.Extension) {
+			gplog.Verbose("Skipping object handler %s because extension %s is not installed", spec.Name, spec.Extension)
+			continue
+		}
+		err = RegisterObjectHandler(NewObjectHandlerFromSpec(spec))
+		gplog.FatalOnError(err)
+	}
+}
+
+func isExtensionInstalled(connectionPool *dbconn.DBConn, extensionName string) bool {
+	if connectionPool.Version.Before("5") {
+		return false
+	}
+	query := fmt.Sprintf("SELECT count(*) AS string FROM pg_extension WHERE extname = '%s'", utils.EscapeSingleQuotes(extensionName))
+	return dbconn.MustSelectString(connectionPool, query) != "0"
+}
+
+func backupCustomObjects(metadataFile *utils.FileWithByteCount, section string, tables []Table) {
+	if wasTerminated {
+		return
+	}
+	for _, handler := range objectHandlers {
+		if handler.Section != section {
+			continue
+		}
+		gplog.Verbose("Writing %s statements to metadata file", handler.ObjectType)
+		objects, err := handler.GetObjects(connectionPool)
+		gplog.FatalOnError(err)
+		objects = FilterCustomObjects(objects, tables)
+		objectCounts[handler.ObjectType] += len(objects)
+		PrintCustomObjectStatements(metadataFile, globalTOC, section, handler.ObjectType, objects)
+	}
+}
+
+/*
+ * Objects are filtered by schema in the same way as built-in objects.  An
+ * object that references a table is kept only if that table is backed up,
+ * and in a table-filtered backup only objects that reference a table are kept.
+ */
+func FilterCustomObjects(objects []CustomObject, tables []Table) []CustomObject {
+	schemaSet := utils.NewIncludeSet(MustGetFlagStringArray(options.INCLUDE_SCHEMA))
+	excludeSchemaSet := utils.NewExcludeSet(MustGetFlagStringArray(options.EXCLUDE_SCHEMA))
+	isTableFiltered := len(MustGetFlagStringArray(options.INCLUDE_RELATION)) > 0
+	tableFQNs := make([]string, 0, len(tables))
+	for _, table := range tables {
+		tableFQNs = append(tableFQNs, table.FQN())
+	}
+	tableSet := utils.NewSet(tableFQNs)
+
+	filteredObjects := make([]CustomObject, 0)
+	for _, object := range objects {
+		if object.Schema != "" && !(schemaSet.MatchesFilter(object.Schema) && excludeSchemaSet.MatchesFilter(object.Schema)) {
+			continue
+		}
+		if object.ReferenceObject != "" && !tableSet.MatchesFilter(object.ReferenceObject) {
+			continue
+		}
+		if object.ReferenceObject == "" && isTableFiltered {
+			continue
+		}
+		filteredObjects = append(filteredObjects, object)
+	}
+	return filteredObjects
+}
+
+func PrintCustomObjectStatements(metadataFile *utils.FileWithByteCount, tocfile *toc.TOC, section string, objectType string, objects []CustomObject) {
+	for _, object := range objects {
+		start := metadataFile.ByteCount
+		statement := strings.TrimSpace(object.Statement)
+		if !strings.HasSuffix(statement, ";") {
+			statement += ";"
+		}
+		metadataFile.MustPrintf("\n\n%s", statement)
+		entry := toc.MetadataEntry{Schema: object.Schema, Name: object.Name, ObjectType: objectType, ReferenceObject: object.ReferenceObject}
+		tocfile.AddMetadataEntry(section, entry, start, metadataFile.ByteCount)
+	}
+}
@@ -0,0 +1,135 @@
+package backup_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/testutils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/object_handlers tests", func() {
+	getNoObjects := func(connectionPool *dbconn.DBConn) ([]backup.CustomObject, error) {
+		return []backup.CustomObject{}, nil
+	}
+	AfterEach(func() {
+		backup.SetObjectHandlers(nil)
+		operating.InitializeSystemFunctions()
+	})
+	Describe("RegisterObjectHandler", func() {
+		It("registers a valid handler", func() {
+			err := backup.RegisterObjectHandler(backup.ObjectHandler{Name: "overviews", Section: "postdata", ObjectType: "RASTER OVERVIEW", GetObjects: getNoObjects})
+
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("returns an error for a handler with an invalid section", func() {
+			err := backup.RegisterObjectHandler(backup.ObjectHandler{Name: "overviews", Section: "data", ObjectType: "RASTER OVERVIEW", GetObjects: getNoObjects})
+
+			Expect(err).To(MatchError("Invalid section 'data' for object handler overviews.  Valid values are 'predata' and 'postdata'."))
+		})
+		It("returns an error for a handler with no object type", func() {
+			err := backup.RegisterObjectHandler(backup.ObjectHandler{Name: "overviews", Section: "postdata", GetObjects: getNoObjects})
+
+			Expect(err).To(MatchError("Object handler overviews must have a name, an object type, and a function to retrieve objects"))
+		})
+		It("returns an error for a handler with the same name as a registered handler", func() {
+			handler := backup.ObjectHandler{Name: "overviews", Section: "postdata", ObjectType: "RASTER OVERVIEW", GetObjects: getNoObjects}
+			Expect(backup.RegisterObjectHandler(handler)).To(Succeed())
+
+			err := backup.RegisterObjectHandler(handler)
+
+			Expect(err).To(MatchError("An object handler named overviews is already registered"))
+		})
+	})
+	Describe("ReadObjectHandlerFile", func() {
+		It("reads the handlers declared in the file", func() {
+			operating.System.ReadFile = func(filename string) ([]byte, error) {
+				return []byte(`handlers:
+- name: overviews
+  extension: postgis_raster
+  section: postdata
+  objecttype: RASTER OVERVIEW
+  query: SELECT 'public' AS schema, 'o_2_rast' AS name, 'SELECT 1' AS statement
+`), nil
+			}
+
+			specs, err := backup.ReadObjectHandlerFile("/tmp/handlers.yaml")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs).To(Equal([]backup.ObjectHandlerSpec{{
+				Name:       "overviews",
+				Extension:  "postgis_raster",
+				Section:    "postdata",
+				ObjectType: "RASTER OVERVIEW",
+				Query:      "SELECT 'public' AS schema, 'o_2_rast' AS name, 'SELECT 1' AS statement",
+			}}))
+		})
+		It("returns an error for a handler with no query", func() {
+			operating.System.ReadFile = func(filename string) ([]byte, error) {
+				return []byte("handlers:\n- name: overviews\n  section: postdata\n"), nil
+			}
+
+			_, err := backup.ReadObjectHandlerFile("/tmp/handlers.yaml")
+
+			Expect(err).To(MatchError("Object handler overviews in /tmp/handlers.yaml has no query"))
+		})
+	})
+	Describe("NewObjectHandlerFromSpec", func() {
+		It("retrieves objects using the query of the spec", func() {
+			rows := sqlmock.NewRows([]string{"schema", "name", "referenceobject", "statement"}).
+				AddRow("public", "o_2_rast", "public.rast", "SELECT AddOverviewConstraints('o_2_rast', 'rast', 'rast', 2)")
+			mock.ExpectQuery("SELECT (.*)").WillReturnRows(rows)
+			handler := backup.NewObjectHandlerFromSpec(backup.ObjectHandlerSpec{Name: "overviews", Section: "postdata", ObjectType: "RASTER OVERVIEW", Query: "SELECT ..."})
+
+			objects, err := handler.GetObjects(connectionPool)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(objects).To(Equal([]backup.CustomObject{
+				{Schema: "public", Name: "o_2_rast", ReferenceObject: "public.rast", Statement: "SELECT AddOverviewConstraints('o_2_rast', 'rast', 'rast', 2)"},
+			}))
+		})
+	})
+	Describe("FilterCustomObjects", func() {
+		tables := []backup.Table{{Relation: backup.Relation{Schema: "public", Name: "rast"}}}
+		unreferenced := backup.CustomObject{Schema: "public", Name: "standalone"}
+		referencing := backup.CustomObject{Schema: "public", Name: "o_2_rast", ReferenceObject: "public.rast"}
+		referencingOther := backup.CustomObject{Schema: "public", Name: "o_2_other", ReferenceObject: "public.other"}
+		otherSchema := backup.CustomObject{Schema: "other", Name: "standalone"}
+		objects := []backup.CustomObject{unreferenced, referencing, referencingOther, otherSchema}
+
+		It("keeps objects that reference no table or a backed up table", func() {
+			Expect(backup.FilterCustomObjects(objects, tables)).To(Equal([]backup.CustomObject{unreferenced, referencing, otherSchema}))
+		})
+		It("filters objects by schema", func() {
+			_ = cmdFlags.Set(options.EXCLUDE_SCHEMA, "other")
+
+			Expect(backup.FilterCustomObjects(objects, tables)).To(Equal([]backup.CustomObject{unreferenced, referencing}))
+		})
+		It("keeps only objects that reference a backed up table in a table-filtered backup", func() {
+			_ = cmdFlags.Set(options.INCLUDE_RELATION, "public.rast")
+
+			Expect(backup.FilterCustomObjects(objects, tables)).To(Equal([]backup.CustomObject{referencing}))
+		})
+	})
+	Describe("PrintCustomObjectStatements", func() {
+		It("prints the statement of each object with a TOC entry of the handler's object type", func() {
+			tocfile, backupfile = testutils.InitializeTestTOC(buffer, "postdata")
+			objects := []backup.CustomObject{
+				{Schema: "public", Name: "o_2_rast", ReferenceObject: "public.rast", Statement: "SELECT AddOverviewConstraints('o_2_rast', 'rast', 'rast', 2)"},
+				{Schema: "public", Name: "o_4_rast", ReferenceObject: "public.rast", Statement: "SELECT AddOverviewConstraints('o_4_rast', 'rast', 'rast', 4);\n"},
+			}
+
+			backup.PrintCustomObjectStatements(backupfile, tocfile, "postdata", "RASTER OVERVIEW", objects)
+
+			testutils.ExpectEntry(tocfile.PostdataEntries, 0, "public", "public.rast", "o_2_rast", "RASTER OVERVIEW")
+			testutils.ExpectEntry(tocfile.PostdataEntries, 1, "public", "public.rast", "o_4_rast", "RASTER OVERVIEW")
+			testutils.AssertBufferContents(tocfile.PostdataEntries, buffer,
+				"SELECT AddOverviewConstraints('o_2_rast', 'rast', 'rast', 2);",
+				"SELECT AddOverviewConstraints('o_4_rast', 'rast', 'rast', 4);")
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package backup
+
+/*
+ * This file contains functions for backing up table data while the metadata
+ * is being backed up, so that on a catalog with many objects the COPY
+ * commands of the --jobs workers are not held up by the metadata queries.
+ */
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+)
+
+/*
+ * The metadata queries need connection 0 to themselves, so the data can only
+ * be backed up alongside them if there are other connections to copy it with.
+ * Whether data is backed up at all must also not depend on the metadata, as
+ * it does with --skip-if-unchanged, and the tables must not have to be copied
+ * in the order of the oid list given to the helpers for --single-data-file.
+ */
+func CanBackupDataDuringMetadata(numConns int, dataOnly bool, skipIfUnchanged bool, singleDataFile bool) bool {
+	return numConns > 1 && !dataOnly && !skipIfUnchanged && !singleDataFile
+}
+
+func canBackupDataDuringMetadata() bool {
+	return !backupReport.MetadataOnly && CanBackupDataDuringMetadata(connectionPool.NumConns,
+		MustGetFlagBool(options.DATA_ONLY), MustGetFlagBool(options.SKIP_IF_UNCHANGED), MustGetFlagBool(options.SINGLE_DATA_FILE))
+}
+
+/*
+ * Workers 1 and up start copying data as soon as the tables are prepared,
+ * while backupMetadata runs on connection 0.  Worker 0 joins them once the
+ * metadata is written, and only then backs up the tables that the other
+ * workers could not lock, as it already holds the locks on all the tables.
+ */
+func backupDataDuringMetadata(tables []Table, backupMetadata func()) {
+	if len(tables) == 0 {
+		backupMetadata()
+		globalTOC.SyncProgressFile()
+		backupData(tables)
+		return
+	}
+	tablesToCopy, resumedRows := prepareDataBackup(tables)
+	defer stopDataBackup()
+
+	gplog.Info("Backing up data with %d worker(s) while metadata is written", connectionPool.NumConns-1)
+	mainWorkerReady := make(chan struct{})
+	dataDone := make(chan struct{})
+	var dataPanic interface{}
+	go func() {
+		defer close(dataDone)
+		// A fatal error is raised again once the metadata is done, so that it is handled as usual
+		defer func() {
+			dataPanic = recover()
+		}()
+		copyTableData(tables, tablesToCopy, resumedRows, mainWorkerReady)
+	}()
+
+	backupMetadata()
+	globalTOC.SyncProgressFile()
+	runStatus.SetPhase("Data")
+	close(mainWorkerReady)
+	<-dataDone
+	if dataPanic != nil {
+		panic(dataPanic)
+	}
+}
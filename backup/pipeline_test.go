@@ -0,0 +1,28 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/pipeline tests", func() {
+	Describe("CanBackupDataDuringMetadata", func() {
+		It("backs up data during the metadata backup with multiple connections", func() {
+			Expect(backup.CanBackupDataDuringMetadata(4, false, false, false)).To(BeTrue())
+		})
+		It("does not back up data during the metadata backup with a single connection", func() {
+			Expect(backup.CanBackupDataDuringMetadata(1, false, false, false)).To(BeFalse())
+		})
+		It("does not back up data during the metadata backup if there is no metadata backup", func() {
+			Expect(backup.CanBackupDataDuringMetadata(4, true, false, false)).To(BeFalse())
+		})
+		It("does not back up data during the metadata backup if the data backup depends on the metadata", func() {
+			Expect(backup.CanBackupDataDuringMetadata(4, false, true, false)).To(BeFalse())
+		})
+		It("does not back up data during the metadata backup to a single data file", func() {
+			Expect(backup.CanBackupDataDuringMetadata(4, false, false, true)).To(BeFalse())
+		})
+	})
+})
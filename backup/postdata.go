@@ -103,3 +103,67 @@ func PrintCreateEventTriggerStatements(metadataFile *utils.FileWithByteCount, to
 		PrintObjectMetadata(metadataFile, toc, eventTriggerMetadata[eventTrigger.GetUniqueID()], eventTrigger, "")
 	}
 }
+
+/*
+ * The REFRESH MATERIALIZED VIEW statements are not run in the post-data
+ * restore, but by gprestore --refresh-materialized-views once the data is
+ * restored.
+ */
+func PrintRefreshMaterializedViewStatements(metadataFile *utils.FileWithByteCount, tocfile *toc.TOC, views []Relation) {
+	for _, view := range views {
+		start := metadataFile.ByteCount
+		metadataFile.MustPrintf("\n\nREFRESH MATERIALIZED VIEW %s;", view.FQN())
+		entry := toc.MetadataEntry{
+			Schema:          view.Schema,
+			Name:            view.Name,
+			ObjectType:      "REFRESH MATERIALIZED VIEW",
+			ReferenceObject: view.FQN(),
+		}
+		tocfile.AddMetadataEntry("postdata", entry, start, metadataFile.ByteCount)
+	}
+}
+
+/*
+ * Row-level security is enabled on the tables after their policies are
+ * created, and both after the data is restored, so that the restored rows are
+ * not checked against the policies.
+ */
+func PrintCreatePolicyStatements(metadataFile *utils.FileWithByteCount, toc *toc.TOC, policies []RowSecurityPolicy, policyMetadata MetadataMap) {
+	for _, policy := range policies {
+		start := metadataFile.ByteCount
+		tableFQN := utils.MakeFQN(policy.OwningSchema, policy.OwningTable)
+		metadataFile.MustPrintf("\n\nCREATE POLICY %s ON %s", policy.Name, tableFQN)
+		if !policy.IsPermissive {
+			metadataFile.MustPrintf(" AS RESTRICTIVE")
+		}
+		metadataFile.MustPrintf(" FOR %s TO %s", policy.Command, policy.Roles)
+		if policy.UsingExpression != "" {
+			metadataFile.MustPrintf(" USING (%s)", policy.UsingExpression)
+		}
+		if policy.WithCheckExpression != "" {
+			metadataFile.MustPrintf(" WITH CHECK (%s)", policy.WithCheckExpression)
+		}
+		metadataFile.MustPrintf(";")
+
+		section, entry := policy.GetMetadataEntry()
+		toc.AddMetadataEntry(section, entry, start, metadataFile.ByteCount)
+		PrintObjectMetadata(metadataFile, toc, policyMetadata[policy.GetUniqueID()], policy, tableFQN)
+	}
+}
+
+func PrintEnableRowSecurityStatements(metadataFile *utils.FileWithByteCount, tocfile *toc.TOC, tables []RowSecurityTable) {
+	for _, table := range tables {
+		entry := toc.MetadataEntry{
+			Schema:          table.Schema,
+			Name:            table.Name,
+			ObjectType:      "ROW SECURITY METADATA",
+			ReferenceObject: table.FQN(),
+		}
+		start := metadataFile.ByteCount
+		metadataFile.MustPrintf("\n\nALTER TABLE %s ENABLE ROW LEVEL SECURITY;", table.FQN())
+		if table.IsForced {
+			metadataFile.MustPrintf("\nALTER TABLE %s FORCE ROW LEVEL SECURITY;", table.FQN())
+		}
+		tocfile.AddMetadataEntry("postdata", entry, start, metadataFile.ByteCount)
+	}
+}
@@ -185,4 +185,49 @@ ON ddl_command_start
 EXECUTE PROCEDURE abort_any_command();`, `ALTER EVENT TRIGGER testeventtrigger ENABLE ALWAYS;`)
 		})
 	})
+	Context("PrintRefreshMaterializedViewStatements", func() {
+		It("can print a refresh of each populated materialized view", func() {
+			views := []backup.Relation{{Oid: 1, Schema: "public", Name: "mview1"}, {Oid: 2, Schema: "public", Name: "mview2"}}
+			backup.PrintRefreshMaterializedViewStatements(backupfile, tocfile, views)
+			testutils.ExpectEntry(tocfile.PostdataEntries, 0, "public", "public.mview1", "mview1", "REFRESH MATERIALIZED VIEW")
+			testutils.ExpectEntry(tocfile.PostdataEntries, 1, "public", "public.mview2", "mview2", "REFRESH MATERIALIZED VIEW")
+			testutils.AssertBufferContents(tocfile.PostdataEntries, buffer, "REFRESH MATERIALIZED VIEW public.mview1;", "REFRESH MATERIALIZED VIEW public.mview2;")
+		})
+	})
+	Context("PrintCreatePolicyStatements", func() {
+		var policy backup.RowSecurityPolicy
+		BeforeEach(func() {
+			policy = backup.RowSecurityPolicy{Oid: 1, Name: "testpolicy", OwningSchema: "public", OwningTable: "testtable", IsPermissive: true, Command: "ALL", Roles: "PUBLIC"}
+		})
+		It("can print a policy for all commands and roles", func() {
+			policy.UsingExpression = "(owner = CURRENT_USER)"
+			backup.PrintCreatePolicyStatements(backupfile, tocfile, []backup.RowSecurityPolicy{policy}, emptyMetadataMap)
+			testutils.ExpectEntry(tocfile.PostdataEntries, 0, "public", "public.testtable", "testpolicy", "POLICY")
+			testutils.AssertBufferContents(tocfile.PostdataEntries, buffer, `CREATE POLICY testpolicy ON public.testtable FOR ALL TO PUBLIC USING ((owner = CURRENT_USER));`)
+		})
+		It("can print a restrictive policy for one command and several roles", func() {
+			policy.IsPermissive = false
+			policy.Command = "INSERT"
+			policy.Roles = "role1, role2"
+			policy.WithCheckExpression = "(i > 0)"
+			backup.PrintCreatePolicyStatements(backupfile, tocfile, []backup.RowSecurityPolicy{policy}, emptyMetadataMap)
+			testutils.AssertBufferContents(tocfile.PostdataEntries, buffer, `CREATE POLICY testpolicy ON public.testtable AS RESTRICTIVE FOR INSERT TO role1, role2 WITH CHECK ((i > 0));`)
+		})
+		It("can print a policy with a comment", func() {
+			policyMetadataMap := testutils.DefaultMetadataMap("POLICY", false, false, true, false)
+			backup.PrintCreatePolicyStatements(backupfile, tocfile, []backup.RowSecurityPolicy{policy}, policyMetadataMap)
+			testutils.AssertBufferContents(tocfile.PostdataEntries, buffer, `CREATE POLICY testpolicy ON public.testtable FOR ALL TO PUBLIC;`,
+				`COMMENT ON POLICY testpolicy ON public.testtable IS 'This is a policy comment.';`)
+		})
+	})
+	Context("PrintEnableRowSecurityStatements", func() {
+		It("can print the row-level security settings of tables", func() {
+			tables := []backup.RowSecurityTable{{Oid: 1, Schema: "public", Name: "table1"}, {Oid: 2, Schema: "public", Name: "table2", IsForced: true}}
+			backup.PrintEnableRowSecurityStatements(backupfile, tocfile, tables)
+			testutils.ExpectEntry(tocfile.PostdataEntries, 0, "public", "public.table1", "table1", "ROW SECURITY METADATA")
+			testutils.ExpectEntry(tocfile.PostdataEntries, 1, "public", "public.table2", "table2", "ROW SECURITY METADATA")
+			testutils.AssertBufferContents(tocfile.PostdataEntries, buffer, "ALTER TABLE public.table1 ENABLE ROW LEVEL SECURITY;",
+				"ALTER TABLE public.table2 ENABLE ROW LEVEL SECURITY;\nALTER TABLE public.table2 FORCE ROW LEVEL SECURITY;")
+		})
+	})
 })
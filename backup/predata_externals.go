@@ -8,8 +8,11 @@ package backup
 
 import (
 	"fmt"
+	"net/url"
+	"sort"
 	"strings"
 
+	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 )
@@ -26,6 +29,7 @@ const (
 	GPHDFS
 	HTTP
 	S3
+	PXF
 )
 
 type ExternalTableDefinition struct {
@@ -114,11 +118,56 @@ func DetermineExternalTableCharacteristics(extTableDef ExternalTableDefinition)
 			tableProtocol = HTTP
 		case "s3":
 			tableProtocol = S3
+		case "pxf":
+			tableProtocol = PXF
 		}
 	}
 	return tableType, tableProtocol
 }
 
+/*
+ * Returns the distinct PXF servers and profiles referenced by the LOCATION
+ * clauses of the given external tables.  PXF uses the "default" server when
+ * none is specified.
+ */
+func GetPXFReferences(tables []Table) []history.PXFReference {
+	referenceSet := make(map[history.PXFReference]bool)
+	for _, table := range tables {
+		if !table.IsExternal {
+			continue
+		}
+		for _, location := range table.ExtTableDef.URIs {
+			if !strings.HasPrefix(location, "pxf://") {
+				continue
+			}
+			reference := history.PXFReference{Server: "default"}
+			if queryStart := strings.Index(location, "?"); queryStart != -1 {
+				params, _ := url.ParseQuery(location[queryStart+1:])
+				for key, values := range params {
+					switch strings.ToUpper(key) {
+					case "SERVER":
+						reference.Server = values[0]
+					case "PROFILE":
+						reference.Profile = values[0]
+					}
+				}
+			}
+			referenceSet[reference] = true
+		}
+	}
+	references := make([]history.PXFReference, 0)
+	for reference := range referenceSet {
+		references = append(references, reference)
+	}
+	sort.Slice(references, func(i, j int) bool {
+		if references[i].Server != references[j].Server {
+			return references[i].Server < references[j].Server
+		}
+		return references[i].Profile < references[j].Profile
+	})
+	return references
+}
+
 func generateExecuteStatement(extTableDef ExternalTableDefinition) string {
 	var executeStatement string
 
@@ -5,6 +5,7 @@ import (
 
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/testutils"
 
 	. "github.com/onsi/ginkgo"
@@ -78,8 +79,36 @@ var _ = Describe("backup/predata_externals tests", func() {
 			Entry("classifies http:// locations correctly", "http://webhost:port/path/file", backup.READABLE_WEB, backup.HTTP),
 			Entry("classifies https:// locations correctly", "https://webhost:port/path/file", backup.READABLE_WEB, backup.HTTP),
 			Entry("classifies s3:// locations correctly", "s3://s3_endpoint:port/bucket_name/s3_prefix", backup.READABLE, backup.S3),
+			Entry("classifies pxf:// locations correctly", "pxf://data/path?PROFILE=hdfs:text&SERVER=hadoop", backup.READABLE, backup.PXF),
 		)
 	})
+	Describe("GetPXFReferences", func() {
+		makeTable := func(locations ...string) backup.Table {
+			extTableDef := extTableEmpty
+			extTableDef.URIs = locations
+			return backup.Table{TableDefinition: backup.TableDefinition{IsExternal: true, ExtTableDef: extTableDef}}
+		}
+		It("returns the distinct servers and profiles used by PXF external tables", func() {
+			tables := []backup.Table{
+				makeTable("pxf://data/sales?PROFILE=hdfs:text&SERVER=hadoop"),
+				makeTable("pxf://data/returns?profile=hdfs:text&server=hadoop"),
+				makeTable("pxf://public.orders?PROFILE=jdbc&SERVER=pgsrv"),
+				makeTable("pxf://data/logs?PROFILE=s3:parquet"),
+				makeTable("gpfdist://host:8080/file.txt"),
+				{TableDefinition: backup.TableDefinition{IsExternal: false}},
+			}
+			references := backup.GetPXFReferences(tables)
+			Expect(references).To(Equal([]history.PXFReference{
+				{Server: "default", Profile: "s3:parquet"},
+				{Server: "hadoop", Profile: "hdfs:text"},
+				{Server: "pgsrv", Profile: "jdbc"},
+			}))
+		})
+		It("returns an empty list if there are no PXF external tables", func() {
+			references := backup.GetPXFReferences([]backup.Table{makeTable("s3://endpoint/bucket/prefix")})
+			Expect(references).To(BeEmpty())
+		})
+	})
 	Describe("PrintExternalTableCreateStatement", func() {
 		var testTable backup.Table
 		var extTableDef backup.ExternalTableDefinition
@@ -196,10 +196,19 @@ func PrintCreateCastStatement(metadataFile *utils.FileWithByteCount, toc *toc.TO
 	PrintObjectMetadata(metadataFile, toc, castMetadata, castDef, "")
 }
 
+/*
+ * The version is included so that the restored extension matches its backed
+ * up members; gprestore --extension-versions upgrade removes it to create
+ * the default version of the restore cluster instead.
+ */
 func PrintCreateExtensionStatements(metadataFile *utils.FileWithByteCount, toc *toc.TOC, extensionDefs []Extension, extensionMetadata MetadataMap) {
 	for _, extensionDef := range extensionDefs {
 		start := metadataFile.ByteCount
-		metadataFile.MustPrintf("\n\nSET search_path=%s,pg_catalog;\nCREATE EXTENSION IF NOT EXISTS %s WITH SCHEMA %s;\nSET search_path=pg_catalog;", extensionDef.Schema, extensionDef.Name, extensionDef.Schema)
+		versionClause := ""
+		if extensionDef.Version != "" {
+			versionClause = fmt.Sprintf(" VERSION '%s'", utils.EscapeSingleQuotes(extensionDef.Version))
+		}
+		metadataFile.MustPrintf("\n\nSET search_path=%s,pg_catalog;\nCREATE EXTENSION IF NOT EXISTS %s WITH SCHEMA %s%s;\nSET search_path=pg_catalog;", extensionDef.Schema, extensionDef.Name, extensionDef.Schema, versionClause)
 
 		section, entry := extensionDef.GetMetadataEntry()
 		toc.AddMetadataEntry(section, entry, start, metadataFile.ByteCount)
@@ -207,6 +216,22 @@ func PrintCreateExtensionStatements(metadataFile *utils.FileWithByteCount, toc *
 	}
 }
 
+/*
+ * Extensions may require other extensions, which must be created first.
+ */
+func SortExtensions(extensions []Extension, dependencies DependencyMap) []Extension {
+	sortable := make([]Sortable, len(extensions))
+	for i, extension := range extensions {
+		sortable[i] = extension
+	}
+	sorted := TopologicalSort(sortable, dependencies)
+	sortedExtensions := make([]Extension, len(sorted))
+	for i, extension := range sorted {
+		sortedExtensions[i] = extension.(Extension)
+	}
+	return sortedExtensions
+}
+
 /*
  * This function separates out functions related to procedural languages from
  * any other functions, so that language-related functions can be backed up before
@@ -323,6 +348,17 @@ func PrintCreateForeignDataWrapperStatement(metadataFile *utils.FileWithByteCoun
 	PrintObjectMetadata(metadataFile, toc, fdwMetadata, fdw, "")
 }
 
+/*
+ * With --redact-credentials, the values of credential options are replaced
+ * with placeholders, and the values are kept in redactedCredentials.
+ */
+func redactCredentialOptions(optionList string) string {
+	if redactedCredentials == nil {
+		return optionList
+	}
+	return utils.RedactCredentialOptions(optionList, redactedCredentials)
+}
+
 func PrintCreateServerStatement(metadataFile *utils.FileWithByteCount, toc *toc.TOC, server ForeignServer, serverMetadata ObjectMetadata) {
 	start := metadataFile.ByteCount
 	metadataFile.MustPrintf("\n\nCREATE SERVER %s", server.Name)
@@ -334,7 +370,7 @@ func PrintCreateServerStatement(metadataFile *utils.FileWithByteCount, toc *toc.
 	}
 	metadataFile.MustPrintf("\n\tFOREIGN DATA WRAPPER %s", server.ForeignDataWrapper)
 	if server.Options != "" {
-		metadataFile.MustPrintf("\n\tOPTIONS (%s)", server.Options)
+		metadataFile.MustPrintf("\n\tOPTIONS (%s)", redactCredentialOptions(server.Options))
 	}
 	metadataFile.MustPrintf(";")
 
@@ -348,7 +384,7 @@ func PrintCreateUserMappingStatement(metadataFile *utils.FileWithByteCount, toc
 	start := metadataFile.ByteCount
 	metadataFile.MustPrintf("\n\nCREATE USER MAPPING FOR %s\n\tSERVER %s", mapping.User, mapping.Server)
 	if mapping.Options != "" {
-		metadataFile.MustPrintf("\n\tOPTIONS (%s)", mapping.Options)
+		metadataFile.MustPrintf("\n\tOPTIONS (%s)", redactCredentialOptions(mapping.Options))
 	}
 	metadataFile.MustPrintf(";")
 
@@ -591,6 +591,28 @@ SET search_path=pg_catalog;`)
 CREATE EXTENSION IF NOT EXISTS extension1 WITH SCHEMA schema1;
 SET search_path=pg_catalog;`, "COMMENT ON EXTENSION extension1 IS 'This is an extension comment.';")
 		})
+		It("prints a create extension statement with a version", func() {
+			extensionDef := backup.Extension{Oid: 1, Name: "extension1", Schema: "schema1", Version: "1.0"}
+			backup.PrintCreateExtensionStatements(backupfile, tocfile, []backup.Extension{extensionDef}, emptyMetadataMap)
+			testutils.AssertBufferContents(tocfile.PredataEntries, buffer, `SET search_path=schema1,pg_catalog;
+CREATE EXTENSION IF NOT EXISTS extension1 WITH SCHEMA schema1 VERSION '1.0';
+SET search_path=pg_catalog;`)
+		})
+	})
+	Describe("SortExtensions", func() {
+		extension1 := backup.Extension{Oid: 1, Name: "extension1", Schema: "schema1"}
+		extension2 := backup.Extension{Oid: 2, Name: "extension2", Schema: "schema1"}
+		It("returns the extensions in their original order if they do not require one another", func() {
+			sorted := backup.SortExtensions([]backup.Extension{extension1, extension2}, backup.DependencyMap{})
+			Expect(sorted).To(Equal([]backup.Extension{extension1, extension2}))
+		})
+		It("sorts required extensions before the extensions that require them", func() {
+			dependencies := backup.DependencyMap{
+				extension1.GetUniqueID(): {extension2.GetUniqueID(): true},
+			}
+			sorted := backup.SortExtensions([]backup.Extension{extension1, extension2}, dependencies)
+			Expect(sorted).To(Equal([]backup.Extension{extension2, extension1}))
+		})
 	})
 	Describe("ExtractLanguageFunctions", func() {
 		customLang1 := backup.ProceduralLanguage{Oid: 1, Name: "custom_language", Owner: "testrole", IsPl: true, PlTrusted: true, Handler: 3, Inline: 4, Validator: 5}
@@ -23,7 +23,9 @@ import (
  * backed up normally (both metadata and data).
  *
  * When the flag is not set, we want to back up both metadata and data for all
- * tables, so both returned arrays contain all tables.
+ * tables, so both returned arrays contain all tables, except that the roots
+ * whose leaf partitions are backed up separately because of
+ * --leaf-partition-data-larger-than are split as above.
  */
 func SplitTablesByPartitionType(tables []Table, includeList []string) ([]Table, []Table) {
 	metadataTables := make([]Table, 0)
@@ -49,16 +51,43 @@ func SplitTablesByPartitionType(tables []Table, includeList []string) ([]Table,
 		}
 	} else {
 		for _, table := range tables {
+			dataTable := table
 			if table.IsExternal && table.PartitionLevelInfo.Level == "l" {
 				table.Name = AppendExtPartSuffix(table.Name)
+			} else if table.PartitionLevelInfo.Level == "l" {
+				// Only the leaf partitions of the roots in splitPartitionRoots are retrieved
+				dataTables = append(dataTables, dataTable)
+				continue
 			}
 			metadataTables = append(metadataTables, table)
+			if !splitPartitionRoots[table.Oid] {
+				dataTables = append(dataTables, dataTable)
+			}
 		}
-		dataTables = tables
 	}
 	return metadataTables, dataTables
 }
 
+/*
+ * Splits the data tables into those whose data is backed up and those named
+ * in excludeList, whose data is not.  Excluding the data of a partitioned
+ * table excludes the data of its leaf partitions as well.
+ */
+func FilterTablesByExcludedData(tables []Table, excludeList []string) ([]Table, []Table) {
+	excludeSet := utils.NewSet(excludeList)
+	includedTables := make([]Table, 0)
+	excludedTables := make([]Table, 0)
+	for _, table := range tables {
+		isExcludedLeaf := table.PartitionLevelInfo.Level == "l" && excludeSet.MatchesFilter(utils.MakeFQN(table.Schema, table.PartitionLevelInfo.RootName))
+		if excludeSet.MatchesFilter(table.FQN()) || isExcludedLeaf {
+			excludedTables = append(excludedTables, table)
+		} else {
+			includedTables = append(includedTables, table)
+		}
+	}
+	return includedTables, excludedTables
+}
+
 func AppendExtPartSuffix(name string) string {
 	const SUFFIX = "_ext_part_"
 	const MAX_LEN = 63                 // MAX_DATA_LEN - 1 is the maximum length of a relation name
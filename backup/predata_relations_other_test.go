@@ -260,6 +260,30 @@ GRANT ALL ON shamwow.shazam TO testrole;`}
 			testutils.AssertBufferContents(tocfile.PredataEntries, buffer, `ALTER SEQUENCE public.seq_name OWNED BY public.tablename.col_one;`)
 		})
 	})
+	Describe("FilterTablesByExcludedData", func() {
+		auditTable := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "audit"}}
+		factsTable := backup.Table{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "facts"}}
+		scratchLeaf := backup.Table{
+			Relation:        backup.Relation{Oid: 3, Schema: "public", Name: "scratch_1_prt_1"},
+			TableDefinition: backup.TableDefinition{PartitionLevelInfo: backup.PartitionLevelInfo{Level: "l", RootName: "scratch"}},
+		}
+		tables := []backup.Table{auditTable, factsTable, scratchLeaf}
+		It("excludes the data of the listed tables", func() {
+			includedTables, excludedTables := backup.FilterTablesByExcludedData(tables, []string{"public.audit"})
+			Expect(includedTables).To(Equal([]backup.Table{factsTable, scratchLeaf}))
+			Expect(excludedTables).To(Equal([]backup.Table{auditTable}))
+		})
+		It("excludes the data of the leaf partitions of a listed partitioned table", func() {
+			includedTables, excludedTables := backup.FilterTablesByExcludedData(tables, []string{"public.scratch"})
+			Expect(includedTables).To(Equal([]backup.Table{auditTable, factsTable}))
+			Expect(excludedTables).To(Equal([]backup.Table{scratchLeaf}))
+		})
+		It("excludes nothing if no tables are listed", func() {
+			includedTables, excludedTables := backup.FilterTablesByExcludedData(tables, []string{})
+			Expect(includedTables).To(Equal(tables))
+			Expect(excludedTables).To(BeEmpty())
+		})
+	})
 	Describe("SplitTablesByPartitionType", func() {
 		var tables []backup.Table
 		var includeList []string
@@ -434,6 +458,44 @@ GRANT ALL ON shamwow.shazam TO testrole;`}
 				structmatcher.ExpectStructsToMatch(&expectedTables[0], &metadataTables[0])
 				structmatcher.ExpectStructsToMatch(&expectedTables[1], &metadataTables[1])
 			})
+			It("splits the partitioned tables whose leaf partitions are backed up separately", func() {
+				includeList = []string{}
+				tables = []backup.Table{
+					{
+						Relation:        backup.Relation{Oid: 1, Schema: "public", Name: "part_parent1"},
+						TableDefinition: backup.TableDefinition{PartitionLevelInfo: backup.PartitionLevelInfo{Level: "p"}},
+					},
+					{
+						Relation:        backup.Relation{Oid: 2, Schema: "public", Name: "part_parent2"},
+						TableDefinition: backup.TableDefinition{PartitionLevelInfo: backup.PartitionLevelInfo{Level: "p"}},
+					},
+					{
+						Relation:        backup.Relation{Oid: 8, Schema: "public", Name: "test_table"},
+						TableDefinition: backup.TableDefinition{PartitionLevelInfo: backup.PartitionLevelInfo{Level: "n"}},
+					},
+					{
+						Relation:        backup.Relation{Oid: 6, Schema: "public", Name: "part_parent2_child1"},
+						TableDefinition: backup.TableDefinition{PartitionLevelInfo: backup.PartitionLevelInfo{Level: "l", RootName: "part_parent2"}},
+					},
+					{
+						Relation:        backup.Relation{Oid: 7, Schema: "public", Name: "part_parent2_child2"},
+						TableDefinition: backup.TableDefinition{PartitionLevelInfo: backup.PartitionLevelInfo{Level: "l", RootName: "part_parent2"}},
+					},
+				}
+				_ = cmdFlags.Set(options.LEAF_PARTITION_DATA, "false")
+				_ = cmdFlags.Set(options.INCLUDE_RELATION, "")
+				backup.SetSplitPartitionRoots(map[uint32]bool{2: true})
+				defer backup.SetSplitPartitionRoots(nil)
+				metadataTables, dataTables := backup.SplitTablesByPartitionType(tables, includeList)
+
+				Expect(metadataTables).To(Equal(expectedMetadataTables))
+
+				dataTableNames := make([]string, 0)
+				for _, table := range dataTables {
+					dataTableNames = append(dataTableNames, table.FQN())
+				}
+				Expect(dataTableNames).To(Equal([]string{"public.part_parent1", "public.test_table", "public.part_parent2_child1", "public.part_parent2_child2"}))
+			})
 		})
 	})
 	Describe("AppendExtPartSuffix", func() {
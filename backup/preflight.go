@@ -0,0 +1,173 @@
+package backup
+
+/*
+ * This file contains functions for the pre-flight summary, which reports the
+ * objects, largest tables, and estimated size and duration of a backup once
+ * its metadata is written and before its data is copied, so that a backup
+ * that looks wrong can be stopped early.
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+// The number of largest tables listed in the pre-flight summary
+const numPreflightTables = 20
+
+/*
+ * EstimatedBackupSize is the estimated size of the backup files, from the
+ * ratio of backup size to data size of previous backups, and is only valid
+ * if NumSizeBackups is greater than 0.
+ */
+type PreflightSummary struct {
+	Timestamp           string
+	Database            string
+	ObjectCounts        map[string]int
+	NumDataTables       int
+	LargestTables       []DryRunTable
+	DataSize            int64
+	EstimatedBackupSize int64
+	NumSizeBackups      int
+	EstimatedDuration   time.Duration
+	NumDurationBackups  int
+}
+
+func NewPreflightSummary(timestamp string, dbName string, objectCounts map[string]int, dataTables []Table, sizes map[uint32]int64, backupHistory *history.History) PreflightSummary {
+	plan := NewDryRunPlan(dbName, 0, dataTables, dataTables, sizes)
+	largestTables := plan.DataTables
+	if len(largestTables) > numPreflightTables {
+		largestTables = largestTables[:numPreflightTables]
+	}
+	summary := PreflightSummary{
+		Timestamp:     timestamp,
+		Database:      dbName,
+		ObjectCounts:  objectCounts,
+		NumDataTables: len(dataTables),
+		LargestTables: largestTables,
+		DataSize:      plan.DataSize,
+	}
+	summary.EstimatedBackupSize, summary.NumSizeBackups = EstimateBackupSize(backupHistory, dbName, plan.DataSize)
+	summary.EstimatedDuration, summary.NumDurationBackups = EstimateBackupDuration(backupHistory, dbName, plan.DataSize)
+	return summary
+}
+
+/*
+ * Estimates the size of the backup files for the given amount of data from
+ * the ratio of backup size to data size of the most recent successful
+ * backups of the database, and returns the number of backups the estimate is
+ * based on.
+ */
+func EstimateBackupSize(backupHistory *history.History, dbName string, dataSize int64) (int64, int) {
+	ratio, numBackups := EstimateCompressionRatio(backupHistory, dbName)
+	return int64(math.Round(float64(dataSize) * ratio)), numBackups
+}
+
+/*
+ * Returns the ratio of backup size to data size of the most recent successful
+ * backups of the database, which reflects how well their data compressed, and
+ * the number of backups it is based on.  Backups whose sizes were not
+ * recorded, such as plugin backups, are not used.
+ */
+func EstimateCompressionRatio(backupHistory *history.History, dbName string) (float64, int) {
+	var totalBackupSize, totalDataSize int64
+	numBackups := 0
+	for _, backupConfig := range backupHistory.BackupConfigs {
+		if numBackups == numEstimateBackups {
+			break
+		}
+		if backupConfig.DatabaseName != dbName || backupConfig.Status != history.BackupStatusSucceed ||
+			backupConfig.DataSize <= 0 || backupConfig.BackupSize <= 0 {
+			continue
+		}
+		totalBackupSize += backupConfig.BackupSize
+		totalDataSize += backupConfig.DataSize
+		numBackups++
+	}
+	if numBackups == 0 {
+		return 0, 0
+	}
+	return float64(totalBackupSize) / float64(totalDataSize), numBackups
+}
+
+func PrintPreflightSummary(writer io.Writer, summary PreflightSummary) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	sizeEstimate := "unknown (no previous backups with a recorded backup size)"
+	if summary.NumSizeBackups > 0 {
+		sizeEstimate = fmt.Sprintf("%s (based on %d previous backups)", utils.FormatSize(summary.EstimatedBackupSize), summary.NumSizeBackups)
+	}
+	durationEstimate := "unknown (no previous backups with a recorded data size)"
+	if summary.NumDurationBackups > 0 {
+		durationEstimate = fmt.Sprintf("%s (based on %d previous backups)", report.FormatDuration(summary.EstimatedDuration.Round(time.Second)), summary.NumDurationBackups)
+	}
+	_, _ = fmt.Fprintf(tabWriter, "Pre-flight summary for backup %s of database %s\n", summary.Timestamp, summary.Database)
+
+	objectTypes := make([]string, 0, len(summary.ObjectCounts))
+	for objectType := range summary.ObjectCounts {
+		objectTypes = append(objectTypes, objectType)
+	}
+	sort.Strings(objectTypes)
+	for _, objectType := range objectTypes {
+		_, _ = fmt.Fprintf(tabWriter, "%s:\t%d\n", strings.ToLower(objectType), summary.ObjectCounts[objectType])
+	}
+	_, _ = fmt.Fprintf(tabWriter, "tables with data:\t%d\n", summary.NumDataTables)
+	_, _ = fmt.Fprintf(tabWriter, "data size:\t%s\n", utils.FormatSize(summary.DataSize))
+	_, _ = fmt.Fprintf(tabWriter, "estimated backup size:\t%s\n", sizeEstimate)
+	_, _ = fmt.Fprintf(tabWriter, "estimated duration:\t%s\n", durationEstimate)
+	err := tabWriter.Flush()
+	if err != nil || len(summary.LargestTables) == 0 {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(tabWriter, "\nLARGEST TABLES\tSIZE")
+	for _, table := range summary.LargestTables {
+		size := "external"
+		if table.Size >= 0 {
+			size = utils.FormatSize(table.Size)
+		}
+		_, _ = fmt.Fprintf(tabWriter, "%s\t%s\n", table.Name, size)
+	}
+	return tabWriter.Flush()
+}
+
+/*
+ * Logs the pre-flight summary and writes it next to the report.  Errors are
+ * only logged, as the summary must never stop the backup.
+ */
+func writePreflightSummary(dataTables []Table) {
+	backupHistory := &history.History{BackupConfigs: make([]history.BackupConfig, 0)}
+	historyFilename := globalFPInfo.GetBackupHistoryFilePath()
+	if iohelper.FileExistsAndIsReadable(historyFilename) {
+		if pastBackups, err := history.NewHistory(historyFilename); err == nil {
+			backupHistory = pastBackups
+		} else {
+			gplog.Verbose("Unable to read backup history %s for the pre-flight summary: %v", historyFilename, err)
+		}
+	}
+	summary := NewPreflightSummary(globalFPInfo.Timestamp, connectionPool.DBName, objectCounts, dataTables, tableSizes, backupHistory)
+
+	var buffer bytes.Buffer
+	_ = PrintPreflightSummary(&buffer, summary)
+	for _, line := range strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n") {
+		gplog.Info("%s", line)
+	}
+
+	preflightFilename := globalFPInfo.GetBackupPreflightFilePath()
+	err := ioutil.WriteFile(preflightFilename, buffer.Bytes(), 0644)
+	if err != nil {
+		gplog.Verbose("Unable to write pre-flight summary to %s: %v", preflightFilename, err)
+	}
+}
@@ -0,0 +1,78 @@
+package backup_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/history"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("backup/preflight tests", func() {
+	Describe("NewPreflightSummary", func() {
+		It("lists only the largest tables", func() {
+			tables := make([]backup.Table, 0)
+			sizes := make(map[uint32]int64)
+			for i := 1; i <= 25; i++ {
+				tables = append(tables, backup.Table{Relation: backup.Relation{Oid: uint32(i), Schema: "public", Name: fmt.Sprintf("t%02d", i)}})
+				sizes[uint32(i)] = int64(i * 1024)
+			}
+			backupHistory := &history.History{BackupConfigs: []history.BackupConfig{}}
+			summary := backup.NewPreflightSummary("20170101010101", "testdb", map[string]int{"Tables": 25}, tables, sizes, backupHistory)
+			Expect(summary.NumDataTables).To(Equal(25))
+			Expect(summary.LargestTables).To(HaveLen(20))
+			Expect(summary.LargestTables[0]).To(Equal(backup.DryRunTable{Name: "public.t25", Size: 25 * 1024}))
+			Expect(summary.LargestTables[19]).To(Equal(backup.DryRunTable{Name: "public.t06", Size: 6 * 1024}))
+			Expect(summary.DataSize).To(Equal(int64(325 * 1024)))
+			Expect(summary.NumSizeBackups).To(Equal(0))
+		})
+	})
+	Describe("EstimateBackupSize", func() {
+		It("estimates the size from the ratio of backup size to data size of previous backups", func() {
+			backupHistory := &history.History{BackupConfigs: []history.BackupConfig{
+				{DatabaseName: "testdb", Status: history.BackupStatusSucceed, DataSize: 1000, BackupSize: 300},
+				{DatabaseName: "otherdb", Status: history.BackupStatusSucceed, DataSize: 1000, BackupSize: 900},
+				{DatabaseName: "testdb", Status: history.BackupStatusFailed, DataSize: 1000, BackupSize: 900},
+				{DatabaseName: "testdb", Status: history.BackupStatusSucceed, DataSize: 1000},
+				{DatabaseName: "testdb", Status: history.BackupStatusSucceed, DataSize: 3000, BackupSize: 500},
+			}}
+			size, numBackups := backup.EstimateBackupSize(backupHistory, "testdb", 8000)
+			Expect(numBackups).To(Equal(2))
+			Expect(size).To(Equal(int64(1600)))
+		})
+	})
+	Describe("PrintPreflightSummary", func() {
+		It("prints the object counts, estimates, and largest tables", func() {
+			buffer := NewBuffer()
+			summary := backup.PreflightSummary{
+				Timestamp:           "20170101010101",
+				Database:            "testdb",
+				ObjectCounts:        map[string]int{"Tables": 3, "Functions": 12},
+				NumDataTables:       2,
+				LargestTables:       []backup.DryRunTable{{Name: "public.large", Size: 3 * 1024 * 1024}, {Name: "public.ext", Size: -1}},
+				DataSize:            3 * 1024 * 1024,
+				EstimatedBackupSize: 1024 * 1024,
+				NumSizeBackups:      3,
+				EstimatedDuration:   90 * time.Second,
+			}
+			err := backup.PrintPreflightSummary(buffer, summary)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buffer.Contents())).To(Equal(`Pre-flight summary for backup 20170101010101 of database testdb
+functions:              12
+tables:                 3
+tables with data:       2
+data size:              3.0 MB
+estimated backup size:  1.0 MB (based on 3 previous backups)
+estimated duration:     unknown (no previous backups with a recorded data size)
+
+LARGEST TABLES  SIZE
+public.large    3.0 MB
+public.ext      external
+`))
+		})
+	})
+})
@@ -46,6 +46,7 @@ var (
 	TYPE_FOREIGNSERVER      MetadataQueryParams
 	TYPE_FUNCTION           MetadataQueryParams
 	TYPE_INDEX              MetadataQueryParams
+	TYPE_POLICY             MetadataQueryParams
 	TYPE_PROCLANGUAGE       MetadataQueryParams
 	TYPE_OPERATOR           MetadataQueryParams
 	TYPE_OPERATORCLASS      MetadataQueryParams
@@ -79,6 +80,7 @@ func InitializeMetadataParams(connectionPool *dbconn.DBConn) {
 	TYPE_FOREIGNSERVER = MetadataQueryParams{ObjectType: "SERVER", NameField: "srvname", ACLField: "srvacl", OwnerField: "srvowner", CatalogTable: "pg_foreign_server"}
 	TYPE_FUNCTION = MetadataQueryParams{ObjectType: "FUNCTION", NameField: "proname", SchemaField: "pronamespace", ACLField: "proacl", OwnerField: "proowner", CatalogTable: "pg_proc", FilterClause: "proisagg = 'f'"}
 	TYPE_INDEX = MetadataQueryParams{ObjectType: "INDEX", NameField: "relname", OidField: "indexrelid", OidTable: "pg_class", CommentTable: "pg_class", CatalogTable: "pg_index"}
+	TYPE_POLICY = MetadataQueryParams{ObjectType: "POLICY", NameField: "polname", OidField: "oid", CatalogTable: "pg_policy"}
 	TYPE_PROCLANGUAGE = MetadataQueryParams{ObjectType: "LANGUAGE", NameField: "lanname", ACLField: "lanacl", CatalogTable: "pg_language"}
 	if connectionPool.Version.Before("5") {
 		TYPE_PROCLANGUAGE.OwnerField = "10" // In GPDB 4.3, there is no lanowner field in pg_language, but languages have an implicit owner
@@ -691,9 +691,11 @@ func GetCasts(connectionPool *dbconn.DBConn) []Cast {
 }
 
 type Extension struct {
-	Oid    uint32
-	Name   string
-	Schema string
+	Oid         uint32
+	Name        string
+	Schema      string
+	Version     string
+	MemberCount int
 }
 
 func (e Extension) GetMetadataEntry() (string, toc.MetadataEntry) {
@@ -719,10 +721,17 @@ func (e Extension) FQN() string {
 func GetExtensions(connectionPool *dbconn.DBConn) []Extension {
 	results := make([]Extension, 0)
 
+	// The members of an extension, recorded in pg_depend with deptype 'e',
+	// are created by CREATE EXTENSION and so are not backed up individually.
 	query := fmt.Sprintf(`
 	SELECT e.oid,
 		quote_ident(extname) AS name,
-		quote_ident(n.nspname) AS schema
+		quote_ident(n.nspname) AS schema,
+		extversion AS version,
+		(SELECT count(*) FROM pg_depend d
+			WHERE d.refclassid = 'pg_extension'::regclass
+			AND d.refobjid = e.oid
+			AND d.deptype = 'e') AS membercount
 	FROM pg_extension e
 		JOIN pg_namespace n ON e.extnamespace = n.oid
 	WHERE e.oid >= %d`, FIRST_NORMAL_OBJECT_ID)
@@ -731,6 +740,44 @@ func GetExtensions(connectionPool *dbconn.DBConn) []Extension {
 	return results
 }
 
+/*
+ * Returns the extensions that each extension requires, so that required
+ * extensions are created first.  Extensions that are not being backed up,
+ * such as those created with the database, are left out.
+ */
+func GetExtensionDependencies(connectionPool *dbconn.DBConn, extensions []Extension) DependencyMap {
+	query := `
+	SELECT d.objid AS oid,
+		d.refobjid AS referencedoid
+	FROM pg_depend d
+	WHERE d.classid = 'pg_extension'::regclass
+		AND d.refclassid = 'pg_extension'::regclass
+		AND d.deptype = 'n'`
+	results := make([]struct {
+		Oid           uint32
+		ReferencedOid uint32
+	}, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+
+	backupSet := make(map[uint32]bool, len(extensions))
+	for _, extension := range extensions {
+		backupSet[extension.Oid] = true
+	}
+	dependencies := make(DependencyMap)
+	for _, result := range results {
+		if !backupSet[result.Oid] || !backupSet[result.ReferencedOid] {
+			continue
+		}
+		extensionID := UniqueID{ClassID: PG_EXTENSION_OID, Oid: result.Oid}
+		if _, ok := dependencies[extensionID]; !ok {
+			dependencies[extensionID] = make(map[UniqueID]bool)
+		}
+		dependencies[extensionID][UniqueID{ClassID: PG_EXTENSION_OID, Oid: result.ReferencedOid}] = true
+	}
+	return dependencies
+}
+
 type ProceduralLanguage struct {
 	Oid       uint32
 	Name      string
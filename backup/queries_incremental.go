@@ -6,6 +6,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/pkg/errors"
 )
 
 func GetAOIncrementalMetadata(connectionPool *dbconn.DBConn) map[string]toc.AOEntry {
@@ -117,3 +118,69 @@ func getLastDDLTimestamps(connectionPool *dbconn.DBConn) map[string]string {
 	}
 	return resultMap
 }
+
+/*
+ * The tuple counts are read from the statistics collector on each segment, as
+ * the master does not see the modifications made to the data on segments.
+ */
+func GetHeapIncrementalMetadata(connectionPool *dbconn.DBConn) map[string]toc.HeapEntry {
+	gplog.Verbose("Querying heap table modification counts")
+	query := fmt.Sprintf(`
+	SELECT quote_ident(n.nspname) || '.' || quote_ident(c.relname) AS heaptablefqn,
+		c.relfilenode,
+		COALESCE(segstats.modcount, 0) AS modcount,
+		COALESCE(lastop.lastddltimestamp::text, '') AS lastddltimestamp
+	FROM pg_class c
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+		LEFT JOIN ( SELECT segc.oid,
+				pg_catalog.sum(pg_stat_get_tuples_inserted(segc.oid) +
+					pg_stat_get_tuples_updated(segc.oid) +
+					pg_stat_get_tuples_deleted(segc.oid)) AS modcount
+			FROM gp_dist_random('pg_class') segc
+			WHERE segc.relkind = 'r'
+				AND segc.relstorage = 'h'
+			GROUP BY segc.oid
+		) segstats ON c.oid = segstats.oid
+		LEFT JOIN ( SELECT lo.objid,
+				MAX(lo.statime) AS lastddltimestamp
+			FROM pg_stat_last_operation lo
+			WHERE lo.staactionname IN ('CREATE', 'ALTER', 'TRUNCATE')
+			GROUP BY lo.objid
+		) lastop ON c.oid = lastop.objid
+	WHERE c.relkind = 'r'
+		AND c.relstorage = 'h'
+		AND %s`, relationAndSchemaFilterClause())
+
+	var results []struct {
+		HeapTableFQN     string
+		RelFileNode      uint32
+		Modcount         int64
+		LastDDLTimestamp string
+	}
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	heapTableEntries := make(map[string]toc.HeapEntry)
+	for _, result := range results {
+		heapTableEntries[result.HeapTableFQN] = toc.HeapEntry{
+			Modcount:         result.Modcount,
+			RelFileNode:      result.RelFileNode,
+			LastDDLTimestamp: result.LastDDLTimestamp,
+		}
+	}
+	return heapTableEntries
+}
+
+/*
+ * Heap table modifications are not counted unless the statistics collector
+ * is counting tuple-level activity, which GPDB 4.3 calls stats_row_level.
+ */
+func ValidateTrackCountsEnabled(connectionPool *dbconn.DBConn, purpose string) {
+	settingName := "track_counts"
+	if connectionPool.Version.Before("5") {
+		settingName = "stats_row_level"
+	}
+	setting := dbconn.MustSelectString(connectionPool, fmt.Sprintf("SELECT setting AS string FROM pg_settings WHERE name = '%s'", settingName))
+	if setting != "on" {
+		gplog.Fatal(errors.Errorf("%s must be enabled to %s", settingName, purpose), "")
+	}
+}
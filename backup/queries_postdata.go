@@ -339,3 +339,131 @@ func GetEventTriggers(connectionPool *dbconn.DBConn) []EventTrigger {
 	gplog.FatalOnError(err)
 	return results
 }
+
+/*
+ * Returns the materialized views that held data when the backup was taken, as
+ * their definitions are restored WITH NO DATA, so that gprestore can populate
+ * them again once the data of their base tables is restored.
+ */
+func GetPopulatedMaterializedViews(connectionPool *dbconn.DBConn) []Relation {
+	query := fmt.Sprintf(`
+	SELECT n.oid AS schemaoid,
+		c.oid AS oid,
+		quote_ident(n.nspname) AS schema,
+		quote_ident(c.relname) AS name
+	FROM pg_class c
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+	WHERE c.relkind = 'm'
+		AND c.relispopulated
+		AND %s
+		AND %s
+	ORDER BY n.nspname, c.relname`,
+	relationAndSchemaFilterClause(), ExtensionFilterClause("c"))
+
+	results := make([]Relation, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	return results
+}
+
+type RowSecurityPolicy struct {
+	Oid                 uint32
+	Name                string
+	OwningSchema        string
+	OwningTable         string
+	IsPermissive        bool
+	Command             string
+	Roles               string
+	UsingExpression     string
+	WithCheckExpression string
+}
+
+func (p RowSecurityPolicy) GetMetadataEntry() (string, toc.MetadataEntry) {
+	tableFQN := utils.MakeFQN(p.OwningSchema, p.OwningTable)
+	return "postdata",
+		toc.MetadataEntry{
+			Schema:          p.OwningSchema,
+			Name:            p.Name,
+			ObjectType:      "POLICY",
+			ReferenceObject: tableFQN,
+			StartByte:       0,
+			EndByte:         0,
+		}
+}
+
+func (p RowSecurityPolicy) GetUniqueID() UniqueID {
+	return UniqueID{ClassID: PG_POLICY_OID, Oid: p.Oid}
+}
+
+func (p RowSecurityPolicy) FQN() string {
+	return p.Name
+}
+
+// Row-level security was introduced in GPDB 7
+func GetRowSecurityPolicies(connectionPool *dbconn.DBConn) []RowSecurityPolicy {
+	query := fmt.Sprintf(`
+	SELECT p.oid AS oid,
+		quote_ident(p.polname) AS name,
+		quote_ident(n.nspname) AS owningschema,
+		quote_ident(c.relname) AS owningtable,
+		p.polpermissive AS ispermissive,
+		CASE p.polcmd
+			WHEN 'r' THEN 'SELECT'
+			WHEN 'a' THEN 'INSERT'
+			WHEN 'w' THEN 'UPDATE'
+			WHEN 'd' THEN 'DELETE'
+			ELSE 'ALL'
+		END AS command,
+		CASE WHEN p.polroles = '{0}' THEN 'PUBLIC'
+			ELSE array_to_string(ARRAY(SELECT quote_ident(r.rolname) FROM pg_roles r WHERE r.oid = ANY(p.polroles) ORDER BY r.rolname), ', ')
+		END AS roles,
+		coalesce(pg_get_expr(p.polqual, p.polrelid), '') AS usingexpression,
+		coalesce(pg_get_expr(p.polwithcheck, p.polrelid), '') AS withcheckexpression
+	FROM pg_policy p
+		JOIN pg_class c ON c.oid = p.polrelid
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+	WHERE %s
+		AND %s
+	ORDER BY n.nspname, c.relname, p.polname`,
+		relationAndSchemaFilterClause(), ExtensionFilterClause("c"))
+
+	results := make([]RowSecurityPolicy, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	return results
+}
+
+/*
+ * Tables on which row-level security is enabled, and whether it is forced on
+ * the owner of the table as well.
+ */
+type RowSecurityTable struct {
+	Oid      uint32
+	Schema   string
+	Name     string
+	IsForced bool
+}
+
+func (t RowSecurityTable) FQN() string {
+	return utils.MakeFQN(t.Schema, t.Name)
+}
+
+func GetRowSecurityTables(connectionPool *dbconn.DBConn) []RowSecurityTable {
+	query := fmt.Sprintf(`
+	SELECT c.oid AS oid,
+		quote_ident(n.nspname) AS schema,
+		quote_ident(c.relname) AS name,
+		c.relforcerowsecurity AS isforced
+	FROM pg_class c
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+	WHERE c.relrowsecurity
+		AND %s
+		AND %s
+	ORDER BY n.nspname, c.relname`,
+		relationAndSchemaFilterClause(), ExtensionFilterClause("c"))
+
+	results := make([]RowSecurityTable, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	return results
+}
@@ -4,10 +4,13 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"regexp"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/greenplum-db/gp-common-go-libs/structmatcher"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/pkg/errors"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -36,6 +39,100 @@ var _ = Describe("backup internal tests", func() {
 			Expect(len(lockQueries)).To(Equal(3))
 		})
 	})
+	Describe("LockTables", func() {
+		busy := backup.Relation{Oid: 1, Schema: "public", Name: "busy"}
+		idle := backup.Relation{Oid: 2, Schema: "public", Name: "idle"}
+		BeforeEach(func() {
+			testhelper.SetDBVersion(connectionPool, "6.0.0")
+		})
+		It("locks the tables in batches without a timeout", func() {
+			mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE public.busy, public.idle IN ACCESS SHARE MODE")).WillReturnResult(sqlmock.NewResult(0, 0))
+			locked, skipped := backup.LockTables(connectionPool, []backup.Relation{busy, idle}, 0, false)
+			Expect(locked).To(Equal([]backup.Relation{busy, idle}))
+			Expect(skipped).To(BeEmpty())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("fails when the tables cannot be locked within the timeout", func() {
+			mock.ExpectExec("SET lock_timeout = 30000").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE public.busy, public.idle IN ACCESS SHARE MODE")).WillReturnError(errors.New("canceling statement due to lock timeout"))
+			defer testhelper.ShouldPanicWithMessage("Could not acquire ACCESS SHARE locks on tables within 30 seconds")
+			backup.LockTables(connectionPool, []backup.Relation{busy, idle}, 30, false)
+		})
+		It("locks the tables of a batch that timed out one at a time and skips those that cannot be locked", func() {
+			mock.ExpectExec("SET lock_timeout = 30000").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE public.busy, public.idle IN ACCESS SHARE MODE")).WillReturnError(errors.New("canceling statement due to lock timeout"))
+			mock.ExpectExec("ROLLBACK TO SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE public.busy IN ACCESS SHARE MODE")).WillReturnError(errors.New("canceling statement due to lock timeout"))
+			mock.ExpectExec("ROLLBACK TO SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE public.idle IN ACCESS SHARE MODE")).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SET lock_timeout = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+			locked, skipped := backup.LockTables(connectionPool, []backup.Relation{busy, idle}, 30, true)
+			Expect(locked).To(Equal([]backup.Relation{idle}))
+			Expect(skipped).To(Equal([]backup.Relation{busy}))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("uses statement_timeout before GPDB 6", func() {
+			testhelper.SetDBVersion(connectionPool, "5.1.0")
+			mock.ExpectExec("SET statement_timeout = 30000").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("LOCK TABLE public.busy IN ACCESS SHARE MODE")).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SET statement_timeout = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+			locked, _ := backup.LockTables(connectionPool, []backup.Relation{busy}, 30, false)
+			Expect(locked).To(Equal([]backup.Relation{busy}))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
+	Describe("GetLockBlockingSessions", func() {
+		It("returns the sessions blocking the locks of the backup", func() {
+			header := []string{"sessionid", "pid", "username", "relation", "query"}
+			fakeRows := sqlmock.NewRows(header).AddRow(12, 3456, "etl", "public.busy", "ALTER TABLE public.busy ADD COLUMN c int;")
+			mock.ExpectQuery(`SELECT (.*)`).WillReturnRows(fakeRows)
+			sessions, err := backup.GetLockBlockingSessions(connectionPool, "gpbackup_20170101010101")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sessions).To(Equal([]backup.BlockingSession{{SessionID: 12, Pid: 3456, Username: "etl", Relation: "public.busy", Query: "ALTER TABLE public.busy ADD COLUMN c int;"}}))
+			Expect(sessions[0].String()).To(Equal("Session 12 (pid 3456, user etl) is blocking the lock on public.busy with query: ALTER TABLE public.busy ADD COLUMN c int;"))
+		})
+	})
+	Describe("GetPartitionLeavesLargerThan", func() {
+		It("returns the leaf partitions of the partitioned tables larger than the threshold with their roots", func() {
+			header := []string{"rootoid", "schemaoid", "oid", "schema", "name"}
+			fakeRows := sqlmock.NewRows(header).AddRow(1, 2200, 3, "public", "foo_1_prt_1").AddRow(1, 2200, 4, "public", "foo_1_prt_2")
+			mock.ExpectQuery(`HAVING sum\(pg_relation_size\(pr.parchildrelid\)\) > 1024`).WillReturnRows(fakeRows)
+			leaves := backup.GetPartitionLeavesLargerThan(connectionPool, []backup.Relation{{Oid: 1, Schema: "public", Name: "foo"}}, 1024)
+			Expect(leaves).To(Equal([]backup.PartitionLeaf{
+				{RootOid: 1, Relation: backup.Relation{SchemaOid: 2200, Oid: 3, Schema: "public", Name: "foo_1_prt_1"}},
+				{RootOid: 1, Relation: backup.Relation{SchemaOid: 2200, Oid: 4, Schema: "public", Name: "foo_1_prt_2"}},
+			}))
+		})
+		It("does not query the database when there are no relations", func() {
+			Expect(backup.GetPartitionLeavesLargerThan(connectionPool, []backup.Relation{}, 1024)).To(BeEmpty())
+		})
+	})
+	Describe("FilterRelationsBySize", func() {
+		small := backup.Relation{Oid: 1, Schema: "public", Name: "small"}
+		medium := backup.Relation{Oid: 2, Schema: "public", Name: "medium"}
+		large := backup.Relation{Oid: 3, Schema: "public", Name: "large"}
+		relationSizes := map[uint32]int64{1: 10, 2: 100, 3: 1000}
+		It("skips relations larger than the maximum size", func() {
+			included, skipped := backup.FilterRelationsBySize([]backup.Relation{small, medium, large}, relationSizes, 100)
+			Expect(included).To(Equal([]backup.Relation{small, medium}))
+			Expect(skipped).To(Equal([]backup.Relation{large}))
+		})
+		It("skips no relations when all are within the maximum size", func() {
+			included, skipped := backup.FilterRelationsBySize([]backup.Relation{small, medium, large}, relationSizes, 1000)
+			Expect(included).To(Equal([]backup.Relation{small, medium, large}))
+			Expect(skipped).To(BeEmpty())
+		})
+		It("includes relations with no known size", func() {
+			unknown := backup.Relation{Oid: 4, Schema: "public", Name: "unknown"}
+			included, skipped := backup.FilterRelationsBySize([]backup.Relation{unknown}, relationSizes, 0)
+			Expect(included).To(Equal([]backup.Relation{unknown}))
+			Expect(skipped).To(BeEmpty())
+		})
+	})
 	Describe("GetAllViews", func() {
 		It("GetAllViews properly handles NULL view definitions", func() {
 			header := []string{"oid", "schema", "name", "options", "definition", "tablespace", "ismaterialized"}
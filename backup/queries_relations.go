@@ -151,6 +151,191 @@ func GetForeignTableRelations(connectionPool *dbconn.DBConn) []Relation {
 	return results
 }
 
+/*
+ * Returns the on-disk size of each of the given relations.  Unless leaf
+ * partitions are being backed up separately, the size of a partition root
+ * includes the sizes of all of its child partitions, as their data is backed
+ * up together with the root.
+ */
+func GetRelationSizes(connectionPool *dbconn.DBConn, relations []Relation) map[uint32]int64 {
+	relationSizes := make(map[uint32]int64)
+	if len(relations) == 0 {
+		return relationSizes
+	}
+	oids := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		oids = append(oids, fmt.Sprintf("%d", relation.Oid))
+	}
+
+	childPartitionSize := ""
+	if !MustGetFlagBool(options.LEAF_PARTITION_DATA) {
+		childPartitionSize = `
+		+ coalesce((SELECT sum(pg_relation_size(r.parchildrelid))
+			FROM pg_partition p
+				JOIN pg_partition_rule r ON p.oid = r.paroid
+			WHERE p.parrelid = c.oid
+				AND p.paristemplate = false), 0)`
+	}
+	query := fmt.Sprintf(`
+	SELECT c.oid AS oid,
+		pg_relation_size(c.oid)%s AS size
+	FROM pg_class c
+	WHERE c.oid IN (%s)`, childPartitionSize, strings.Join(oids, ", "))
+
+	results := make([]struct {
+		Oid  uint32
+		Size int64
+	}, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	for _, result := range results {
+		relationSizes[result.Oid] = result.Size
+	}
+	return relationSizes
+}
+
+/*
+ * Returns the number of lock requests waiting on each of the given relations,
+ * on the master and segments, for the relations with any.
+ */
+func GetRelationLockWaiters(connectionPool *dbconn.DBConn, relations []Relation) map[uint32]int64 {
+	lockWaiters := make(map[uint32]int64)
+	if len(relations) == 0 {
+		return lockWaiters
+	}
+	oids := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		oids = append(oids, fmt.Sprintf("%d", relation.Oid))
+	}
+	query := fmt.Sprintf(`
+	SELECT l.relation AS oid,
+		count(*) AS waiters
+	FROM pg_locks l
+	WHERE l.locktype = 'relation'
+		AND NOT l.granted
+		AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+		AND l.relation IN (%s)
+	GROUP BY l.relation`, strings.Join(oids, ", "))
+
+	results := make([]struct {
+		Oid     uint32
+		Waiters int64
+	}, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	for _, result := range results {
+		lockWaiters[result.Oid] = result.Waiters
+	}
+	return lockWaiters
+}
+
+/*
+ * Returns the total on-disk size of the given relations on each segment,
+ * keyed by content, including child partitions as GetRelationSizes does.
+ */
+func GetSegmentRelationSizes(connectionPool *dbconn.DBConn, relations []Relation) map[int]int64 {
+	segmentSizes := make(map[int]int64)
+	if len(relations) == 0 {
+		return segmentSizes
+	}
+	oids := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		oids = append(oids, fmt.Sprintf("%d", relation.Oid))
+	}
+	oidList := strings.Join(oids, ", ")
+
+	childPartitions := ""
+	if !MustGetFlagBool(options.LEAF_PARTITION_DATA) {
+		childPartitions = fmt.Sprintf(`
+		OR c.oid IN (SELECT r.parchildrelid
+			FROM pg_partition p
+				JOIN pg_partition_rule r ON p.oid = r.paroid
+			WHERE p.parrelid IN (%s)
+				AND p.paristemplate = false)`, oidList)
+	}
+	query := fmt.Sprintf(`
+	SELECT c.gp_segment_id AS contentid,
+		sum(pg_relation_size(c.oid)) AS size
+	FROM gp_dist_random('pg_class') c
+	WHERE c.oid IN (%s)%s
+	GROUP BY c.gp_segment_id`, oidList, childPartitions)
+
+	results := make([]struct {
+		ContentID int
+		Size      int64
+	}, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	for _, result := range results {
+		segmentSizes[result.ContentID] = result.Size
+	}
+	return segmentSizes
+}
+
+type PartitionLeaf struct {
+	RootOid uint32
+	Relation
+}
+
+/*
+ * Returns the non-external leaf partitions of those of the given relations
+ * that are partitioned tables larger than the threshold in bytes.
+ */
+func GetPartitionLeavesLargerThan(connectionPool *dbconn.DBConn, relations []Relation, threshold int64) []PartitionLeaf {
+	if len(relations) == 0 {
+		return []PartitionLeaf{}
+	}
+	oids := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		oids = append(oids, fmt.Sprintf("%d", relation.Oid))
+	}
+	query := fmt.Sprintf(`
+	SELECT p.parrelid AS rootoid,
+		n.oid AS schemaoid,
+		c.oid AS oid,
+		quote_ident(n.nspname) AS schema,
+		quote_ident(c.relname) AS name
+	FROM pg_partition p
+		JOIN pg_partition_rule r ON p.oid = r.paroid
+		JOIN pg_class c ON c.oid = r.parchildrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_exttable e ON e.reloid = c.oid
+	WHERE p.parrelid IN (%s)
+		AND p.paristemplate = false
+		AND p.parlevel = (SELECT max(parlevel) FROM pg_partition WHERE parrelid = p.parrelid)
+		AND e.reloid IS NULL
+		AND p.parrelid IN (
+			SELECT pp.parrelid
+			FROM pg_partition pp
+				JOIN pg_partition_rule pr ON pp.oid = pr.paroid
+			WHERE pp.paristemplate = false
+			GROUP BY pp.parrelid
+			HAVING sum(pg_relation_size(pr.parchildrelid)) > %d)
+	ORDER BY c.oid`, strings.Join(oids, ", "), threshold)
+
+	results := make([]PartitionLeaf, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	return results
+}
+
+/*
+ * Splits relations into those at or below the maximum size, which will be
+ * backed up, and those above it, which will be skipped.
+ */
+func FilterRelationsBySize(relations []Relation, relationSizes map[uint32]int64, maxSize int64) ([]Relation, []Relation) {
+	includedRelations := make([]Relation, 0)
+	skippedRelations := make([]Relation, 0)
+	for _, relation := range relations {
+		if relationSizes[relation.Oid] > maxSize {
+			skippedRelations = append(skippedRelations, relation)
+		} else {
+			includedRelations = append(includedRelations, relation)
+		}
+	}
+	return includedRelations, skippedRelations
+}
+
 type Sequence struct {
 	Relation
 	OwningTableOid    string
@@ -365,37 +550,108 @@ func GetAllViews(connectionPool *dbconn.DBConn) []View {
 // dumping part but it also makes the main worker thread (worker 0) the
 // most resilient for the later data dumping logic. Locks will still be
 // taken for --data-only calls.
-func LockTables(connectionPool *dbconn.DBConn, tables []Relation) {
+//
+// With a lockTimeout in seconds, a batch that cannot be locked within the
+// timeout fails the backup, unless skipLockedTables is set, in which case the
+// tables of the batch are locked one at a time and those that still cannot be
+// locked are returned separately to be left out of the backup.
+func LockTables(connectionPool *dbconn.DBConn, tables []Relation, lockTimeout int, skipLockedTables bool) ([]Relation, []Relation) {
 	gplog.Info("Acquiring ACCESS SHARE locks on tables")
 
 	progressBar := utils.NewProgressBar(len(tables), "Locks acquired: ", utils.PB_VERBOSE)
 	progressBar.Start()
 
+	if lockTimeout > 0 {
+		setLockTimeout(connectionPool, lockTimeout)
+	}
+
 	const batchSize = 100
-	lastBatchSize := len(tables) % batchSize
 	tableBatches := GenerateTableBatches(tables, batchSize)
-	currentBatchSize := batchSize
+	lockedTables := make([]Relation, 0, len(tables))
+	skippedTables := make([]Relation, 0)
 
 	// The LOCK TABLE query could block if someone else is holding an
 	// AccessExclusiveLock on the table.  In the case gpbackup is interrupted,
 	// cancelBlockedQueries() will cancel these queries during cleanup.
 	for i, currentBatch := range tableBatches {
-		_, err := connectionPool.Exec(fmt.Sprintf("LOCK TABLE %s IN ACCESS SHARE MODE", currentBatch))
-		if err != nil {
-			if wasTerminated {
-				gplog.Warn("Interrupt received while acquiring ACCESS SHARE locks on tables")
-				select {} // wait for cleanup thread to exit gpbackup
-			} else {
-				gplog.FatalOnError(err)
-			}
+		batchEnd := (i + 1) * batchSize
+		if batchEnd > len(tables) {
+			batchEnd = len(tables)
 		}
-		if i == len(tableBatches)-1 && lastBatchSize > 0 {
-			currentBatchSize = lastBatchSize
+		batchTables := tables[i*batchSize : batchEnd]
+		err := lockTableBatch(connectionPool, currentBatch, skipLockedTables)
+		if err == nil {
+			lockedTables = append(lockedTables, batchTables...)
+		} else if skipLockedTables && isLockTimeoutError(err) {
+			gplog.Verbose("Timed out acquiring locks on a batch of %d tables, locking them one at a time", len(batchTables))
+			for _, table := range batchTables {
+				err = lockTableBatch(connectionPool, table.FQN(), true)
+				if err == nil {
+					lockedTables = append(lockedTables, table)
+				} else if isLockTimeoutError(err) {
+					gplog.Warn("Could not acquire ACCESS SHARE lock on table %s within %d seconds, skipping it", table.FQN(), lockTimeout)
+					skippedTables = append(skippedTables, table)
+				} else {
+					handleLockTablesError(err, lockTimeout)
+				}
+			}
+		} else {
+			handleLockTablesError(err, lockTimeout)
 		}
-		progressBar.Add(currentBatchSize)
+		progressBar.Add(len(batchTables))
+	}
+	if lockTimeout > 0 {
+		setLockTimeout(connectionPool, 0)
 	}
 
 	progressBar.Finish()
+	return lockedTables, skippedTables
+}
+
+/*
+ * lock_timeout was added in GPDB 6, so statement_timeout, which also limits
+ * how long a LOCK TABLE statement waits, is used for earlier versions.
+ */
+func setLockTimeout(connectionPool *dbconn.DBConn, lockTimeout int) {
+	timeoutGUC := "statement_timeout"
+	if connectionPool.Version.AtLeast("6") {
+		timeoutGUC = "lock_timeout"
+	}
+	connectionPool.MustExec(fmt.Sprintf("SET %s = %d", timeoutGUC, lockTimeout*1000))
+}
+
+/*
+ * Worker 0 is inside the backup transaction, which a failed LOCK TABLE would
+ * abort, so a savepoint is rolled back to when locks may be skipped.
+ */
+func lockTableBatch(connectionPool *dbconn.DBConn, batch string, useSavepoint bool) error {
+	if !useSavepoint {
+		_, err := connectionPool.Exec(fmt.Sprintf("LOCK TABLE %s IN ACCESS SHARE MODE", batch))
+		return err
+	}
+	connectionPool.MustExec("SAVEPOINT gpbackup_lock_tables")
+	_, err := connectionPool.Exec(fmt.Sprintf("LOCK TABLE %s IN ACCESS SHARE MODE", batch))
+	if err != nil {
+		connectionPool.MustExec("ROLLBACK TO SAVEPOINT gpbackup_lock_tables")
+		return err
+	}
+	connectionPool.MustExec("RELEASE SAVEPOINT gpbackup_lock_tables")
+	return nil
+}
+
+func isLockTimeoutError(err error) bool {
+	return strings.Contains(err.Error(), "lock timeout") || strings.Contains(err.Error(), "statement timeout")
+}
+
+func handleLockTablesError(err error, lockTimeout int) {
+	if wasTerminated {
+		gplog.Warn("Interrupt received while acquiring ACCESS SHARE locks on tables")
+		select {} // wait for cleanup thread to exit gpbackup
+	}
+	if isLockTimeoutError(err) {
+		gplog.Fatal(errors.Errorf("Could not acquire ACCESS SHARE locks on tables within %d seconds.  Use --skip-locked-tables to back up the database without the tables that cannot be locked.", lockTimeout), "")
+	}
+	gplog.FatalOnError(err)
 }
 
 // GenerateTableBatches batches tables to reduce network congestion and
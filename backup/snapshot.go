@@ -0,0 +1,119 @@
+package backup
+
+/*
+ * This file contains functions for sharing one snapshot between the
+ * connections of a backup, so that the data copied by each worker with --jobs
+ * is from the same committed state of the database.
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/pkg/errors"
+)
+
+const (
+	ISOLATION_SERIALIZABLE    = "serializable"
+	ISOLATION_REPEATABLE_READ = "repeatable-read"
+)
+
+func ValidateIsolationLevel(isolationLevel string) error {
+	if isolationLevel != ISOLATION_SERIALIZABLE && isolationLevel != ISOLATION_REPEATABLE_READ {
+		return errors.Errorf("Invalid isolation level '%s'.  Valid values are 'serializable' and 'repeatable-read'.", isolationLevel)
+	}
+	return nil
+}
+
+func GetIsolationLevelSQL(isolationLevel string) string {
+	return strings.ToUpper(strings.Replace(isolationLevel, "-", " ", -1))
+}
+
+/*
+ * An exported snapshot only covers the segments as well as the master from
+ * GPDB 7 on, so earlier versions keep taking a snapshot per connection.
+ */
+func UseSynchronizedSnapshot(connectionPool *dbconn.DBConn, disabled bool) bool {
+	if disabled || connectionPool.NumConns < 2 {
+		return false
+	}
+	if connectionPool.Version.Before("7") {
+		gplog.Verbose("GPDB version %s cannot share a snapshot between connections, so each connection will take its own snapshot", connectionPool.Version.VersionString)
+		return false
+	}
+	return true
+}
+
+/*
+ * The snapshot stays valid for as long as the transaction of the exporting
+ * connection is open, which is the whole backup for connection 0.
+ */
+func ExportSnapshot(connectionPool *dbconn.DBConn) string {
+	snapshotID := dbconn.MustSelectString(connectionPool, "SELECT pg_export_snapshot() AS string", 0)
+	gplog.Verbose("Exported snapshot %s to be shared by all connections", snapshotID)
+	return snapshotID
+}
+
+/*
+ * Must be run right after the transaction begins, before it runs any query.
+ */
+func ImportSnapshot(connectionPool *dbconn.DBConn, snapshotID string, connNum int) {
+	connectionPool.MustExec(fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", snapshotID), connNum)
+}
+
+/*
+ * Returns the snapshot of the transaction on the coordinator, which is the
+ * same for transactions in different databases if no transaction committed
+ * between them.
+ */
+func GetTransactionSnapshot(connectionPool *dbconn.DBConn, whichConn ...int) string {
+	return dbconn.MustSelectString(connectionPool, "SELECT txid_current_snapshot()::text AS string", whichConn...)
+}
+
+/*
+ * A snapshot cannot be imported into a different database, so for
+ * --consistent-snapshot a transaction is begun in each database and its
+ * snapshot exported for the backup of that database.  The snapshots are only
+ * of the same point in time if no transaction committed while they were
+ * taken, so they are taken again until the transaction snapshots match.
+ * Returns the exported snapshot of each connection and the shared
+ * transaction snapshot.
+ */
+func TakeConsistentSnapshot(conns []*dbconn.DBConn, maxAttempts int) ([]string, string, error) {
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		for _, conn := range conns {
+			err := conn.Begin()
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		// The snapshots are taken by the first query of each transaction
+		txSnapshots := make([]string, len(conns))
+		for i, conn := range conns {
+			txSnapshots[i] = GetTransactionSnapshot(conn)
+		}
+		if SnapshotsMatch(txSnapshots) {
+			snapshotIDs := make([]string, len(conns))
+			for i, conn := range conns {
+				snapshotIDs[i] = dbconn.MustSelectString(conn, "SELECT pg_export_snapshot() AS string")
+			}
+			return snapshotIDs, txSnapshots[0], nil
+		}
+		gplog.Verbose("Transactions committed while the snapshots of the databases were taken (attempt %d of %d)", attempt, maxAttempts)
+		for _, conn := range conns {
+			conn.MustRollback()
+		}
+	}
+	return nil, "", errors.Errorf("Unable to take a consistent snapshot of the databases in %d attempts, as transactions kept committing while the snapshots were taken", maxAttempts)
+}
+
+func SnapshotsMatch(txSnapshots []string) bool {
+	for _, txSnapshot := range txSnapshots {
+		if txSnapshot != txSnapshots[0] {
+			return false
+		}
+	}
+	return true
+}
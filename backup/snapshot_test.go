@@ -0,0 +1,113 @@
+package backup_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/snapshot tests", func() {
+	var numConns int
+	BeforeEach(func() {
+		numConns = connectionPool.NumConns
+		connectionPool.NumConns = 2
+	})
+	AfterEach(func() {
+		connectionPool.NumConns = numConns
+	})
+	Describe("UseSynchronizedSnapshot", func() {
+		It("shares a snapshot between multiple connections on GPDB 7", func() {
+			testhelper.SetDBVersion(connectionPool, "7.0.0")
+			Expect(backup.UseSynchronizedSnapshot(connectionPool, false)).To(BeTrue())
+		})
+		It("does not share a snapshot when disabled", func() {
+			testhelper.SetDBVersion(connectionPool, "7.0.0")
+			Expect(backup.UseSynchronizedSnapshot(connectionPool, true)).To(BeFalse())
+		})
+		It("does not share a snapshot with a single connection", func() {
+			testhelper.SetDBVersion(connectionPool, "7.0.0")
+			connectionPool.NumConns = 1
+			Expect(backup.UseSynchronizedSnapshot(connectionPool, false)).To(BeFalse())
+		})
+		It("does not share a snapshot before GPDB 7", func() {
+			testhelper.SetDBVersion(connectionPool, "6.0.0")
+			Expect(backup.UseSynchronizedSnapshot(connectionPool, false)).To(BeFalse())
+		})
+	})
+	Describe("ValidateIsolationLevel", func() {
+		It("accepts the valid isolation levels", func() {
+			Expect(backup.ValidateIsolationLevel("serializable")).To(Succeed())
+			Expect(backup.ValidateIsolationLevel("repeatable-read")).To(Succeed())
+		})
+		It("rejects an invalid isolation level", func() {
+			Expect(backup.ValidateIsolationLevel("read-committed")).To(MatchError("Invalid isolation level 'read-committed'.  Valid values are 'serializable' and 'repeatable-read'."))
+		})
+	})
+	Describe("GetIsolationLevelSQL", func() {
+		It("returns the isolation level as written in SQL", func() {
+			Expect(backup.GetIsolationLevelSQL("serializable")).To(Equal("SERIALIZABLE"))
+			Expect(backup.GetIsolationLevelSQL("repeatable-read")).To(Equal("REPEATABLE READ"))
+		})
+	})
+	Describe("ExportSnapshot", func() {
+		It("returns the identifier of the exported snapshot", func() {
+			mock.ExpectQuery(`SELECT pg_export_snapshot\(\)`).WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow("00000003-0000001B-1"))
+			Expect(backup.ExportSnapshot(connectionPool)).To(Equal("00000003-0000001B-1"))
+		})
+	})
+	Describe("ImportSnapshot", func() {
+		It("sets the snapshot of the transaction", func() {
+			mock.ExpectExec(`SET TRANSACTION SNAPSHOT '00000003-0000001B-1'`).WillReturnResult(sqlmock.NewResult(0, 0))
+			backup.ImportSnapshot(connectionPool, "00000003-0000001B-1", 0)
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
+	Describe("TakeConsistentSnapshot", func() {
+		var (
+			conns []*dbconn.DBConn
+			mocks []sqlmock.Sqlmock
+		)
+		BeforeEach(func() {
+			conns = make([]*dbconn.DBConn, 2)
+			mocks = make([]sqlmock.Sqlmock, 2)
+			for i := range conns {
+				conns[i], mocks[i] = testhelper.CreateAndConnectMockDB(1)
+			}
+		})
+		expectSnapshot := func(dbMock sqlmock.Sqlmock, txSnapshot string) {
+			dbMock.ExpectBegin()
+			dbMock.ExpectExec("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE").WillReturnResult(sqlmock.NewResult(0, 0))
+			dbMock.ExpectQuery(`SELECT txid_current_snapshot\(\)`).WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow(txSnapshot))
+		}
+		It("exports the snapshot of each database once the snapshots match", func() {
+			expectSnapshot(mocks[0], "100:104:101")
+			expectSnapshot(mocks[1], "100:105:101")
+			mocks[0].ExpectRollback()
+			mocks[1].ExpectRollback()
+			expectSnapshot(mocks[0], "100:105:101")
+			expectSnapshot(mocks[1], "100:105:101")
+			mocks[0].ExpectQuery(`SELECT pg_export_snapshot\(\)`).WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow("00000003-0000001B-1"))
+			mocks[1].ExpectQuery(`SELECT pg_export_snapshot\(\)`).WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow("00000004-0000001C-1"))
+
+			snapshotIDs, sharedSnapshot, err := backup.TakeConsistentSnapshot(conns, 3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshotIDs).To(Equal([]string{"00000003-0000001B-1", "00000004-0000001C-1"}))
+			Expect(sharedSnapshot).To(Equal("100:105:101"))
+			Expect(mocks[0].ExpectationsWereMet()).To(Succeed())
+			Expect(mocks[1].ExpectationsWereMet()).To(Succeed())
+		})
+		It("returns an error if the snapshots never match", func() {
+			expectSnapshot(mocks[0], "100:104:101")
+			expectSnapshot(mocks[1], "100:105:101")
+			mocks[0].ExpectRollback()
+			mocks[1].ExpectRollback()
+
+			_, _, err := backup.TakeConsistentSnapshot(conns, 1)
+			Expect(err).To(MatchError("Unable to take a consistent snapshot of the databases in 1 attempts, as transactions kept committing while the snapshots were taken"))
+		})
+	})
+})
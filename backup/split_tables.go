@@ -0,0 +1,105 @@
+package backup
+
+/*
+ * This file contains functions for --split-table-data-larger-than, which
+ * copies the data of a large non-partitioned table with several concurrent
+ * COPY statements, each writing its own data file on every segment, so that
+ * one large table does not keep the backup running on a single connection
+ * after the other tables are done.
+ */
+
+import (
+	"fmt"
+	"sync"
+)
+
+/*
+ * A task backs up the data of a table or, for a split table, the data of one
+ * of its streams.  NumStreams is 1 for tables that are not split.
+ */
+type DataCopyTask struct {
+	Table
+	Stream     int
+	NumStreams int
+}
+
+/*
+ * Returns the number of streams of each table whose data is split, which are
+ * the tables larger than the threshold that are not partitioned.  Each stream
+ * needs its own connection to run concurrently, so tables are not split into
+ * more streams than there are connections.
+ */
+func GetSplitTables(tables []Table, sizes map[uint32]int64, threshold int64, numStreams int, numConns int) map[uint32]int {
+	splitTables := make(map[uint32]int)
+	if numStreams > numConns {
+		numStreams = numConns
+	}
+	if numStreams < 2 {
+		return splitTables
+	}
+	for _, table := range tables {
+		level := table.PartitionLevelInfo.Level
+		if table.SkipDataBackup() || level == "p" || level == "i" || sizes[table.Oid] <= threshold {
+			continue
+		}
+		splitTables[table.Oid] = numStreams
+	}
+	return splitTables
+}
+
+/*
+ * Returns a task for each table, or for each stream of a split table, with
+ * the streams of a table next to each other so that they are taken up by
+ * different connections at about the same time.
+ */
+func GetDataCopyTasks(tables []Table, splitTables map[uint32]int) []DataCopyTask {
+	tasks := make([]DataCopyTask, 0, len(tables))
+	for _, table := range tables {
+		numStreams := splitTables[table.Oid]
+		if numStreams < 2 {
+			tasks = append(tasks, DataCopyTask{Table: table, NumStreams: 1})
+			continue
+		}
+		for stream := 0; stream < numStreams; stream++ {
+			tasks = append(tasks, DataCopyTask{Table: table, Stream: stream, NumStreams: numStreams})
+		}
+	}
+	return tasks
+}
+
+/*
+ * Each stream copies the rows in every numStreams-th block of the table on
+ * each segment.  As all connections share one snapshot, every row is in the
+ * same block for every stream and so is copied by exactly one stream.
+ */
+func SplitTableStreamCondition(stream int, numStreams int) string {
+	return fmt.Sprintf("(ctid::text::point)[0]::bigint %% %d = %d", numStreams, stream)
+}
+
+/*
+ * Tracks the streams of each split table that are not yet backed up, so that
+ * a split table is only counted as backed up once all of its streams are.
+ */
+type splitTableProgress struct {
+	mutex     sync.Mutex
+	remaining map[uint32]int
+}
+
+func newSplitTableProgress(splitTables map[uint32]int) *splitTableProgress {
+	remaining := make(map[uint32]int, len(splitTables))
+	for oid, numStreams := range splitTables {
+		remaining[oid] = numStreams
+	}
+	return &splitTableProgress{remaining: remaining}
+}
+
+/*
+ * Records that one stream of the table is backed up, and returns whether it
+ * was the last one.
+ */
+func (progress *splitTableProgress) finishStream(oid uint32) bool {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	progress.remaining[oid]--
+	return progress.remaining[oid] == 0
+}
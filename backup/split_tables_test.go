@@ -0,0 +1,50 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/split_tables tests", func() {
+	large := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "large"}}
+	small := backup.Table{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "small"}}
+	leaf := backup.Table{Relation: backup.Relation{Oid: 3, Schema: "public", Name: "leaf"},
+		TableDefinition: backup.TableDefinition{PartitionLevelInfo: backup.PartitionLevelInfo{Level: "l"}}}
+	parent := backup.Table{Relation: backup.Relation{Oid: 4, Schema: "public", Name: "parent"},
+		TableDefinition: backup.TableDefinition{PartitionLevelInfo: backup.PartitionLevelInfo{Level: "p"}}}
+	external := backup.Table{Relation: backup.Relation{Oid: 5, Schema: "public", Name: "external"},
+		TableDefinition: backup.TableDefinition{IsExternal: true}}
+	sizes := map[uint32]int64{1: 2000, 2: 10, 3: 2000, 4: 4000, 5: 2000}
+
+	Describe("GetSplitTables", func() {
+		It("splits the tables larger than the threshold that are not partitioned", func() {
+			splitTables := backup.GetSplitTables([]backup.Table{large, small, leaf, parent, external}, sizes, 1000, 4, 8)
+			Expect(splitTables).To(Equal(map[uint32]int{1: 4, 3: 4}))
+		})
+		It("does not split tables into more streams than there are connections", func() {
+			splitTables := backup.GetSplitTables([]backup.Table{large}, sizes, 1000, 4, 3)
+			Expect(splitTables).To(Equal(map[uint32]int{1: 3}))
+		})
+		It("does not split tables with a single connection", func() {
+			splitTables := backup.GetSplitTables([]backup.Table{large}, sizes, 1000, 4, 1)
+			Expect(splitTables).To(BeEmpty())
+		})
+	})
+	Describe("GetDataCopyTasks", func() {
+		It("returns a task for each stream of a split table and for each other table", func() {
+			tasks := backup.GetDataCopyTasks([]backup.Table{large, small}, map[uint32]int{1: 2})
+			Expect(tasks).To(Equal([]backup.DataCopyTask{
+				{Table: large, Stream: 0, NumStreams: 2},
+				{Table: large, Stream: 1, NumStreams: 2},
+				{Table: small, Stream: 0, NumStreams: 1},
+			}))
+		})
+	})
+	Describe("SplitTableStreamCondition", func() {
+		It("selects the rows in the blocks of the stream", func() {
+			Expect(backup.SplitTableStreamCondition(2, 4)).To(Equal("(ctid::text::point)[0]::bigint % 4 = 2"))
+		})
+	})
+})
@@ -0,0 +1,31 @@
+package backup
+
+/*
+ * This file contains functions for --status, which prints the progress of a
+ * running backup from the status file that it keeps up to date.
+ */
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+func DoStatus() {
+	SetLoggerVerbosity()
+	timestamp := MustGetFlagString(options.STATUS)
+	// Sets globalCluster, from which the master data directory is found
+	getMasterFPInfo(MustGetFlagString(options.DBNAME))
+	segPrefix, err := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), timestamp)
+	gplog.FatalOnError(err)
+	fpInfo := filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), timestamp, segPrefix)
+
+	status, err := utils.ReadRunStatus(fpInfo.GetBackupStatusFilePath())
+	gplog.FatalOnError(err)
+	fmt.Fprint(operating.System.Stdout, utils.FormatRunStatus(status, time.Now()))
+}
@@ -0,0 +1,131 @@
+package backup
+
+/*
+ * This file contains structs and functions for --table-timings, which records
+ * how long the data of each table took to back up, for capacity planning and
+ * to find the tables that slow backups down.
+ */
+
+import (
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+type tableTiming struct {
+	table    string
+	lockWait time.Duration
+	start    time.Time
+	end      time.Time
+	rows     int64
+}
+
+/*
+ * Collects the timings recorded by the data workers.  The streams of a split
+ * table are combined into one timing, from the start of the first stream to
+ * the end of the last.  All methods may be called on a nil recorder.
+ */
+type TableTimingRecorder struct {
+	mutex   sync.Mutex
+	timings map[uint32]*tableTiming
+}
+
+func NewTableTimingRecorder() *TableTimingRecorder {
+	return &TableTimingRecorder{timings: make(map[uint32]*tableTiming)}
+}
+
+func (recorder *TableTimingRecorder) getTiming(table Table) *tableTiming {
+	timing, ok := recorder.timings[table.Oid]
+	if !ok {
+		timing = &tableTiming{table: table.FQN()}
+		recorder.timings[table.Oid] = timing
+	}
+	return timing
+}
+
+func (recorder *TableTimingRecorder) RecordLockWait(table Table, lockWait time.Duration) {
+	if recorder == nil {
+		return
+	}
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.getTiming(table).lockWait += lockWait
+}
+
+func (recorder *TableTimingRecorder) RecordCopy(table Table, start time.Time, end time.Time, rows int64) {
+	if recorder == nil {
+		return
+	}
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	timing := recorder.getTiming(table)
+	if timing.start.IsZero() || start.Before(timing.start) {
+		timing.start = start
+	}
+	if end.After(timing.end) {
+		timing.end = end
+	}
+	timing.rows += rows
+}
+
+/*
+ * Returns the timing of each table whose data was copied.  The compression
+ * ratio is the size of the table on disk over the size of its data files, and
+ * is only set for tables whose data file sizes are known.
+ */
+func (recorder *TableTimingRecorder) Timings(sizes map[uint32]int64, fileSizes map[uint32]int64) []report.TableTiming {
+	timings := make([]report.TableTiming, 0)
+	if recorder == nil {
+		return timings
+	}
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	for oid, timing := range recorder.timings {
+		if timing.start.IsZero() {
+			continue
+		}
+		result := report.TableTiming{
+			Table:        timing.table,
+			LockWait:     timing.lockWait,
+			CopyDuration: timing.end.Sub(timing.start),
+			Bytes:        sizes[oid],
+			Rows:         timing.rows,
+		}
+		if fileSize := fileSizes[oid]; fileSize > 0 && sizes[oid] > 0 {
+			result.CompressionRatio = float64(sizes[oid]) / float64(fileSize)
+		}
+		timings = append(timings, result)
+	}
+	return timings
+}
+
+/*
+ * The sizes of the data files can only be checked for backups that write one
+ * file per table to the backup directories.
+ */
+func writeTableTimings() {
+	if tableTimings == nil {
+		return
+	}
+	var fileSizes map[uint32]int64
+	if isResumableBackup() && !MustGetFlagBool(options.DEDUP) {
+		var err error
+		fileSizes, err = utils.GetDataFileSizesOnSegments(globalCluster, globalFPInfo)
+		if err != nil {
+			gplog.Verbose("Unable to get the sizes of data files for the table timings: %v", err)
+		}
+	}
+	timings := tableTimings.Timings(tableSizes, fileSizes)
+	backupReport.TableTimings = timings
+	timingsFilename := globalFPInfo.GetBackupTableTimingsFilePath()
+	err := report.WriteTableTimingsFile(timingsFilename, timings)
+	if err != nil {
+		gplog.Warn("Unable to write table timings to %s: %v", timingsFilename, err)
+		return
+	}
+	gplog.Info("Table timings written to %s", timingsFilename)
+}
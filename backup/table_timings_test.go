@@ -0,0 +1,43 @@
+package backup_test
+
+import (
+	"time"
+
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/report"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/table_timings tests", func() {
+	table := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "foo"}}
+	start := time.Date(2017, 1, 1, 1, 1, 1, 0, time.Local)
+
+	Describe("TableTimingRecorder", func() {
+		It("combines the streams of a table into one timing", func() {
+			recorder := backup.NewTableTimingRecorder()
+			recorder.RecordLockWait(table, 100*time.Millisecond)
+			recorder.RecordCopy(table, start.Add(time.Second), start.Add(3*time.Second), 10)
+			recorder.RecordLockWait(table, 50*time.Millisecond)
+			recorder.RecordCopy(table, start, start.Add(2*time.Second), 20)
+
+			timings := recorder.Timings(map[uint32]int64{1: 4000}, map[uint32]int64{1: 1000})
+			Expect(timings).To(Equal([]report.TableTiming{
+				{Table: "public.foo", LockWait: 150 * time.Millisecond, CopyDuration: 3 * time.Second, Bytes: 4000, Rows: 30, CompressionRatio: 4},
+			}))
+		})
+		It("leaves out tables whose data was not copied", func() {
+			recorder := backup.NewTableTimingRecorder()
+			recorder.RecordLockWait(table, 100*time.Millisecond)
+
+			Expect(recorder.Timings(map[uint32]int64{}, nil)).To(BeEmpty())
+		})
+		It("records nothing without a recorder", func() {
+			var recorder *backup.TableTimingRecorder
+			recorder.RecordCopy(table, start, start.Add(time.Second), 10)
+
+			Expect(recorder.Timings(map[uint32]int64{}, nil)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,509 @@
+package backup
+
+/*
+ * This file contains functions for --test-restore, which checks that a backup
+ * can be restored without restoring it: every data file is read back and
+ * decompressed on its segment, and every metadata statement is read and
+ * checked for completeness, so that a truncated or corrupted backup is found
+ * before it is needed.  With --verify-sample, only the data files of a sample
+ * of the tables are read, for backups too large to read in full.
+ */
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func DoTestRestore() {
+	SetLoggerVerbosity()
+	timestamp := MustGetFlagString(options.TEST_RESTORE)
+	fpInfo := getMasterFPInfo(MustGetFlagString(options.DBNAME))
+	backupHistory := readBackupHistory(fpInfo.GetBackupHistoryFilePath())
+	fpInfo = getBackupFPInfo(backupHistory, timestamp)
+
+	configFilename := fpInfo.GetConfigFilePath()
+	if !iohelper.FileExistsAndIsReadable(configFilename) {
+		gplog.Fatal(errors.Errorf("Backup %s not found in %s", timestamp, fpInfo.GetDirForContent(-1)), "")
+	}
+	backupConfig := history.ReadConfigFile(configFilename)
+	if backupConfig.Plugin != "" {
+		gplog.Fatal(errors.Errorf("Backup %s was taken with plugin %s; only backups in backup directories can be tested with --%s",
+			timestamp, backupConfig.Plugin, options.TEST_RESTORE), "")
+	}
+
+	sample := getVerifySample()
+	gplog.Info("Checking metadata of backup %s", timestamp)
+	failures := checkBackupMetadata(fpInfo, backupConfig)
+	if !backupConfig.MetadataOnly {
+		restorePlan := backupConfig.RestorePlan
+		if len(restorePlan) == 0 {
+			restorePlan = []history.RestorePlanEntry{{Timestamp: timestamp}}
+		}
+		for _, planEntry := range restorePlan {
+			planFPInfo := fpInfo
+			if planEntry.Timestamp != timestamp {
+				planFPInfo = getBackupFPInfo(backupHistory, planEntry.Timestamp)
+			}
+			gplog.Info("Checking data of backup %s", planEntry.Timestamp)
+			failures = append(failures, checkBackupData(planFPInfo, backupConfig, planEntry, sample)...)
+		}
+	}
+
+	fmt.Fprint(operating.System.Stdout, FormatVerifySample(sample))
+	fmt.Fprint(operating.System.Stdout, FormatTestRestoreResult(timestamp, failures))
+	if len(failures) > 0 {
+		gplog.Fatal(errors.Errorf("Backup %s cannot be restored", timestamp), "")
+	}
+}
+
+func FormatTestRestoreResult(timestamp string, failures []string) string {
+	if len(failures) == 0 {
+		return fmt.Sprintf("PASS: backup %s can be restored\n", timestamp)
+	}
+	result := fmt.Sprintf("FAIL: backup %s cannot be restored, with %d problems:\n", timestamp, len(failures))
+	for _, failure := range failures {
+		result += fmt.Sprintf("  %s\n", failure)
+	}
+	return result
+}
+
+// The data of the largest tables is always checked, as they hold most of the data
+const verifySampleLargestTables = 10
+
+/*
+ * The tables whose data files are checked with --verify-sample, chosen with
+ * a seed that is printed with them so that the same sample can be checked
+ * again with --verify-seed.
+ */
+type VerifySample struct {
+	Percent float64
+	Seed    int64
+	Total   int
+	Tables  []string
+}
+
+func ParseVerifySamplePercent(value string) (float64, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return 0, errors.Errorf("Invalid value '%s' for --%s.  The sample must be a percentage greater than 0%% and at most 100%%, such as '5%%'.", value, options.VERIFY_SAMPLE)
+	}
+	return percent, nil
+}
+
+func getVerifySample() *VerifySample {
+	if MustGetFlagString(options.VERIFY_SAMPLE) == "" {
+		return nil
+	}
+	percent, err := ParseVerifySamplePercent(MustGetFlagString(options.VERIFY_SAMPLE))
+	gplog.FatalOnError(err)
+	seed := int64(MustGetFlagInt(options.VERIFY_SEED))
+	if seed == 0 {
+		seed = operating.System.Now().UnixNano()
+	}
+	return &VerifySample{Percent: percent, Seed: seed}
+}
+
+/*
+ * Returns the largest tables and a random sample of the percentage of the
+ * other tables, in the order of the table of contents, and records them in
+ * the sample.  All of the tables are returned if there is no sample.
+ */
+func (sample *VerifySample) Choose(dataEntries []toc.MasterDataEntry) []toc.MasterDataEntry {
+	if sample == nil {
+		return dataEntries
+	}
+	bySize := make([]int, len(dataEntries))
+	for i := range bySize {
+		bySize[i] = i
+	}
+	sort.SliceStable(bySize, func(i, j int) bool {
+		return dataEntries[bySize[i]].Size > dataEntries[bySize[j]].Size
+	})
+	numLargest := verifySampleLargestTables
+	if numLargest > len(bySize) {
+		numLargest = len(bySize)
+	}
+	chosen := make(map[int]bool)
+	for _, i := range bySize[:numLargest] {
+		chosen[i] = true
+	}
+	others := make([]int, 0, len(dataEntries)-numLargest)
+	for i := range dataEntries {
+		if !chosen[i] {
+			others = append(others, i)
+		}
+	}
+	random := rand.New(rand.NewSource(sample.Seed))
+	random.Shuffle(len(others), func(i, j int) { others[i], others[j] = others[j], others[i] })
+	numSampled := int(math.Ceil(float64(len(others)) * sample.Percent / 100))
+	for _, i := range others[:numSampled] {
+		chosen[i] = true
+	}
+
+	sampledEntries := make([]toc.MasterDataEntry, 0, len(chosen))
+	for i, entry := range dataEntries {
+		if chosen[i] {
+			sampledEntries = append(sampledEntries, entry)
+			sample.Tables = append(sample.Tables, utils.MakeFQN(entry.Schema, entry.Name))
+		}
+	}
+	sample.Total += len(dataEntries)
+	return sampledEntries
+}
+
+func FormatVerifySample(sample *VerifySample) string {
+	if sample == nil {
+		return ""
+	}
+	result := fmt.Sprintf("Checked the data files of %d of %d tables, sampled with --%s %d:\n", len(sample.Tables), sample.Total, options.VERIFY_SEED, sample.Seed)
+	for _, table := range sample.Tables {
+		result += fmt.Sprintf("  %s\n", table)
+	}
+	return result
+}
+
+/*
+ * The globals file, if any, is only checked against the cluster section of
+ * the table of contents, and the statistics file, if any, against the
+ * statistics section; everything else is in the metadata file.
+ */
+func checkBackupMetadata(fpInfo filepath.FilePathInfo, backupConfig *history.BackupConfig) []string {
+	tocFilename := fpInfo.GetTOCFilePath()
+	if !iohelper.FileExistsAndIsReadable(tocFilename) {
+		return []string{fmt.Sprintf("Table of contents %s is missing", tocFilename)}
+	}
+	tocfile := toc.NewTOC(tocFilename)
+	metadataEntries := make([]toc.MetadataEntry, 0)
+	metadataEntries = append(metadataEntries, tocfile.GlobalEntries...)
+	metadataEntries = append(metadataEntries, tocfile.PredataEntries...)
+	metadataEntries = append(metadataEntries, tocfile.PostdataEntries...)
+
+	failures := checkMetadataFile(fpInfo.GetMetadataFilePath(), metadataEntries)
+	if backupConfig.GlobalsFile {
+		failures = append(failures, checkMetadataFile(fpInfo.GetGlobalsFilePath(), tocfile.ClusterEntries)...)
+	}
+	if backupConfig.WithStatistics {
+		failures = append(failures, checkMetadataFile(fpInfo.GetStatisticsFilePath(), tocfile.StatisticsEntries)...)
+	}
+	return failures
+}
+
+func checkMetadataFile(filename string, entries []toc.MetadataEntry) []string {
+	metadataFile, err := os.Open(filename)
+	if err != nil {
+		return []string{fmt.Sprintf("Metadata file %s cannot be read: %v", filename, err)}
+	}
+	defer metadataFile.Close()
+	fileInfo, err := metadataFile.Stat()
+	if err != nil {
+		return []string{fmt.Sprintf("Metadata file %s cannot be read: %v", filename, err)}
+	}
+	return CheckMetadataStatements(metadataFile, fileInfo.Size(), filename, entries)
+}
+
+/*
+ * Returns a description of each statement that lies outside of the metadata
+ * file, cannot be read, or is incomplete.
+ */
+func CheckMetadataStatements(metadataFile io.ReaderAt, fileSize int64, filename string, entries []toc.MetadataEntry) []string {
+	failures := make([]string, 0)
+	for _, entry := range entries {
+		object := entry.Name
+		if entry.Schema != "" {
+			object = entry.Schema + "." + entry.Name
+		}
+		if entry.EndByte < entry.StartByte || int64(entry.EndByte) > fileSize {
+			failures = append(failures, fmt.Sprintf("Statement for %s %s lies beyond the end of %s", entry.ObjectType, object, filename))
+			continue
+		}
+		contents := make([]byte, entry.EndByte-entry.StartByte)
+		_, err := metadataFile.ReadAt(contents, int64(entry.StartByte))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Statement for %s %s cannot be read from %s: %v", entry.ObjectType, object, filename, err))
+			continue
+		}
+		err = CheckStatementSyntax(string(contents))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Statement for %s %s in %s is invalid: %v", entry.ObjectType, object, filename, err))
+		}
+	}
+	return failures
+}
+
+/*
+ * Checks that a statement is complete: that its quoted strings, quoted
+ * identifiers, dollar-quoted bodies, comments, and parentheses are closed, and
+ * that it ends with a semicolon.  The statement is not parsed any further, as
+ * only the server can do that.
+ */
+func CheckStatementSyntax(statement string) error {
+	depth := 0
+	var last byte
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		switch {
+		case strings.HasPrefix(statement[i:], "--"):
+			end := strings.IndexByte(statement[i:], '\n')
+			if end == -1 {
+				i = len(statement)
+			} else {
+				i += end + 1
+			}
+			continue
+		case strings.HasPrefix(statement[i:], "/*"):
+			end := skipBlockComment(statement, i)
+			if end == -1 {
+				return errors.New("unterminated comment")
+			}
+			i = end
+			continue
+		case c == '\'':
+			// Backslashes only escape quotes in escape strings, E'...'
+			escapes := i > 0 && (statement[i-1] == 'E' || statement[i-1] == 'e') && (i < 2 || !isIdentifierByte(statement[i-2]))
+			end := skipQuoted(statement, i, '\'', escapes)
+			if end == -1 {
+				return errors.New("unterminated quoted string")
+			}
+			i, last = end, c
+			continue
+		case c == '"':
+			end := skipQuoted(statement, i, '"', false)
+			if end == -1 {
+				return errors.New("unterminated quoted identifier")
+			}
+			i, last = end, c
+			continue
+		case c == '$' && (i == 0 || !isIdentifierByte(statement[i-1])):
+			if tag := getDollarQuoteTag(statement[i:]); tag != "" {
+				end := strings.Index(statement[i+len(tag):], tag)
+				if end == -1 {
+					return errors.Errorf("unterminated dollar-quoted string %s", tag)
+				}
+				i, last = i+end+2*len(tag), c
+				continue
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return errors.New("unbalanced parentheses")
+			}
+		}
+		if !unicode.IsSpace(rune(c)) {
+			last = c
+		}
+		i++
+	}
+	if depth != 0 {
+		return errors.New("unbalanced parentheses")
+	}
+	if last != ';' {
+		return errors.New("missing terminating semicolon")
+	}
+	return nil
+}
+
+// Returns the index after the end of the comment, which may be nested
+func skipBlockComment(statement string, start int) int {
+	depth := 0
+	for i := start; i < len(statement)-1; i++ {
+		if strings.HasPrefix(statement[i:], "/*") {
+			depth++
+			i++
+		} else if strings.HasPrefix(statement[i:], "*/") {
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// Returns the index after the closing quote, where a doubled quote is escaped
+func skipQuoted(statement string, start int, quote byte, backslashEscapes bool) int {
+	for i := start + 1; i < len(statement); i++ {
+		if backslashEscapes && statement[i] == '\\' {
+			i++
+		} else if statement[i] == quote {
+			if i+1 < len(statement) && statement[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return -1
+}
+
+/*
+ * Returns the opening tag, such as $$ or $body$, if the string starts with a
+ * dollar quote, or "" if the dollar sign starts a parameter such as $1.
+ */
+func getDollarQuoteTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '$' {
+			return s[:i+1]
+		}
+		if !isIdentifierByte(s[i]) || (i == 1 && s[i] >= '0' && s[i] <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func checkBackupData(fpInfo filepath.FilePathInfo, backupConfig *history.BackupConfig, planEntry history.RestorePlanEntry, sample *VerifySample) []string {
+	tocFilename := fpInfo.GetTOCFilePath()
+	if !iohelper.FileExistsAndIsReadable(tocFilename) {
+		return []string{fmt.Sprintf("Table of contents %s is missing", tocFilename)}
+	}
+	tocfile := toc.NewTOC(tocFilename)
+	dataEntries := tocfile.DataEntries
+	if planEntry.TableFQNs != nil {
+		dataEntries = tocfile.GetDataEntriesMatching([]string{}, []string{}, []string{}, []string{}, planEntry.TableFQNs)
+	}
+	if len(dataEntries) == 0 {
+		return []string{}
+	}
+	if backupConfig.SingleDataFile {
+		if sample != nil {
+			gplog.Warn("The data of backup %s is in a single data file on each segment, which is checked in full", fpInfo.Timestamp)
+		}
+		return checkSingleDataFiles(fpInfo, backupConfig)
+	}
+	return checkTableDataFiles(fpInfo, backupConfig, sample.Choose(dataEntries))
+}
+
+/*
+ * Returns a line for each data file of the tables, giving its path, with the
+ * same placeholders for the segment as in COPY commands, and the command that
+ * decompresses it.
+ */
+func GetTestRestoreDataFileList(fpInfo filepath.FilePathInfo, backupConfig *history.BackupConfig, dataEntries []toc.MasterDataEntry) []string {
+	pipeThroughProgram := utils.NewPipeThroughProgram(backupConfig.Compressed, backupConfig.CompressionType, 1)
+	fpInfo.DataFiles = toc.GetDataFiles(dataEntries)
+	dataFiles := make([]string, 0, len(dataEntries))
+	for _, entry := range dataEntries {
+		program := pipeThroughProgram
+		if entry.Uncompressed {
+			program = utils.NewPipeThroughProgram(false, "", 0)
+		}
+		if backupConfig.Dedup {
+			// gpbackup_helper decompresses each chunk itself
+			dataFile := fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, filepath.DedupDataFileExtension, false)
+			dataFiles = append(dataFiles, fmt.Sprintf("%s cat -", dataFile))
+		} else if entry.Streams > 1 {
+			for stream := 0; stream < entry.Streams; stream++ {
+				dataFile := fpInfo.GetTableStreamBackupFilePathForCopyCommand(entry.Oid, stream, program.Extension)
+				dataFiles = append(dataFiles, fmt.Sprintf("%s %s", dataFile, program.InputCommand))
+			}
+		} else {
+			dataFile := fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, program.Extension, false)
+			dataFiles = append(dataFiles, fmt.Sprintf("%s %s", dataFile, program.InputCommand))
+		}
+	}
+	return dataFiles
+}
+
+/*
+ * Returns a command that reads and decompresses each data file in the list
+ * on the segment, discarding the data, and prints the path of each one that
+ * cannot be read or decompressed.  The list is removed afterwards.
+ */
+func GetTestRestoreDataCommand(listFile string, segDataDir string, contentID int, readCommand string) string {
+	return fmt.Sprintf(`set -o pipefail; sed -e 's|<SEG_DATA_DIR>|%s|g' -e 's|<SEGID>|%d|g' %s | `+
+		`while read -r datafile program; do (%s "$datafile" 2>/dev/null | $program > /dev/null 2>&1) || echo "$datafile"; done; `+
+		`status=$?; rm -f %s; exit $status`, segDataDir, contentID, listFile, readCommand, listFile)
+}
+
+func checkTableDataFiles(fpInfo filepath.FilePathInfo, backupConfig *history.BackupConfig, dataEntries []toc.MasterDataEntry) []string {
+	dataFiles := GetTestRestoreDataFileList(fpInfo, backupConfig, dataEntries)
+	utils.WriteOidListToSegments(dataFiles, globalCluster, fpInfo)
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Reading and decompressing data files on segments", cluster.ON_SEGMENTS, func(contentID int) string {
+		readCommand := "cat"
+		if backupConfig.Dedup {
+			readCommand = fmt.Sprintf("%s/bin/gpbackup_helper --dedup-read --content %d --chunk-dir %s --data-file",
+				operating.System.Getenv("GPHOME"), contentID, fpInfo.GetChunkDirForContent(contentID))
+		}
+		return GetTestRestoreDataCommand(fpInfo.GetSegmentHelperFilePath(contentID, "oid"), fpInfo.SegDirMap[contentID], contentID, readCommand)
+	})
+
+	failures := make([]string, 0)
+	for _, command := range remoteOutput.Commands {
+		if command.Error != nil {
+			failures = append(failures, fmt.Sprintf("Data files on segment %d on host %s cannot be checked: %s",
+				command.Content, command.Host, strings.TrimSpace(command.Stderr)))
+			continue
+		}
+		for _, dataFile := range strings.Fields(command.Stdout) {
+			failures = append(failures, fmt.Sprintf("Data file %s on segment %d on host %s cannot be read or decompressed",
+				dataFile, command.Content, command.Host))
+		}
+	}
+	return failures
+}
+
+/*
+ * The single data file of each segment is decompressed as a whole, and must
+ * hold as much data as the segment table of contents gives for its tables.
+ */
+func checkSingleDataFiles(fpInfo filepath.FilePathInfo, backupConfig *history.BackupConfig) []string {
+	pipeThroughProgram := utils.NewPipeThroughProgram(backupConfig.Compressed, backupConfig.CompressionType, 1)
+	tocOutput := globalCluster.GenerateAndExecuteCommand("Reading segment tables of contents", cluster.ON_SEGMENTS, func(contentID int) string {
+		return fmt.Sprintf("cat %s", fpInfo.GetSegmentTOCFilePath(contentID))
+	})
+	sizeOutput := globalCluster.GenerateAndExecuteCommand("Reading and decompressing data files on segments", cluster.ON_SEGMENTS, func(contentID int) string {
+		return fmt.Sprintf("set -o pipefail; %s < %s | wc -c", pipeThroughProgram.InputCommand,
+			fpInfo.GetTableBackupFilePath(contentID, 0, pipeThroughProgram.Extension, true))
+	})
+
+	dataSizes := make(map[int]uint64)
+	failures := make([]string, 0)
+	for _, command := range tocOutput.Commands {
+		segmentTOC, err := toc.ParseSegmentTOC([]byte(command.Stdout))
+		if command.Error != nil || err != nil {
+			failures = append(failures, fmt.Sprintf("Table of contents %s on host %s cannot be read",
+				fpInfo.GetSegmentTOCFilePath(command.Content), command.Host))
+			continue
+		}
+		dataSizes[command.Content] = segmentTOC.DataSize()
+	}
+	for _, command := range sizeOutput.Commands {
+		dataFile := fpInfo.GetTableBackupFilePath(command.Content, 0, pipeThroughProgram.Extension, true)
+		size, err := strconv.ParseUint(strings.TrimSpace(command.Stdout), 10, 64)
+		if command.Error != nil || err != nil {
+			failures = append(failures, fmt.Sprintf("Data file %s on segment %d on host %s cannot be read or decompressed",
+				dataFile, command.Content, command.Host))
+			continue
+		}
+		if expected, ok := dataSizes[command.Content]; ok && size < expected {
+			failures = append(failures, fmt.Sprintf("Data file %s on segment %d on host %s is truncated: it holds %d bytes of data, but %d were backed up",
+				dataFile, command.Content, command.Host, size, expected))
+		}
+	}
+	return failures
+}
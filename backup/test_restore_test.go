@@ -0,0 +1,135 @@
+package backup_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/test_restore tests", func() {
+	Describe("CheckStatementSyntax", func() {
+		DescribeTable("accepts complete statements",
+			func(statement string) {
+				Expect(backup.CheckStatementSyntax(statement)).To(Succeed())
+			},
+			Entry("a simple statement", "\n\nCREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED BY (i);\n"),
+			Entry("a semicolon and parenthesis in a string", "COMMENT ON TABLE public.foo IS 'it''s (not; done';"),
+			Entry("an escaped quote in an escape string", `COMMENT ON TABLE public.foo IS E'it\'s';`),
+			Entry("a quoted identifier", `CREATE SCHEMA "my ""schema"" (";`),
+			Entry("a dollar-quoted body", "CREATE FUNCTION public.f() RETURNS integer AS $body$ SELECT ')'; $$ $body$ LANGUAGE sql;"),
+			Entry("a positional parameter", "PREPARE foo_plan(integer) AS SELECT $1;"),
+			Entry("comments", "/* a /* nested */ comment ( */ SELECT 1; -- trailing comment '\n"),
+		)
+		DescribeTable("rejects incomplete statements",
+			func(statement string, expectedError string) {
+				Expect(backup.CheckStatementSyntax(statement)).To(MatchError(expectedError))
+			},
+			Entry("a truncated statement", "CREATE TABLE public.foo (\n\ti integer\n) DISTRIB", "missing terminating semicolon"),
+			Entry("an unterminated string", "COMMENT ON TABLE public.foo IS 'foo;", "unterminated quoted string"),
+			Entry("an unterminated identifier", `CREATE SCHEMA "foo;`, "unterminated quoted identifier"),
+			Entry("an unterminated dollar quote", "CREATE FUNCTION public.f() RETURNS integer AS $$ SELECT 1;", "unterminated dollar-quoted string $$"),
+			Entry("an unterminated comment", "SELECT 1; /* comment", "unterminated comment"),
+			Entry("an unclosed parenthesis", "CREATE TABLE public.foo (i integer;", "unbalanced parentheses"),
+			Entry("an extra parenthesis", "CREATE TABLE public.foo (i integer));", "unbalanced parentheses"),
+		)
+	})
+	Describe("CheckMetadataStatements", func() {
+		metadata := "CREATE SCHEMA foo;\nCREATE TABLE foo.bar (i integer"
+		It("returns nothing for complete statements", func() {
+			entries := []toc.MetadataEntry{{Name: "foo", ObjectType: "SCHEMA", StartByte: 0, EndByte: 18}}
+			Expect(backup.CheckMetadataStatements(strings.NewReader(metadata), int64(len(metadata)), "metadata.sql", entries)).To(BeEmpty())
+		})
+		It("returns the statements that are incomplete or lie beyond the end of the file", func() {
+			entries := []toc.MetadataEntry{
+				{Schema: "foo", Name: "bar", ObjectType: "TABLE", StartByte: 19, EndByte: uint64(len(metadata))},
+				{Schema: "foo", Name: "baz", ObjectType: "TABLE", StartByte: uint64(len(metadata)), EndByte: uint64(len(metadata)) + 10},
+			}
+			Expect(backup.CheckMetadataStatements(strings.NewReader(metadata), int64(len(metadata)), "metadata.sql", entries)).To(Equal([]string{
+				"Statement for TABLE foo.bar in metadata.sql is invalid: unbalanced parentheses",
+				"Statement for TABLE foo.baz lies beyond the end of metadata.sql",
+			}))
+		})
+	})
+	Describe("GetTestRestoreDataFileList", func() {
+		fpInfo := filepath.NewFilePathInfo(cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, DataDir: "/data/gpseg-1"}}), "", "20170101010101", "gpseg")
+		dataEntries := []toc.MasterDataEntry{{Oid: 16384}, {Oid: 16390, Uncompressed: true}, {Oid: 16400, Streams: 2}}
+		It("lists the data file of each table and stream with its decompression command", func() {
+			backupConfig := &history.BackupConfig{Compressed: true, CompressionType: "zstd"}
+			Expect(backup.GetTestRestoreDataFileList(fpInfo, backupConfig, dataEntries)).To(Equal([]string{
+				"<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_16384.zst zstd --decompress -c",
+				"<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_16390 cat -",
+				"<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_16400_0.zst zstd --decompress -c",
+				"<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_16400_1.zst zstd --decompress -c",
+			}))
+		})
+		It("lists the data files of a deduplicated backup, which are decompressed as they are read", func() {
+			backupConfig := &history.BackupConfig{Compressed: true, CompressionType: "gzip", Dedup: true}
+			Expect(backup.GetTestRestoreDataFileList(fpInfo, backupConfig, dataEntries[:1])).To(Equal([]string{
+				"<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_16384.chunks cat -",
+			}))
+		})
+	})
+	Describe("GetTestRestoreDataCommand", func() {
+		It("reads each data file in the list on the segment and prints those that fail", func() {
+			command := backup.GetTestRestoreDataCommand("/data/gpseg0/gpbackup_0_20170101010101_oid_1234", "/data/gpseg0", 0, "cat")
+			Expect(command).To(Equal(`set -o pipefail; sed -e 's|<SEG_DATA_DIR>|/data/gpseg0|g' -e 's|<SEGID>|0|g' /data/gpseg0/gpbackup_0_20170101010101_oid_1234 | ` +
+				`while read -r datafile program; do (cat "$datafile" 2>/dev/null | $program > /dev/null 2>&1) || echo "$datafile"; done; ` +
+				`status=$?; rm -f /data/gpseg0/gpbackup_0_20170101010101_oid_1234; exit $status`))
+		})
+	})
+	Describe("VerifySample", func() {
+		dataEntries := make([]toc.MasterDataEntry, 0)
+		for i := 0; i < 30; i++ {
+			dataEntries = append(dataEntries, toc.MasterDataEntry{Schema: "public", Name: fmt.Sprintf("t%d", i), Size: int64(i)})
+		}
+		It("checks every table without a sample", func() {
+			var sample *backup.VerifySample
+			Expect(sample.Choose(dataEntries)).To(Equal(dataEntries))
+		})
+		It("checks the largest tables and a sample of the others, in the order of the table of contents", func() {
+			sample := &backup.VerifySample{Percent: 10, Seed: 42}
+			chosen := sample.Choose(dataEntries)
+			Expect(chosen).To(HaveLen(12))
+			Expect(chosen[2:]).To(Equal(dataEntries[20:]))
+			Expect(chosen[0].Size).To(BeNumerically("<", 20))
+			Expect(chosen[1].Size).To(BeNumerically(">", chosen[0].Size))
+			Expect(sample.Total).To(Equal(30))
+			Expect(sample.Tables).To(HaveLen(12))
+			Expect(sample.Tables[11]).To(Equal("public.t29"))
+		})
+		It("chooses the same sample with the same seed", func() {
+			first := &backup.VerifySample{Percent: 10, Seed: 42}
+			second := &backup.VerifySample{Percent: 10, Seed: 42}
+			Expect(first.Choose(dataEntries)).To(Equal(second.Choose(dataEntries)))
+		})
+		It("lists the sampled tables with the seed", func() {
+			sample := &backup.VerifySample{Seed: 42, Total: 30, Tables: []string{"public.t3", "public.t29"}}
+			Expect(backup.FormatVerifySample(sample)).To(Equal("Checked the data files of 2 of 30 tables, sampled with --verify-seed 42:\n  public.t3\n  public.t29\n"))
+			Expect(backup.FormatVerifySample(nil)).To(BeEmpty())
+		})
+		It("parses the percentage of tables to sample", func() {
+			Expect(backup.ParseVerifySamplePercent("5%")).To(Equal(5.0))
+			Expect(backup.ParseVerifySamplePercent("0.5")).To(Equal(0.5))
+			_, err := backup.ParseVerifySamplePercent("0%")
+			Expect(err).To(MatchError("Invalid value '0%' for --verify-sample.  The sample must be a percentage greater than 0% and at most 100%, such as '5%'."))
+		})
+	})
+	Describe("FormatTestRestoreResult", func() {
+		It("reports a pass", func() {
+			Expect(backup.FormatTestRestoreResult("20170101010101", []string{})).To(Equal("PASS: backup 20170101010101 can be restored\n"))
+		})
+		It("reports a failure with each problem found", func() {
+			Expect(backup.FormatTestRestoreResult("20170101010101", []string{"problem 1", "problem 2"})).To(Equal(
+				"FAIL: backup 20170101010101 cannot be restored, with 2 problems:\n  problem 1\n  problem 2\n"))
+		})
+	})
+})
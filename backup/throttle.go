@@ -0,0 +1,282 @@
+package backup
+
+/*
+ * This file contains structs and functions for slowing the data backup while
+ * segment hosts are busy, when --throttle-cpu-percent or
+ * --throttle-iowait-percent is used, and for limiting the COPY pipelines run
+ * on each segment host at once, when --copy-queue-size is used.
+ */
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/pkg/errors"
+)
+
+var hostLoadSampleInterval = 10 * time.Second
+
+/*
+ * The percentages of CPU time that a host spent busy and waiting for IO over
+ * the sampling period.
+ */
+type HostLoad struct {
+	Host          string
+	CPUPercent    float64
+	IOWaitPercent float64
+}
+
+/*
+ * Parses the aggregate cpu line of /proc/stat printed twice, before and after
+ * the sampling period, into the load of the host over that period.
+ */
+func ParseHostLoad(host string, output string) (HostLoad, error) {
+	samples := make([][]uint64, 0)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[0] != "cpu" {
+			continue
+		}
+		sample := make([]uint64, 0)
+		for _, field := range fields[1:] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return HostLoad{}, errors.Errorf("Invalid CPU statistics for host %s: %s", host, line)
+			}
+			sample = append(sample, value)
+		}
+		samples = append(samples, sample)
+	}
+	if len(samples) != 2 {
+		return HostLoad{}, errors.Errorf("Expected two CPU samples for host %s, found %d", host, len(samples))
+	}
+
+	// The fields are user, nice, system, idle, iowait, irq, softirq, and steal
+	var total, idle, iowait uint64
+	for i := 0; i < len(samples[0]) && i < len(samples[1]) && i < 8; i++ {
+		delta := samples[1][i] - samples[0][i]
+		total += delta
+		if i == 3 {
+			idle = delta
+		} else if i == 4 {
+			iowait = delta
+		}
+	}
+	load := HostLoad{Host: host}
+	if total > 0 {
+		load.CPUPercent = float64(total-idle-iowait) * 100 / float64(total)
+		load.IOWaitPercent = float64(iowait) * 100 / float64(total)
+	}
+	return load, nil
+}
+
+/*
+ * Returns the hosts whose CPU or IO wait exceeds its threshold, where a
+ * threshold of 0 is not checked.
+ */
+func GetOverloadedHosts(loads []HostLoad, cpuThreshold int, ioWaitThreshold int) []string {
+	hosts := make([]string, 0)
+	for _, load := range loads {
+		if (cpuThreshold > 0 && load.CPUPercent > float64(cpuThreshold)) ||
+			(ioWaitThreshold > 0 && load.IOWaitPercent > float64(ioWaitThreshold)) {
+			hosts = append(hosts, load.Host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func sampleSegmentHostLoad() []HostLoad {
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Sampling segment host load", cluster.ON_HOSTS, func(host string) string {
+		return "grep '^cpu ' /proc/stat; sleep 1; grep '^cpu ' /proc/stat"
+	})
+	loads := make([]HostLoad, 0)
+	for _, command := range remoteOutput.Commands {
+		if command.Error != nil {
+			gplog.Verbose("Unable to sample the load of host %s: %v", command.Host, command.Error)
+			continue
+		}
+		load, err := ParseHostLoad(command.Host, command.Stdout)
+		if err != nil {
+			gplog.Verbose(err.Error())
+			continue
+		}
+		loads = append(loads, load)
+	}
+	return loads
+}
+
+/*
+ * Workers acquire a slot before copying a table and release it afterwards.
+ * As COPY ON SEGMENT runs on every segment at once, a busy host slows every
+ * COPY, so while any host is over a threshold only one table is copied at a
+ * time, and the other tables wait until the hosts are below their thresholds
+ * again.  Errors while sampling are only logged, as the throttle must never
+ * stop the backup.
+ */
+type loadThrottle struct {
+	cpuThreshold    int
+	ioWaitThreshold int
+	overloaded      bool
+	running         int
+	cond            *sync.Cond
+	done            chan struct{}
+	stopped         chan struct{}
+}
+
+/*
+ * Returns a throttle that is sampling the segment hosts if a threshold was
+ * given, and nil otherwise, in which case tables are never held.
+ */
+func startLoadThrottle() *loadThrottle {
+	cpuThreshold := MustGetFlagInt(options.THROTTLE_CPU)
+	ioWaitThreshold := MustGetFlagInt(options.THROTTLE_IOWAIT)
+	if cpuThreshold == 0 && ioWaitThreshold == 0 {
+		return nil
+	}
+	throttle := &loadThrottle{
+		cpuThreshold:    cpuThreshold,
+		ioWaitThreshold: ioWaitThreshold,
+		cond:            sync.NewCond(&sync.Mutex{}),
+		done:            make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	go throttle.monitor()
+	return throttle
+}
+
+func (throttle *loadThrottle) monitor() {
+	defer close(throttle.stopped)
+	ticker := time.NewTicker(hostLoadSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-throttle.done:
+			return
+		case <-ticker.C:
+			hosts := GetOverloadedHosts(sampleSegmentHostLoad(), throttle.cpuThreshold, throttle.ioWaitThreshold)
+			throttle.setOverloaded(hosts)
+		}
+	}
+}
+
+func (throttle *loadThrottle) setOverloaded(hosts []string) {
+	throttle.cond.L.Lock()
+	overloaded := len(hosts) > 0
+	if overloaded && !throttle.overloaded {
+		gplog.Verbose("Copying one table at a time while host(s) %s are over the load thresholds", strings.Join(hosts, ", "))
+	} else if !overloaded && throttle.overloaded {
+		gplog.Verbose("Segment hosts are below the load thresholds, resuming parallel data copy")
+	}
+	throttle.overloaded = overloaded
+	throttle.cond.L.Unlock()
+	throttle.cond.Broadcast()
+}
+
+func (throttle *loadThrottle) acquire() {
+	if throttle == nil {
+		return
+	}
+	throttle.cond.L.Lock()
+	defer throttle.cond.L.Unlock()
+	for throttle.overloaded && throttle.running > 0 {
+		throttle.cond.Wait()
+	}
+	throttle.running++
+}
+
+func (throttle *loadThrottle) release() {
+	if throttle == nil {
+		return
+	}
+	throttle.cond.L.Lock()
+	throttle.running--
+	throttle.cond.L.Unlock()
+	throttle.cond.Broadcast()
+}
+
+func (throttle *loadThrottle) stop() {
+	if throttle == nil {
+		return
+	}
+	close(throttle.done)
+	<-throttle.stopped
+	throttle.setOverloaded([]string{})
+}
+
+/*
+ * Every COPY ON SEGMENT runs a pipeline on each primary segment, so the
+ * pipelines running on a host are the tables being copied times the segments
+ * on the host.  Returns the number of tables that can be copied at once
+ * without any host running more than copyQueueSize pipelines, which is at
+ * least one so that the backup always makes progress.
+ */
+func GetCopyQueueLimit(copyQueueSize int, segmentsPerHost map[string]int) int {
+	maxSegmentsPerHost := 1
+	for _, numSegments := range segmentsPerHost {
+		if numSegments > maxSegmentsPerHost {
+			maxSegmentsPerHost = numSegments
+		}
+	}
+	if limit := copyQueueSize / maxSegmentsPerHost; limit > 1 {
+		return limit
+	}
+	return 1
+}
+
+func getSegmentsPerHost() map[string]int {
+	segmentsPerHost := make(map[string]int)
+	for _, segment := range globalCluster.Segments {
+		if segment.ContentID >= 0 && segment.Role == "p" {
+			segmentsPerHost[segment.Hostname]++
+		}
+	}
+	return segmentsPerHost
+}
+
+/*
+ * Workers take a slot before copying a table and give it back afterwards, so
+ * that no more tables are copied at once than the hosts have room for, however
+ * many connections there are.
+ */
+type copyQueue struct {
+	slots chan struct{}
+}
+
+/*
+ * Returns a queue limiting the tables copied at once if --copy-queue-size
+ * allows fewer of them than there are connections, and nil otherwise, in
+ * which case tables are never held.
+ */
+func newCopyQueue() *copyQueue {
+	copyQueueSize := MustGetFlagInt(options.COPY_QUEUE_SIZE)
+	if copyQueueSize == 0 {
+		return nil
+	}
+	limit := GetCopyQueueLimit(copyQueueSize, getSegmentsPerHost())
+	if limit >= connectionPool.NumConns {
+		return nil
+	}
+	gplog.Info("Copying at most %d table(s) at a time to run at most %d COPY pipelines on each segment host", limit, copyQueueSize)
+	return &copyQueue{slots: make(chan struct{}, limit)}
+}
+
+func (queue *copyQueue) acquire() {
+	if queue == nil {
+		return
+	}
+	queue.slots <- struct{}{}
+}
+
+func (queue *copyQueue) release() {
+	if queue == nil {
+		return
+	}
+	<-queue.slots
+}
@@ -0,0 +1,63 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/throttle tests", func() {
+	Describe("ParseHostLoad", func() {
+		It("computes the CPU and IO wait percentages between the two samples", func() {
+			output := "cpu  100 0 100 700 100 0 0 0 0 0\ncpu  160 0 140 760 140 0 0 0 0 0\n"
+
+			load, err := backup.ParseHostLoad("sdw1", output)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(load).To(Equal(backup.HostLoad{Host: "sdw1", CPUPercent: 50, IOWaitPercent: 20}))
+		})
+		It("returns no load for a host with no CPU time between the samples", func() {
+			output := "cpu  100 0 100 700 100 0 0 0\ncpu  100 0 100 700 100 0 0 0\n"
+
+			load, err := backup.ParseHostLoad("sdw1", output)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(load).To(Equal(backup.HostLoad{Host: "sdw1"}))
+		})
+		It("returns an error if a sample is missing", func() {
+			_, err := backup.ParseHostLoad("sdw1", "cpu  100 0 100 700 100 0 0 0\n")
+
+			Expect(err).To(MatchError("Expected two CPU samples for host sdw1, found 1"))
+		})
+		It("returns an error for a malformed sample", func() {
+			_, err := backup.ParseHostLoad("sdw1", "cpu  100 0 100 700 100 0 0 0\ncpu  100 0 abc 700 100 0 0 0\n")
+
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("GetOverloadedHosts", func() {
+		loads := []backup.HostLoad{
+			{Host: "sdw2", CPUPercent: 95, IOWaitPercent: 2},
+			{Host: "sdw1", CPUPercent: 40, IOWaitPercent: 35},
+			{Host: "sdw3", CPUPercent: 20, IOWaitPercent: 1},
+		}
+		It("returns the hosts over either threshold", func() {
+			Expect(backup.GetOverloadedHosts(loads, 90, 30)).To(Equal([]string{"sdw1", "sdw2"}))
+		})
+		It("does not check a threshold of 0", func() {
+			Expect(backup.GetOverloadedHosts(loads, 0, 30)).To(Equal([]string{"sdw1"}))
+		})
+		It("returns no hosts when every host is below the thresholds", func() {
+			Expect(backup.GetOverloadedHosts(loads, 99, 50)).To(BeEmpty())
+		})
+	})
+	Describe("GetCopyQueueLimit", func() {
+		It("copies as many tables as the host with the most segments has room for", func() {
+			Expect(backup.GetCopyQueueLimit(16, map[string]int{"sdw1": 4, "sdw2": 8})).To(Equal(2))
+		})
+		It("copies at least one table at a time", func() {
+			Expect(backup.GetCopyQueueLimit(4, map[string]int{"sdw1": 8})).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,121 @@
+package backup
+
+/*
+ * This file contains functions for --skip-if-unchanged, which skips backing
+ * up the data of a database in which nothing changed since its last backup,
+ * for databases that are backed up on a schedule but rarely change.
+ */
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * The checksum of the metadata file is recorded for every backup, so that a
+ * later backup can tell whether any DDL ran in between by comparing it.
+ */
+func GetMetadataChecksum(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+/*
+ * A backup is unchanged since the previous one if its metadata is identical
+ * and every table has the same modification count, last DDL timestamp, and,
+ * for heap tables, relfilenode.  Heap modification counts come from the
+ * statistics collector, so a change made in the last moments before the
+ * backup started may not be counted yet.
+ */
+func IsUnchangedSince(previousConfig *history.BackupConfig, previousTOC *toc.TOC, metadataChecksum string, currentTOC *toc.TOC) bool {
+	if previousConfig.MetadataChecksum == "" || previousConfig.MetadataChecksum != metadataChecksum {
+		return false
+	}
+	if previousConfig.MetadataOnly || previousConfig.DataOnly || previousConfig.WithStatistics != MustGetFlagBool(options.WITH_STATS) {
+		return false
+	}
+	previous := previousTOC.IncrementalMetadata
+	current := currentTOC.IncrementalMetadata
+	if len(previous.AO) != len(current.AO) || len(previous.Heap) != len(current.Heap) {
+		return false
+	}
+	for fqn, currentEntry := range current.AO {
+		if previousEntry, ok := previous.AO[fqn]; !ok || previousEntry != currentEntry {
+			return false
+		}
+	}
+	for fqn, currentEntry := range current.Heap {
+		if previousEntry, ok := previous.Heap[fqn]; !ok || previousEntry != currentEntry {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * Returns the backup that this one is unchanged since, or nil if there is no
+ * matching backup or something changed since it.
+ */
+func getUnchangedSinceBackup() *history.BackupConfig {
+	if !iohelper.FileExistsAndIsReadable(globalFPInfo.GetBackupHistoryFilePath()) {
+		return nil
+	}
+	backupHistory, err := history.NewHistory(globalFPInfo.GetBackupHistoryFilePath())
+	gplog.FatalOnError(err)
+	previousConfig := GetLatestMatchingBackupConfig(backupHistory, &backupReport.BackupConfig)
+	if previousConfig == nil {
+		gplog.Info("No matching previous backup found, so the backup will not be skipped")
+		return nil
+	}
+	previousFPInfo := filepath.NewFilePathInfo(globalCluster, globalFPInfo.UserSpecifiedBackupDir,
+		previousConfig.Timestamp, globalFPInfo.UserSpecifiedSegPrefix)
+	if pluginConfig != nil {
+		pluginConfig.MustRestoreFile(previousFPInfo.GetTOCFilePath())
+	}
+	previousTOC := toc.NewTOC(previousFPInfo.GetTOCFilePath())
+	if !IsUnchangedSince(previousConfig, previousTOC, backupReport.MetadataChecksum, globalTOC) {
+		gplog.Info("The database changed since backup %s, so the backup will not be skipped", previousConfig.Timestamp)
+		return nil
+	}
+	return previousConfig
+}
+
+/*
+ * Records the backup as unchanged since the previous one instead of backing
+ * up the data.  It takes on the restore plan of the previous backup, so that
+ * the backups it stands for are not expired while it is kept, and its
+ * metadata files are removed as they are identical to those of the previous
+ * backup.
+ */
+func finishUnchangedBackup(metadataFile *utils.FileWithByteCount, previousConfig *history.BackupConfig) {
+	gplog.Info("Nothing changed since backup %s, skipping the backup of the data", previousConfig.Timestamp)
+	backupReport.UnchangedSince = previousConfig.Timestamp
+	backupReport.RestorePlan = previousConfig.RestorePlan
+	commitTransactions()
+	metadataFile.Close()
+	for _, filename := range []string{globalFPInfo.GetMetadataFilePath(), globalFPInfo.GetGlobalsFilePath(), globalFPInfo.GetCredentialsFilePath()} {
+		err := os.Remove(filename)
+		if err != nil && !os.IsNotExist(err) {
+			gplog.Warn("Unable to remove %s: %v", filename, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package backup_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/unchanged tests", func() {
+	Describe("GetMetadataChecksum", func() {
+		It("returns the SHA-256 checksum of the file", func() {
+			file, _ := ioutil.TempFile("", "metadata")
+			defer os.Remove(file.Name())
+			_, _ = file.WriteString("CREATE TABLE public.foo (i integer);\n")
+			_ = file.Close()
+
+			checksum, err := backup.GetMetadataChecksum(file.Name())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checksum).To(HaveLen(64))
+
+			otherChecksum, _ := backup.GetMetadataChecksum(file.Name())
+			Expect(otherChecksum).To(Equal(checksum))
+		})
+		It("returns an error if the file cannot be read", func() {
+			_, err := backup.GetMetadataChecksum("/tmp/nonexistent_metadata_file")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("IsUnchangedSince", func() {
+		var previousConfig history.BackupConfig
+		var previousTOC, currentTOC toc.TOC
+		BeforeEach(func() {
+			previousConfig = history.BackupConfig{Timestamp: "20170101010101", MetadataChecksum: "abc"}
+			previousTOC = toc.TOC{IncrementalMetadata: toc.IncrementalEntries{
+				AO:   map[string]toc.AOEntry{"public.ao": {Modcount: 2, LastDDLTimestamp: "2017-01-01"}},
+				Heap: map[string]toc.HeapEntry{"public.heap": {Modcount: 5, RelFileNode: 1234}},
+			}}
+			currentTOC = toc.TOC{IncrementalMetadata: toc.IncrementalEntries{
+				AO:   map[string]toc.AOEntry{"public.ao": {Modcount: 2, LastDDLTimestamp: "2017-01-01"}},
+				Heap: map[string]toc.HeapEntry{"public.heap": {Modcount: 5, RelFileNode: 1234}},
+			}}
+		})
+		It("is unchanged if the metadata and every table are unchanged", func() {
+			Expect(backup.IsUnchangedSince(&previousConfig, &previousTOC, "abc", &currentTOC)).To(BeTrue())
+		})
+		It("is changed if the metadata changed", func() {
+			Expect(backup.IsUnchangedSince(&previousConfig, &previousTOC, "def", &currentTOC)).To(BeFalse())
+		})
+		It("is changed if the previous backup has no metadata checksum", func() {
+			previousConfig.MetadataChecksum = ""
+			Expect(backup.IsUnchangedSince(&previousConfig, &previousTOC, "", &currentTOC)).To(BeFalse())
+		})
+		It("is changed if an append-optimized table was modified", func() {
+			currentTOC.IncrementalMetadata.AO["public.ao"] = toc.AOEntry{Modcount: 3, LastDDLTimestamp: "2017-01-01"}
+			Expect(backup.IsUnchangedSince(&previousConfig, &previousTOC, "abc", &currentTOC)).To(BeFalse())
+		})
+		It("is changed if a heap table was truncated", func() {
+			currentTOC.IncrementalMetadata.Heap["public.heap"] = toc.HeapEntry{Modcount: 5, RelFileNode: 5678}
+			Expect(backup.IsUnchangedSince(&previousConfig, &previousTOC, "abc", &currentTOC)).To(BeFalse())
+		})
+		It("is changed if a table was added", func() {
+			currentTOC.IncrementalMetadata.Heap["public.heap2"] = toc.HeapEntry{}
+			Expect(backup.IsUnchangedSince(&previousConfig, &previousTOC, "abc", &currentTOC)).To(BeFalse())
+		})
+		It("is changed if the previous backup has no statistics and statistics are being backed up", func() {
+			_ = cmdFlags.Set(options.WITH_STATS, "true")
+			Expect(backup.IsUnchangedSince(&previousConfig, &previousTOC, "abc", &currentTOC)).To(BeFalse())
+		})
+		It("is changed if the previous backup was metadata-only", func() {
+			previousConfig.MetadataOnly = true
+			Expect(backup.IsUnchangedSince(&previousConfig, &previousTOC, "abc", &currentTOC)).To(BeFalse())
+		})
+	})
+})
@@ -21,6 +21,7 @@ func validateFilterLists(opts *options.Options) {
 	gplog.Verbose("Validating Tables and Schemas exist in Database")
 	ValidateTablesExist(connectionPool, opts.GetIncludedTables(), false)
 	ValidateTablesExist(connectionPool, opts.GetExcludedTables(), true)
+	ValidateTablesExist(connectionPool, opts.ExcludedDataRelations, true)
 	ValidateSchemasExist(connectionPool, opts.GetIncludedSchemas(), false)
 	ValidateSchemasExist(connectionPool, opts.GetExcludedSchemas(), true)
 }
@@ -97,17 +98,98 @@ func validateFlagCombinations(flags *pflag.FlagSet) {
 	options.CheckExclusiveFlags(flags, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE)
 	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE)
 	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.EXCLUDE_RELATION, options.INCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.INCLUDE_RELATION_FILE)
+	options.CheckExclusiveFlags(flags, options.EXCLUDE_TABLE_DATA, options.EXCLUDE_TABLE_DATA_FILE, options.METADATA_ONLY)
 	options.CheckExclusiveFlags(flags, options.JOBS, options.METADATA_ONLY, options.SINGLE_DATA_FILE)
 	options.CheckExclusiveFlags(flags, options.METADATA_ONLY, options.LEAF_PARTITION_DATA)
+	for _, flagName := range []string{options.LEAF_PARTITION_DATA, options.METADATA_ONLY, options.SINGLE_DATA_FILE, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE} {
+		options.CheckExclusiveFlags(flags, options.LEAF_DATA_LARGER_THAN, flagName)
+	}
+	for _, flagName := range []string{options.METADATA_ONLY, options.SINGLE_DATA_FILE, options.DEDUP, options.NO_SYNC_SNAPSHOT} {
+		options.CheckExclusiveFlags(flags, options.SPLIT_LARGER_THAN, flagName)
+	}
+	if flags.Changed(options.VERIFY_SAMPLE) && MustGetFlagString(options.TEST_RESTORE) == "" {
+		gplog.Fatal(errors.Errorf("--verify-sample must be specified with --test-restore"), "")
+	}
+	if flags.Changed(options.VERIFY_SEED) && !flags.Changed(options.VERIFY_SAMPLE) {
+		gplog.Fatal(errors.Errorf("--verify-seed must be specified with --verify-sample"), "")
+	}
+	if flags.Changed(options.SPLIT_TABLE_STREAMS) && MustGetFlagString(options.SPLIT_LARGER_THAN) == "" {
+		gplog.Fatal(errors.Errorf("--split-table-streams must be specified with --split-table-data-larger-than"), "")
+	}
 	options.CheckExclusiveFlags(flags, options.NO_COMPRESSION, options.COMPRESSION_TYPE)
 	options.CheckExclusiveFlags(flags, options.NO_COMPRESSION, options.COMPRESSION_LEVEL)
+	options.CheckExclusiveFlags(flags, options.COMPRESSION_OVERRIDES, options.NO_COMPRESSION, options.SINGLE_DATA_FILE, options.METADATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.COMPRESSION_WORKERS, options.NO_COMPRESSION, options.METADATA_ONLY, options.DEDUP)
 	options.CheckExclusiveFlags(flags, options.PLUGIN_CONFIG, options.BACKUP_DIR)
+	options.CheckExclusiveFlags(flags, options.DELETE_BEFORE, options.RETENTION_COUNT, options.LIST, options.LIST_BACKUPS, options.LIST_RESTORES, options.DRY_RUN, options.ESTIMATE, options.DIFF, options.STATUS, options.TEST_RESTORE, options.MIGRATE_HISTORY, options.CLEANUP)
+	if MustGetFlagBool(options.MIGRATE_HISTORY) && !flags.Changed(options.HISTORY_DB) {
+		gplog.Fatal(errors.Errorf("--history-db must be specified with --migrate-history"), "")
+	}
+	options.CheckExclusiveFlags(flags, options.DRY_RUN, options.INCREMENTAL, options.RESUME)
+	options.CheckExclusiveFlags(flags, options.ESTIMATE, options.INCREMENTAL, options.RESUME)
+	if flags.Changed(options.LIST_FORMAT) && !flags.Changed(options.LIST) && !MustGetFlagBool(options.LIST_BACKUPS) && !MustGetFlagBool(options.LIST_RESTORES) {
+		gplog.Fatal(errors.Errorf("--list-format must be specified with --list, --list-backups, or --list-restores"), "")
+	}
+	if flags.Changed(options.LIST_OBJECT_TYPE) && !flags.Changed(options.LIST) {
+		gplog.Fatal(errors.Errorf("--list-object-type must be specified with --list"), "")
+	}
+	if flags.Changed(options.DIFF_FORMAT) && !flags.Changed(options.DIFF) {
+		gplog.Fatal(errors.Errorf("--diff-format must be specified with --diff"), "")
+	}
 	if MustGetFlagString(options.FROM_TIMESTAMP) != "" && !MustGetFlagBool(options.INCREMENTAL) {
 		gplog.Fatal(errors.Errorf("--from-timestamp must be specified with --incremental"), "")
 	}
 	if MustGetFlagBool(options.INCREMENTAL) && !MustGetFlagBool(options.LEAF_PARTITION_DATA) {
 		gplog.Fatal(errors.Errorf("--leaf-partition-data must be specified with --incremental"), "")
 	}
+	if MustGetFlagBool(options.DIFFERENTIAL) && !MustGetFlagBool(options.INCREMENTAL) {
+		gplog.Fatal(errors.Errorf("--incremental must be specified with --differential"), "")
+	}
+	options.CheckExclusiveFlags(flags, options.DIFFERENTIAL, options.FROM_TIMESTAMP)
+	if flags.Changed(options.CREDENTIALS_KEY_FILE) && !MustGetFlagBool(options.REDACT_CREDENTIALS) {
+		gplog.Fatal(errors.Errorf("--credentials-key-file must be specified with --redact-credentials"), "")
+	}
+	options.CheckExclusiveFlags(flags, options.REDACT_CREDENTIALS, options.DATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.NO_LOCK, options.LOCK_TIMEOUT)
+	options.CheckExclusiveFlags(flags, options.CONTENDED_TABLES_FIRST, options.METADATA_ONLY, options.SINGLE_DATA_FILE)
+	options.CheckExclusiveFlags(flags, options.COPY_QUEUE_SIZE, options.METADATA_ONLY)
+	for _, flagName := range []string{options.DATA_ONLY, options.METADATA_ONLY, options.RESUME} {
+		options.CheckExclusiveFlags(flags, options.SKIP_IF_UNCHANGED, flagName)
+	}
+	options.CheckExclusiveFlags(flags, options.NO_LOCK, options.SKIP_LOCKED_TABLES)
+	if MustGetFlagBool(options.SKIP_LOCKED_TABLES) && MustGetFlagInt(options.LOCK_TIMEOUT) == 0 {
+		gplog.Fatal(errors.Errorf("--lock-timeout must be specified with --skip-locked-tables"), "")
+	}
+	if MustGetFlagBool(options.MIRROR_FAILOVER) && MustGetFlagString(options.BACKUP_DIR) == "" {
+		gplog.Fatal(errors.Errorf("--backup-dir must be specified with --mirror-failover"), "")
+	}
+	options.CheckExclusiveFlags(flags, options.MIRROR_FAILOVER, options.SINGLE_DATA_FILE)
+	options.CheckExclusiveFlags(flags, options.RESUME, options.SINGLE_DATA_FILE)
+	options.CheckExclusiveFlags(flags, options.RESUME, options.PLUGIN_CONFIG)
+	options.CheckExclusiveFlags(flags, options.RESUME, options.METADATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.WITH_GLOBALS, options.WITHOUT_GLOBALS, options.DATA_ONLY)
+	for _, flagName := range []string{options.SINGLE_DATA_FILE, options.PLUGIN_CONFIG, options.COMPRESSION_OVERRIDES, options.RESUME, options.METADATA_ONLY} {
+		options.CheckExclusiveFlags(flags, options.DEDUP, flagName)
+	}
+	options.CheckExclusiveFlags(flags, options.WITH_GLOBALS, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE)
+	// These write their results to stdout, which --machine-output keeps for the summary
+	for _, flagName := range []string{options.LIST, options.LIST_BACKUPS, options.LIST_RESTORES, options.DIFF, options.STATUS, options.DRY_RUN, options.ESTIMATE, options.TEST_RESTORE} {
+		options.CheckExclusiveFlags(flags, options.MACHINE_OUTPUT, flagName)
+	}
+	if MustGetFlagString(options.DATA_LAYOUT) == filepath.DataLayoutDirectory {
+		for _, flagName := range []string{options.SINGLE_DATA_FILE, options.DEDUP, options.PLUGIN_CONFIG, options.STORAGE, options.RESUME} {
+			if flags.Changed(flagName) {
+				gplog.Fatal(errors.Errorf("Cannot use --%s with --data-layout %s", flagName, filepath.DataLayoutDirectory), "")
+			}
+		}
+	}
+	validateStorageFlags(flags)
+	for _, flagName := range []string{options.CLEANUP, options.RESUME, options.PLUGIN_CONFIG, options.STORAGE, options.CLIENT_MODE, options.NO_SEGMENTS} {
+		options.CheckExclusiveFlags(flags, options.CLEANUP_ON_FAILURE, flagName)
+	}
+	validateClientModeFlags(flags)
+	validateNoSegmentsFlags(flags)
+	validateMultiDatabaseFlags(flags)
 }
 
 func validateFlagValues() {
@@ -117,10 +199,115 @@ func validateFlagValues() {
 	gplog.FatalOnError(err)
 	err = utils.ValidateCompressionTypeAndLevel(MustGetFlagString(options.COMPRESSION_TYPE), MustGetFlagInt(options.COMPRESSION_LEVEL))
 	gplog.FatalOnError(err)
+	if MustGetFlagInt(options.COMPRESSION_WORKERS) < 1 {
+		gplog.Fatal(errors.Errorf("--compression-workers must be at least 1"), "")
+	}
+	err = utils.ValidateFullPath(MustGetFlagString(options.COMPRESSION_OVERRIDES))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.SLA_FILE))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.OBJECT_HANDLER_FILE))
+	gplog.FatalOnError(err)
+	if keyFilename := MustGetFlagString(options.CREDENTIALS_KEY_FILE); keyFilename != "" {
+		_, err = utils.ReadCredentialsKey(keyFilename)
+		gplog.FatalOnError(err)
+	}
+	err = utils.ValidateProgressMode(MustGetFlagString(options.PROGRESS))
+	gplog.FatalOnError(err)
+	_, err = utils.ParseJobs(MustGetFlagString(options.JOBS))
+	gplog.FatalOnError(err)
+	validateStorageFlagValues()
+	err = ValidateIsolationLevel(MustGetFlagString(options.ISOLATION_LEVEL))
+	gplog.FatalOnError(err)
+	err = filepath.ValidateDataLayout(MustGetFlagString(options.DATA_LAYOUT))
+	gplog.FatalOnError(err)
+	if sizeStr := MustGetFlagString(options.EXCLUDE_LARGER_THAN); sizeStr != "" {
+		_, err = utils.ParseSize(sizeStr)
+		gplog.FatalOnError(err)
+	}
+	if sizeStr := MustGetFlagString(options.LEAF_DATA_LARGER_THAN); sizeStr != "" {
+		_, err = utils.ParseSize(sizeStr)
+		gplog.FatalOnError(err)
+	}
+	if sizeStr := MustGetFlagString(options.SPLIT_LARGER_THAN); sizeStr != "" {
+		_, err = utils.ParseSize(sizeStr)
+		gplog.FatalOnError(err)
+	}
+	if MustGetFlagInt(options.SPLIT_TABLE_STREAMS) < 2 {
+		gplog.Fatal(errors.Errorf("--split-table-streams must be at least 2"), "")
+	}
+	if sizeStr := MustGetFlagString(options.INCLUDE_SMALLER_THAN); sizeStr != "" {
+		size, err := utils.ParseSize(sizeStr)
+		gplog.FatalOnError(err)
+		if size == 0 {
+			gplog.Fatal(errors.Errorf("--include-table-smaller-than must be greater than 0"), "")
+		}
+	}
+	if deleteBefore := MustGetFlagString(options.DELETE_BEFORE); deleteBefore != "" && !IsValidDeleteBeforeDate(deleteBefore) {
+		gplog.Fatal(errors.Errorf("Date %s is invalid.  Dates must be in the format YYYYMMDD or YYYYMMDDHHMMSS.", deleteBefore), "")
+	}
+	if listFormat := MustGetFlagString(options.LIST_FORMAT); listFormat != "table" && listFormat != "json" {
+		gplog.Fatal(errors.Errorf("Invalid list format '%s'.  Valid values are 'table' and 'json'.", listFormat), "")
+	}
+	if diffFormat := MustGetFlagString(options.DIFF_FORMAT); diffFormat != "text" && diffFormat != "json" {
+		gplog.Fatal(errors.Errorf("Invalid diff format '%s'.  Valid values are 'text' and 'json'.", diffFormat), "")
+	}
+	if timestamp := MustGetFlagString(options.LIST); timestamp != "" && !filepath.IsValidTimestamp(timestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", timestamp), "")
+	}
+	if timestamps := MustGetFlagStringSlice(options.DIFF); len(timestamps) > 0 {
+		if len(timestamps) != 2 {
+			gplog.Fatal(errors.Errorf("--diff requires exactly two timestamps"), "")
+		}
+		for _, timestamp := range timestamps {
+			if !filepath.IsValidTimestamp(timestamp) {
+				gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", timestamp), "")
+			}
+		}
+	}
+	for _, flagName := range []string{options.LOCK_TIMEOUT, options.WAIT_FOR_DIR_LOCK, options.COPY_QUEUE_SIZE} {
+		if MustGetFlagInt(flagName) < 0 {
+			gplog.Fatal(errors.Errorf("--%s must not be negative", flagName), "")
+		}
+	}
+	for _, flagName := range []string{options.THROTTLE_CPU, options.THROTTLE_IOWAIT} {
+		if percent := MustGetFlagInt(flagName); percent < 0 || percent > 100 {
+			gplog.Fatal(errors.Errorf("--%s must be between 0 and 100", flagName), "")
+		}
+	}
+	if cmdFlags.Changed(options.RETENTION_COUNT) && MustGetFlagInt(options.RETENTION_COUNT) < 1 {
+		gplog.Fatal(errors.Errorf("--retention-count must be at least 1"), "")
+	}
 	if MustGetFlagString(options.FROM_TIMESTAMP) != "" && !filepath.IsValidTimestamp(MustGetFlagString(options.FROM_TIMESTAMP)) {
 		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
 			MustGetFlagString(options.FROM_TIMESTAMP)), "")
 	}
+	if MustGetFlagString(options.STATUS) != "" && !filepath.IsValidTimestamp(MustGetFlagString(options.STATUS)) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
+			MustGetFlagString(options.STATUS)), "")
+	}
+	if MustGetFlagString(options.TEST_RESTORE) != "" && !filepath.IsValidTimestamp(MustGetFlagString(options.TEST_RESTORE)) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
+			MustGetFlagString(options.TEST_RESTORE)), "")
+	}
+	if MustGetFlagString(options.VERIFY_SAMPLE) != "" {
+		_, err = ParseVerifySamplePercent(MustGetFlagString(options.VERIFY_SAMPLE))
+		gplog.FatalOnError(err)
+	}
+	if MustGetFlagString(options.CLEANUP) != "" && !filepath.IsValidTimestamp(MustGetFlagString(options.CLEANUP)) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
+			MustGetFlagString(options.CLEANUP)), "")
+	}
+	err = ValidateCleanupOnFailureMode(MustGetFlagString(options.CLEANUP_ON_FAILURE))
+	gplog.FatalOnError(err)
+	if MustGetFlagString(options.RESUME) != "" && !filepath.IsValidTimestamp(MustGetFlagString(options.RESUME)) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
+			MustGetFlagString(options.RESUME)), "")
+	}
+	if MustGetFlagString(options.DATABASE_GROUP) != "" && !filepath.IsValidTimestamp(MustGetFlagString(options.DATABASE_GROUP)) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
+			MustGetFlagString(options.DATABASE_GROUP)), "")
+	}
 }
 
 func validateFromTimestamp(fromTimestamp string) {
@@ -238,6 +238,13 @@ var _ = Describe("backup/validate tests", func() {
 			Entry("--exclude-table-file combos", "--exclude-table-file /tmp/file --include-schema schema2", true), // TODO: Verify this.
 			Entry("--exclude-table-file combos", "--exclude-table-file /tmp/file --include-schema-file /tmp/file2", true), // TODO: Verify this.
 
+			// --exclude-table-data combinations
+			Entry("--exclude-table-data combos", "--exclude-table-data schema.table --exclude-table-data schema.table2", true),
+			Entry("--exclude-table-data combos", "--exclude-table-data schema.table --include-schema schema", true),
+			Entry("--exclude-table-data combos", "--exclude-table-data schema.table --exclude-table-data-file /tmp/file", false),
+			Entry("--exclude-table-data combos", "--exclude-table-data schema.table --metadata-only", false),
+			Entry("--exclude-table-data combos", "--exclude-table-data-file /tmp/file --metadata-only", false),
+
 			// --include-schema combinations with other filters
 			Entry("--include-schema combos", "--include-schema schema1 --include-table schema.table2", false),
 			Entry("--include-schema combos", "--include-schema schema1 --include-table-file /tmp/file2", false),
@@ -269,6 +276,214 @@ var _ = Describe("backup/validate tests", func() {
 			Entry("jobs combos", "--jobs 2 --single-data-file", false),
 			Entry("jobs combos", "--jobs 2 --plugin-config /tmp/file", true),
 			Entry("jobs combos", "--jobs 2 --data-only", true),
+			Entry("jobs combos", "--jobs auto --single-data-file", false),
+			Entry("jobs combos", "--jobs auto --data-only", true),
+
+			/*
+			 * Below are various different multi-database combinations
+			 */
+			Entry("multi-database combos", "--all-databases --dbname testdb", false),
+			Entry("multi-database combos", "--all-databases --include-schema public", true),
+			Entry("multi-database combos", "--dbname db1,db2 --include-table public.foo", false),
+			Entry("multi-database combos", "--all-databases --resume 20170101010101", false),
+			Entry("multi-database combos", "--dbname db1,db2 --list-backups", false),
+			Entry("multi-database combos", "--dbname testdb --include-table public.foo", true),
+			Entry("multi-database combos", "--all-databases --consistent-snapshot", true),
+			Entry("multi-database combos", "--dbname testdb --consistent-snapshot", false),
+			Entry("multi-database combos", "--dbname db1,db2 --import-snapshot 00000003-0000001B-1", false),
+
+			/*
+			 * Below are various different --with-globals combinations
+			 */
+			Entry("--with-globals combos", "--with-globals --without-globals", false),
+			Entry("--with-globals combos", "--with-globals --data-only", false),
+			Entry("--with-globals combos", "--with-globals --include-table public.foo", false),
+			Entry("--with-globals combos", "--with-globals --include-schema public", true),
+			Entry("--with-globals combos", "--with-globals --metadata-only", true),
+
+			/*
+			 * Below are various different --storage combinations
+			 */
+			Entry("--storage combos", "--storage s3 --s3-bucket bucket", true),
+			Entry("--storage combos", "--storage s3 --s3-bucket bucket --s3-endpoint http://minio:9000 --s3-sse AES256", true),
+			Entry("--storage combos", "--storage s3", false),
+			Entry("--storage combos", "--storage gcs", false),
+			Entry("--storage combos", "--s3-bucket bucket", false),
+			Entry("--storage combos", "--storage s3 --s3-bucket bucket --plugin-config /tmp/plugin.yaml", false),
+			Entry("--storage combos", "--storage s3 --s3-bucket bucket --backup-dir /tmp", false),
+			Entry("--storage combos", "--storage s3 --s3-bucket bucket --s3-part-size 1", false),
+			Entry("--storage combos", "--storage s3 --s3-bucket bucket --s3-sse-kms-key-id key", false),
+			Entry("--storage combos", "--storage s3 --s3-bucket bucket --dedup", false),
+
+			/*
+			 * Below are various different --dedup combinations
+			 */
+			Entry("--dedup combos", "--dedup", true),
+			Entry("--dedup combos", "--dedup --backup-dir /tmp --compression-type zstd", true),
+			Entry("--dedup combos", "--dedup --incremental --leaf-partition-data", true),
+			Entry("--dedup combos", "--dedup --single-data-file", false),
+			Entry("--dedup combos", "--dedup --plugin-config /tmp/plugin.yaml", false),
+			Entry("--dedup combos", "--dedup --metadata-only", false),
+			Entry("--dedup combos", "--dedup --resume 20170101010101", false),
+
+			/*
+			 * Below are various different --compression-workers combinations
+			 */
+			Entry("--compression-workers combos", "--compression-workers 4", true),
+			Entry("--compression-workers combos", "--compression-workers 4 --single-data-file --compression-type zstd", true),
+			Entry("--compression-workers combos", "--compression-workers 0", false),
+			Entry("--compression-workers combos", "--compression-workers 4 --no-compression", false),
+			Entry("--compression-workers combos", "--compression-workers 4 --dedup", false),
+
+			/*
+			 * Below are various different --dry-run combinations
+			 */
+			Entry("--dry-run combos", "--dry-run", true),
+			Entry("--dry-run combos", "--dry-run --include-schema public --exclude-table-larger-than 1GB", true),
+			Entry("--dry-run combos", "--dry-run --list-backups", false),
+			Entry("--dry-run combos", "--dry-run --status 20170101010101", false),
+			Entry("--dry-run combos", "--dry-run --retention-count 2", false),
+			Entry("--dry-run combos", "--dry-run --incremental --leaf-partition-data", false),
+			Entry("--dry-run combos", "--dry-run --resume 20170101010101", false),
+			Entry("--estimate combos", "--estimate", true),
+			Entry("--estimate combos", "--estimate --include-schema public --exclude-table-larger-than 1GB", true),
+			Entry("--estimate combos", "--estimate --dry-run", false),
+			Entry("--estimate combos", "--estimate --list-backups", false),
+			Entry("--estimate combos", "--estimate --incremental --leaf-partition-data", false),
+			Entry("--estimate combos", "--estimate --machine-output", false),
+
+			/*
+			 * Below are various different --diff combinations
+			 */
+			Entry("--diff combos", "--diff 20170101010101,20170102010101", true),
+			Entry("--diff combos", "--diff 20170101010101,20170102010101 --diff-format json", true),
+			Entry("--diff combos", "--diff 20170101010101", false),
+			Entry("--diff combos", "--diff 20170101010101,2017", false),
+			Entry("--diff combos", "--diff 20170101010101,20170102010101 --diff-format yaml", false),
+			Entry("--diff combos", "--diff-format json", false),
+			Entry("--diff combos", "--diff 20170101010101,20170102010101 --list-backups", false),
+
+			/*
+			 * Below are various different --list combinations
+			 */
+			Entry("--list combos", "--list 20170101010101", true),
+			Entry("--list combos", "--list 20170101010101 --list-format json --include-schema public --list-object-type table,index", true),
+			Entry("--list combos", "--list 2017", false),
+			Entry("--list combos", "--list 20170101010101 --list-backups", false),
+			Entry("--list combos", "--list-object-type table", false),
+			Entry("--migrate-history combos", "--migrate-history --history-db gpadmin", true),
+			Entry("--migrate-history combos", "--migrate-history", false),
+			Entry("--migrate-history combos", "--migrate-history --history-db gpadmin --list-backups", false),
+			Entry("--contended-tables-first combos", "--contended-tables-first --jobs 4", true),
+			Entry("--contended-tables-first combos", "--contended-tables-first --metadata-only", false),
+			Entry("--contended-tables-first combos", "--contended-tables-first --single-data-file", false),
+
+			/*
+			 * Below are various different --status combinations
+			 */
+			Entry("--status combos", "--status 20170101010101", true),
+			Entry("--status combos", "--status 2017", false),
+			Entry("--status combos", "--status 20170101010101 --list-backups", false),
+
+			/*
+			 * Below are various different --test-restore combinations
+			 */
+			Entry("--test-restore combos", "--test-restore 20170101010101", true),
+			Entry("--test-restore combos", "--test-restore 20170101010101 --backup-dir /tmp", true),
+			Entry("--test-restore combos", "--test-restore 2017", false),
+			Entry("--test-restore combos", "--test-restore 20170101010101 --status 20170101010101", false),
+			Entry("--test-restore combos", "--test-restore 20170101010101 --dry-run", false),
+			Entry("--test-restore combos", "--test-restore 20170101010101 --verify-sample 5%", true),
+			Entry("--test-restore combos", "--test-restore 20170101010101 --verify-sample 0.5 --verify-seed 42", true),
+			Entry("--test-restore combos", "--test-restore 20170101010101 --verify-sample 0%", false),
+			Entry("--test-restore combos", "--test-restore 20170101010101 --verify-sample 200%", false),
+			Entry("--test-restore combos", "--verify-sample 5%", false),
+			Entry("--test-restore combos", "--test-restore 20170101010101 --verify-seed 42", false),
+
+			/*
+			 * Below are various different --lock-timeout combinations
+			 */
+			Entry("--isolation-level combos", "--isolation-level repeatable-read", true),
+			Entry("--isolation-level combos", "--isolation-level serializable --jobs 4", true),
+			Entry("--isolation-level combos", "--isolation-level read-committed", false),
+			Entry("--data-layout combos", "--data-layout directory", true),
+			Entry("--data-layout combos", "--data-layout oid --single-data-file", true),
+			Entry("--data-layout combos", "--data-layout schema", false),
+			Entry("--data-layout combos", "--data-layout directory --single-data-file", false),
+			Entry("--data-layout combos", "--data-layout directory --dedup", false),
+			Entry("--data-layout combos", "--data-layout directory --plugin-config /tmp/config", false),
+			Entry("--machine-output combos", "--machine-output --quiet", true),
+			Entry("--machine-output combos", "--machine-output --list-backups", false),
+			Entry("--machine-output combos", "--machine-output --dry-run", false),
+			Entry("--machine-output combos", "--machine-output --all-databases", false),
+			Entry("--client-mode combos", "--client-mode --backup-dir /tmp", true),
+			Entry("--client-mode combos", "--client-mode --backup-dir /tmp --metadata-only", true),
+			Entry("--client-mode combos", "--client-mode", false),
+			Entry("--client-mode combos", "--client-mode --backup-dir /tmp --single-data-file", false),
+			Entry("--client-mode combos", "--client-mode --backup-dir /tmp --dedup", false),
+			Entry("--client-mode combos", "--client-mode --backup-dir /tmp --mirror-failover", false),
+			Entry("--client-mode combos", "--client-mode --backup-dir /tmp --retention-count 2", false),
+			Entry("--lock-timeout combos", "--lock-timeout 30", true),
+			Entry("--lock-timeout combos", "--lock-timeout 30 --skip-locked-tables", true),
+			Entry("--lock-timeout combos", "--skip-locked-tables", false),
+			Entry("--no-lock combos", "--no-lock", true),
+			Entry("--no-lock combos", "--no-lock --lock-timeout 30", false),
+			Entry("--no-lock combos", "--no-lock --lock-timeout 30 --skip-locked-tables", false),
+			Entry("--redact-credentials combos", "--redact-credentials", true),
+			Entry("--redact-credentials combos", "--redact-credentials --data-only", false),
+			Entry("--redact-credentials combos", "--credentials-key-file /tmp/key", false),
+			Entry("--lock-timeout combos", "--lock-timeout -1", false),
+			Entry("--wait-for-directory-lock combos", "--wait-for-directory-lock 600", true),
+			Entry("--wait-for-directory-lock combos", "--wait-for-directory-lock -1", false),
+			Entry("--skip-if-unchanged combos", "--skip-if-unchanged", true),
+			Entry("--skip-if-unchanged combos", "--skip-if-unchanged --incremental --leaf-partition-data", true),
+			Entry("--skip-if-unchanged combos", "--skip-if-unchanged --metadata-only", false),
+			Entry("--skip-if-unchanged combos", "--skip-if-unchanged --data-only", false),
+			Entry("--skip-if-unchanged combos", "--skip-if-unchanged --resume 20170101010101", false),
+
+			/*
+			 * Below are various different --leaf-partition-data-larger-than combinations
+			 */
+			Entry("--leaf-partition-data-larger-than combos", "--leaf-partition-data-larger-than 100GB --jobs 8", true),
+			Entry("--leaf-partition-data-larger-than combos", "--leaf-partition-data-larger-than 100GB --leaf-partition-data", false),
+			Entry("--leaf-partition-data-larger-than combos", "--leaf-partition-data-larger-than 100GB --single-data-file", false),
+			Entry("--leaf-partition-data-larger-than combos", "--leaf-partition-data-larger-than 100GB --include-table public.foo", false),
+			Entry("--leaf-partition-data-larger-than combos", "--leaf-partition-data-larger-than 100GB --metadata-only", false),
+
+			/*
+			 * Below are various different --split-table-data-larger-than combinations
+			 */
+			Entry("--split-table-data-larger-than combos", "--split-table-data-larger-than 100GB --jobs 8", true),
+			Entry("--split-table-data-larger-than combos", "--split-table-data-larger-than 100GB --jobs 8 --split-table-streams 8", true),
+			Entry("--split-table-data-larger-than combos", "--split-table-data-larger-than 100GB --split-table-streams 1", false),
+			Entry("--split-table-data-larger-than combos", "--split-table-data-larger-than 100GB --single-data-file", false),
+			Entry("--split-table-data-larger-than combos", "--split-table-data-larger-than 100GB --no-synchronized-snapshot", false),
+			Entry("--split-table-data-larger-than combos", "--split-table-data-larger-than lots", false),
+			Entry("--split-table-data-larger-than combos", "--split-table-streams 8", false),
+
+			/*
+			 * Below are various different --throttle-cpu-percent and --throttle-iowait-percent combinations
+			 */
+			Entry("--throttle combos", "--throttle-cpu-percent 80 --jobs 4", true),
+			Entry("--throttle combos", "--throttle-cpu-percent 80 --throttle-iowait-percent 30", true),
+			Entry("--throttle combos", "--throttle-cpu-percent 101", false),
+			Entry("--throttle combos", "--throttle-iowait-percent -1", false),
+			Entry("--copy-queue-size combos", "--copy-queue-size 16 --jobs 8", true),
+			Entry("--copy-queue-size combos", "--copy-queue-size -1", false),
+			Entry("--copy-queue-size combos", "--copy-queue-size 16 --metadata-only", false),
+			Entry("--no-segments combos", "--no-segments --metadata-only", true),
+			Entry("--no-segments combos", "--no-segments --metadata-only --backup-dir /tmp", true),
+			Entry("--no-segments combos", "--no-segments", false),
+			Entry("--no-segments combos", "--no-segments --metadata-only --plugin-config /tmp/config", false),
+			Entry("--no-segments combos", "--no-segments --metadata-only --mirror-failover --backup-dir /tmp", false),
+			Entry("--cleanup combos", "--cleanup 20170101010101", true),
+			Entry("--cleanup combos", "--cleanup 20170101", false),
+			Entry("--cleanup combos", "--cleanup 20170101010101 --test-restore 20170101010101", false),
+			Entry("--cleanup-on-failure combos", "--cleanup-on-failure always", true),
+			Entry("--cleanup-on-failure combos", "--cleanup-on-failure ask --backup-dir /tmp", true),
+			Entry("--cleanup-on-failure combos", "--cleanup-on-failure sometimes", false),
+			Entry("--cleanup-on-failure combos", "--cleanup-on-failure always --resume 20170101010101", false),
+			Entry("--cleanup-on-failure combos", "--cleanup-on-failure always --plugin-config /tmp/config", false),
 		)
 	})
 })
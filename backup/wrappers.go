@@ -2,15 +2,21 @@ package backup
 
 import (
 	"fmt"
+	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/nightlyone/lockfile"
 	"github.com/pkg/errors"
@@ -39,14 +45,33 @@ func SetLoggerVerbosity() {
 
 func initializeConnectionPool(timestamp string) {
 	connectionPool = dbconn.NewDBConnFromEnvironment(MustGetFlagString(options.DBNAME))
-	connectionPool.MustConnect(MustGetFlagInt(options.JOBS))
+	connectionPool.MustConnect(utils.GetNumJobs(MustGetFlagString(options.JOBS), MustGetFlagString(options.DBNAME)))
 	utils.ValidateGPDBVersionCompatibility(connectionPool)
 	InitializeMetadataParams(connectionPool)
+	snapshotID := MustGetFlagString(options.IMPORT_SNAPSHOT)
 	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
 		connectionPool.MustExec(fmt.Sprintf("SET application_name TO 'gpbackup_%s'", timestamp), connNum)
 		// BEGIN TRANSACTION
 		connectionPool.MustBegin(connNum)
+		SetTransactionIsolationLevel(connNum)
+		if snapshotID != "" {
+			ImportSnapshot(connectionPool, snapshotID, connNum)
+		}
 		SetSessionGUCs(connNum)
+		if connNum == 0 && snapshotID == "" && UseSynchronizedSnapshot(connectionPool, MustGetFlagBool(options.NO_SYNC_SNAPSHOT)) {
+			snapshotID = ExportSnapshot(connectionPool)
+		}
+	}
+}
+
+/*
+ * Begin makes the transaction SERIALIZABLE, so the isolation level is only
+ * changed for other levels.  This must be done before the transaction runs
+ * any query.
+ */
+func SetTransactionIsolationLevel(connNum int) {
+	if isolationLevel := MustGetFlagString(options.ISOLATION_LEVEL); isolationLevel != ISOLATION_SERIALIZABLE {
+		connectionPool.MustExec(fmt.Sprintf("SET TRANSACTION ISOLATION LEVEL %s", GetIsolationLevelSQL(isolationLevel)), connNum)
 	}
 }
 
@@ -81,20 +106,28 @@ func NewBackupConfig(dbName string, dbVersion string, backupVersion string, plug
 		BackupVersion:         backupVersion,
 		Compressed:            !MustGetFlagBool(options.NO_COMPRESSION),
 		CompressionType:       MustGetFlagString(options.COMPRESSION_TYPE),
+		DatabaseGroup:         MustGetFlagString(options.DATABASE_GROUP),
 		DatabaseName:          dbName,
 		DatabaseVersion:       dbVersion,
+		Dedup:                 MustGetFlagBool(options.DEDUP),
+		DataLayout:            MustGetFlagString(options.DATA_LAYOUT),
 		DataOnly:              MustGetFlagBool(options.DATA_ONLY),
+		Differential:          MustGetFlagBool(options.DIFFERENTIAL),
 		ExcludeRelations:      MustGetFlagStringArray(options.EXCLUDE_RELATION),
 		ExcludeSchemaFiltered: len(MustGetFlagStringArray(options.EXCLUDE_SCHEMA)) > 0,
 		ExcludeSchemas:        MustGetFlagStringArray(options.EXCLUDE_SCHEMA),
 		ExcludeTableFiltered:  len(MustGetFlagStringArray(options.EXCLUDE_RELATION)) > 0,
+		FormatVersion:         history.CURRENT_FORMAT_VERSION,
+		GlobalsFile:           MustGetFlagBool(options.WITH_GLOBALS),
 		IncludeRelations:      opts.GetOriginalIncludedTables(),
 		IncludeSchemaFiltered: len(MustGetFlagStringArray(options.INCLUDE_SCHEMA)) > 0,
 		IncludeSchemas:        MustGetFlagStringArray(options.INCLUDE_SCHEMA),
 		IncludeTableFiltered:  len(opts.GetOriginalIncludedTables()) > 0,
 		Incremental:           MustGetFlagBool(options.INCREMENTAL),
+		IsolationLevel:        MustGetFlagString(options.ISOLATION_LEVEL),
 		LeafPartitionData:     MustGetFlagBool(options.LEAF_PARTITION_DATA),
 		MetadataOnly:          MustGetFlagBool(options.METADATA_ONLY),
+		NoLock:                MustGetFlagBool(options.NO_LOCK),
 		Plugin:                plugin,
 		SingleDataFile:        MustGetFlagBool(options.SINGLE_DATA_FILE),
 		Timestamp:             timestamp,
@@ -114,6 +147,15 @@ func initializeBackupReport(opts options.Options) {
 	}
 	config := NewBackupConfig(escapedDBName, connectionPool.Version.VersionString, version,
 		plugin, globalFPInfo.Timestamp, opts)
+	config.SegmentCount = len(globalCluster.ContentIDs) - 1
+	db := GetDatabaseInfo(connectionPool)
+	config.DatabaseCollate = db.Collate
+	config.DatabaseCType = db.CType
+	config.DatabaseEncoding = db.Encoding
+	config.DatabaseTablespace = db.Tablespace
+	if MustGetFlagString(options.IMPORT_SNAPSHOT) != "" {
+		config.SharedSnapshot = GetTransactionSnapshot(connectionPool)
+	}
 
 	isFilteredBackup := config.IncludeTableFiltered || config.IncludeSchemaFiltered ||
 		config.ExcludeTableFiltered || config.ExcludeSchemaFiltered
@@ -133,7 +175,11 @@ func initializeBackupReport(opts options.Options) {
 
 func createBackupLockFile(timestamp string) {
 	var err error
-	timestampLockFile := fmt.Sprintf("/tmp/%s.lck", timestamp)
+	lockDir := "/tmp"
+	if runtime.GOOS == "windows" {
+		lockDir = os.TempDir()
+	}
+	timestampLockFile := filepath.Join(lockDir, fmt.Sprintf("%s.lck", timestamp))
 	backupLockFile, err = lockfile.New(timestampLockFile)
 	gplog.FatalOnError(err)
 	err = backupLockFile.TryLock()
@@ -143,6 +189,18 @@ func createBackupLockFile(timestamp string) {
 	}
 }
 
+/*
+ * The timestamp lock file only keeps two backups from starting in the same
+ * second, so each backup also locks its backup directory on the master to
+ * keep backups with different timestamps from writing to it at once.
+ */
+func lockBackupDirectory() {
+	var err error
+	wait := time.Duration(MustGetFlagInt(options.WAIT_FOR_DIR_LOCK)) * time.Second
+	backupDirectoryLock, err = utils.AcquireDirectoryLock(globalFPInfo.GetBackupRootDirForContent(-1), "gpbackup", globalFPInfo.Timestamp, wait)
+	gplog.FatalOnError(err)
+}
+
 func createBackupDirectoriesOnAllHosts() {
 	remoteOutput := globalCluster.GenerateAndExecuteCommand("Creating backup directories",
 		cluster.ON_SEGMENTS|cluster.INCLUDE_MASTER,
@@ -159,22 +217,208 @@ func createBackupDirectoriesOnAllHosts() {
  */
 
 func RetrieveAndProcessTables() ([]Table, []Table) {
+	tableRelations, quotedIncludeRelations := retrieveTableRelations()
+	tableRelations = lockTableRelations(tableRelations)
+
+	metadataTables, dataTables := processTableRelations(tableRelations, quotedIncludeRelations)
+	dataTables, dataExcludedTables := excludeTableData(dataTables)
+	for _, table := range dataExcludedTables {
+		globalTOC.DataExcludedEntries = append(globalTOC.DataExcludedEntries, toc.MasterDataEntry{
+			Schema:        table.Schema,
+			Name:          table.Name,
+			Oid:           table.Oid,
+			PartitionRoot: table.PartitionLevelInfo.RootName,
+		})
+	}
+	objectCounts["Tables"] = len(metadataTables)
+
+	return metadataTables, dataTables
+}
+
+/*
+ * Locks the tables while logging the sessions blocking the backup, and
+ * returns the tables that were locked.  With --skip-locked-tables, the tables
+ * that could not be locked within --lock-timeout are recorded in the report.
+ * With --no-lock, no tables are locked and all of them are returned.
+ */
+func lockTableRelations(tableRelations []Relation) []Relation {
+	if MustGetFlagBool(options.NO_LOCK) {
+		gplog.Warn("Not locking tables due to --no-lock.  Tables changed by concurrent DDL may be backed up inconsistently.")
+		return tableRelations
+	}
+	stopLockWaitMonitor := startLockWaitMonitor(globalFPInfo.Timestamp)
+	lockedRelations, skippedRelations := LockTables(connectionPool, tableRelations,
+		MustGetFlagInt(options.LOCK_TIMEOUT), MustGetFlagBool(options.SKIP_LOCKED_TABLES))
+	stopLockWaitMonitor()
+	if len(skippedRelations) > 0 {
+		gplog.Warn("Skipping %d table(s) that could not be locked within %d seconds", len(skippedRelations), MustGetFlagInt(options.LOCK_TIMEOUT))
+	}
+	for _, relation := range skippedRelations {
+		backupReport.LockSkippedTables = append(backupReport.LockSkippedTables, relation.FQN())
+	}
+	return lockedRelations
+}
+
+/*
+ * Returns the user tables to be backed up, which must be locked before their
+ * definitions are retrieved, along with the quoted names of the included
+ * relations.
+ */
+func retrieveTableRelations() ([]Relation, []string) {
 	quotedIncludeRelations, err := options.QuoteTableNames(connectionPool, MustGetFlagStringArray(options.INCLUDE_RELATION))
 	gplog.FatalOnError(err)
 
 	tableRelations := GetIncludedUserTableRelations(connectionPool, quotedIncludeRelations)
-	LockTables(connectionPool, tableRelations)
+	tableRelations = filterTableRelationsBySize(tableRelations)
+	tableRelations = append(tableRelations, retrieveSplitPartitionLeaves(tableRelations)...)
+	return tableRelations, quotedIncludeRelations
+}
+
+/*
+ * Returns the leaf partitions of the partitioned tables larger than
+ * --leaf-partition-data-larger-than, whose data is backed up separately so
+ * that the leaf partitions of a single large table can be copied in parallel.
+ */
+func retrieveSplitPartitionLeaves(tableRelations []Relation) []Relation {
+	sizeStr := MustGetFlagString(options.LEAF_DATA_LARGER_THAN)
+	if sizeStr == "" {
+		return []Relation{}
+	}
+	threshold, err := utils.ParseSize(sizeStr)
+	gplog.FatalOnError(err)
+	leaves := GetPartitionLeavesLargerThan(connectionPool, tableRelations, threshold)
+	splitPartitionRoots = make(map[uint32]bool)
+	leafRelations := make([]Relation, 0, len(leaves))
+	for _, leaf := range leaves {
+		splitPartitionRoots[leaf.RootOid] = true
+		leafRelations = append(leafRelations, leaf.Relation)
+	}
+	if len(splitPartitionRoots) > 0 {
+		gplog.Info("Backing up the data of %d leaf partition(s) of %d partitioned table(s) larger than %s separately", len(leafRelations), len(splitPartitionRoots), sizeStr)
+	}
+	return leafRelations
+}
+
+/*
+ * Returns the number of streams of each non-partitioned table larger than
+ * --split-table-data-larger-than.  The streams of a table are copied by
+ * different connections, so they must share a snapshot to copy each row
+ * exactly once.
+ */
+func retrieveSplitTables(tables []Table) map[uint32]int {
+	sizeStr := MustGetFlagString(options.SPLIT_LARGER_THAN)
+	if sizeStr == "" {
+		return map[uint32]int{}
+	}
+	if !UseSynchronizedSnapshot(connectionPool, MustGetFlagBool(options.NO_SYNC_SNAPSHOT)) {
+		gplog.Warn("The data of tables larger than %s will not be split, as the connections of this backup do not share a snapshot", sizeStr)
+		return map[uint32]int{}
+	}
+	threshold, err := utils.ParseSize(sizeStr)
+	gplog.FatalOnError(err)
+	tablesToSplit := GetSplitTables(tables, tableSizes, threshold, MustGetFlagInt(options.SPLIT_TABLE_STREAMS), connectionPool.NumConns)
+	if len(tablesToSplit) > 0 {
+		gplog.Info("Backing up the data of %d table(s) larger than %s with multiple COPY statements each", len(tablesToSplit), sizeStr)
+	}
+	return tablesToSplit
+}
 
+func processTableRelations(tableRelations []Relation, quotedIncludeRelations []string) ([]Table, []Table) {
 	if connectionPool.Version.AtLeast("6") {
 		tableRelations = append(tableRelations, GetForeignTableRelations(connectionPool)...)
 	}
 
 	tables := ConstructDefinitionsForTables(connectionPool, tableRelations)
 
-	metadataTables, dataTables := SplitTablesByPartitionType(tables, quotedIncludeRelations)
-	objectCounts["Tables"] = len(metadataTables)
+	return SplitTablesByPartitionType(tables, quotedIncludeRelations)
+}
 
-	return metadataTables, dataTables
+/*
+ * Reads the per-table compression overrides file, if any, and returns the
+ * overrides keyed by quoted table name so they can be matched against Table.FQN().
+ */
+func getCompressionOverrides() map[string]utils.PipeThroughProgram {
+	overrides := make(map[string]utils.PipeThroughProgram)
+	overrideFile := MustGetFlagString(options.COMPRESSION_OVERRIDES)
+	if overrideFile == "" {
+		return overrides
+	}
+	lines, err := iohelper.ReadLinesFromFile(overrideFile)
+	gplog.FatalOnError(err)
+	unquotedOverrides, err := utils.ParseCompressionOverrides(lines, MustGetFlagString(options.COMPRESSION_TYPE), MustGetFlagInt(options.COMPRESSION_WORKERS))
+	gplog.FatalOnError(err)
+	for tableName, program := range unquotedOverrides {
+		quotedNames, err := options.QuoteTableNames(connectionPool, []string{tableName})
+		gplog.FatalOnError(err)
+		overrides[quotedNames[0]] = program
+	}
+	return overrides
+}
+
+func filterTableRelationsBySize(tableRelations []Relation) []Relation {
+	maxSize, isSizeFiltered := getMaxTableSize()
+	if !isSizeFiltered {
+		return tableRelations
+	}
+	gplog.Info("Gathering table sizes")
+	relationSizes := GetRelationSizes(connectionPool, tableRelations)
+	includedRelations, skippedRelations := FilterRelationsBySize(tableRelations, relationSizes, maxSize)
+	if len(skippedRelations) > 0 {
+		gplog.Info("Skipping %d table(s) exceeding the table size threshold", len(skippedRelations))
+	}
+	for _, relation := range skippedRelations {
+		gplog.Verbose("Skipping table %s of size %d bytes", relation.FQN(), relationSizes[relation.Oid])
+		backupReport.SizeFilteredTables = append(backupReport.SizeFilteredTables, relation.FQN())
+	}
+	return includedRelations
+}
+
+/*
+ * Splits the data tables into those whose data is backed up and those whose
+ * data is excluded with --exclude-table-data, which are recorded in the
+ * report.
+ */
+func excludeTableData(dataTables []Table) ([]Table, []Table) {
+	excludeRelations := MustGetFlagStringArray(options.EXCLUDE_TABLE_DATA)
+	if len(excludeRelations) == 0 {
+		return dataTables, []Table{}
+	}
+	quotedExcludeRelations, err := options.QuoteTableNames(connectionPool, excludeRelations)
+	gplog.FatalOnError(err)
+	includedTables, excludedTables := FilterTablesByExcludedData(dataTables, quotedExcludeRelations)
+	if len(excludedTables) > 0 {
+		gplog.Info("Backing up only the metadata of %d table(s) whose data is excluded", len(excludedTables))
+	}
+	for _, table := range excludedTables {
+		gplog.Verbose("Excluding the data of table %s", table.FQN())
+		backupReport.DataExcludedTables = append(backupReport.DataExcludedTables, table.FQN())
+	}
+	return includedTables, excludedTables
+}
+
+/*
+ * Returns the largest table size in bytes that will be backed up, taking
+ * into account both --exclude-table-larger-than and
+ * --include-table-smaller-than, and whether either flag was specified.
+ */
+func getMaxTableSize() (int64, bool) {
+	var maxSize int64
+	isSizeFiltered := false
+	if sizeStr := MustGetFlagString(options.EXCLUDE_LARGER_THAN); sizeStr != "" {
+		size, err := utils.ParseSize(sizeStr)
+		gplog.FatalOnError(err)
+		maxSize = size
+		isSizeFiltered = true
+	}
+	if sizeStr := MustGetFlagString(options.INCLUDE_SMALLER_THAN); sizeStr != "" {
+		size, err := utils.ParseSize(sizeStr)
+		gplog.FatalOnError(err)
+		if !isSizeFiltered || size-1 < maxSize {
+			maxSize = size - 1
+		}
+		isSizeFiltered = true
+	}
+	return maxSize, isSizeFiltered
 }
 
 func retrieveFunctions(sortables *[]Sortable, metadataMap MetadataMap) ([]Function, map[uint32]FunctionInfo) {
@@ -388,6 +632,28 @@ func retrieveUserMappings(sortables *[]Sortable) {
 	*sortables = append(*sortables, convertToSortableSlice(mappings)...)
 }
 
+/*
+ * With --credentials-key-file, the credentials redacted from the metadata
+ * file are written to the encrypted credentials file for gprestore.
+ */
+func writeRedactedCredentials() {
+	if redactedCredentials == nil {
+		return
+	}
+	gplog.Info("Redacted %d credential(s) from the metadata file", len(redactedCredentials))
+	keyFilename := MustGetFlagString(options.CREDENTIALS_KEY_FILE)
+	if keyFilename == "" || len(redactedCredentials) == 0 {
+		return
+	}
+	key, err := utils.ReadCredentialsKey(keyFilename)
+	gplog.FatalOnError(err)
+	credentialsFilename := globalFPInfo.GetCredentialsFilePath()
+	err = utils.WriteCredentialsFile(credentialsFilename, redactedCredentials, key)
+	gplog.FatalOnError(err)
+	backupReport.CredentialsFile = true
+	gplog.Info("Redacted credentials written to %s", credentialsFilename)
+}
+
 func backupSessionGUC(metadataFile *utils.FileWithByteCount) {
 	gplog.Verbose("Writing Session Configuration Parameters to metadata file")
 	gucs := GetSessionGUCs(connectionPool)
@@ -591,7 +857,11 @@ func backupExtensions(metadataFile *utils.FileWithByteCount) {
 	}
 	gplog.Verbose("Writing CREATE EXTENSION statements to metadata file")
 	extensions := GetExtensions(connectionPool)
+	extensions = SortExtensions(extensions, GetExtensionDependencies(connectionPool, extensions))
 	objectCounts["Extensions"] = len(extensions)
+	for _, extension := range extensions {
+		gplog.Verbose("Extension %s version %s has %d member objects, which CREATE EXTENSION will create", extension.Name, extension.Version, extension.MemberCount)
+	}
 	extensionMetadata := GetCommentsForObjectType(connectionPool, TYPE_EXTENSION)
 	PrintCreateExtensionStatements(metadataFile, globalTOC, extensions, extensionMetadata)
 }
@@ -614,6 +884,12 @@ func backupIndexes(metadataFile *utils.FileWithByteCount) {
 	PrintCreateIndexStatements(metadataFile, globalTOC, indexes, indexMetadata)
 }
 
+func backupMaterializedViewRefreshes(metadataFile *utils.FileWithByteCount) {
+	gplog.Verbose("Writing REFRESH MATERIALIZED VIEW statements to metadata file")
+	views := GetPopulatedMaterializedViews(connectionPool)
+	PrintRefreshMaterializedViewStatements(metadataFile, globalTOC, views)
+}
+
 func backupRules(metadataFile *utils.FileWithByteCount) {
 	gplog.Verbose("Writing CREATE RULE statements to metadata file")
 	rules := GetRules(connectionPool)
@@ -630,6 +906,15 @@ func backupTriggers(metadataFile *utils.FileWithByteCount) {
 	PrintCreateTriggerStatements(metadataFile, globalTOC, triggers, triggerMetadata)
 }
 
+func backupRowSecurity(metadataFile *utils.FileWithByteCount) {
+	gplog.Verbose("Writing CREATE POLICY statements to metadata file")
+	policies := GetRowSecurityPolicies(connectionPool)
+	objectCounts["Policies"] = len(policies)
+	policyMetadata := GetCommentsForObjectType(connectionPool, TYPE_POLICY)
+	PrintCreatePolicyStatements(metadataFile, globalTOC, policies, policyMetadata)
+	PrintEnableRowSecurityStatements(metadataFile, globalTOC, GetRowSecurityTables(connectionPool))
+}
+
 func backupEventTriggers(metadataFile *utils.FileWithByteCount) {
 	gplog.Verbose("Writing CREATE EVENT TRIGGER statements to metadata file")
 	eventTriggers := GetEventTriggers(connectionPool)
@@ -660,4 +945,6 @@ func backupTableStatistics(statisticsFile *utils.FileWithByteCount, tables []Tab
 func backupIncrementalMetadata() {
 	aoTableEntries := GetAOIncrementalMetadata(connectionPool)
 	globalTOC.IncrementalMetadata.AO = aoTableEntries
+	heapTableEntries := GetHeapIncrementalMetadata(connectionPool)
+	globalTOC.IncrementalMetadata.Heap = heapTableEntries
 }
@@ -26,6 +26,57 @@ type FilePathInfo struct {
 	Timestamp              string
 	UserSpecifiedBackupDir string
 	UserSpecifiedSegPrefix string
+	// The data file of each table of a --data-layout directory backup, by oid
+	DataFiles map[uint32]string
+}
+
+/*
+ * The data file of each table in a deduplicated backup lists its chunks
+ * rather than holding its data.
+ */
+const DedupDataFileExtension = ".chunks"
+
+/*
+ * In the oid layout, the data file of each table on a segment is named for
+ * the backup timestamp and the oid of the table.  In the directory layout, it
+ * is named for the table and placed in a directory named for its schema, so
+ * that the files of a table have the same path in every backup.
+ */
+const (
+	DataLayoutOid       = "oid"
+	DataLayoutDirectory = "directory"
+)
+
+func ValidateDataLayout(layout string) error {
+	if layout != DataLayoutOid && layout != DataLayoutDirectory {
+		return fmt.Errorf("Invalid data layout '%s'.  Valid values are '%s' and '%s'.", layout, DataLayoutOid, DataLayoutDirectory)
+	}
+	return nil
+}
+
+/*
+ * Returns the path of the data file of a table in the directory layout,
+ * relative to the backup directory of a segment and without an extension.
+ * The schema and table names must be unquoted.  Any character of a name that
+ * is not a letter, digit, underscore, or hyphen is written as %XX, so that the
+ * path is safe to use in a shell command and a "." in the file name always
+ * starts an extension.
+ */
+func GetDirectoryLayoutDataFile(schema string, table string) string {
+	return path.Join(escapePathComponent(schema), escapePathComponent(table))
+}
+
+func escapePathComponent(name string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-' {
+			escaped.WriteByte(c)
+		} else {
+			escaped.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+	return escaped.String()
 }
 
 func NewFilePathInfo(c *cluster.Cluster, userSpecifiedBackupDir string, timestamp string, userSegPrefix string) FilePathInfo {
@@ -83,28 +134,69 @@ func (backupFPInfo *FilePathInfo) GetTableBackupFilePath(contentID int, tableOid
 }
 
 func (backupFPInfo *FilePathInfo) GetTableBackupFilePathForCopyCommand(tableOid uint32, extension string, singleDataFile bool) string {
+	if dataFile, ok := backupFPInfo.DataFiles[tableOid]; ok && !singleDataFile {
+		return path.Join(backupFPInfo.GetDirForCopyCommand(), dataFile+extension)
+	}
 	backupFilePath := fmt.Sprintf("gpbackup_<SEGID>_%s", backupFPInfo.Timestamp)
 	if !singleDataFile {
 		backupFilePath += fmt.Sprintf("_%d", tableOid)
 	}
 
 	backupFilePath += extension
+	return path.Join(backupFPInfo.GetDirForCopyCommand(), backupFilePath)
+}
+
+/*
+ * The backup directory of each segment, in the form used by COPY ON SEGMENT,
+ * in which each segment replaces <SEG_DATA_DIR> and <SEGID> with its own.
+ */
+func (backupFPInfo *FilePathInfo) GetDirForCopyCommand() string {
 	baseDir := "<SEG_DATA_DIR>"
 	if backupFPInfo.IsUserSpecifiedBackupDir() {
 		baseDir = path.Join(backupFPInfo.UserSpecifiedBackupDir, fmt.Sprintf("%s<SEGID>", backupFPInfo.UserSpecifiedSegPrefix))
 	}
-	return path.Join(baseDir, "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp, backupFilePath)
+	return path.Join(baseDir, "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp)
+}
+
+/*
+ * The data of a table split with --split-table-data-larger-than is written to
+ * one file for each of its streams on every segment.
+ */
+func (backupFPInfo *FilePathInfo) GetTableStreamBackupFilePath(contentID int, tableOid uint32, stream int, extension string) string {
+	templateFilePath := backupFPInfo.GetTableStreamBackupFilePathForCopyCommand(tableOid, stream, extension)
+	return backupFPInfo.replaceCopyFormatStringsInPath(templateFilePath, contentID)
+}
+
+func (backupFPInfo *FilePathInfo) GetTableStreamBackupFilePathForCopyCommand(tableOid uint32, stream int, extension string) string {
+	if _, ok := backupFPInfo.DataFiles[tableOid]; ok {
+		return backupFPInfo.GetTableBackupFilePathForCopyCommand(tableOid, fmt.Sprintf(".%d%s", stream, extension), false)
+	}
+	return backupFPInfo.GetTableBackupFilePathForCopyCommand(tableOid, fmt.Sprintf("_%d%s", stream, extension), false)
 }
 
 var metadataFilenameMap = map[string]string{
 	"config":                "config.yaml",
 	"metadata":              "metadata.sql",
 	"statistics":            "statistics.sql",
+	"globals":               "globals.sql",
 	"table of contents":     "toc.yaml",
+	"toc_progress":          "toc_progress.jsonl",
 	"report":                "report",
 	"plugin_config":         "plugin_config.yaml",
 	"error_tables_metadata": "error_tables_metadata",
 	"error_tables_data":     "error_tables_data",
+	"conflict_mapping":      "conflict_mapping",
+	"failed_objects":        "failed_objects.json",
+	"dry_run":               "dry_run.sql",
+	"journal":               "journal",
+	"status":                "status.yaml",
+	"progress":              "progress.jsonl",
+	"log_level":             "log_level",
+	"preflight":             "preflight",
+	"credentials":           "credentials.enc",
+	"table_timings":         "table_timings.csv",
+	"restore_phases":        "restore_phases.yaml",
+	"statement_transforms":  "statement_transforms.json",
 }
 
 func (backupFPInfo *FilePathInfo) GetBackupFilePath(filetype string) string {
@@ -116,6 +208,11 @@ func (backupFPInfo *FilePathInfo) GetBackupHistoryFilePath() string {
 	return path.Join(masterDataDirectoryPath, "gpbackup_history.yaml")
 }
 
+func (backupFPInfo *FilePathInfo) GetRestoreHistoryFilePath() string {
+	masterDataDirectoryPath := backupFPInfo.SegDirMap[-1]
+	return path.Join(masterDataDirectoryPath, "gprestore_history.yaml")
+}
+
 func (backupFPInfo *FilePathInfo) GetMetadataFilePath() string {
 	return backupFPInfo.GetBackupFilePath("metadata")
 }
@@ -124,6 +221,10 @@ func (backupFPInfo *FilePathInfo) GetStatisticsFilePath() string {
 	return backupFPInfo.GetBackupFilePath("statistics")
 }
 
+func (backupFPInfo *FilePathInfo) GetGlobalsFilePath() string {
+	return backupFPInfo.GetBackupFilePath("globals")
+}
+
 func (backupFPInfo *FilePathInfo) GetTOCFilePath() string {
 	return backupFPInfo.GetBackupFilePath("table of contents")
 }
@@ -148,6 +249,74 @@ func (backupFPInfo *FilePathInfo) GetErrorTablesDataFilePath(restoreTimestamp st
 	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "error_tables_data")
 }
 
+func (backupFPInfo *FilePathInfo) GetConflictMappingFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "conflict_mapping")
+}
+
+func (backupFPInfo *FilePathInfo) GetFailedObjectsFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "failed_objects")
+}
+
+func (backupFPInfo *FilePathInfo) GetStatementTransformsFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "statement_transforms")
+}
+
+func (backupFPInfo *FilePathInfo) GetDryRunFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "dry_run")
+}
+
+func (backupFPInfo *FilePathInfo) GetBackupJournalFilePath() string {
+	return backupFPInfo.GetBackupFilePath("journal")
+}
+
+func (backupFPInfo *FilePathInfo) GetTOCProgressFilePath() string {
+	return backupFPInfo.GetBackupFilePath("toc_progress")
+}
+
+func (backupFPInfo *FilePathInfo) GetBackupStatusFilePath() string {
+	return backupFPInfo.GetBackupFilePath("status")
+}
+
+func (backupFPInfo *FilePathInfo) GetBackupPreflightFilePath() string {
+	return backupFPInfo.GetBackupFilePath("preflight")
+}
+
+func (backupFPInfo *FilePathInfo) GetCredentialsFilePath() string {
+	return backupFPInfo.GetBackupFilePath("credentials")
+}
+
+func (backupFPInfo *FilePathInfo) GetBackupTableTimingsFilePath() string {
+	return backupFPInfo.GetBackupFilePath("table_timings")
+}
+
+func (backupFPInfo *FilePathInfo) GetRestoreTableTimingsFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "table_timings")
+}
+
+func (backupFPInfo *FilePathInfo) GetRestoreStatusFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "status")
+}
+
+func (backupFPInfo *FilePathInfo) GetBackupLogLevelFilePath() string {
+	return backupFPInfo.GetBackupFilePath("log_level")
+}
+
+func (backupFPInfo *FilePathInfo) GetRestoreLogLevelFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "log_level")
+}
+
+func (backupFPInfo *FilePathInfo) GetRestoreProgressFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "progress")
+}
+
+/*
+ * The phases restored with --phase are recorded for the backup rather than
+ * for each restore, as each phase is restored by a separate gprestore run.
+ */
+func (backupFPInfo *FilePathInfo) GetRestorePhasesFilePath() string {
+	return backupFPInfo.GetBackupFilePath("restore_phases")
+}
+
 func (backupFPInfo *FilePathInfo) GetConfigFilePath() string {
 	return backupFPInfo.GetBackupFilePath("config")
 }
@@ -156,6 +325,37 @@ func (backupFPInfo *FilePathInfo) GetSegmentTOCFilePath(contentID int) string {
 	return fmt.Sprintf("%s/gpbackup_%d_%s_toc.yaml", backupFPInfo.GetDirForContent(contentID), contentID, backupFPInfo.Timestamp)
 }
 
+func (backupFPInfo *FilePathInfo) GetSegmentChunkIndexFilePath(contentID int) string {
+	return fmt.Sprintf("%s/gpbackup_%d_%s_chunk_index", backupFPInfo.GetDirForContent(contentID), contentID, backupFPInfo.Timestamp)
+}
+
+/*
+ * The directory under which the date directories of all of the backups in
+ * the same backup directory are created.
+ */
+func (backupFPInfo *FilePathInfo) GetBackupRootDirForContent(contentID int) string {
+	return path.Dir(path.Dir(backupFPInfo.GetDirForContent(contentID)))
+}
+
+/*
+ * The chunks of deduplicated backups are shared by every backup in the same
+ * backup directory, so the chunk directory does not depend on the timestamp.
+ */
+func (backupFPInfo *FilePathInfo) GetChunkDirForContent(contentID int) string {
+	if backupFPInfo.IsUserSpecifiedBackupDir() {
+		segDir := fmt.Sprintf("%s%d", backupFPInfo.UserSpecifiedSegPrefix, contentID)
+		return path.Join(backupFPInfo.UserSpecifiedBackupDir, segDir, "backups", "chunks")
+	}
+	return path.Join(backupFPInfo.SegDirMap[contentID], "backups", "chunks")
+}
+
+func (backupFPInfo *FilePathInfo) GetChunkDirForCopyCommand() string {
+	if backupFPInfo.IsUserSpecifiedBackupDir() {
+		return path.Join(backupFPInfo.UserSpecifiedBackupDir, fmt.Sprintf("%s<SEGID>", backupFPInfo.UserSpecifiedSegPrefix), "backups", "chunks")
+	}
+	return path.Join("<SEG_DATA_DIR>", "backups", "chunks")
+}
+
 func (backupFPInfo *FilePathInfo) GetPluginConfigPath() string {
 	return backupFPInfo.GetBackupFilePath("plugin_config")
 }
@@ -63,6 +63,16 @@ var _ = Describe("filepath tests", func() {
 			Expect(fpInfo.GetDirForContent(-1)).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101"))
 		})
 	})
+	Describe("GetDirForCopyCommand()", func() {
+		It("returns the segment directory for copy command", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetDirForCopyCommand()).To(Equal("<SEG_DATA_DIR>/backups/20170101/20170101010101"))
+		})
+		It("returns the segment directory for copy command based on user specified path", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
+			Expect(fpInfo.GetDirForCopyCommand()).To(Equal("/foo/bar/gpseg<SEGID>/backups/20170101/20170101010101"))
+		})
+	})
 	Describe("GetTableBackupFilePathForCopyCommand()", func() {
 		It("returns table file path for copy command", func() {
 			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
@@ -97,6 +107,66 @@ var _ = Describe("filepath tests", func() {
 			Expect(fpInfo.GetTableBackupFilePathForCopyCommand(1234, ".gzip", true)).To(Equal("/foo/bar/gpseg<SEGID>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101.gzip"))
 		})
 	})
+	Describe("GetTableStreamBackupFilePath", func() {
+		It("returns the file path of a stream of a table for copy command", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetTableStreamBackupFilePathForCopyCommand(1234, 2, ".gz")).To(Equal("<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1234_2.gz"))
+		})
+		It("returns the file path of a stream of a table on a segment based on user specified path", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
+			Expect(fpInfo.GetTableStreamBackupFilePath(-1, 1234, 0, "")).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_-1_20170101010101_1234_0"))
+		})
+	})
+	Describe("GetDirectoryLayoutDataFile", func() {
+		It("returns the schema and table as a path", func() {
+			Expect(GetDirectoryLayoutDataFile("public", "foo_bar-1")).To(Equal("public/foo_bar-1"))
+		})
+		It("escapes characters that are not safe in a path or shell command", func() {
+			Expect(GetDirectoryLayoutDataFile("my schema", "a.b/c%'d")).To(Equal("my%20schema/a%2Eb%2Fc%25%27d"))
+		})
+		It("escapes names that are special in a path", func() {
+			Expect(GetDirectoryLayoutDataFile("..", ".")).To(Equal("%2E%2E/%2E"))
+		})
+	})
+	Describe("directory layout data file paths", func() {
+		var fpInfo FilePathInfo
+		BeforeEach(func() {
+			fpInfo = NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
+			fpInfo.DataFiles = map[uint32]string{1234: "public/foo"}
+		})
+		It("returns the table file path for copy command", func() {
+			Expect(fpInfo.GetTableBackupFilePathForCopyCommand(1234, ".gz", false)).To(Equal("/foo/bar/gpseg<SEGID>/backups/20170101/20170101010101/public/foo.gz"))
+		})
+		It("returns the table file path on a segment", func() {
+			Expect(fpInfo.GetTableBackupFilePath(0, 1234, ".gz", false)).To(Equal("/foo/bar/gpseg0/backups/20170101/20170101010101/public/foo.gz"))
+		})
+		It("returns the file path of a stream of a table", func() {
+			Expect(fpInfo.GetTableStreamBackupFilePathForCopyCommand(1234, 2, ".gz")).To(Equal("/foo/bar/gpseg<SEGID>/backups/20170101/20170101010101/public/foo.2.gz"))
+		})
+		It("returns the oid file path of a table without a data file", func() {
+			Expect(fpInfo.GetTableBackupFilePathForCopyCommand(5678, ".gz", false)).To(Equal("/foo/bar/gpseg<SEGID>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_5678.gz"))
+		})
+	})
+	Describe("GetChunkDirForContent", func() {
+		It("returns the chunk directory in the segment data directory", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetChunkDirForContent(-1)).To(Equal("/data/gpseg-1/backups/chunks"))
+		})
+		It("returns the chunk directory based on user specified path", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
+			Expect(fpInfo.GetChunkDirForContent(-1)).To(Equal("/foo/bar/gpseg-1/backups/chunks"))
+		})
+	})
+	Describe("GetChunkDirForCopyCommand", func() {
+		It("returns the chunk directory for copy command", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetChunkDirForCopyCommand()).To(Equal("<SEG_DATA_DIR>/backups/chunks"))
+		})
+		It("returns the chunk directory for copy command based on user specified path", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
+			Expect(fpInfo.GetChunkDirForCopyCommand()).To(Equal("/foo/bar/gpseg<SEGID>/backups/chunks"))
+		})
+	})
 	Describe("GetReportFilePath", func() {
 		It("returns report file path", func() {
 			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
@@ -107,6 +177,20 @@ var _ = Describe("filepath tests", func() {
 			Expect(fpInfo.GetBackupReportFilePath()).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_report"))
 		})
 	})
+	Describe("GetTableTimingsFilePath", func() {
+		It("returns the table timings file paths for backup and restore", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetBackupTableTimingsFilePath()).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_table_timings.csv"))
+			Expect(fpInfo.GetRestoreTableTimingsFilePath("20170102010101")).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gprestore_20170101010101_20170102010101_table_timings.csv"))
+		})
+	})
+	Describe("GetLogLevelFilePath", func() {
+		It("returns the log level control file paths for backup and restore", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetBackupLogLevelFilePath()).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_log_level"))
+			Expect(fpInfo.GetRestoreLogLevelFilePath("20170102010101")).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gprestore_20170101010101_20170102010101_log_level"))
+		})
+	})
 	Describe("GetTableBackupFilePath", func() {
 		It("returns table file path", func() {
 			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
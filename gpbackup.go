@@ -19,6 +19,54 @@ func main() {
 		Run: func(cmd *cobra.Command, args []string) {
 			defer DoTeardown()
 			DoFlagValidation(cmd)
+			if IsMultiDatabaseRun() {
+				DoMultiDatabaseBackup()
+				return
+			}
+			if IsExpireRun() {
+				DoExpire()
+				return
+			}
+			if MustGetFlagBool(options.MIGRATE_HISTORY) {
+				DoMigrateHistory()
+				return
+			}
+			if MustGetFlagString(options.LIST) != "" {
+				DoListBackupContents()
+				return
+			}
+			if MustGetFlagBool(options.LIST_BACKUPS) {
+				DoListBackups()
+				return
+			}
+			if MustGetFlagBool(options.LIST_RESTORES) {
+				DoListRestores()
+				return
+			}
+			if MustGetFlagString(options.STATUS) != "" {
+				DoStatus()
+				return
+			}
+			if MustGetFlagString(options.CLEANUP) != "" {
+				DoCleanupBackup()
+				return
+			}
+			if MustGetFlagString(options.TEST_RESTORE) != "" {
+				DoTestRestore()
+				return
+			}
+			if len(MustGetFlagStringSlice(options.DIFF)) > 0 {
+				DoDiff()
+				return
+			}
+			if MustGetFlagBool(options.DRY_RUN) {
+				DoDryRun()
+				return
+			}
+			if MustGetFlagBool(options.ESTIMATE) {
+				DoEstimate()
+				return
+			}
 			DoSetup()
 			DoBackup()
 		}}
@@ -19,6 +19,34 @@ func main() {
 		Run: func(cmd *cobra.Command, args []string) {
 			defer DoTeardown()
 			DoValidation(cmd)
+			if IsMultiDatabaseRun() {
+				DoMultiDatabaseRestore()
+				return
+			}
+			if MustGetFlagBool(options.STATUS) {
+				DoStatus()
+				return
+			}
+			if MustGetFlagBool(options.DRY_RUN) {
+				DoDryRun()
+				return
+			}
+			if MustGetFlagString(options.TO_FILE) != "" {
+				DoRestoreToFile()
+				return
+			}
+			if MustGetFlagString(options.EXTRACT_TABLE) != "" {
+				DoExtractTable()
+				return
+			}
+			if MustGetFlagString(options.IMPORT_TABLE) != "" {
+				DoImportTable()
+				return
+			}
+			if MustGetFlagString(options.LIST_TOC) != "" {
+				DoListTOC()
+				return
+			}
 			DoSetup()
 			DoRestore()
 		}}
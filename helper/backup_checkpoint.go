@@ -0,0 +1,170 @@
+package helper
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Checkpoint specific functions
+ */
+
+/*
+ * When gpbackup may restart the backup agent, the agent records a checkpoint
+ * after each table: the byte range of the table in the uncompressed data and
+ * the size of the data file once the table was flushed to it.  A restarted
+ * agent truncates the data file to the last checkpoint before the table it
+ * resumes from and appends from there.
+ */
+type backupCheckpoint struct {
+	oid       int
+	startByte uint64
+	endByte   uint64
+	fileSize  int64
+}
+
+func getCheckpointFile() string {
+	return fmt.Sprintf("%s_checkpoint", *pipeFile)
+}
+
+func writeCheckpoints(filename string, checkpoints []backupCheckpoint, flags int) error {
+	handle, err := os.OpenFile(filename, flags, 0644)
+	if err != nil {
+		return err
+	}
+	for _, checkpoint := range checkpoints {
+		_, err = fmt.Fprintf(handle, "%d %d %d %d\n", checkpoint.oid, checkpoint.startByte, checkpoint.endByte, checkpoint.fileSize)
+		if err != nil {
+			_ = handle.Close()
+			return err
+		}
+	}
+	err = handle.Sync()
+	if err != nil {
+		_ = handle.Close()
+		return err
+	}
+	return handle.Close()
+}
+
+func appendCheckpoint(checkpoint backupCheckpoint) error {
+	return writeCheckpoints(getCheckpointFile(), []backupCheckpoint{checkpoint}, os.O_WRONLY|os.O_APPEND|os.O_CREATE)
+}
+
+/*
+ * A helper killed while recording a checkpoint can leave the last line
+ * incomplete, so reading stops at the first line that does not parse.
+ */
+func readCheckpoints(filename string) ([]backupCheckpoint, error) {
+	checkpoints := make([]backupCheckpoint, 0)
+	handle, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return checkpoints, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+	scanner := bufio.NewScanner(handle)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			break
+		}
+		oid, oidErr := strconv.Atoi(fields[0])
+		startByte, startErr := strconv.ParseUint(fields[1], 10, 64)
+		endByte, endErr := strconv.ParseUint(fields[2], 10, 64)
+		fileSize, sizeErr := strconv.ParseInt(fields[3], 10, 64)
+		if oidErr != nil || startErr != nil || endErr != nil || sizeErr != nil {
+			break
+		}
+		checkpoints = append(checkpoints, backupCheckpoint{oid: oid, startByte: startByte, endByte: endByte, fileSize: fileSize})
+	}
+	return checkpoints, scanner.Err()
+}
+
+/*
+ * Returns the checkpoints of the tables before resumeOid, which must be
+ * exactly the tables of the oid list before it, and the oids left to back up.
+ */
+func getResumeCheckpoints(checkpoints []backupCheckpoint, oidList []int, resumeOid int) ([]backupCheckpoint, []int, error) {
+	resumeIndex := -1
+	for i, oid := range oidList {
+		if oid == resumeOid {
+			resumeIndex = i
+			break
+		}
+	}
+	if resumeIndex == -1 {
+		return nil, nil, errors.Errorf("Cannot resume from table with oid %d, which is not in the oid list", resumeOid)
+	}
+	keptCheckpoints := make([]backupCheckpoint, 0, resumeIndex)
+	for _, checkpoint := range checkpoints {
+		if len(keptCheckpoints) == resumeIndex {
+			break
+		}
+		if checkpoint.oid != oidList[len(keptCheckpoints)] {
+			break
+		}
+		keptCheckpoints = append(keptCheckpoints, checkpoint)
+	}
+	if len(keptCheckpoints) < resumeIndex {
+		return nil, nil, errors.Errorf("Cannot resume from table with oid %d, as there is no checkpoint for table with oid %d", resumeOid, oidList[len(keptCheckpoints)])
+	}
+	return keptCheckpoints, oidList[resumeIndex:], nil
+}
+
+/*
+ * Prepares a restarted agent to resume from the table with resumeOid, adding
+ * the tables before it to the segment TOC.  Returns the oids left to back up,
+ * the end of the data already backed up, and the size the data file must be
+ * truncated to.
+ */
+func resumeFromCheckpoint(tocfile *toc.SegmentTOC, oidList []int, resumeOid int) ([]int, uint64, int64, error) {
+	checkpoints, err := readCheckpoints(getCheckpointFile())
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	keptCheckpoints, remainingOids, err := getResumeCheckpoints(checkpoints, oidList, resumeOid)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	err = writeCheckpoints(getCheckpointFile(), keptCheckpoints, os.O_WRONLY|os.O_TRUNC|os.O_CREATE)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var lastRead uint64
+	var fileSize int64
+	for _, checkpoint := range keptCheckpoints {
+		tocfile.AddSegmentDataEntry(uint(checkpoint.oid), checkpoint.startByte, checkpoint.endByte, "")
+		lastRead = checkpoint.endByte
+		fileSize = checkpoint.fileSize
+	}
+	log(fmt.Sprintf("Resuming from table with oid %d, truncating data file to %d bytes\n", resumeOid, fileSize))
+	return remainingOids, lastRead, fileSize, nil
+}
+
+/*
+ * Opens the data file of a restarted agent, discarding anything written after
+ * the last checkpoint it resumes from.
+ */
+func openDataFileForResume(fileSize int64) (*os.File, error) {
+	handle, err := os.OpenFile(*dataFile, os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = handle.Truncate(fileSize)
+	if err == nil {
+		_, err = handle.Seek(fileSize, 0)
+	}
+	if err != nil {
+		_ = handle.Close()
+		return nil, err
+	}
+	return handle, nil
+}
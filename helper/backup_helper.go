@@ -3,6 +3,8 @@ package helper
 import (
 	"bufio"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"os"
 	"os/exec"
@@ -17,11 +19,20 @@ import (
  * Backup specific functions
  */
 
+/*
+ * Either the plugin backup_data command or a multipart upload, which must be
+ * waited on after the pipe writer is closed to know whether the plugin has
+ * stored all of the data.
+ */
+type pluginUpload interface {
+	Wait() error
+}
+
 func doBackupAgent() error {
 	var lastRead uint64
 	var (
 		pipeWriter BackupPipeWriterCloser
-		writeCmd   *exec.Cmd
+		writeCmd   pluginUpload
 	)
 	tocfile := &toc.SegmentTOC{}
 	tocfile.DataEntries = make(map[uint]toc.SegmentDataEntry)
@@ -30,6 +41,14 @@ func doBackupAgent() error {
 	if err != nil {
 		return err
 	}
+	var dataFileSize int64
+	if *resumeFromOid != 0 {
+		setHeartbeatOid(*resumeFromOid)
+		oidList, lastRead, dataFileSize, err = resumeFromCheckpoint(tocfile, oidList, *resumeFromOid)
+		if err != nil {
+			return err
+		}
+	}
 
 	currentPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[0])
 	/*
@@ -41,6 +60,7 @@ func doBackupAgent() error {
 		if wasTerminated {
 			return errors.New("Terminated due to user request")
 		}
+		setHeartbeatOid(oid)
 		if i < len(oidList)-1 {
 			log(fmt.Sprintf("Creating pipe for oid %d\n", oidList[i+1]))
 			nextPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[i+1])
@@ -56,21 +76,47 @@ func doBackupAgent() error {
 			return err
 		}
 		if i == 0 {
-			pipeWriter, writeCmd, err = getBackupPipeWriter()
+			pipeWriter, writeCmd, err = getBackupPipeWriter(dataFileSize)
 			if err != nil {
 				return err
 			}
 		}
 
+		/*
+		 * Data stored through a plugin is checksummed as it is streamed, so
+		 * that the restore helper can detect data the plugin returns truncated
+		 * or altered.  The checksums reach the plugin in the segment TOC.
+		 */
+		checksum := ""
+		var tableHash hash.Hash32
+		if *pluginConfigFile != "" {
+			tableHash = crc32.New(checksumTable)
+			reader = io.TeeReader(reader, tableHash)
+		}
+
 		log(fmt.Sprintf("Backing up table with oid %d\n", oid))
 		numBytes, err := io.Copy(pipeWriter, reader)
 		if err != nil {
 			return errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
 		}
 		log(fmt.Sprintf("Read %d bytes\n", numBytes))
+		totalBytesRead += numBytes
+		if tableHash != nil {
+			checksum = formatChecksum(tableHash)
+		}
 
 		lastProcessed := lastRead + uint64(numBytes)
-		tocfile.AddSegmentDataEntry(uint(oid), lastRead, lastProcessed)
+		tocfile.AddSegmentDataEntry(uint(oid), lastRead, lastProcessed, checksum)
+		if *checkpoint {
+			err = pipeWriter.FlushMember()
+			if err != nil {
+				return err
+			}
+			err = appendCheckpoint(backupCheckpoint{oid: oid, startByte: lastRead, endByte: lastProcessed, fileSize: dataFileSize + totalBytesWritten})
+			if err != nil {
+				return err
+			}
+		}
 		lastRead = lastProcessed
 
 		lastPipe = currentPipe
@@ -117,28 +163,35 @@ func getBackupPipeReader(currentPipe string) (io.Reader, io.ReadCloser, error) {
 	return reader, readHandle, nil
 }
 
-func getBackupPipeWriter() (pipe BackupPipeWriterCloser, writeCmd *exec.Cmd, err error) {
+func getBackupPipeWriter(dataFileSize int64) (pipe BackupPipeWriterCloser, writeCmd pluginUpload, err error) {
 	var writeHandle io.WriteCloser
 	if *pluginConfigFile != "" {
 		writeCmd, writeHandle, err = startBackupPluginCommand()
+	} else if *resumeFromOid != 0 {
+		writeHandle, err = openDataFileForResume(dataFileSize)
 	} else {
 		writeHandle, err = os.Create(*dataFile)
 	}
 	if err != nil {
 		return nil, nil, err
 	}
+	writeHandle = countingWriteCloser{writeCloser: writeHandle, byteCount: &totalBytesWritten}
 
 	if *compressionLevel == 0 {
 		pipe = NewCommonBackupPipeWriterCloser(writeHandle)
 		return
 	}
 
+	if *compressionType == "gzip" && *compressionWorkers > 1 {
+		pipe, err = NewParallelGZipBackupPipeWriterCloser(writeHandle, *compressionLevel, *compressionWorkers)
+		return
+	}
 	if *compressionType == "gzip" {
 		pipe, err = NewGZipBackupPipeWriterCloser(writeHandle, *compressionLevel)
 		return
 	}
 	if *compressionType == "zstd" {
-		pipe, err = NewZSTDBackupPipeWriterCloser(writeHandle, *compressionLevel)
+		pipe, err = NewZSTDBackupPipeWriterCloser(writeHandle, *compressionLevel, *compressionWorkers)
 		return
 	}
 
@@ -146,11 +199,18 @@ func getBackupPipeWriter() (pipe BackupPipeWriterCloser, writeCmd *exec.Cmd, err
 	return nil, nil, fmt.Errorf("unknown compression type '%s' (compression level %d)", *compressionType, *compressionLevel)
 }
 
-func startBackupPluginCommand() (*exec.Cmd, io.WriteCloser, error) {
+func startBackupPluginCommand() (pluginUpload, io.WriteCloser, error) {
 	pluginConfig, err := utils.ReadPluginConfig(*pluginConfigFile)
 	if err != nil {
 		return nil, nil, err
 	}
+	if pluginConfig.UsesMultipartUpload() {
+		uploader, err := newMultipartUploader(pluginConfig, *dataFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return uploader, uploader, nil
+	}
 	cmdStr := fmt.Sprintf("%s backup_data %s %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath, *dataFile)
 	writeCmd := exec.Command("bash", "-c", cmdStr)
 
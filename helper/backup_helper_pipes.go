@@ -5,12 +5,14 @@ import (
 	"compress/gzip"
 	"io"
 
+	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/klauspost/compress/zstd"
 )
 
 type BackupPipeWriterCloser interface {
 	io.Writer
 	io.Closer
+	FlushMember() error
 }
 
 type CommonBackupPipeWriterCloser struct {
@@ -30,6 +32,10 @@ func (cPipe CommonBackupPipeWriterCloser) Close() error {
 	return nil
 }
 
+func (cPipe CommonBackupPipeWriterCloser) FlushMember() error {
+	return cPipe.bufIoWriter.Flush()
+}
+
 func NewCommonBackupPipeWriterCloser(writeHandle io.WriteCloser) (cPipe CommonBackupPipeWriterCloser) {
 	cPipe.writeHandle = writeHandle
 	cPipe.bufIoWriter = bufio.NewWriter(cPipe.writeHandle)
@@ -52,6 +58,20 @@ func (gzPipe GZipBackupPipeWriterCloser) Close() error {
 	return gzPipe.cPipe.Close()
 }
 
+/*
+ * Ends the current gzip member and starts another, so that the data file can
+ * be truncated after this point and appended to.  Readers of the data file
+ * decompress consecutive members as one stream.
+ */
+func (gzPipe GZipBackupPipeWriterCloser) FlushMember() error {
+	err := gzPipe.gzipWriter.Close()
+	if err != nil {
+		return err
+	}
+	gzPipe.gzipWriter.Reset(gzPipe.cPipe.bufIoWriter)
+	return gzPipe.cPipe.FlushMember()
+}
+
 func NewGZipBackupPipeWriterCloser(writeHandle io.WriteCloser, compressLevel int) (gzPipe GZipBackupPipeWriterCloser, err error) {
 	gzPipe.cPipe = NewCommonBackupPipeWriterCloser(writeHandle)
 	gzPipe.gzipWriter, err = gzip.NewWriterLevel(gzPipe.cPipe.bufIoWriter, compressLevel)
@@ -61,6 +81,44 @@ func NewGZipBackupPipeWriterCloser(writeHandle io.WriteCloser, compressLevel int
 	return
 }
 
+/*
+ * Compresses on several cores with the same gzip format as
+ * GZipBackupPipeWriterCloser, used when the agent is given more than one
+ * compression worker.
+ */
+type ParallelGZipBackupPipeWriterCloser struct {
+	cPipe      CommonBackupPipeWriterCloser
+	gzipWriter *utils.ParallelGzipWriter
+}
+
+func (gzPipe ParallelGZipBackupPipeWriterCloser) Write(p []byte) (n int, err error) {
+	return gzPipe.gzipWriter.Write(p)
+}
+
+// Returns errors from underlying common writer only
+func (gzPipe ParallelGZipBackupPipeWriterCloser) Close() error {
+	_ = gzPipe.gzipWriter.Close()
+	return gzPipe.cPipe.Close()
+}
+
+func (gzPipe ParallelGZipBackupPipeWriterCloser) FlushMember() error {
+	err := gzPipe.gzipWriter.Close()
+	if err != nil {
+		return err
+	}
+	gzPipe.gzipWriter.Reset(gzPipe.cPipe.bufIoWriter)
+	return gzPipe.cPipe.FlushMember()
+}
+
+func NewParallelGZipBackupPipeWriterCloser(writeHandle io.WriteCloser, compressLevel int, compressWorkers int) (gzPipe ParallelGZipBackupPipeWriterCloser, err error) {
+	gzPipe.cPipe = NewCommonBackupPipeWriterCloser(writeHandle)
+	gzPipe.gzipWriter, err = utils.NewParallelGzipWriter(gzPipe.cPipe.bufIoWriter, compressLevel, compressWorkers)
+	if err != nil {
+		gzPipe.cPipe.Close()
+	}
+	return
+}
+
 type ZSTDBackupPipeWriterCloser struct {
 	cPipe       CommonBackupPipeWriterCloser
 	zstdEncoder *zstd.Encoder
@@ -76,9 +134,30 @@ func (zstdPipe ZSTDBackupPipeWriterCloser) Close() error {
 	return zstdPipe.cPipe.Close()
 }
 
-func NewZSTDBackupPipeWriterCloser(writeHandle io.WriteCloser, compressLevel int) (zstdPipe ZSTDBackupPipeWriterCloser, err error) {
+/*
+ * Ends the current zstd frame and starts another, for the same reason as for
+ * gzip members.
+ */
+func (zstdPipe ZSTDBackupPipeWriterCloser) FlushMember() error {
+	err := zstdPipe.zstdEncoder.Close()
+	if err != nil {
+		return err
+	}
+	zstdPipe.zstdEncoder.Reset(zstdPipe.cPipe.bufIoWriter)
+	return zstdPipe.cPipe.FlushMember()
+}
+
+/*
+ * The encoder compresses on as many cores as are available unless it is given
+ * a number of workers.
+ */
+func NewZSTDBackupPipeWriterCloser(writeHandle io.WriteCloser, compressLevel int, compressWorkers int) (zstdPipe ZSTDBackupPipeWriterCloser, err error) {
 	zstdPipe.cPipe = NewCommonBackupPipeWriterCloser(writeHandle)
-	zstdPipe.zstdEncoder, err = zstd.NewWriter(zstdPipe.cPipe.bufIoWriter, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(compressLevel)))
+	encoderOptions := []zstd.EOption{zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(compressLevel))}
+	if compressWorkers > 1 {
+		encoderOptions = append(encoderOptions, zstd.WithEncoderConcurrency(compressWorkers))
+	}
+	zstdPipe.zstdEncoder, err = zstd.NewWriter(zstdPipe.cPipe.bufIoWriter, encoderOptions...)
 	if err != nil {
 		zstdPipe.cPipe.Close()
 	}
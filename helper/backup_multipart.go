@@ -0,0 +1,151 @@
+package helper
+
+/*
+ * This file contains structs and functions for uploading the data of a
+ * segment to a plugin in parts, several at once, when the plugin config
+ * enables multipart_upload.
+ */
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Data is buffered until a full part has been written, which is then passed
+ * to the plugin backup_data_part command in the background while the next
+ * part is buffered.  Once all parts are uploaded, Wait passes the checksum of
+ * every part to the plugin finalize_backup_data command, which must combine
+ * them into the single data file that restore_data will later read.
+ */
+type multipartUploader struct {
+	pluginConfig *utils.PluginConfig
+	dataFile     string
+	chunkSize    int
+	buffer       []byte
+	checksums    []string
+	slots        chan struct{}
+	uploads      sync.WaitGroup
+	errMutex     sync.Mutex
+	err          error
+}
+
+func newMultipartUploader(pluginConfig *utils.PluginConfig, dataFile string) (*multipartUploader, error) {
+	chunkSize, parallelism, err := pluginConfig.GetMultipartSettings()
+	if err != nil {
+		return nil, err
+	}
+	return &multipartUploader{
+		pluginConfig: pluginConfig,
+		dataFile:     dataFile,
+		chunkSize:    chunkSize,
+		buffer:       make([]byte, 0, chunkSize),
+		checksums:    make([]string, 0),
+		slots:        make(chan struct{}, parallelism),
+	}, nil
+}
+
+func (uploader *multipartUploader) Write(p []byte) (int, error) {
+	if err := uploader.getError(); err != nil {
+		return 0, err
+	}
+	numWritten := 0
+	for len(p) > 0 {
+		numToCopy := uploader.chunkSize - len(uploader.buffer)
+		if numToCopy > len(p) {
+			numToCopy = len(p)
+		}
+		uploader.buffer = append(uploader.buffer, p[:numToCopy]...)
+		p = p[numToCopy:]
+		numWritten += numToCopy
+		if len(uploader.buffer) == uploader.chunkSize {
+			uploader.uploadPart()
+		}
+	}
+	return numWritten, nil
+}
+
+/*
+ * Uploads the remaining buffered data as the last part.  An empty part is
+ * uploaded if no data was written, so that the data file always exists.
+ */
+func (uploader *multipartUploader) Close() error {
+	if len(uploader.buffer) > 0 || len(uploader.checksums) == 0 {
+		uploader.uploadPart()
+	}
+	return nil
+}
+
+/*
+ * Waits for every part to be uploaded and then finalizes the data file,
+ * returning the first error from the plugin.
+ */
+func (uploader *multipartUploader) Wait() error {
+	uploader.uploads.Wait()
+	if err := uploader.getError(); err != nil {
+		return err
+	}
+	var manifest strings.Builder
+	for i, checksum := range uploader.checksums {
+		manifest.WriteString(fmt.Sprintf("%d %s\n", i+1, checksum))
+	}
+	command := fmt.Sprintf("%s finalize_backup_data %s %s %d", uploader.pluginConfig.ExecutablePath,
+		uploader.pluginConfig.ConfigPath, uploader.dataFile, len(uploader.checksums))
+	return runPluginCommandWithInput(command, strings.NewReader(manifest.String()))
+}
+
+func (uploader *multipartUploader) uploadPart() {
+	part := uploader.buffer
+	uploader.buffer = make([]byte, 0, uploader.chunkSize)
+	checksum := sha256.Sum256(part)
+	uploader.checksums = append(uploader.checksums, hex.EncodeToString(checksum[:]))
+	command := fmt.Sprintf("%s backup_data_part %s %s %d %s", uploader.pluginConfig.ExecutablePath,
+		uploader.pluginConfig.ConfigPath, uploader.dataFile, len(uploader.checksums), hex.EncodeToString(checksum[:]))
+
+	uploader.slots <- struct{}{}
+	uploader.uploads.Add(1)
+	go func() {
+		defer func() {
+			<-uploader.slots
+			uploader.uploads.Done()
+		}()
+		err := runPluginCommandWithInput(command, bytes.NewReader(part))
+		if err != nil {
+			uploader.setError(err)
+		}
+	}()
+}
+
+func (uploader *multipartUploader) getError() error {
+	uploader.errMutex.Lock()
+	defer uploader.errMutex.Unlock()
+	return uploader.err
+}
+
+func (uploader *multipartUploader) setError(err error) {
+	uploader.errMutex.Lock()
+	defer uploader.errMutex.Unlock()
+	if uploader.err == nil {
+		uploader.err = err
+	}
+}
+
+func runPluginCommandWithInput(command string, input io.Reader) error {
+	log(fmt.Sprintf("Running plugin command: %s\n", command))
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Stdin = input
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrap(err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package helper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Compress specific functions
+ */
+
+/*
+ * With --compress, the helper compresses the data of a table on several
+ * cores as the COPY program of a backup with more than one compression
+ * worker.  Errors are written to stderr and the helper exits with an error
+ * code, so that the COPY command running it fails.
+ */
+func doCompress() {
+	err := compressStream(os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Segment %d: %v\n", *content, err)
+		os.Exit(1)
+	}
+}
+
+func compressStream(input io.Reader, output io.Writer) error {
+	bufferedOutput := bufio.NewWriter(output)
+	gzipWriter, err := utils.NewParallelGzipWriter(bufferedOutput, *compressionLevel, *compressionWorkers)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(gzipWriter, bufio.NewReader(input))
+	if err != nil {
+		return err
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		return err
+	}
+	return bufferedOutput.Flush()
+}
@@ -0,0 +1,357 @@
+package helper
+
+/*
+ * This file contains functions for backing up and restoring the data of a
+ * table as content-defined chunks shared by every deduplicated backup in the
+ * same backup directory, which gpbackup and gprestore run as the program of
+ * a COPY command on each segment.
+ *
+ * The data of a table is split into chunks at positions determined by its
+ * content, so that a change to one part of a table changes only the chunks
+ * around it.  Each chunk is stored once in the chunk directory, named by the
+ * SHA-256 checksum of its uncompressed content, and the data file of the
+ * table is a manifest listing its chunks in order.
+ */
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Changing any of these values or the gear table would change where chunks
+ * are cut, so no chunk stored by an earlier backup would be reused.
+ */
+const (
+	minChunkSize  = 16 * 1024
+	maxChunkSize  = 256 * 1024
+	chunkHashMask = 1<<16 - 1 // an average of 64KB past the minimum size
+)
+
+var gearTable = newGearTable()
+
+/*
+ * The gear table is generated with splitmix64 from a fixed seed, so that it
+ * is the same for every version of gpbackup_helper.
+ */
+func newGearTable() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x9E3779B97F4A7C15)
+	for i := range table {
+		state += 0x9E3779B97F4A7C15
+		z := state
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}
+
+type chunker struct {
+	reader io.Reader
+	buffer []byte
+	length int
+}
+
+func newChunker(reader io.Reader) *chunker {
+	return &chunker{reader: reader, buffer: make([]byte, maxChunkSize)}
+}
+
+/*
+ * Returns the next chunk of data, which is only valid until the next call,
+ * or io.EOF once all data has been read.
+ */
+func (c *chunker) Next() ([]byte, error) {
+	numRead, err := io.ReadFull(c.reader, c.buffer[c.length:])
+	c.length += numRead
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if c.length == 0 {
+		return nil, io.EOF
+	}
+	cut := findChunkBoundary(c.buffer[:c.length])
+	chunk := make([]byte, cut)
+	copy(chunk, c.buffer[:cut])
+	c.length = copy(c.buffer, c.buffer[cut:c.length])
+	return chunk, nil
+}
+
+func findChunkBoundary(data []byte) int {
+	if len(data) <= minChunkSize {
+		return len(data)
+	}
+	var hash uint64
+	for i := minChunkSize; i < len(data); i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+		if hash&chunkHashMask == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+func getChunkExtension() string {
+	if *compressionLevel == 0 {
+		return ""
+	}
+	if *compressionType == "zstd" {
+		return ".zst"
+	}
+	return ".gz"
+}
+
+func getChunkPath(chunkDir string, chunkName string) string {
+	return filepath.Join(chunkDir, chunkName[:2], chunkName)
+}
+
+/*
+ * Reads the data of a table from stdin and writes the manifest to the data
+ * file.  Each line of the manifest names a chunk, gives its stored size, and
+ * records whether this backup stored it ("new") or reused it ("dup").
+ */
+func doDedupWrite() error {
+	manifest, err := os.Create(*dataFile)
+	if err != nil {
+		return err
+	}
+	manifestWriter := bufio.NewWriter(manifest)
+	reader := newChunker(bufio.NewReader(os.Stdin))
+	for {
+		chunk, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			_ = manifest.Close()
+			return err
+		}
+		checksum := sha256.Sum256(chunk)
+		chunkName := hex.EncodeToString(checksum[:]) + getChunkExtension()
+		storedSize, isNew, err := storeChunk(*chunkDir, chunkName, chunk)
+		if err != nil {
+			_ = manifest.Close()
+			return err
+		}
+		status := "dup"
+		if isNew {
+			status = "new"
+		}
+		_, err = fmt.Fprintf(manifestWriter, "%s %d %s\n", chunkName, storedSize, status)
+		if err != nil {
+			_ = manifest.Close()
+			return err
+		}
+	}
+	err = manifestWriter.Flush()
+	if err != nil {
+		_ = manifest.Close()
+		return err
+	}
+	return manifest.Close()
+}
+
+/*
+ * Chunks are written to a temporary file and renamed into place, so that a
+ * chunk that exists is always complete even if two tables store the same
+ * chunk at once.
+ */
+func storeChunk(chunkDir string, chunkName string, chunk []byte) (int64, bool, error) {
+	chunkPath := getChunkPath(chunkDir, chunkName)
+	if info, err := os.Stat(chunkPath); err == nil {
+		return info.Size(), false, nil
+	}
+	err := os.MkdirAll(filepath.Dir(chunkPath), 0755)
+	if err != nil {
+		return 0, false, err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(chunkPath), chunkName+".tmp.")
+	if err != nil {
+		return 0, false, err
+	}
+	defer os.Remove(tempFile.Name())
+	err = writeCompressedChunk(tempFile, chunk)
+	if err != nil {
+		_ = tempFile.Close()
+		return 0, false, err
+	}
+	info, err := tempFile.Stat()
+	if err != nil {
+		_ = tempFile.Close()
+		return 0, false, err
+	}
+	err = tempFile.Close()
+	if err != nil {
+		return 0, false, err
+	}
+	err = os.Rename(tempFile.Name(), chunkPath)
+	if err != nil {
+		return 0, false, err
+	}
+	return info.Size(), true, nil
+}
+
+func writeCompressedChunk(file io.Writer, chunk []byte) error {
+	var writer io.WriteCloser
+	var err error
+	switch getChunkExtension() {
+	case "":
+		_, err = file.Write(chunk)
+		return err
+	case ".zst":
+		writer, err = zstd.NewWriter(file, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(*compressionLevel)))
+	default:
+		writer, err = gzip.NewWriterLevel(file, *compressionLevel)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(chunk)
+	if err != nil {
+		_ = writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+/*
+ * Writes the data of a table to stdout by reading each chunk in its
+ * manifest, checking that its content matches the checksum it is named by.
+ */
+func doDedupRead() error {
+	manifest, err := os.Open(*dataFile)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+	output := bufio.NewWriter(os.Stdout)
+	scanner := bufio.NewScanner(manifest)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		err = readChunk(*chunkDir, fields[0], output)
+		if err != nil {
+			return err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	return output.Flush()
+}
+
+func readChunk(chunkDir string, chunkName string, output io.Writer) error {
+	chunkPath := getChunkPath(chunkDir, chunkName)
+	file, err := os.Open(chunkPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	switch filepath.Ext(chunkName) {
+	case ".gz":
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read chunk %s", chunkPath)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case ".zst":
+		zstdReader, err := zstd.NewReader(file)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read chunk %s", chunkPath)
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(output, hash), reader)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read chunk %s", chunkPath)
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if !strings.HasPrefix(chunkName, checksum) {
+		return errors.Errorf("Chunk %s is corrupt: its checksum is %s", chunkPath, checksum)
+	}
+	return nil
+}
+
+/*
+ * Removes every chunk not listed in the manifest of a table in any backup
+ * remaining in the backup directory containing the chunk directory, and
+ * prints the number of chunks removed.
+ */
+func doDedupPrune() error {
+	manifests, err := filepath.Glob(filepath.Join(filepath.Dir(*chunkDir), "*", "*", "*.chunks"))
+	if err != nil {
+		return err
+	}
+	referenced := make(map[string]bool)
+	for _, manifestPath := range manifests {
+		contents, err := ioutil.ReadFile(manifestPath)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(contents), "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				referenced[fields[0]] = true
+			}
+		}
+	}
+	numRemoved := 0
+	err = filepath.Walk(*chunkDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.Contains(info.Name(), ".tmp.") || referenced[info.Name()] {
+			return nil
+		}
+		numRemoved++
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(numRemoved)
+	return nil
+}
+
+func isDedupCommand() bool {
+	return *dedupWrite || *dedupRead || *dedupPrune
+}
+
+/*
+ * Errors are written to stderr and the helper exits with an error code, so
+ * that the COPY command running it fails.
+ */
+func doDedupCommand() {
+	var err error
+	if *chunkDir == "" {
+		err = errors.New("--chunk-dir is required")
+	} else if *dedupWrite {
+		err = doDedupWrite()
+	} else if *dedupRead {
+		err = doDedupRead()
+	} else {
+		err = doDedupPrune()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Segment %d: %v\n", *content, err)
+		os.Exit(1)
+	}
+}
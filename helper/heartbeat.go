@@ -0,0 +1,85 @@
+package helper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Heartbeat specific functions
+ */
+
+var (
+	heartbeatInterval = time.Second
+	heartbeatMutex    sync.Mutex
+	heartbeatOid      int64
+	heartbeatStopped  bool
+)
+
+func getHeartbeatFile() string {
+	return fmt.Sprintf("%s_heartbeat", *pipeFile)
+}
+
+func setHeartbeatOid(oid int) {
+	atomic.StoreInt64(&heartbeatOid, int64(oid))
+}
+
+/*
+ * The backup agent rewrites its heartbeat file every second while it runs, so
+ * that gpbackup can tell a helper that died or stopped responding, which
+ * leaves no error file behind, from one waiting on a slow COPY.  The file
+ * holds the pid of the agent and the oid of the table it is working on.
+ */
+func startHeartbeat() {
+	writeHeartbeat()
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if !writeHeartbeat() {
+				return
+			}
+		}
+	}()
+}
+
+func writeHeartbeat() bool {
+	heartbeatMutex.Lock()
+	defer heartbeatMutex.Unlock()
+	if heartbeatStopped {
+		return false
+	}
+	// The file is replaced rather than rewritten, so it is never read half written
+	contents := fmt.Sprintf("%d %d\n", os.Getpid(), atomic.LoadInt64(&heartbeatOid))
+	tempFile := fmt.Sprintf("%s.tmp", getHeartbeatFile())
+	err := ioutil.WriteFile(tempFile, []byte(contents), 0644)
+	if err == nil {
+		err = os.Rename(tempFile, getHeartbeatFile())
+	}
+	if err != nil {
+		log(fmt.Sprintf("Unable to write heartbeat file: %v", err))
+	}
+	return true
+}
+
+/*
+ * A helper that exits, whether or not it succeeded, removes its heartbeat file,
+ * so that only a helper that is killed or stops responding leaves one behind.
+ */
+func stopHeartbeat() {
+	heartbeatMutex.Lock()
+	defer heartbeatMutex.Unlock()
+	if *heartbeat && !heartbeatStopped {
+		heartbeatStopped = true
+		err := utils.RemoveFileIfExists(getHeartbeatFile())
+		if err != nil {
+			log("Encountered error during cleanup: %v", err)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"os"
 	"os/signal"
 	"runtime/debug"
@@ -27,38 +29,62 @@ import (
  */
 
 var (
-	CleanupGroup  *sync.WaitGroup
-	currentPipe   string
-	errBuf        bytes.Buffer
-	lastPipe      string
-	nextPipe      string
-	version       string
-	wasTerminated bool
-	writeHandle   *os.File
-	writer        *bufio.Writer
+	CleanupGroup      *sync.WaitGroup
+	currentPipe       string
+	errBuf            bytes.Buffer
+	lastPipe          string
+	nextPipe          string
+	totalBytesRead    int64
+	totalBytesWritten int64
+	version           string
+	wasTerminated     bool
+	writeHandle       *os.File
+	writer            *bufio.Writer
 )
 
 /*
  * Command-line flags
  */
 var (
-	backupAgent      *bool
-	compressionLevel *int
-	compressionType  *string
-	content          *int
-	dataFile         *string
-	oidFile          *string
-	onErrorContinue  *bool
-	pipeFile         *string
-	pluginConfigFile *string
-	printVersion     *bool
-	restoreAgent     *bool
-	tocFile          *string
-	isFiltered       *bool
+	backupAgent        *bool
+	checkpoint         *bool
+	chunkDir           *string
+	compress           *bool
+	compressionLevel   *int
+	compressionType    *string
+	compressionWorkers *int
+	content            *int
+	dataFile           *string
+	dedupPrune         *bool
+	dedupRead          *bool
+	dedupWrite         *bool
+	heartbeat          *bool
+	oidFile            *string
+	onErrorContinue    *bool
+	pipeFile           *string
+	pluginConfigFile   *string
+	printVersion       *bool
+	restoreAgent       *bool
+	resumeFromOid      *int
+	tocFile            *string
+	isFiltered         *bool
 )
 
 func DoHelper() {
+	if isS3PluginCommand(os.Args[1:]) {
+		doS3PluginCommand(os.Args[1:])
+		return
+	}
 	var err error
+	InitializeGlobals()
+	if isDedupCommand() {
+		doDedupCommand()
+		return
+	}
+	if *compress {
+		doCompress()
+		return
+	}
 	defer func() {
 		if wasTerminated {
 			CleanupGroup.Wait()
@@ -68,7 +94,6 @@ func DoHelper() {
 		os.Exit(gplog.GetErrorCode())
 	}()
 
-	InitializeGlobals()
 	// Initialize signal handler
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
@@ -82,11 +107,17 @@ func DoHelper() {
 		}
 	}()
 
+	if *heartbeat {
+		startHeartbeat()
+	}
 	if *backupAgent {
 		err = doBackupAgent()
 	} else if *restoreAgent {
 		err = doRestoreAgent()
 	}
+	if !wasTerminated {
+		writeResourceUsage()
+	}
 	if err != nil {
 		logError(fmt.Sprintf("%v: %s", err, debug.Stack()))
 		handle, _ := utils.OpenFileForWrite(fmt.Sprintf("%s_error", *pipeFile))
@@ -100,16 +131,25 @@ func InitializeGlobals() {
 	gplog.InitializeLogging("gpbackup_helper", "")
 
 	backupAgent = flag.Bool("backup-agent", false, "Use gpbackup_helper as an agent for backup")
+	checkpoint = flag.Bool("checkpoint", false, "Record a checkpoint after each table, so that a restarted backup agent can resume the data file")
+	chunkDir = flag.String("chunk-dir", "", "Absolute path to the directory of data chunks shared by deduplicated backups")
 	content = flag.Int("content", -2, "Content ID of the corresponding segment")
 	compressionLevel = flag.Int("compression-level", 0, "The level of compression. O indicates no compression. Range of valid values depends on compression type")
 	compressionType = flag.String("compression-type", "gzip", "The type of compression. Valid values are 'gzip', 'zstd'")
+	compress = flag.Bool("compress", false, "Compress the data read from stdin with gzip to stdout, using --compression-workers cores")
+	compressionWorkers = flag.Int("compression-workers", 1, "The number of cores to compress data with")
 	dataFile = flag.String("data-file", "", "Absolute path to the data file")
+	dedupPrune = flag.Bool("dedup-prune", false, "Remove the chunks in the chunk directory that no remaining backup uses")
+	dedupRead = flag.Bool("dedup-read", false, "Write the data of a table stored as chunks to stdout, reading the list of chunks from the data file")
+	dedupWrite = flag.Bool("dedup-write", false, "Store the data of a table read from stdin as chunks, writing the list of chunks to the data file")
+	heartbeat = flag.Bool("heartbeat", false, "Write a heartbeat file while the agent runs, so that gpbackup can detect an agent that died")
 	oidFile = flag.String("oid-file", "", "Absolute path to the file containing a list of oids to restore")
 	onErrorContinue = flag.Bool("on-error-continue", false, "Continue restore even when encountering an error")
 	pipeFile = flag.String("pipe-file", "", "Absolute path to the pipe file")
 	pluginConfigFile = flag.String("plugin-config", "", "The configuration file to use for a plugin")
 	printVersion = flag.Bool("version", false, "Print version number and exit")
 	restoreAgent = flag.Bool("restore-agent", false, "Use gpbackup_helper as an agent for restore")
+	resumeFromOid = flag.Int("resume-from-oid", 0, "Resume the data file of a backup agent that was restarted from the table with this oid, using its checkpoints")
 	tocFile = flag.String("toc-file", "", "Absolute path to the table of contents file")
 	isFiltered = flag.Bool("with-filters", false, "Used with table/schema filters")
 
@@ -150,6 +190,16 @@ func getOidListFromFile() ([]int, error) {
 	return oidList, nil
 }
 
+/*
+ * Table data sent through a plugin is checksummed with CRC-32C, which the
+ * helper can compute as fast as the data streams through it.
+ */
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+func formatChecksum(tableHash hash.Hash32) string {
+	return fmt.Sprintf("%08x", tableHash.Sum32())
+}
+
 func flushAndCloseRestoreWriter() error {
 	if writer != nil {
 		err := writer.Flush()
@@ -183,6 +233,7 @@ func DoCleanup() {
 		handle, _ := utils.OpenFileForWrite(fmt.Sprintf("%s_error", *pipeFile))
 		_ = handle.Close()
 	}
+	stopHeartbeat()
 	err := flushAndCloseRestoreWriter()
 	if err != nil {
 		log("Encountered error during cleanup: %v", err)
@@ -207,6 +258,14 @@ func DoCleanup() {
 			log("Encountered error during cleanup skip files: %v", err)
 		}
 	}
+
+	checksumErrorFiles, _ := filepath.Glob(fmt.Sprintf("%s_*_checksum_error", *pipeFile))
+	for _, checksumErrorFile := range checksumErrorFiles {
+		err = utils.RemoveFileIfExists(checksumErrorFile)
+		if err != nil {
+			log("Encountered error during cleanup checksum error files: %v", err)
+		}
+	}
 	log("Cleanup complete")
 }
 
@@ -0,0 +1,21 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestHelper(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "helper tests")
+}
+
+var _ = BeforeEach(func() {
+	_, _, _ = testhelper.SetupTestLogger()
+	contentID := 0
+	content = &contentID
+})
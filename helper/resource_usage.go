@@ -0,0 +1,62 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Resource usage specific functions
+ */
+
+type countingReader struct {
+	reader    io.Reader
+	byteCount *int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	*r.byteCount += int64(n)
+	return n, err
+}
+
+type countingWriteCloser struct {
+	writeCloser io.WriteCloser
+	byteCount   *int64
+}
+
+func (w countingWriteCloser) Write(p []byte) (int, error) {
+	n, err := w.writeCloser.Write(p)
+	*w.byteCount += int64(n)
+	return n, err
+}
+
+func (w countingWriteCloser) Close() error {
+	return w.writeCloser.Close()
+}
+
+/*
+ * The usage file is collected by gpbackup or gprestore once the agent has
+ * finished, so it is written whether or not the agent succeeded.
+ */
+func writeResourceUsage() {
+	usage := utils.HelperResourceUsage{
+		BytesRead:    totalBytesRead,
+		BytesWritten: totalBytesWritten,
+		CPUTime:      utils.GetCPUTime(),
+	}
+	if *pluginConfigFile != "" {
+		if *backupAgent {
+			usage.NetworkBytes = usage.BytesWritten
+		} else {
+			usage.NetworkBytes = usage.BytesRead
+		}
+	}
+	err := ioutil.WriteFile(fmt.Sprintf("%s_usage", *pipeFile), []byte(usage.String()+"\n"), 0644)
+	if err != nil {
+		log("Unable to write resource usage: %v", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"compress/gzip"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"os"
@@ -66,15 +68,17 @@ func (r *RestoreReader) positionReader(pos uint64) error {
 	return nil
 }
 
-func (r *RestoreReader) copyData(num int64) (int64, error) {
+func (r *RestoreReader) copyData(num int64, destination io.Writer) (int64, error) {
 	var bytesRead int64
 	var err error
 	switch r.readerType {
 	case SEEKABLE:
-		bytesRead, err = io.CopyN(writer, r.seekReader, num)
+		bytesRead, err = io.CopyN(destination, r.seekReader, num)
+		totalBytesRead += bytesRead
 	case NONSEEKABLE, SUBSET:
-		bytesRead, err = io.CopyN(writer, r.bufReader, num)
+		bytesRead, err = io.CopyN(destination, r.bufReader, num)
 	}
+	totalBytesWritten += bytesRead
 	return bytesRead, err
 }
 
@@ -88,6 +92,7 @@ func doRestoreAgent() error {
 	var end uint64
 	var errRemove error
 	var lastError error
+	var tableHash hash.Hash32
 
 	oidList, err := getOidListFromFile()
 	if err != nil {
@@ -165,17 +170,23 @@ func doRestoreAgent() error {
 		}
 
 		log(fmt.Sprintf("Restoring table with oid %d", oid))
-		bytesRead, err = reader.copyData(int64(end - start))
-		if err != nil {
+		tableHash = crc32.New(checksumTable)
+		bytesRead, err = copyTableData(reader, writer, tableHash, oid, int64(end-start), tocEntries[uint(oid)].Checksum)
+		if bytesRead < int64(end-start) {
 			// In case COPY FROM or copyN fails in the middle of a load. We
 			// need to update the lastByte with the amount of bytes that was
 			// copied before it errored out
 			lastByte += uint64(bytesRead)
 			err = errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
+			_ = flushAndCloseRestoreWriter()
 			goto LoopEnd
 		}
 		lastByte = end
 		log(fmt.Sprintf("Copied %d bytes into the pipe", bytesRead))
+		if err != nil {
+			_ = flushAndCloseRestoreWriter()
+			goto LoopEnd
+		}
 
 		log(fmt.Sprintf("Closing pipe for oid %d: %s", oid, currentPipe))
 		err = flushAndCloseRestoreWriter()
@@ -206,6 +217,39 @@ func doRestoreAgent() error {
 	return lastError
 }
 
+/*
+ * Copies the data of a table into its pipe while checksumming it, for
+ * comparison with the checksum that backups made through a plugin record for
+ * each table.  Data that was cut short or does not match gets a checksum error
+ * file, so that the COPY of the table fails when its pipe is closed instead of
+ * loading it as if it were complete.
+ */
+func copyTableData(reader *RestoreReader, destination io.Writer, tableHash hash.Hash32, oid int, numBytes int64, expectedChecksum string) (int64, error) {
+	bytesRead, err := reader.copyData(numBytes, io.MultiWriter(destination, tableHash))
+	if err != nil {
+		createChecksumErrorFile(oid)
+		return bytesRead, err
+	}
+	return bytesRead, verifyTableChecksum(oid, expectedChecksum, formatChecksum(tableHash))
+}
+
+func verifyTableChecksum(oid int, expected string, actual string) error {
+	if expected == "" || expected == actual {
+		return nil
+	}
+	createChecksumErrorFile(oid)
+	return errors.Errorf("Checksum mismatch for table with oid %d: expected %s, got %s", oid, expected, actual)
+}
+
+func createChecksumErrorFile(oid int) {
+	handle, err := utils.OpenFileForWrite(fmt.Sprintf("%s_%d_checksum_error", *pipeFile, oid))
+	if err != nil {
+		logError(fmt.Sprintf("Could not create checksum error file for table with oid %d: %v", oid, err))
+		return
+	}
+	_ = handle.Close()
+}
+
 func getRestoreDataReader(toc *toc.SegmentTOC, oidList []int) (*RestoreReader, error) {
 	var readHandle io.Reader
 	var seekHandle io.ReadSeeker
@@ -236,6 +280,10 @@ func getRestoreDataReader(toc *toc.SegmentTOC, oidList []int) (*RestoreReader, e
 	if err != nil {
 		return nil, err
 	}
+	if readHandle != nil {
+		// Seeked over bytes are not read, so a seekable reader counts bytes as they are copied
+		readHandle = countingReader{reader: readHandle, byteCount: &totalBytesRead}
+	}
 
 	// Set the underlying stream reader in restoreReader
 	if restoreReader.readerType == SEEKABLE {
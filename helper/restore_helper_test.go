@@ -0,0 +1,98 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("helper/restore_helper tests", func() {
+	var pipeDir string
+	var checksumErrorFile string
+	BeforeEach(func() {
+		var err error
+		pipeDir, err = ioutil.TempDir("", "restore_helper")
+		Expect(err).ToNot(HaveOccurred())
+		pipePath := path.Join(pipeDir, "gpbackup_0_20170101010101_pipe")
+		pipeFile = &pipePath
+		checksumErrorFile = fmt.Sprintf("%s_%d_checksum_error", pipePath, 16384)
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(pipeDir)
+	})
+	Describe("formatChecksum", func() {
+		It("formats the CRC-32C checksum of the data", func() {
+			tableHash := crc32.New(checksumTable)
+			_, _ = io.Copy(ioutil.Discard, io.TeeReader(strings.NewReader("123456789"), tableHash))
+			Expect(formatChecksum(tableHash)).To(Equal("e3069283"))
+		})
+		It("pads the checksum to eight digits", func() {
+			Expect(formatChecksum(crc32.New(checksumTable))).To(Equal("00000000"))
+		})
+	})
+	Describe("verifyTableChecksum", func() {
+		It("accepts a matching checksum", func() {
+			Expect(verifyTableChecksum(16384, "e3069283", "e3069283")).To(Succeed())
+			Expect(utils.FileExists(checksumErrorFile)).To(BeFalse())
+		})
+		It("skips a table backed up without a checksum", func() {
+			Expect(verifyTableChecksum(16384, "", "e3069283")).To(Succeed())
+			Expect(utils.FileExists(checksumErrorFile)).To(BeFalse())
+		})
+		It("creates a checksum error file for a mismatched checksum", func() {
+			err := verifyTableChecksum(16384, "e3069283", "00000000")
+			Expect(err).To(MatchError("Checksum mismatch for table with oid 16384: expected e3069283, got 00000000"))
+			Expect(utils.FileExists(checksumErrorFile)).To(BeTrue())
+		})
+	})
+	Describe("createChecksumErrorFile", func() {
+		It("creates the checksum error file of the table", func() {
+			createChecksumErrorFile(16384)
+			Expect(utils.FileExists(checksumErrorFile)).To(BeTrue())
+		})
+	})
+	Describe("copyTableData", func() {
+		var destination *bytes.Buffer
+		newReader := func(data string) *RestoreReader {
+			return &RestoreReader{bufReader: bufio.NewReader(strings.NewReader(data)), readerType: NONSEEKABLE}
+		}
+		BeforeEach(func() {
+			destination = &bytes.Buffer{}
+		})
+		It("copies data matching its checksum", func() {
+			bytesRead, err := copyTableData(newReader("123456789"), destination, crc32.New(checksumTable), 16384, 9, "e3069283")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bytesRead).To(Equal(int64(9)))
+			Expect(destination.String()).To(Equal("123456789"))
+			Expect(utils.FileExists(checksumErrorFile)).To(BeFalse())
+		})
+		It("creates a checksum error file for altered data", func() {
+			bytesRead, err := copyTableData(newReader("123456780"), destination, crc32.New(checksumTable), 16384, 9, "e3069283")
+			Expect(err).To(MatchError(ContainSubstring("Checksum mismatch for table with oid 16384: expected e3069283")))
+			Expect(bytesRead).To(Equal(int64(9)))
+			Expect(utils.FileExists(checksumErrorFile)).To(BeTrue())
+		})
+		It("creates a checksum error file for truncated data", func() {
+			bytesRead, err := copyTableData(newReader("12345"), destination, crc32.New(checksumTable), 16384, 9, "e3069283")
+			Expect(err).To(Equal(io.EOF))
+			Expect(bytesRead).To(Equal(int64(5)))
+			Expect(utils.FileExists(checksumErrorFile)).To(BeTrue())
+		})
+		It("creates a checksum error file for truncated data backed up without a checksum", func() {
+			_, err := copyTableData(newReader("12345"), destination, crc32.New(checksumTable), 16384, 9, "")
+			Expect(err).To(Equal(io.EOF))
+			Expect(utils.FileExists(checksumErrorFile)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,152 @@
+package helper
+
+/*
+ * This file contains functions for running gpbackup_helper as the plugin
+ * executable for --storage s3, which gpbackup and gprestore call with the
+ * plugin API commands in the same way as an external plugin.
+ */
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const s3PluginAPIVersion = "0.4.0"
+
+/*
+ * Each command is passed the client for the plugin config, which is always
+ * the first argument after the command, and the remaining arguments.
+ */
+var s3PluginCommands = map[string]func(client *utils.S3Client, args []string) error{
+	"setup_plugin_for_backup":    setupS3ForBackup,
+	"setup_plugin_for_restore":   func(*utils.S3Client, []string) error { return nil },
+	"cleanup_plugin_for_backup":  func(*utils.S3Client, []string) error { return nil },
+	"cleanup_plugin_for_restore": func(*utils.S3Client, []string) error { return nil },
+	"backup_file":                backupFileToS3,
+	"restore_file":               restoreFileFromS3,
+	"backup_data":                backupDataToS3,
+	"restore_data":               restoreDataFromS3,
+	"delete_backup":              deleteBackupFromS3,
+}
+
+func isS3PluginCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	_, ok := s3PluginCommands[args[0]]
+	return ok || args[0] == "plugin_api_version"
+}
+
+/*
+ * Errors are written to stderr, where gpbackup and gprestore read them as
+ * they would for any plugin.
+ */
+func doS3PluginCommand(args []string) {
+	command := args[0]
+	if command == "plugin_api_version" {
+		fmt.Println(s3PluginAPIVersion)
+		return
+	}
+	err := runS3PluginCommand(command, args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		os.Exit(1)
+	}
+}
+
+func runS3PluginCommand(command string, args []string) error {
+	if len(args) < 1 {
+		return errors.New("a plugin config path is required")
+	}
+	settings, err := utils.ReadS3SettingsFromPluginConfig(args[0])
+	if err != nil {
+		return err
+	}
+	client, err := utils.NewS3Client(settings)
+	if err != nil {
+		return err
+	}
+	return s3PluginCommands[command](client, args[1:])
+}
+
+/*
+ * Checks that the bucket can be reached once for the whole cluster, so that
+ * a backup with bad credentials or an unreachable endpoint fails before any
+ * data is written.
+ */
+func setupS3ForBackup(client *utils.S3Client, args []string) error {
+	if len(args) < 2 || args[1] != string(utils.MASTER) {
+		return nil
+	}
+	return client.CheckBucket()
+}
+
+func backupFileToS3(client *utils.S3Client, args []string) error {
+	if len(args) < 1 {
+		return errors.New("a file to back up is required")
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return client.Upload(client.Settings.ObjectKey(args[0]), file)
+}
+
+func restoreFileFromS3(client *utils.S3Client, args []string) error {
+	if len(args) < 1 {
+		return errors.New("a file to restore is required")
+	}
+	reader, err := client.Download(client.Settings.ObjectKey(args[0]))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	err = os.MkdirAll(filepath.Dir(args[0]), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func backupDataToS3(client *utils.S3Client, args []string) error {
+	if len(args) < 1 {
+		return errors.New("a data file key is required")
+	}
+	return client.Upload(client.Settings.ObjectKey(args[0]), os.Stdin)
+}
+
+func restoreDataFromS3(client *utils.S3Client, args []string) error {
+	if len(args) < 1 {
+		return errors.New("a data file key is required")
+	}
+	reader, err := client.Download(client.Settings.ObjectKey(args[0]))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(os.Stdout, reader)
+	return err
+}
+
+func deleteBackupFromS3(client *utils.S3Client, args []string) error {
+	if len(args) < 1 {
+		return errors.New("a backup timestamp is required")
+	}
+	_, err := client.DeletePrefix(client.Settings.BackupPrefix(args[0]))
+	return err
+}
@@ -20,52 +20,131 @@ type RestorePlanEntry struct {
 	TableFQNs []string
 }
 
+/*
+ * A PXF server and profile referenced by the LOCATION of one or more PXF
+ * external tables.  The server configuration itself lives on the segment
+ * hosts rather than in the catalog, so it must already exist at restore time.
+ */
+type PXFReference struct {
+	Server  string
+	Profile string
+}
+
 const (
 	BackupStatusSucceed = "Success"
 	BackupStatusFailed  = "Failure"
 )
 
+/*
+ * The format version of the files of a backup is raised whenever a change to
+ * the config, TOC, or segment TOC files would keep an older gprestore from
+ * restoring the backup correctly, so that gprestore can tell whether it can
+ * read a backup from its format rather than from the version of gpbackup
+ * that took it.  Backups taken before format versions were recorded are in
+ * format version 1.  The data files hold nothing but table data, which COPY
+ * reads directly, so their format is described by the segment TOCs.
+ */
+const (
+	UNVERSIONED_FORMAT_VERSION = 1
+	CURRENT_FORMAT_VERSION     = 2
+)
+
 type BackupConfig struct {
 	BackupDir             string
 	BackupVersion         string
 	Compressed            bool
 	CompressionType       string
+	CredentialsFile       bool   `yaml:",omitempty"`
+	DatabaseCollate       string `yaml:",omitempty"`
+	DatabaseCType         string `yaml:",omitempty"`
+	DatabaseEncoding      string `yaml:",omitempty"`
 	DatabaseName          string
+	DatabaseTablespace    string `yaml:",omitempty"`
 	DatabaseVersion       string
+	DataLayout            string `yaml:",omitempty"`
 	DataOnly              bool
+	DatabaseGroup         string `yaml:",omitempty"`
 	DateDeleted           string
+	Dedup                 bool `yaml:",omitempty"`
+	Differential          bool `yaml:",omitempty"`
 	ExcludeRelations      []string
 	ExcludeSchemaFiltered bool
 	ExcludeSchemas        []string
 	ExcludeTableFiltered  bool
+	FormatVersion         int  `yaml:",omitempty"`
+	GlobalsFile           bool `yaml:",omitempty"`
 	IncludeRelations      []string
 	IncludeSchemaFiltered bool
 	IncludeSchemas        []string
 	IncludeTableFiltered  bool
 	Incremental           bool
+	IsolationLevel        string `yaml:",omitempty"`
 	LeafPartitionData     bool
+	MetadataChecksum      string `yaml:",omitempty"`
 	MetadataOnly          bool
+	NoLock                bool `yaml:",omitempty"`
 	Plugin                string
 	PluginVersion         string
 	RestorePlan           []RestorePlanEntry
+	Resumed               bool   `yaml:",omitempty"`
+	SegmentCount          int    `yaml:",omitempty"`
+	SharedSnapshot        string `yaml:",omitempty"`
 	SingleDataFile        bool
 	Timestamp             string
+	UnchangedSince        string `yaml:",omitempty"`
 	EndTime               string
 	WithoutGlobals        bool
 	WithStatistics        bool
 	Status                string
+	BackupSize            int64          `yaml:",omitempty"`
+	DataSize              int64          `yaml:",omitempty"`
+	PXFReferences         []PXFReference `yaml:",omitempty"`
 }
 
 func (backup *BackupConfig) Failed() bool {
 	return backup.Status == BackupStatusFailed
 }
 
+/*
+ * Backups taken before format versions were recorded have none in their
+ * config file.
+ */
+func (backup *BackupConfig) GetFormatVersion() int {
+	if backup.FormatVersion == 0 {
+		return UNVERSIONED_FORMAT_VERSION
+	}
+	return backup.FormatVersion
+}
+
+/*
+ * The shims that translate the config file of each older format version into
+ * the next one.  Fields that are unknown to this version, as written by a
+ * later gpbackup in a compatible format, are ignored when the file is read.
+ */
+var configFormatShims = map[int]func(config *BackupConfig){
+	// Format 1 config files of compressed backups may not name the compression type
+	1: func(config *BackupConfig) {
+		if config.Compressed && config.CompressionType == "" {
+			config.CompressionType = "gzip"
+		}
+	},
+}
+
+func TranslateConfigFormat(config *BackupConfig) {
+	for formatVersion := config.GetFormatVersion(); formatVersion < CURRENT_FORMAT_VERSION; formatVersion++ {
+		if shim, ok := configFormatShims[formatVersion]; ok {
+			shim(config)
+		}
+	}
+}
+
 func ReadConfigFile(filename string) *BackupConfig {
 	config := &BackupConfig{}
 	contents, err := ioutil.ReadFile(filename)
 	gplog.FatalOnError(err)
 	err = yaml.Unmarshal(contents, config)
 	gplog.FatalOnError(err)
+	TranslateConfigFormat(config)
 	return config
 }
 
@@ -188,6 +267,10 @@ func lockHistoryFile() lockfile.Lockfile {
 }
 
 func (history *History) WriteToFileAndMakeReadOnly(filename string) error {
+	return writeYAMLToFileAndMakeReadOnly(filename, history)
+}
+
+func writeYAMLToFileAndMakeReadOnly(filename string, contents interface{}) error {
 	_, err := operating.System.Stat(filename)
 	fileExists := err == nil
 	if fileExists {
@@ -196,7 +279,7 @@ func (history *History) WriteToFileAndMakeReadOnly(filename string) error {
 			return err
 		}
 	}
-	historyFileContents, err := yaml.Marshal(history)
+	historyFileContents, err := yaml.Marshal(contents)
 
 	if err != nil {
 		return err
@@ -212,3 +295,100 @@ func (history *History) FindBackupConfig(timestamp string) *BackupConfig {
 	}
 	return nil
 }
+
+/*
+ * Sets DateDeleted on the entries for the given timestamps.  The history file
+ * is re-read while holding the lock so that entries written by a concurrent
+ * backup are not lost.
+ */
+func MarkBackupsDeleted(historyFilePath string, timestamps []string, dateDeleted string) error {
+	lock := lockHistoryFile()
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	history, err := NewHistory(historyFilePath)
+	if err != nil {
+		return err
+	}
+	deleted := make(map[string]bool, len(timestamps))
+	for _, timestamp := range timestamps {
+		deleted[timestamp] = true
+	}
+	for i := range history.BackupConfigs {
+		if deleted[history.BackupConfigs[i].Timestamp] {
+			history.BackupConfigs[i].DateDeleted = dateDeleted
+		}
+	}
+	return history.WriteToFileAndMakeReadOnly(historyFilePath)
+}
+
+/*
+ * A record of a gprestore run.  Restores are recorded in a history file of
+ * their own in the master data directory of the cluster that was restored to,
+ * so that the backup history file does not need to be rewritten by gprestore.
+ */
+type RestoreConfig struct {
+	Timestamp        string
+	EndTime          string
+	BackupTimestamp  string
+	BackupDir        string
+	Plugin           string
+	SourceDatabase   string
+	TargetDatabase   string
+	TargetCluster    string
+	IncludeRelations []string
+	IncludeSchemas   []string
+	ExcludeRelations []string
+	ExcludeSchemas   []string
+	RedirectSchema   string
+	DataOnly         bool
+	MetadataOnly     bool
+	Incremental      bool
+	Status           string
+}
+
+func (restore *RestoreConfig) Failed() bool {
+	return restore.Status == BackupStatusFailed
+}
+
+type RestoreHistory struct {
+	RestoreConfigs []RestoreConfig
+}
+
+func NewRestoreHistory(filename string) (*RestoreHistory, error) {
+	restoreHistory := &RestoreHistory{RestoreConfigs: make([]RestoreConfig, 0)}
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(contents, restoreHistory)
+	if err != nil {
+		return nil, err
+	}
+	return restoreHistory, nil
+}
+
+/*
+ * Adds the given restore to the front of the restore history, creating the
+ * history file if it does not exist.
+ */
+func WriteRestoreHistory(historyFilePath string, currentRestoreConfig *RestoreConfig) error {
+	lock := lockHistoryFile()
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	currentRestoreConfig.EndTime = CurrentTimestamp()
+	restoreHistory := &RestoreHistory{RestoreConfigs: make([]RestoreConfig, 0)}
+	if _, err := operating.System.Stat(historyFilePath); err == nil {
+		restoreHistory, err = NewRestoreHistory(historyFilePath)
+		if err != nil {
+			return err
+		}
+	} else {
+		gplog.Verbose("No existing restores found. Creating new restore history file.")
+	}
+	restoreHistory.RestoreConfigs = append([]RestoreConfig{*currentRestoreConfig}, restoreHistory.RestoreConfigs...)
+	return writeYAMLToFileAndMakeReadOnly(historyFilePath, restoreHistory)
+}
@@ -0,0 +1,147 @@
+package history
+
+/*
+ * This file contains functions for recording the backup history in a table,
+ * for sites with so many backups that reading and rewriting the history file
+ * is slow.  Each backup is a row holding its config in the same YAML as the
+ * history file, so that fields added to BackupConfig need no table changes.
+ */
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gpbackup/utils"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	HISTORY_SCHEMA = "gpbackup_history"
+	HISTORY_TABLE  = "gpbackup_history.backups"
+)
+
+func historyTableExists(conn *dbconn.DBConn) (bool, error) {
+	tableName, err := dbconn.SelectString(conn, fmt.Sprintf(`
+	SELECT c.relname AS string
+	FROM pg_class c
+	JOIN pg_namespace n ON c.relnamespace = n.oid
+	WHERE n.nspname = '%s' AND c.relname = 'backups'`, HISTORY_SCHEMA))
+	return tableName != "", err
+}
+
+/*
+ * The schema and table are created in their own transaction, as a backup
+ * that fails to record its history should not leave an empty schema behind.
+ */
+func CreateHistoryTable(conn *dbconn.DBConn) error {
+	tableExists, err := historyTableExists(conn)
+	if err != nil || tableExists {
+		return err
+	}
+	schemaName, err := dbconn.SelectString(conn, fmt.Sprintf("SELECT nspname AS string FROM pg_namespace WHERE nspname = '%s'", HISTORY_SCHEMA))
+	if err != nil {
+		return err
+	}
+	err = conn.Begin()
+	if err != nil {
+		return err
+	}
+	if schemaName == "" {
+		_, err = conn.Exec(fmt.Sprintf("CREATE SCHEMA %s", HISTORY_SCHEMA))
+	}
+	if err == nil {
+		_, err = conn.Exec(fmt.Sprintf(`CREATE TABLE %s (
+	backup_timestamp text NOT NULL PRIMARY KEY,
+	database_name text NOT NULL,
+	status text NOT NULL,
+	end_time text NOT NULL,
+	date_deleted text NOT NULL,
+	config text NOT NULL
+) DISTRIBUTED BY (backup_timestamp)`, HISTORY_TABLE))
+	}
+	if err != nil {
+		_ = conn.Rollback()
+		return err
+	}
+	return conn.Commit()
+}
+
+/*
+ * The row of each backup is replaced rather than updated, so that the same
+ * statements record a new backup, a backup marked deleted, and a backup
+ * migrated from the history file again.
+ */
+func GetBackupHistoryStatements(backupConfig *BackupConfig) ([]string, error) {
+	contents, err := yaml.Marshal(backupConfig)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := utils.EscapeSingleQuotes(backupConfig.Timestamp)
+	return []string{
+		fmt.Sprintf("DELETE FROM %s WHERE backup_timestamp = '%s'", HISTORY_TABLE, timestamp),
+		fmt.Sprintf("INSERT INTO %s VALUES ('%s', '%s', '%s', '%s', '%s', '%s')", HISTORY_TABLE, timestamp,
+			utils.EscapeSingleQuotes(backupConfig.DatabaseName), utils.EscapeSingleQuotes(backupConfig.Status),
+			utils.EscapeSingleQuotes(backupConfig.EndTime), utils.EscapeSingleQuotes(backupConfig.DateDeleted),
+			utils.EscapeSingleQuotes(string(contents))),
+	}, nil
+}
+
+/*
+ * Records the given backups in a single transaction, so that the table never
+ * holds only some of them.  Literals are written with standard quoting, so
+ * backslashes in the configs are kept as they are.
+ */
+func WriteBackupHistoryToDB(conn *dbconn.DBConn, backupConfigs []BackupConfig) error {
+	err := CreateHistoryTable(conn)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec("SET standard_conforming_strings TO on")
+	if err != nil {
+		return err
+	}
+	err = conn.Begin()
+	if err != nil {
+		return err
+	}
+	for i := range backupConfigs {
+		statements, err := GetBackupHistoryStatements(&backupConfigs[i])
+		for j := 0; err == nil && j < len(statements); j++ {
+			_, err = conn.Exec(statements[j])
+		}
+		if err != nil {
+			_ = conn.Rollback()
+			return err
+		}
+	}
+	return conn.Commit()
+}
+
+/*
+ * Returns the backups recorded in the table, newest first, as they would be
+ * read from the history file.  A database without the table has no history.
+ */
+func NewHistoryFromDB(conn *dbconn.DBConn) (*History, error) {
+	history := &History{BackupConfigs: make([]BackupConfig, 0)}
+	tableExists, err := historyTableExists(conn)
+	if err != nil || !tableExists {
+		return history, err
+	}
+	contents, err := dbconn.SelectStringSlice(conn, fmt.Sprintf("SELECT config AS string FROM %s", HISTORY_TABLE))
+	if err != nil {
+		return nil, err
+	}
+	for _, content := range contents {
+		backupConfig := BackupConfig{}
+		err = yaml.Unmarshal([]byte(content), &backupConfig)
+		if err != nil {
+			return nil, err
+		}
+		history.BackupConfigs = append(history.BackupConfigs, backupConfig)
+	}
+	sort.Slice(history.BackupConfigs, func(i, j int) bool {
+		return history.BackupConfigs[i].Timestamp > history.BackupConfigs[j].Timestamp
+	})
+	return history, nil
+}
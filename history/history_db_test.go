@@ -0,0 +1,107 @@
+package history_test
+
+import (
+	"strings"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("history/history_db tests", func() {
+	var (
+		conn   *dbconn.DBConn
+		mock   sqlmock.Sqlmock
+		config history.BackupConfig
+	)
+	BeforeEach(func() {
+		conn, mock = testhelper.CreateAndConnectMockDB(1)
+		config = history.BackupConfig{DatabaseName: "o'brien", Timestamp: "20170101010101", Status: history.BackupStatusSucceed, EndTime: "20170101010202"}
+	})
+	expectTableExists := func(exists bool) {
+		rows := sqlmock.NewRows([]string{"string"})
+		if exists {
+			rows.AddRow("backups")
+		}
+		mock.ExpectQuery("SELECT c.relname AS string").WillReturnRows(rows)
+	}
+	Describe("GetBackupHistoryStatements", func() {
+		It("replaces the row of the backup with one holding its config", func() {
+			contents, _ := yaml.Marshal(config)
+
+			statements, err := history.GetBackupHistoryStatements(&config)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(statements).To(Equal([]string{
+				"DELETE FROM gpbackup_history.backups WHERE backup_timestamp = '20170101010101'",
+				"INSERT INTO gpbackup_history.backups VALUES ('20170101010101', 'o''brien', 'Success', '20170101010202', '', '" + strings.Replace(string(contents), "'", "''", -1) + "')",
+			}))
+		})
+	})
+	Describe("WriteBackupHistoryToDB", func() {
+		It("creates the table and records the backups in one transaction", func() {
+			expectTableExists(false)
+			mock.ExpectQuery("SELECT nspname AS string").WillReturnRows(sqlmock.NewRows([]string{"string"}))
+			mock.ExpectBegin()
+			mock.ExpectExec("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("CREATE SCHEMA gpbackup_history").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("CREATE TABLE gpbackup_history.backups").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+			mock.ExpectExec("SET standard_conforming_strings TO on").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectBegin()
+			mock.ExpectExec("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("DELETE FROM gpbackup_history.backups").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("INSERT INTO gpbackup_history.backups").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(history.WriteBackupHistoryToDB(conn, []history.BackupConfig{config})).To(Succeed())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("records none of the backups if one cannot be recorded", func() {
+			expectTableExists(true)
+			mock.ExpectExec("SET standard_conforming_strings TO on").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectBegin()
+			mock.ExpectExec("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("DELETE FROM gpbackup_history.backups").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("INSERT INTO gpbackup_history.backups").WillReturnError(errors.New("disk full"))
+			mock.ExpectRollback()
+
+			err := history.WriteBackupHistoryToDB(conn, []history.BackupConfig{config})
+
+			Expect(err).To(MatchError("disk full"))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
+	Describe("NewHistoryFromDB", func() {
+		It("reads the backups from the table newest first", func() {
+			olderConfig := config
+			olderConfig.Timestamp = "20160101010101"
+			older, _ := yaml.Marshal(olderConfig)
+			newer, _ := yaml.Marshal(config)
+			expectTableExists(true)
+			mock.ExpectQuery("SELECT config AS string FROM gpbackup_history.backups").WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow(string(older)).AddRow(string(newer)))
+
+			backupHistory, err := history.NewHistoryFromDB(conn)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupHistory.BackupConfigs).To(HaveLen(2))
+			Expect(backupHistory.BackupConfigs[0].Timestamp).To(Equal("20170101010101"))
+			Expect(backupHistory.BackupConfigs[0].DatabaseName).To(Equal("o'brien"))
+			Expect(backupHistory.BackupConfigs[1].Timestamp).To(Equal("20160101010101"))
+		})
+		It("has no backups if the table does not exist", func() {
+			expectTableExists(false)
+
+			backupHistory, err := history.NewHistoryFromDB(conn)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupHistory.BackupConfigs).To(BeEmpty())
+		})
+	})
+})
@@ -298,4 +298,98 @@ var _ = Describe("backup/history tests", func() {
 			Expect(foundConfig).To(BeNil())
 		})
 	})
+	Describe("TranslateConfigFormat", func() {
+		It("names the compression type of a compressed backup in the unversioned format", func() {
+			config := history.BackupConfig{Compressed: true}
+			history.TranslateConfigFormat(&config)
+			Expect(config.CompressionType).To(Equal("gzip"))
+		})
+		It("leaves a config in the current format as it is", func() {
+			config := history.BackupConfig{Compressed: true, FormatVersion: history.CURRENT_FORMAT_VERSION}
+			history.TranslateConfigFormat(&config)
+			Expect(config.CompressionType).To(BeEmpty())
+		})
+	})
+	Describe("MarkBackupsDeleted", func() {
+		It("sets the deletion date on only the given backups", func() {
+			err := history.WriteBackupHistory(historyFilePath, &testConfig1)
+			Expect(err).ToNot(HaveOccurred())
+			err = history.WriteBackupHistory(historyFilePath, &testConfig2)
+			Expect(err).ToNot(HaveOccurred())
+			err = history.WriteBackupHistory(historyFilePath, &testConfig3)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = history.MarkBackupsDeleted(historyFilePath, []string{"timestamp1", "timestamp3"}, "20170101010101")
+			Expect(err).ToNot(HaveOccurred())
+
+			resultHistory, err := history.NewHistory(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultHistory.BackupConfigs).To(HaveLen(3))
+			Expect(resultHistory.BackupConfigs[0].DateDeleted).To(Equal("20170101010101"))
+			Expect(resultHistory.BackupConfigs[1].DateDeleted).To(BeEmpty())
+			Expect(resultHistory.BackupConfigs[2].DateDeleted).To(Equal("20170101010101"))
+		})
+		It("returns an error when the history file does not exist", func() {
+			err := history.MarkBackupsDeleted(historyFilePath, []string{"timestamp1"}, "20170101010101")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("WriteRestoreHistory", func() {
+		var restoreConfig1, restoreConfig2 history.RestoreConfig
+		BeforeEach(func() {
+			restoreConfig1 = history.RestoreConfig{
+				Timestamp:        "20170101010101",
+				BackupTimestamp:  "timestamp1",
+				SourceDatabase:   "testdb1",
+				TargetDatabase:   "devdb",
+				TargetCluster:    "mdw:5432",
+				IncludeRelations: []string{},
+				IncludeSchemas:   []string{"public"},
+				ExcludeRelations: []string{},
+				ExcludeSchemas:   []string{},
+				Status:           history.BackupStatusSucceed,
+			}
+			restoreConfig2 = history.RestoreConfig{
+				Timestamp:        "20170102010101",
+				BackupTimestamp:  "timestamp2",
+				SourceDatabase:   "testdb2",
+				TargetDatabase:   "devdb",
+				TargetCluster:    "mdw:5432",
+				IncludeRelations: []string{},
+				IncludeSchemas:   []string{},
+				ExcludeRelations: []string{},
+				ExcludeSchemas:   []string{},
+				Status:           history.BackupStatusFailed,
+			}
+		})
+		It("writes file with new config when file does not exist", func() {
+			simulatedEndTime := time.Now()
+			operating.System.Now = func() time.Time {
+				return simulatedEndTime
+			}
+			err := history.WriteRestoreHistory(historyFilePath, &restoreConfig1)
+			Expect(err).ToNot(HaveOccurred())
+
+			resultHistory, err := history.NewRestoreHistory(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultHistory.RestoreConfigs).To(HaveLen(1))
+			Expect(resultHistory.RestoreConfigs[0]).To(structmatcher.MatchStruct(restoreConfig1))
+			Expect(restoreConfig1.EndTime).To(Equal(simulatedEndTime.Format("20060102150405")))
+			Expect(testLogfile).To(Say("No existing restores found. Creating new restore history file."))
+		})
+		It("adds new config to the front of the history when file exists", func() {
+			err := history.WriteRestoreHistory(historyFilePath, &restoreConfig1)
+			Expect(err).ToNot(HaveOccurred())
+			err = history.WriteRestoreHistory(historyFilePath, &restoreConfig2)
+			Expect(err).ToNot(HaveOccurred())
+
+			resultHistory, err := history.NewRestoreHistory(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultHistory.RestoreConfigs).To(HaveLen(2))
+			Expect(resultHistory.RestoreConfigs[0]).To(structmatcher.MatchStruct(restoreConfig2))
+			Expect(resultHistory.RestoreConfigs[1]).To(structmatcher.MatchStruct(restoreConfig1))
+			Expect(resultHistory.RestoreConfigs[1].Failed()).To(BeFalse())
+			Expect(resultHistory.RestoreConfigs[0].Failed()).To(BeTrue())
+		})
+	})
 })
@@ -263,4 +263,28 @@ var _ = Describe("backup integration tests", func() {
 			})
 		})
 	})
+	Describe("GetHeapIncrementalMetadata", func() {
+		var heapTableFQN = "public.heap_foo"
+		BeforeEach(func() {
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf("CREATE TABLE %s (i int)", heapTableFQN))
+		})
+		AfterEach(func() {
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf(dropTableSQL, heapTableFQN))
+		})
+		It("only retrieves heap metadata for heap tables", func() {
+			heapIncrementalMetadata := backup.GetHeapIncrementalMetadata(connectionPool)
+
+			Expect(heapIncrementalMetadata).To(HaveKey(heapTableFQN))
+			Expect(heapIncrementalMetadata).To(Not(HaveKey(aoTableFQN)))
+			Expect(heapIncrementalMetadata[heapTableFQN].LastDDLTimestamp).To(Not(BeEmpty()))
+		})
+		It("has a new relfilenode after the table is truncated", func() {
+			oldEntry := backup.GetHeapIncrementalMetadata(connectionPool)[heapTableFQN]
+			testhelper.AssertQueryRuns(connectionPool, fmt.Sprintf("TRUNCATE %s", heapTableFQN))
+
+			newEntry := backup.GetHeapIncrementalMetadata(connectionPool)[heapTableFQN]
+
+			Expect(newEntry.RelFileNode).To(Not(Equal(oldEntry.RelFileNode)))
+		})
+	})
 })
@@ -485,7 +485,7 @@ var _ = Describe("backup integration create statement tests", func() {
 	Describe("PrintCreateExtensions", func() {
 		It("creates extensions", func() {
 			testutils.SkipIfBefore5(connectionPool)
-			plperlExtension := backup.Extension{Oid: 1, Name: "plperl", Schema: "pg_catalog"}
+			plperlExtension := backup.Extension{Oid: 1, Name: "plperl", Schema: "pg_catalog", Version: "1.0"}
 			extensions := []backup.Extension{plperlExtension}
 			extensionMetadataMap := testutils.DefaultMetadataMap("EXTENSION", false, false, true, false)
 			extensionMetadata := extensionMetadataMap[plperlExtension.GetUniqueID()]
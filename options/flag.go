@@ -14,103 +14,337 @@ import (
 )
 
 const (
-	BACKUP_DIR            = "backup-dir"
-	COMPRESSION_TYPE      = "compression-type"
-	COMPRESSION_LEVEL     = "compression-level"
-	DATA_ONLY             = "data-only"
-	DBNAME                = "dbname"
-	DEBUG                 = "debug"
-	EXCLUDE_RELATION      = "exclude-table"
-	EXCLUDE_RELATION_FILE = "exclude-table-file"
-	EXCLUDE_SCHEMA        = "exclude-schema"
-	EXCLUDE_SCHEMA_FILE   = "exclude-schema-file"
-	FROM_TIMESTAMP        = "from-timestamp"
-	INCLUDE_RELATION      = "include-table"
-	INCLUDE_RELATION_FILE = "include-table-file"
-	INCLUDE_SCHEMA        = "include-schema"
-	INCLUDE_SCHEMA_FILE   = "include-schema-file"
-	INCREMENTAL           = "incremental"
-	JOBS                  = "jobs"
-	LEAF_PARTITION_DATA   = "leaf-partition-data"
-	METADATA_ONLY         = "metadata-only"
-	NO_COMPRESSION        = "no-compression"
-	PLUGIN_CONFIG         = "plugin-config"
-	QUIET                 = "quiet"
-	SINGLE_DATA_FILE      = "single-data-file"
-	VERBOSE               = "verbose"
-	WITH_STATS            = "with-stats"
-	CREATE_DB             = "create-db"
-	ON_ERROR_CONTINUE     = "on-error-continue"
-	REDIRECT_DB           = "redirect-db"
-	RUN_ANALYZE           = "run-analyze"
-	TIMESTAMP             = "timestamp"
-	WITH_GLOBALS          = "with-globals"
-	REDIRECT_SCHEMA       = "redirect-schema"
-	TRUNCATE_TABLE        = "truncate-table"
-	WITHOUT_GLOBALS       = "without-globals"
+	ACL_MODE                = "acl-mode"
+	ALL_DATABASES           = "all-databases"
+	ANALYZE_PARTITION_ROOTS = "analyze-partition-roots"
+	BACKUP_DIR              = "backup-dir"
+	CLEANUP                 = "cleanup"
+	CLEANUP_ON_FAILURE      = "cleanup-on-failure"
+	CLIENT_MODE             = "client-mode"
+	COMPRESSION_TYPE        = "compression-type"
+	COMPRESSION_LEVEL       = "compression-level"
+	COMPRESSION_OVERRIDES   = "compression-override-file"
+	COMPRESSION_WORKERS     = "compression-workers"
+	CONSISTENT_SNAPSHOT     = "consistent-snapshot"
+	CONTENDED_TABLES_FIRST  = "contended-tables-first"
+	COPY_QUEUE_SIZE         = "copy-queue-size"
+	DATA_LAYOUT             = "data-layout"
+	DATA_ONLY               = "data-only"
+	DATABASE_GROUP          = "database-group"
+	DBNAME                  = "dbname"
+	DEBUG                   = "debug"
+	DEDUP                   = "dedup"
+	DIFF                    = "diff"
+	DIFF_FORMAT             = "diff-format"
+	DIFFERENTIAL            = "differential"
+	DRY_RUN                 = "dry-run"
+	DELETE_BEFORE           = "delete-before"
+	ESTIMATE                = "estimate"
+	EXACT_SEQ_VALUES        = "exact-sequence-values"
+	EXCLUDE_RELATION        = "exclude-table"
+	EXCLUDE_TABLE_DATA      = "exclude-table-data"
+	EXCLUDE_TABLE_DATA_FILE = "exclude-table-data-file"
+	EXCLUDE_RELATION_FILE   = "exclude-table-file"
+	EXCLUDE_SCHEMA          = "exclude-schema"
+	EXCLUDE_SCHEMA_FILE     = "exclude-schema-file"
+	EXCLUDE_LARGER_THAN     = "exclude-table-larger-than"
+	EXCLUDE_OBJECT_TYPE     = "exclude-object-type"
+	EXTENSION_VERSIONS      = "extension-versions"
+	FROM_TIMESTAMP          = "from-timestamp"
+	HISTORY_DB              = "history-db"
+	EXCHANGE_PARTITION      = "exchange-partition"
+	INCLUDE_DATABASE        = "include-database"
+	INCLUDE_PARTITION       = "include-partition"
+	INCLUDE_RELATION        = "include-table"
+	INCLUDE_RELATION_FILE   = "include-table-file"
+	IMPORT_SNAPSHOT         = "import-snapshot"
+	INCLUDE_SCHEMA          = "include-schema"
+	INCLUDE_SCHEMA_FILE     = "include-schema-file"
+	INCLUDE_SMALLER_THAN    = "include-table-smaller-than"
+	INCREMENTAL             = "incremental"
+	ISOLATION_LEVEL         = "isolation-level"
+	JOBS                    = "jobs"
+	JOBS_MAX                = "jobs-max"
+	JOBS_MIN                = "jobs-min"
+	KEEP_GREENPLUM_SYNTAX   = "keep-greenplum-syntax"
+	LEAF_PARTITION_DATA     = "leaf-partition-data"
+	LEAF_DATA_LARGER_THAN   = "leaf-partition-data-larger-than"
+	LIST                    = "list"
+	LIST_BACKUPS            = "list-backups"
+	LIST_FORMAT             = "list-format"
+	LIST_OBJECT_TYPE        = "list-object-type"
+	LIST_RESTORES           = "list-restores"
+	LIST_TOC                = "list-toc"
+	LOCK_TIMEOUT            = "lock-timeout"
+	MACHINE_OUTPUT          = "machine-output"
+	MAX_CONCURRENT          = "max-concurrent"
+	METADATA_ONLY           = "metadata-only"
+	MIGRATE_HISTORY         = "migrate-history"
+	MIRROR_FAILOVER         = "mirror-failover"
+	NO_COMPRESSION          = "no-compression"
+	NO_LOCK                 = "no-lock"
+	NO_SEGMENTS             = "no-segments"
+	NO_SYNC_SNAPSHOT        = "no-synchronized-snapshot"
+	OBJECT_HANDLER_FILE     = "object-handler-file"
+	PHASE                   = "phase"
+	PLUGIN_CONFIG           = "plugin-config"
+	PROGRESS                = "progress"
+	QUIET                   = "quiet"
+	RESTORE_GLOBALS         = "restore-globals"
+	RESUME                  = "resume"
+	REDACT_CREDENTIALS      = "redact-credentials"
+	RETENTION_COUNT         = "retention-count"
+	S3_BUCKET               = "s3-bucket"
+	S3_ENDPOINT             = "s3-endpoint"
+	S3_FOLDER               = "s3-folder"
+	S3_PART_SIZE            = "s3-part-size"
+	S3_REGION               = "s3-region"
+	S3_SSE                  = "s3-sse"
+	S3_SSE_KMS_KEY_ID       = "s3-sse-kms-key-id"
+	SINGLE_DATA_FILE        = "single-data-file"
+	SKIP_DISK_SPACE_CHECK   = "skip-disk-space-check"
+	SKIP_IF_UNCHANGED       = "skip-if-unchanged"
+	SKIP_LOCKED_TABLES      = "skip-locked-tables"
+	SLA_FILE                = "sla-file"
+	SPLIT_LARGER_THAN       = "split-table-data-larger-than"
+	SKIP_UNKNOWN_GUCS       = "skip-unknown-gucs"
+	SPLIT_TABLE_STREAMS     = "split-table-streams"
+	STATEMENT_TIMEOUT_POST  = "statement-timeout-postdata"
+	STATEMENT_TIMEOUT_PRE   = "statement-timeout-predata"
+	STATUS                  = "status"
+	STORAGE                 = "storage"
+	TEST_RESTORE            = "test-restore"
+	TABLE_TIMINGS           = "table-timings"
+	VERBOSE                 = "verbose"
+	VERIFY_SAMPLE           = "verify-sample"
+	VERIFY_SEED             = "verify-seed"
+	WITH_STATS              = "with-stats"
+	CREATE_DB               = "create-db"
+	CREATE_DB_OPTIONS       = "create-db-with-options"
+	CREDENTIALS_KEY_FILE    = "credentials-key-file"
+	ON_CONFLICT             = "on-conflict"
+	CONFLICT_SUFFIX         = "conflict-suffix"
+	ON_ERROR_CONTINUE       = "on-error-continue"
+	REDIRECT_DB             = "redirect-db"
+	RUN_ANALYZE             = "run-analyze"
+	THROTTLE_CPU            = "throttle-cpu-percent"
+	THROTTLE_IOWAIT         = "throttle-iowait-percent"
+	TIMESTAMP               = "timestamp"
+	TOC_EDIT                = "toc-edit"
+	TO_FILE                 = "to-file"
+	TO_FILE_DATA            = "to-file-data"
+	TO_FILE_FORMAT          = "to-file-format"
+	EXTRACT_TABLE           = "extract-table"
+	EXTRACT_FORMAT          = "format"
+	EXTRACT_OUTPUT          = "output"
+	IMPORT_TABLE            = "import-table"
+	IMPORT_FILE             = "import-file"
+	IMPORT_HEADER           = "import-header"
+	TRANSFORM_PLUGIN        = "transform-plugin"
+	TRANSFORM_PROGRAM       = "transform-program"
+	TRANSLATE_DDL           = "translate-ddl"
+	WITH_GLOBALS            = "with-globals"
+	REDIRECT_SCHEMA         = "redirect-schema"
+	REFRESH_MATVIEWS        = "refresh-materialized-views"
+	RETRY_FAILED            = "retry-failed"
+	SCHEMA_PREFIX           = "schema-prefix"
+	SCHEMA_SUFFIX           = "schema-suffix"
+	SEGMENT_REJECT_LIMIT    = "segment-reject-limit"
+	TRUNCATE_TABLE          = "truncate-table"
+	TRUNCATE_CASCADE        = "truncate-cascade"
+	VALIDATE_ROWCOUNTS      = "validate-rowcounts"
+	VERIFY_TABLE_DEFS       = "verify-table-definitions"
+	WAIT_FOR_DIR_LOCK       = "wait-for-directory-lock"
+	WITHOUT_GLOBALS         = "without-globals"
 )
 
 func SetBackupFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.Bool(ALL_DATABASES, false, "Back up every database that accepts connections, except template0 and template1, instead of the database given by --dbname")
 	flagSet.String(BACKUP_DIR, "", "The absolute path of the directory to which all backup files will be written")
+	flagSet.String(CLEANUP, "", "Instead of taking a backup, remove the files of the failed or terminated backup with the specified timestamp from the backup directories of all hosts, and mark it deleted in the backup history")
+	flagSet.String(CLEANUP_ON_FAILURE, "never", "Whether to remove the partial files of a backup from the backup directories of all hosts when it fails or is terminated. Valid values are 'ask' to ask when run from a terminal, 'always', and 'never' to keep them so that the backup can be resumed with --resume or removed later with --cleanup")
+	flagSet.Bool(CLIENT_MODE, false, "Run the backup from a host other than the coordinator, such as a workstation or CI runner, connecting to the coordinator only over libpq as given by PGHOST and PGPORT. The metadata files are written to --backup-dir on this host, and the segments write the data files to --backup-dir on the segment hosts. Requires --backup-dir, and cannot be used with options that run commands on the segment hosts")
 	flagSet.String(COMPRESSION_TYPE, "gzip", "Type of compression to use during data backup. Valid values are 'gzip', 'zstd'")
 	flagSet.Int(COMPRESSION_LEVEL, 1, "Level of compression to use during data backup. Range of valid values depends on compression type")
+	flagSet.String(COMPRESSION_OVERRIDES, "", "A file containing lines of the form 'schema.table:level' to override the compression level of specific tables, where a level of 'none' disables compression")
+	flagSet.Int(COMPRESSION_WORKERS, 1, "The number of cores with which to compress the data of each segment.  Data compressed with gzip on several cores can still be read with gunzip")
+	flagSet.Bool(CONSISTENT_SNAPSHOT, false, "When backing up multiple databases, back up every database as of the same point in time, by holding a transaction open in each database until all of them are backed up. Requires GPDB 7 or later")
+	flagSet.Int(COPY_QUEUE_SIZE, 0, "The most COPY pipelines to run on each segment host at once. As each table being copied runs a pipeline on every segment, fewer tables are copied at once than --jobs allows if a host has too many segments. A value of 0 disables the limit")
+	flagSet.Bool(CONTENDED_TABLES_FIRST, false, "Back up the data of the tables with the most waiting lock requests first, as sampled from pg_locks when the data backup starts, so that the sessions waiting on them are held up for less time")
+	flagSet.String(DATA_LAYOUT, "oid", "The layout of the data files on each segment. Valid values are 'oid', which names each file for the backup timestamp and table oid, and 'directory', which writes the data of each table to a file named for the table in a directory named for its schema, so that the files of a table have the same path in every backup")
 	flagSet.Bool(DATA_ONLY, false, "Only back up data, do not back up metadata")
-	flagSet.String(DBNAME, "", "The database to be backed up")
+	flagSet.String(DATABASE_GROUP, "", "The timestamp of the multi-database backup that this backup is part of")
+	flagSet.String(DBNAME, "", "The database to be backed up.  A comma-separated list of databases may be given to back up each of them in turn.")
 	flagSet.Bool(DEBUG, false, "Print verbose and debug log messages")
+	flagSet.Bool(DEDUP, false, "Store table data as content-defined chunks shared with the other deduplicated backups in the same backup directory, so that only chunks not already stored are written")
+	flagSet.StringSlice(DIFF, []string{}, "Instead of taking a backup, compare the metadata of the two backups with the given comma-separated timestamps and print the objects added, removed, and changed between them")
+	flagSet.String(DIFF_FORMAT, "text", "The output format to use with --diff. Valid values are 'text', 'json'")
+	flagSet.Bool(DIFFERENTIAL, false, "Use with --incremental to base the backup off the last full backup and to also skip heap tables that the statistics collector shows as unmodified since then. Requires track_counts.")
+	flagSet.Bool(DRY_RUN, false, "Instead of taking a backup, print the tables that would be backed up with their sizes and an estimate of how long the backup would take, without locking tables or writing any files")
+	flagSet.Bool(ESTIMATE, false, "Instead of taking a backup, print as JSON the size of the data of each table that would be backed up and its expected compressed size, based on the compression ratio of previous backups of the database, without locking tables or writing any files")
+	flagSet.String(DELETE_BEFORE, "", "Instead of taking a backup, delete the backups of the database taken before the specified date, in the format YYYYMMDD or YYYYMMDDHHMMSS")
 	flagSet.StringArray(EXCLUDE_SCHEMA, []string{}, "Back up all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
 	flagSet.String(EXCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas to be excluded from the backup")
 	flagSet.StringArray(EXCLUDE_RELATION, []string{}, "Back up all metadata except the specified table(s). --exclude-table can be specified multiple times.")
 	flagSet.String(EXCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified tables to be excluded from the backup")
+	flagSet.StringArray(EXCLUDE_TABLE_DATA, []string{}, "Back up the metadata of the specified table(s) but not their data. --exclude-table-data can be specified multiple times.")
+	flagSet.String(EXCLUDE_TABLE_DATA_FILE, "", "A file containing a list of fully-qualified tables whose metadata is backed up but whose data is not")
+	flagSet.String(EXCLUDE_LARGER_THAN, "", "Back up all tables except those whose on-disk size is larger than the specified size, e.g. '500MB' or '2TB'")
 	flagSet.String(FROM_TIMESTAMP, "", "A timestamp to use to base the current incremental backup off")
 	flagSet.Bool("help", false, "Help for gpbackup")
+	flagSet.String(HISTORY_DB, "", "Also record the backup history in the gpbackup_history.backups table of the specified database, which can be the database being backed up or a separate catalog database. The backup history is then read from the table instead of the history file when listing backups")
 	flagSet.StringArray(INCLUDE_SCHEMA, []string{}, "Back up only the specified schema(s). --include-schema can be specified multiple times.")
+	flagSet.String(IMPORT_SNAPSHOT, "", "The snapshot, exported by a multi-database backup with --consistent-snapshot, as of which the database is backed up")
 	flagSet.String(INCLUDE_SCHEMA_FILE, "", "A file containing a list of schema(s) to be included in the backup")
 	flagSet.StringArray(INCLUDE_RELATION, []string{}, "Back up only the specified table(s). --include-table can be specified multiple times.")
 	flagSet.String(INCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified tables to be included in the backup")
+	flagSet.String(INCLUDE_SMALLER_THAN, "", "Back up only tables whose on-disk size is smaller than the specified size, e.g. '500MB' or '2TB'")
 	flagSet.Bool(INCREMENTAL, false, "Only back up data for AO tables that have been modified since the last backup")
-	flagSet.Int(JOBS, 1, "The number of parallel connections to use when backing up data")
+	flagSet.String(ISOLATION_LEVEL, "serializable", "The isolation level of the transactions in which the metadata and data are backed up. Valid values are 'serializable' and 'repeatable-read'. On heavily concurrent systems, 'repeatable-read' avoids the serialization failures of serializable transactions, at the cost of their stronger consistency guarantees")
+	flagSet.String(JOBS, "1", "The number of parallel connections to use when backing up data, or \"auto\" to pick the number from the size and resource settings of the cluster")
 	flagSet.Bool(LEAF_PARTITION_DATA, false, "For partition tables, create one data file per leaf partition instead of one data file for the whole table")
+	flagSet.String(LEAF_DATA_LARGER_THAN, "", "For partition tables whose on-disk size is larger than the specified size, e.g. '100GB', create one data file per leaf partition and back up the leaf partitions in parallel, largest first")
+	flagSet.String(LIST, "", "Instead of taking a backup, list the objects in the backup with the specified timestamp with their types, sizes, and dependencies, as recorded in its TOC. The objects can be filtered with --include-schema, --exclude-schema, --include-table, --exclude-table, and --list-object-type")
+	flagSet.Bool(LIST_BACKUPS, false, "Instead of taking a backup, list the backups of the database recorded in the backup history")
+	flagSet.String(LIST_FORMAT, "table", "The output format to use with --list, --list-backups, or --list-restores. Valid values are 'table', 'json'")
+	flagSet.StringSlice(LIST_OBJECT_TYPE, []string{}, "Use with --list to list only objects of the specified comma-separated types, such as TABLE,INDEX. The data of tables has the type 'TABLE DATA'")
+	flagSet.Bool(LIST_RESTORES, false, "Instead of taking a backup, list the restores into the database recorded in the restore history")
+	flagSet.Int(LOCK_TIMEOUT, 0, "The number of seconds to wait for the ACCESS SHARE locks on the tables to be backed up before failing the backup. A value of 0 waits indefinitely")
+	flagSet.Bool(MACHINE_OUTPUT, false, "Write only a JSON summary of the backup, with its status, object counts, errors, and report file, to stdout, and write all log messages to stderr. Use with --quiet to write only warnings and errors to stderr")
 	flagSet.Bool(METADATA_ONLY, false, "Only back up metadata, do not back up data")
+	flagSet.Bool(MIGRATE_HISTORY, false, "Instead of taking a backup, copy the backups recorded in the backup history file into the table of the database specified with --history-db")
+	flagSet.Bool(MIRROR_FAILOVER, false, "If a segment host cannot be reached, perform that segment's file operations on the host of its mirror instead. Requires --backup-dir to be on storage shared by primary and mirror hosts.")
 	flagSet.Bool(NO_COMPRESSION, false, "Disable compression of data files")
+	flagSet.Bool(NO_LOCK, false, "Do not lock the tables being backed up, to start large backups sooner.  Only use when no DDL runs during the backup, as tables changed by concurrent DDL may be backed up inconsistently or fail the backup")
+	flagSet.Bool(NO_SEGMENTS, false, "Use with --metadata-only to back up without connecting to the segment hosts over ssh or creating backup directories on them, writing every file of the backup on the coordinator host only, for quick schema snapshots such as in CI pipelines. Cannot be used with options that run commands on the segment hosts")
+	flagSet.Bool(REDACT_CREDENTIALS, false, "Replace the values of credential options, such as passwords, of foreign servers and user mappings with placeholders in the metadata file")
+	flagSet.String(CREDENTIALS_KEY_FILE, "", "Use with --redact-credentials to write the redacted credentials to a separate file, encrypted with a key derived from the contents of the specified file, that gprestore can use to restore them")
+	flagSet.Bool(NO_SYNC_SNAPSHOT, false, "Do not share one snapshot between the connections used with --jobs, so that each connection takes its own snapshot as on GPDB versions before 7")
+	flagSet.String(OBJECT_HANDLER_FILE, "", "A file declaring queries that generate the statements to back up objects that gpbackup does not otherwise back up, such as objects created by extensions")
 	flagSet.String(PLUGIN_CONFIG, "", "The configuration file to use for a plugin")
+	flagSet.String(PROGRESS, "objects", "How to show the progress of the data backup.  Valid values are 'objects' to count tables, 'bytes' to show the bytes copied with the throughput and estimated time remaining, and 'none'")
 	flagSet.Bool("version", false, "Print version number and exit")
 	flagSet.Bool(QUIET, false, "Suppress non-warning, non-error log messages")
+	flagSet.String(RESUME, "", "The timestamp of an interrupted backup to resume, backing up only the data of tables not backed up before the interruption. Must be run with the same options as the interrupted backup.")
+	flagSet.Int(RETENTION_COUNT, 0, "Instead of taking a backup, delete all but the specified number of most recent successful backups of the database")
+	flagSet.String(S3_BUCKET, "", "The S3 bucket to which the backup will be written when used with --storage s3")
+	flagSet.String(S3_ENDPOINT, "", "The endpoint of an S3-compatible object store, such as MinIO or Ceph, to use instead of Amazon S3")
+	flagSet.String(S3_FOLDER, "", "The folder in the S3 bucket under which backups will be written")
+	flagSet.Int(S3_PART_SIZE, 64, "The size in megabytes of each part of a multipart upload to S3, from 5 to 5120")
+	flagSet.String(S3_REGION, "", "The region of the S3 bucket.  Defaults to the AWS_REGION environment variable, or us-east-1")
+	flagSet.String(S3_SSE, "", "The server-side encryption to request for objects written to S3. Valid values are 'AES256', 'aws:kms'")
+	flagSet.String(S3_SSE_KMS_KEY_ID, "", "The KMS key to use with --s3-sse aws:kms, instead of the default key of the account")
 	flagSet.Bool(SINGLE_DATA_FILE, false, "Back up all data to a single file instead of one per table")
+	flagSet.Bool(SKIP_DISK_SPACE_CHECK, false, "Do not check before backing up data that the backup directories on the segment hosts have enough free space for the estimated size of the backup")
+	flagSet.Bool(SKIP_IF_UNCHANGED, false, "Skip backing up the data if neither the metadata nor the data of any table changed since the last matching backup, and record the backup as unchanged since that one")
+	flagSet.Bool(SKIP_LOCKED_TABLES, false, "Use with --lock-timeout to leave out of the backup, and list in the report, the tables that cannot be locked within the timeout instead of failing the backup")
+	flagSet.String(SLA_FILE, "", "A file containing the duration, throughput, and age targets for backups of each database")
+	flagSet.String(SPLIT_LARGER_THAN, "", "For non-partitioned tables whose on-disk size is larger than the specified size, e.g. '100GB', copy the data with several concurrent COPY statements, each writing its own data file on every segment. Requires a synchronized snapshot, so GPDB 7 or later and --jobs greater than 1")
+	flagSet.Int(SPLIT_TABLE_STREAMS, 4, "Use with --split-table-data-larger-than to set the number of concurrent COPY statements for each table, up to the number of --jobs")
+	flagSet.String(STATUS, "", "Instead of taking a backup, print the current phase, progress, errors, and estimated completion time of the running or finished backup with the specified timestamp")
+	flagSet.String(STORAGE, "local", "Where to store the backup. Valid values are 'local' for the backup directories, 's3' to write directly to S3 with the --s3-* options")
+	flagSet.Bool(TABLE_TIMINGS, false, "Write the lock wait, copy duration, size, rows, and compression ratio of each table to a CSV file next to the report, and list the slowest tables in the report")
+	flagSet.String(TEST_RESTORE, "", "Instead of taking a backup, check that the backup with the specified timestamp can be restored by reading and decompressing all of its data files and checking all of its metadata statements, without restoring anything")
+	flagSet.Int(THROTTLE_CPU, 0, "Copy the data of only one table at a time while the CPU usage of any segment host is above the specified percentage. A value of 0 disables the check")
+	flagSet.Int(THROTTLE_IOWAIT, 0, "Copy the data of only one table at a time while the IO wait of any segment host is above the specified percentage. A value of 0 disables the check")
 	flagSet.Bool(VERBOSE, false, "Print verbose log messages")
+	flagSet.String(VERIFY_SAMPLE, "", "Use with --test-restore to read and decompress the data files of only a random sample of the specified percentage of the tables, such as '5%', along with those of the 10 largest tables. The sampled tables are listed in the result")
+	flagSet.Int(VERIFY_SEED, 0, "Use with --verify-sample to choose the sample with the specified seed, as printed by an earlier run, to check the same tables again. By default a new seed is used")
+	flagSet.Int(WAIT_FOR_DIR_LOCK, 0, "The number of seconds to wait for another gpbackup writing to the same backup directory to finish before failing the backup. A value of 0 fails the backup at once")
 	flagSet.Bool(WITH_STATS, false, "Back up query plan statistics")
+	flagSet.Bool(WITH_GLOBALS, false, "Back up cluster-level global metadata (roles, role memberships, resource queues and groups, and tablespaces) to a separate globals file instead of the metadata file")
 	flagSet.Bool(WITHOUT_GLOBALS, false, "Disable backup of global metadata")
+	_ = flagSet.MarkHidden(DATABASE_GROUP)
+	_ = flagSet.MarkHidden(IMPORT_SNAPSHOT)
 }
 
 func SetRestoreFlagDefaults(flagSet *pflag.FlagSet) {
+	flagSet.String(ACL_MODE, "replace", "How to restore the privileges of the restored objects. Valid values are 'replace' to restore them as backed up, replacing any existing privileges, 'skip' to not restore them, and 'merge' to add the backed up grants to the existing privileges, skipping grants to roles that do not exist in the restore database")
+	flagSet.Bool(ANALYZE_PARTITION_ROOTS, false, "After restoring data, run ANALYZE ROOTPARTITION on the root partition of each partitioned table with a leaf partition whose data was restored, running as many at once as --jobs allows, so that the planner has statistics for the partitioned tables")
+	flagSet.Bool(ALL_DATABASES, false, "Restore every database in the multi-database backup with the timestamp given by --timestamp, each into the database that was backed up")
 	flagSet.String(BACKUP_DIR, "", "The absolute path of the directory in which the backup files to be restored are located")
 	flagSet.Bool(CREATE_DB, false, "Create the database before metadata restore")
+	flagSet.Bool(CREATE_DB_OPTIONS, false, "Use with --create-db to create the database with the encoding, LC_COLLATE, LC_CTYPE, and tablespace it had at backup time, instead of inheriting any that matched template0 of the backed up cluster from template0 of the restore cluster")
 	flagSet.Bool(DATA_ONLY, false, "Only restore data, do not restore metadata")
 	flagSet.Bool(DEBUG, false, "Print verbose and debug log messages")
+	flagSet.Bool(DRY_RUN, false, "Instead of restoring, write the statements that would be executed and the tables whose data would be loaded, in order, to a file in the backup directory")
 	flagSet.StringArray(EXCLUDE_SCHEMA, []string{}, "Restore all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
 	flagSet.String(EXCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas that will not be restored")
 	flagSet.StringArray(EXCLUDE_RELATION, []string{}, "Restore all metadata except the specified relation(s). --exclude-table can be specified multiple times.")
 	flagSet.String(EXCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified relation(s) that will not be restored")
+	flagSet.StringSlice(EXCLUDE_OBJECT_TYPE, []string{}, "Restore all metadata except objects of the specified comma-separated types, such as INDEX,TRIGGER,RULE, so that they can be created after the data is loaded. The objects not restored are listed in the restore report")
+	flagSet.Bool(EXACT_SEQ_VALUES, false, "Use with --data-only to set each sequence to its value in the backup even if that moves the sequence back. By default, a data-only restore only advances sequences that are behind their value in the backup")
+	flagSet.Bool(EXCHANGE_PARTITION, false, "Use with --include-partition and --data-only to load the data of each leaf partition into a new table and exchange it into the existing partitioned table, instead of loading the data into the leaf partition")
+	flagSet.String(EXTENSION_VERSIONS, "pin", "The versions of the extensions to create. Valid values are 'pin' to create the version that was backed up, and 'upgrade' to create the default version of the restore database")
 	flagSet.Bool("help", false, "Help for gprestore")
+	flagSet.StringArray(INCLUDE_DATABASE, []string{}, "Restore only the specified database(s) of the multi-database backup with the timestamp given by --timestamp. --include-database can be specified multiple times.")
+	flagSet.StringArray(INCLUDE_PARTITION, []string{}, "Restore only the data of the specified leaf partition(s), along with the definition of their partitioned tables, from a backup taken with --leaf-partition-data. --include-partition can be specified multiple times.")
 	flagSet.StringArray(INCLUDE_SCHEMA, []string{}, "Restore only the specified schema(s). --include-schema can be specified multiple times.")
 	flagSet.String(INCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas that will be restored")
 	flagSet.StringArray(INCLUDE_RELATION, []string{}, "Restore only the specified relation(s). --include-table can be specified multiple times.")
 	flagSet.String(INCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified relation(s) that will be restored")
 	flagSet.Bool(INCREMENTAL, false, "BETA FEATURE: Only restore data for all heap tables and only AO tables that have been modified since the last backup")
+	flagSet.Bool(MACHINE_OUTPUT, false, "Write only a JSON summary of the restore, with its status, object counts, errors, and report file, to stdout, and write all log messages to stderr. Use with --quiet to write only warnings and errors to stderr")
 	flagSet.Bool(METADATA_ONLY, false, "Only restore metadata, do not restore data")
-	flagSet.Int(JOBS, 1, "Number of parallel connections to use when restoring table data and post-data")
+	flagSet.String(JOBS, "1", "Number of parallel connections to use when restoring table data and post-data, or \"auto\" to pick the number from the size and resource settings of the cluster")
+	flagSet.Int(JOBS_MAX, 1, "The maximum number of parallel connections to use when restoring table data and post-data, adjusted with the load on the restore database.  Must be used with --jobs-min")
+	flagSet.Int(JOBS_MIN, 1, "The minimum number of parallel connections to use when restoring table data and post-data.  Must be used with --jobs-max")
+	flagSet.StringArray(KEEP_GREENPLUM_SYNTAX, []string{}, "Use with --to-file-format postgres to keep the specified Greenplum-specific syntax instead of removing it. Valid values are 'distributed-by', 'storage-options', 'partition-by', 'greenplum-objects'. --keep-greenplum-syntax can be specified multiple times.")
+	flagSet.String(LIST_TOC, "", "Instead of restoring, write the entries of the backup to the specified file, to be edited and passed to --toc-edit, without connecting to a database")
+	flagSet.StringToInt(MAX_CONCURRENT, map[string]int{}, "Maximum number of post-data statements of the specified object type(s), or of ANALYZE statements with --run-analyze, to run concurrently, e.g. index=4,constraint=2,analyze=2")
+	flagSet.String(ON_CONFLICT, "", "How to handle tables, views, and sequences that already exist in the restore database. Valid values are 'skip', 'replace', 'suffix'")
+	flagSet.String(CONFLICT_SUFFIX, "_restored", "The suffix to append to the names of conflicting relations when used with --on-conflict suffix")
+	flagSet.String(CREDENTIALS_KEY_FILE, "", "The key file used to back up with --redact-credentials, to restore the redacted credentials of foreign servers and user mappings")
 	flagSet.Bool(ON_ERROR_CONTINUE, false, "Log errors and continue restore, instead of exiting on first error")
+	flagSet.StringSlice(PHASE, []string{}, "Restore only the specified comma-separated phases, out of 'predata', 'data', 'postdata', and 'statistics', leaving the others to later runs of gprestore with the same --timestamp. Each phase can only be restored after the phases it depends on")
 	flagSet.String(PLUGIN_CONFIG, "", "The configuration file to use for a plugin")
+	flagSet.String(PROGRESS, "objects", "How to show the progress of the data restore.  Valid values are 'objects' to count tables, 'bytes' to show the bytes copied with the throughput and estimated time remaining, and 'none'")
 	flagSet.Bool("version", false, "Print version number and exit")
 	flagSet.Bool(QUIET, false, "Suppress non-warning, non-error log messages")
+	flagSet.Bool(SKIP_DISK_SPACE_CHECK, false, "Do not check before restoring that the data directories of the segments have enough free space for the data to restore")
+	flagSet.Bool(SKIP_UNKNOWN_GUCS, false, "Skip the database and role configuration settings of parameters that do not exist in the restore database, such as those removed in a later GPDB version")
+	flagSet.String(SLA_FILE, "", "A file containing the duration, throughput, and age targets for restores into each database")
+	flagSet.Int(STATEMENT_TIMEOUT_POST, 0, "The number of seconds each post-data statement, such as CREATE INDEX or ADD CONSTRAINT, may run. A statement that times out is recorded as a failed object, as with --on-error-continue, and the restore goes on. A value of 0 disables the timeout")
+	flagSet.Int(STATEMENT_TIMEOUT_PRE, 0, "The number of seconds each pre-data statement may run. A statement that times out is recorded as a failed object, as with --on-error-continue, and the restore goes on. A value of 0 disables the timeout")
+	flagSet.Bool(STATUS, false, "Instead of restoring, print the current phase, progress, errors, and estimated completion time of the running or most recent restore of the backup with the timestamp given by --timestamp")
 	flagSet.String(REDIRECT_DB, "", "Restore to the specified database instead of the database that was backed up")
 	flagSet.String(REDIRECT_SCHEMA, "", "Restore to the specified schema instead of the schema that was backed up")
+	flagSet.String(SCHEMA_PREFIX, "", "Restore each schema under its name with this prefix added, such as staging_, to restore a copy of the schemas alongside the originals")
+	flagSet.String(SCHEMA_SUFFIX, "", "Restore each schema under its name with this suffix added, to restore a copy of the schemas alongside the originals")
+	flagSet.String(TRANSFORM_PLUGIN, "", "A Go plugin exporting a TransformStatement function, which is called to rewrite each metadata statement before it is run")
+	flagSet.String(TRANSFORM_PROGRAM, "", "A program to rewrite the metadata statements before they are run, which is given the statements of each section as JSON lines on standard input and writes them to standard output")
+	flagSet.String(REFRESH_MATVIEWS, "", "Once the data is restored, refresh the materialized views, which are restored without data.  Valid values are 'populated' to refresh those that held data when the backup was taken, and 'all'.  Views are refreshed in parallel as set by --jobs, after the views they depend on")
+	flagSet.Bool(RESTORE_GLOBALS, false, "Restore the cluster-level global metadata in the globals file of a backup taken with --with-globals before restoring the database")
+	flagSet.String(RETRY_FAILED, "", "The failed objects file of a previous --on-error-continue restore of this backup, to restore only the objects that failed")
+	flagSet.String(S3_BUCKET, "", "The S3 bucket from which the backup will be read when used with --storage s3")
+	flagSet.String(S3_ENDPOINT, "", "The endpoint of an S3-compatible object store, such as MinIO or Ceph, to use instead of Amazon S3")
+	flagSet.String(S3_FOLDER, "", "The folder in the S3 bucket under which the backup was written")
+	flagSet.String(S3_REGION, "", "The region of the S3 bucket.  Defaults to the AWS_REGION environment variable, or us-east-1")
+	flagSet.String(SEGMENT_REJECT_LIMIT, "", "Load table data in single row error isolation mode, logging the rows that cannot be loaded to the error log of each table instead of failing the table, unless more than the specified number of rows, or percentage of rows such as '5%', is rejected on any segment")
+	flagSet.String(STORAGE, "local", "Where the backup is stored. Valid values are 'local' for the backup directories, 's3' to read directly from S3 with the --s3-* options")
+	flagSet.Bool(TABLE_TIMINGS, false, "Write the copy duration, size, and rows of each table to a CSV file next to the report, and list the slowest tables in the report")
 	flagSet.Bool(WITH_GLOBALS, false, "Restore global metadata")
 	flagSet.String(TIMESTAMP, "", "The timestamp to be restored, in the format YYYYMMDDHHMMSS")
+	flagSet.String(TOC_EDIT, "", "Restore only the entries listed in the specified file, written with --list-toc and edited to remove or reorder entries, in the listed order within each section")
+	flagSet.String(TO_FILE, "", "Instead of restoring, write the statements of the restore to the specified file as a psql script, without connecting to a database")
+	flagSet.Bool(TO_FILE_DATA, false, "Use with --to-file to also write a COPY statement loading the data of each table from the backup files")
+	flagSet.String(TO_FILE_FORMAT, "greenplum", "The format of the --to-file script. Valid values are 'greenplum', and 'postgres' to remove Greenplum-specific syntax so the script can be run against PostgreSQL and to include the data of --to-file-data in the script")
+	flagSet.String(EXTRACT_TABLE, "", "Instead of restoring, write the data of the specified table, in the form <schema>.<table>, to a file in the --output directory, reading the backup files of every segment under --backup-dir without connecting to a database")
+	flagSet.String(EXTRACT_FORMAT, "csv", "The format of the file written by --extract-table. Valid values are 'csv' and 'parquet'")
+	flagSet.String(EXTRACT_OUTPUT, "", "The directory to which --extract-table writes the data of the table")
+	flagSet.String(IMPORT_TABLE, "", "Instead of restoring a backup, load the data of the specified table, in the form <schema>.<table>, in the --redirect-db database from the --import-file CSV files, such as those written by --extract-table")
+	flagSet.StringArray(IMPORT_FILE, []string{}, "An absolute path of a CSV file to load with --import-table. Specify multiple times for multiple files, which are loaded in parallel. The rows of a file on the master host are distributed to the segments, while a path containing <SEGID> is read by each segment from its own host, replacing <SEGID> with its content id, and its rows must belong to that segment")
+	flagSet.Bool(IMPORT_HEADER, false, "Use with --import-table to skip the first line of each import file, and load the columns it names in that order if the file is on the master host")
+	flagSet.Bool(TRANSLATE_DDL, false, "Restore into a database of a different major version of GPDB, even an earlier one, rewriting the DDL known to be incompatible with it, such as storage options and syntax that were added or removed. Each rewrite is logged. Extensions are created at their default versions unless --extension-versions is used. This is best effort, and other objects may fail to restore")
 	flagSet.Bool(TRUNCATE_TABLE, false, "Removes data of the tables getting restored")
+	flagSet.Bool(TRUNCATE_CASCADE, false, "Use with --truncate-table to also remove the data of tables with foreign keys referencing the tables getting restored")
 	flagSet.Bool(VERBOSE, false, "Print verbose log messages")
 	flagSet.Bool(WITH_STATS, false, "Restore query plan statistics")
 	flagSet.Bool(LEAF_PARTITION_DATA, false, "For partition tables, create one data file per leaf partition instead of one data file for the whole table")
-	flagSet.Bool(RUN_ANALYZE, false, "Run ANALYZE on restored tables")
+	flagSet.String(RUN_ANALYZE, "", "Run ANALYZE on restored tables after their data is loaded, or when used with --with-stats, only if the backup has no statistics. Use --run-analyze=rootpartition to analyze only the root partition of partitioned tables whose leaf partitions were backed up separately")
+	flagSet.Lookup(RUN_ANALYZE).NoOptDefVal = "all"
+	flagSet.Bool(VALIDATE_ROWCOUNTS, false, "Compare the row count of each restored table against the row count recorded at backup time")
+	flagSet.Bool(VERIFY_TABLE_DEFS, false, "Use with --data-only to check that the tables in the restore database, such as those created by another tool, have the columns and column types of the backup before restoring any data")
 	_ = flagSet.MarkHidden(LEAF_PARTITION_DATA)
 }
 
@@ -135,6 +369,26 @@ func CheckExclusiveFlags(flags *pflag.FlagSet, flagNames ...string) {
  * Functions for validating flag values
  */
 
+/*
+ * Converts the object types given to --max-concurrent into the format used in
+ * the TOC (e.g. "event_trigger" to "EVENT TRIGGER") and checks that each limit
+ * allows at least one statement to run.
+ */
+func ParseConcurrencyLimits(limits map[string]int) (map[string]int, error) {
+	objectTypeLimits := make(map[string]int, len(limits))
+	for objectType, limit := range limits {
+		if strings.TrimSpace(objectType) == "" {
+			return nil, errors.Errorf("An object type must be specified for each --max-concurrent limit")
+		}
+		if limit < 1 {
+			return nil, errors.Errorf("The --max-concurrent limit for %s must be at least 1", objectType)
+		}
+		tocObjectType := strings.ToUpper(strings.Replace(strings.TrimSpace(objectType), "_", " ", -1))
+		objectTypeLimits[tocObjectType] = limit
+	}
+	return objectTypeLimits, nil
+}
+
 /*
  * Convert arguments that contain a single dash to double dashes for backward
  * compatibility.
@@ -178,3 +432,9 @@ func MustGetFlagStringArray(cmdFlags *pflag.FlagSet, flagName string) []string {
 	gplog.FatalOnError(err)
 	return value
 }
+
+func MustGetFlagStringToInt(cmdFlags *pflag.FlagSet, flagName string) map[string]int {
+	value, err := cmdFlags.GetStringToInt(flagName)
+	gplog.FatalOnError(err)
+	return value
+}
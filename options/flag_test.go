@@ -57,5 +57,20 @@ var _ = Describe("utils/flag tests", func() {
 				Expect(result).To(Equal([]string{"-s", "some_argument"}))
 			})
 		})
+		Context("ParseConcurrencyLimits", func() {
+			It("converts object types to their TOC format", func() {
+				limits, err := options.ParseConcurrencyLimits(map[string]int{"index": 4, "event_trigger": 1})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(limits).To(Equal(map[string]int{"INDEX": 4, "EVENT TRIGGER": 1}))
+			})
+			It("returns an error if a limit is less than 1", func() {
+				_, err := options.ParseConcurrencyLimits(map[string]int{"index": 0})
+				Expect(err).To(MatchError("The --max-concurrent limit for index must be at least 1"))
+			})
+			It("returns an error if an object type is empty", func() {
+				_, err := options.ParseConcurrencyLimits(map[string]int{"": 2})
+				Expect(err).To(MatchError("An object type must be specified for each --max-concurrent limit"))
+			})
+		})
 	})
 })
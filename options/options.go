@@ -22,6 +22,7 @@ type Options struct {
 	IncludedSchemas           []string
 	originalIncludedRelations []string
 	RedirectSchema            string
+	ExcludedDataRelations     []string
 }
 
 func NewOptions(initialFlags *pflag.FlagSet) (*Options, error) {
@@ -58,6 +59,19 @@ func NewOptions(initialFlags *pflag.FlagSet) (*Options, error) {
 		return nil, err
 	}
 
+	// Only gpbackup can exclude the data of tables
+	excludedDataRelations := []string{}
+	if initialFlags.Lookup(EXCLUDE_TABLE_DATA) != nil {
+		excludedDataRelations, err = setFiltersFromFile(initialFlags, EXCLUDE_TABLE_DATA, EXCLUDE_TABLE_DATA_FILE)
+		if err != nil {
+			return nil, err
+		}
+		err = utils.ValidateFQNs(excludedDataRelations)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	redirectSchema := ""
 	if initialFlags.Lookup(REDIRECT_SCHEMA) != nil {
 		redirectSchema, err = initialFlags.GetString(REDIRECT_SCHEMA)
@@ -74,6 +88,7 @@ func NewOptions(initialFlags *pflag.FlagSet) (*Options, error) {
 		isLeafPartitionData:       leafPartitionData,
 		originalIncludedRelations: includedRelations,
 		RedirectSchema:            redirectSchema,
+		ExcludedDataRelations:     excludedDataRelations,
 	}, nil
 }
 
@@ -176,6 +191,22 @@ func QuoteTableNames(conn *dbconn.DBConn, tableNames []string) ([]string, error)
 	return result, nil
 }
 
+/*
+ * Quotes the schema and table of each name as QuoteTableNames does, for use
+ * when there is no connection to the database.
+ */
+func QuoteTableNamesWithoutConnection(tableNames []string) ([]string, error) {
+	fqnSlice, err := SeparateSchemaAndTable(tableNames)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0)
+	for _, fqn := range fqnSlice {
+		result = append(result, utils.MakeFQN(utils.QuoteIdentWithoutConnection(fqn.SchemaName), utils.QuoteIdentWithoutConnection(fqn.TableName)))
+	}
+	return result, nil
+}
+
 func SeparateSchemaAndTable(tableNames []string) ([]FqnStruct, error) {
 	fqnSlice := make([]FqnStruct, 0)
 	for _, fqn := range tableNames {
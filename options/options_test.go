@@ -202,6 +202,33 @@ var _ = Describe("options", func() {
 			_, err = options.NewOptions(myflags)
 			Expect(err).To(HaveOccurred())
 		})
+		It("sets the EXCLUDE_TABLE_DATA flag from file", func() {
+			file, err := ioutil.TempFile("/tmp", "gpbackup_test_options*.txt")
+			Expect(err).To(Not(HaveOccurred()))
+			defer func() {
+				_ = os.Remove(file.Name())
+			}()
+			_, err = file.WriteString("myschema.audit\n\nmyschema.scratch\n")
+			Expect(err).To(Not(HaveOccurred()))
+			err = file.Close()
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = myflags.Set(options.EXCLUDE_TABLE_DATA_FILE, file.Name())
+			Expect(err).ToNot(HaveOccurred())
+			subject, err := options.NewOptions(myflags)
+			Expect(err).To(Not(HaveOccurred()))
+
+			Expect(subject.ExcludedDataRelations).To(Equal([]string{"myschema.audit", "myschema.scratch"}))
+			excludedDataTables, err := myflags.GetStringArray(options.EXCLUDE_TABLE_DATA)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(excludedDataTables).To(Equal([]string{"myschema.audit", "myschema.scratch"}))
+		})
+		It("returns an error upon invalid data exclusions", func() {
+			err := myflags.Set(options.EXCLUDE_TABLE_DATA, "foo")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = options.NewOptions(myflags)
+			Expect(err).To(HaveOccurred())
+		})
 		Describe("AddIncludeRelation", func() {
 			It("it adds a relation", func() {
 				subject, err := options.NewOptions(myflags)
@@ -310,4 +337,15 @@ var _ = Describe("options", func() {
 		//	})
 		//
 	})
+	Describe("QuoteTableNamesWithoutConnection", func() {
+		It("quotes the schema and table of each fqn that need it", func() {
+			quotedTableNames, err := options.QuoteTableNamesWithoutConnection([]string{"public.foo", "Sales.order"})
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(quotedTableNames).To(Equal([]string{"public.foo", `"Sales"."order"`}))
+		})
+		It("returns an error if given a name that is not fully qualified", func() {
+			_, err := options.QuoteTableNamesWithoutConnection([]string{"foo"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
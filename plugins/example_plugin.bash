@@ -72,6 +72,35 @@ backup_data() {
 	cat - > /tmp/plugin_dest/$timestamp_day_dir/$timestamp_dir/$filename
 }
 
+backup_data_part() {
+  echo "backup_data_part $1 $2 $3 $4" >> /tmp/plugin_out.txt
+  filename=`basename "$2"`
+  timestamp_dir=`basename $(dirname "$2")`
+  timestamp_day_dir=${timestamp_dir%??????}
+  part_file=/tmp/plugin_dest/$timestamp_day_dir/$timestamp_dir/$filename.part$3
+	cat - > $part_file
+  if [ "`sha256sum $part_file | cut -d ' ' -f 1`" != "$4" ]
+    then echo "Checksum mismatch for part $3 of $2" >&2 && exit 1
+  fi
+}
+
+finalize_backup_data() {
+  echo "finalize_backup_data $1 $2 $3" >> /tmp/plugin_out.txt
+  filename=`basename "$2"`
+  timestamp_dir=`basename $(dirname "$2")`
+  timestamp_day_dir=${timestamp_dir%??????}
+  dest_file=/tmp/plugin_dest/$timestamp_day_dir/$timestamp_dir/$filename
+  > $dest_file
+  while read part_number checksum; do
+    part_file=$dest_file.part$part_number
+    if [ "`sha256sum $part_file | cut -d ' ' -f 1`" != "$checksum" ]
+      then echo "Checksum mismatch for part $part_number of $2" >&2 && exit 1
+    fi
+    cat $part_file >> $dest_file
+    rm $part_file
+  done
+}
+
 restore_data() {
   echo "restore_data $1 $2" >> /tmp/plugin_out.txt
   filename=`basename "$2"`
@@ -91,8 +120,8 @@ delete_backup() {
 }
 
 plugin_api_version(){
-  echo "0.4.0"
-  echo "0.4.0" >> /tmp/plugin_out.txt
+  echo "0.5.0"
+  echo "0.5.0" >> /tmp/plugin_out.txt
 }
 
 --version(){
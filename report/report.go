@@ -1,12 +1,20 @@
 package report
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
+	"math"
 	"os"
+	"path"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	texttemplate "text/template"
 	"time"
 
 	"github.com/blang/semver"
@@ -15,6 +23,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
@@ -27,16 +36,177 @@ import (
  * file that we will want to read in for a restore.
  */
 type Report struct {
-	BackupParamsString string
-	DatabaseSize       string
+	BackupParamsString  string
+	DatabaseSize        string
+	SizeFilteredTables  []string
+	DataExcludedTables  []string
+	LockSkippedTables   []string
+	SLAViolations       []string
+	MirrorSubstitutions []string
+	HelperFailures      []string
+	ResourceUsage       *ResourceUsage
+	DedupStats          *DedupStats
+	TableTimings        []TableTiming
 	history.BackupConfig
 }
 
+/*
+ * The bytes of chunks that a deduplicated backup stored, and of the chunks
+ * it used that earlier backups had already stored, as compressed on disk.
+ */
+type DedupStats struct {
+	NewBytes    int64
+	ReusedBytes int64
+}
+
+func (stats *DedupStats) Add(other DedupStats) {
+	stats.NewBytes += other.NewBytes
+	stats.ReusedBytes += other.ReusedBytes
+}
+
+/*
+ * The percentage of the data of the backup that did not need to be written.
+ */
+func (stats *DedupStats) SavedPercent() float64 {
+	total := stats.NewBytes + stats.ReusedBytes
+	if total == 0 {
+		return 0
+	}
+	return float64(stats.ReusedBytes) * 100 / float64(total)
+}
+
+/*
+ * Resources used by a run, for chargeback and capacity planning.  Usage by
+ * host is only available for runs that use gpbackup_helper agents, which are
+ * backups and restores of single-data-file backups.
+ */
+type ResourceUsage struct {
+	PeakMemory int64
+	IsRestore  bool
+	HostUsage  map[string]*utils.HelperResourceUsage
+}
+
+/*
+ * The time spent on the data of one table.  LockWait is only measured for
+ * backups, and CompressionRatio is 0 if the size of the data files of the
+ * table is not known, as for plugin and single-data-file backups.
+ */
+type TableTiming struct {
+	Table            string
+	LockWait         time.Duration
+	CopyDuration     time.Duration
+	Bytes            int64
+	Rows             int64
+	CompressionRatio float64
+}
+
+// The number of slowest tables listed in the report
+const numReportTableTimings = 10
+
+/*
+ * How the time of a restore was spent, so that --jobs can be tuned: how long
+ * each phase took, how long each connection spent running statements and
+ * loading data, and the statements that took longest.  ConnectionBusy is
+ * indexed by connection number.
+ */
+type RestoreTimings struct {
+	Phases            []PhaseTiming
+	ConnectionBusy    []time.Duration
+	SlowestStatements []StatementTiming
+}
+
+type PhaseTiming struct {
+	Phase    string
+	Duration time.Duration
+}
+
+type StatementTiming struct {
+	ObjectType string
+	Object     string
+	Duration   time.Duration
+}
+
+// The number of slowest statements kept for the report
+const NumSlowestStatements = 10
+
 type LineInfo struct {
 	Key   string
 	Value string
 }
 
+/*
+ * A single-line summary of a gpbackup or gprestore run.  It is written once
+ * at exit so that log aggregation and SIEM tools receive exactly one
+ * predictable record per run.  Bytes is -1 if the size could not be determined.
+ */
+type RunSummary struct {
+	Utility       string
+	RunID         string
+	Database      string
+	Type          string
+	Status        string
+	Duration      time.Duration
+	Bytes         int64
+	ObjectCounts  map[string]int
+	ErrorCount    int
+	ExitCode      int
+	FailedObjects []string
+	SLAViolations []string
+	Errors        []string
+	ReportFile    string
+	Timings       *RestoreTimings
+}
+
+/*
+ * The run summary as written to stdout with --machine-output, so that
+ * scripts wrapping gpbackup or gprestore can parse the result of the run.
+ * The lists are empty rather than null when there is nothing in them.
+ */
+type MachineOutput struct {
+	Utility         string         `json:"utility"`
+	RunID           string         `json:"run_id"`
+	Database        string         `json:"database"`
+	Type            string         `json:"type"`
+	Status          string         `json:"status"`
+	ExitCode        int            `json:"exit_code"`
+	DurationSeconds int64          `json:"duration_seconds"`
+	Bytes           int64          `json:"bytes"`
+	ObjectCounts    map[string]int `json:"object_counts"`
+	ErrorCount      int            `json:"error_count"`
+	Errors          []string       `json:"errors"`
+	FailedObjects   []string       `json:"failed_objects"`
+	SLAViolations   []string       `json:"sla_violations"`
+	ReportFile      string         `json:"report_file"`
+	Timings         *TimingsOutput `json:"timings,omitempty"`
+}
+
+/*
+ * The restore timings as written with --machine-output.  Utilization is the
+ * percentage of the duration of the phases that a connection was busy.
+ */
+type TimingsOutput struct {
+	Phases            []PhaseTimingOutput      `json:"phases"`
+	Connections       []ConnectionTimingOutput `json:"connections"`
+	SlowestStatements []StatementTimingOutput  `json:"slowest_statements"`
+}
+
+type PhaseTimingOutput struct {
+	Phase           string  `json:"phase"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+type ConnectionTimingOutput struct {
+	Connection         int     `json:"connection"`
+	BusySeconds        float64 `json:"busy_seconds"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+}
+
+type StatementTimingOutput struct {
+	ObjectType      string  `json:"object_type"`
+	Object          string  `json:"object"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
 func ParseErrorMessage(errStr string) string {
 	if errStr == "" {
 		return ""
@@ -85,6 +255,10 @@ func (report *Report) ConstructBackupParamsString() {
 		filesStr = "No Data Files"
 	} else if report.SingleDataFile {
 		filesStr = "Single Data File Per Segment"
+	} else if report.Dedup {
+		filesStr = "Deduplicated Chunks Per Segment"
+	} else if report.DataLayout == filepath.DataLayoutDirectory {
+		filesStr = "One Data File Per Table In Schema Directories"
 	}
 	statsStr := "No"
 	if report.WithStatistics {
@@ -134,6 +308,9 @@ func (report *Report) WriteBackupReportFile(reportFilename string, timestamp str
 	)
 
 	AppendBackupParams(&reportInfo, report.BackupParamsString)
+	if report.IsolationLevel != "" {
+		reportInfo = append(reportInfo, LineInfo{Key: "isolation level:", Value: report.IsolationLevel})
+	}
 
 	reportInfo = append(reportInfo,
 		LineInfo{},
@@ -150,6 +327,12 @@ func (report *Report) WriteBackupReportFile(reportFilename string, timestamp str
 		reportInfo = append(reportInfo,
 			LineInfo{},
 			LineInfo{Key: "backup status:", Value: history.BackupStatusSucceed})
+		if report.UnchangedSince != "" {
+			reportInfo = append(reportInfo, LineInfo{Key: "unchanged since:", Value: report.UnchangedSince})
+		}
+		if report.SharedSnapshot != "" {
+			reportInfo = append(reportInfo, LineInfo{Key: "shared snapshot:", Value: report.SharedSnapshot})
+		}
 	}
 	if report.DatabaseSize != "" {
 		reportInfo = append(reportInfo,
@@ -166,13 +349,43 @@ func (report *Report) WriteBackupReportFile(reportFilename string, timestamp str
 	logOutputReport(reportFile, reportInfo)
 
 	PrintObjectCounts(reportFile, objectCounts)
+	PrintSizeFilteredTables(reportFile, report.SizeFilteredTables)
+	PrintDataExcludedTables(reportFile, report.DataExcludedTables)
+	PrintNoLockWarning(reportFile, report.NoLock)
+	PrintLockSkippedTables(reportFile, report.LockSkippedTables)
+	PrintPXFReferences(reportFile, report.PXFReferences)
+	PrintSLAViolations(reportFile, report.SLAViolations)
+	PrintMirrorSubstitutions(reportFile, report.MirrorSubstitutions)
+	PrintHelperFailures(reportFile, report.HelperFailures)
+	PrintDedupStats(reportFile, report.DedupStats)
+	PrintTableTimings(reportFile, report.TableTimings)
+	PrintResourceUsage(reportFile, report.ResourceUsage)
 
 	err = reportFile.Close()
 	gplog.FatalOnError(err)
 	_ = operating.System.Chmod(reportFilename, 0444)
 }
 
-func WriteRestoreReportFile(reportFilename string, backupTimestamp string, startTimestamp string, connectionPool *dbconn.DBConn, restoreVersion string, errMsg string) {
+/*
+ * The sections of a restore report that follow its status.  Sections left
+ * empty are not written.
+ */
+type RestoreReportContents struct {
+	RowCountMismatches []string
+	RejectedRows       []string
+	RelationConflicts  []string
+	ExcludedObjects    []string
+	DataExcludedTables []string
+	SLAViolations      []string
+	AnalyzeTimings     []string
+	DeadlockRetries    []string
+	SequenceChanges    []string
+	TableTimings       []TableTiming
+	RestoreTimings     *RestoreTimings
+	ResourceUsage      *ResourceUsage
+}
+
+func WriteRestoreReportFile(reportFilename string, backupTimestamp string, startTimestamp string, connectionPool *dbconn.DBConn, restoreVersion string, errMsg string, contents RestoreReportContents) {
 	reportFile, err := iohelper.OpenFileForWriting(reportFilename)
 	if err != nil {
 		gplog.Error("Unable to open restore report file %s", reportFilename)
@@ -215,12 +428,101 @@ func WriteRestoreReportFile(reportFilename string, backupTimestamp string, start
 	}
 
 	logOutputReport(reportFile, reportInfo)
+	PrintRowCountMismatches(reportFile, contents.RowCountMismatches)
+	PrintRejectedRows(reportFile, contents.RejectedRows)
+	PrintRelationConflicts(reportFile, contents.RelationConflicts)
+	PrintExcludedObjects(reportFile, contents.ExcludedObjects)
+	PrintRestoredWithoutData(reportFile, contents.DataExcludedTables)
+	PrintSLAViolations(reportFile, contents.SLAViolations)
+	PrintAnalyzeTimings(reportFile, contents.AnalyzeTimings)
+	PrintDeadlockRetries(reportFile, contents.DeadlockRetries)
+	PrintSequenceChanges(reportFile, contents.SequenceChanges)
+	PrintTableTimings(reportFile, contents.TableTimings)
+	PrintRestoreTimings(reportFile, contents.RestoreTimings)
+	PrintResourceUsage(reportFile, contents.ResourceUsage)
 
 	err = reportFile.Close()
 	gplog.FatalOnError(err)
 	_ = operating.System.Chmod(reportFilename, 0444)
 }
 
+/*
+ * The outcome of backing up or restoring one database of a multi-database
+ * run.  Timestamp is empty if the run failed before a backup was taken or
+ * if there was no backup of the database to restore.
+ */
+type DatabaseRunResult struct {
+	Database  string
+	Timestamp string
+	ExitCode  int
+}
+
+/*
+ * Writes a report combining the runs for each database of a multi-database
+ * backup or restore, each of which also writes its own report as usual.
+ */
+func WriteDatabaseGroupReportFile(reportFilename string, utility string, groupTimestamp string, startTimestamp string, endtime time.Time, results []DatabaseRunResult) {
+	reportFile, err := iohelper.OpenFileForWriting(reportFilename)
+	if err != nil {
+		gplog.Error("Unable to open %s report file %s", utility, reportFilename)
+		return
+	}
+
+	commandLine := strings.Join(os.Args, " ")
+	start, end, duration := GetDurationInfo(startTimestamp, endtime)
+	numFailed := 0
+	for _, result := range results {
+		if GetRunStatus(result.ExitCode, false) == "failure" {
+			numFailed++
+		}
+	}
+	status := "Success"
+	if numFailed > 0 {
+		status = fmt.Sprintf("Failure (%d of %d databases failed)", numFailed, len(results))
+	}
+
+	title := "Backup"
+	if utility == "gprestore" {
+		title = "Restore"
+	}
+	utils.MustPrintf(reportFile, "Greenplum Database Multi-Database %s Report\n\n", title)
+	logOutputReport(reportFile, []LineInfo{
+		{Key: "database group:", Value: groupTimestamp},
+		{Key: "command line:", Value: fmt.Sprintf("%s\n", commandLine)},
+		{Key: "start time:", Value: start},
+		{Key: "end time:", Value: end},
+		{Key: "duration:", Value: duration},
+		{},
+		{Key: fmt.Sprintf("%s status:", strings.ToLower(title)), Value: status},
+	})
+	PrintDatabaseRunResults(reportFile, results)
+
+	err = reportFile.Close()
+	gplog.FatalOnError(err)
+	_ = operating.System.Chmod(reportFilename, 0444)
+}
+
+func PrintDatabaseRunResults(reportFile io.WriteCloser, results []DatabaseRunResult) {
+	if len(results) == 0 {
+		return
+	}
+	maxSize := 0
+	for _, result := range results {
+		if len(result.Database) > maxSize {
+			maxSize = len(result.Database)
+		}
+	}
+	resultStr := "\ndatabases:\n"
+	for _, result := range results {
+		timestamp := result.Timestamp
+		if timestamp == "" {
+			timestamp = "-"
+		}
+		resultStr += fmt.Sprintf("%-*s%-17s%s\n", maxSize+3, result.Database, timestamp, GetRunStatus(result.ExitCode, false))
+	}
+	utils.MustPrintf(reportFile, "%s", resultStr)
+}
+
 func logOutputReport(reportFile io.WriteCloser, reportInfo []LineInfo) {
 	maxSize := 0
 	for _, lineInfo := range reportInfo {
@@ -241,14 +543,14 @@ func logOutputReport(reportFile io.WriteCloser, reportInfo []LineInfo) {
 
 func GetDurationInfo(timestamp string, endTime time.Time) (string, string, string) {
 	startTime, _ := time.ParseInLocation("20060102150405", timestamp, operating.System.Local)
-	duration := reformatDuration(endTime.Sub(startTime))
+	duration := FormatDuration(endTime.Sub(startTime))
 	startTimestamp := startTime.Format("Mon Jan 02 2006 15:04:05")
 	endTimestamp := endTime.Format("Mon Jan 02 2006 15:04:05")
 	return startTimestamp, endTimestamp, duration
 }
 
 // Turns "1h2m3.456s" into "1:02:03"
-func reformatDuration(duration time.Duration) string {
+func FormatDuration(duration time.Duration) string {
 	hour := duration / time.Hour
 	duration -= hour * time.Hour
 	min := duration / time.Minute
@@ -278,7 +580,619 @@ func PrintObjectCounts(reportFile io.WriteCloser, objectCounts map[string]int) {
 	utils.MustPrintf(reportFile, objectStr)
 }
 
+func PrintSizeFilteredTables(reportFile io.WriteCloser, tables []string) {
+	if len(tables) == 0 {
+		return
+	}
+	tableStr := "\ntables skipped by size filter:\n"
+	for _, table := range tables {
+		tableStr += fmt.Sprintf("%s\n", table)
+	}
+	utils.MustPrintf(reportFile, tableStr)
+}
+
+func PrintDataExcludedTables(reportFile io.WriteCloser, tables []string) {
+	if len(tables) == 0 {
+		return
+	}
+	tableStr := "\ntables backed up without data:\n"
+	for _, table := range tables {
+		tableStr += fmt.Sprintf("%s\n", table)
+	}
+	utils.MustPrintf(reportFile, tableStr)
+}
+
+func PrintRestoredWithoutData(reportFile io.WriteCloser, tables []string) {
+	if len(tables) == 0 {
+		return
+	}
+	tableStr := "\ntables restored without data, as their data was excluded from the backup:\n"
+	for _, table := range tables {
+		tableStr += fmt.Sprintf("%s\n", table)
+	}
+	utils.MustPrintf(reportFile, tableStr)
+}
+
+func PrintLockSkippedTables(reportFile io.WriteCloser, tables []string) {
+	if len(tables) == 0 {
+		return
+	}
+	tableStr := "\ntables skipped because they could not be locked:\n"
+	for _, table := range tables {
+		tableStr += fmt.Sprintf("%s\n", table)
+	}
+	utils.MustPrintf(reportFile, tableStr)
+}
+
+func PrintNoLockWarning(reportFile io.WriteCloser, noLock bool) {
+	if !noLock {
+		return
+	}
+	utils.MustPrintf(reportFile, "\ntables were not locked during this backup (--no-lock); any table changed by concurrent DDL may have been backed up inconsistently\n")
+}
+
+func PrintPXFReferences(reportFile io.WriteCloser, references []history.PXFReference) {
+	if len(references) == 0 {
+		return
+	}
+	referenceStr := "\npxf servers referenced by external tables:\n"
+	for _, reference := range references {
+		if reference.Profile == "" {
+			referenceStr += fmt.Sprintf("%s\n", reference.Server)
+		} else {
+			referenceStr += fmt.Sprintf("%s (profile %s)\n", reference.Server, reference.Profile)
+		}
+	}
+	utils.MustPrintf(reportFile, referenceStr)
+}
+
+func PrintRowCountMismatches(reportFile io.WriteCloser, mismatches []string) {
+	if len(mismatches) == 0 {
+		return
+	}
+	mismatchStr := "\ntables with row count mismatches:\n"
+	for _, mismatch := range mismatches {
+		mismatchStr += fmt.Sprintf("%s\n", mismatch)
+	}
+	utils.MustPrintf(reportFile, mismatchStr)
+}
+
+func PrintRejectedRows(reportFile io.WriteCloser, rejectedRows []string) {
+	if len(rejectedRows) == 0 {
+		return
+	}
+	rejectedStr := "\ntables with rows rejected by --segment-reject-limit:\n"
+	for _, rejected := range rejectedRows {
+		rejectedStr += fmt.Sprintf("%s\n", rejected)
+	}
+	utils.MustPrintf(reportFile, rejectedStr)
+}
+
+func PrintRelationConflicts(reportFile io.WriteCloser, conflicts []string) {
+	if len(conflicts) == 0 {
+		return
+	}
+	conflictStr := "\nrelations that already existed in the restore database:\n"
+	for _, conflict := range conflicts {
+		conflictStr += fmt.Sprintf("%s\n", conflict)
+	}
+	utils.MustPrintf(reportFile, conflictStr)
+}
+
+func PrintExcludedObjects(reportFile io.WriteCloser, objects []string) {
+	if len(objects) == 0 {
+		return
+	}
+	objectStr := "\nobjects not restored because of --exclude-object-type:\n"
+	for _, object := range objects {
+		objectStr += fmt.Sprintf("%s\n", object)
+	}
+	utils.MustPrintf(reportFile, objectStr)
+}
+
+func PrintSLAViolations(reportFile io.WriteCloser, violations []string) {
+	if len(violations) == 0 {
+		return
+	}
+	violationStr := "\nSLA violations:\n"
+	for _, violation := range violations {
+		violationStr += fmt.Sprintf("%s\n", violation)
+	}
+	utils.MustPrintf(reportFile, violationStr)
+}
+
+func PrintAnalyzeTimings(reportFile io.WriteCloser, timings []string) {
+	if len(timings) == 0 {
+		return
+	}
+	timingStr := "\nANALYZE duration per table:\n"
+	for _, timing := range timings {
+		timingStr += fmt.Sprintf("%s\n", timing)
+	}
+	utils.MustPrintf(reportFile, timingStr)
+}
+
+func PrintDeadlockRetries(reportFile io.WriteCloser, retries []string) {
+	if len(retries) == 0 {
+		return
+	}
+	retryStr := "\nstatements retried serially after a deadlock:\n"
+	for _, retry := range retries {
+		retryStr += fmt.Sprintf("%s\n", retry)
+	}
+	utils.MustPrintf(reportFile, retryStr)
+}
+
+func PrintSequenceChanges(reportFile io.WriteCloser, changes []string) {
+	if len(changes) == 0 {
+		return
+	}
+	changeStr := "\nsequence values changed by the restore:\n"
+	for _, change := range changes {
+		changeStr += fmt.Sprintf("%s\n", change)
+	}
+	utils.MustPrintf(reportFile, changeStr)
+}
+
+func PrintMirrorSubstitutions(reportFile io.WriteCloser, substitutions []string) {
+	if len(substitutions) == 0 {
+		return
+	}
+	substitutionStr := "\nsegments whose files were written using their mirror's host:\n"
+	for _, substitution := range substitutions {
+		substitutionStr += fmt.Sprintf("%s\n", substitution)
+	}
+	utils.MustPrintf(reportFile, substitutionStr)
+}
+
+func PrintHelperFailures(reportFile io.WriteCloser, failures []string) {
+	if len(failures) == 0 {
+		return
+	}
+	failureStr := "\nsegment agent failures:\n"
+	for _, failure := range failures {
+		failureStr += fmt.Sprintf("%s\n", failure)
+	}
+	utils.MustPrintf(reportFile, failureStr)
+}
+
+func PrintDedupStats(reportFile io.WriteCloser, stats *DedupStats) {
+	if stats == nil {
+		return
+	}
+	statsStr := "\ndeduplication:\n"
+	statsStr += fmt.Sprintf("new chunk data:            %s\n", utils.FormatSize(stats.NewBytes))
+	statsStr += fmt.Sprintf("reused chunk data:         %s\n", utils.FormatSize(stats.ReusedBytes))
+	statsStr += fmt.Sprintf("space saved:               %.1f%%\n", stats.SavedPercent())
+	utils.MustPrintf(reportFile, statsStr)
+}
+
 /*
+ * Returns the timings with the longest copy first, as those are the tables
+ * that most affect how long a backup or restore takes.
+ */
+func SortTableTimings(timings []TableTiming) []TableTiming {
+	sortedTimings := make([]TableTiming, len(timings))
+	copy(sortedTimings, timings)
+	sort.SliceStable(sortedTimings, func(i int, j int) bool {
+		return sortedTimings[i].CopyDuration > sortedTimings[j].CopyDuration
+	})
+	return sortedTimings
+}
+
+func PrintTableTimings(reportFile io.WriteCloser, timings []TableTiming) {
+	if len(timings) == 0 {
+		return
+	}
+	sortedTimings := SortTableTimings(timings)
+	if len(sortedTimings) > numReportTableTimings {
+		sortedTimings = sortedTimings[:numReportTableTimings]
+	}
+	timingStr := "\nslowest tables:\n"
+	for _, timing := range sortedTimings {
+		timingStr += fmt.Sprintf("%s: copy %s, %s, %d rows", timing.Table, timing.CopyDuration.Round(time.Millisecond), utils.FormatSize(timing.Bytes), timing.Rows)
+		if timing.LockWait > 0 {
+			timingStr += fmt.Sprintf(", lock wait %s", timing.LockWait.Round(time.Millisecond))
+		}
+		if timing.CompressionRatio > 0 {
+			timingStr += fmt.Sprintf(", compression ratio %.2f", timing.CompressionRatio)
+		}
+		timingStr += "\n"
+	}
+	utils.MustPrintf(reportFile, timingStr)
+}
+
+/*
+ * Adds a statement to the slowest statements, which are kept longest first
+ * and limited to NumSlowestStatements so that restores of many objects do not
+ * keep the timing of every statement.
+ */
+func AddStatementTiming(timings []StatementTiming, timing StatementTiming) []StatementTiming {
+	index := sort.Search(len(timings), func(i int) bool {
+		return timings[i].Duration < timing.Duration
+	})
+	if index >= NumSlowestStatements {
+		return timings
+	}
+	timings = append(timings, StatementTiming{})
+	copy(timings[index+1:], timings[index:])
+	timings[index] = timing
+	if len(timings) > NumSlowestStatements {
+		timings = timings[:NumSlowestStatements]
+	}
+	return timings
+}
+
+/*
+ * Returns the percentage of the time spent in the restored phases that each
+ * connection was busy, or nil if no phase was timed.
+ */
+func (timings *RestoreTimings) Utilization() []float64 {
+	var total time.Duration
+	for _, phase := range timings.Phases {
+		total += phase.Duration
+	}
+	if total <= 0 {
+		return nil
+	}
+	utilization := make([]float64, len(timings.ConnectionBusy))
+	for conn, busy := range timings.ConnectionBusy {
+		utilization[conn] = math.Min(100, 100*float64(busy)/float64(total))
+	}
+	return utilization
+}
+
+func PrintRestoreTimings(reportFile io.WriteCloser, timings *RestoreTimings) {
+	if timings == nil {
+		return
+	}
+	timingStr := ""
+	if len(timings.Phases) > 0 {
+		timingStr += "\nphase durations:\n"
+		for _, phase := range timings.Phases {
+			timingStr += fmt.Sprintf("%s: %s\n", phase.Phase, phase.Duration.Round(time.Millisecond))
+		}
+	}
+	if len(timings.ConnectionBusy) > 0 {
+		utilization := timings.Utilization()
+		timingStr += "\nconnection busy time:\n"
+		for conn, busy := range timings.ConnectionBusy {
+			timingStr += fmt.Sprintf("connection %d: %s", conn, busy.Round(time.Millisecond))
+			if utilization != nil {
+				timingStr += fmt.Sprintf(" (%.1f%% utilization)", utilization[conn])
+			}
+			timingStr += "\n"
+		}
+	}
+	if len(timings.SlowestStatements) > 0 {
+		timingStr += "\nslowest statements:\n"
+		for _, statement := range timings.SlowestStatements {
+			timingStr += fmt.Sprintf("%s %s: %s\n", statement.ObjectType, statement.Object, statement.Duration.Round(time.Millisecond))
+		}
+	}
+	utils.MustPrintf(reportFile, "%s", timingStr)
+}
+
+func NewTimingsOutput(timings *RestoreTimings) *TimingsOutput {
+	if timings == nil {
+		return nil
+	}
+	output := &TimingsOutput{
+		Phases:            make([]PhaseTimingOutput, 0, len(timings.Phases)),
+		Connections:       make([]ConnectionTimingOutput, 0, len(timings.ConnectionBusy)),
+		SlowestStatements: make([]StatementTimingOutput, 0, len(timings.SlowestStatements)),
+	}
+	for _, phase := range timings.Phases {
+		output.Phases = append(output.Phases, PhaseTimingOutput{Phase: phase.Phase, DurationSeconds: phase.Duration.Seconds()})
+	}
+	utilization := timings.Utilization()
+	for conn, busy := range timings.ConnectionBusy {
+		connOutput := ConnectionTimingOutput{Connection: conn, BusySeconds: busy.Seconds()}
+		if utilization != nil {
+			connOutput.UtilizationPercent = math.Round(utilization[conn]*10) / 10
+		}
+		output.Connections = append(output.Connections, connOutput)
+	}
+	for _, statement := range timings.SlowestStatements {
+		output.SlowestStatements = append(output.SlowestStatements, StatementTimingOutput{ObjectType: statement.ObjectType, Object: statement.Object, DurationSeconds: statement.Duration.Seconds()})
+	}
+	return output
+}
+
+/*
+ * Writes the timing of every table, slowest first, as CSV for spreadsheets
+ * and capacity planning tools.
+ */
+func WriteTableTimingsFile(filename string, timings []TableTiming) error {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	_ = writer.Write([]string{"table", "lock_wait_seconds", "copy_seconds", "bytes", "rows", "compression_ratio"})
+	for _, timing := range SortTableTimings(timings) {
+		compressionRatio := ""
+		if timing.CompressionRatio > 0 {
+			compressionRatio = strconv.FormatFloat(timing.CompressionRatio, 'f', 2, 64)
+		}
+		_ = writer.Write([]string{
+			timing.Table,
+			strconv.FormatFloat(timing.LockWait.Seconds(), 'f', 3, 64),
+			strconv.FormatFloat(timing.CopyDuration.Seconds(), 'f', 3, 64),
+			strconv.FormatInt(timing.Bytes, 10),
+			strconv.FormatInt(timing.Rows, 10),
+			compressionRatio,
+		})
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func NewResourceUsage(peakMemory int64, isRestore bool) *ResourceUsage {
+	return &ResourceUsage{PeakMemory: peakMemory, IsRestore: isRestore, HostUsage: make(map[string]*utils.HelperResourceUsage)}
+}
+
+func (usage *ResourceUsage) AddHelperUsage(c *cluster.Cluster, segmentUsage map[int]utils.HelperResourceUsage) {
+	for contentID, helperUsage := range segmentUsage {
+		host := c.GetHostForContent(contentID)
+		if _, ok := usage.HostUsage[host]; !ok {
+			usage.HostUsage[host] = &utils.HelperResourceUsage{}
+		}
+		usage.HostUsage[host].Add(helperUsage)
+	}
+}
+
+func (usage *ResourceUsage) Total() utils.HelperResourceUsage {
+	total := utils.HelperResourceUsage{}
+	for _, hostUsage := range usage.HostUsage {
+		total.Add(*hostUsage)
+	}
+	return total
+}
+
+/*
+ * Returns the ratio of uncompressed to compressed bytes, which are the bytes
+ * read from the pipes and written to the data files for a backup and the
+ * reverse for a restore, or 0 if nothing was transferred.
+ */
+func (usage *ResourceUsage) CompressionRatio() float64 {
+	total := usage.Total()
+	uncompressed, compressed := total.BytesRead, total.BytesWritten
+	if usage.IsRestore {
+		uncompressed, compressed = total.BytesWritten, total.BytesRead
+	}
+	if compressed == 0 {
+		return 0
+	}
+	return float64(uncompressed) / float64(compressed)
+}
+
+func PrintResourceUsage(reportFile io.WriteCloser, usage *ResourceUsage) {
+	if usage == nil {
+		return
+	}
+	usageStr := "\nresource usage:\n"
+	usageStr += fmt.Sprintf("peak coordinator memory:   %s\n", utils.FormatSize(usage.PeakMemory))
+	if len(usage.HostUsage) == 0 {
+		utils.MustPrintf(reportFile, usageStr)
+		return
+	}
+	total := usage.Total()
+	usageStr += fmt.Sprintf("network transfer:          %s\n", utils.FormatSize(total.NetworkBytes))
+	usageStr += fmt.Sprintf("helper cpu time:           %s\n", total.CPUTime.Round(time.Millisecond))
+	usageStr += fmt.Sprintf("compression ratio:         %.2f\n", usage.CompressionRatio())
+	hosts := make([]string, 0, len(usage.HostUsage))
+	for host := range usage.HostUsage {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		hostUsage := usage.HostUsage[host]
+		usageStr += fmt.Sprintf("%s: read %s, wrote %s, network transfer %s, helper cpu time %s\n", host, utils.FormatSize(hostUsage.BytesRead),
+			utils.FormatSize(hostUsage.BytesWritten), utils.FormatSize(hostUsage.NetworkBytes), hostUsage.CPUTime.Round(time.Millisecond))
+	}
+	utils.MustPrintf(reportFile, usageStr)
+}
+
+func (summary RunSummary) String() string {
+	fields := []string{
+		fmt.Sprintf("utility=%s", quoteSummaryValue(summary.Utility)),
+		fmt.Sprintf("run_id=%s", quoteSummaryValue(summary.RunID)),
+		fmt.Sprintf("database=%s", quoteSummaryValue(summary.Database)),
+		fmt.Sprintf("type=%s", quoteSummaryValue(summary.Type)),
+		fmt.Sprintf("status=%s", quoteSummaryValue(summary.Status)),
+		fmt.Sprintf("duration_seconds=%d", int64(summary.Duration.Seconds())),
+		fmt.Sprintf("bytes=%d", summary.Bytes),
+	}
+	objectTypes := make([]string, 0)
+	for objectType := range summary.ObjectCounts {
+		objectTypes = append(objectTypes, objectType)
+	}
+	sort.Strings(objectTypes)
+	for _, objectType := range objectTypes {
+		key := strings.ReplaceAll(strings.ToLower(objectType), " ", "_")
+		fields = append(fields, fmt.Sprintf("objects.%s=%d", key, summary.ObjectCounts[objectType]))
+	}
+	fields = append(fields,
+		fmt.Sprintf("errors=%d", summary.ErrorCount),
+		fmt.Sprintf("sla_violations=%d", len(summary.SLAViolations)),
+		fmt.Sprintf("exit_code=%d", summary.ExitCode))
+	return strings.Join(fields, " ")
+}
+
+func WriteMachineOutput(writer io.Writer, summary RunSummary) error {
+	output := MachineOutput{
+		Utility:         summary.Utility,
+		RunID:           summary.RunID,
+		Database:        summary.Database,
+		Type:            summary.Type,
+		Status:          summary.Status,
+		ExitCode:        summary.ExitCode,
+		DurationSeconds: int64(summary.Duration.Seconds()),
+		Bytes:           summary.Bytes,
+		ObjectCounts:    summary.ObjectCounts,
+		ErrorCount:      summary.ErrorCount,
+		Errors:          summary.Errors,
+		FailedObjects:   summary.FailedObjects,
+		SLAViolations:   summary.SLAViolations,
+		ReportFile:      summary.ReportFile,
+		Timings:         NewTimingsOutput(summary.Timings),
+	}
+	if output.ObjectCounts == nil {
+		output.ObjectCounts = map[string]int{}
+	}
+	for _, list := range []*[]string{&output.Errors, &output.FailedObjects, &output.SLAViolations} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+	return json.NewEncoder(writer).Encode(output)
+}
+
+func GetRunStatus(errorCode int, wasTerminated bool) string {
+	if wasTerminated {
+		return "canceled"
+	}
+	switch errorCode {
+	case 0:
+		return "success"
+	case 1:
+		return "success_with_errors"
+	case SLAViolationExitCode:
+		return "sla_violation"
+	default:
+		return "failure"
+	}
+}
+
+/*
+ * Service-level targets for the backups or restores of a database, read from
+ * the file given with --sla-file.  Durations use Go duration syntax, such as
+ * "2h30m", and the minimum throughput is a size per second, such as "100MB".
+ * For a backup, the age is the time since the previous successful backup of
+ * the database was taken; for a restore, it is the age of the backup restored.
+ */
+type SLATargets struct {
+	MaxDuration   string
+	MinThroughput string
+	MaxAge        string
+}
+
+type SLAFile struct {
+	Databases map[string]SLATargets
+}
+
+/*
+ * Runs that otherwise succeed exit with this code if any SLA target is missed.
+ */
+const SLAViolationExitCode = 3
+
+/*
+ * Returns the targets for the given database, or nil if the file has none.
+ */
+func ReadSLATargets(filename string, dbName string) (*SLATargets, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	slaFile := &SLAFile{}
+	err = yaml.Unmarshal(contents, slaFile)
+	if err != nil {
+		return nil, errors.Errorf("Unable to parse SLA file %s: %v", filename, err)
+	}
+	targets, ok := slaFile.Databases[dbName]
+	if !ok {
+		return nil, nil
+	}
+	for _, duration := range []string{targets.MaxDuration, targets.MaxAge} {
+		if _, err := time.ParseDuration(duration); duration != "" && err != nil {
+			return nil, errors.Errorf("Invalid SLA duration '%s' for database %s.  Durations must be in a format such as '2h30m'.", duration, dbName)
+		}
+	}
+	if targets.MinThroughput != "" {
+		_, err = utils.ParseSize(targets.MinThroughput)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &targets, nil
+}
+
+/*
+ * Returns a description of each target that was missed.  Targets that depend
+ * on a byte count or age less than zero are not checked, as those values are
+ * not known.
+ */
+func (targets *SLATargets) GetViolations(duration time.Duration, numBytes int64, age time.Duration) []string {
+	violations := make([]string, 0)
+	if targets.MaxDuration != "" {
+		maxDuration, _ := time.ParseDuration(targets.MaxDuration)
+		if duration > maxDuration {
+			violations = append(violations, fmt.Sprintf("duration %s exceeded the maximum of %s", FormatDuration(duration), targets.MaxDuration))
+		}
+	}
+	if targets.MinThroughput != "" && numBytes >= 0 && duration > 0 {
+		minThroughput, _ := utils.ParseSize(targets.MinThroughput)
+		throughput := int64(float64(numBytes) / duration.Seconds())
+		if throughput < minThroughput {
+			violations = append(violations, fmt.Sprintf("throughput %s/s was below the minimum of %s/s", utils.FormatSize(throughput), utils.FormatSize(minThroughput)))
+		}
+	}
+	if targets.MaxAge != "" && age >= 0 {
+		maxAge, _ := time.ParseDuration(targets.MaxAge)
+		if age > maxAge {
+			violations = append(violations, fmt.Sprintf("backup age %s exceeded the maximum of %s", FormatDuration(age), targets.MaxAge))
+		}
+	}
+	return violations
+}
+
+func quoteSummaryValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+/*
+ * Writes the run summary to stderr and, if available, to the local syslog.
+ */
+func LogRunSummary(summary RunSummary) {
+	summaryLine := summary.String()
+	fmt.Fprintln(os.Stderr, summaryLine)
+	err := writeToSyslog(summary.Utility, summaryLine)
+	if err != nil {
+		gplog.Verbose("Unable to write run summary to syslog: %v", err)
+	}
+}
+
+const (
+	FORMAT_NATIVE     = "native"
+	FORMAT_TRANSLATED = "translated"
+)
+
+/*
+ * How gprestore reads the files of each format version of a backup: as they
+ * are, or translated into the current format by the shims in the history and
+ * toc packages as they are read.  Backups in a format missing from the
+ * matrix can no longer be restored, and a later format must be added to it
+ * once gprestore can read it.
+ */
+var backupFormatCompatibility = map[int]string{
+	history.UNVERSIONED_FORMAT_VERSION: FORMAT_TRANSLATED,
+	history.CURRENT_FORMAT_VERSION:     FORMAT_NATIVE,
+}
+
+/*
+ * A backup that records its format version can be restored by any gprestore
+ * whose compatibility matrix includes that format, even if it was taken by a
+ * later gpbackup.  Backups taken before format versions were recorded must
+ * not have been taken by a later gpbackup than gprestore.
+ *
  * This function will not error out if the user has gprestore X.Y.Z
  * and gpbackup X.Y.Z+dev, when technically the uncommitted code changes
  * in the +dev version of gpbackup may have incompatibilities with the
@@ -288,47 +1202,138 @@ func PrintObjectCounts(reportFile io.WriteCloser, objectCounts map[string]int) {
  * gprestore will be built with identical versions during development, and
  * users will never use a +dev version in production.
  */
-func EnsureBackupVersionCompatibility(backupVersion string, restoreVersion string) {
+func EnsureBackupVersionCompatibility(backupVersion string, restoreVersion string, formatVersion int) {
 	backupSemVer, err := semver.Make(backupVersion)
 	gplog.FatalOnError(err)
 	restoreSemVer, err := semver.Make(restoreVersion)
 	gplog.FatalOnError(err)
+	if formatVersion == 0 {
+		// The backup predates format versions, so only its gpbackup version tells
+		if backupSemVer.GT(restoreSemVer) {
+			gplog.Fatal(errors.Errorf("gprestore %s cannot restore a backup taken with gpbackup %s; please use gprestore %s or later.",
+				restoreVersion, backupVersion, backupVersion), "")
+		}
+		formatVersion = history.UNVERSIONED_FORMAT_VERSION
+	}
+	if formatVersion > history.CURRENT_FORMAT_VERSION {
+		gplog.Fatal(errors.Errorf("gprestore %s cannot restore a backup in format version %d, taken with gpbackup %s; please use gprestore %s or later.",
+			restoreVersion, formatVersion, backupVersion, backupVersion), "")
+	}
+	compatibility, ok := backupFormatCompatibility[formatVersion]
+	if !ok {
+		gplog.Fatal(errors.Errorf("gprestore %s can no longer restore a backup in format version %d, taken with gpbackup %s; please use an earlier gprestore.",
+			restoreVersion, formatVersion, backupVersion), "")
+	}
+	if compatibility == FORMAT_TRANSLATED {
+		gplog.Verbose("Backup is in format version %d, which is translated to format version %d as it is read", formatVersion, history.CURRENT_FORMAT_VERSION)
+	}
 	if backupSemVer.GT(restoreSemVer) {
-		gplog.Fatal(errors.Errorf("gprestore %s cannot restore a backup taken with gpbackup %s; please use gprestore %s or later.",
-			restoreVersion, backupVersion, backupVersion), "")
+		gplog.Verbose("Backup was taken with gpbackup %s in format version %d, which gprestore %s can read", backupVersion, formatVersion, restoreVersion)
 	}
 }
 
-func EnsureDatabaseVersionCompatibility(backupGPDBVersion string, restoreGPDBVersion dbconn.GPDBVersion) {
+/*
+ * With translateDDL, a backup of a later major version is restored on a best
+ * effort basis, with the DDL known to be incompatible rewritten by gprestore.
+ */
+func EnsureDatabaseVersionCompatibility(backupGPDBVersion string, restoreGPDBVersion dbconn.GPDBVersion, translateDDL bool) {
 	pattern := regexp.MustCompile(`\d+\.\d+\.\d+`)
 	threeDigitVersion := pattern.FindStringSubmatch(backupGPDBVersion)[0]
 	backupGPDBSemVer, err := semver.Make(threeDigitVersion)
 	gplog.FatalOnError(err)
 	if backupGPDBSemVer.Major > restoreGPDBVersion.SemVer.Major {
+		if translateDDL {
+			gplog.Warn("Restoring from GPDB version %s to %s with --translate-ddl.  DDL known to be incompatible is rewritten, but other objects may fail to restore.", backupGPDBVersion, restoreGPDBVersion.VersionString)
+			return
+		}
 		gplog.Fatal(errors.Errorf("Cannot restore from GPDB version %s to %s due to catalog incompatibilities.", backupGPDBVersion, restoreGPDBVersion.VersionString), "")
 	}
 }
 
+/*
+ * SendOn limits the runs that send an email: "always" (the default),
+ * "warnings" for any run that did not succeed cleanly, or "failure" for runs
+ * that failed or were canceled.  Subject is a template for the subject line,
+ * with the same values as the body template.  Groups names lists of
+ * addresses that contacts can refer to, so that one list can be given
+ * different statuses for each utility.
+ */
 type ContactFile struct {
 	Contacts map[string][]EmailContact
+	Groups   map[string][]string
+	Template string
+	Subject  string
+	SendOn   string `yaml:"send_on"`
 }
 
 type EmailContact struct {
 	Address string
+	Group   string
 	Status  map[string]bool
 }
 
-func GetContacts(filename string, utility string) string {
+const (
+	EMAIL_SEND_ALWAYS   = "always"
+	EMAIL_SEND_WARNINGS = "warnings"
+	EMAIL_SEND_FAILURE  = "failure"
+)
+
+const DefaultEmailSubject = "{{.Utility}} {{.RunID}} on {{.Hostname}} completed: {{.Result}}"
+
+const DefaultEmailTemplate = `<html>
+<body>
+<h3>{{.Utility}} {{.RunID}} on {{.Hostname}} completed: {{.Status}}</h3>
+<table border="1" cellpadding="4" style="border-collapse: collapse">
+<tr><th align="left">Status</th><td>{{.Status}}</td></tr>
+<tr><th align="left">Database</th><td>{{.Database}}</td></tr>
+<tr><th align="left">Type</th><td>{{.Type}}</td></tr>
+<tr><th align="left">Duration</th><td>{{.DurationString}}</td></tr>
+<tr><th align="left">Size</th><td>{{.Size}}</td></tr>
+<tr><th align="left">Errors</th><td>{{.ErrorCount}}</td></tr>
+</table>
+{{if .FailedObjects}}<h4>Failed objects</h4>
+<ul>
+{{range .FailedObjects}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}<p>The full report is attached as {{.ReportFilename}}.</p>
+</body>
+</html>
+`
+
+const emailBoundary = "gpbackup-report-boundary"
+
+/*
+ * The values available to an email template, in addition to the fields of
+ * RunSummary.
+ */
+type EmailTemplateData struct {
+	RunSummary
+	Hostname       string
+	Result         string
+	DurationString string
+	Size           string
+	ReportFilename string
+}
+
+func readContactFile(filename string) (*ContactFile, error) {
 	contactFile := &ContactFile{}
 	contents, err := operating.System.ReadFile(filename)
 	gplog.FatalOnError(err)
 	err = yaml.Unmarshal(contents, contactFile)
+	return contactFile, err
+}
+
+func GetContacts(filename string, utility string) string {
+	contactFile, err := readContactFile(filename)
 	if err != nil {
 		gplog.Warn("Unable to send email report: Error reading email contacts file.")
 		gplog.Warn("Please ensure that the email contacts file is in valid YAML format.")
 		return ""
 	}
+	return contactFile.GetContactList(utility, getContactStatus())
+}
 
+func getContactStatus() string {
 	errorCode := gplog.GetErrorCode()
 	exitStatus := "success"
 	if errorCode == 1 {
@@ -336,62 +1341,244 @@ func GetContacts(filename string, utility string) string {
 	} else if errorCode == 2 {
 		exitStatus = "failure"
 	}
+	return exitStatus
+}
 
+/*
+ * Returns the addresses of the contacts of the utility that want an email for
+ * the exit status, with each group expanded to its addresses.
+ */
+func (contactFile *ContactFile) GetContactList(utility string, exitStatus string) string {
 	contactList := make([]string, 0)
+	seen := make(map[string]bool)
+	addAddress := func(address string) {
+		if address != "" && !seen[address] {
+			seen[address] = true
+			contactList = append(contactList, address)
+		}
+	}
 	for _, contact := range contactFile.Contacts[utility] {
-		if contact.Status[exitStatus] {
-			contactList = append(contactList, contact.Address)
+		if !contact.Status[exitStatus] {
+			continue
+		}
+		addAddress(contact.Address)
+		if contact.Group == "" {
+			continue
+		}
+		addresses, ok := contactFile.Groups[contact.Group]
+		if !ok {
+			gplog.Warn("Email contact group %s is not defined in the email contacts file", contact.Group)
+		}
+		for _, address := range addresses {
+			addAddress(address)
 		}
 	}
 	return strings.Join(contactList, " ")
 }
 
-func ConstructEmailMessage(timestamp string, contactList string, reportFilePath string, utility string, status bool) string {
+/*
+ * Returns whether an email should be sent for a run with the given status.
+ * The GPBACKUP_EMAIL_SEND_ON environment variable overrides the setting in the
+ * contacts file.
+ */
+func (contactFile *ContactFile) ShouldSendEmail(runStatus string) bool {
+	sendOn := contactFile.SendOn
+	if envSendOn := operating.System.Getenv("GPBACKUP_EMAIL_SEND_ON"); envSendOn != "" {
+		sendOn = envSendOn
+	}
+	shouldSend, err := shouldNotify(sendOn, runStatus)
+	if err != nil {
+		gplog.Warn("%v, sending the email report", err)
+	}
+	return shouldSend
+}
+
+/*
+ * Notifications are sent for an unrecognized send_on setting, so that a typo
+ * does not silence them.
+ */
+func shouldNotify(sendOn string, runStatus string) (bool, error) {
+	switch sendOn {
+	case "", EMAIL_SEND_ALWAYS:
+		return true, nil
+	case EMAIL_SEND_WARNINGS:
+		return runStatus != "success", nil
+	case EMAIL_SEND_FAILURE:
+		return runStatus == "failure" || runStatus == "canceled", nil
+	default:
+		return true, errors.Errorf("Unrecognized send_on setting %s", sendOn)
+	}
+}
+
+/*
+ * Returns the subject template, from the GPBACKUP_EMAIL_SUBJECT environment
+ * variable or the contacts file, or the default subject if neither is set.
+ */
+func (contactFile *ContactFile) GetSubjectTemplate() string {
+	if envSubject := operating.System.Getenv("GPBACKUP_EMAIL_SUBJECT"); envSubject != "" {
+		return envSubject
+	}
+	if contactFile.Subject != "" {
+		return contactFile.Subject
+	}
+	return DefaultEmailSubject
+}
+
+/*
+ * Returns the contents of the email template file named in the contacts file,
+ * or the default template if none is specified or it cannot be read.
+ */
+func GetEmailTemplate(filename string) string {
+	contactFile, err := readContactFile(filename)
+	if err != nil {
+		return DefaultEmailTemplate
+	}
+	return contactFile.getEmailTemplate()
+}
+
+func (contactFile *ContactFile) getEmailTemplate() string {
+	if contactFile.Template == "" {
+		return DefaultEmailTemplate
+	}
+	contents, err := operating.System.ReadFile(contactFile.Template)
+	if err != nil {
+		gplog.Warn("Unable to read email template file %s, using the default template: %v", contactFile.Template, err)
+		return DefaultEmailTemplate
+	}
+	return string(contents)
+}
+
+func getEmailTemplateData(summary RunSummary, reportFilename string) EmailTemplateData {
 	hostname, _ := operating.System.Hostname()
-	statusString := history.BackupStatusSucceed
-	if !status {
-		statusString = history.BackupStatusFailed
+	data := EmailTemplateData{
+		RunSummary:     summary,
+		Hostname:       hostname,
+		Result:         history.BackupStatusSucceed,
+		DurationString: FormatDuration(summary.Duration),
+		Size:           "unknown",
+		ReportFilename: reportFilename,
+	}
+	if summary.Status != "success" && summary.Status != "success_with_errors" {
+		data.Result = history.BackupStatusFailed
+	}
+	if summary.Bytes >= 0 {
+		data.Size = utils.FormatSize(summary.Bytes)
+	}
+	return data
+}
+
+func ConstructHTMLReport(summary RunSummary, reportFilename string, emailTemplate string) (string, error) {
+	data := getEmailTemplateData(summary, reportFilename)
+	tmpl, err := template.New("email").Parse(emailTemplate)
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid email template")
+	}
+	var htmlReport bytes.Buffer
+	err = tmpl.Execute(&htmlReport, data)
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid email template")
+	}
+	return htmlReport.String(), nil
+}
+
+/*
+ * Renders the subject template as plain text on a single line, so that the
+ * subject cannot add headers to the message.
+ */
+func ConstructEmailSubject(summary RunSummary, reportFilename string, subjectTemplate string) (string, error) {
+	data := getEmailTemplateData(summary, reportFilename)
+	tmpl, err := texttemplate.New("subject").Parse(subjectTemplate)
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid email subject template")
+	}
+	var subject bytes.Buffer
+	err = tmpl.Execute(&subject, data)
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid email subject template")
+	}
+	return strings.Join(strings.Fields(subject.String()), " "), nil
+}
+
+/*
+ * Builds a MIME message with an HTML summary of the run as the body and the
+ * full text report as an attachment.
+ */
+func ConstructEmailMessage(contactList string, reportFilePath string, summary RunSummary, emailTemplate string, subjectTemplate string) string {
+	_, reportFilename := path.Split(reportFilePath)
+	subject, err := ConstructEmailSubject(summary, reportFilename, subjectTemplate)
+	if err != nil {
+		gplog.Warn("%v, using the default subject", err)
+		subject, _ = ConstructEmailSubject(summary, reportFilename, DefaultEmailSubject)
+	}
+	htmlReport, err := ConstructHTMLReport(summary, reportFilename, emailTemplate)
+	if err != nil {
+		gplog.Warn("%v, using the default template", err)
+		htmlReport, _ = ConstructHTMLReport(summary, reportFilename, DefaultEmailTemplate)
 	}
-	emailHeader := fmt.Sprintf(`To: %s
-Subject: %s %s on %s completed: %s
-Content-Type: text/html
-Content-Disposition: inline
-<html>
-<body>
-<pre style=\"font: monospace\">
-`, contactList, utility, timestamp, hostname, statusString)
-	emailFooter := `
-</pre>
-</body>
-</html>`
 	fileContents := strings.Join(iohelper.MustReadLinesFromFile(reportFilePath), "\n")
-	return emailHeader + fileContents + emailFooter
+	return fmt.Sprintf(`To: %[1]s
+Subject: %[2]s
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="%[3]s"
+
+--%[3]s
+Content-Type: text/html; charset=UTF-8
+Content-Disposition: inline
+
+%[4]s
+--%[3]s
+Content-Type: text/plain; charset=UTF-8
+Content-Disposition: attachment; filename="%[5]s"
+
+%[6]s
+--%[3]s--
+`, contactList, subject, emailBoundary, htmlReport, reportFilename, fileContents)
 }
 
-func EmailReport(c *cluster.Cluster, timestamp string, reportFilePath string, utility string, status bool) {
-	contactsFilename := "gp_email_contacts.yaml"
-	gphomeFile := fmt.Sprintf("%s/bin/%s", operating.System.Getenv("GPHOME"), contactsFilename)
-	homeFile := fmt.Sprintf("%s/%s", operating.System.Getenv("HOME"), contactsFilename)
+/*
+ * Returns the path of the named configuration file in $HOME or, failing that,
+ * in $GPHOME/bin, or an error naming both paths if it is in neither.
+ */
+func findConfigFile(c *cluster.Cluster, filename string) (string, error) {
+	gphomeFile := fmt.Sprintf("%s/bin/%s", operating.System.Getenv("GPHOME"), filename)
+	homeFile := fmt.Sprintf("%s/%s", operating.System.Getenv("HOME"), filename)
 	_, homeErr := c.ExecuteLocalCommand(fmt.Sprintf("test -f %s", homeFile))
-	if homeErr != nil {
-		_, gphomeErr := c.ExecuteLocalCommand(fmt.Sprintf("test -f %s", gphomeFile))
-		if gphomeErr != nil {
-			gplog.Info("Found neither %s nor %s", gphomeFile, homeFile)
-			gplog.Info("Email containing %s report %s will not be sent", utility, reportFilePath)
-			return
-		}
-		contactsFilename = gphomeFile
-	} else {
-		contactsFilename = homeFile
+	if homeErr == nil {
+		return homeFile, nil
+	}
+	_, gphomeErr := c.ExecuteLocalCommand(fmt.Sprintf("test -f %s", gphomeFile))
+	if gphomeErr == nil {
+		return gphomeFile, nil
+	}
+	return "", errors.Errorf("Found neither %s nor %s", gphomeFile, homeFile)
+}
+
+func EmailReport(c *cluster.Cluster, reportFilePath string, summary RunSummary) {
+	utility := summary.Utility
+	contactsFilename, err := findConfigFile(c, "gp_email_contacts.yaml")
+	if err != nil {
+		gplog.Info(err.Error())
+		gplog.Info("Email containing %s report %s will not be sent", utility, reportFilePath)
+		return
+	}
+	contactFile, err := readContactFile(contactsFilename)
+	if err != nil {
+		gplog.Warn("Unable to send email report: Error reading email contacts file.")
+		gplog.Warn("Please ensure that the email contacts file is in valid YAML format.")
+		return
+	}
+	if !contactFile.ShouldSendEmail(summary.Status) {
+		gplog.Info("Email containing %s report %s will not be sent for a run with status %s", utility, reportFilePath, summary.Status)
+		return
 	}
 	gplog.Info("%s list found, %s will be sent", contactsFilename, reportFilePath)
-	contactList := GetContacts(contactsFilename, utility)
+	contactList := contactFile.GetContactList(utility, getContactStatus())
 	if contactList == "" {
 		return
 	}
-	message := ConstructEmailMessage(timestamp, contactList, reportFilePath, utility, status)
+	message := ConstructEmailMessage(contactList, reportFilePath, summary, contactFile.getEmailTemplate(), contactFile.GetSubjectTemplate())
 	gplog.Verbose("Sending email report to the following addresses: %s", contactList)
-	output, sendErr := c.ExecuteLocalCommand(fmt.Sprintf(`echo "%s" | sendmail -t`, message))
+	output, sendErr := c.ExecuteLocalCommand(fmt.Sprintf(`echo '%s' | sendmail -t`, strings.ReplaceAll(message, "'", `'\''`)))
 	if sendErr != nil {
 		gplog.Warn("Unable to send email report: %s", output)
 	}
@@ -1,6 +1,7 @@
 package report_test
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -17,7 +18,6 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/structmatcher"
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
-	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/testutils"
@@ -28,6 +28,7 @@ import (
 
 	. "github.com/greenplum-db/gpbackup/report"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gbytes"
 )
@@ -119,6 +120,28 @@ count of database objects in backup:
 sequences   1
 tables      42
 types       1000`))
+		})
+		It("writes a report for a backup taken with an isolation level", func() {
+			backupReport.IsolationLevel = "repeatable-read"
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`data file format:      Single Data File Per Segment
+isolation level:       repeatable-read
+
+start time:`))
+		})
+		It("writes a report for a backup that was unchanged since a previous backup", func() {
+			backupReport.UnchangedSince = "20161231010101"
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`backup status:         Success
+unchanged since:       20161231010101
+`))
+		})
+		It("writes a report for a backup taken as of a snapshot shared with other databases", func() {
+			backupReport.SharedSnapshot = "100:105:101"
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`backup status:         Success
+shared snapshot:       100:105:101
+`))
 		})
 		It("writes a report for a failed backup", func() {
 			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "Cannot access /tmp/backups: Permission denied")
@@ -149,6 +172,81 @@ count of database objects in backup:
 sequences   1
 tables      42
 types       1000`))
+		})
+		It("writes a report listing tables skipped by size filter", func() {
+			backupReport.SizeFilteredTables = []string{"public.big_facts", "public.huge_facts"}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`count of database objects in backup:
+sequences   1
+tables      42
+types       1000
+
+tables skipped by size filter:
+public.big_facts
+public.huge_facts`))
+		})
+		It("writes a report listing tables backed up without data", func() {
+			backupReport.DataExcludedTables = []string{"public.audit_log"}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`tables backed up without data:
+public.audit_log`))
+		})
+		It("writes a report listing tables skipped because they could not be locked", func() {
+			backupReport.LockSkippedTables = []string{"public.busy_facts"}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`tables skipped because they could not be locked:
+public.busy_facts`))
+		})
+		It("writes a report warning that the tables were not locked", func() {
+			backupReport.NoLock = true
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`tables were not locked during this backup \(--no-lock\)`))
+		})
+		It("writes a report listing PXF servers referenced by external tables", func() {
+			backupReport.PXFReferences = []history.PXFReference{{Server: "default", Profile: "s3:parquet"}, {Server: "hadoop"}}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`pxf servers referenced by external tables:
+default \(profile s3:parquet\)
+hadoop`))
+		})
+		It("writes a report listing SLA violations", func() {
+			backupReport.SLAViolations = []string{"duration 4:03:02 exceeded the maximum of 2h"}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`SLA violations:
+duration 4:03:02 exceeded the maximum of 2h`))
+		})
+		It("writes a report listing segments whose mirror hosts were used", func() {
+			backupReport.MirrorSubstitutions = []string{"segment 1: sdw1 replaced by sdw2"}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`segments whose files were written using their mirror's host:
+segment 1: sdw1 replaced by sdw2`))
+		})
+		It("writes a report with the space saved by deduplication", func() {
+			backupReport.DedupStats = &DedupStats{NewBytes: 1024, ReusedBytes: 3072}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`deduplication:
+new chunk data:            1\.0 kB
+reused chunk data:         3\.0 kB
+space saved:               75\.0%`))
+		})
+		It("writes a report with the resource usage of the backup", func() {
+			testCluster := cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, Hostname: "mdw"}, {ContentID: 0, Hostname: "sdw1"}, {ContentID: 1, Hostname: "sdw1"}, {ContentID: 2, Hostname: "sdw2"},
+			})
+			backupReport.ResourceUsage = NewResourceUsage(50*1024*1024, false)
+			backupReport.ResourceUsage.AddHelperUsage(testCluster, map[int]utils.HelperResourceUsage{
+				0: {BytesRead: 3072, BytesWritten: 1024, CPUTime: 1500 * time.Millisecond},
+				1: {BytesRead: 3072, BytesWritten: 1024, CPUTime: 500 * time.Millisecond},
+				2: {BytesRead: 2048, BytesWritten: 1024, CPUTime: time.Second},
+			})
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`resource usage:
+peak coordinator memory:   50\.0 MB
+network transfer:          0 B
+helper cpu time:           3s
+compression ratio:         2\.67
+sdw1: read 6\.0 kB, wrote 2\.0 kB, network transfer 0 B, helper cpu time 2s
+sdw2: read 2\.0 kB, wrote 1\.0 kB, network transfer 0 B, helper cpu time 1s`))
 		})
 		It("writes a report without database size information", func() {
 			backupReport.DatabaseSize = ""
@@ -239,7 +337,7 @@ incremental backup set:
 
 		It("writes a report for a failed restore", func() {
 			gplog.SetErrorCode(2)
-			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "Cannot access /tmp/backups: Permission denied")
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "Cannot access /tmp/backups: Permission denied", RestoreReportContents{})
 			Expect(buffer).To(Say(`Greenplum Database Restore Report
 
 timestamp key:       20170101010101
@@ -258,7 +356,7 @@ restore error:       Cannot access /tmp/backups: Permission denied`))
 		})
 		It("writes a report for a successful restore", func() {
 			gplog.SetErrorCode(0)
-			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "")
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{})
 			Expect(buffer).To(Say(`Greenplum Database Restore Report
 
 timestamp key:       20170101010101
@@ -276,7 +374,7 @@ restore status:      Success`))
 		})
 		It("writes a report for a successful restore with errors", func() {
 			gplog.SetErrorCode(1)
-			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "")
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{})
 			Expect(buffer).To(Say(`Greenplum Database Restore Report
 
 timestamp key:       20170101010101
@@ -292,6 +390,323 @@ duration:            4:03:01
 
 restore status:      Success but non-fatal errors occurred. See log file .+ for details.`))
 		})
+		It("writes a report listing tables with row count mismatches", func() {
+			gplog.SetErrorCode(1)
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{RowCountMismatches: []string{"public.bar: expected 10 rows, found 8", "public.foo: expected 5 rows, found 0"}})
+			Expect(buffer).To(Say(`restore status:      Success but non-fatal errors occurred. See log file .+ for details.
+
+tables with row count mismatches:
+public.bar: expected 10 rows, found 8
+public.foo: expected 5 rows, found 0`))
+		})
+		It("writes a report listing tables with rejected rows", func() {
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{RejectedRows: []string{"public.bar: 2 rows rejected", "public.foo: 1 rows rejected"}})
+			Expect(buffer).To(Say(`tables with rows rejected by --segment-reject-limit:
+public.bar: 2 rows rejected
+public.foo: 1 rows rejected`))
+		})
+		It("writes a report with the resource usage of the restore", func() {
+			testCluster := cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, Hostname: "mdw"}, {ContentID: 0, Hostname: "sdw1"}})
+			resourceUsage := NewResourceUsage(1024*1024, true)
+			resourceUsage.AddHelperUsage(testCluster, map[int]utils.HelperResourceUsage{
+				0: {BytesRead: 1024, BytesWritten: 4096, NetworkBytes: 1024, CPUTime: 250 * time.Millisecond},
+			})
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{ResourceUsage: resourceUsage})
+			Expect(buffer).To(Say(`restore status:      Success
+
+resource usage:
+peak coordinator memory:   1\.0 MB
+network transfer:          1\.0 kB
+helper cpu time:           250ms
+compression ratio:         4\.00
+sdw1: read 1\.0 kB, wrote 4\.0 kB, network transfer 1\.0 kB, helper cpu time 250ms`))
+		})
+		It("writes a report listing relations that already existed in the restore database", func() {
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{RelationConflicts: []string{"public.bar: skipped", "public.foo: restored as public.foo_restored"}})
+			Expect(buffer).To(Say(`restore status:      Success
+
+relations that already existed in the restore database:
+public.bar: skipped
+public.foo: restored as public.foo_restored`))
+		})
+		It("writes a report listing objects not restored because of their type", func() {
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{ExcludedObjects: []string{"INDEX public.foo_idx", "TRIGGER public.foo_trigger"}})
+			Expect(buffer).To(Say(`restore status:      Success
+
+objects not restored because of --exclude-object-type:
+INDEX public.foo_idx
+TRIGGER public.foo_trigger`))
+		})
+		It("writes a report listing the ANALYZE duration of each table", func() {
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{AnalyzeTimings: []string{"public.big: 2.5s", "public.small: 10ms"}})
+			Expect(buffer).To(Say(`ANALYZE duration per table:
+public.big: 2.5s
+public.small: 10ms`))
+		})
+		It("writes a report listing the tables restored without data", func() {
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{DataExcludedTables: []string{"public.audit_log"}})
+			Expect(buffer).To(Say(`tables restored without data, as their data was excluded from the backup:
+public.audit_log`))
+		})
+		It("writes a report listing the statements retried after a deadlock", func() {
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{DeadlockRetries: []string{"CONSTRAINT public.foo_fkey: 1 statement", "INDEX public.foo_idx: 2 statements"}})
+			Expect(buffer).To(Say(`statements retried serially after a deadlock:
+CONSTRAINT public.foo_fkey: 1 statement
+INDEX public.foo_idx: 2 statements`))
+		})
+		It("writes a report listing the sequence values changed by the restore", func() {
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{SequenceChanges: []string{"public.bar_seq: reset from 90 to 57", "public.foo_seq: advanced from 1 to 42"}})
+			Expect(buffer).To(Say(`sequence values changed by the restore:
+public.bar_seq: reset from 90 to 57
+public.foo_seq: advanced from 1 to 42`))
+		})
+		It("writes a report listing the slowest tables", func() {
+			tableTimings := []TableTiming{
+				{Table: "public.small", CopyDuration: 10 * time.Millisecond, Bytes: 1024, Rows: 5},
+				{Table: "public.big", CopyDuration: 2500 * time.Millisecond, Bytes: 2048, Rows: 100},
+			}
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{TableTimings: tableTimings})
+			Expect(buffer).To(Say(`slowest tables:
+public.big: copy 2.5s, 2\.0 kB, 100 rows
+public.small: copy 10ms, 1\.0 kB, 5 rows`))
+		})
+		It("writes a report listing the phase durations, connection busy time, and slowest statements", func() {
+			restoreTimings := &RestoreTimings{
+				Phases:            []PhaseTiming{{Phase: "predata", Duration: 2 * time.Second}, {Phase: "data", Duration: 8 * time.Second}},
+				ConnectionBusy:    []time.Duration{9 * time.Second, 2500 * time.Millisecond},
+				SlowestStatements: []StatementTiming{{ObjectType: "INDEX", Object: "public.foo_idx", Duration: 1500 * time.Millisecond}},
+			}
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", RestoreReportContents{RestoreTimings: restoreTimings})
+			Expect(buffer).To(Say(`phase durations:
+predata: 2s
+data: 8s
+
+connection busy time:
+connection 0: 9s \(90\.0% utilization\)
+connection 1: 2\.5s \(25\.0% utilization\)
+
+slowest statements:
+INDEX public.foo_idx: 1\.5s`))
+		})
+	})
+	Describe("AddStatementTiming", func() {
+		It("keeps the statements longest first", func() {
+			timings := AddStatementTiming(nil, StatementTiming{Object: "public.a", Duration: time.Second})
+			timings = AddStatementTiming(timings, StatementTiming{Object: "public.b", Duration: 3 * time.Second})
+			timings = AddStatementTiming(timings, StatementTiming{Object: "public.c", Duration: 2 * time.Second})
+
+			Expect(timings).To(Equal([]StatementTiming{
+				{Object: "public.b", Duration: 3 * time.Second},
+				{Object: "public.c", Duration: 2 * time.Second},
+				{Object: "public.a", Duration: time.Second},
+			}))
+		})
+		It("keeps only the slowest statements", func() {
+			var timings []StatementTiming
+			for i := 1; i <= NumSlowestStatements+2; i++ {
+				timings = AddStatementTiming(timings, StatementTiming{Object: fmt.Sprintf("public.t%d", i), Duration: time.Duration(i) * time.Second})
+			}
+
+			Expect(timings).To(HaveLen(NumSlowestStatements))
+			Expect(timings[0].Duration).To(Equal(time.Duration(NumSlowestStatements+2) * time.Second))
+			Expect(timings[NumSlowestStatements-1].Duration).To(Equal(3 * time.Second))
+		})
+	})
+	Describe("WriteTableTimingsFile", func() {
+		It("writes the timing of each table as CSV, slowest first", func() {
+			tempDir, _ := ioutil.TempDir("", "timings")
+			defer os.RemoveAll(tempDir)
+			filename := tempDir + "/table_timings.csv"
+			tableTimings := []TableTiming{
+				{Table: "public.small", CopyDuration: 10 * time.Millisecond, Bytes: 1024, Rows: 5},
+				{Table: "public.big", LockWait: 250 * time.Millisecond, CopyDuration: 2500 * time.Millisecond, Bytes: 2048, Rows: 100, CompressionRatio: 4},
+			}
+
+			err := WriteTableTimingsFile(filename, tableTimings)
+
+			Expect(err).ToNot(HaveOccurred())
+			contents, _ := ioutil.ReadFile(filename)
+			Expect(string(contents)).To(Equal(`table,lock_wait_seconds,copy_seconds,bytes,rows,compression_ratio
+public.big,0.250,2.500,2048,100,4.00
+public.small,0.000,0.010,1024,5,
+`))
+		})
+	})
+	Describe("WriteDatabaseGroupReportFile", func() {
+		BeforeEach(func() {
+			operating.System.OpenFileWrite = func(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+				return buffer, nil
+			}
+			operating.System.Chmod = func(name string, mode os.FileMode) error {
+				return nil
+			}
+		})
+		It("writes a report for a multi-database backup in which every backup succeeded", func() {
+			results := []DatabaseRunResult{
+				{Database: "sales", Timestamp: "20170101010102", ExitCode: 0},
+				{Database: "hr", Timestamp: "20170101020304", ExitCode: 0},
+			}
+			WriteDatabaseGroupReportFile("filename", "gpbackup", "20170101010101", "20170101010101", time.Date(2017, 1, 1, 2, 3, 4, 0, time.Local), results)
+			Expect(buffer).To(Say(`Greenplum Database Multi-Database Backup Report
+
+database group:   20170101010101
+command line:     .*
+
+start time:       Sun Jan 01 2017 01:01:01
+end time:         Sun Jan 01 2017 02:03:04
+duration:         1:02:03
+
+backup status:    Success
+
+databases:
+sales   20170101010102   success
+hr      20170101020304   success`))
+		})
+		It("writes a report for a multi-database restore in which a restore failed", func() {
+			results := []DatabaseRunResult{
+				{Database: "sales", Timestamp: "20170101010102", ExitCode: 1},
+				{Database: "hr", Timestamp: "20170101020304", ExitCode: 2},
+			}
+			WriteDatabaseGroupReportFile("filename", "gprestore", "20170101010101", "20170102010101", time.Date(2017, 1, 2, 2, 3, 4, 0, time.Local), results)
+			Expect(buffer).To(Say(`Greenplum Database Multi-Database Restore Report
+
+database group:   20170101010101`))
+			Expect(buffer).To(Say(`restore status:   Failure \(1 of 2 databases failed\)
+
+databases:
+sales   20170101010102   success_with_errors
+hr      20170101020304   failure`))
+		})
+		It("lists a database with no backup without a timestamp", func() {
+			PrintDatabaseRunResults(buffer, []DatabaseRunResult{{Database: "sales", ExitCode: 2}})
+			Expect(buffer).To(Say(`databases:
+sales   -                failure`))
+		})
+	})
+	Describe("RunSummary", func() {
+		It("formats the summary as a single line of key=value pairs", func() {
+			summary := RunSummary{
+				Utility:      "gpbackup",
+				RunID:        "20170101010101",
+				Database:     "test db",
+				Type:         "full",
+				Status:       "success",
+				Duration:     90 * time.Second,
+				Bytes:        4096,
+				ObjectCounts: map[string]int{"Tables": 42, "Database GUCs": 2},
+				ExitCode:     0,
+			}
+			Expect(summary.String()).To(Equal(`utility=gpbackup run_id=20170101010101 database="test db" type=full status=success duration_seconds=90 bytes=4096 objects.database_gucs=2 objects.tables=42 errors=0 sla_violations=0 exit_code=0`))
+		})
+		It("quotes empty values", func() {
+			summary := RunSummary{Utility: "gprestore", Status: "failure", Bytes: -1, ErrorCount: 1, ExitCode: 2}
+			Expect(summary.String()).To(Equal(`utility=gprestore run_id="" database="" type="" status=failure duration_seconds=0 bytes=-1 errors=1 sla_violations=0 exit_code=2`))
+		})
+	})
+	Describe("WriteMachineOutput", func() {
+		It("writes the summary as a single JSON object", func() {
+			summary := RunSummary{
+				Utility:       "gprestore",
+				RunID:         "20170101010101",
+				Database:      "testdb",
+				Type:          "full",
+				Status:        "failure",
+				Duration:      90 * time.Second,
+				Bytes:         4096,
+				ObjectCounts:  map[string]int{"Tables": 42},
+				ErrorCount:    2,
+				ExitCode:      2,
+				FailedObjects: []string{"public.foo"},
+				Errors:        []string{"Cannot access /tmp/backups: Permission denied"},
+				ReportFile:    "/tmp/backups/gprestore_20170101010101_20170102010101_report",
+			}
+			var output bytes.Buffer
+
+			Expect(WriteMachineOutput(&output, summary)).To(Succeed())
+
+			Expect(output.String()).To(Equal(`{"utility":"gprestore","run_id":"20170101010101","database":"testdb","type":"full","status":"failure","exit_code":2,"duration_seconds":90,"bytes":4096,"object_counts":{"Tables":42},"error_count":2,"errors":["Cannot access /tmp/backups: Permission denied"],"failed_objects":["public.foo"],"sla_violations":[],"report_file":"/tmp/backups/gprestore_20170101010101_20170102010101_report"}` + "\n"))
+		})
+		It("writes empty lists and counts rather than null", func() {
+			var output bytes.Buffer
+
+			Expect(WriteMachineOutput(&output, RunSummary{Utility: "gpbackup", Status: "success", Bytes: -1})).To(Succeed())
+
+			Expect(output.String()).To(ContainSubstring(`"object_counts":{},"error_count":0,"errors":[],"failed_objects":[],"sla_violations":[],"report_file":""`))
+		})
+		It("writes the restore timings", func() {
+			summary := RunSummary{
+				Utility: "gprestore",
+				Status:  "success",
+				Timings: &RestoreTimings{
+					Phases:            []PhaseTiming{{Phase: "data", Duration: 4 * time.Second}},
+					ConnectionBusy:    []time.Duration{3 * time.Second},
+					SlowestStatements: []StatementTiming{{ObjectType: "INDEX", Object: "public.foo_idx", Duration: 500 * time.Millisecond}},
+				},
+			}
+			var output bytes.Buffer
+
+			Expect(WriteMachineOutput(&output, summary)).To(Succeed())
+
+			Expect(output.String()).To(ContainSubstring(`"timings":{"phases":[{"phase":"data","duration_seconds":4}],"connections":[{"connection":0,"busy_seconds":3,"utilization_percent":75}],"slowest_statements":[{"object_type":"INDEX","object":"public.foo_idx","duration_seconds":0.5}]}`))
+		})
+	})
+	Describe("GetRunStatus", func() {
+		It("reports a canceled run regardless of error code", func() {
+			Expect(GetRunStatus(2, true)).To(Equal("canceled"))
+		})
+		It("reports the status for each error code", func() {
+			Expect(GetRunStatus(0, false)).To(Equal("success"))
+			Expect(GetRunStatus(1, false)).To(Equal("success_with_errors"))
+			Expect(GetRunStatus(2, false)).To(Equal("failure"))
+			Expect(GetRunStatus(SLAViolationExitCode, false)).To(Equal("sla_violation"))
+		})
+	})
+	Describe("ReadSLATargets", func() {
+		slaFileContents := `databases:
+  proddb:
+    maxduration: 2h
+    minthroughput: 100MB
+    maxage: 24h
+  baddb:
+    maxduration: 2 hours
+`
+		BeforeEach(func() {
+			operating.System.ReadFile = func(filename string) ([]byte, error) { return []byte(slaFileContents), nil }
+		})
+		AfterEach(func() {
+			operating.System = operating.InitializeSystemFunctions()
+		})
+		It("returns the targets for the given database", func() {
+			targets, err := ReadSLATargets("/tmp/sla.yaml", "proddb")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*targets).To(Equal(SLATargets{MaxDuration: "2h", MinThroughput: "100MB", MaxAge: "24h"}))
+		})
+		It("returns nil if the database has no targets", func() {
+			targets, err := ReadSLATargets("/tmp/sla.yaml", "devdb")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(targets).To(BeNil())
+		})
+		It("returns an error if a target is invalid", func() {
+			_, err := ReadSLATargets("/tmp/sla.yaml", "baddb")
+			Expect(err).To(MatchError("Invalid SLA duration '2 hours' for database baddb.  Durations must be in a format such as '2h30m'."))
+		})
+	})
+	Describe("GetViolations", func() {
+		targets := &SLATargets{MaxDuration: "2h", MinThroughput: "100MB", MaxAge: "24h"}
+		It("returns no violations when all targets are met", func() {
+			Expect(targets.GetViolations(time.Hour, 1<<40, 12*time.Hour)).To(BeEmpty())
+		})
+		It("returns a violation for each target that is missed", func() {
+			Expect(targets.GetViolations(3*time.Hour, 10*(1<<30), 26*time.Hour)).To(Equal([]string{
+				"duration 3:00:00 exceeded the maximum of 2h",
+				"throughput 970.9 kB/s was below the minimum of 100.0 MB/s",
+				"backup age 26:00:00 exceeded the maximum of 24h",
+			}))
+		})
+		It("does not check targets whose values are unknown or unset", func() {
+			Expect(targets.GetViolations(time.Hour, -1, -1)).To(BeEmpty())
+			Expect((&SLATargets{}).GetViolations(3*time.Hour, 1, 26*time.Hour)).To(BeEmpty())
+		})
 	})
 	Describe("SetBackupParamFromFlags", func() {
 		AfterEach(func() {
@@ -322,9 +737,12 @@ restore status:      Success but non-fatal errors occurred. See log file .+ for
 				IncludeRelations:     []string{"public.foobar"},
 				ExcludeSchemas:       []string{},
 				ExcludeRelations:     []string{},
+				FormatVersion:        history.CURRENT_FORMAT_VERSION,
 				Plugin:               "/tmp/plugin.sh",
 				Timestamp:            "timestamp1",
 				IncludeTableFiltered: true,
+				DataLayout:           "oid",
+				IsolationLevel:       "serializable",
 				Status:               history.BackupStatusFailed,
 			}, backupConfig)
 		})
@@ -384,13 +802,23 @@ restore status:      Success but non-fatal errors occurred. See log file .+ for
 	Describe("EnsureBackupVersionCompatibility", func() {
 		It("Panics if gpbackup version is greater than gprestore version", func() {
 			defer testhelper.ShouldPanicWithMessage("gprestore 0.1.0 cannot restore a backup taken with gpbackup 0.2.0; please use gprestore 0.2.0 or later.")
-			EnsureBackupVersionCompatibility("0.2.0", "0.1.0")
+			EnsureBackupVersionCompatibility("0.2.0", "0.1.0", 0)
 		})
 		It("Does not panic if gpbackup version is less than gprestore version", func() {
-			EnsureBackupVersionCompatibility("0.1.0", "0.1.3")
+			EnsureBackupVersionCompatibility("0.1.0", "0.1.3", 0)
 		})
 		It("Does not panic if gpbackup version equals gprestore version", func() {
-			EnsureBackupVersionCompatibility("0.1.0", "0.1.0")
+			EnsureBackupVersionCompatibility("0.1.0", "0.1.0", 0)
+		})
+		It("Does not panic if a later gpbackup wrote a format that gprestore can read", func() {
+			EnsureBackupVersionCompatibility("0.2.0", "0.1.0", history.CURRENT_FORMAT_VERSION)
+		})
+		It("Panics if the backup is in a later format than gprestore can read", func() {
+			defer testhelper.ShouldPanicWithMessage(fmt.Sprintf("gprestore 0.1.0 cannot restore a backup in format version %d, taken with gpbackup 0.2.0; please use gprestore 0.2.0 or later.", history.CURRENT_FORMAT_VERSION+1))
+			EnsureBackupVersionCompatibility("0.2.0", "0.1.0", history.CURRENT_FORMAT_VERSION+1)
+		})
+		It("Does not panic if the backup is in an earlier format that gprestore translates", func() {
+			EnsureBackupVersionCompatibility("0.1.0", "0.1.3", history.UNVERSIONED_FORMAT_VERSION)
 		})
 	})
 	Describe("EnsureDatabaseVersionCompatibility", func() {
@@ -404,13 +832,16 @@ restore status:      Success but non-fatal errors occurred. See log file .+ for
 		})
 		It("Panics if backup database major version is greater than restore major version", func() {
 			defer testhelper.ShouldPanicWithMessage("Cannot restore from GPDB version 6.0.0-beta.9+dev.129.g4bd4e41 build dev to 5.0.0-beta.9+dev.129.g4bd4e41 build dev due to catalog incompatibilities.")
-			EnsureDatabaseVersionCompatibility("6.0.0-beta.9+dev.129.g4bd4e41 build dev", restoreVersion)
+			EnsureDatabaseVersionCompatibility("6.0.0-beta.9+dev.129.g4bd4e41 build dev", restoreVersion, false)
+		})
+		It("Does not panic if backup database major version is greater than restore major version with DDL translation", func() {
+			EnsureDatabaseVersionCompatibility("6.0.0-beta.9+dev.129.g4bd4e41 build dev", restoreVersion, true)
 		})
 		It("Does not panic if backup database major version is greater than restore major version", func() {
-			EnsureDatabaseVersionCompatibility("4.3.16-beta.9+dev.129.g4bd4e41 build dev", restoreVersion)
+			EnsureDatabaseVersionCompatibility("4.3.16-beta.9+dev.129.g4bd4e41 build dev", restoreVersion, false)
 		})
 		It("Does not panic if backup database major version is equal to restore major version", func() {
-			EnsureDatabaseVersionCompatibility("5.0.6-beta.9+dev.129.g4bd4e41 build dev", restoreVersion)
+			EnsureDatabaseVersionCompatibility("5.0.6-beta.9+dev.129.g4bd4e41 build dev", restoreVersion, false)
 		})
 	})
 
@@ -449,23 +880,22 @@ Timestamp Key: 20170101010101`)
 		var (
 			testExecutor *testhelper.TestExecutor
 			testCluster  *cluster.Cluster
-			testFPInfo   filepath.FilePathInfo
 			w            *os.File
 			r            *os.File
 		)
 		BeforeEach(func() {
 			r, w, _ = os.Pipe()
 			testCluster = testutils.SetDefaultSegmentConfiguration()
-			testFPInfo = filepath.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg")
 			operating.System.OpenFileRead = func(name string, flag int, perm os.FileMode) (operating.ReadCloserAt, error) { return r, nil }
 			operating.System.ReadFile = func(filename string) ([]byte, error) { return ioutil.ReadAll(r) }
 			operating.System.Hostname = func() (string, error) { return "localhost", nil }
 			operating.System.Getenv = func(key string) string {
 				if key == "HOME" {
 					return "home"
-				} else {
+				} else if key == "GPHOME" {
 					return "gphome"
 				}
+				return ""
 			}
 			testExecutor = &testhelper.TestExecutor{}
 			testCluster.Executor = testExecutor
@@ -510,65 +940,181 @@ Timestamp Key: 20170101010101`)
 				Expect(contacts).To(Equal("contact4@example.org"))
 			})
 		})
-		Context("ConstructEmailMessage for successful backup", func() {
-			It("adds HTML formatting to the contents of the report file", func() {
+		Context("GetContactList", func() {
+			contactFile := ContactFile{
+				Groups: map[string][]string{
+					"dba":    {"dba1@example.com", "dba2@example.com"},
+					"oncall": {"pager@example.com", "dba1@example.com"},
+				},
+				Contacts: map[string][]EmailContact{
+					"gpbackup": {
+						{Group: "dba", Status: map[string]bool{"success": true, "success_with_errors": true, "failure": true}},
+						{Group: "oncall", Status: map[string]bool{"failure": true}},
+						{Address: "manager@example.com", Status: map[string]bool{"failure": true}},
+						{Group: "missing", Status: map[string]bool{"failure": true}},
+					},
+				},
+			}
+			It("expands groups to their addresses for the statuses they receive", func() {
+				Expect(contactFile.GetContactList("gpbackup", "success")).To(Equal("dba1@example.com dba2@example.com"))
+			})
+			It("lists each address once when it is in several groups", func() {
+				Expect(contactFile.GetContactList("gpbackup", "failure")).To(Equal("dba1@example.com dba2@example.com pager@example.com manager@example.com"))
+				Expect(stdout).To(Say("Email contact group missing is not defined in the email contacts file"))
+			})
+		})
+		Context("ShouldSendEmail", func() {
+			DescribeTable("sends an email according to the send_on setting",
+				func(sendOn string, runStatus string, shouldSend bool) {
+					contactFile := ContactFile{SendOn: sendOn}
+					Expect(contactFile.ShouldSendEmail(runStatus)).To(Equal(shouldSend))
+				},
+				Entry("always on success", "", "success", true),
+				Entry("always on failure", "always", "failure", true),
+				Entry("warnings on success", "warnings", "success", false),
+				Entry("warnings on success with errors", "warnings", "success_with_errors", true),
+				Entry("warnings on SLA violation", "warnings", "sla_violation", true),
+				Entry("failure on success with errors", "failure", "success_with_errors", false),
+				Entry("failure on failure", "failure", "failure", true),
+				Entry("failure on cancel", "failure", "canceled", true),
+			)
+			It("uses the environment variable over the contacts file", func() {
+				operating.System.Getenv = func(key string) string {
+					if key == "GPBACKUP_EMAIL_SEND_ON" {
+						return "failure"
+					}
+					return ""
+				}
+				contactFile := ContactFile{SendOn: "always"}
+				Expect(contactFile.ShouldSendEmail("success")).To(BeFalse())
+			})
+		})
+		Context("ConstructEmailSubject", func() {
+			It("renders the subject template on a single line", func() {
+				summary := RunSummary{Utility: "gpbackup", RunID: "20170101010101", Database: "testdb", Status: "failure"}
+				subject, err := ConstructEmailSubject(summary, "report_file", "[{{.Result}}] {{.Utility}}\nBcc: someone@example.com {{.Database}}")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(subject).To(Equal("[Failure] gpbackup Bcc: someone@example.com testdb"))
+			})
+			It("uses the subject template from the environment variable over the contacts file", func() {
+				operating.System.Getenv = func(key string) string {
+					if key == "GPBACKUP_EMAIL_SUBJECT" {
+						return "{{.Database}}: {{.Status}}"
+					}
+					return ""
+				}
+				contactFile := ContactFile{Subject: "{{.Utility}}"}
+				Expect(contactFile.GetSubjectTemplate()).To(Equal("{{.Database}}: {{.Status}}"))
+			})
+		})
+		Context("ConstructEmailMessage", func() {
+			summary := RunSummary{
+				Utility:    "gpbackup",
+				RunID:      "20170101010101",
+				Database:   "testdb",
+				Type:       "full",
+				Status:     "success",
+				Duration:   90 * time.Second,
+				Bytes:      2048,
+				ErrorCount: 0,
+			}
+			It("builds a multipart message with an HTML summary and the report attached", func() {
 				_, _ = w.Write(reportFileContents)
 				_ = w.Close()
 
-				message := ConstructEmailMessage(testFPInfo.Timestamp, contactsList, "report_file", "gpbackup", true)
+				message := ConstructEmailMessage(contactsList, "/tmp/report_file", summary, "<p>{{.Status}} {{.Database}} {{.DurationString}} {{.Size}} {{.ReportFilename}}</p>", DefaultEmailSubject)
 				expectedMessage := `To: contact1@example.com contact2@example.org
 Subject: gpbackup 20170101010101 on localhost completed: Success
-Content-Type: text/html
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="gpbackup-report-boundary"
+
+--gpbackup-report-boundary
+Content-Type: text/html; charset=UTF-8
 Content-Disposition: inline
-<html>
-<body>
-<pre style=\"font: monospace\">
+
+<p>success testdb 0:01:30 2.0 kB report_file</p>
+--gpbackup-report-boundary
+Content-Type: text/plain; charset=UTF-8
+Content-Disposition: attachment; filename="report_file"
+
 Greenplum Database Backup Report
 
 Timestamp Key: 20170101010101
-</pre>
-</body>
-</html>`
+--gpbackup-report-boundary--
+`
 				Expect(message).To(Equal(expectedMessage))
 			})
-		})
-		Context("ConstructEmailMessage for Failed backup", func() {
-			It("adds HTML formatting to the contents of the report file", func() {
+			It("reports failure in the subject for a failed run", func() {
 				_, _ = w.Write(reportFileContents)
 				_ = w.Close()
 
-				message := ConstructEmailMessage(testFPInfo.Timestamp, contactsList, "report_file", "gpbackup", false)
-				expectedMessage := `To: contact1@example.com contact2@example.org
-Subject: gpbackup 20170101010101 on localhost completed: Failure
-Content-Type: text/html
-Content-Disposition: inline
-<html>
-<body>
-<pre style=\"font: monospace\">
-Greenplum Database Backup Report
+				failedSummary := summary
+				failedSummary.Status = "failure"
+				message := ConstructEmailMessage(contactsList, "report_file", failedSummary, DefaultEmailTemplate, DefaultEmailSubject)
+				Expect(message).To(ContainSubstring("Subject: gpbackup 20170101010101 on localhost completed: Failure\n"))
+			})
+			It("uses a custom subject template", func() {
+				_, _ = w.Write(reportFileContents)
+				_ = w.Close()
 
-Timestamp Key: 20170101010101
-</pre>
-</body>
-</html>`
-				Expect(message).To(Equal(expectedMessage))
+				message := ConstructEmailMessage(contactsList, "report_file", summary, DefaultEmailTemplate, "{{.Database}} {{.Type}} backup: {{.Status}}")
+				Expect(message).To(ContainSubstring("Subject: testdb full backup: success\n"))
+			})
+			It("falls back to the default subject if the subject template is invalid", func() {
+				_, _ = w.Write(reportFileContents)
+				_ = w.Close()
+
+				message := ConstructEmailMessage(contactsList, "report_file", summary, DefaultEmailTemplate, "{{.Database")
+				Expect(message).To(ContainSubstring("Subject: gpbackup 20170101010101 on localhost completed: Success\n"))
+				Expect(stdout).To(Say("Invalid email subject template"))
+			})
+			It("falls back to the default template if the custom template is invalid", func() {
+				_, _ = w.Write(reportFileContents)
+				_ = w.Close()
+
+				message := ConstructEmailMessage(contactsList, "report_file", summary, "{{.Status", DefaultEmailSubject)
+				Expect(message).To(ContainSubstring(`<tr><th align="left">Status</th><td>success</td></tr>`))
+				Expect(stdout).To(Say("Invalid email template"))
+			})
+		})
+		Context("ConstructHTMLReport", func() {
+			It("renders a summary table with the failed objects", func() {
+				summary := RunSummary{
+					Utility:       "gprestore",
+					RunID:         "20170101010101",
+					Database:      "testdb",
+					Type:          "full",
+					Status:        "success_with_errors",
+					Duration:      time.Hour,
+					Bytes:         -1,
+					ErrorCount:    2,
+					FailedObjects: []string{"public.foo", "public.bar"},
+				}
+				htmlReport, err := ConstructHTMLReport(summary, "report_file", DefaultEmailTemplate)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(htmlReport).To(ContainSubstring(`<tr><th align="left">Status</th><td>success_with_errors</td></tr>`))
+				Expect(htmlReport).To(ContainSubstring(`<tr><th align="left">Duration</th><td>1:00:00</td></tr>`))
+				Expect(htmlReport).To(ContainSubstring(`<tr><th align="left">Size</th><td>unknown</td></tr>`))
+				Expect(htmlReport).To(ContainSubstring(`<tr><th align="left">Errors</th><td>2</td></tr>`))
+				Expect(htmlReport).To(ContainSubstring("<li>public.foo</li>\n<li>public.bar</li>"))
+				Expect(htmlReport).To(ContainSubstring("The full report is attached as report_file."))
+			})
+			It("omits the failed objects list when nothing failed", func() {
+				htmlReport, err := ConstructHTMLReport(RunSummary{Status: "success"}, "report_file", DefaultEmailTemplate)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(htmlReport).ToNot(ContainSubstring("Failed objects"))
+			})
+			It("escapes object names in the HTML", func() {
+				htmlReport, err := ConstructHTMLReport(RunSummary{FailedObjects: []string{"public.<foo>"}}, "report_file", DefaultEmailTemplate)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(htmlReport).To(ContainSubstring("<li>public.&lt;foo&gt;</li>"))
 			})
 		})
 		Context("EmailReport", func() {
 			var (
 				expectedHomeCmd   = "test -f home/gp_email_contacts.yaml"
 				expectedGpHomeCmd = "test -f gphome/bin/gp_email_contacts.yaml"
-				expectedMessage   = `echo "To: contact1@example.com
-Subject: gpbackup 20170101010101 on localhost completed: Success
-Content-Type: text/html
-Content-Disposition: inline
-<html>
-<body>
-<pre style=\"font: monospace\">
-
-</pre>
-</body>
-</html>" | sendmail -t`
+				summary           = RunSummary{Utility: "gpbackup", RunID: "20170101010101", Status: "success", Bytes: -1}
 			)
 			It("sends no email and raises a warning if no gp_email_contacts.yaml file is found", func() {
 				_, _ = w.Write(contactsFileContents)
@@ -576,7 +1122,7 @@ Content-Disposition: inline
 
 				testExecutor.LocalError = errors.Errorf("exit status 2")
 
-				EmailReport(testCluster, testFPInfo.Timestamp, "report_file", "gpbackup", true)
+				EmailReport(testCluster, "report_file", summary)
 				Expect(testExecutor.NumExecutions).To(Equal(2))
 				Expect(testExecutor.LocalCommands).To(Equal([]string{expectedHomeCmd, expectedGpHomeCmd}))
 				Expect(stdout).To(Say("Found neither gphome/bin/gp_email_contacts.yaml nor home/gp_email_contacts.yaml"))
@@ -588,9 +1134,12 @@ Content-Disposition: inline
 				testExecutor.ErrorOnExecNum = 2 // Shouldn't hit this case, as it shouldn't be executed a second time
 				testExecutor.LocalError = errors.Errorf("exit status 2")
 
-				EmailReport(testCluster, testFPInfo.Timestamp, "report_file", "gpbackup", true)
+				EmailReport(testCluster, "report_file", summary)
 				Expect(testExecutor.NumExecutions).To(Equal(2))
-				Expect(testExecutor.LocalCommands).To(Equal([]string{expectedHomeCmd, expectedMessage}))
+				Expect(testExecutor.LocalCommands).To(HaveLen(2))
+				Expect(testExecutor.LocalCommands[0]).To(Equal(expectedHomeCmd))
+				Expect(testExecutor.LocalCommands[1]).To(HavePrefix("echo 'To: contact1@example.com\nSubject: gpbackup 20170101010101 on localhost completed: Success\n"))
+				Expect(testExecutor.LocalCommands[1]).To(HaveSuffix("' | sendmail -t"))
 				Expect(logfile).To(Say("Sending email report to the following addresses: contact1@example.com"))
 			})
 			It("sends an email to contacts in $GPHOME/bin/gp_email_contacts.yaml if only that file is found", func() {
@@ -600,20 +1149,37 @@ Content-Disposition: inline
 				testExecutor.ErrorOnExecNum = 1
 				testExecutor.LocalError = errors.Errorf("exit status 2")
 
-				EmailReport(testCluster, testFPInfo.Timestamp, "report_file", "gpbackup", true)
+				EmailReport(testCluster, "report_file", summary)
 				Expect(testExecutor.NumExecutions).To(Equal(3))
-				Expect(testExecutor.LocalCommands).To(Equal([]string{expectedHomeCmd, expectedGpHomeCmd, expectedMessage}))
+				Expect(testExecutor.LocalCommands).To(HaveLen(3))
+				Expect(testExecutor.LocalCommands[:2]).To(Equal([]string{expectedHomeCmd, expectedGpHomeCmd}))
+				Expect(testExecutor.LocalCommands[2]).To(HavePrefix("echo 'To: contact1@example.com\nSubject: gpbackup 20170101010101 on localhost completed: Success\n"))
 				Expect(logfile).To(Say("Sending email report to the following addresses: contact1@example.com"))
 			})
 			It("sends an email to contacts in $HOME/gp_email_contacts.yaml if a file exists in both $HOME and $GPHOME/bin", func() {
 				_, _ = w.Write(contactsFileContents)
 				_ = w.Close()
 
-				EmailReport(testCluster, testFPInfo.Timestamp, "report_file", "gpbackup", true)
+				EmailReport(testCluster, "report_file", summary)
 				Expect(testExecutor.NumExecutions).To(Equal(2))
-				Expect(testExecutor.LocalCommands).To(Equal([]string{expectedHomeCmd, expectedMessage}))
+				Expect(testExecutor.LocalCommands).To(HaveLen(2))
+				Expect(testExecutor.LocalCommands[0]).To(Equal(expectedHomeCmd))
+				Expect(testExecutor.LocalCommands[1]).To(HavePrefix("echo 'To: contact1@example.com\nSubject: gpbackup 20170101010101 on localhost completed: Success\n"))
+				Expect(testExecutor.LocalCommands[1]).To(HaveSuffix("' | sendmail -t"))
 				Expect(logfile).To(Say("Sending email report to the following addresses: contact1@example.com"))
 			})
+			It("sends no email for a successful run if emails are only sent on failure", func() {
+				failureOnlyContents, _ := yaml.Marshal(ContactFile{
+					SendOn:   "failure",
+					Contacts: map[string][]EmailContact{"gpbackup": {{Address: "contact1@example.com", Status: map[string]bool{"success": true}}}},
+				})
+				_, _ = w.Write(failureOnlyContents)
+				_ = w.Close()
+
+				EmailReport(testCluster, "report_file", summary)
+				Expect(testExecutor.NumExecutions).To(Equal(1))
+				Expect(stdout).To(Say("Email containing gpbackup report report_file will not be sent for a run with status success"))
+			})
 		})
 	})
 })
@@ -0,0 +1,16 @@
+// +build !windows
+
+package report
+
+import (
+	"log/syslog"
+)
+
+func writeToSyslog(tag string, line string) error {
+	syslogWriter, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return err
+	}
+	defer syslogWriter.Close()
+	return syslogWriter.Info(line)
+}
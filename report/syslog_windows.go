@@ -0,0 +1,11 @@
+// +build windows
+
+package report
+
+import (
+	"github.com/pkg/errors"
+)
+
+func writeToSyslog(tag string, line string) error {
+	return errors.New("syslog is not supported on Windows")
+}
@@ -0,0 +1,292 @@
+package report
+
+/*
+ * This file contains functions for posting a notification to webhook
+ * endpoints, such as Slack, Microsoft Teams, or PagerDuty, when a backup or
+ * restore completes, alongside the email report.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	WEBHOOK_FORMAT_JSON      = "json"
+	WEBHOOK_FORMAT_SLACK     = "slack"
+	WEBHOOK_FORMAT_TEAMS     = "teams"
+	WEBHOOK_FORMAT_PAGERDUTY = "pagerduty"
+
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+	defaultWebhookRetries = 3
+	defaultWebhookTimeout = 10
+)
+
+/*
+ * Retries is the number of times a failed request is retried, and Timeout
+ * the number of seconds each request may take.  ReportURL is a template for
+ * a link to the report, for sites that publish the reports; by default the
+ * path of the report on the coordinator is sent.
+ */
+type WebhookFile struct {
+	Webhooks  []Webhook
+	Retries   *int
+	Timeout   int
+	ReportURL string `yaml:"report_url"`
+}
+
+/*
+ * Format is one of json (the default), slack, teams, or pagerduty, and SendOn
+ * takes the same values as in the email contacts file.  Utilities limits the
+ * webhook to gpbackup or gprestore runs.
+ */
+type Webhook struct {
+	URL        string
+	Format     string
+	SendOn     string `yaml:"send_on"`
+	RoutingKey string `yaml:"routing_key"`
+	Utilities  []string
+}
+
+type WebhookPayload struct {
+	Utility         string   `json:"utility"`
+	Timestamp       string   `json:"timestamp"`
+	Database        string   `json:"database"`
+	Type            string   `json:"type"`
+	Status          string   `json:"status"`
+	Hostname        string   `json:"hostname"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	ErrorCount      int      `json:"error_count"`
+	ErrorSummary    string   `json:"error_summary,omitempty"`
+	FailedObjects   []string `json:"failed_objects,omitempty"`
+	ReportURL       string   `json:"report_url"`
+}
+
+func readWebhookFile(filename string) (*WebhookFile, error) {
+	webhookFile := &WebhookFile{}
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(contents, webhookFile)
+	return webhookFile, err
+}
+
+func NewWebhookPayload(summary RunSummary, errMsg string, reportURL string) WebhookPayload {
+	hostname, _ := operating.System.Hostname()
+	return WebhookPayload{
+		Utility:         summary.Utility,
+		Timestamp:       summary.RunID,
+		Database:        summary.Database,
+		Type:            summary.Type,
+		Status:          summary.Status,
+		Hostname:        hostname,
+		DurationSeconds: summary.Duration.Seconds(),
+		ErrorCount:      summary.ErrorCount,
+		ErrorSummary:    strings.TrimSpace(errMsg),
+		FailedObjects:   summary.FailedObjects,
+		ReportURL:       reportURL,
+	}
+}
+
+/*
+ * Returns the link to the report, from the report_url template if there is
+ * one, or the path of the report otherwise.
+ */
+func (webhookFile *WebhookFile) GetReportURL(summary RunSummary, reportFilePath string) string {
+	if webhookFile.ReportURL == "" {
+		return reportFilePath
+	}
+	_, reportFilename := path.Split(reportFilePath)
+	tmpl, err := template.New("report_url").Parse(webhookFile.ReportURL)
+	if err != nil {
+		gplog.Warn("Invalid webhook report_url template: %v", err)
+		return reportFilePath
+	}
+	var reportURL bytes.Buffer
+	err = tmpl.Execute(&reportURL, getEmailTemplateData(summary, reportFilename))
+	if err != nil {
+		gplog.Warn("Invalid webhook report_url template: %v", err)
+		return reportFilePath
+	}
+	return reportURL.String()
+}
+
+func webhookMessage(payload WebhookPayload) string {
+	message := fmt.Sprintf("%s %s of database %s on %s completed: %s (duration %s, %d errors)", payload.Utility, payload.Timestamp,
+		payload.Database, payload.Hostname, payload.Status, FormatDuration(time.Duration(payload.DurationSeconds*float64(time.Second))), payload.ErrorCount)
+	if payload.ErrorSummary != "" {
+		message += fmt.Sprintf("\nError: %s", payload.ErrorSummary)
+	}
+	return message + fmt.Sprintf("\nReport: %s", payload.ReportURL)
+}
+
+/*
+ * Returns the URL and body of the request for the webhook, in the format its
+ * service expects.
+ */
+func ConstructWebhookRequest(webhook Webhook, payload WebhookPayload) (string, []byte, error) {
+	var body interface{}
+	webhookURL := webhook.URL
+	switch webhook.Format {
+	case "", WEBHOOK_FORMAT_JSON:
+		body = payload
+	case WEBHOOK_FORMAT_SLACK, WEBHOOK_FORMAT_TEAMS:
+		body = map[string]string{"text": webhookMessage(payload)}
+	case WEBHOOK_FORMAT_PAGERDUTY:
+		if webhookURL == "" {
+			webhookURL = pagerDutyEventsURL
+		}
+		severity := "info"
+		if payload.Status == "failure" || payload.Status == "canceled" {
+			severity = "critical"
+		} else if payload.Status != "success" {
+			severity = "warning"
+		}
+		body = map[string]interface{}{
+			"routing_key":  webhook.RoutingKey,
+			"event_action": "trigger",
+			"dedup_key":    fmt.Sprintf("%s-%s", payload.Utility, payload.Timestamp),
+			"payload": map[string]interface{}{
+				"summary":        strings.SplitN(webhookMessage(payload), "\n", 2)[0],
+				"source":         payload.Hostname,
+				"severity":       severity,
+				"custom_details": payload,
+			},
+		}
+	default:
+		return "", nil, errors.Errorf("Unrecognized webhook format %s", webhook.Format)
+	}
+	if webhookURL == "" {
+		return "", nil, errors.New("Webhook has no url")
+	}
+	contents, err := json.Marshal(body)
+	return webhookURL, contents, err
+}
+
+/*
+ * Posts the body to the URL, retrying after connection errors, rate limiting,
+ * and server errors with a doubling delay.  Other client errors are not
+ * retried, as the same request would fail again.
+ */
+func PostWebhook(client *http.Client, webhookURL string, body []byte, retries int, retryDelay time.Duration) error {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryDelay)
+			retryDelay *= 2
+		}
+		var response *http.Response
+		response, err = client.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			// The error names the URL, which may hold a secret token
+			if urlErr, ok := err.(*url.Error); ok {
+				err = urlErr.Err
+			}
+			continue
+		}
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		_ = response.Body.Close()
+		if response.StatusCode < 300 {
+			return nil
+		}
+		err = errors.Errorf("Webhook returned %s", response.Status)
+		if response.StatusCode != http.StatusTooManyRequests && response.StatusCode < 500 {
+			return err
+		}
+	}
+	return err
+}
+
+func (webhook Webhook) appliesTo(utility string) bool {
+	if len(webhook.Utilities) == 0 {
+		return true
+	}
+	for _, webhookUtility := range webhook.Utilities {
+		if webhookUtility == utility {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Posts a notification of the run to each webhook in gp_webhooks.yaml, which
+ * is looked for in the same places as the email contacts file.  Failing to
+ * notify a webhook is a warning, as the run itself is already complete.
+ */
+func SendWebhookNotifications(c *cluster.Cluster, reportFilePath string, summary RunSummary, errMsg string) {
+	webhookFilename, err := findConfigFile(c, "gp_webhooks.yaml")
+	if err != nil {
+		gplog.Verbose("%v, no webhook notifications will be sent", err)
+		return
+	}
+	webhookFile, err := readWebhookFile(webhookFilename)
+	if err != nil {
+		gplog.Warn("Unable to send webhook notifications: Error reading webhook file %s: %v", webhookFilename, err)
+		return
+	}
+	retries := defaultWebhookRetries
+	if webhookFile.Retries != nil {
+		retries = *webhookFile.Retries
+	}
+	timeout := defaultWebhookTimeout
+	if webhookFile.Timeout > 0 {
+		timeout = webhookFile.Timeout
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	payload := NewWebhookPayload(summary, errMsg, webhookFile.GetReportURL(summary, reportFilePath))
+	for _, webhook := range webhookFile.Webhooks {
+		if !webhook.appliesTo(summary.Utility) {
+			continue
+		}
+		shouldSend, err := shouldNotify(webhook.SendOn, summary.Status)
+		if err != nil {
+			gplog.Warn("%v, sending the webhook notification", err)
+		}
+		if !shouldSend {
+			continue
+		}
+		webhookURL, body, err := ConstructWebhookRequest(webhook, payload)
+		if err != nil {
+			gplog.Warn("Unable to send webhook notification: %v", err)
+			continue
+		}
+		gplog.Verbose("Sending %s notification to webhook %s", summary.Utility, webhookHost(webhookURL))
+		err = PostWebhook(client, webhookURL, body, retries, time.Second)
+		if err != nil {
+			gplog.Warn("Unable to send webhook notification to %s: %v", webhookHost(webhookURL), err)
+		}
+	}
+}
+
+/*
+ * Webhook URLs often embed a secret token in the path, so only the host is
+ * logged.
+ */
+func webhookHost(webhookURL string) string {
+	host := webhookURL
+	if index := strings.Index(host, "://"); index != -1 {
+		host = host[index+3:]
+	}
+	if index := strings.Index(host, "/"); index != -1 {
+		host = host[:index]
+	}
+	return host
+}
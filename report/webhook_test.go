@@ -0,0 +1,190 @@
+package report_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/testutils"
+
+	. "github.com/greenplum-db/gpbackup/report"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("report/webhook tests", func() {
+	summary := RunSummary{
+		Utility:    "gpbackup",
+		RunID:      "20170101010101",
+		Database:   "testdb",
+		Type:       "full",
+		Status:     "failure",
+		Duration:   90 * time.Second,
+		ErrorCount: 1,
+	}
+	BeforeEach(func() {
+		operating.System.Hostname = func() (string, error) { return "localhost", nil }
+	})
+	AfterEach(func() {
+		operating.InitializeSystemFunctions()
+	})
+
+	Describe("NewWebhookPayload", func() {
+		It("fills in the payload from the run summary", func() {
+			payload := NewWebhookPayload(summary, "Cannot access /tmp/backups: Permission denied\n", "/tmp/report_file")
+			Expect(payload).To(Equal(WebhookPayload{
+				Utility:         "gpbackup",
+				Timestamp:       "20170101010101",
+				Database:        "testdb",
+				Type:            "full",
+				Status:          "failure",
+				Hostname:        "localhost",
+				DurationSeconds: 90,
+				ErrorCount:      1,
+				ErrorSummary:    "Cannot access /tmp/backups: Permission denied",
+				ReportURL:       "/tmp/report_file",
+			}))
+		})
+	})
+	Describe("GetReportURL", func() {
+		It("returns the report path without a report_url template", func() {
+			webhookFile := WebhookFile{}
+			Expect(webhookFile.GetReportURL(summary, "/data/backups/gpbackup_20170101010101_report")).To(Equal("/data/backups/gpbackup_20170101010101_report"))
+		})
+		It("renders the report_url template", func() {
+			webhookFile := WebhookFile{ReportURL: "https://backups.example.com/{{.Database}}/{{.ReportFilename}}"}
+			Expect(webhookFile.GetReportURL(summary, "/data/backups/gpbackup_20170101010101_report")).To(Equal("https://backups.example.com/testdb/gpbackup_20170101010101_report"))
+		})
+	})
+	Describe("ConstructWebhookRequest", func() {
+		payload := WebhookPayload{Utility: "gpbackup", Timestamp: "20170101010101", Database: "testdb", Status: "failure",
+			Hostname: "localhost", DurationSeconds: 90, ErrorCount: 1, ErrorSummary: "out of disk", ReportURL: "/tmp/report_file"}
+		It("sends the payload as JSON by default", func() {
+			url, body, err := ConstructWebhookRequest(Webhook{URL: "https://example.com/hook"}, payload)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(url).To(Equal("https://example.com/hook"))
+			var sent WebhookPayload
+			_ = json.Unmarshal(body, &sent)
+			Expect(sent).To(Equal(payload))
+		})
+		It("sends a text message to Slack", func() {
+			_, body, err := ConstructWebhookRequest(Webhook{URL: "https://hooks.slack.com/services/T/B/X", Format: "slack"}, payload)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal(`{"text":"gpbackup 20170101010101 of database testdb on localhost completed: failure (duration 0:01:30, 1 errors)\nError: out of disk\nReport: /tmp/report_file"}`))
+		})
+		It("sends a critical event to PagerDuty for a failed run", func() {
+			url, body, err := ConstructWebhookRequest(Webhook{Format: "pagerduty", RoutingKey: "key"}, payload)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(url).To(Equal("https://events.pagerduty.com/v2/enqueue"))
+			var event map[string]interface{}
+			_ = json.Unmarshal(body, &event)
+			Expect(event["routing_key"]).To(Equal("key"))
+			Expect(event["dedup_key"]).To(Equal("gpbackup-20170101010101"))
+			Expect(event["payload"]).To(HaveKeyWithValue("severity", "critical"))
+			Expect(event["payload"]).To(HaveKeyWithValue("summary", "gpbackup 20170101010101 of database testdb on localhost completed: failure (duration 0:01:30, 1 errors)"))
+		})
+		It("returns an error for an unrecognized format", func() {
+			_, _, err := ConstructWebhookRequest(Webhook{URL: "https://example.com/hook", Format: "irc"}, payload)
+			Expect(err).To(MatchError("Unrecognized webhook format irc"))
+		})
+		It("returns an error for a webhook without a url", func() {
+			_, _, err := ConstructWebhookRequest(Webhook{Format: "slack"}, payload)
+			Expect(err).To(MatchError("Webhook has no url"))
+		})
+	})
+	Describe("PostWebhook", func() {
+		var (
+			httpServer *httptest.Server
+			statuses   []int
+			requests   int
+			received   []byte
+		)
+		BeforeEach(func() {
+			requests = 0
+			httpServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(statuses[requests])
+				requests++
+			}))
+		})
+		AfterEach(func() {
+			httpServer.Close()
+		})
+		It("posts the body", func() {
+			statuses = []int{http.StatusOK}
+			err := PostWebhook(httpServer.Client(), httpServer.URL, []byte(`{"status":"success"}`), 3, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requests).To(Equal(1))
+			Expect(string(received)).To(Equal(`{"status":"success"}`))
+		})
+		It("retries after server errors", func() {
+			statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+			err := PostWebhook(httpServer.Client(), httpServer.URL, []byte("{}"), 3, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requests).To(Equal(3))
+		})
+		It("returns the last error once the retries are used up", func() {
+			statuses = []int{http.StatusInternalServerError, http.StatusInternalServerError}
+			err := PostWebhook(httpServer.Client(), httpServer.URL, []byte("{}"), 1, 0)
+			Expect(err).To(MatchError("Webhook returned 500 Internal Server Error"))
+			Expect(requests).To(Equal(2))
+		})
+		It("does not retry after client errors", func() {
+			statuses = []int{http.StatusNotFound}
+			err := PostWebhook(httpServer.Client(), httpServer.URL, []byte("{}"), 3, 0)
+			Expect(err).To(MatchError("Webhook returned 404 Not Found"))
+			Expect(requests).To(Equal(1))
+		})
+	})
+	Describe("SendWebhookNotifications", func() {
+		var (
+			testCluster  *cluster.Cluster
+			testExecutor *testhelper.TestExecutor
+		)
+		BeforeEach(func() {
+			testCluster = testutils.SetDefaultSegmentConfiguration()
+			testExecutor = &testhelper.TestExecutor{}
+			testCluster.Executor = testExecutor
+			operating.System.Getenv = func(key string) string {
+				if key == "HOME" {
+					return "home"
+				}
+				return "gphome"
+			}
+		})
+		It("sends nothing if there is no webhook file", func() {
+			testExecutor.LocalError = os.ErrNotExist
+
+			SendWebhookNotifications(testCluster, "report_file", summary, "")
+			Expect(testExecutor.LocalCommands).To(Equal([]string{"test -f home/gp_webhooks.yaml", "test -f gphome/bin/gp_webhooks.yaml"}))
+		})
+		It("posts to the webhooks whose send_on setting matches the run", func() {
+			requests := make([]string, 0)
+			httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.URL.Path)
+			}))
+			defer httpServer.Close()
+			operating.System.ReadFile = func(filename string) ([]byte, error) {
+				return []byte(`webhooks:
+- url: ` + httpServer.URL + `/failure
+  send_on: failure
+- url: ` + httpServer.URL + `/restore
+  utilities: [gprestore]
+- url: ` + httpServer.URL + `/missing
+  format: irc
+`), nil
+			}
+
+			SendWebhookNotifications(testCluster, "report_file", summary, "")
+			Expect(requests).To(Equal([]string{"/failure"}))
+			Expect(stdout).To(Say("Unable to send webhook notification: Unrecognized webhook format irc"))
+		})
+	})
+})
@@ -0,0 +1,131 @@
+package restore
+
+/*
+ * This file contains functions for --acl-mode, which controls how the
+ * privileges of the restored objects are restored, as the grants of a backup
+ * often name roles that do not exist in the restore database.
+ */
+
+import (
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/pkg/errors"
+)
+
+const (
+	ACL_MODE_REPLACE = "replace"
+	ACL_MODE_SKIP    = "skip"
+	ACL_MODE_MERGE   = "merge"
+)
+
+var restoreDatabaseRoles map[string]bool
+
+func ValidateACLMode(mode string) error {
+	if mode != ACL_MODE_REPLACE && mode != ACL_MODE_SKIP && mode != ACL_MODE_MERGE {
+		return errors.Errorf("Invalid value '%s' for --acl-mode.  Valid values are 'replace', 'skip', and 'merge'.", mode)
+	}
+	return nil
+}
+
+/*
+ * gpbackup writes the privileges of each object as a statement of its own,
+ * revoking the default privileges and then granting those of the object.
+ * Role memberships are also granted with GRANT, but are not privileges on an
+ * object.
+ */
+func IsACLStatement(statement toc.StatementWithType) bool {
+	if statement.ObjectType == "ROLE GRANT" {
+		return false
+	}
+	lines := strings.Split(strings.TrimSpace(statement.Statement), "\n")
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "REVOKE ") && !strings.HasPrefix(line, "GRANT ") {
+			return false
+		}
+	}
+	return len(lines) > 0 && lines[0] != ""
+}
+
+func getGrantee(grant string) string {
+	grantee := grant[strings.LastIndex(grant, " TO ")+len(" TO "):]
+	grantee = strings.TrimSuffix(grantee, ";")
+	return strings.TrimSuffix(grantee, " WITH GRANT OPTION")
+}
+
+/*
+ * With skip, the privilege statements are left out.  With merge, the REVOKE
+ * statements are left out so that the existing privileges of an object are
+ * kept, and grants to roles not in existingRoles are left out, as they would
+ * fail; each grant left out is returned.  With replace, the statements are
+ * restored as they were backed up.
+ */
+func EditStatementsForACLMode(statements []toc.StatementWithType, mode string, existingRoles map[string]bool) ([]toc.StatementWithType, []string) {
+	skippedGrants := make([]string, 0)
+	if mode == ACL_MODE_REPLACE {
+		return statements, skippedGrants
+	}
+	editedStatements := make([]toc.StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		if !IsACLStatement(statement) {
+			editedStatements = append(editedStatements, statement)
+			continue
+		}
+		if mode == ACL_MODE_SKIP {
+			continue
+		}
+		grants := make([]string, 0)
+		for _, line := range strings.Split(strings.TrimSpace(statement.Statement), "\n") {
+			if strings.HasPrefix(line, "REVOKE ") {
+				continue
+			}
+			if grantee := getGrantee(line); grantee != "PUBLIC" && !existingRoles[grantee] {
+				skippedGrants = append(skippedGrants, line)
+				continue
+			}
+			grants = append(grants, line)
+		}
+		if len(grants) > 0 {
+			statement.Statement = "\n\n" + strings.Join(grants, "\n")
+			editedStatements = append(editedStatements, statement)
+		}
+	}
+	return editedStatements, skippedGrants
+}
+
+func GetRestoreDatabaseRoles(connectionPool *dbconn.DBConn) (map[string]bool, error) {
+	roles := make([]string, 0)
+	err := connectionPool.Select(&roles, "SELECT quote_ident(rolname) AS string FROM pg_roles")
+	if err != nil {
+		return nil, err
+	}
+	existingRoles := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		existingRoles[role] = true
+	}
+	return existingRoles, nil
+}
+
+/*
+ * The roles are looked up once, when the privileges are first restored, so
+ * that the roles restored with --with-globals are included.
+ */
+func editStatementsForACLMode(statements []toc.StatementWithType) []toc.StatementWithType {
+	mode := MustGetFlagString(options.ACL_MODE)
+	if mode == ACL_MODE_MERGE && restoreDatabaseRoles == nil {
+		var err error
+		restoreDatabaseRoles, err = GetRestoreDatabaseRoles(connectionPool)
+		gplog.FatalOnError(err)
+	}
+	statements, skippedGrants := EditStatementsForACLMode(statements, mode, restoreDatabaseRoles)
+	if len(skippedGrants) > 0 {
+		gplog.Warn("Skipping %d grant(s) to roles that do not exist in the restore database", len(skippedGrants))
+		for _, grant := range skippedGrants {
+			gplog.Verbose("Skipping grant: %s", grant)
+		}
+	}
+	return statements
+}
@@ -0,0 +1,85 @@
+package restore_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/acl tests", func() {
+	tableStatement := toc.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (i integer);"}
+	aclStatement := toc.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: `
+
+REVOKE ALL ON TABLE public.foo FROM PUBLIC;
+REVOKE ALL ON TABLE public.foo FROM testrole;
+GRANT ALL ON TABLE public.foo TO testrole;
+GRANT SELECT ON TABLE public.foo TO "Missing Role" WITH GRANT OPTION;
+GRANT SELECT ON TABLE public.foo TO PUBLIC;`}
+	roleGrantStatement := toc.StatementWithType{Name: "testrole", ObjectType: "ROLE GRANT", Statement: "\n\nGRANT admins TO testrole;"}
+	statements := []toc.StatementWithType{tableStatement, aclStatement, roleGrantStatement}
+
+	Describe("ValidateACLMode", func() {
+		It("accepts the valid modes", func() {
+			for _, mode := range []string{"replace", "skip", "merge"} {
+				Expect(restore.ValidateACLMode(mode)).To(Succeed())
+			}
+		})
+		It("rejects an invalid mode", func() {
+			Expect(restore.ValidateACLMode("keep")).To(MatchError("Invalid value 'keep' for --acl-mode.  Valid values are 'replace', 'skip', and 'merge'."))
+		})
+	})
+	Describe("IsACLStatement", func() {
+		It("identifies the privilege statements of an object", func() {
+			Expect(restore.IsACLStatement(aclStatement)).To(BeTrue())
+			Expect(restore.IsACLStatement(tableStatement)).To(BeFalse())
+			Expect(restore.IsACLStatement(roleGrantStatement)).To(BeFalse())
+		})
+	})
+	Describe("EditStatementsForACLMode", func() {
+		existingRoles := map[string]bool{"testrole": true}
+		It("restores the privileges as backed up with replace", func() {
+			edited, skipped := restore.EditStatementsForACLMode(statements, "replace", existingRoles)
+
+			Expect(edited).To(Equal(statements))
+			Expect(skipped).To(BeEmpty())
+		})
+		It("leaves out the privileges with skip", func() {
+			edited, skipped := restore.EditStatementsForACLMode(statements, "skip", existingRoles)
+
+			Expect(edited).To(Equal([]toc.StatementWithType{tableStatement, roleGrantStatement}))
+			Expect(skipped).To(BeEmpty())
+		})
+		It("keeps only the grants to existing roles with merge", func() {
+			edited, skipped := restore.EditStatementsForACLMode(statements, "merge", existingRoles)
+
+			Expect(edited).To(HaveLen(3))
+			Expect(edited[1].Statement).To(Equal(`
+
+GRANT ALL ON TABLE public.foo TO testrole;
+GRANT SELECT ON TABLE public.foo TO PUBLIC;`))
+			Expect(skipped).To(Equal([]string{`GRANT SELECT ON TABLE public.foo TO "Missing Role" WITH GRANT OPTION;`}))
+		})
+		It("leaves out a privilege statement with no grants left with merge", func() {
+			otherACLStatement := toc.StatementWithType{Schema: "public", Name: "bar", ObjectType: "VIEW", Statement: "\n\nREVOKE ALL ON public.bar FROM PUBLIC;\nGRANT SELECT ON public.bar TO otherrole;"}
+
+			edited, skipped := restore.EditStatementsForACLMode([]toc.StatementWithType{tableStatement, otherACLStatement}, "merge", existingRoles)
+
+			Expect(edited).To(Equal([]toc.StatementWithType{tableStatement}))
+			Expect(skipped).To(Equal([]string{"GRANT SELECT ON public.bar TO otherrole;"}))
+		})
+	})
+	Describe("GetRestoreDatabaseRoles", func() {
+		It("returns the quoted names of the roles", func() {
+			mock.ExpectQuery(`SELECT quote_ident\(rolname\) AS string FROM pg_roles`).WillReturnRows(
+				sqlmock.NewRows([]string{"string"}).AddRow("testrole").AddRow(`"Test Role"`))
+
+			roles, err := restore.GetRestoreDatabaseRoles(connectionPool)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(roles).To(Equal(map[string]bool{"testrole": true, `"Test Role"`: true}))
+		})
+	})
+})
@@ -0,0 +1,174 @@
+package restore
+
+/*
+ * This file contains structs and functions for varying the number of
+ * connections that run statements at once with the load on the restore
+ * database, when --jobs-min and --jobs-max are used instead of --jobs.
+ */
+
+import (
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+)
+
+/*
+ * Workers acquire a slot before taking a statement and release it once the
+ * statement completes, and no more than limit slots may be held at once.  The
+ * limit starts at the minimum and is adjusted after each window of statements
+ * by the worker that completes it, using that worker's idle connection to
+ * check for sessions waiting in the restore database.
+ */
+type adaptiveScheduler struct {
+	minJobs     int
+	maxJobs     int
+	limit       int
+	running     int
+	closed      bool
+	adjusting   bool
+	baseline    time.Duration
+	windowTotal time.Duration
+	windowCount int
+	lastAdjust  time.Time
+	cond        *sync.Cond
+}
+
+const minAdjustInterval = time.Second
+
+func newAdaptiveScheduler(minJobs int, maxJobs int) *adaptiveScheduler {
+	return &adaptiveScheduler{
+		minJobs:    minJobs,
+		maxJobs:    maxJobs,
+		limit:      minJobs,
+		lastAdjust: time.Now(),
+		cond:       sync.NewCond(&sync.Mutex{}),
+	}
+}
+
+/*
+ * Returns a scheduler if --jobs-min and --jobs-max were used, and nil
+ * otherwise, in which case every connection in the pool is used.
+ */
+func getAdaptiveScheduler() *adaptiveScheduler {
+	if !cmdFlags.Changed(options.JOBS_MAX) {
+		return nil
+	}
+	return newAdaptiveScheduler(MustGetFlagInt(options.JOBS_MIN), MustGetFlagInt(options.JOBS_MAX))
+}
+
+func (scheduler *adaptiveScheduler) acquire() {
+	if scheduler == nil {
+		return
+	}
+	scheduler.cond.L.Lock()
+	defer scheduler.cond.L.Unlock()
+	for scheduler.running >= scheduler.limit && !scheduler.closed {
+		scheduler.cond.Wait()
+	}
+	scheduler.running++
+}
+
+/*
+ * Releases a slot without recording a statement, for a worker that found no
+ * statement to run.
+ */
+func (scheduler *adaptiveScheduler) release() {
+	if scheduler == nil {
+		return
+	}
+	scheduler.cond.L.Lock()
+	scheduler.running--
+	scheduler.cond.L.Unlock()
+	scheduler.cond.Broadcast()
+}
+
+/*
+ * Called once there are no statements left, so that workers waiting for a
+ * slot can find that out and exit.
+ */
+func (scheduler *adaptiveScheduler) close() {
+	if scheduler == nil {
+		return
+	}
+	scheduler.cond.L.Lock()
+	scheduler.closed = true
+	scheduler.cond.L.Unlock()
+	scheduler.cond.Broadcast()
+}
+
+func (scheduler *adaptiveScheduler) releaseAfterStatement(latency time.Duration, whichConn int) {
+	if scheduler == nil {
+		return
+	}
+	scheduler.cond.L.Lock()
+	scheduler.running--
+	scheduler.windowTotal += latency
+	scheduler.windowCount++
+	shouldAdjust := !scheduler.adjusting && !scheduler.closed && scheduler.windowCount >= 2*scheduler.limit &&
+		time.Since(scheduler.lastAdjust) >= minAdjustInterval
+	var windowMean time.Duration
+	if shouldAdjust {
+		scheduler.adjusting = true
+		windowMean = scheduler.windowTotal / time.Duration(scheduler.windowCount)
+		scheduler.windowTotal, scheduler.windowCount = 0, 0
+		if scheduler.baseline == 0 || windowMean < scheduler.baseline {
+			scheduler.baseline = windowMean
+		}
+	}
+	scheduler.cond.L.Unlock()
+	scheduler.cond.Broadcast()
+	if !shouldAdjust {
+		return
+	}
+
+	numWaiting, err := GetNumWaitingSessions(connectionPool, whichConn)
+	if err != nil {
+		gplog.Verbose("Unable to check for waiting sessions: %v", err)
+	}
+	scheduler.cond.L.Lock()
+	latencyRatio := float64(windowMean) / float64(scheduler.baseline)
+	newLimit := AdjustParallelism(scheduler.limit, scheduler.minJobs, scheduler.maxJobs, latencyRatio, numWaiting)
+	if newLimit != scheduler.limit {
+		gplog.Verbose("Changing number of active connections from %d to %d (statement latency %.1fx the lowest observed, %d waiting sessions)",
+			scheduler.limit, newLimit, latencyRatio, numWaiting)
+		scheduler.limit = newLimit
+	}
+	scheduler.lastAdjust = time.Now()
+	scheduler.adjusting = false
+	scheduler.cond.L.Unlock()
+	scheduler.cond.Broadcast()
+}
+
+/*
+ * Halves the number of active connections when statements take more than
+ * twice as long as they did in the fastest window or when more sessions are
+ * waiting than there are active connections, and adds one connection when
+ * statements run at close to their fastest and no sessions are waiting.
+ */
+func AdjustParallelism(current int, minJobs int, maxJobs int, latencyRatio float64, numWaiting int) int {
+	newLimit := current
+	if latencyRatio > 2 || numWaiting > current {
+		newLimit = current / 2
+	} else if latencyRatio < 1.25 && numWaiting == 0 {
+		newLimit = current + 1
+	}
+	if newLimit < minJobs {
+		newLimit = minJobs
+	}
+	if newLimit > maxJobs {
+		newLimit = maxJobs
+	}
+	return newLimit
+}
+
+func GetNumWaitingSessions(connectionPool *dbconn.DBConn, whichConn int) (int, error) {
+	var numWaiting []int
+	err := connectionPool.Select(&numWaiting, "SELECT count(*) FROM pg_stat_activity WHERE waiting = 't'", whichConn)
+	if err != nil || len(numWaiting) == 0 {
+		return 0, err
+	}
+	return numWaiting[0], nil
+}
@@ -0,0 +1,34 @@
+package restore_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gpbackup/restore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/adaptive tests", func() {
+	DescribeTable("AdjustParallelism", func(current int, latencyRatio float64, numWaiting int, expected int) {
+		Expect(restore.AdjustParallelism(current, 2, 8, latencyRatio, numWaiting)).To(Equal(expected))
+	},
+		Entry("adds a connection when statements are fast and nothing is waiting", 4, 1.1, 0, 5),
+		Entry("does not exceed the maximum", 8, 1.0, 0, 8),
+		Entry("halves the connections when statements slow down", 6, 2.5, 0, 3),
+		Entry("halves the connections when more sessions are waiting than are active", 6, 1.0, 7, 3),
+		Entry("does not go below the minimum", 3, 3.0, 0, 2),
+		Entry("keeps the connections when statements are somewhat slower", 4, 1.5, 0, 4),
+		Entry("keeps the connections when a few sessions are waiting", 4, 1.0, 2, 4),
+	)
+	Describe("GetNumWaitingSessions", func() {
+		It("returns the number of waiting sessions", func() {
+			mock.ExpectQuery("SELECT count\\(\\*\\) FROM pg_stat_activity WHERE waiting = 't'").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+			numWaiting, err := restore.GetNumWaitingSessions(connectionPool, 0)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(numWaiting).To(Equal(3))
+		})
+	})
+})
@@ -0,0 +1,113 @@
+package restore
+
+/*
+ * This file contains functions for recording how long ANALYZE took on each
+ * restored table with --run-analyze, for the restore report, and for
+ * --analyze-partition-roots, which analyzes the root partitions of the leaf
+ * partitions whose data was loaded.
+ */
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+const (
+	RUN_ANALYZE_ALL           = "all"
+	RUN_ANALYZE_ROOTPARTITION = "rootpartition"
+
+	// Allows --max-concurrent analyze=N to limit the ANALYZE statements run at once
+	ANALYZE_OBJECT_TYPE = "ANALYZE"
+)
+
+type AnalyzeTiming struct {
+	Table    string
+	Duration time.Duration
+}
+
+var (
+	analyzeTimingsMutex  sync.Mutex
+	loadedLeafPartitions []toc.MasterDataEntry
+	loadedLeafMutex      sync.Mutex
+)
+
+func recordAnalyzeTiming(statement toc.StatementWithType, duration time.Duration) {
+	analyzeTimingsMutex.Lock()
+	defer analyzeTimingsMutex.Unlock()
+	analyzeTimings = append(analyzeTimings, AnalyzeTiming{Table: utils.MakeFQN(statement.Schema, statement.Name), Duration: duration})
+}
+
+/*
+ * Lists the tables with the longest ANALYZE first, as those are the ones
+ * worth looking at when ANALYZE makes the restore take too long.
+ */
+func FormatAnalyzeTimings(timings []AnalyzeTiming) []string {
+	sortedTimings := make([]AnalyzeTiming, len(timings))
+	copy(sortedTimings, timings)
+	sort.SliceStable(sortedTimings, func(i int, j int) bool {
+		return sortedTimings[i].Duration > sortedTimings[j].Duration
+	})
+	lines := make([]string, 0, len(sortedTimings))
+	for _, timing := range sortedTimings {
+		lines = append(lines, fmt.Sprintf("%s: %s", timing.Table, timing.Duration.Round(time.Millisecond)))
+	}
+	return lines
+}
+
+func recordLoadedLeafPartition(entry toc.MasterDataEntry) {
+	loadedLeafMutex.Lock()
+	defer loadedLeafMutex.Unlock()
+	loadedLeafPartitions = append(loadedLeafPartitions, entry)
+}
+
+/*
+ * Returns an ANALYZE ROOTPARTITION statement for the root partition of each
+ * of the leaf partitions, once per root, as the planner uses the statistics
+ * of the root partition for queries on a partitioned table.
+ */
+func getPartitionRootAnalyzeStatements(leafPartitions []toc.MasterDataEntry) []toc.StatementWithType {
+	statements := make([]toc.StatementWithType, 0)
+	isAnalyzed := make(map[string]bool)
+	for _, entry := range leafPartitions {
+		rootFQN := utils.MakeFQN(entry.Schema, entry.PartitionRoot)
+		if entry.PartitionRoot == "" || isAnalyzed[rootFQN] {
+			continue
+		}
+		isAnalyzed[rootFQN] = true
+		statements = append(statements, getAnalyzeStatement(entry.Schema, entry.PartitionRoot, "ANALYZE ROOTPARTITION"))
+	}
+	sort.Slice(statements, func(i int, j int) bool {
+		return statements[i].Statement < statements[j].Statement
+	})
+	return statements
+}
+
+func analyzePartitionRoots() {
+	if wasTerminated {
+		return
+	}
+	statements := getPartitionRootAnalyzeStatements(loadedLeafPartitions)
+	if len(statements) == 0 {
+		gplog.Verbose("No leaf partitions were restored, so there are no root partitions to analyze")
+		return
+	}
+	gplog.Info("Running ANALYZE ROOTPARTITION on %d partitioned table(s)", len(statements))
+	progressBar := utils.NewProgressBar(len(statements), "Root partitions analyzed: ", utils.PB_VERBOSE)
+	progressBar.Start()
+	numErrors := ExecuteStatements(statements, progressBar, connectionPool.NumConns > 1)
+	progressBar.Finish()
+
+	if wasTerminated {
+		gplog.Info("ANALYZE of root partitions incomplete")
+	} else if numErrors > 0 {
+		gplog.Info("ANALYZE of root partitions completed with failures")
+	} else {
+		gplog.Info("ANALYZE of root partitions complete")
+	}
+}
@@ -0,0 +1,346 @@
+package restore
+
+/*
+ * This file contains functions for resolving conflicts between relations in
+ * the backup and relations that already exist in the restore database, as
+ * specified by --on-conflict.
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+const (
+	CONFLICT_SKIP    = "skip"
+	CONFLICT_REPLACE = "replace"
+	CONFLICT_SUFFIX  = "suffix"
+)
+
+var conflictRelationTypes = []string{"TABLE", "FOREIGN TABLE", "VIEW", "MATERIALIZED VIEW", "SEQUENCE"}
+
+type ExistingRelation struct {
+	Name       string
+	ObjectType string
+}
+
+/*
+ * Returns the relations in the given list that exist in the restore database,
+ * along with the object type to use when dropping them.
+ */
+func GetExistingRelations(connectionPool *dbconn.DBConn, relationList []string) ([]ExistingRelation, error) {
+	existingRelations := make([]ExistingRelation, 0)
+	if len(relationList) == 0 {
+		return existingRelations, nil
+	}
+	query := fmt.Sprintf(`
+SELECT
+	quote_ident(n.nspname) || '.' || quote_ident(c.relname) AS name,
+	CASE
+		WHEN c.relkind = 'v' THEN 'VIEW'
+		WHEN c.relkind = 'm' THEN 'MATERIALIZED VIEW'
+		WHEN c.relkind = 'S' THEN 'SEQUENCE'
+		WHEN c.relkind = 'f' THEN 'FOREIGN TABLE'
+		WHEN c.relstorage = 'x' THEN 'EXTERNAL TABLE'
+		ELSE 'TABLE'
+	END AS objecttype
+FROM pg_namespace n
+JOIN pg_class c ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'v', 'm', 'S', 'f')
+AND quote_ident(n.nspname) || '.' || quote_ident(c.relname) IN (%s)
+ORDER BY 1`, utils.SliceToQuotedString(relationList))
+	err := connectionPool.Select(&existingRelations, query)
+	return existingRelations, err
+}
+
+/*
+ * Appends the suffix to an identifier, keeping it inside the quotes if the
+ * identifier is quoted.
+ */
+func AddSuffixToIdentifier(ident string, suffix string) string {
+	if len(ident) > 1 && strings.HasPrefix(ident, `"`) && strings.HasSuffix(ident, `"`) {
+		return ident[:len(ident)-1] + suffix + `"`
+	}
+	return ident + suffix
+}
+
+func addSuffixToFQN(fqn string, suffix string) string {
+	schemaAndName := strings.SplitN(fqn, ".", 2)
+	return utils.MakeFQN(schemaAndName[0], AddSuffixToIdentifier(schemaAndName[1], suffix))
+}
+
+/*
+ * Determines which of the relations to be restored already exist in the
+ * restore database and resolves each conflict according to the policy: skip
+ * restoring the relation, drop the existing relation, or restore the relation
+ * under a new name.  Indexes on renamed tables are renamed as well, as index
+ * names must be unique within a schema.
+ */
+func resolveRelationConflicts(metadataFilename string) {
+	policy := MustGetFlagString(options.ON_CONFLICT)
+	if policy == "" || wasTerminated {
+		return
+	}
+	gplog.Info("Checking for relations that already exist in the restore database")
+	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+	statements := GetRestoreMetadataStatementsFiltered("predata", metadataFilename, conflictRelationTypes, []string{}, filters)
+	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	editStatementsForSchemaRenames(statements)
+	incomingRelations := make([]string, 0)
+	for _, statement := range statements {
+		incomingRelations = append(incomingRelations, utils.MakeFQN(statement.Schema, statement.Name))
+	}
+	existingRelations, err := GetExistingRelations(connectionPool, incomingRelations)
+	gplog.FatalOnError(err)
+	if len(existingRelations) == 0 {
+		gplog.Verbose("No relations to be restored already exist in the restore database")
+		return
+	}
+
+	switch policy {
+	case CONFLICT_SKIP:
+		for _, relation := range existingRelations {
+			gplog.Verbose("Skipping relation %s, as it already exists", relation.Name)
+			skippedRelations[relation.Name] = Empty{}
+			relationConflicts = append(relationConflicts, fmt.Sprintf("%s: skipped", relation.Name))
+		}
+		resolveLeafPartitionConflicts()
+		gplog.Info("Skipping %d relation(s) that already exist in the restore database", len(existingRelations))
+	case CONFLICT_REPLACE:
+		for _, relation := range existingRelations {
+			gplog.Verbose("Dropping existing relation %s", relation.Name)
+			_, err := connectionPool.Exec(fmt.Sprintf("DROP %s IF EXISTS %s CASCADE", relation.ObjectType, relation.Name))
+			gplog.FatalOnError(err)
+			relationConflicts = append(relationConflicts, fmt.Sprintf("%s: replaced", relation.Name))
+		}
+		gplog.Info("Dropped %d existing relation(s) to be replaced", len(existingRelations))
+	case CONFLICT_SUFFIX:
+		suffix := MustGetFlagString(options.CONFLICT_SUFFIX)
+		newNames := make([]string, 0)
+		for _, relation := range existingRelations {
+			newName := addSuffixToFQN(relation.Name, suffix)
+			renamedRelations[relation.Name] = newName
+			newNames = append(newNames, newName)
+			relationConflicts = append(relationConflicts, fmt.Sprintf("%s: restored as %s", relation.Name, newName))
+		}
+		collisions, err := GetExistingRelations(connectionPool, newNames)
+		gplog.FatalOnError(err)
+		if len(collisions) > 0 {
+			gplog.Fatal(nil, "Cannot restore conflicting relations with suffix %s, as relation %s already exists", suffix, collisions[0].Name)
+		}
+		resolveLeafPartitionConflicts()
+		indexStatements := GetRestoreMetadataStatementsFiltered("postdata", metadataFilename, []string{"INDEX"}, []string{}, filters)
+		editStatementsRedirectSchema(indexStatements, opts.RedirectSchema)
+		editStatementsForSchemaRenames(indexStatements)
+		for _, statement := range indexStatements {
+			if _, ok := renamedRelations[statement.ReferenceObject]; ok {
+				indexFQN := utils.MakeFQN(statement.Schema, statement.Name)
+				renamedRelations[indexFQN] = addSuffixToFQN(indexFQN, suffix)
+			}
+		}
+		gplog.Info("Restoring %d conflicting relation(s) with suffix %s", len(existingRelations), suffix)
+	}
+}
+
+/*
+ * Removes the statements for skipped relations and the objects that depend on
+ * them, and substitutes the new names of renamed relations into the rest.
+ */
+func editStatementsForConflicts(statements []toc.StatementWithType) []toc.StatementWithType {
+	if len(skippedRelations) == 0 && len(renamedRelations) == 0 {
+		return statements
+	}
+	renamePattern := getRenamePattern()
+	suffix := MustGetFlagString(options.CONFLICT_SUFFIX)
+	editedStatements := make([]toc.StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		fqn := utils.MakeFQN(statement.Schema, statement.Name)
+		if _, ok := skippedRelations[fqn]; ok && isConflictRelationStatement(statement) {
+			continue
+		}
+		if _, ok := skippedRelations[statement.ReferenceObject]; ok {
+			continue
+		}
+		if renamePattern != nil {
+			newFQN, isRenamed := renamedRelations[fqn]
+			_, isReferenceRenamed := renamedRelations[statement.ReferenceObject]
+			switch {
+			case statement.ObjectType == "INDEX" && isRenamed:
+				oldIndex := fmt.Sprintf("INDEX %s ON ", statement.Name)
+				statement.Name = strings.SplitN(newFQN, ".", 2)[1]
+				statement.Statement = strings.Replace(statement.Statement, oldIndex, fmt.Sprintf("INDEX %s ON ", statement.Name), 1)
+			case statement.ObjectType == "CONSTRAINT" && isReferenceRenamed:
+				oldConstraint := fmt.Sprintf("CONSTRAINT %s ", statement.Name)
+				statement.Name = AddSuffixToIdentifier(statement.Name, suffix)
+				statement.Statement = strings.Replace(statement.Statement, oldConstraint, fmt.Sprintf("CONSTRAINT %s ", statement.Name), -1)
+			case isRenamed && isConflictRelationStatement(statement):
+				statement.Name = strings.SplitN(newFQN, ".", 2)[1]
+			}
+			if isReferenceRenamed {
+				statement.ReferenceObject = renamedRelations[statement.ReferenceObject]
+			}
+			statement.Statement = replaceRelationNames(statement.Statement, renamePattern)
+		}
+		editedStatements = append(editedStatements, statement)
+	}
+	return editedStatements
+}
+
+func isConflictRelationStatement(statement toc.StatementWithType) bool {
+	return utils.Exists(conflictRelationTypes, statement.ObjectType) || statement.ObjectType == "STATISTICS" || statement.ObjectType == "SEQUENCE OWNER"
+}
+
+/*
+ * Returns a pattern matching the old name of any renamed relation, trying
+ * longer names first so that a name is not matched by a prefix of itself.
+ */
+func getRenamePattern() *regexp.Regexp {
+	if len(renamedRelations) == 0 {
+		return nil
+	}
+	oldNames := make([]string, 0, len(renamedRelations))
+	for oldName := range renamedRelations {
+		oldNames = append(oldNames, oldName)
+	}
+	sort.Slice(oldNames, func(i, j int) bool {
+		if len(oldNames[i]) != len(oldNames[j]) {
+			return len(oldNames[i]) > len(oldNames[j])
+		}
+		return oldNames[i] < oldNames[j]
+	})
+	for i, oldName := range oldNames {
+		oldNames[i] = regexp.QuoteMeta(oldName)
+	}
+	return regexp.MustCompile(strings.Join(oldNames, "|"))
+}
+
+func replaceRelationNames(statement string, renamePattern *regexp.Regexp) string {
+	var result strings.Builder
+	last := 0
+	for _, match := range renamePattern.FindAllStringIndex(statement, -1) {
+		start, end := match[0], match[1]
+		if start > 0 && (isIdentifierChar(statement[start-1]) || statement[start-1] == '.') {
+			continue
+		}
+		if end < len(statement) && isIdentifierChar(statement[end]) {
+			continue
+		}
+		result.WriteString(statement[last:start])
+		result.WriteString(renamedRelations[statement[start:end]])
+		last = end
+	}
+	result.WriteString(statement[last:])
+	return result.String()
+}
+
+func isIdentifierChar(char byte) bool {
+	return char == '_' || char == '$' || char == '"' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char >= 0x80
+}
+
+/*
+ * Returns the name of the table into which the data for the given table in
+ * the backup will be restored, taking --redirect-schema and any renaming due
+ * to conflicts into account.
+ */
+func getRestoreTableFQN(schema string, name string) string {
+	tableFQN := utils.MakeFQN(getRestoreSchema(schema), name)
+	if newFQN, ok := renamedRelations[tableFQN]; ok {
+		return newFQN
+	}
+	if exchangeFQN, ok := exchangeTables[tableFQN]; ok {
+		return exchangeFQN
+	}
+	return tableFQN
+}
+
+/*
+ * Removes the data entries for skipped tables.
+ */
+func editDataEntriesForConflicts(entries []toc.MasterDataEntry) []toc.MasterDataEntry {
+	if len(skippedRelations) == 0 {
+		return entries
+	}
+	editedEntries := make([]toc.MasterDataEntry, 0, len(entries))
+	for _, entry := range entries {
+		schema := getRestoreSchema(entry.Schema)
+		if _, ok := skippedRelations[utils.MakeFQN(schema, entry.Name)]; ok {
+			continue
+		}
+		editedEntries = append(editedEntries, entry)
+	}
+	return editedEntries
+}
+
+/*
+ * Leaf partitions are not restored by statements of their own, so conflicts
+ * are resolved for them along with their root partitions.  The leaf partitions
+ * of a renamed root are given the names the database will generate for them,
+ * which start with the name of the root.
+ */
+func resolveLeafPartitionConflicts() {
+	for _, entry := range globalTOC.DataEntries {
+		if entry.PartitionRoot == "" {
+			continue
+		}
+		schema := getRestoreSchema(entry.Schema)
+		rootFQN := utils.MakeFQN(schema, entry.PartitionRoot)
+		leafFQN := utils.MakeFQN(schema, entry.Name)
+		if _, ok := skippedRelations[rootFQN]; ok {
+			skippedRelations[leafFQN] = Empty{}
+		} else if newRootFQN, ok := renamedRelations[rootFQN]; ok {
+			newRoot := strings.SplitN(newRootFQN, ".", 2)[1]
+			if newLeaf, ok := renameLeafPartition(entry.Name, entry.PartitionRoot, newRoot); ok {
+				renamedRelations[leafFQN] = utils.MakeFQN(schema, newLeaf)
+			}
+		}
+	}
+}
+
+func renameLeafPartition(leafName string, oldRoot string, newRoot string) (string, bool) {
+	unquotedLeaf := utils.UnquoteIdent(leafName)
+	unquotedOldRoot := utils.UnquoteIdent(oldRoot)
+	if !strings.HasPrefix(unquotedLeaf, unquotedOldRoot) {
+		return "", false
+	}
+	newLeaf := utils.UnquoteIdent(newRoot) + strings.TrimPrefix(unquotedLeaf, unquotedOldRoot)
+	if strings.HasPrefix(leafName, `"`) {
+		return fmt.Sprintf(`"%s"`, strings.Replace(newLeaf, `"`, `""`, -1)), true
+	}
+	return newLeaf, true
+}
+
+func writeConflictMapping() {
+	if len(renamedRelations) == 0 {
+		return
+	}
+	mappingFilename := globalFPInfo.GetConflictMappingFilePath(restoreStartTime)
+	gplog.Verbose("Logging renamed relations in %s", mappingFilename)
+	oldNames := make([]string, 0, len(renamedRelations))
+	for oldName := range renamedRelations {
+		oldNames = append(oldNames, oldName)
+	}
+	sort.Strings(oldNames)
+
+	mappingFile, err := os.OpenFile(mappingFilename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	gplog.FatalOnError(err)
+	mappingWriter := bufio.NewWriter(mappingFile)
+	for _, oldName := range oldNames {
+		_, _ = mappingWriter.WriteString(fmt.Sprintf("%s\t%s\n", oldName, renamedRelations[oldName]))
+	}
+	err = mappingWriter.Flush()
+	gplog.FatalOnError(err)
+	err = mappingFile.Close()
+	gplog.FatalOnError(err)
+	err = os.Chmod(mappingFilename, 0444)
+	gplog.FatalOnError(err)
+}
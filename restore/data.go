@@ -6,11 +6,14 @@ package restore
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/toc"
@@ -24,22 +27,9 @@ var (
 	tableDelim = ","
 )
 
-func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttributes string, destinationToRead string, singleDataFile bool, whichConn int) (int64, error) {
+func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttributes string, destinationToRead string, singleDataFile bool, pipeThroughProgram utils.PipeThroughProgram, whichConn int) (int64, error) {
 	whichConn = connectionPool.ValidateConnNum(whichConn)
-	copyCommand := ""
-	readFromDestinationCommand := "cat"
-	customPipeThroughCommand := utils.GetPipeThroughProgram().InputCommand
-
-	if singleDataFile {
-		//helper.go handles compression, so we don't want to set it here
-		customPipeThroughCommand = "cat -"
-	} else if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
-		readFromDestinationCommand = fmt.Sprintf("%s restore_data %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath)
-	}
-
-	copyCommand = fmt.Sprintf("PROGRAM '%s %s | %s'", readFromDestinationCommand, destinationToRead, customPipeThroughCommand)
-
-	query := fmt.Sprintf("COPY %s%s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT;", tableName, tableAttributes, copyCommand, tableDelim)
+	query := GetCopyTableInQuery(tableName, tableAttributes, destinationToRead, singleDataFile, pipeThroughProgram)
 	gplog.Verbose(query)
 	result, err := connectionPool.Exec(query, whichConn)
 	if err != nil {
@@ -56,22 +46,104 @@ func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttribute
 	return numRows, err
 }
 
-func restoreSingleTableData(fpInfo *filepath.FilePathInfo, entry toc.MasterDataEntry, tableName string, whichConn int) error {
+func GetCopyTableInQuery(tableName string, tableAttributes string, destinationToRead string, singleDataFile bool, pipeThroughProgram utils.PipeThroughProgram) string {
+	copyCommand := ""
+	readFromDestinationCommand := "cat"
+	customPipeThroughCommand := pipeThroughProgram.InputCommand
+
+	if singleDataFile {
+		//helper.go handles compression, so we don't want to set it here
+		customPipeThroughCommand = "cat -"
+		if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
+			// The helper creates this file when the data of the table fails checksum verification
+			customPipeThroughCommand = fmt.Sprintf("cat - && test ! -e %s_checksum_error", destinationToRead)
+		}
+	} else if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
+		readFromDestinationCommand = fmt.Sprintf("%s restore_data %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath)
+	} else if backupConfig != nil && backupConfig.Dedup {
+		// gpbackup_helper decompresses each chunk itself
+		readFromDestinationCommand = fmt.Sprintf("%s/bin/gpbackup_helper --dedup-read --content <SEGID> --chunk-dir %s --data-file",
+			operating.System.Getenv("GPHOME"), globalFPInfo.GetChunkDirForCopyCommand())
+		customPipeThroughCommand = "cat -"
+	}
+
+	copyCommand = fmt.Sprintf("PROGRAM '%s %s | %s'", readFromDestinationCommand, destinationToRead, customPipeThroughCommand)
+	if isResizeRestore() {
+		copyCommand = GetResizeCopyProgram(readFromDestinationCommand, destinationToRead, customPipeThroughCommand, backupConfig.SegmentCount, getRestoreSegmentCount())
+	}
+
+	errorHandlingClause := ""
+	if rejectLimitClause, _ := GetSegmentRejectLimitClause(MustGetFlagString(options.SEGMENT_REJECT_LIMIT)); rejectLimitClause != "" {
+		errorHandlingClause = " " + rejectLimitClause
+	}
+
+	return fmt.Sprintf("COPY %s%s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT%s;", tableName, tableAttributes, copyCommand, tableDelim, errorHandlingClause)
+}
+
+/*
+ * Returns the file or pipe from which the data of the table is read and the
+ * program through which it is decompressed.
+ */
+func getTableDataSource(fpInfo *filepath.FilePathInfo, entry toc.MasterDataEntry) (string, utils.PipeThroughProgram) {
+	pipeThroughProgram := utils.GetPipeThroughProgram()
+	if entry.Uncompressed {
+		pipeThroughProgram = utils.NewPipeThroughProgram(false, "", 0)
+	}
 	destinationToRead := ""
 	if backupConfig.SingleDataFile {
 		destinationToRead = fmt.Sprintf("%s_%d", fpInfo.GetSegmentPipePathForCopyCommand(), entry.Oid)
+	} else if backupConfig.Dedup {
+		destinationToRead = fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, filepath.DedupDataFileExtension, false)
 	} else {
-		destinationToRead = fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, utils.GetPipeThroughProgram().Extension, backupConfig.SingleDataFile)
+		destinationToRead = fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, pipeThroughProgram.Extension, backupConfig.SingleDataFile)
 	}
-	numRowsRestored, err := CopyTableIn(connectionPool, tableName, entry.AttributeString, destinationToRead, backupConfig.SingleDataFile, whichConn)
-	if err != nil {
-		return err
+	return destinationToRead, pipeThroughProgram
+}
+
+/*
+ * The data of a table that was split with --split-table-data-larger-than is
+ * read from the files of each of its streams in turn.
+ */
+func getTableDataSources(fpInfo *filepath.FilePathInfo, entry toc.MasterDataEntry) ([]string, utils.PipeThroughProgram) {
+	destinationToRead, pipeThroughProgram := getTableDataSource(fpInfo, entry)
+	if entry.Streams < 2 {
+		return []string{destinationToRead}, pipeThroughProgram
+	}
+	destinationsToRead := make([]string, entry.Streams)
+	for stream := range destinationsToRead {
+		destinationsToRead[stream] = fpInfo.GetTableStreamBackupFilePathForCopyCommand(entry.Oid, stream, pipeThroughProgram.Extension)
+	}
+	return destinationsToRead, pipeThroughProgram
+}
+
+func restoreSingleTableData(fpInfo *filepath.FilePathInfo, entry toc.MasterDataEntry, tableName string, whichConn int) error {
+	destinationsToRead, pipeThroughProgram := getTableDataSources(fpInfo, entry)
+	if isResizeRestore() {
+		err := CheckTableCanBeResized(connectionPool, tableName, whichConn)
+		if err != nil {
+			return err
+		}
+	}
+	var numRowsRestored int64
+	for _, destinationToRead := range destinationsToRead {
+		numRows, err := CopyTableIn(connectionPool, tableName, entry.AttributeString, destinationToRead, backupConfig.SingleDataFile, pipeThroughProgram, whichConn)
+		if err != nil {
+			return err
+		}
+		numRowsRestored += numRows
 	}
 	numRowsBackedUp := entry.RowsCopied
-	err = CheckRowsRestored(numRowsRestored, numRowsBackedUp, tableName)
+	if isRejectLimitRestore() && numRowsRestored < numRowsBackedUp {
+		recordRejectedRows(tableName, numRowsBackedUp-numRowsRestored)
+		numRowsBackedUp = numRowsRestored
+	}
+	err := CheckRowsRestored(numRowsRestored, numRowsBackedUp, tableName)
 	if err != nil {
 		return err
 	}
+	if isResizeRestore() {
+		return RedistributeTableData(connectionPool, tableName, whichConn)
+	}
 	return nil
 }
 
@@ -83,13 +155,64 @@ func CheckRowsRestored(rowsRestored int64, rowsBackedUp int64, tableName string)
 	return nil
 }
 
+func GetTableRowCount(connectionPool *dbconn.DBConn, tableName string, whichConn int) (int64, error) {
+	query := fmt.Sprintf("SELECT count(*) FROM %s;", tableName)
+	var rowCount int64
+	err := connectionPool.Get(&rowCount, query, whichConn)
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("Error counting rows in table %s", tableName))
+	}
+	return rowCount, nil
+}
+
+/*
+ * Returns the data entries with the largest tables first, so that the largest
+ * tables start loading right away instead of being left to run alone at the
+ * end of the restore.  Backups that did not record table sizes are ordered
+ * by row count instead.
+ */
+func SortDataEntriesBySize(dataEntries []toc.MasterDataEntry) []toc.MasterDataEntry {
+	hasSizes := false
+	for _, entry := range dataEntries {
+		if entry.Size > 0 {
+			hasSizes = true
+			break
+		}
+	}
+	sortedEntries := make([]toc.MasterDataEntry, len(dataEntries))
+	copy(sortedEntries, dataEntries)
+	sort.SliceStable(sortedEntries, func(i int, j int) bool {
+		if hasSizes {
+			return sortedEntries[i].Size > sortedEntries[j].Size
+		}
+		return sortedEntries[i].RowsCopied > sortedEntries[j].RowsCopied
+	})
+	return sortedEntries
+}
+
+/*
+ * Tables are loaded largest first, or in the order of the --toc-edit list.
+ * The helpers of a single data file restore read tables in the order of the
+ * oid list, so its entries are never reordered.
+ */
+func getDataEntriesInLoadOrder(dataEntries []toc.MasterDataEntry) []toc.MasterDataEntry {
+	if backupConfig.SingleDataFile {
+		return dataEntries
+	}
+	if tocEditDataTables != nil {
+		return SortDataEntriesByTOCEdit(dataEntries, tocEditDataTables)
+	}
+	return SortDataEntriesBySize(dataEntries)
+}
+
 func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.MasterDataEntry,
-	gucStatements []toc.StatementWithType, dataProgressBar utils.ProgressBar) int32 {
+	gucStatements []toc.StatementWithType, dataProgressBar utils.ProgressBar, byteProgress bool) int32 {
 	totalTables := len(dataEntries)
 	if totalTables == 0 {
 		gplog.Verbose("No data to restore for timestamp = %s", fpInfo.Timestamp)
 		return 0
 	}
+	fpInfo.DataFiles = toc.GetDataFiles(dataEntries)
 
 	if backupConfig.SingleDataFile {
 		gplog.Verbose("Initializing pipes and gpbackup_helper on segments for single data file restore")
@@ -110,6 +233,7 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 		}
 		utils.StartGpbackupHelpers(globalCluster, fpInfo, "--restore-agent", MustGetFlagString(options.PLUGIN_CONFIG), "", MustGetFlagBool(options.ON_ERROR_CONTINUE), isFilter, &wasTerminated)
 	}
+	dataEntries = getDataEntriesInLoadOrder(dataEntries)
 	/*
 	 * We break when an interrupt is received and rely on
 	 * TerminateHangingCopySessions to kill any COPY
@@ -120,42 +244,59 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 	var workerPool sync.WaitGroup
 	var numErrors int32
 	var mutex = &sync.Mutex{}
+	scheduler := getAdaptiveScheduler()
 
 	for i := 0; i < connectionPool.NumConns; i++ {
 		workerPool.Add(1)
 		go func(whichConn int) {
 			defer workerPool.Done()
+			// Workers waiting for a slot must be woken when any worker exits
+			defer scheduler.close()
 
 			setGUCsForConnection(gucStatements, whichConn)
-			for entry := range tasks {
+			for {
+				dataCopyPause.WaitWhilePaused()
+				scheduler.acquire()
+				entry, ok := <-tasks
+				if !ok {
+					scheduler.release()
+					return
+				}
 				if wasTerminated {
+					scheduler.release()
 					dataProgressBar.(*pb.ProgressBar).NotPrint = true
 					return
 				}
-				tableName := utils.MakeFQN(entry.Schema, entry.Name)
-				if opts.RedirectSchema != "" {
-					tableName = utils.MakeFQN(opts.RedirectSchema, entry.Name)
-				}
-				// Truncate table before restore, if needed
+				start := time.Now()
+				tableName := getRestoreTableFQN(entry.Schema, entry.Name)
 				var err error
 				if MustGetFlagBool(options.INCREMENTAL) || MustGetFlagBool(options.TRUNCATE_TABLE) {
-					err = TruncateTable(tableName, whichConn)
-				}
-				if err == nil {
+					err = restoreTruncatedTableData(&fpInfo, entry, tableName, whichConn)
+				} else {
 					err = restoreSingleTableData(&fpInfo, entry, tableName, whichConn)
+				}
+				if err == nil && MustGetFlagBool(options.TABLE_TIMINGS) {
+					recordTableTiming(entry, tableName, time.Since(start))
+				}
+				if err == nil && entry.PartitionRoot != "" {
+					recordLoadedLeafPartition(entry)
+				}
 
-					atomic.AddInt64(&tableNum, 1)
-					if gplog.GetVerbosity() > gplog.LOGINFO {
-						// No progress bar at this log level, so we note table count here
-						gplog.Verbose("Restored data to table %s from file (table %d of %d)", tableName, tableNum, totalTables)
-					} else {
-						gplog.Verbose("Restored data to table %s from file", tableName)
-					}
+				atomic.AddInt64(&tableNum, 1)
+				if gplog.GetVerbosity() > gplog.LOGINFO {
+					// No progress bar at this log level, so we note table count here
+					gplog.Verbose("Restored data to table %s from file (table %d of %d)", tableName, tableNum, totalTables)
+				} else {
+					gplog.Verbose("Restored data to table %s from file", tableName)
 				}
+				scheduler.releaseAfterStatement(time.Since(start), whichConn)
+				recordConnectionBusy(whichConn, time.Since(start), nil)
+				runStatus.AddTableResult(tableName, err)
 
 				if err != nil {
 					gplog.Error(err.Error())
 					atomic.AddInt32(&numErrors, 1)
+					runStatus.AddError()
 					if !MustGetFlagBool(options.ON_ERROR_CONTINUE) {
 						dataProgressBar.(*pb.ProgressBar).NotPrint = true
 						return
@@ -166,6 +307,7 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 					mutex.Lock()
 					errorTablesData[tableName] = Empty{}
 					mutex.Unlock()
+					recordFailedObject(FailedObject{ObjectType: "TABLE DATA", Schema: entry.Schema, Name: entry.Name, Error: err.Error()})
 				}
 
 				if backupConfig.SingleDataFile {
@@ -176,7 +318,14 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 					}
 				}
 
-				dataProgressBar.Increment()
+				if err == nil {
+					runStatus.AddTableCompleted(entry.Size)
+				}
+				if byteProgress {
+					dataProgressBar.Add(int(entry.Size))
+				} else {
+					dataProgressBar.Increment()
+				}
 			}
 		}(i)
 	}
@@ -1,17 +1,25 @@
 package restore_test
 
 import (
+	"errors"
 	"regexp"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/jackc/pgconn"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("restore/data tests", func() {
@@ -26,7 +34,7 @@ var _ = Describe("restore/data tests", func() {
 			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz | gzip -d -c' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, utils.GetPipeThroughProgram(), 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -35,7 +43,7 @@ var _ = Describe("restore/data tests", func() {
 			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.zst | zstd --decompress -c' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.zst"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, utils.GetPipeThroughProgram(), 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -43,7 +51,7 @@ var _ = Describe("restore/data tests", func() {
 			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456 | cat -' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, utils.GetPipeThroughProgram(), 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -51,7 +59,26 @@ var _ = Describe("restore/data tests", func() {
 			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456 | cat -' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, true, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, true, utils.GetPipeThroughProgram(), 0)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("will restore a table with a segment reject limit, logging the rows that cannot be loaded", func() {
+			_ = cmdFlags.Set(options.SEGMENT_REJECT_LIMIT, "5%")
+			defer cmdFlags.Set(options.SEGMENT_REJECT_LIMIT, "")
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456 | cat -' WITH CSV DELIMITER ',' ON SEGMENT LOG ERRORS SEGMENT REJECT LIMIT 5 PERCENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, utils.GetPipeThroughProgram(), 0)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("will fail the table when its data fails checksum verification in a single data file restore using a plugin", func() {
+			_ = cmdFlags.Set(options.PLUGIN_CONFIG, "/tmp/plugin_config")
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456 | cat - && test ! -e <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456_checksum_error' WITH CSV DELIMITER ',' ON SEGMENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456"
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, true, utils.GetPipeThroughProgram(), 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -64,7 +91,7 @@ var _ = Describe("restore/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, utils.GetPipeThroughProgram(), 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -77,7 +104,7 @@ var _ = Describe("restore/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.zst"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, utils.GetPipeThroughProgram(), 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -89,7 +116,7 @@ var _ = Describe("restore/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, utils.GetPipeThroughProgram(), 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -103,7 +130,7 @@ var _ = Describe("restore/data tests", func() {
 			}
 			mock.ExpectExec(execStr).WillReturnError(pgErr)
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, utils.GetPipeThroughProgram(), 0)
 
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("Error loading data into table public.foo: " +
@@ -111,6 +138,113 @@ var _ = Describe("restore/data tests", func() {
 				"ERROR: value of distribution key doesn't belong to segment with ID 0, it belongs to segment with ID 1 (SQLSTATE 22P04)"))
 		})
 	})
+	Describe("CopyTableIn to a cluster with a different number of segments", func() {
+		BeforeEach(func() {
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -1", InputCommand: "gzip -d -c", Extension: ".gz"})
+			backup.SetPluginConfig(nil)
+			_ = cmdFlags.Set(options.PLUGIN_CONFIG, "")
+			restore.SetBackupConfig(&history.BackupConfig{SegmentCount: 4})
+			restore.SetCluster(cluster.NewCluster([]cluster.SegConfig{{ContentID: -1}, {ContentID: 0}, {ContentID: 1}}))
+		})
+		AfterEach(func() {
+			restore.SetBackupConfig(&history.BackupConfig{})
+		})
+		It("reads the file of every backup segment mapped to each restore segment", func() {
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'for segid in $(seq <SEGID> 2 3); do cat /backups/gpseg${segid}/backups/20170101/20170101010101/gpbackup_${segid}_20170101010101_3456.gz | gzip -d -c || exit 1; done' WITH CSV DELIMITER ',' ON SEGMENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "/backups/gpseg<SEGID>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, utils.GetPipeThroughProgram(), 0)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+	Describe("CopyTableIn from a deduplicated backup", func() {
+		BeforeEach(func() {
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -1", InputCommand: "gzip -d -c", Extension: ".gz"})
+			backup.SetPluginConfig(nil)
+			_ = cmdFlags.Set(options.PLUGIN_CONFIG, "")
+			restore.SetBackupConfig(&history.BackupConfig{Dedup: true})
+			restore.SetFPInfo(filepath.NewFilePathInfo(cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, DataDir: "/data/gpseg-1"}}), "", "20170101010101", "gpseg"))
+			operating.System.Getenv = func(key string) string { return "/usr/local/greenplum-db" }
+		})
+		AfterEach(func() {
+			restore.SetBackupConfig(&history.BackupConfig{})
+			operating.InitializeSystemFunctions()
+		})
+		It("reassembles the data of a table from its chunks", func() {
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM '/usr/local/greenplum-db/bin/gpbackup_helper --dedup-read --content <SEGID> --chunk-dir <SEG_DATA_DIR>/backups/chunks --data-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.chunks | cat -' WITH CSV DELIMITER ',' ON SEGMENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.chunks"
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, utils.GetPipeThroughProgram(), 0)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+	Describe("GetResizeCopyProgram", func() {
+		It("replaces the content ID of the backup file when restoring to fewer segments", func() {
+			program := restore.GetResizeCopyProgram("cat", "/backups/gpseg<SEGID>/gpbackup_<SEGID>_3456", "cat -", 8, 3)
+			Expect(program).To(Equal("PROGRAM 'for segid in $(seq <SEGID> 3 7); do cat /backups/gpseg${segid}/gpbackup_${segid}_3456 | cat - || exit 1; done'"))
+		})
+		It("reads at most one file per segment when restoring to more segments", func() {
+			program := restore.GetResizeCopyProgram("cat", "gpbackup_<SEGID>_3456", "cat -", 2, 4)
+			Expect(program).To(Equal("PROGRAM 'for segid in $(seq <SEGID> 4 1); do cat gpbackup_${segid}_3456 | cat - || exit 1; done'"))
+		})
+		It("replaces the content ID in the command reading the file", func() {
+			program := restore.GetResizeCopyProgram("gpbackup_helper --dedup-read --content <SEGID> --chunk-dir /backups/gpseg<SEGID>/backups/chunks --data-file", "/backups/gpseg<SEGID>/gpbackup_<SEGID>_3456", "cat -", 4, 2)
+			Expect(program).To(Equal("PROGRAM 'for segid in $(seq <SEGID> 2 3); do gpbackup_helper --dedup-read --content ${segid} --chunk-dir /backups/gpseg${segid}/backups/chunks --data-file /backups/gpseg${segid}/gpbackup_${segid}_3456 | cat - || exit 1; done'"))
+		})
+	})
+	Describe("ValidateResizeRestore", func() {
+		BeforeEach(func() {
+			restore.SetBackupConfig(&history.BackupConfig{Timestamp: "20170101010101", SegmentCount: 4})
+			restore.SetCluster(cluster.NewCluster([]cluster.SegConfig{{ContentID: -1}, {ContentID: 0}, {ContentID: 1}}))
+		})
+		AfterEach(func() {
+			restore.SetBackupConfig(&history.BackupConfig{})
+		})
+		It("panics without a backup directory that every segment host can read", func() {
+			defer testhelper.ShouldPanicWithMessage("Cannot restore backup 20170101010101, taken on 4 segments, to a cluster with 2 segments without --backup-dir")
+			restore.ValidateResizeRestore()
+		})
+		It("accepts a backup directory", func() {
+			testhelper.SetDBVersion(connectionPool, "6.0.0")
+			_ = cmdFlags.Set(options.BACKUP_DIR, "/backups")
+			restore.ValidateResizeRestore()
+			Expect(logfile).To(Say("Backup was taken on 4 segments; data will be redistributed across 2 segments"))
+		})
+	})
+	Describe("CheckTableCanBeResized", func() {
+		It("returns no error for a table that is not replicated", func() {
+			mock.ExpectQuery("SELECT (.*) FROM gp_distribution_policy").WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow("false"))
+			err := restore.CheckTableCanBeResized(connectionPool, "public.foo", 0)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("returns an error for a replicated table", func() {
+			mock.ExpectQuery("SELECT (.*) FROM gp_distribution_policy").WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow("true"))
+			err := restore.CheckTableCanBeResized(connectionPool, "public.foo", 0)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Cannot restore replicated table public.foo to a cluster with a different number of segments"))
+		})
+	})
+	Describe("RedistributeTableData", func() {
+		It("reorganizes the table", func() {
+			mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE public.foo SET WITH (REORGANIZE=true);")).WillReturnResult(sqlmock.NewResult(0, 0))
+			err := restore.RedistributeTableData(connectionPool, "public.foo", 0)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+	Describe("SortDataEntriesBySize", func() {
+		It("orders the entries largest first, keeping the order of entries of the same size", func() {
+			entries := []toc.MasterDataEntry{{Name: "small", Size: 10}, {Name: "large", Size: 1000}, {Name: "other_small", Size: 10}}
+			sortedEntries := restore.SortDataEntriesBySize(entries)
+			Expect(sortedEntries).To(Equal([]toc.MasterDataEntry{{Name: "large", Size: 1000}, {Name: "small", Size: 10}, {Name: "other_small", Size: 10}}))
+			Expect(entries[0].Name).To(Equal("small"))
+		})
+		It("orders the entries by row count when table sizes were not recorded", func() {
+			entries := []toc.MasterDataEntry{{Name: "few", RowsCopied: 5}, {Name: "many", RowsCopied: 500}}
+			Expect(restore.SortDataEntriesBySize(entries)).To(Equal([]toc.MasterDataEntry{{Name: "many", RowsCopied: 500}, {Name: "few", RowsCopied: 5}}))
+		})
+	})
 	Describe("CheckRowsRestored", func() {
 		var (
 			expectedRows int64 = 10
@@ -126,4 +260,18 @@ var _ = Describe("restore/data tests", func() {
 			Expect(err.Error()).To(Equal("Expected to restore 10 rows to table public.foo, but restored 5 instead"))
 		})
 	})
+	Describe("GetTableRowCount", func() {
+		It("returns the number of rows in the table", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM public.foo;")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+			rowCount, err := restore.GetTableRowCount(connectionPool, "public.foo", 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rowCount).To(Equal(int64(42)))
+		})
+		It("returns an error if the rows cannot be counted", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM public.foo;")).WillReturnError(errors.New("relation does not exist"))
+			_, err := restore.GetTableRowCount(connectionPool, "public.foo", 0)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Error counting rows in table public.foo: relation does not exist"))
+		})
+	})
 })
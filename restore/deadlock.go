@@ -0,0 +1,100 @@
+package restore
+
+/*
+ * This file contains functions for retrying the metadata statements that are
+ * ended by a deadlock when they are run in parallel, such as foreign key
+ * constraints on tables that are referenced by other constraints being added
+ * at the same time.  Such statements are run again serially once the other
+ * statements of the batch are finished, and counted for the restore report.
+ */
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/jackc/pgconn"
+)
+
+const DEADLOCK_DETECTED = "40P01"
+
+var deadlockRetriesMutex sync.Mutex
+
+func IsDeadlockError(err error) bool {
+	pgErr, ok := err.(*pgconn.PgError)
+	return ok && pgErr.Code == DEADLOCK_DETECTED
+}
+
+/*
+ * Collects the statements that were ended by a deadlock while the statements
+ * of a batch run in parallel.
+ */
+type deadlockedStatements struct {
+	counts map[toc.StatementWithType]int
+	mutex  sync.Mutex
+}
+
+func newDeadlockedStatements() *deadlockedStatements {
+	return &deadlockedStatements{counts: make(map[toc.StatementWithType]int)}
+}
+
+func (deadlocked *deadlockedStatements) add(statement toc.StatementWithType) {
+	deadlocked.mutex.Lock()
+	defer deadlocked.mutex.Unlock()
+	deadlocked.counts[statement]++
+}
+
+/*
+ * Returns the deadlocked statements in the order in which they appear in the
+ * batch, so that they are retried in the order in which they were meant to run.
+ */
+func (deadlocked *deadlockedStatements) inOrder(statements []toc.StatementWithType) []toc.StatementWithType {
+	remaining := make(map[toc.StatementWithType]int, len(deadlocked.counts))
+	for statement, count := range deadlocked.counts {
+		remaining[statement] = count
+	}
+	ordered := make([]toc.StatementWithType, 0)
+	for _, statement := range statements {
+		if remaining[statement] > 0 {
+			ordered = append(ordered, statement)
+			remaining[statement]--
+		}
+	}
+	return ordered
+}
+
+func recordDeadlockRetry(statement toc.StatementWithType) {
+	object := statement.Name
+	if statement.Schema != "" {
+		object = utils.MakeFQN(statement.Schema, statement.Name)
+	}
+	deadlockRetriesMutex.Lock()
+	defer deadlockRetriesMutex.Unlock()
+	if deadlockRetries == nil {
+		deadlockRetries = make(map[string]int)
+	}
+	deadlockRetries[fmt.Sprintf("%s %s", statement.ObjectType, object)]++
+}
+
+/*
+ * Lists the number of statements of each object that were retried, in order
+ * of object.
+ */
+func FormatDeadlockRetries(retries map[string]int) []string {
+	objects := make([]string, 0, len(retries))
+	for object := range retries {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+	lines := make([]string, 0, len(objects))
+	for _, object := range objects {
+		statementStr := "statements"
+		if retries[object] == 1 {
+			statementStr = "statement"
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d %s", object, retries[object], statementStr))
+	}
+	return lines
+}
@@ -0,0 +1,39 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/deadlock tests", func() {
+	Describe("IsDeadlockError", func() {
+		It("returns true for a deadlock error", func() {
+			Expect(restore.IsDeadlockError(&pgconn.PgError{Code: "40P01"})).To(BeTrue())
+		})
+		It("returns false for any other database error", func() {
+			Expect(restore.IsDeadlockError(&pgconn.PgError{Code: "42P07"})).To(BeFalse())
+		})
+		It("returns false for an error that is not a database error", func() {
+			Expect(restore.IsDeadlockError(errors.New("deadlock detected"))).To(BeFalse())
+		})
+		It("returns false for no error", func() {
+			Expect(restore.IsDeadlockError(nil)).To(BeFalse())
+		})
+	})
+	Describe("FormatDeadlockRetries", func() {
+		It("lists the retried statements of each object in order of object", func() {
+			retries := map[string]int{"INDEX public.foo_idx": 2, "CONSTRAINT public.foo_fkey": 1}
+			Expect(restore.FormatDeadlockRetries(retries)).To(Equal([]string{
+				"CONSTRAINT public.foo_fkey: 1 statement",
+				"INDEX public.foo_idx: 2 statements",
+			}))
+		})
+		It("returns an empty list if no statements were retried", func() {
+			Expect(restore.FormatDeadlockRetries(nil)).To(BeEmpty())
+		})
+	})
+})
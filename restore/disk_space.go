@@ -0,0 +1,120 @@
+package restore
+
+/*
+ * This file contains functions for checking that the data directories of the
+ * segments have enough free space for the data of a restore before any of it
+ * is restored.
+ */
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Estimates the size of the data restored from a backup from the data size
+ * recorded for the backup and the share of its rows in the restored tables,
+ * as the size of each table is not recorded.  Tables are counted instead of
+ * rows if the backup recorded no rows.
+ */
+func EstimateRestoreDataSize(dataSize int64, backupEntries []toc.MasterDataEntry, restoredEntries []toc.MasterDataEntry) int64 {
+	var backupRows, restoredRows int64
+	for _, entry := range backupEntries {
+		backupRows += entry.RowsCopied
+	}
+	for _, entry := range restoredEntries {
+		restoredRows += entry.RowsCopied
+	}
+	if backupRows == 0 {
+		if len(backupEntries) == 0 {
+			return 0
+		}
+		backupRows, restoredRows = int64(len(backupEntries)), int64(len(restoredEntries))
+	}
+	return int64(float64(dataSize) * float64(restoredRows) / float64(backupRows))
+}
+
+/*
+ * Returns the data size recorded for each backup in the restore plan, or
+ * false if any of them did not record one, as backups taken before data sizes
+ * were recorded have none.
+ */
+func getRestorePlanDataSizes() (map[string]int64, bool) {
+	dataSizes := map[string]int64{globalFPInfo.Timestamp: backupConfig.DataSize}
+	var backupHistory *history.History
+	historyFilename := globalFPInfo.GetBackupHistoryFilePath()
+	if iohelper.FileExistsAndIsReadable(historyFilename) {
+		backupHistory, _ = history.NewHistory(historyFilename)
+	}
+	for _, entry := range backupConfig.RestorePlan {
+		if entry.Timestamp == globalFPInfo.Timestamp {
+			continue
+		}
+		if backupHistory == nil {
+			return nil, false
+		}
+		planConfig := backupHistory.FindBackupConfig(entry.Timestamp)
+		if planConfig == nil {
+			return nil, false
+		}
+		dataSizes[entry.Timestamp] = planConfig.DataSize
+	}
+	for _, dataSize := range dataSizes {
+		if dataSize <= 0 {
+			return nil, false
+		}
+	}
+	return dataSizes, true
+}
+
+/*
+ * Fails the restore if a filesystem holding the data directories of the
+ * segments on a host cannot fit their share of the data to restore.  The data
+ * is assumed to be spread evenly across the segments, as its distribution in
+ * the restore cluster is only known once it is restored.
+ */
+func checkRestoreDiskSpace() {
+	if MustGetFlagBool(options.SKIP_DISK_SPACE_CHECK) {
+		return
+	}
+	dataSizes, ok := getRestorePlanDataSizes()
+	if !ok {
+		gplog.Verbose("Not checking free space on segment hosts, as the data size of the backup was not recorded")
+		return
+	}
+	var dataSize int64
+	for timestamp, restoredEntries := range getFilteredDataEntries() {
+		fpInfo := GetBackupFPInfoForTimestamp(timestamp)
+		backupEntries := toc.NewTOC(fpInfo.GetTOCFilePath()).DataEntries
+		dataSize += EstimateRestoreDataSize(dataSizes[timestamp], backupEntries, restoredEntries)
+	}
+	if dataSize == 0 {
+		return
+	}
+
+	segments := make([]int, 0, len(globalCluster.ContentIDs))
+	for _, contentID := range globalCluster.ContentIDs {
+		if contentID != -1 {
+			segments = append(segments, contentID)
+		}
+	}
+	required := make(map[int]int64, len(segments))
+	for _, contentID := range segments {
+		required[contentID] = dataSize / int64(len(segments))
+	}
+	freeSpace := utils.GetFreeSpaceOnSegments(globalCluster, func(contentID int) string {
+		return globalCluster.GetDirForContent(contentID)
+	})
+	shortfalls := utils.GetDiskSpaceShortfalls(globalCluster, freeSpace, required)
+	if len(shortfalls) == 0 {
+		gplog.Verbose("Segment hosts have enough free space for the restore")
+		return
+	}
+	gplog.Fatal(errors.Errorf("Segment hosts do not have enough free space for the data to restore, estimated at %s:\n%s\n"+
+		"Free up space or use --%s to restore anyway.", utils.FormatSize(dataSize), utils.FormatDiskSpaceShortfalls(shortfalls), options.SKIP_DISK_SPACE_CHECK), "")
+}
@@ -0,0 +1,31 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/disk_space tests", func() {
+	Describe("EstimateRestoreDataSize", func() {
+		backupEntries := []toc.MasterDataEntry{
+			{Schema: "public", Name: "foo", RowsCopied: 300},
+			{Schema: "public", Name: "bar", RowsCopied: 100},
+		}
+		It("returns the data size of the backup when every table is restored", func() {
+			Expect(restore.EstimateRestoreDataSize(1000, backupEntries, backupEntries)).To(Equal(int64(1000)))
+		})
+		It("returns the share of the data size in the rows of the restored tables", func() {
+			Expect(restore.EstimateRestoreDataSize(1000, backupEntries, backupEntries[1:])).To(Equal(int64(250)))
+		})
+		It("counts tables instead of rows if the backup recorded no rows", func() {
+			emptyEntries := []toc.MasterDataEntry{{Schema: "public", Name: "foo"}, {Schema: "public", Name: "bar"}}
+			Expect(restore.EstimateRestoreDataSize(1000, emptyEntries, emptyEntries[1:])).To(Equal(int64(500)))
+		})
+		It("returns 0 for a backup without data", func() {
+			Expect(restore.EstimateRestoreDataSize(1000, []toc.MasterDataEntry{}, []toc.MasterDataEntry{})).To(Equal(int64(0)))
+		})
+	})
+})
@@ -0,0 +1,210 @@
+package restore
+
+/*
+ * This file contains functions for --dry-run, which writes the statements a
+ * restore would execute and the tables whose data it would load to a file,
+ * without connecting to the restore database or restoring anything.
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Statements are SQL statements, or comments in the case of the data load
+ * plan, in the order the restore would execute them.
+ */
+type RestoreSection struct {
+	Title      string
+	Statements []string
+	// If set, writes the data read by the COPY FROM STDIN statement of the same index
+	CopyData []func(io.Writer) error
+}
+
+func DoDryRun() {
+	SetLoggerVerbosity()
+	restoreStartTime = history.CurrentTimestamp()
+	backupTimestamp := MustGetFlagString(options.TIMESTAMP)
+	gplog.Info("Restore Key = %s", backupTimestamp)
+
+	// A single connection is used to read the cluster configuration and quote names
+	connectionPool = dbconn.NewDBConnFromEnvironment("postgres")
+	connectionPool.MustConnect(1)
+	utils.ValidateGPDBVersionCompatibility(connectionPool)
+	configureS3Storage()
+
+	var err error
+	opts, err = options.NewOptions(cmdFlags)
+	gplog.FatalOnError(err)
+	err = opts.QuoteIncludeRelations(connectionPool)
+	gplog.FatalOnError(err)
+	err = opts.QuoteExcludeRelations(connectionPool)
+	gplog.FatalOnError(err)
+
+	segConfig := cluster.MustGetSegmentConfiguration(connectionPool)
+	globalCluster = cluster.NewCluster(segConfig)
+	segPrefix, err := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), backupTimestamp)
+	gplog.FatalOnError(err)
+	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), backupTimestamp, segPrefix)
+	if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
+		RecoverMetadataFilesUsingPlugin()
+	} else {
+		InitializeBackupConfig()
+	}
+	BackupConfigurationValidation()
+	if retryFile := MustGetFlagString(options.RETRY_FAILED); retryFile != "" {
+		retryObjects, err = ReadFailedObjectsFile(retryFile)
+		gplog.FatalOnError(err)
+	}
+
+	sections := getRestoreSections(getDataLoadPlanSection, nil)
+	dryRunFilename := globalFPInfo.GetDryRunFilePath(restoreStartTime)
+	dryRunFile, err := os.OpenFile(dryRunFilename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	gplog.FatalOnError(err)
+	dryRunWriter := bufio.NewWriter(dryRunFile)
+	err = WriteDryRunPlan(dryRunWriter, backupTimestamp, sections)
+	gplog.FatalOnError(err)
+	err = dryRunWriter.Flush()
+	gplog.FatalOnError(err)
+	err = dryRunFile.Close()
+	gplog.FatalOnError(err)
+	gplog.Info("Restore plan written to %s", dryRunFilename)
+}
+
+/*
+ * Returns the statements of each phase of the restore in the same order as
+ * DoSetup and DoRestore execute them.  The data section is returned by
+ * getDataSection, and is left out if that is nil.  The connectStatements are
+ * placed before the statements run in the restore database.
+ */
+func getRestoreSections(getDataSection func(map[string][]toc.MasterDataEntry) RestoreSection, connectStatements []string) []RestoreSection {
+	metadataFilename := globalFPInfo.GetMetadataFilePath()
+	isDataOnly := backupConfig.DataOnly || MustGetFlagBool(options.DATA_ONLY)
+	isMetadataOnly := backupConfig.MetadataOnly || MustGetFlagBool(options.METADATA_ONLY)
+	isIncremental := MustGetFlagBool(options.INCREMENTAL)
+
+	sections := make([]RestoreSection, 0)
+	addSection := func(title string, statements []toc.StatementWithType) {
+		if isPostgresRestoreScript() {
+			statements = ConvertStatementsForPostgres(statements, getKeptGreenplumSyntax())
+		}
+		sections = append(sections, RestoreSection{Title: title, Statements: getStatementStrings(statements)})
+	}
+	if MustGetFlagBool(options.RESTORE_GLOBALS) || (MustGetFlagBool(options.WITH_GLOBALS) && backupConfig.GlobalsFile) {
+		addSection("Cluster-level global objects", getClusterGlobalStatements())
+	}
+	if MustGetFlagBool(options.WITH_GLOBALS) {
+		addSection("Global objects", getGlobalStatements(metadataFilename))
+	} else if MustGetFlagBool(options.CREATE_DB) {
+		addSection("Database creation", getCreateDatabaseStatements(metadataFilename))
+	}
+	if MustGetFlagBool(options.WITH_GLOBALS) || MustGetFlagBool(options.CREATE_DB) {
+		addSection("Configuration settings", getSettingsStatements(metadataFilename))
+	}
+	if len(connectStatements) > 0 {
+		sections = append(sections, RestoreSection{Title: "Restore database session", Statements: connectStatements})
+	}
+
+	if !isDataOnly && !isIncremental {
+		schemaStatements, statements := getPredataStatements(metadataFilename)
+		addSection("Schemas", schemaStatements)
+		addSection("Pre-data objects", statements)
+	} else if isDataOnly {
+		addSection("Sequence values", getSequenceValueStatements(metadataFilename))
+	}
+
+	filteredDataEntries := make(map[string][]toc.MasterDataEntry)
+	if !isMetadataOnly {
+		filteredDataEntries = getFilteredDataEntries()
+		if getDataSection != nil {
+			sections = append(sections, getDataSection(filteredDataEntries))
+		}
+	}
+
+	if !isDataOnly && !isIncremental {
+		firstBatch, secondBatch, thirdBatch := BatchPostdataStatements(getPostdataStatements(metadataFilename))
+		addSection("Post-data objects", append(append(firstBatch, secondBatch...), thirdBatch...))
+	}
+
+	if MustGetFlagBool(options.WITH_STATS) && backupConfig.WithStatistics {
+		addSection("Query planner statistics", getStatisticsStatements())
+	} else if MustGetFlagString(options.RUN_ANALYZE) != "" && len(filteredDataEntries) > 0 {
+		addSection("ANALYZE", getAnalyzeStatements(filteredDataEntries))
+	}
+	return sections
+}
+
+func getStatementStrings(statements []toc.StatementWithType) []string {
+	statementStrings := make([]string, 0, len(statements))
+	for _, statement := range statements {
+		statementStrings = append(statementStrings, strings.TrimSpace(statement.Statement))
+	}
+	return statementStrings
+}
+
+/*
+ * Returns a comment for each table whose data would be loaded, with the
+ * backup it would be loaded from, in the order the tables would start loading.
+ */
+func GetDataLoadPlan(filteredDataEntries map[string][]toc.MasterDataEntry) []string {
+	plan := make([]string, 0)
+	for _, timestamp := range getSortedTimestamps(filteredDataEntries) {
+		for _, entry := range getDataEntriesInLoadOrder(filteredDataEntries[timestamp]) {
+			plan = append(plan, fmt.Sprintf("-- %s: %d rows from backup %s", getRestoreTableFQN(entry.Schema, entry.Name), entry.RowsCopied, timestamp))
+		}
+	}
+	return plan
+}
+
+func getDataLoadPlanSection(filteredDataEntries map[string][]toc.MasterDataEntry) RestoreSection {
+	return RestoreSection{Title: "Data", Statements: GetDataLoadPlan(filteredDataEntries)}
+}
+
+func getSortedTimestamps(filteredDataEntries map[string][]toc.MasterDataEntry) []string {
+	timestamps := make([]string, 0, len(filteredDataEntries))
+	for timestamp := range filteredDataEntries {
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Strings(timestamps)
+	return timestamps
+}
+
+func WriteDryRunPlan(writer io.Writer, backupTimestamp string, sections []RestoreSection) error {
+	_, _ = fmt.Fprintf(writer, "-- Restore plan for backup %s\n", backupTimestamp)
+	return writeRestoreSections(writer, sections)
+}
+
+func writeRestoreSections(writer io.Writer, sections []RestoreSection) error {
+	for _, section := range sections {
+		_, _ = fmt.Fprintf(writer, "\n-- %s (%d)\n", section.Title, len(section.Statements))
+		for i, statement := range section.Statements {
+			_, err := fmt.Fprintf(writer, "%s\n", statement)
+			if err != nil {
+				return err
+			}
+			if section.CopyData == nil {
+				continue
+			}
+			err = section.CopyData[i](writer)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintln(writer, `\.`)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package restore
+
+import (
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("restore/dry_run tests", func() {
+	BeforeEach(func() {
+		opts = &options.Options{}
+		backupConfig = &history.BackupConfig{}
+	})
+	Describe("GetDataLoadPlan", func() {
+		dataEntries := map[string][]toc.MasterDataEntry{
+			"20170102010101": {{Schema: "public", Name: "foo", RowsCopied: 10}},
+			"20170101010101": {{Schema: "public", Name: "bar", RowsCopied: 20}, {Schema: "other", Name: "baz"}},
+		}
+		It("lists the tables to load from each backup in timestamp order", func() {
+			Expect(GetDataLoadPlan(dataEntries)).To(Equal([]string{
+				"-- public.bar: 20 rows from backup 20170101010101",
+				"-- other.baz: 0 rows from backup 20170101010101",
+				"-- public.foo: 10 rows from backup 20170102010101",
+			}))
+		})
+		It("lists the tables of each backup largest first", func() {
+			sizedEntries := map[string][]toc.MasterDataEntry{
+				"20170101010101": {{Schema: "public", Name: "small", Size: 10}, {Schema: "public", Name: "large", Size: 1000}},
+			}
+			Expect(GetDataLoadPlan(sizedEntries)).To(Equal([]string{
+				"-- public.large: 0 rows from backup 20170101010101",
+				"-- public.small: 0 rows from backup 20170101010101",
+			}))
+		})
+		It("lists the tables in the schema they are redirected to", func() {
+			opts.RedirectSchema = "newschema"
+			Expect(GetDataLoadPlan(dataEntries)).To(ContainElement("-- newschema.foo: 10 rows from backup 20170102010101"))
+		})
+	})
+	Describe("WriteDryRunPlan", func() {
+		It("writes each section with its title and number of statements", func() {
+			buffer := NewBuffer()
+			WriteDryRunPlan(buffer, "20170101010101", []RestoreSection{
+				{Title: "Schemas", Statements: getStatementStrings([]toc.StatementWithType{{Statement: "\n\nCREATE SCHEMA foo;\n"}})},
+				{Title: "Data", Statements: []string{}},
+			})
+			Expect(string(buffer.Contents())).To(Equal(`-- Restore plan for backup 20170101010101
+
+-- Schemas (1)
+CREATE SCHEMA foo;
+
+-- Data (0)
+`))
+		})
+	})
+})
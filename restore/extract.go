@@ -0,0 +1,278 @@
+package restore
+
+/*
+ * This file contains functions for --extract-table, which writes the data of
+ * a single table from a backup to a CSV or Parquet file, reading the backup
+ * files of every segment without connecting to a database, to recover a few
+ * rows or load them into analytics tools.
+ */
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	EXTRACT_FORMAT_CSV     = "csv"
+	EXTRACT_FORMAT_PARQUET = "parquet"
+)
+
+func ValidateExtractFormat(format string) error {
+	if format != EXTRACT_FORMAT_CSV && format != EXTRACT_FORMAT_PARQUET {
+		return errors.Errorf("Invalid value '%s' for --format.  Valid values are '%s' and '%s'.", format, EXTRACT_FORMAT_CSV, EXTRACT_FORMAT_PARQUET)
+	}
+	return nil
+}
+
+func DoExtractTable() {
+	SetLoggerVerbosity()
+	restoreStartTime = history.CurrentTimestamp()
+	backupTimestamp := MustGetFlagString(options.TIMESTAMP)
+	tableName := MustGetFlagString(options.EXTRACT_TABLE)
+	gplog.Info("Extracting data of table %s from backup %s", tableName, backupTimestamp)
+
+	var err error
+	opts, err = options.NewOptions(cmdFlags)
+	gplog.FatalOnError(err)
+	opts.IncludedRelations, err = options.QuoteTableNamesWithoutConnection([]string{tableName})
+	gplog.FatalOnError(err)
+
+	globalCluster = getMasterOnlyCluster()
+	segPrefix, err := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), backupTimestamp)
+	gplog.FatalOnError(err)
+	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), backupTimestamp, segPrefix)
+	readBackupConfig()
+	validateExtractTable()
+	validateBackupMetadata()
+
+	filteredDataEntries := getFilteredDataEntries()
+	dataEntries := make([]toc.MasterDataEntry, 0)
+	for _, timestamp := range getSortedTimestamps(filteredDataEntries) {
+		dataEntries = append(dataEntries, filteredDataEntries[timestamp]...)
+	}
+	if len(dataEntries) == 0 {
+		gplog.Fatal(errors.Errorf("Backup %s has no data for table %s", backupTimestamp, tableName), "")
+	}
+
+	format := MustGetFlagString(options.EXTRACT_FORMAT)
+	fqn := strings.Split(tableName, ".")
+	outputFilename := path.Join(MustGetFlagString(options.EXTRACT_OUTPUT), fmt.Sprintf("%s.%s.%s", fqn[0], fqn[1], format))
+	err = os.MkdirAll(MustGetFlagString(options.EXTRACT_OUTPUT), 0755)
+	gplog.FatalOnError(err)
+	outputFile, err := os.Create(outputFilename)
+	gplog.FatalOnError(err)
+	writer := bufio.NewWriter(outputFile)
+	if format == EXTRACT_FORMAT_PARQUET {
+		err = extractTableToParquet(writer, filteredDataEntries)
+	} else {
+		err = extractTableToCSV(writer, filteredDataEntries)
+	}
+	gplog.FatalOnError(err)
+	err = writer.Flush()
+	gplog.FatalOnError(err)
+	err = outputFile.Close()
+	gplog.FatalOnError(err)
+	gplog.Info("Data of table %s written to %s", tableName, outputFilename)
+}
+
+/*
+ * The data is read from the backup files of every segment of the backup, so
+ * the directories of all segments must be readable under --backup-dir.
+ */
+func validateExtractTable() {
+	if MustGetFlagString(options.BACKUP_DIR) == "" {
+		gplog.Fatal(errors.Errorf("Cannot use --extract-table without --backup-dir"), "")
+	}
+	if backupConfig.MetadataOnly {
+		gplog.Fatal(errors.Errorf("Cannot use --extract-table with a metadata-only backup"), "")
+	}
+	if backupConfig.SingleDataFile {
+		gplog.Fatal(errors.Errorf("Cannot use --extract-table with a backup taken with --single-data-file, as its data is read by gpbackup_helper"), "")
+	}
+	if backupConfig.Dedup {
+		gplog.Fatal(errors.Errorf("Cannot use --extract-table with a backup taken with --dedup"), "")
+	}
+	if backupConfig.SegmentCount == 0 {
+		gplog.Fatal(errors.Errorf("Cannot use --extract-table with a backup that does not record its segment count"), "")
+	}
+}
+
+/*
+ * The data of a backup is already CSV, so it is copied as it is, after a
+ * header line naming the columns.  The data of leaf partitions is written
+ * after one another under the header of the first.
+ */
+func extractTableToCSV(writer io.Writer, filteredDataEntries map[string][]toc.MasterDataEntry) error {
+	headerWritten := false
+	for _, timestamp := range getSortedTimestamps(filteredDataEntries) {
+		fpInfo := GetBackupFPInfoForTimestamp(timestamp)
+		fpInfo.DataFiles = toc.GetDataFiles(filteredDataEntries[timestamp])
+		for _, entry := range filteredDataEntries[timestamp] {
+			if !headerWritten && entry.AttributeString != "" {
+				csvWriter := csv.NewWriter(writer)
+				err := csvWriter.Write(ParseAttributeNames(entry.AttributeString))
+				if err != nil {
+					return err
+				}
+				csvWriter.Flush()
+				headerWritten = true
+			}
+			err := writeTableData(writer, fpInfo, entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * Every column is written as a string, as the backup does not record the
+ * types of the columns in a form that can be read without a database.
+ */
+func extractTableToParquet(writer io.Writer, filteredDataEntries map[string][]toc.MasterDataEntry) error {
+	var parquetWriter *utils.ParquetWriter
+	columns := ""
+	for _, timestamp := range getSortedTimestamps(filteredDataEntries) {
+		fpInfo := GetBackupFPInfoForTimestamp(timestamp)
+		fpInfo.DataFiles = toc.GetDataFiles(filteredDataEntries[timestamp])
+		for _, entry := range filteredDataEntries[timestamp] {
+			if parquetWriter == nil {
+				var err error
+				parquetWriter, err = utils.NewParquetWriter(writer, ParseAttributeNames(entry.AttributeString))
+				if err != nil {
+					return errors.Wrapf(err, "Could not extract data of table %s", utils.MakeFQN(entry.Schema, entry.Name))
+				}
+				columns = entry.AttributeString
+			} else if entry.AttributeString != columns {
+				return errors.Errorf("Cannot write the data of table %s to the same Parquet file as the other partitions, as its columns differ", utils.MakeFQN(entry.Schema, entry.Name))
+			}
+			err := writeTableRows(parquetWriter, fpInfo, entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return parquetWriter.Close()
+}
+
+func writeTableRows(parquetWriter *utils.ParquetWriter, fpInfo filepath.FilePathInfo, entry toc.MasterDataEntry) error {
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeTableData(writer, fpInfo, entry))
+	}()
+	defer reader.Close()
+	bufferedReader := bufio.NewReader(reader)
+	for {
+		record, err := ReadCSVRecord(bufferedReader, tableDelim[0])
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "Could not read data of table %s", utils.MakeFQN(entry.Schema, entry.Name))
+		}
+		err = parquetWriter.WriteRow(record)
+		if err != nil {
+			return errors.Wrapf(err, "Could not write data of table %s", utils.MakeFQN(entry.Schema, entry.Name))
+		}
+	}
+}
+
+/*
+ * Returns the unquoted column names of an attribute string such as
+ * (id,"Name, Full"), which may contain quoted commas.
+ */
+func ParseAttributeNames(attributeString string) []string {
+	attributeString = strings.TrimSuffix(strings.TrimPrefix(attributeString, "("), ")")
+	names := make([]string, 0)
+	if attributeString == "" {
+		return names
+	}
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(attributeString); i++ {
+		switch {
+		case attributeString[i] == '"':
+			inQuotes = !inQuotes
+		case attributeString[i] == ',' && !inQuotes:
+			names = append(names, utils.UnquoteIdent(attributeString[start:i]))
+			start = i + 1
+		}
+	}
+	return append(names, utils.UnquoteIdent(attributeString[start:]))
+}
+
+/*
+ * Reads a record in the CSV form written by COPY, in which a NULL is an
+ * unquoted empty field and an empty string is a quoted one, so a NULL is
+ * returned as a nil value.  Quoted fields may contain the delimiter, quotes
+ * doubled, and newlines.  Returns io.EOF once there are no more records.
+ */
+func ReadCSVRecord(reader *bufio.Reader, delimiter byte) ([]*string, error) {
+	record := make([]*string, 0)
+	field := make([]byte, 0)
+	quoted := false
+	inQuotes := false
+	started := false
+	endField := func() {
+		if quoted || len(field) > 0 {
+			value := string(field)
+			record = append(record, &value)
+		} else {
+			record = append(record, nil)
+		}
+		field = field[:0]
+		quoted = false
+	}
+	for {
+		char, err := reader.ReadByte()
+		if err == io.EOF {
+			if !started {
+				return nil, io.EOF
+			}
+			if inQuotes {
+				return nil, errors.New("Unterminated quoted field at end of data")
+			}
+			endField()
+			return record, nil
+		} else if err != nil {
+			return nil, err
+		}
+		started = true
+		if inQuotes {
+			if char != '"' {
+				field = append(field, char)
+			} else if next, err := reader.Peek(1); err == nil && next[0] == '"' {
+				_, _ = reader.ReadByte()
+				field = append(field, '"')
+			} else {
+				inQuotes = false
+			}
+			continue
+		}
+		switch char {
+		case '"':
+			inQuotes = true
+			quoted = true
+		case delimiter:
+			endField()
+		case '\n':
+			endField()
+			return record, nil
+		default:
+			field = append(field, char)
+		}
+	}
+}
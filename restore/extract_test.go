@@ -0,0 +1,126 @@
+package restore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/klauspost/compress/zstd"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/extract tests", func() {
+	Describe("ValidateExtractFormat", func() {
+		It("accepts the valid formats", func() {
+			Expect(ValidateExtractFormat("csv")).To(Succeed())
+			Expect(ValidateExtractFormat("parquet")).To(Succeed())
+		})
+		It("rejects an invalid format", func() {
+			Expect(ValidateExtractFormat("json")).To(MatchError("Invalid value 'json' for --format.  Valid values are 'csv' and 'parquet'."))
+		})
+	})
+	Describe("ParseAttributeNames", func() {
+		It("returns the unquoted column names", func() {
+			Expect(ParseAttributeNames(`(id,"Name, Full","a""b")`)).To(Equal([]string{"id", "Name, Full", `a"b`}))
+		})
+		It("returns no names for a table without columns", func() {
+			Expect(ParseAttributeNames("")).To(BeEmpty())
+		})
+	})
+	Describe("ReadCSVRecord", func() {
+		readAll := func(data string) [][]*string {
+			reader := bufio.NewReader(strings.NewReader(data))
+			records := make([][]*string, 0)
+			for {
+				record, err := ReadCSVRecord(reader, ',')
+				if err == io.EOF {
+					return records
+				}
+				Expect(err).ToNot(HaveOccurred())
+				records = append(records, record)
+			}
+		}
+		value := func(contents string) *string { return &contents }
+		It("distinguishes NULLs from empty strings", func() {
+			Expect(readAll("1,,\"\"\n")).To(Equal([][]*string{{value("1"), nil, value("")}}))
+		})
+		It("reads quoted fields containing delimiters, quotes, and newlines", func() {
+			Expect(readAll("2,\"x,\ny\"\"z\",w\n3,a,b\n")).To(Equal([][]*string{
+				{value("2"), value("x,\ny\"z"), value("w")},
+				{value("3"), value("a"), value("b")},
+			}))
+		})
+		It("reads a last record without a newline", func() {
+			Expect(readAll("4,d")).To(Equal([][]*string{{value("4"), value("d")}}))
+		})
+		It("returns an error for an unterminated quoted field", func() {
+			_, err := ReadCSVRecord(bufio.NewReader(strings.NewReader("5,\"e")), ',')
+			Expect(err).To(MatchError("Unterminated quoted field at end of data"))
+		})
+	})
+	Describe("extracting the data of a table", func() {
+		var backupDir string
+		writeSegmentFile := func(contentID int, contents string) {
+			dir := path.Join(backupDir, fmt.Sprintf("gpseg%d", contentID), "backups", "20170101", "20170101010101")
+			Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+			file, err := os.Create(path.Join(dir, fmt.Sprintf("gpbackup_%d_20170101010101_2.zst", contentID)))
+			Expect(err).ToNot(HaveOccurred())
+			writer, err := zstd.NewWriter(file)
+			Expect(err).ToNot(HaveOccurred())
+			_, _ = io.WriteString(writer, contents)
+			Expect(writer.Close()).To(Succeed())
+			Expect(file.Close()).To(Succeed())
+		}
+		dataEntries := map[string][]toc.MasterDataEntry{
+			"20170101010101": {{Schema: "public", Name: "foo", Oid: 2, AttributeString: `(i,"J")`}},
+		}
+		BeforeEach(func() {
+			var err error
+			backupDir, err = ioutil.TempDir("", "extract_table")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.MkdirAll(path.Join(backupDir, "gpseg-1", "backups", "20170101", "20170101010101"), 0755)).To(Succeed())
+			_ = cmdFlags.Set(options.BACKUP_DIR, backupDir)
+			globalCluster = cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, Hostname: "localhost"}})
+			backupConfig = &history.BackupConfig{Compressed: true, CompressionType: "zstd", SegmentCount: 2}
+			utils.InitializePipeThroughParameters(true, "zstd", 0)
+			writeSegmentFile(0, "1,a\n")
+			writeSegmentFile(1, "2,\n")
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(backupDir)
+			_ = cmdFlags.Set(options.BACKUP_DIR, "")
+			utils.InitializePipeThroughParameters(false, "", 0)
+		})
+		It("writes the data of every segment as CSV after a header", func() {
+			buffer := &bytes.Buffer{}
+			Expect(extractTableToCSV(buffer, dataEntries)).To(Succeed())
+			Expect(buffer.String()).To(Equal("i,J\n1,a\n2,\n"))
+		})
+		It("writes the data of every segment as Parquet", func() {
+			buffer := &bytes.Buffer{}
+			Expect(extractTableToParquet(buffer, dataEntries)).To(Succeed())
+			contents := buffer.Bytes()
+			Expect(contents[:4]).To(Equal([]byte("PAR1")))
+			Expect(contents[len(contents)-4:]).To(Equal([]byte("PAR1")))
+			Expect(buffer.String()).To(ContainSubstring("\x01\x00\x00\x001\x01\x00\x00\x002"))
+			Expect(buffer.String()).To(ContainSubstring("\x01\x00\x00\x00a"))
+		})
+		It("returns an error if the data of a segment is missing", func() {
+			Expect(os.RemoveAll(path.Join(backupDir, "gpseg1"))).To(Succeed())
+			err := extractTableToParquet(&bytes.Buffer{}, dataEntries)
+			Expect(err).To(MatchError(ContainSubstring("Could not read data of table public.foo")))
+		})
+	})
+})
@@ -0,0 +1,160 @@
+package restore
+
+/*
+ * This file contains structs and functions for recording the objects that
+ * could not be restored with --on-error-continue in a form that other tools
+ * can consume, and for restoring only those objects with --retry-failed.
+ */
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Statement is empty for objects whose data failed to restore.
+ */
+type FailedObject struct {
+	ObjectType      string `json:"object_type"`
+	Schema          string `json:"schema"`
+	Name            string `json:"name"`
+	ReferenceObject string `json:"reference_object,omitempty"`
+	Error           string `json:"error"`
+	Statement       string `json:"statement,omitempty"`
+}
+
+/*
+ * RetryIncludeTables can be passed to gprestore with --include-table to retry
+ * restoring the failed objects, once the cause of the failures is fixed.
+ */
+type FailedObjectsFile struct {
+	FailedObjects      []FailedObject `json:"failed_objects"`
+	RetryIncludeTables []string       `json:"retry_include_tables"`
+}
+
+var failedObjectsMutex = &sync.Mutex{}
+
+func recordFailedObject(failedObject FailedObject) {
+	failedObjectsMutex.Lock()
+	defer failedObjectsMutex.Unlock()
+	failedObjects = append(failedObjects, failedObject)
+}
+
+/*
+ * Returns the tables that must be restored again to retry the failed objects,
+ * which are the failed tables and views themselves and the tables that other
+ * failed objects, such as indexes and constraints, belong to.
+ */
+func GetRetryIncludeTables(failedObjects []FailedObject) []string {
+	tableSet := make(map[string]bool)
+	for _, failedObject := range failedObjects {
+		isMetadata := strings.HasSuffix(failedObject.ObjectType, " METADATA")
+		objectType := strings.TrimSuffix(failedObject.ObjectType, " METADATA")
+		switch {
+		case objectType == "TABLE" || objectType == "TABLE DATA" || objectType == "VIEW" ||
+			objectType == "MATERIALIZED VIEW" || objectType == "SEQUENCE":
+			tableSet[utils.MakeFQN(failedObject.Schema, failedObject.Name)] = true
+		case failedObject.ReferenceObject != "" && !isMetadata:
+			// The reference object of a metadata entry is the object itself
+			tableSet[failedObject.ReferenceObject] = true
+		}
+	}
+	tables := make([]string, 0, len(tableSet))
+	for table := range tableSet {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+func writeFailedObjects() {
+	if len(failedObjects) == 0 {
+		return
+	}
+	failedObjectsFilename := globalFPInfo.GetFailedObjectsFilePath(restoreStartTime)
+	contents, err := json.MarshalIndent(FailedObjectsFile{
+		FailedObjects:      failedObjects,
+		RetryIncludeTables: GetRetryIncludeTables(failedObjects),
+	}, "", "  ")
+	gplog.FatalOnError(err)
+	failedObjectsFile, err := os.OpenFile(failedObjectsFilename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	gplog.FatalOnError(err)
+	_, err = failedObjectsFile.Write(append(contents, '\n'))
+	gplog.FatalOnError(err)
+	err = failedObjectsFile.Close()
+	gplog.FatalOnError(err)
+	err = os.Chmod(failedObjectsFilename, 0444)
+	gplog.FatalOnError(err)
+	gplog.Info("%d objects failed to restore; they are listed in %s", len(failedObjects), failedObjectsFilename)
+}
+
+func ReadFailedObjectsFile(filename string) ([]FailedObject, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	failedObjectsFile := FailedObjectsFile{}
+	err = json.Unmarshal(contents, &failedObjectsFile)
+	if err != nil {
+		return nil, errors.Errorf("Unable to parse failed objects file %s: %v", filename, err)
+	}
+	if len(failedObjectsFile.FailedObjects) == 0 {
+		return nil, errors.Errorf("Failed objects file %s does not list any failed objects", filename)
+	}
+	return failedObjectsFile.FailedObjects, nil
+}
+
+/*
+ * Failed statements are recorded after their schemas have been redirected
+ * and their names changed for conflicts, so statements must be compared with
+ * them after the same edits have been made, using the same restore options.
+ */
+func FilterRetryStatements(statements []toc.StatementWithType, retryObjects []FailedObject) []toc.StatementWithType {
+	retrySet := make(map[toc.StatementWithType]bool)
+	for _, object := range retryObjects {
+		retrySet[toc.StatementWithType{ObjectType: object.ObjectType, Schema: object.Schema, Name: object.Name, ReferenceObject: object.ReferenceObject}] = true
+	}
+	filteredStatements := make([]toc.StatementWithType, 0)
+	for _, statement := range statements {
+		key := toc.StatementWithType{ObjectType: statement.ObjectType, Schema: statement.Schema, Name: statement.Name, ReferenceObject: statement.ReferenceObject}
+		if retrySet[key] {
+			filteredStatements = append(filteredStatements, statement)
+		}
+	}
+	return filteredStatements
+}
+
+func FilterRetryDataEntries(entries []toc.MasterDataEntry, retryObjects []FailedObject) []toc.MasterDataEntry {
+	retrySet := make(map[string]bool)
+	for _, object := range retryObjects {
+		if object.ObjectType == "TABLE DATA" {
+			retrySet[utils.MakeFQN(object.Schema, object.Name)] = true
+		}
+	}
+	filteredEntries := make([]toc.MasterDataEntry, 0)
+	for _, entry := range entries {
+		if retrySet[utils.MakeFQN(entry.Schema, entry.Name)] {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	return filteredEntries
+}
+
+/*
+ * Restricts the statements to the failed objects being retried, if any.
+ */
+func filterStatementsForRetry(statements []toc.StatementWithType) []toc.StatementWithType {
+	if retryObjects == nil {
+		return statements
+	}
+	return FilterRetryStatements(statements, retryObjects)
+}
@@ -0,0 +1,91 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/failed_objects tests", func() {
+	Describe("GetRetryIncludeTables", func() {
+		It("returns the failed tables, views, and sequences", func() {
+			failedObjects := []restore.FailedObject{
+				{ObjectType: "TABLE", Schema: "public", Name: "foo"},
+				{ObjectType: "VIEW", Schema: "public", Name: "myview"},
+				{ObjectType: "SEQUENCE", Schema: "public", Name: "myseq"},
+				{ObjectType: "TABLE DATA", Schema: "public", Name: "bar"},
+			}
+
+			Expect(restore.GetRetryIncludeTables(failedObjects)).To(Equal([]string{"public.bar", "public.foo", "public.myseq", "public.myview"}))
+		})
+		It("returns the tables that failed postdata objects belong to", func() {
+			failedObjects := []restore.FailedObject{
+				{ObjectType: "INDEX", Schema: "public", Name: "foo_idx", ReferenceObject: "public.foo"},
+				{ObjectType: "TRIGGER", Schema: "public", Name: "foo_trigger", ReferenceObject: "public.foo"},
+			}
+
+			Expect(restore.GetRetryIncludeTables(failedObjects)).To(Equal([]string{"public.foo"}))
+		})
+		It("returns tables for failed table metadata but not for other failed metadata", func() {
+			failedObjects := []restore.FailedObject{
+				{ObjectType: "TABLE METADATA", Schema: "public", Name: "foo"},
+				{ObjectType: "INDEX METADATA", Schema: "public", Name: "foo_idx", ReferenceObject: "public.foo_idx"},
+				{ObjectType: "FUNCTION", Schema: "public", Name: "myfunc"},
+			}
+
+			Expect(restore.GetRetryIncludeTables(failedObjects)).To(Equal([]string{"public.foo"}))
+		})
+	})
+	Describe("ReadFailedObjectsFile", func() {
+		AfterEach(func() {
+			operating.InitializeSystemFunctions()
+		})
+		It("reads the failed objects listed in the file", func() {
+			operating.System.ReadFile = func(filename string) ([]byte, error) {
+				return []byte(`{
+  "failed_objects": [
+    {"object_type": "INDEX", "schema": "public", "name": "foo_idx", "reference_object": "public.foo", "error": "out of memory", "statement": "CREATE INDEX foo_idx ON public.foo USING btree (i);"}
+  ],
+  "retry_include_tables": ["public.foo"]
+}`), nil
+			}
+
+			failedObjects, err := restore.ReadFailedObjectsFile("/tmp/failed_objects.json")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(failedObjects).To(Equal([]restore.FailedObject{{ObjectType: "INDEX", Schema: "public", Name: "foo_idx", ReferenceObject: "public.foo",
+				Error: "out of memory", Statement: "CREATE INDEX foo_idx ON public.foo USING btree (i);"}}))
+		})
+		It("returns an error for a file that lists no failed objects", func() {
+			operating.System.ReadFile = func(filename string) ([]byte, error) {
+				return []byte(`{"failed_objects": [], "retry_include_tables": []}`), nil
+			}
+
+			_, err := restore.ReadFailedObjectsFile("/tmp/failed_objects.json")
+
+			Expect(err).To(MatchError("Failed objects file /tmp/failed_objects.json does not list any failed objects"))
+		})
+	})
+	Describe("FilterRetryStatements", func() {
+		It("keeps only the statements of the failed objects", func() {
+			table := toc.StatementWithType{ObjectType: "TABLE", Schema: "public", Name: "foo", Statement: "CREATE TABLE public.foo (i int);"}
+			index := toc.StatementWithType{ObjectType: "INDEX", Schema: "public", Name: "foo_idx", ReferenceObject: "public.foo", Statement: "CREATE INDEX foo_idx ON public.foo USING btree (i);"}
+			otherIndex := toc.StatementWithType{ObjectType: "INDEX", Schema: "public", Name: "bar_idx", ReferenceObject: "public.bar", Statement: "CREATE INDEX bar_idx ON public.bar USING btree (i);"}
+			failedObjects := []restore.FailedObject{{ObjectType: "INDEX", Schema: "public", Name: "foo_idx", ReferenceObject: "public.foo"}}
+
+			Expect(restore.FilterRetryStatements([]toc.StatementWithType{table, index, otherIndex}, failedObjects)).To(Equal([]toc.StatementWithType{index}))
+		})
+	})
+	Describe("FilterRetryDataEntries", func() {
+		It("keeps only the data entries of tables whose data failed to restore", func() {
+			foo := toc.MasterDataEntry{Schema: "public", Name: "foo", Oid: 1}
+			bar := toc.MasterDataEntry{Schema: "public", Name: "bar", Oid: 2}
+			failedObjects := []restore.FailedObject{{ObjectType: "TABLE DATA", Schema: "public", Name: "bar"}, {ObjectType: "TABLE", Schema: "public", Name: "foo"}}
+
+			Expect(restore.FilterRetryDataEntries([]toc.MasterDataEntry{foo, bar}, failedObjects)).To(Equal([]toc.MasterDataEntry{bar}))
+		})
+	})
+})
@@ -1,6 +1,7 @@
 package restore
 
 import (
+	"os"
 	"sync"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
@@ -8,6 +9,7 @@ import (
 	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/spf13/pflag"
@@ -35,11 +37,37 @@ var (
 	globalTOC           *toc.TOC
 	pluginConfig        *utils.PluginConfig
 	restoreStartTime    string
+	runStatus           *utils.StatusTracker
+	dataCopyPause       *utils.DataCopyPause
+	logLevelControl     *utils.LogLevelControl
+	autoJobs            int
 	version             string
 	wasTerminated       bool
 	errorTablesMetadata map[string]Empty
 	errorTablesData     map[string]Empty
+	failedObjects       []FailedObject
+	retryObjects        []FailedObject
+	tocEditDataTables   map[string]int
+	rowCountMismatches  []string
+	relationConflicts   []string
+	excludedObjects     []string
+	dataExcludedTables  []string
+	skippedRelations    map[string]Empty
+	renamedRelations    map[string]string
+	exchangeTables      map[string]string
+	objectCounts        map[string]int
 	opts                *options.Options
+	slaTargets          *report.SLATargets
+	slaViolations       []string
+	analyzeTimings      []AnalyzeTiming
+	deadlockRetries     map[string]int
+	sequenceChanges     []string
+	tableTimings        []report.TableTiming
+	restoreTimings      report.RestoreTimings
+	transformers        []StatementTransformer
+	transformChanges    []TransformedStatement
+	s3PluginConfigFile  string
+	machineOutput       *os.File
 	/*
 	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
 	 * and then wait for at least one DoCleanup to finish, either in DoTeardown
@@ -52,6 +80,10 @@ func init() {
 	// Initialize global variables
 	errorTablesMetadata = make(map[string]Empty)
 	errorTablesData = make(map[string]Empty)
+	skippedRelations = make(map[string]Empty)
+	renamedRelations = make(map[string]string)
+	exchangeTables = make(map[string]string)
+	objectCounts = make(map[string]int)
 }
 
 /*
@@ -68,6 +100,10 @@ func SetCmdFlags(flagSet *pflag.FlagSet) {
 	options.SetRestoreFlagDefaults(cmdFlags)
 }
 
+func SetStatementTransformers(statementTransformers []StatementTransformer) {
+	transformers = statementTransformers
+}
+
 func SetBackupConfig(config *history.BackupConfig) {
 	backupConfig = config
 }
@@ -114,6 +150,10 @@ func MustGetFlagStringArray(flagName string) []string {
 	return options.MustGetFlagStringArray(cmdFlags, flagName)
 }
 
+func MustGetFlagStringToInt(flagName string) map[string]int {
+	return options.MustGetFlagStringToInt(cmdFlags, flagName)
+}
+
 func GetVersion() string {
 	return version
 }
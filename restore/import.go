@@ -0,0 +1,130 @@
+package restore
+
+/*
+ * This file contains functions for --import-table, which loads the data of a
+ * table from CSV files, such as those written by --extract-table or exported
+ * by another tool, to repair a single table without restoring a backup.  The
+ * files are loaded in parallel on the restore connections as the data of a
+ * backup is.
+ */
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+// The placeholder Greenplum replaces with the content id of each segment
+const segmentIDPlaceholder = "<SEGID>"
+
+func DoImportTable() {
+	SetLoggerVerbosity()
+	utils.SetProgressMode(MustGetFlagString(options.PROGRESS))
+	restoreStartTime = history.CurrentTimestamp()
+	tableName := MustGetFlagString(options.IMPORT_TABLE)
+	filenames := MustGetFlagStringArray(options.IMPORT_FILE)
+	header := MustGetFlagBool(options.IMPORT_HEADER)
+	err := ValidateImportFiles(filenames)
+	gplog.FatalOnError(err)
+
+	CreateConnectionPool(MustGetFlagString(options.REDIRECT_DB))
+	tableFQNs, err := options.QuoteTableNames(connectionPool, []string{tableName})
+	gplog.FatalOnError(err)
+	tableFQN := tableFQNs[0]
+	gplog.Info("Importing data of table %s from %d files", tableFQN, len(filenames))
+
+	statements := make([]toc.StatementWithType, 0, len(filenames))
+	for _, filename := range filenames {
+		columns := make([]string, 0)
+		// The files of each segment are read on the segment hosts, so only files on this host have their header read
+		if header && !strings.Contains(filename, segmentIDPlaceholder) {
+			columns, err = readImportFileHeader(filename)
+			gplog.FatalOnError(err)
+			for i, column := range columns {
+				columns[i] = utils.QuoteIdent(connectionPool, column)
+			}
+		}
+		statements = append(statements, GetImportStatement(tableFQN, filename, columns, header))
+	}
+
+	if MustGetFlagBool(options.TRUNCATE_TABLE) {
+		gplog.Info("Truncating table %s", tableFQN)
+		connectionPool.MustExec(fmt.Sprintf("TRUNCATE %s", tableFQN))
+	}
+	numErrors := ExecuteStatementsAndCreateProgressBar(statements, "Data files", utils.PB_INFO, true)
+	if numErrors > 0 {
+		gplog.Info("Import of table %s completed with failures for %d of %d files", tableFQN, numErrors, len(filenames))
+	} else {
+		gplog.Info("Import of table %s complete", tableFQN)
+	}
+}
+
+/*
+ * The files are read by the database server, so their paths must be
+ * absolute, and files containing <SEGID> are read by each segment from its
+ * own host.  Only CSV can be read by COPY.
+ */
+func ValidateImportFiles(filenames []string) error {
+	for _, filename := range filenames {
+		if !strings.HasPrefix(filename, "/") {
+			return errors.Errorf("Import file %s is not an absolute path.", filename)
+		}
+		if strings.HasSuffix(strings.ToLower(filename), ".parquet") {
+			return errors.Errorf("Cannot import Parquet file %s.  Import files must be CSV, such as those written by --extract-table --format csv.", filename)
+		}
+		if strings.Contains(filename, segmentIDPlaceholder) {
+			continue
+		}
+		if _, err := os.Stat(filename); err != nil {
+			return errors.Errorf("Cannot find import file %s", filename)
+		}
+	}
+	return nil
+}
+
+func readImportFileHeader(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	header, err := csv.NewReader(file).Read()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not read the header of import file %s", filename)
+	}
+	return header, nil
+}
+
+/*
+ * A file on this host is read by the master and its rows are distributed to
+ * the segments, while a file containing <SEGID> is read by each segment with
+ * ON SEGMENT, so its rows must already belong to that segment.  The columns
+ * are those named by the header of the file, if it was read.
+ */
+func GetImportStatement(tableFQN string, filename string, columns []string, header bool) toc.StatementWithType {
+	schema, name := tableFQN, ""
+	if index := strings.Index(tableFQN, "."); index >= 0 {
+		schema, name = tableFQN[:index], tableFQN[index+1:]
+	}
+	columnList := ""
+	if len(columns) > 0 {
+		columnList = fmt.Sprintf("(%s)", strings.Join(columns, ","))
+	}
+	copyOptions := ""
+	if header {
+		copyOptions += " HEADER"
+	}
+	if strings.Contains(filename, segmentIDPlaceholder) {
+		copyOptions += " ON SEGMENT"
+	}
+	statement := fmt.Sprintf("COPY %s%s FROM '%s' WITH CSV DELIMITER '%s'%s;", tableFQN, columnList, utils.EscapeSingleQuotes(filename), tableDelim, copyOptions)
+	return toc.StatementWithType{Schema: schema, Name: name, ObjectType: "TABLE DATA", Statement: statement}
+}
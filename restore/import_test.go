@@ -0,0 +1,65 @@
+package restore
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/import tests", func() {
+	Describe("GetImportStatement", func() {
+		It("loads a file on the master host with its rows distributed to the segments", func() {
+			statement := GetImportStatement("public.foo", "/tmp/foo.csv", []string{}, false)
+			Expect(statement).To(Equal(toc.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE DATA",
+				Statement: "COPY public.foo FROM '/tmp/foo.csv' WITH CSV DELIMITER ',';"}))
+		})
+		It("loads the columns named by the header of the file", func() {
+			statement := GetImportStatement("public.foo", "/tmp/foo's.csv", []string{"i", `"J"`}, true)
+			Expect(statement.Statement).To(Equal(`COPY public.foo(i,"J") FROM '/tmp/foo''s.csv' WITH CSV DELIMITER ',' HEADER;`))
+		})
+		It("loads the file of each segment on its own host", func() {
+			statement := GetImportStatement("public.foo", "/data/foo_<SEGID>.csv", []string{}, true)
+			Expect(statement.Statement).To(Equal("COPY public.foo FROM '/data/foo_<SEGID>.csv' WITH CSV DELIMITER ',' HEADER ON SEGMENT;"))
+		})
+	})
+	Describe("ValidateImportFiles", func() {
+		var importDir string
+		BeforeEach(func() {
+			var err error
+			importDir, err = ioutil.TempDir("", "import_table")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(path.Join(importDir, "foo.csv"), []byte("1,a\n"), 0644)).To(Succeed())
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(importDir)
+		})
+		It("accepts existing files and the files of each segment", func() {
+			Expect(ValidateImportFiles([]string{path.Join(importDir, "foo.csv"), "/data/foo_<SEGID>.csv"})).To(Succeed())
+		})
+		It("rejects a relative path", func() {
+			Expect(ValidateImportFiles([]string{"foo.csv"})).To(MatchError("Import file foo.csv is not an absolute path."))
+		})
+		It("rejects a missing file", func() {
+			filename := path.Join(importDir, "bar.csv")
+			Expect(ValidateImportFiles([]string{filename})).To(MatchError("Cannot find import file " + filename))
+		})
+		It("rejects a Parquet file", func() {
+			Expect(ValidateImportFiles([]string{"/tmp/foo.parquet"})).To(MatchError(ContainSubstring("Cannot import Parquet file /tmp/foo.parquet")))
+		})
+	})
+	Describe("readImportFileHeader", func() {
+		It("returns the column names of the first line", func() {
+			importDir, err := ioutil.TempDir("", "import_table")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(importDir)
+			filename := path.Join(importDir, "foo.csv")
+			Expect(ioutil.WriteFile(filename, []byte("i,\"Name, Full\"\n1,a\n"), 0644)).To(Succeed())
+			Expect(readImportFileHeader(filename)).To(Equal([]string{"i", "Name, Full"}))
+		})
+	})
+})
@@ -0,0 +1,169 @@
+package restore
+
+/*
+ * This file contains functions for --refresh-materialized-views, which
+ * populates the materialized views, restored WITH NO DATA, once the data of
+ * their base tables is restored.
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	REFRESH_MATVIEWS_POPULATED = "populated"
+	REFRESH_MATVIEWS_ALL       = "all"
+
+	REFRESH_MATVIEW_OBJECT_TYPE = "REFRESH MATERIALIZED VIEW"
+)
+
+func ValidateRefreshMatviewsMode(mode string) error {
+	if mode != "" && mode != REFRESH_MATVIEWS_POPULATED && mode != REFRESH_MATVIEWS_ALL {
+		return errors.Errorf("Invalid value '%s' for --refresh-materialized-views.  Valid values are 'populated' and 'all'.", mode)
+	}
+	return nil
+}
+
+/*
+ * Groups the REFRESH statements into batches that can each be run in
+ * parallel, in which every materialized view comes after the materialized
+ * views that its definition names, so that it is refreshed from their data.
+ * The definitions are in the order in which the backup creates them, which is
+ * after the objects they depend on.
+ */
+func GroupRefreshStatementsByDependency(definitions []toc.StatementWithType, refreshStatements []toc.StatementWithType) [][]toc.StatementWithType {
+	viewOrder := make([]string, 0)
+	viewDefinitions := make(map[string]string)
+	for _, definition := range definitions {
+		fqn := utils.MakeFQN(definition.Schema, definition.Name)
+		if _, ok := viewDefinitions[fqn]; !ok {
+			viewOrder = append(viewOrder, fqn)
+		}
+		viewDefinitions[fqn] += definition.Statement
+	}
+	levels := make(map[string]int)
+	for i, fqn := range viewOrder {
+		for _, earlierFQN := range viewOrder[:i] {
+			if levels[earlierFQN] >= levels[fqn] && containsRelationName(viewDefinitions[fqn], earlierFQN) {
+				levels[fqn] = levels[earlierFQN] + 1
+			}
+		}
+	}
+
+	batches := make([][]toc.StatementWithType, 0)
+	for _, statement := range refreshStatements {
+		level := levels[utils.MakeFQN(statement.Schema, statement.Name)]
+		for len(batches) <= level {
+			batches = append(batches, make([]toc.StatementWithType, 0))
+		}
+		batches[level] = append(batches[level], statement)
+	}
+	nonEmptyBatches := make([][]toc.StatementWithType, 0, len(batches))
+	for _, batch := range batches {
+		if len(batch) > 0 {
+			nonEmptyBatches = append(nonEmptyBatches, batch)
+		}
+	}
+	return nonEmptyBatches
+}
+
+func containsRelationName(statement string, fqn string) bool {
+	for offset := 0; ; {
+		index := strings.Index(statement[offset:], fqn)
+		if index == -1 {
+			return false
+		}
+		start, end := offset+index, offset+index+len(fqn)
+		if (start == 0 || !(isIdentifierChar(statement[start-1]) || statement[start-1] == '.')) &&
+			(end == len(statement) || !isIdentifierChar(statement[end])) {
+			return true
+		}
+		offset = end
+	}
+}
+
+func editMaterializedViewStatements(statements []toc.StatementWithType) []toc.StatementWithType {
+	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	editStatementsForSchemaRenames(statements)
+	return editStatementsForConflicts(statements)
+}
+
+/*
+ * With the populated mode, only the materialized views that held data when
+ * the backup was taken are refreshed.  Backups taken before gpbackup recorded
+ * this have none, so the all mode refreshes every materialized view instead.
+ */
+func getRefreshMaterializedViewStatements(metadataFilename string, mode string) [][]toc.StatementWithType {
+	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+	definitions := GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{"MATERIALIZED VIEW"}, []string{}, filters)
+	definitions = editMaterializedViewStatements(definitions)
+
+	var refreshStatements []toc.StatementWithType
+	if mode == REFRESH_MATVIEWS_POPULATED {
+		refreshStatements = GetRestoreMetadataStatementsFiltered("postdata", metadataFilename, []string{REFRESH_MATVIEW_OBJECT_TYPE}, []string{}, filters)
+		refreshStatements = editMaterializedViewStatements(refreshStatements)
+	} else {
+		refreshStatements = make([]toc.StatementWithType, 0)
+		isRefreshed := make(map[string]bool)
+		for _, definition := range definitions {
+			fqn := utils.MakeFQN(definition.Schema, definition.Name)
+			if isRefreshed[fqn] {
+				continue
+			}
+			isRefreshed[fqn] = true
+			refreshStatements = append(refreshStatements, toc.StatementWithType{
+				Schema:          definition.Schema,
+				Name:            definition.Name,
+				ObjectType:      REFRESH_MATVIEW_OBJECT_TYPE,
+				ReferenceObject: fqn,
+				Statement:       fmt.Sprintf("\n\nREFRESH MATERIALIZED VIEW %s;", fqn),
+			})
+		}
+	}
+	return GroupRefreshStatementsByDependency(definitions, filterStatementsForRetry(refreshStatements))
+}
+
+func refreshMaterializedViews(metadataFilename string) {
+	if wasTerminated {
+		return
+	}
+	if backupConfig.DataOnly {
+		gplog.Warn("Backup %s has no metadata, so no materialized views will be refreshed", globalFPInfo.Timestamp)
+		return
+	}
+	batches := getRefreshMaterializedViewStatements(metadataFilename, MustGetFlagString(options.REFRESH_MATVIEWS))
+	numViews := 0
+	for _, batch := range batches {
+		numViews += len(batch)
+	}
+	if numViews == 0 {
+		gplog.Verbose("There are no materialized views to refresh")
+		return
+	}
+	gplog.Info("Refreshing %d materialized view(s)", numViews)
+	progressBar := utils.NewProgressBar(numViews, "Materialized views refreshed: ", utils.PB_VERBOSE)
+	progressBar.Start()
+	var numErrors int32
+	for _, batch := range batches {
+		if wasTerminated {
+			break
+		}
+		numErrors += ExecuteStatements(batch, progressBar, connectionPool.NumConns > 1)
+	}
+	progressBar.Finish()
+
+	if wasTerminated {
+		gplog.Info("Materialized view refresh incomplete")
+	} else if numErrors > 0 {
+		gplog.Info("Materialized view refresh completed with failures")
+	} else {
+		gplog.Info("Materialized view refresh complete")
+	}
+}
@@ -0,0 +1,58 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/matviews tests", func() {
+	Describe("ValidateRefreshMatviewsMode", func() {
+		It("accepts the valid modes", func() {
+			for _, mode := range []string{"", "populated", "all"} {
+				Expect(restore.ValidateRefreshMatviewsMode(mode)).To(Succeed())
+			}
+		})
+		It("rejects an invalid mode", func() {
+			Expect(restore.ValidateRefreshMatviewsMode("some")).To(MatchError("Invalid value 'some' for --refresh-materialized-views.  Valid values are 'populated' and 'all'."))
+		})
+	})
+	Describe("GroupRefreshStatementsByDependency", func() {
+		definition := func(name string, from string) toc.StatementWithType {
+			return toc.StatementWithType{Schema: "public", Name: name, ObjectType: "MATERIALIZED VIEW",
+				Statement: "\n\nCREATE MATERIALIZED VIEW public." + name + " AS  SELECT i\n   FROM " + from + "\nWITH NO DATA;\n"}
+		}
+		refresh := func(name string) toc.StatementWithType {
+			return toc.StatementWithType{Schema: "public", Name: name, ObjectType: "REFRESH MATERIALIZED VIEW", ReferenceObject: "public." + name,
+				Statement: "\n\nREFRESH MATERIALIZED VIEW public." + name + ";"}
+		}
+		It("refreshes materialized views of tables together", func() {
+			definitions := []toc.StatementWithType{definition("mv1", "public.foo"), definition("mv2", "public.bar")}
+
+			batches := restore.GroupRefreshStatementsByDependency(definitions, []toc.StatementWithType{refresh("mv1"), refresh("mv2")})
+
+			Expect(batches).To(Equal([][]toc.StatementWithType{{refresh("mv1"), refresh("mv2")}}))
+		})
+		It("refreshes materialized views after those they depend on", func() {
+			definitions := []toc.StatementWithType{
+				definition("mv1", "public.foo"),
+				definition("mv2", "public.mv1"),
+				definition("mv3", "public.mv2 JOIN public.mv1 USING (i)"),
+				definition("mv1_copy", "public.mv1_other"),
+			}
+
+			batches := restore.GroupRefreshStatementsByDependency(definitions, []toc.StatementWithType{refresh("mv1"), refresh("mv2"), refresh("mv3"), refresh("mv1_copy")})
+
+			Expect(batches).To(Equal([][]toc.StatementWithType{{refresh("mv1"), refresh("mv1_copy")}, {refresh("mv2")}, {refresh("mv3")}}))
+		})
+		It("leaves out the materialized views that are not refreshed", func() {
+			definitions := []toc.StatementWithType{definition("mv1", "public.foo"), definition("mv2", "public.mv1")}
+
+			batches := restore.GroupRefreshStatementsByDependency(definitions, []toc.StatementWithType{refresh("mv2")})
+
+			Expect(batches).To(Equal([][]toc.StatementWithType{{refresh("mv2")}}))
+		})
+	})
+})
@@ -0,0 +1,140 @@
+package restore
+
+/*
+ * This file contains functions for restoring the databases of a
+ * multi-database backup, taken with gpbackup --all-databases or with a
+ * comma-separated --dbname, in one invocation.  Each database is restored by
+ * a separate gprestore process from its own backup, into the database that
+ * was backed up.
+ */
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+func IsMultiDatabaseRun() bool {
+	return MustGetFlagBool(options.ALL_DATABASES) || len(MustGetFlagStringArray(options.INCLUDE_DATABASE)) > 0
+}
+
+/*
+ * Options that name objects in, or files of, a single database cannot be used
+ * when restoring several databases.
+ */
+func validateMultiDatabaseFlags(flags *pflag.FlagSet) {
+	options.CheckExclusiveFlags(flags, options.ALL_DATABASES, options.INCLUDE_DATABASE)
+	if !IsMultiDatabaseRun() {
+		return
+	}
+	for _, flagName := range []string{options.REDIRECT_DB, options.RETRY_FAILED, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE, options.DRY_RUN, options.TO_FILE, options.EXTRACT_TABLE, options.IMPORT_TABLE, options.LIST_TOC, options.TOC_EDIT, options.MACHINE_OUTPUT} {
+		if flags.Changed(flagName) {
+			gplog.Fatal(errors.Errorf("Cannot use --%s when restoring multiple databases", flagName), "")
+		}
+	}
+}
+
+func DoMultiDatabaseRestore() {
+	SetLoggerVerbosity()
+	gplog.Info("gprestore version = %s", GetVersion())
+
+	startTimestamp := history.CurrentTimestamp()
+	groupTimestamp := MustGetFlagString(options.TIMESTAMP)
+	fpInfo := getMasterFPInfo()
+	historyFilename := fpInfo.GetBackupHistoryFilePath()
+	if !iohelper.FileExistsAndIsReadable(historyFilename) {
+		gplog.Fatal(errors.Errorf("No backup history found at %s", historyFilename), "")
+	}
+	backupHistory, err := history.NewHistory(historyFilename)
+	gplog.FatalOnError(err)
+	backupConfigs, err := GetDatabaseGroupBackups(backupHistory, groupTimestamp, MustGetFlagStringArray(options.INCLUDE_DATABASE))
+	gplog.FatalOnError(err)
+	gplog.Info("Restoring %d databases from multi-database backup with timestamp = %s", len(backupConfigs), groupTimestamp)
+	args := utils.RemoveFlagsFromArgs(options.HandleSingleDashes(os.Args[1:]),
+		[]string{options.ALL_DATABASES}, []string{options.INCLUDE_DATABASE, options.TIMESTAMP})
+
+	results := make([]report.DatabaseRunResult, 0, len(backupConfigs))
+	for i, backupConfig := range backupConfigs {
+		dbName := utils.UnquoteIdent(backupConfig.DatabaseName)
+		result := report.DatabaseRunResult{Database: dbName, Timestamp: backupConfig.Timestamp, ExitCode: 2}
+		if !wasTerminated {
+			gplog.Info("Restoring database %s from backup with timestamp = %s (%d of %d)", dbName, backupConfig.Timestamp, i+1, len(backupConfigs))
+			result.ExitCode = utils.RunSelfWithArgs(append(args, "--timestamp", backupConfig.Timestamp))
+		}
+		results = append(results, result)
+	}
+
+	reportFilename := path.Join(path.Dir(gplog.GetLogFilePath()), fmt.Sprintf("gprestore_%s_%s_group_report", groupTimestamp, startTimestamp))
+	report.WriteDatabaseGroupReportFile(reportFilename, "gprestore", groupTimestamp, startTimestamp, operating.System.Now(), results)
+
+	numFailed := 0
+	for _, result := range results {
+		if result.ExitCode > gplog.GetErrorCode() {
+			gplog.SetErrorCode(result.ExitCode)
+		}
+		if report.GetRunStatus(result.ExitCode, false) == "failure" {
+			numFailed++
+		}
+	}
+	if numFailed > 0 {
+		gplog.Error("Restore of %d of %d databases failed; see %s for details", numFailed, len(results), reportFilename)
+	} else {
+		gplog.Info("Restored %d databases; see %s for details", len(results), reportFilename)
+	}
+}
+
+func getMasterFPInfo() filepath.FilePathInfo {
+	conn := dbconn.NewDBConnFromEnvironment("template1")
+	conn.MustConnect(1)
+	segConfig := cluster.MustGetSegmentConfiguration(conn)
+	conn.Close()
+	globalCluster = cluster.NewCluster(segConfig)
+	return filepath.NewFilePathInfo(globalCluster, "", "", "")
+}
+
+/*
+ * Returns the successful backups of the given multi-database backup, oldest
+ * first, restricted to the given databases if any are given.
+ */
+func GetDatabaseGroupBackups(backupHistory *history.History, groupTimestamp string, dbNames []string) ([]history.BackupConfig, error) {
+	dbNameSet := utils.NewIncludeSet(dbNames)
+	foundDBNames := make(map[string]bool)
+	backupConfigs := make([]history.BackupConfig, 0)
+	for _, backupConfig := range backupHistory.BackupConfigs {
+		if backupConfig.DatabaseGroup != groupTimestamp || backupConfig.Failed() || backupConfig.DateDeleted != "" {
+			continue
+		}
+		dbName := utils.UnquoteIdent(backupConfig.DatabaseName)
+		if !dbNameSet.MatchesFilter(dbName) {
+			continue
+		}
+		foundDBNames[dbName] = true
+		backupConfigs = append(backupConfigs, backupConfig)
+	}
+	for _, dbName := range dbNames {
+		if !foundDBNames[dbName] {
+			return nil, errors.Errorf("The multi-database backup with timestamp %s has no successful backup of database %s", groupTimestamp, dbName)
+		}
+	}
+	if len(backupConfigs) == 0 {
+		return nil, errors.Errorf("No successful backups were found for the multi-database backup with timestamp %s", groupTimestamp)
+	}
+	sort.Slice(backupConfigs, func(i, j int) bool {
+		return backupConfigs[i].Timestamp < backupConfigs[j].Timestamp
+	})
+	return backupConfigs, nil
+}
@@ -0,0 +1,42 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/restore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/multi_database tests", func() {
+	Describe("GetDatabaseGroupBackups", func() {
+		sales := history.BackupConfig{DatabaseName: `"Sales"`, Timestamp: "20170101010103", DatabaseGroup: "20170101010101", Status: history.BackupStatusSucceed}
+		hr := history.BackupConfig{DatabaseName: "hr", Timestamp: "20170101010102", DatabaseGroup: "20170101010101", Status: history.BackupStatusSucceed}
+		failed := history.BackupConfig{DatabaseName: "finance", Timestamp: "20170101010104", DatabaseGroup: "20170101010101", Status: history.BackupStatusFailed}
+		otherGroup := history.BackupConfig{DatabaseName: "hr", Timestamp: "20161231010101", DatabaseGroup: "20161231010100", Status: history.BackupStatusSucceed}
+		backupHistory := &history.History{BackupConfigs: []history.BackupConfig{failed, sales, hr, otherGroup}}
+
+		It("returns the successful backups of the group, oldest first", func() {
+			backupConfigs, err := restore.GetDatabaseGroupBackups(backupHistory, "20170101010101", []string{})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupConfigs).To(Equal([]history.BackupConfig{hr, sales}))
+		})
+		It("returns only the backups of the given databases", func() {
+			backupConfigs, err := restore.GetDatabaseGroupBackups(backupHistory, "20170101010101", []string{"Sales"})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupConfigs).To(Equal([]history.BackupConfig{sales}))
+		})
+		It("returns an error if a given database has no successful backup in the group", func() {
+			_, err := restore.GetDatabaseGroupBackups(backupHistory, "20170101010101", []string{"finance"})
+
+			Expect(err).To(MatchError("The multi-database backup with timestamp 20170101010101 has no successful backup of database finance"))
+		})
+		It("returns an error if the group has no successful backups", func() {
+			_, err := restore.GetDatabaseGroupBackups(backupHistory, "20170101010100", []string{})
+
+			Expect(err).To(MatchError("No successful backups were found for the multi-database backup with timestamp 20170101010100"))
+		})
+	})
+})
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/options"
@@ -20,15 +21,125 @@ var (
 	mutex = &sync.Mutex{}
 )
 
-func executeStatementsForConn(statements chan toc.StatementWithType, fatalErr *error, numErrors *int32, progressBar utils.ProgressBar, whichConn int, executeInParallel bool) {
-	for statement := range statements {
+/*
+ * Hands out statements to workers in their original order, while ensuring
+ * that no more than the configured number of statements of a given object
+ * type run at once.  Statements of an object type that is at its limit are
+ * skipped over rather than waited on, so cheap statements such as COMMENT or
+ * GRANT are not held up behind expensive ones such as CREATE INDEX.
+ */
+type statementQueue struct {
+	pending map[string][]queuedStatement
+	limits  map[string]int
+	running map[string]int
+	cond    *sync.Cond
+}
+
+type queuedStatement struct {
+	order     int
+	statement toc.StatementWithType
+}
+
+func newStatementQueue(statements []toc.StatementWithType, limits map[string]int) *statementQueue {
+	queue := &statementQueue{
+		pending: make(map[string][]queuedStatement),
+		limits:  limits,
+		running: make(map[string]int),
+		cond:    sync.NewCond(&sync.Mutex{}),
+	}
+	for i, statement := range statements {
+		queue.pending[statement.ObjectType] = append(queue.pending[statement.ObjectType], queuedStatement{order: i, statement: statement})
+	}
+	return queue
+}
+
+/*
+ * Returns the earliest statement whose object type is below its concurrency
+ * limit, blocking until one is available.  Returns false once there are no
+ * statements left.  Each statement returned must be passed to done().
+ */
+func (queue *statementQueue) next() (toc.StatementWithType, bool) {
+	queue.cond.L.Lock()
+	defer queue.cond.L.Unlock()
+	for {
+		nextType := ""
+		hasPending := false
+		for objectType, statements := range queue.pending {
+			if len(statements) == 0 {
+				continue
+			}
+			hasPending = true
+			if limit, ok := queue.limits[objectType]; ok && queue.running[objectType] >= limit {
+				continue
+			}
+			if nextType == "" || statements[0].order < queue.pending[nextType][0].order {
+				nextType = objectType
+			}
+		}
+		if !hasPending {
+			return toc.StatementWithType{}, false
+		}
+		if nextType != "" {
+			statement := queue.pending[nextType][0].statement
+			queue.pending[nextType] = queue.pending[nextType][1:]
+			queue.running[nextType]++
+			return statement, true
+		}
+		queue.cond.Wait()
+	}
+}
+
+func (queue *statementQueue) done(statement toc.StatementWithType) {
+	queue.cond.L.Lock()
+	queue.running[statement.ObjectType]--
+	queue.cond.L.Unlock()
+	queue.cond.Broadcast()
+}
+
+/*
+ * Statements ended by a deadlock are added to deadlocked rather than treated
+ * as errors if it is not nil.
+ */
+func executeStatementsForConn(statements *statementQueue, scheduler *adaptiveScheduler, deadlocked *deadlockedStatements, fatalErr *error, numErrors *int32, progressBar utils.ProgressBar, whichConn int, executeInParallel bool) {
+	for {
+		scheduler.acquire()
+		statement, ok := statements.next()
+		if !ok {
+			scheduler.release()
+			scheduler.close()
+			return
+		}
 		if wasTerminated || *fatalErr != nil {
+			statements.done(statement)
+			scheduler.release()
+			scheduler.close()
 			return
 		}
+		start := time.Now()
 		_, err := connectionPool.Exec(statement.Statement, whichConn)
+		statements.done(statement)
+		scheduler.releaseAfterStatement(time.Since(start), whichConn)
+		recordConnectionBusy(whichConn, time.Since(start), &statement)
+		if err == nil && statement.ObjectType == ANALYZE_OBJECT_TYPE {
+			recordAnalyzeTiming(statement, time.Since(start))
+		}
+		if deadlocked != nil && IsDeadlockError(err) {
+			gplog.Verbose("Deadlock encountered when executing statement: %s The statement will be retried serially", strings.TrimSpace(statement.Statement))
+			deadlocked.add(statement)
+			continue
+		}
 		if err != nil {
 			gplog.Verbose("Error encountered when executing statement: %s Error was: %s", strings.TrimSpace(statement.Statement), err.Error())
-			if MustGetFlagBool(options.ON_ERROR_CONTINUE) {
+			// A statement that times out is skipped even without --on-error-continue
+			if MustGetFlagBool(options.ON_ERROR_CONTINUE) || IsStatementTimeoutError(err) {
+				recordFailedObject(FailedObject{
+					ObjectType:      statement.ObjectType,
+					Schema:          statement.Schema,
+					Name:            statement.Name,
+					ReferenceObject: statement.ReferenceObject,
+					Error:           err.Error(),
+					Statement:       strings.TrimSpace(statement.Statement),
+				})
 				if executeInParallel {
 					atomic.AddInt32(numErrors, 1)
 					mutex.Lock()
@@ -48,31 +159,46 @@ func executeStatementsForConn(statements chan toc.StatementWithType, fatalErr *e
 
 /*
  * This function creates a worker pool of N goroutines to be able to execute up
- * to N statements in parallel.
+ * to N statements in parallel, or fewer if the number of active connections is
+ * being adjusted with the load on the restore database.
  */
 func ExecuteStatements(statements []toc.StatementWithType, progressBar utils.ProgressBar, executeInParallel bool, whichConn ...int) int32 {
 	var workerPool sync.WaitGroup
 	var fatalErr error
 	var numErrors int32
-	tasks := make(chan toc.StatementWithType, len(statements))
-	for _, statement := range statements {
-		tasks <- statement
+	limits := make(map[string]int)
+	if executeInParallel {
+		limits, _ = options.ParseConcurrencyLimits(MustGetFlagStringToInt(options.MAX_CONCURRENT))
 	}
-	close(tasks)
+	tasks := newStatementQueue(statements, limits)
 
 	if !executeInParallel {
 		connNum := connectionPool.ValidateConnNum(whichConn...)
-		executeStatementsForConn(tasks, &fatalErr, &numErrors, progressBar, connNum, executeInParallel)
+		executeStatementsForConn(tasks, nil, nil, &fatalErr, &numErrors, progressBar, connNum, executeInParallel)
 	} else {
+		scheduler := getAdaptiveScheduler()
+		deadlocked := newDeadlockedStatements()
 		for i := 0; i < connectionPool.NumConns; i++ {
 			workerPool.Add(1)
 			go func(connNum int) {
 				defer workerPool.Done()
 				connNum = connectionPool.ValidateConnNum(connNum)
-				executeStatementsForConn(tasks, &fatalErr, &numErrors, progressBar, connNum, executeInParallel)
+				executeStatementsForConn(tasks, scheduler, deadlocked, &fatalErr, &numErrors, progressBar, connNum, executeInParallel)
 			}(i)
 		}
 		workerPool.Wait()
+		/*
+		 * The other statements of the batch have finished, so the deadlocked
+		 * statements cannot deadlock with them again when run one at a time.
+		 */
+		if retries := deadlocked.inOrder(statements); len(retries) > 0 && fatalErr == nil && !wasTerminated {
+			gplog.Info("Retrying %d statements serially after a deadlock", len(retries))
+			for _, statement := range retries {
+				recordDeadlockRetry(statement)
+			}
+			connNum := connectionPool.ValidateConnNum(0)
+			executeStatementsForConn(newStatementQueue(retries, nil), nil, nil, &fatalErr, &numErrors, progressBar, connNum, false)
+		}
 	}
 	if fatalErr != nil {
 		fmt.Println("")
@@ -0,0 +1,242 @@
+package restore
+
+/*
+ * This file contains functions for restoring only selected leaf partitions of
+ * partitioned tables, as specified by --include-partition, and for exchanging
+ * them into existing partitioned tables with --exchange-partition.
+ */
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const EXCHANGE_TABLE_SUFFIX = "_gpexchange"
+
+/*
+ * Returns an error listing the relations that are not leaf partitions whose
+ * data was backed up separately, as only those can be restored on their own.
+ */
+func ValidateIncludePartitionsInBackupSet(partitions []string, dataEntries []toc.MasterDataEntry) error {
+	leafPartitions := make(map[string]bool)
+	for _, entry := range dataEntries {
+		if entry.PartitionRoot != "" {
+			leafPartitions[utils.MakeFQN(entry.Schema, entry.Name)] = true
+		}
+	}
+	missing := make([]string, 0)
+	for _, partition := range partitions {
+		if !leafPartitions[partition] {
+			missing = append(missing, partition)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("Could not find the following leaf partition(s) in the backup set: %s.  Leaf partitions can only be restored from backups taken with --leaf-partition-data.", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+/*
+ * The included leaf partitions are restored as included tables, so their data
+ * is restored along with the DDL of their root partitions.
+ */
+func includePartitions() {
+	partitions := MustGetFlagStringArray(options.INCLUDE_PARTITION)
+	if len(partitions) == 0 {
+		return
+	}
+	err := utils.ValidateFQNs(partitions)
+	gplog.FatalOnError(err)
+	partitions, err = options.QuoteTableNames(connectionPool, partitions)
+	gplog.FatalOnError(err)
+	err = ValidateIncludePartitionsInBackupSet(partitions, globalTOC.DataEntries)
+	gplog.FatalOnError(err)
+	for _, partition := range partitions {
+		opts.AddIncludedRelation(partition)
+	}
+	gplog.Verbose("Restoring leaf partition(s) %s", strings.Join(partitions, ", "))
+}
+
+/*
+ * Creates an empty table like each included leaf partition into which its
+ * data is loaded, so that the leaf partition keeps its data until the loaded
+ * data is exchanged into it.
+ */
+func createExchangeTables() {
+	partitions, err := options.QuoteTableNames(connectionPool, MustGetFlagStringArray(options.INCLUDE_PARTITION))
+	gplog.FatalOnError(err)
+	for _, partition := range partitions {
+		exchangeFQN := addSuffixToFQN(partition, EXCHANGE_TABLE_SUFFIX)
+		gplog.Verbose("Creating table %s to exchange with leaf partition %s", exchangeFQN, partition)
+		_, err := connectionPool.Exec(fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", exchangeFQN, partition))
+		gplog.FatalOnError(err, fmt.Sprintf("Could not create table %s to exchange with leaf partition %s", exchangeFQN, partition))
+		exchangeTables[partition] = exchangeFQN
+	}
+}
+
+type PartitionEntry struct {
+	TableName       string
+	ParentTableName string
+	Name            string
+	Rank            int
+	Root            string
+}
+
+/*
+ * Returns the partition entries of the root partition of the given leaf
+ * partition in the restore database, keyed by the FQN of each partition.
+ */
+func GetPartitionHierarchy(connectionPool *dbconn.DBConn, leafFQN string) (map[string]PartitionEntry, error) {
+	query := fmt.Sprintf(`
+	SELECT quote_ident(p.partitionschemaname) || '.' || quote_ident(p.partitiontablename) AS tablename,
+		coalesce(quote_ident(p.partitionschemaname) || '.' || quote_ident(p.parentpartitiontablename), '') AS parenttablename,
+		coalesce(quote_ident(p.partitionname), '') AS name,
+		coalesce(p.partitionrank, 0) AS rank,
+		quote_ident(p.schemaname) || '.' || quote_ident(p.tablename) AS root
+	FROM pg_partitions p
+		JOIN pg_partitions leaf ON leaf.schemaname = p.schemaname AND leaf.tablename = p.tablename
+	WHERE quote_ident(leaf.partitionschemaname) || '.' || quote_ident(leaf.partitiontablename) = '%s'`, utils.EscapeSingleQuotes(leafFQN))
+	results := make([]PartitionEntry, 0)
+	err := connectionPool.Select(&results, query)
+	if err != nil {
+		return nil, err
+	}
+	hierarchy := make(map[string]PartitionEntry, len(results))
+	for _, result := range results {
+		hierarchy[result.TableName] = result
+	}
+	return hierarchy, nil
+}
+
+/*
+ * Greenplum 5 and 6 exchange a leaf partition of a multi-level partitioned
+ * table through its ancestors, each identified by its name or its rank.
+ */
+func GetExchangePartitionStatement(hierarchy map[string]PartitionEntry, leafFQN string, exchangeFQN string) (string, error) {
+	entry, ok := hierarchy[leafFQN]
+	if !ok {
+		return "", errors.Errorf("%s is not a leaf partition in the restore database", leafFQN)
+	}
+	root := entry.Root
+	clauses := make([]string, 0)
+	for {
+		var clause string
+		if entry.Name != "" {
+			clause = fmt.Sprintf("PARTITION %s", entry.Name)
+		} else if entry.Rank > 0 {
+			clause = fmt.Sprintf("PARTITION FOR (RANK(%d))", entry.Rank)
+		} else {
+			return "", errors.Errorf("Partition %s has neither a name nor a rank by which to exchange it", entry.TableName)
+		}
+		clauses = append([]string{clause}, clauses...)
+		if entry.ParentTableName == "" {
+			break
+		}
+		if entry, ok = hierarchy[entry.ParentTableName]; !ok {
+			return "", errors.Errorf("Could not find the parent partition of %s", leafFQN)
+		}
+	}
+	statement := fmt.Sprintf("ALTER TABLE %s", root)
+	for _, clause := range clauses[:len(clauses)-1] {
+		statement += fmt.Sprintf(" ALTER %s", clause)
+	}
+	return fmt.Sprintf("%s EXCHANGE %s WITH TABLE %s", statement, clauses[len(clauses)-1], exchangeFQN), nil
+}
+
+type PartitionBound struct {
+	Parent string
+	Bound  string
+}
+
+/*
+ * Greenplum 7 partitions are exchanged by detaching the leaf partition and
+ * attaching the table holding the restored data with the same bound.
+ */
+func GetAttachPartitionStatements(connectionPool *dbconn.DBConn, leafFQN string, exchangeFQN string) (string, error) {
+	query := fmt.Sprintf(`
+	SELECT quote_ident(pn.nspname) || '.' || quote_ident(p.relname) AS parent,
+		pg_get_expr(c.relpartbound, c.oid) AS bound
+	FROM pg_class c
+		JOIN pg_inherits i ON i.inhrelid = c.oid
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace pn ON pn.oid = p.relnamespace
+	WHERE c.oid = '%s'::regclass
+		AND c.relispartition`, utils.EscapeSingleQuotes(leafFQN))
+	results := make([]PartitionBound, 0)
+	err := connectionPool.Select(&results, query)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", errors.Errorf("%s is not a leaf partition in the restore database", leafFQN)
+	}
+	leafName := strings.SplitN(leafFQN, ".", 2)[1]
+	return fmt.Sprintf("ALTER TABLE %[1]s DETACH PARTITION %[2]s; ALTER TABLE %[1]s ATTACH PARTITION %[3]s %[4]s; DROP TABLE %[2]s; ALTER TABLE %[3]s RENAME TO %[5]s",
+		results[0].Parent, leafFQN, exchangeFQN, results[0].Bound, leafName), nil
+}
+
+/*
+ * Exchanges the tables holding the restored data into the leaf partitions.
+ * Tables whose data could not be restored are dropped without being
+ * exchanged, so those leaf partitions keep their existing data.
+ */
+func exchangePartitions() {
+	if wasTerminated {
+		return
+	}
+	partitions := make([]string, 0, len(exchangeTables))
+	for partition := range exchangeTables {
+		partitions = append(partitions, partition)
+	}
+	sort.Strings(partitions)
+
+	numErrors := 0
+	for _, partition := range partitions {
+		exchangeFQN := exchangeTables[partition]
+		delete(exchangeTables, partition)
+		if _, ok := errorTablesData[exchangeFQN]; ok {
+			gplog.Warn("Not exchanging leaf partition %s, as its data could not be restored", partition)
+			_, _ = connectionPool.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", exchangeFQN))
+			continue
+		}
+		var statement string
+		var err error
+		if connectionPool.Version.AtLeast("7") {
+			statement, err = GetAttachPartitionStatements(connectionPool, partition, exchangeFQN)
+		} else {
+			var hierarchy map[string]PartitionEntry
+			hierarchy, err = GetPartitionHierarchy(connectionPool, partition)
+			if err == nil {
+				statement, err = GetExchangePartitionStatement(hierarchy, partition, exchangeFQN)
+				statement += fmt.Sprintf("; DROP TABLE %s", exchangeFQN)
+			}
+		}
+		if err == nil {
+			gplog.Verbose("Exchanging leaf partition %s with %s", partition, exchangeFQN)
+			_, err = connectionPool.Exec(statement)
+		}
+		if err != nil {
+			gplog.Error("Could not exchange leaf partition %s with %s: %v", partition, exchangeFQN, err)
+			errorTablesData[partition] = Empty{}
+			schemaAndName := strings.SplitN(partition, ".", 2)
+			recordFailedObject(FailedObject{ObjectType: "TABLE DATA", Schema: schemaAndName[0], Name: schemaAndName[1], Error: err.Error()})
+			numErrors++
+			if !MustGetFlagBool(options.ON_ERROR_CONTINUE) {
+				gplog.Fatal(errors.Errorf("Partition exchange failed for %s.  The restored data remains in %s.", partition, exchangeFQN), "")
+			}
+		}
+	}
+	if numErrors > 0 {
+		gplog.Info("Partition exchange completed with failures")
+	} else {
+		gplog.Info("Partition exchange complete")
+	}
+}
@@ -0,0 +1,77 @@
+package restore_test
+
+import (
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/partitions tests", func() {
+	Describe("ValidateIncludePartitionsInBackupSet", func() {
+		dataEntries := []toc.MasterDataEntry{
+			{Schema: "public", Name: "foo", PartitionRoot: ""},
+			{Schema: "public", Name: "bar_1_prt_1", PartitionRoot: "bar"},
+			{Schema: "public", Name: "bar_1_prt_2", PartitionRoot: "bar"},
+		}
+		It("passes when each partition is a leaf partition in the backup", func() {
+			Expect(restore.ValidateIncludePartitionsInBackupSet([]string{"public.bar_1_prt_1", "public.bar_1_prt_2"}, dataEntries)).To(Succeed())
+		})
+		It("returns an error listing the relations that are not leaf partitions in the backup", func() {
+			err := restore.ValidateIncludePartitionsInBackupSet([]string{"public.foo", "public.bar_1_prt_1", "public.bar_1_prt_3"}, dataEntries)
+			Expect(err).To(MatchError("Could not find the following leaf partition(s) in the backup set: public.foo, public.bar_1_prt_3.  Leaf partitions can only be restored from backups taken with --leaf-partition-data."))
+		})
+	})
+	Describe("GetExchangePartitionStatement", func() {
+		It("exchanges a named leaf partition of a single-level partitioned table", func() {
+			hierarchy := map[string]restore.PartitionEntry{
+				"public.foo_1_prt_jan": {TableName: "public.foo_1_prt_jan", Name: "jan", Rank: 1, Root: "public.foo"},
+			}
+			statement, err := restore.GetExchangePartitionStatement(hierarchy, "public.foo_1_prt_jan", "public.foo_1_prt_jan_gpexchange")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(statement).To(Equal("ALTER TABLE public.foo EXCHANGE PARTITION jan WITH TABLE public.foo_1_prt_jan_gpexchange"))
+		})
+		It("exchanges an unnamed leaf partition of a multi-level partitioned table through its parent", func() {
+			hierarchy := map[string]restore.PartitionEntry{
+				"public.foo_1_prt_usa":         {TableName: "public.foo_1_prt_usa", Name: "usa", Rank: 0, Root: "public.foo"},
+				"public.foo_1_prt_usa_2_prt_2": {TableName: "public.foo_1_prt_usa_2_prt_2", ParentTableName: "public.foo_1_prt_usa", Rank: 2, Root: "public.foo"},
+			}
+			statement, err := restore.GetExchangePartitionStatement(hierarchy, "public.foo_1_prt_usa_2_prt_2", "public.foo_1_prt_usa_2_prt_2_gpexchange")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(statement).To(Equal("ALTER TABLE public.foo ALTER PARTITION usa EXCHANGE PARTITION FOR (RANK(2)) WITH TABLE public.foo_1_prt_usa_2_prt_2_gpexchange"))
+		})
+		It("returns an error if the relation is not a leaf partition", func() {
+			_, err := restore.GetExchangePartitionStatement(map[string]restore.PartitionEntry{}, "public.foo", "public.foo_gpexchange")
+			Expect(err).To(MatchError("public.foo is not a leaf partition in the restore database"))
+		})
+		It("returns an error if a partition has neither a name nor a rank", func() {
+			hierarchy := map[string]restore.PartitionEntry{
+				"public.foo_1_prt_1": {TableName: "public.foo_1_prt_1", Root: "public.foo"},
+			}
+			_, err := restore.GetExchangePartitionStatement(hierarchy, "public.foo_1_prt_1", "public.foo_1_prt_1_gpexchange")
+			Expect(err).To(MatchError("Partition public.foo_1_prt_1 has neither a name nor a rank by which to exchange it"))
+		})
+	})
+	Describe("GetAttachPartitionStatements", func() {
+		It("detaches the leaf partition and attaches the exchange table with its bound", func() {
+			rows := sqlmock.NewRows([]string{"parent", "bound"}).AddRow("public.foo", "FOR VALUES FROM (1) TO (10)")
+			mock.ExpectQuery(regexp.QuoteMeta("WHERE c.oid = 'public.foo_1_prt_1'::regclass")).WillReturnRows(rows)
+
+			statement, err := restore.GetAttachPartitionStatements(connectionPool, "public.foo_1_prt_1", "public.foo_1_prt_1_gpexchange")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(statement).To(Equal("ALTER TABLE public.foo DETACH PARTITION public.foo_1_prt_1; ALTER TABLE public.foo ATTACH PARTITION public.foo_1_prt_1_gpexchange FOR VALUES FROM (1) TO (10); DROP TABLE public.foo_1_prt_1; ALTER TABLE public.foo_1_prt_1_gpexchange RENAME TO foo_1_prt_1"))
+		})
+		It("returns an error if the relation is not a partition", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("WHERE c.oid = 'public.foo'::regclass")).WillReturnRows(sqlmock.NewRows([]string{"parent", "bound"}))
+
+			_, err := restore.GetAttachPartitionStatements(connectionPool, "public.foo", "public.foo_gpexchange")
+
+			Expect(err).To(MatchError("public.foo is not a leaf partition in the restore database"))
+		})
+	})
+})
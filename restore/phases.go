@@ -0,0 +1,154 @@
+package restore
+
+/*
+ * This file contains functions for --phase, which restores only some of the
+ * phases of a restore, so that the rest can be restored by later runs, for
+ * example loading the data one night and building the indexes at the
+ * weekend.  The phases completed for each restore database are recorded in a
+ * state file next to the backup, so that later runs restore the phases in
+ * order and restore each one only once.
+ */
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	PHASE_PREDATA    = "predata"
+	PHASE_DATA       = "data"
+	PHASE_POSTDATA   = "postdata"
+	PHASE_STATISTICS = "statistics"
+)
+
+var restorePhases = []string{PHASE_PREDATA, PHASE_DATA, PHASE_POSTDATA, PHASE_STATISTICS}
+
+// The phases that must be restored before each phase
+var phasePrerequisites = map[string][]string{
+	PHASE_PREDATA:    {},
+	PHASE_DATA:       {PHASE_PREDATA},
+	PHASE_POSTDATA:   {PHASE_PREDATA, PHASE_DATA},
+	PHASE_STATISTICS: {PHASE_PREDATA, PHASE_DATA},
+}
+
+/*
+ * Phases maps each restore database to the restore timestamp at which each
+ * of its completed phases finished.
+ */
+type RestorePhaseState struct {
+	Phases map[string]map[string]string
+}
+
+func ValidatePhases(phases []string) error {
+	for _, phase := range phases {
+		if !utils.Exists(restorePhases, phase) {
+			return errors.Errorf("Invalid value '%s' for --phase.  Valid values are '%s'.", phase, strings.Join(restorePhases, "', '"))
+		}
+	}
+	return nil
+}
+
+/*
+ * A missing state file means that no phase of the backup has been restored.
+ */
+func ReadRestorePhaseState(filename string) (*RestorePhaseState, error) {
+	state := &RestorePhaseState{Phases: make(map[string]map[string]string)}
+	contents, err := operating.System.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read restore phase file %s", filename)
+	}
+	err = yaml.Unmarshal(contents, state)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse restore phase file %s", filename)
+	}
+	if state.Phases == nil {
+		state.Phases = make(map[string]map[string]string)
+	}
+	return state, nil
+}
+
+func (state *RestorePhaseState) WriteToFile(filename string) error {
+	contents, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tempFilename := filename + ".tmp"
+	err = ioutil.WriteFile(tempFilename, contents, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempFilename, filename)
+}
+
+/*
+ * Returns an error if any of the phases was already restored into the
+ * database, or if a phase it depends on has neither been restored nor is
+ * among the phases to restore.
+ */
+func (state *RestorePhaseState) CheckPhases(database string, phases []string) error {
+	completed := state.Phases[database]
+	for _, phase := range phases {
+		if restoreTimestamp, ok := completed[phase]; ok {
+			return errors.Errorf("The %s phase was already restored into database %s by the restore at %s", phase, database, restoreTimestamp)
+		}
+		for _, prerequisite := range phasePrerequisites[phase] {
+			if _, ok := completed[prerequisite]; !ok && !utils.Exists(phases, prerequisite) {
+				return errors.Errorf("Cannot restore the %s phase into database %s before the %s phase", phase, database, prerequisite)
+			}
+		}
+	}
+	return nil
+}
+
+func (state *RestorePhaseState) CompletePhase(database string, phase string, restoreTimestamp string) {
+	if state.Phases[database] == nil {
+		state.Phases[database] = make(map[string]string)
+	}
+	state.Phases[database][phase] = restoreTimestamp
+}
+
+func isPhaseRestore() bool {
+	return len(MustGetFlagStringSlice(options.PHASE)) > 0
+}
+
+func shouldRestorePhase(phase string) bool {
+	return !isPhaseRestore() || utils.Exists(MustGetFlagStringSlice(options.PHASE), phase)
+}
+
+func checkRestorePhases(database string) {
+	if !isPhaseRestore() {
+		return
+	}
+	state, err := ReadRestorePhaseState(globalFPInfo.GetRestorePhasesFilePath())
+	gplog.FatalOnError(err)
+	err = state.CheckPhases(database, MustGetFlagStringSlice(options.PHASE))
+	gplog.FatalOnError(err)
+}
+
+/*
+ * A phase is recorded as complete even if some of its statements failed
+ * with --on-error-continue, as it would fail in the same way if restored
+ * again, but not if the restore was interrupted.
+ */
+func completeRestorePhase(phase string) {
+	if !isPhaseRestore() || wasTerminated {
+		return
+	}
+	filename := globalFPInfo.GetRestorePhasesFilePath()
+	state, err := ReadRestorePhaseState(filename)
+	gplog.FatalOnError(err)
+	state.CompletePhase(connectionPool.DBName, phase, restoreStartTime)
+	err = state.WriteToFile(filename)
+	gplog.FatalOnError(err)
+	gplog.Info("Restore phase %s complete", phase)
+}
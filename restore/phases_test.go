@@ -0,0 +1,70 @@
+package restore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/restore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/phases tests", func() {
+	Describe("ValidatePhases", func() {
+		It("passes for each valid phase", func() {
+			Expect(restore.ValidatePhases([]string{"predata", "data", "postdata", "statistics"})).To(Succeed())
+		})
+		It("fails for an unknown phase", func() {
+			Expect(restore.ValidatePhases([]string{"data", "indexes"})).To(MatchError("Invalid value 'indexes' for --phase.  Valid values are 'predata', 'data', 'postdata', 'statistics'."))
+		})
+	})
+	Describe("ReadRestorePhaseState", func() {
+		AfterEach(func() {
+			operating.System = operating.InitializeSystemFunctions()
+		})
+		It("returns an empty state if no phase was restored", func() {
+			operating.System.ReadFile = func(filename string) ([]byte, error) {
+				return nil, os.ErrNotExist
+			}
+			state, err := restore.ReadRestorePhaseState("/tmp/gpbackup_20170101010101_restore_phases.yaml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Phases).To(BeEmpty())
+		})
+		It("reads back the phases written to the file", func() {
+			dir, err := ioutil.TempDir("", "restore_phases")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			filename := path.Join(dir, "gpbackup_20170101010101_restore_phases.yaml")
+
+			state := &restore.RestorePhaseState{Phases: map[string]map[string]string{}}
+			state.CompletePhase("testdb", "predata", "20170102010101")
+			Expect(state.WriteToFile(filename)).To(Succeed())
+
+			readState, err := restore.ReadRestorePhaseState(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readState).To(Equal(state))
+		})
+	})
+	Describe("CheckPhases", func() {
+		var state *restore.RestorePhaseState
+		BeforeEach(func() {
+			state = &restore.RestorePhaseState{Phases: map[string]map[string]string{}}
+			state.CompletePhase("testdb", "predata", "20170102010101")
+		})
+		It("allows phases whose prerequisites were restored or are being restored", func() {
+			Expect(state.CheckPhases("testdb", []string{"data"})).To(Succeed())
+			Expect(state.CheckPhases("testdb", []string{"data", "postdata", "statistics"})).To(Succeed())
+			Expect(state.CheckPhases("otherdb", []string{"predata", "data"})).To(Succeed())
+		})
+		It("fails for a phase that was already restored", func() {
+			Expect(state.CheckPhases("testdb", []string{"predata"})).To(MatchError("The predata phase was already restored into database testdb by the restore at 20170102010101"))
+		})
+		It("fails for a phase whose prerequisites were not restored", func() {
+			Expect(state.CheckPhases("testdb", []string{"postdata"})).To(MatchError("Cannot restore the postdata phase into database testdb before the data phase"))
+			Expect(state.CheckPhases("otherdb", []string{"data"})).To(MatchError("Cannot restore the data phase into database otherdb before the predata phase"))
+		})
+	})
+})
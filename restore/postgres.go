@@ -0,0 +1,276 @@
+package restore
+
+/*
+ * This file contains functions for --to-file-format postgres, which writes a
+ * restore script that can be run against PostgreSQL by removing the syntax
+ * and objects specific to Greenplum and loading the data from the script.
+ */
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+const (
+	TO_FILE_FORMAT_GREENPLUM = "greenplum"
+	TO_FILE_FORMAT_POSTGRES  = "postgres"
+
+	KEEP_DISTRIBUTED_BY    = "distributed-by"
+	KEEP_STORAGE_OPTIONS   = "storage-options"
+	KEEP_PARTITION_BY      = "partition-by"
+	KEEP_GREENPLUM_OBJECTS = "greenplum-objects"
+)
+
+var (
+	distributedByPattern      = regexp.MustCompile(`\s*DISTRIBUTED (BY \([^()]*\)|RANDOMLY|REPLICATED)`)
+	storageOptionsPattern     = regexp.MustCompile(`( ?)WITH \(([^()]*)\)`)
+	columnEncodingPattern     = regexp.MustCompile(` ENCODING \([^()]*\)`)
+	externalTablePattern      = regexp.MustCompile(`^\s*CREATE (READABLE |WRITABLE )?EXTERNAL `)
+	roleAttributePattern      = regexp.MustCompile(` (RESOURCE QUEUE|RESOURCE GROUP) [^ ;]+| CREATEEXTTABLE \([^()]*\)`)
+	roleTimeConstraintPattern = regexp.MustCompile(`(?m)^ALTER ROLE .* DENY BETWEEN .*;\n?`)
+	sessionGUCPattern         = regexp.MustCompile(`(?m)^SET gp_.*;\n?`)
+)
+
+// Storage parameters of append-optimized tables, which PostgreSQL does not have
+var greenplumStorageOptions = map[string]bool{
+	"appendonly": true, "appendoptimized": true, "orientation": true, "compresstype": true,
+	"compresslevel": true, "blocksize": true, "checksum": true,
+}
+
+var greenplumObjectTypes = map[string]bool{
+	"RESOURCE QUEUE": true, "RESOURCE GROUP": true, "PROTOCOL": true, "EXCHANGE PARTITION": true,
+}
+
+func ValidateToFileFormat(format string, keepSyntax []string) error {
+	if format != TO_FILE_FORMAT_GREENPLUM && format != TO_FILE_FORMAT_POSTGRES {
+		return errors.Errorf("Invalid value '%s' for --to-file-format.  Valid values are 'greenplum' and 'postgres'.", format)
+	}
+	for _, syntax := range keepSyntax {
+		if syntax != KEEP_DISTRIBUTED_BY && syntax != KEEP_STORAGE_OPTIONS && syntax != KEEP_PARTITION_BY && syntax != KEEP_GREENPLUM_OBJECTS {
+			return errors.Errorf("Invalid value '%s' for --keep-greenplum-syntax.  Valid values are 'distributed-by', 'storage-options', 'partition-by', and 'greenplum-objects'.", syntax)
+		}
+	}
+	return nil
+}
+
+func isPostgresRestoreScript() bool {
+	return MustGetFlagString(options.TO_FILE) != "" && MustGetFlagString(options.TO_FILE_FORMAT) == TO_FILE_FORMAT_POSTGRES
+}
+
+func getKeptGreenplumSyntax() map[string]bool {
+	keep := make(map[string]bool)
+	for _, syntax := range MustGetFlagStringArray(options.KEEP_GREENPLUM_SYNTAX) {
+		keep[syntax] = true
+	}
+	return keep
+}
+
+/*
+ * Removes the Greenplum-specific clauses that are not kept from each statement
+ * and precedes it with a comment naming its object, as pg_dump does.  The
+ * statements of Greenplum-specific objects, including external tables and
+ * their comments and privileges, are replaced with a comment unless kept.
+ */
+func ConvertStatementsForPostgres(statements []toc.StatementWithType, keep map[string]bool) []toc.StatementWithType {
+	externalTables := make(map[string]bool)
+	for _, statement := range statements {
+		if statement.ObjectType == "TABLE" && externalTablePattern.MatchString(statement.Statement) {
+			externalTables[utils.MakeFQN(statement.Schema, statement.Name)] = true
+		}
+	}
+
+	converted := make([]toc.StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		isExternalTable := statement.ObjectType == "TABLE" && externalTables[utils.MakeFQN(statement.Schema, statement.Name)]
+		isGreenplumGUC := (statement.ObjectType == "DATABASE GUC" || statement.ObjectType == "ROLE GUCS") && strings.Contains(statement.Statement, " SET gp_")
+		if !keep[KEEP_GREENPLUM_OBJECTS] && (greenplumObjectTypes[statement.ObjectType] || isExternalTable || isGreenplumGUC) {
+			statement.Statement = fmt.Sprintf("-- Skipped Greenplum-specific %s %s", statement.ObjectType, getObjectName(statement))
+			converted = append(converted, statement)
+			continue
+		}
+		text := strings.TrimSpace(statement.Statement)
+		isTable := statement.ObjectType == "TABLE" || statement.ObjectType == "MATERIALIZED VIEW"
+		if isTable && !keep[KEEP_PARTITION_BY] {
+			text = removePartitionClauses(text)
+		}
+		if isTable && !keep[KEEP_DISTRIBUTED_BY] {
+			text = distributedByPattern.ReplaceAllString(text, "")
+		}
+		if isTable && !keep[KEEP_STORAGE_OPTIONS] {
+			text = storageOptionsPattern.ReplaceAllStringFunc(text, removeGreenplumStorageOptions)
+			text = columnEncodingPattern.ReplaceAllString(text, "")
+		}
+		if !keep[KEEP_GREENPLUM_OBJECTS] {
+			if statement.ObjectType == "ROLE" {
+				text = roleAttributePattern.ReplaceAllString(text, "")
+				text = roleTimeConstraintPattern.ReplaceAllString(text, "")
+			}
+			if statement.ObjectType == "SESSION GUCS" {
+				text = sessionGUCPattern.ReplaceAllString(text, "")
+			}
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		statement.Statement = fmt.Sprintf("--\n-- Name: %s; Type: %s; Schema: %s\n--\n\n%s", statement.Name, statement.ObjectType, getSchemaForComment(statement.Schema), text)
+		converted = append(converted, statement)
+	}
+	return converted
+}
+
+func getObjectName(statement toc.StatementWithType) string {
+	if statement.Schema == "" {
+		return statement.Name
+	}
+	return utils.MakeFQN(statement.Schema, statement.Name)
+}
+
+func getSchemaForComment(schema string) string {
+	if schema == "" {
+		return "-"
+	}
+	return schema
+}
+
+func removeGreenplumStorageOptions(withClause string) string {
+	keptOptions := make([]string, 0)
+	matches := storageOptionsPattern.FindStringSubmatch(withClause)
+	for _, option := range strings.Split(matches[2], ",") {
+		key := strings.ToLower(strings.TrimSpace(strings.SplitN(option, "=", 2)[0]))
+		if !greenplumStorageOptions[key] {
+			keptOptions = append(keptOptions, strings.TrimSpace(option))
+		}
+	}
+	if len(keptOptions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%sWITH (%s)", matches[1], strings.Join(keptOptions, ", "))
+}
+
+/*
+ * Removes the PARTITION BY clause of a CREATE TABLE statement and the SET
+ * SUBPARTITION TEMPLATE statement following it.  Both end at the first
+ * semicolon outside of parentheses and quotes.
+ */
+func removePartitionClauses(text string) string {
+	if start := strings.Index(text, " PARTITION BY "); start != -1 {
+		if end := findStatementEnd(text, start); end != -1 {
+			text = text[:start] + text[end:]
+		}
+	}
+	if templateIndex := strings.Index(text, "\nSET SUBPARTITION TEMPLATE"); templateIndex != -1 {
+		if start := strings.LastIndex(text[:templateIndex], "ALTER TABLE "); start != -1 {
+			if end := findStatementEnd(text, start); end != -1 {
+				text = strings.TrimRight(text[:start], "\n") + text[end+1:]
+			}
+		}
+	}
+	return text
+}
+
+func findStatementEnd(text string, start int) int {
+	depth := 0
+	inQuotes := false
+	for i := start; i < len(text); i++ {
+		switch {
+		case text[i] == '\'':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case text[i] == '(':
+			depth++
+		case text[i] == ')':
+			depth--
+		case text[i] == ';' && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+ * Returns a section loading the data of each table from within the script, as
+ * pg_dump does, from the backup files of each segment.  The files of all
+ * segments must be readable from the --backup-dir directory.  Without the
+ * partitioning clauses, the data of leaf partitions is loaded into their root
+ * partition.
+ */
+func GetInlineDataSection(filteredDataEntries map[string][]toc.MasterDataEntry) RestoreSection {
+	keepPartitions := getKeptGreenplumSyntax()[KEEP_PARTITION_BY]
+	section := RestoreSection{Title: "Data", Statements: make([]string, 0), CopyData: make([]func(io.Writer) error, 0)}
+	for _, timestamp := range getSortedTimestamps(filteredDataEntries) {
+		fpInfo := GetBackupFPInfoForTimestamp(timestamp)
+		fpInfo.DataFiles = toc.GetDataFiles(filteredDataEntries[timestamp])
+		for _, entry := range getDataEntriesInLoadOrder(filteredDataEntries[timestamp]) {
+			tableName := entry.Name
+			if entry.PartitionRoot != "" && !keepPartitions {
+				tableName = entry.PartitionRoot
+			}
+			section.Statements = append(section.Statements, fmt.Sprintf("COPY %s%s FROM stdin WITH CSV DELIMITER '%s';", getRestoreTableFQN(entry.Schema, tableName), entry.AttributeString, tableDelim))
+			entry := entry
+			section.CopyData = append(section.CopyData, func(writer io.Writer) error {
+				return writeTableData(writer, fpInfo, entry)
+			})
+		}
+	}
+	return section
+}
+
+func writeTableData(writer io.Writer, fpInfo filepath.FilePathInfo, entry toc.MasterDataEntry) error {
+	_, pipeThroughProgram := getTableDataSource(&fpInfo, entry)
+	for contentID := 0; contentID < backupConfig.SegmentCount; contentID++ {
+		filenames := []string{fpInfo.GetTableBackupFilePath(contentID, entry.Oid, pipeThroughProgram.Extension, false)}
+		if entry.Streams > 1 {
+			filenames = make([]string, entry.Streams)
+			for stream := range filenames {
+				filenames[stream] = fpInfo.GetTableStreamBackupFilePath(contentID, entry.Oid, stream, pipeThroughProgram.Extension)
+			}
+		}
+		for _, filename := range filenames {
+			err := copyDecompressedFile(writer, filename, pipeThroughProgram.Name)
+			if err != nil {
+				return errors.Wrapf(err, "Could not read data of table %s", utils.MakeFQN(entry.Schema, entry.Name))
+			}
+		}
+	}
+	return nil
+}
+
+func copyDecompressedFile(writer io.Writer, filename string, compressionType string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var reader io.Reader = bufio.NewReader(file)
+	switch compressionType {
+	case "gzip":
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case "zstd":
+		zstdReader, err := zstd.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	}
+	_, err = io.Copy(writer, reader)
+	return err
+}
@@ -0,0 +1,169 @@
+package restore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/klauspost/compress/zstd"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("restore/postgres tests", func() {
+	BeforeEach(func() {
+		opts = &options.Options{}
+		backupConfig = &history.BackupConfig{}
+	})
+	Describe("ValidateToFileFormat", func() {
+		It("accepts the valid formats and syntax to keep", func() {
+			Expect(ValidateToFileFormat("greenplum", []string{})).To(Succeed())
+			Expect(ValidateToFileFormat("postgres", []string{"distributed-by", "storage-options", "partition-by", "greenplum-objects"})).To(Succeed())
+		})
+		It("rejects an invalid format", func() {
+			Expect(ValidateToFileFormat("oracle", []string{})).To(MatchError(ContainSubstring("Invalid value 'oracle' for --to-file-format")))
+		})
+		It("rejects invalid syntax to keep", func() {
+			Expect(ValidateToFileFormat("postgres", []string{"tablespaces"})).To(MatchError(ContainSubstring("Invalid value 'tablespaces' for --keep-greenplum-syntax")))
+		})
+	})
+	Describe("ConvertStatementsForPostgres", func() {
+		aoTable := toc.StatementWithType{ObjectType: "TABLE", Schema: "public", Name: "foo", Statement: `
+
+CREATE TABLE public.foo (
+	i integer ENCODING (compresstype=zlib),
+	j text
+) WITH (appendonly=true, orientation=column, fillfactor=42) DISTRIBUTED BY (i);
+`}
+		partitionTable := toc.StatementWithType{ObjectType: "TABLE", Schema: "public", Name: "rank", Statement: `
+
+CREATE TABLE public.rank (
+	gender character(1)
+) DISTRIBUTED RANDOMLY PARTITION BY LIST(gender)
+	(
+	PARTITION girls VALUES('F') WITH (tablename='rank_1_prt_girls', appendonly=false ),
+	DEFAULT PARTITION other  WITH (tablename='rank_1_prt_other', appendonly=false )
+	);
+ALTER TABLE rank
+SET SUBPARTITION TEMPLATE
+          (
+          SUBPARTITION usa VALUES('usa') WITH (tablename='rank')
+          )
+;
+ALTER TABLE ONLY public.rank ALTER COLUMN gender SET STATISTICS 10;
+`}
+		It("removes the distribution, storage options, and column encodings of tables", func() {
+			converted := ConvertStatementsForPostgres([]toc.StatementWithType{aoTable}, map[string]bool{})
+			Expect(converted[0].Statement).To(Equal(`--
+-- Name: foo; Type: TABLE; Schema: public
+--
+
+CREATE TABLE public.foo (
+	i integer,
+	j text
+) WITH (fillfactor=42);`))
+		})
+		It("keeps the syntax it is told to keep", func() {
+			converted := ConvertStatementsForPostgres([]toc.StatementWithType{aoTable}, map[string]bool{KEEP_DISTRIBUTED_BY: true, KEEP_STORAGE_OPTIONS: true})
+			Expect(converted[0].Statement).To(ContainSubstring(`) WITH (appendonly=true, orientation=column, fillfactor=42) DISTRIBUTED BY (i);`))
+			Expect(converted[0].Statement).To(ContainSubstring(`i integer ENCODING (compresstype=zlib),`))
+		})
+		It("removes the partitioning clauses of tables", func() {
+			converted := ConvertStatementsForPostgres([]toc.StatementWithType{partitionTable}, map[string]bool{})
+			Expect(converted[0].Statement).To(HaveSuffix(`CREATE TABLE public.rank (
+	gender character(1)
+);
+ALTER TABLE ONLY public.rank ALTER COLUMN gender SET STATISTICS 10;`))
+		})
+		It("does not remove partitioning clauses from other objects", func() {
+			view := toc.StatementWithType{ObjectType: "VIEW", Schema: "public", Name: "v", Statement: "CREATE VIEW public.v AS SELECT rank() OVER (PARTITION BY i) FROM public.foo;"}
+			converted := ConvertStatementsForPostgres([]toc.StatementWithType{view}, map[string]bool{})
+			Expect(converted[0].Statement).To(HaveSuffix("CREATE VIEW public.v AS SELECT rank() OVER (PARTITION BY i) FROM public.foo;"))
+		})
+		It("skips Greenplum-specific objects and the statements of external tables", func() {
+			statements := []toc.StatementWithType{
+				{ObjectType: "RESOURCE QUEUE", Name: "rq", Statement: "CREATE RESOURCE QUEUE rq WITH (ACTIVE_STATEMENTS=1);"},
+				{ObjectType: "TABLE", Schema: "public", Name: "ext", Statement: "CREATE READABLE EXTERNAL TABLE public.ext (\n\ti integer\n) LOCATION ('gpfdist://host:8080/file') FORMAT 'TEXT';"},
+				{ObjectType: "TABLE", Schema: "public", Name: "ext", Statement: "COMMENT ON TABLE public.ext IS 'external';"},
+			}
+			converted := ConvertStatementsForPostgres(statements, map[string]bool{})
+			Expect(getStatementStrings(converted)).To(Equal([]string{
+				"-- Skipped Greenplum-specific RESOURCE QUEUE rq",
+				"-- Skipped Greenplum-specific TABLE public.ext",
+				"-- Skipped Greenplum-specific TABLE public.ext",
+			}))
+		})
+		It("removes Greenplum-specific role attributes and session GUCs", func() {
+			statements := []toc.StatementWithType{
+				{ObjectType: "SESSION GUCS", Statement: "SET client_encoding = 'UTF8';\nSET gp_default_storage_options = 'appendonly=false';\n"},
+				{ObjectType: "ROLE", Name: "testrole", Statement: "CREATE ROLE testrole;\nALTER ROLE testrole WITH LOGIN RESOURCE QUEUE pg_default RESOURCE GROUP default_group CREATEEXTTABLE (protocol='http');\nALTER ROLE testrole DENY BETWEEN DAY 0 TIME '00:00:00' AND DAY 1 TIME '00:00:00';"},
+			}
+			converted := ConvertStatementsForPostgres(statements, map[string]bool{})
+			Expect(converted[0].Statement).To(HaveSuffix("\n\nSET client_encoding = 'UTF8';"))
+			Expect(converted[1].Statement).To(HaveSuffix("\n\nCREATE ROLE testrole;\nALTER ROLE testrole WITH LOGIN;"))
+		})
+	})
+	Describe("GetInlineDataSection", func() {
+		var backupDir string
+		writeSegmentFile := func(contentID int, contents string) {
+			dir := path.Join(backupDir, fmt.Sprintf("gpseg%d", contentID), "backups", "20170101", "20170101010101")
+			Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+			file, err := os.Create(path.Join(dir, fmt.Sprintf("gpbackup_%d_20170101010101_2.zst", contentID)))
+			Expect(err).ToNot(HaveOccurred())
+			writer, err := zstd.NewWriter(file)
+			Expect(err).ToNot(HaveOccurred())
+			_, _ = io.WriteString(writer, contents)
+			Expect(writer.Close()).To(Succeed())
+			Expect(file.Close()).To(Succeed())
+		}
+		BeforeEach(func() {
+			var err error
+			backupDir, err = ioutil.TempDir("", "to_file_postgres")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.MkdirAll(path.Join(backupDir, "gpseg-1", "backups", "20170101", "20170101010101"), 0755)).To(Succeed())
+			_ = cmdFlags.Set(options.BACKUP_DIR, backupDir)
+			globalCluster = cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, Hostname: "localhost"}})
+			backupConfig = &history.BackupConfig{Compressed: true, CompressionType: "zstd", SegmentCount: 2}
+			utils.InitializePipeThroughParameters(true, "zstd", 0)
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(backupDir)
+			_ = cmdFlags.Set(options.BACKUP_DIR, "")
+			utils.InitializePipeThroughParameters(false, "", 0)
+		})
+		It("loads the data of every segment from within the script, into the root of leaf partitions", func() {
+			writeSegmentFile(0, "1,a\n")
+			writeSegmentFile(1, "2,b\n")
+			dataEntries := map[string][]toc.MasterDataEntry{
+				"20170101010101": {{Schema: "public", Name: "rank_1_prt_girls", PartitionRoot: "rank", Oid: 2, AttributeString: "(i,j)"}},
+			}
+			buffer := NewBuffer()
+			Expect(writeRestoreSections(buffer, []RestoreSection{GetInlineDataSection(dataEntries)})).To(Succeed())
+			Expect(string(buffer.Contents())).To(Equal(`
+-- Data (1)
+COPY public.rank(i,j) FROM stdin WITH CSV DELIMITER ',';
+1,a
+2,b
+\.
+`))
+		})
+		It("returns an error if the data of a segment is missing", func() {
+			writeSegmentFile(0, "1,a\n")
+			dataEntries := map[string][]toc.MasterDataEntry{
+				"20170101010101": {{Schema: "public", Name: "foo", Oid: 2, AttributeString: "(i,j)"}},
+			}
+			buffer := NewBuffer()
+			err := writeRestoreSections(buffer, []RestoreSection{GetInlineDataSection(dataEntries)})
+			Expect(err).To(MatchError(ContainSubstring("Could not read data of table public.foo")))
+		})
+	})
+})
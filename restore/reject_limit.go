@@ -0,0 +1,84 @@
+package restore
+
+/*
+ * This file contains functions for --segment-reject-limit, which loads the
+ * data of each table in single row error isolation mode, so that rows that
+ * cannot be loaded, such as those violating a constraint that changed since
+ * the backup, are logged to the error log of the table instead of failing
+ * the whole table.
+ */
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+var (
+	rejectedRows      map[string]int64
+	rejectedRowsMutex sync.Mutex
+)
+
+/*
+ * Converts a limit given as a number of rows, such as "100", or as a
+ * percentage of the rows of each segment, such as "5%", into the error
+ * handling clause of a COPY statement.
+ */
+func GetSegmentRejectLimitClause(limit string) (string, error) {
+	if limit == "" {
+		return "", nil
+	}
+	invalidLimitErr := errors.Errorf("Invalid value '%s' for --segment-reject-limit.  The limit must be a number of rows of at least 2, or a percentage between 1%% and 100%%, such as '5%%'.", limit)
+	if strings.HasSuffix(limit, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(limit, "%"))
+		if err != nil || percent < 1 || percent > 100 {
+			return "", invalidLimitErr
+		}
+		return fmt.Sprintf("LOG ERRORS SEGMENT REJECT LIMIT %d PERCENT", percent), nil
+	}
+	rows, err := strconv.Atoi(limit)
+	if err != nil || rows < 2 {
+		return "", invalidLimitErr
+	}
+	return fmt.Sprintf("LOG ERRORS SEGMENT REJECT LIMIT %d ROWS", rows), nil
+}
+
+func isRejectLimitRestore() bool {
+	return MustGetFlagString(options.SEGMENT_REJECT_LIMIT) != ""
+}
+
+/*
+ * COPY reports only the rows it loaded, so the rows of a table that were
+ * rejected are those backed up but not restored.
+ */
+func recordRejectedRows(tableName string, numRows int64) {
+	gplog.Warn("%d rows of table %s were rejected; see gp_read_error_log('%s') for the rows and errors", numRows, tableName, utils.EscapeSingleQuotes(tableName))
+	rejectedRowsMutex.Lock()
+	defer rejectedRowsMutex.Unlock()
+	if rejectedRows == nil {
+		rejectedRows = make(map[string]int64)
+	}
+	rejectedRows[tableName] += numRows
+}
+
+func getRejectedRows(tableName string) int64 {
+	rejectedRowsMutex.Lock()
+	defer rejectedRowsMutex.Unlock()
+	return rejectedRows[tableName]
+}
+
+func FormatRejectedRows(rejectedRows map[string]int64) []string {
+	lines := make([]string, 0, len(rejectedRows))
+	for tableName, numRows := range rejectedRows {
+		lines = append(lines, fmt.Sprintf("%s: %d rows rejected", tableName, numRows))
+	}
+	sort.Strings(lines)
+	return lines
+}
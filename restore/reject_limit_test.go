@@ -0,0 +1,41 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/reject_limit tests", func() {
+	DescribeTable("GetSegmentRejectLimitClause returns the error handling clause of the COPY for valid limits",
+		func(limit string, expectedClause string) {
+			clause, err := restore.GetSegmentRejectLimitClause(limit)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clause).To(Equal(expectedClause))
+		},
+		Entry("no limit", "", ""),
+		Entry("a number of rows", "100", "LOG ERRORS SEGMENT REJECT LIMIT 100 ROWS"),
+		Entry("a percentage", "5%", "LOG ERRORS SEGMENT REJECT LIMIT 5 PERCENT"),
+	)
+	DescribeTable("GetSegmentRejectLimitClause returns an error for invalid limits",
+		func(limit string) {
+			_, err := restore.GetSegmentRejectLimitClause(limit)
+			Expect(err).To(MatchError("Invalid value '" + limit + "' for --segment-reject-limit.  The limit must be a number of rows of at least 2, or a percentage between 1% and 100%, such as '5%'."))
+		},
+		Entry("a single row", "1"),
+		Entry("a negative number", "-10"),
+		Entry("a percentage over 100", "150%"),
+		Entry("a fractional percentage", "0.5%"),
+		Entry("a word", "many"),
+	)
+	Describe("FormatRejectedRows", func() {
+		It("lists the rows rejected from each table in order", func() {
+			Expect(restore.FormatRejectedRows(map[string]int64{"public.foo": 1, "public.bar": 20})).To(Equal([]string{
+				"public.bar: 20 rows rejected",
+				"public.foo: 1 rows rejected",
+			}))
+		})
+	})
+})
@@ -6,9 +6,12 @@ import (
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
 )
 
@@ -16,10 +19,21 @@ import (
  * Functions to run commands on entire cluster during restore
  */
 
+// The default port on which the PXF service listens on each segment host
+const pxfPort = 5888
+
 func VerifyBackupDirectoriesExistOnAllHosts() {
 	_, err := globalCluster.ExecuteLocalCommand(fmt.Sprintf("test -d %s", globalFPInfo.GetDirForContent(-1)))
 	gplog.FatalOnError(err, "Backup directory %s missing or inaccessible", globalFPInfo.GetDirForContent(-1))
-	if MustGetFlagString(options.PLUGIN_CONFIG) == "" || backupConfig.SingleDataFile {
+	if isResizeRestore() {
+		// Each segment reads the backup directories of the backup segments mapped to it
+		remoteOutput := globalCluster.GenerateAndExecuteCommand("Verifying backup directories are readable", cluster.ON_SEGMENTS, func(contentID int) string {
+			return getResizeBackupDirsCommand(contentID, "test -d %[1]s -a -r %[1]s -a -x %[1]s")
+		})
+		globalCluster.CheckClusterError(remoteOutput, "Backup directories missing or inaccessible", func(contentID int) string {
+			return fmt.Sprintf("Backup directories %s missing or inaccessible", strings.Join(getResizeBackupDirs(contentID), ", "))
+		})
+	} else if MustGetFlagString(options.PLUGIN_CONFIG) == "" || backupConfig.SingleDataFile {
 		remoteOutput := globalCluster.GenerateAndExecuteCommand("Verifying backup directories exist", cluster.ON_SEGMENTS, func(contentID int) string {
 			return fmt.Sprintf("test -d %s", globalFPInfo.GetDirForContent(contentID))
 		})
@@ -50,6 +64,39 @@ func VerifyBackupFileCountOnSegments(fileCount int) {
 	}
 }
 
+/*
+ * Checks that each segment can read all of the backup files of every backup
+ * segment mapped to it, before any data is restored from them.
+ */
+func VerifyResizeBackupFileCountOnSegments(fileCount int) {
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Verifying backup files are readable", cluster.ON_SEGMENTS, func(contentID int) string {
+		return getResizeBackupDirsCommand(contentID, "find %[1]s -type f -readable | wc -l")
+	})
+	globalCluster.CheckClusterError(remoteOutput, "Could not verify backup file count", func(contentID int) string {
+		return "Could not verify backup file count"
+	})
+
+	numIncorrect := 0
+	for _, cmd := range remoteOutput.Commands {
+		backupDirs := getResizeBackupDirs(cmd.Content)
+		counts := strings.Fields(cmd.Stdout)
+		for i, backupDir := range backupDirs {
+			numFound := 0
+			if i < len(counts) {
+				numFound, _ = strconv.Atoi(counts[i])
+			}
+			if numFound != fileCount {
+				gplog.Verbose("Expected to find %d readable file(s) in %s from segment %d on host %s, but found %d instead.", fileCount, backupDir, cmd.Content, globalCluster.GetHostForContent(cmd.Content), numFound)
+				numIncorrect++
+				break
+			}
+		}
+	}
+	if numIncorrect > 0 {
+		cluster.LogFatalClusterError("Found incorrect number of backup files", cluster.ON_SEGMENTS, numIncorrect)
+	}
+}
+
 func VerifyMetadataFilePaths(withStats bool) {
 	filetypes := []string{"config", "table of contents", "metadata"}
 	missing := false
@@ -72,3 +119,39 @@ func VerifyMetadataFilePaths(withStats bool) {
 		gplog.Fatal(errors.Errorf("One or more metadata files do not exist or are not readable."), "Cannot proceed with restore")
 	}
 }
+
+/*
+ * PXF external tables restore successfully even if PXF is not running or the
+ * referenced servers are not configured on the destination cluster, but
+ * queries against them will fail.  Check that the pxf extension exists and
+ * that the PXF service responds on every segment host so the user is warned
+ * up front rather than at query time.
+ */
+func ValidatePXFService(references []history.PXFReference) {
+	if len(references) == 0 {
+		return
+	}
+	gplog.Info("Validating PXF service availability")
+	servers := make([]string, 0)
+	for _, reference := range references {
+		if !utils.Exists(servers, reference.Server) {
+			servers = append(servers, reference.Server)
+		}
+	}
+	gplog.Info("Restored external tables reference PXF server(s) %s; ensure these servers are configured on all segment hosts", strings.Join(servers, ", "))
+
+	extensionCount := dbconn.MustSelectString(connectionPool, "SELECT count(*) AS string FROM pg_extension WHERE extname = 'pxf'")
+	if extensionCount == "0" {
+		gplog.Warn("The pxf extension does not exist in database %s; PXF external tables will not be usable until it is created", connectionPool.DBName)
+	}
+
+	remoteOutput := globalCluster.GenerateAndExecuteCommand("Checking PXF service availability", cluster.ON_HOSTS, func(host string) string {
+		return fmt.Sprintf("curl --silent --fail --max-time 10 http://localhost:%d/actuator/health >/dev/null || curl --silent --fail --max-time 10 http://localhost:%d/pxf/ProtocolVersion >/dev/null", pxfPort, pxfPort)
+	})
+	for _, failedCommand := range remoteOutput.FailedCommands {
+		gplog.Warn("PXF service is not responding on host %s", failedCommand.Host)
+	}
+	if remoteOutput.NumErrors == 0 {
+		gplog.Info("PXF service validation complete")
+	}
+}
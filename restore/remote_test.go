@@ -3,14 +3,17 @@ package restore_test
 import (
 	"os/user"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/restore"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("restore/remote tests", func() {
@@ -78,4 +81,72 @@ var _ = Describe("restore/remote tests", func() {
 			restore.VerifyBackupFileCountOnSegments(2)
 		})
 	})
+	Describe("restoring a backup taken on a different number of segments", func() {
+		BeforeEach(func() {
+			restore.SetCluster(testCluster)
+			restore.SetFPInfo(filepath.NewFilePathInfo(testCluster, "/backups", "20170101010101", "gpseg"))
+			restore.SetBackupConfig(&history.BackupConfig{SegmentCount: 3})
+		})
+		AfterEach(func() {
+			restore.SetBackupConfig(&history.BackupConfig{})
+		})
+		It("checks the backup directories of every backup segment mapped to each segment", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{}
+			restore.VerifyBackupDirectoriesExistOnAllHosts()
+			Expect(testExecutor.NumExecutions).To(Equal(2))
+			commands := testExecutor.ClusterCommands[0]
+			Expect(commands[0].CommandString).To(ContainSubstring("true && test -d /backups/gpseg0/backups/20170101/20170101010101 -a -r /backups/gpseg0/backups/20170101/20170101010101 -a -x /backups/gpseg0/backups/20170101/20170101010101 && test -d /backups/gpseg2/backups/20170101/20170101010101"))
+			Expect(commands[1].CommandString).To(ContainSubstring("true && test -d /backups/gpseg1/backups/20170101/20170101010101"))
+			Expect(commands[1].CommandString).ToNot(ContainSubstring("gpseg2"))
+		})
+		It("counts the readable backup files of every backup segment mapped to each segment", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Commands: []cluster.ShellCommand{
+					{Content: 0, Stdout: "2\n2\n"},
+					{Content: 1, Stdout: "2\n"},
+				},
+			}
+			restore.VerifyResizeBackupFileCountOnSegments(2)
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+			Expect(testExecutor.ClusterCommands[0][0].CommandString).To(ContainSubstring("find /backups/gpseg0/backups/20170101/20170101010101 -type f -readable | wc -l && find /backups/gpseg2/backups/20170101/20170101010101 -type f -readable | wc -l"))
+		})
+		It("panics if a segment cannot read all files of a backup segment mapped to it", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Commands: []cluster.ShellCommand{
+					{Content: 0, Stdout: "2\n1\n"},
+					{Content: 1, Stdout: "2\n"},
+				},
+			}
+			defer testhelper.ShouldPanicWithMessage("Found incorrect number of backup files on 1 segment")
+			restore.VerifyResizeBackupFileCountOnSegments(2)
+		})
+	})
+	Describe("ValidatePXFService", func() {
+		references := []history.PXFReference{{Server: "hadoop", Profile: "hdfs:text"}}
+		BeforeEach(func() {
+			restore.SetCluster(testCluster)
+		})
+		It("does nothing if no PXF servers are referenced", func() {
+			restore.ValidatePXFService([]history.PXFReference{})
+			Expect(testExecutor.NumExecutions).To(Equal(0))
+		})
+		It("checks the PXF service on each host", func() {
+			mock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow("1"))
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{}
+			restore.ValidatePXFService(references)
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+			Expect(testExecutor.ClusterCommands[0][0].CommandString).To(ContainSubstring("curl --silent --fail --max-time 10 http://localhost:5888/actuator/health"))
+			Expect(logfile).To(Say("PXF service validation complete"))
+		})
+		It("warns if the pxf extension is missing or the service is not responding", func() {
+			mock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow("0"))
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				NumErrors:      1,
+				FailedCommands: []*cluster.ShellCommand{{Host: "remotehost1"}},
+			}
+			restore.ValidatePXFService(references)
+			Expect(logfile).To(Say("The pxf extension does not exist in database testdb"))
+			Expect(logfile).To(Say("PXF service is not responding on host remotehost1"))
+		})
+	})
 })
@@ -0,0 +1,132 @@
+package restore
+
+/*
+ * This file contains functions for restoring a backup to a cluster with a
+ * different number of segments than the cluster it was taken on.
+ *
+ * Each segment of the restore cluster loads the data files of every backup
+ * segment whose content ID maps to it (content ID modulo the number of
+ * restore segments), so a larger backup is merged onto fewer segments and a
+ * smaller backup leaves the extra segments with nothing to load.  The files
+ * are read from a --backup-dir that every segment host can read.  Rows are
+ * loaded without checking that they belong on the segment loading them, and
+ * each table is then reorganized to move its rows to the correct segments.
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func getRestoreSegmentCount() int {
+	return len(globalCluster.ContentIDs) - 1
+}
+
+/*
+ * Backups taken before the segment count was recorded are assumed to match
+ * the restore cluster, as was always required of them.
+ */
+func isResizeRestore() bool {
+	if backupConfig == nil || backupConfig.SegmentCount == 0 || globalCluster == nil {
+		return false
+	}
+	// A restore script is written for a cluster with as many segments as the backup
+	if MustGetFlagString(options.TO_FILE) != "" {
+		return false
+	}
+	return backupConfig.SegmentCount != getRestoreSegmentCount()
+}
+
+/*
+ * Loading rows on the wrong segment requires gp_enable_segment_copy_checking,
+ * which was added in GPDB 6, and the data of a single data file backup is
+ * read by gpbackup_helper from the data file of one backup segment only.
+ * Each segment reads the files of other backup segments, so they must be in
+ * a backup directory that every segment host can read them from.
+ */
+func ValidateResizeRestore() {
+	if !isResizeRestore() {
+		return
+	}
+	if MustGetFlagString(options.BACKUP_DIR) == "" {
+		gplog.Fatal(errors.Errorf("Cannot restore backup %s, taken on %d segments, to a cluster with %d segments without --backup-dir. The backup files of every segment must be in a backup directory that all segment hosts can read.",
+			backupConfig.Timestamp, backupConfig.SegmentCount, getRestoreSegmentCount()), "")
+	}
+	if backupConfig.SingleDataFile {
+		gplog.Fatal(errors.Errorf("Cannot restore backup %s, taken with --single-data-file on %d segments, to a cluster with %d segments.",
+			backupConfig.Timestamp, backupConfig.SegmentCount, getRestoreSegmentCount()), "")
+	}
+	if connectionPool.Version.Before("6") {
+		gplog.Fatal(errors.Errorf("Restoring a backup to a cluster with a different number of segments requires GPDB 6 or later."), "")
+	}
+	gplog.Info("Backup was taken on %d segments; data will be redistributed across %d segments", backupConfig.SegmentCount, getRestoreSegmentCount())
+}
+
+/*
+ * Returns the backup directories of the backup segments whose data files are
+ * loaded by the restore segment with the given content ID.
+ */
+func getResizeBackupDirs(contentID int) []string {
+	backupDirs := make([]string, 0)
+	for backupContentID := contentID; backupContentID < backupConfig.SegmentCount; backupContentID += getRestoreSegmentCount() {
+		backupDirs = append(backupDirs, globalFPInfo.GetDirForContent(backupContentID))
+	}
+	return backupDirs
+}
+
+/*
+ * Returns a command that runs commandFormat, with %[1]s as the directory, on
+ * each backup directory read by the restore segment with the given content ID.
+ */
+func getResizeBackupDirsCommand(contentID int, commandFormat string) string {
+	commands := []string{"true"}
+	for _, backupDir := range getResizeBackupDirs(contentID) {
+		commands = append(commands, fmt.Sprintf(commandFormat, backupDir))
+	}
+	return strings.Join(commands, " && ")
+}
+
+/*
+ * Returns a COPY PROGRAM command that runs readCommand once for each backup
+ * segment mapped to the restore segment running it, with the content ID of
+ * the backup segment in place of <SEGID> in readCommand and in the path of
+ * the file to read.
+ */
+func GetResizeCopyProgram(readCommand string, destinationToRead string, pipeCommand string, backupSegmentCount int, restoreSegmentCount int) string {
+	backupSegmentRead := strings.Replace(readCommand, "<SEGID>", "${segid}", -1)
+	backupSegmentFile := strings.Replace(destinationToRead, "<SEGID>", "${segid}", -1)
+	return fmt.Sprintf("PROGRAM 'for segid in $(seq <SEGID> %d %d); do %s %s | %s || exit 1; done'",
+		restoreSegmentCount, backupSegmentCount-1, backupSegmentRead, backupSegmentFile, pipeCommand)
+}
+
+/*
+ * Replicated tables hold every row on every segment, so they cannot be
+ * rebuilt from the data of a different number of segments.
+ */
+func CheckTableCanBeResized(connectionPool *dbconn.DBConn, tableName string, whichConn int) error {
+	query := fmt.Sprintf(`SELECT (count(*) > 0)::text AS string FROM gp_distribution_policy WHERE localoid = '%s'::regclass AND policytype = 'r'`, utils.EscapeSingleQuotes(tableName))
+	isReplicated, err := dbconn.SelectString(connectionPool, query, whichConn)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error checking distribution policy of table %s", tableName))
+	}
+	if isReplicated == "true" {
+		return errors.Errorf("Cannot restore replicated table %s to a cluster with a different number of segments", tableName)
+	}
+	return nil
+}
+
+func RedistributeTableData(connectionPool *dbconn.DBConn, tableName string, whichConn int) error {
+	query := fmt.Sprintf("ALTER TABLE %s SET WITH (REORGANIZE=true);", tableName)
+	gplog.Verbose(query)
+	_, err := connectionPool.Exec(query, whichConn)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error redistributing data of table %s", tableName))
+	}
+	return nil
+}
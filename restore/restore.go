@@ -6,11 +6,14 @@ import (
 	"os"
 	"regexp"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
@@ -29,7 +32,18 @@ func DoInit(cmd *cobra.Command) {
 	gplog.InitializeLogging("gprestore", "")
 	SetCmdFlags(cmd.Flags())
 	_ = cmd.MarkFlagRequired(options.TIMESTAMP)
+	cmd.PreRun = func(cmd *cobra.Command, args []string) {
+		if MustGetFlagBool(options.MACHINE_OUTPUT) {
+			machineOutput = utils.RedirectOutputToStderr("gprestore")
+		}
+		// An import loads files rather than a backup, so it has no timestamp
+		if MustGetFlagString(options.IMPORT_TABLE) != "" {
+			_ = cmd.Flags().SetAnnotation(options.TIMESTAMP, cobra.BashCompOneRequiredFlag, []string{"false"})
+		}
+	}
 	utils.InitializeSignalHandler(DoCleanup, "restore process", &wasTerminated)
+	dataCopyPause = utils.InitializePauseSignalHandler("restore process", func(paused bool) { runStatus.SetPaused(paused) })
+	logLevelControl = utils.InitializeLogLevelHandler("restore process")
 }
 
 /*
@@ -42,14 +56,55 @@ func DoValidation(cmd *cobra.Command) {
 	gplog.FatalOnError(err)
 	err = utils.ValidateFullPath(MustGetFlagString(options.PLUGIN_CONFIG))
 	gplog.FatalOnError(err)
-	if !filepath.IsValidTimestamp(MustGetFlagString(options.TIMESTAMP)) {
+	err = utils.ValidateFullPath(MustGetFlagString(options.SLA_FILE))
+	gplog.FatalOnError(err)
+	if MustGetFlagString(options.IMPORT_TABLE) == "" && !filepath.IsValidTimestamp(MustGetFlagString(options.TIMESTAMP)) {
 		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", MustGetFlagString(options.TIMESTAMP)), "")
 	}
+	_, err = options.ParseConcurrencyLimits(MustGetFlagStringToInt(options.MAX_CONCURRENT))
+	gplog.FatalOnError(err)
+	err = ValidateConflictFlagValues(MustGetFlagString(options.ON_CONFLICT), MustGetFlagString(options.CONFLICT_SUFFIX))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.RETRY_FAILED))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.TRANSFORM_PLUGIN))
+	gplog.FatalOnError(err)
+	err = utils.ValidateProgressMode(MustGetFlagString(options.PROGRESS))
+	gplog.FatalOnError(err)
+	_, err = utils.ParseJobs(MustGetFlagString(options.JOBS))
+	gplog.FatalOnError(err)
+	err = ValidateRunAnalyzeMode(MustGetFlagString(options.RUN_ANALYZE))
+	gplog.FatalOnError(err)
+	err = ValidatePhases(MustGetFlagStringSlice(options.PHASE))
+	gplog.FatalOnError(err)
+	err = ValidateACLMode(MustGetFlagString(options.ACL_MODE))
+	gplog.FatalOnError(err)
+	err = ValidateRefreshMatviewsMode(MustGetFlagString(options.REFRESH_MATVIEWS))
+	gplog.FatalOnError(err)
+	_, err = GetSegmentRejectLimitClause(MustGetFlagString(options.SEGMENT_REJECT_LIMIT))
+	gplog.FatalOnError(err)
+	if keyFilename := MustGetFlagString(options.CREDENTIALS_KEY_FILE); keyFilename != "" {
+		_, err = utils.ReadCredentialsKey(keyFilename)
+		gplog.FatalOnError(err)
+	}
+	err = ValidateExtensionVersionsPolicy(MustGetFlagString(options.EXTENSION_VERSIONS))
+	gplog.FatalOnError(err)
+	err = ValidateToFileFormat(MustGetFlagString(options.TO_FILE_FORMAT), MustGetFlagStringArray(options.KEEP_GREENPLUM_SYNTAX))
+	gplog.FatalOnError(err)
+	err = ValidateExtractFormat(MustGetFlagString(options.EXTRACT_FORMAT))
+	gplog.FatalOnError(err)
+	for _, flagName := range []string{options.STATEMENT_TIMEOUT_PRE, options.STATEMENT_TIMEOUT_POST} {
+		if MustGetFlagInt(flagName) < 0 {
+			gplog.Fatal(errors.Errorf("--%s must not be negative", flagName), "")
+		}
+	}
+	validateStorageFlagValues()
 }
 
 // This function handles setup that must be done after parsing flags.
 func DoSetup() {
 	SetLoggerVerbosity()
+	utils.SetProgressMode(MustGetFlagString(options.PROGRESS))
 	gplog.Verbose("Restore Command: %s", os.Args)
 
 	utils.CheckGpexpandRunning(utils.RestorePreventedByGpexpandMessage)
@@ -58,6 +113,7 @@ func DoSetup() {
 	gplog.Info("Restore Key = %s", backupTimestamp)
 
 	CreateConnectionPool("postgres")
+	configureS3Storage()
 
 	var segPrefix string
 	var err error
@@ -75,6 +131,12 @@ func DoSetup() {
 	segPrefix, err = filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), backupTimestamp)
 	gplog.FatalOnError(err)
 	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), backupTimestamp, segPrefix)
+	if unchangedSince := FindUnchangedSinceTimestamp(backupTimestamp); unchangedSince != "" {
+		gplog.Info("Backup %s recorded no changes since backup %s, which will be restored instead", backupTimestamp, unchangedSince)
+		backupTimestamp = unchangedSince
+		_ = cmdFlags.Set(options.TIMESTAMP, backupTimestamp)
+		globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), backupTimestamp, segPrefix)
+	}
 
 	// Get restore metadata from plugin
 	if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
@@ -88,6 +150,8 @@ func DoSetup() {
 	gplog.Info("Greenplum Database Version = %s", connectionPool.Version.VersionString)
 
 	BackupConfigurationValidation()
+	registerStatementTransformersFromFlags()
+	includePartitions()
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
 	if !backupConfig.DataOnly {
 		gplog.Verbose("Metadata will be restored from %s", metadataFilename)
@@ -96,12 +160,33 @@ func DoSetup() {
 	if MustGetFlagString(options.REDIRECT_DB) != "" {
 		unquotedRestoreDatabase = MustGetFlagString(options.REDIRECT_DB)
 	}
+	runStatus = utils.NewStatusTracker(globalFPInfo.GetRestoreStatusFilePath(restoreStartTime), "gprestore", restoreStartTime, unquotedRestoreDatabase)
+	logLevelControl.SetControlFile(globalFPInfo.GetRestoreLogLevelFilePath(restoreStartTime))
+	if err := runStatus.RecordProgressTo(globalFPInfo.GetRestoreProgressFilePath(restoreStartTime)); err != nil {
+		gplog.Warn("Unable to create restore progress file: %v", err)
+	}
+	checkRestorePhases(unquotedRestoreDatabase)
 	ValidateDatabaseExistence(unquotedRestoreDatabase, MustGetFlagBool(options.CREATE_DB), backupConfig.IncludeTableFiltered || backupConfig.DataOnly)
+	if slaFile := MustGetFlagString(options.SLA_FILE); slaFile != "" {
+		slaTargets, err = report.ReadSLATargets(slaFile, unquotedRestoreDatabase)
+		gplog.FatalOnError(err)
+	}
+	if retryFile := MustGetFlagString(options.RETRY_FAILED); retryFile != "" {
+		retryObjects, err = ReadFailedObjectsFile(retryFile)
+		gplog.FatalOnError(err)
+		gplog.Info("Restoring only the %d objects listed in %s", len(retryObjects), retryFile)
+	}
+	if MustGetFlagBool(options.RESTORE_GLOBALS) {
+		restoreClusterGlobals()
+	}
 	if MustGetFlagBool(options.WITH_GLOBALS) {
 		restoreGlobal(metadataFilename)
 	} else if MustGetFlagBool(options.CREATE_DB) {
 		createDatabase(metadataFilename)
 	}
+	if MustGetFlagBool(options.WITH_GLOBALS) || MustGetFlagBool(options.CREATE_DB) {
+		restoreSettings(metadataFilename)
+	}
 	if connectionPool != nil {
 		connectionPool.Close()
 	}
@@ -112,15 +197,18 @@ func DoSetup() {
 	 * should not error out for validation reasons once the restore database exists.
 	 * For on-error-continue, we will see the same errors later when we try to run SQL,
 	 * but since they will not stop the restore, it is not necessary to log them twice.
+	 * Relations whose objects are being retried, or that were created by the
+	 * predata phase of an earlier run, are expected to exist already.
 	 */
-	if !MustGetFlagBool(options.CREATE_DB) && !MustGetFlagBool(options.ON_ERROR_CONTINUE) && !MustGetFlagBool(options.INCREMENTAL) {
+	if !MustGetFlagBool(options.CREATE_DB) && !MustGetFlagBool(options.ON_ERROR_CONTINUE) && !MustGetFlagBool(options.INCREMENTAL) &&
+		MustGetFlagString(options.ON_CONFLICT) == "" && retryObjects == nil && shouldRestorePhase(PHASE_PREDATA) {
 		relationsToRestore := GenerateRestoreRelationList(*opts)
-		if opts.RedirectSchema != "" {
+		if opts.RedirectSchema != "" || isSchemaRenameRun() {
 			fqns, err := options.SeparateSchemaAndTable(relationsToRestore)
 			gplog.FatalOnError(err)
 			redirectRelationsToRestore := make([]string, 0)
 			for _, fqn := range fqns {
-				redirectRelationsToRestore = append(redirectRelationsToRestore, utils.MakeFQN(opts.RedirectSchema, fqn.TableName))
+				redirectRelationsToRestore = append(redirectRelationsToRestore, utils.MakeFQN(getRestoreSchema(fqn.SchemaName), fqn.TableName))
 			}
 			relationsToRestore = redirectRelationsToRestore
 		}
@@ -130,6 +218,7 @@ func DoSetup() {
 	if opts.RedirectSchema != "" {
 		ValidateRedirectSchema(connectionPool, opts.RedirectSchema)
 	}
+	ValidateSchemaRenames(getSchemaRenames())
 }
 
 func DoRestore() {
@@ -142,49 +231,101 @@ func DoRestore() {
 	if isIncremental {
 		verifyIncrementalState()
 	}
+	if !isMetadataOnly && shouldRestorePhase(PHASE_DATA) {
+		checkRestoreDiskSpace()
+	}
 
-	if !isDataOnly && !isIncremental {
+	if !isDataOnly && !isIncremental && shouldRestorePhase(PHASE_PREDATA) {
+		phaseStart := time.Now()
+		resolveRelationConflicts(metadataFilename)
 		restorePredata(metadataFilename)
+		// The values written to the metadata file may be behind those recorded once the data was copied
+		if len(globalTOC.SequenceValues) > 0 {
+			restoreSequenceValues(metadataFilename, true)
+		}
+		recordPhaseDuration(PHASE_PREDATA, phaseStart)
+		completeRestorePhase(PHASE_PREDATA)
 	} else if isDataOnly {
-		// The sequence setval commands need to be run during data only restores since
+		if MustGetFlagBool(options.VERIFY_TABLE_DEFS) {
+			verifyTableDefinitions(metadataFilename, getFilteredDataEntries())
+		}
+		// The sequence values need to be restored during data only restores since
 		// they are arguably the data of the sequence relations and can affect user tables
 		// containing columns that reference those sequence relations.
-		restoreSequenceValues(metadataFilename)
+		restoreSequenceValues(metadataFilename, MustGetFlagBool(options.EXACT_SEQ_VALUES))
 	}
 
 	totalTablesRestored := 0
-	if !isMetadataOnly {
-		if MustGetFlagString(options.PLUGIN_CONFIG) == "" {
-			backupFileCount := 2 // 1 for the actual data file, 1 for the segment TOC file
-			if !backupConfig.SingleDataFile {
-				backupFileCount = len(globalTOC.DataEntries)
-			}
-			VerifyBackupFileCountOnSegments(backupFileCount)
+	if !isMetadataOnly && shouldRestorePhase(PHASE_DATA) {
+		phaseStart := time.Now()
+		if MustGetFlagString(options.PLUGIN_CONFIG) == "" && !isResizeRestore() {
+			VerifyBackupFileCountOnSegments(getBackupFileCount())
 		}
+		if MustGetFlagBool(options.EXCHANGE_PARTITION) {
+			createExchangeTables()
+		}
+		recordDataExcludedTables()
 		totalTablesRestored, filteredDataEntries = restoreData()
+		if MustGetFlagBool(options.VALIDATE_ROWCOUNTS) {
+			validateRowCounts(filteredDataEntries)
+		}
+		if MustGetFlagBool(options.EXCHANGE_PARTITION) {
+			exchangePartitions()
+		}
+		if MustGetFlagBool(options.ANALYZE_PARTITION_ROOTS) {
+			analyzePartitionRoots()
+		}
+		if MustGetFlagString(options.REFRESH_MATVIEWS) != "" {
+			refreshMaterializedViews(metadataFilename)
+		}
+		recordPhaseDuration(PHASE_DATA, phaseStart)
+	}
+	if shouldRestorePhase(PHASE_DATA) {
+		completeRestorePhase(PHASE_DATA)
 	}
 
-	if !isDataOnly && !isIncremental {
+	if !isDataOnly && !isIncremental && shouldRestorePhase(PHASE_POSTDATA) {
+		phaseStart := time.Now()
 		restorePostdata(metadataFilename)
+		if !wasTerminated {
+			ValidatePXFService(backupConfig.PXFReferences)
+		}
+		recordPhaseDuration(PHASE_POSTDATA, phaseStart)
+		completeRestorePhase(PHASE_POSTDATA)
 	}
 
+	if !shouldRestorePhase(PHASE_STATISTICS) {
+		return
+	}
+	phaseStart := time.Now()
 	if MustGetFlagBool(options.WITH_STATS) && backupConfig.WithStatistics {
 		restoreStatistics()
-	} else if MustGetFlagBool(options.RUN_ANALYZE) && totalTablesRestored > 0 {
-		runAnalyze(filteredDataEntries)
+	} else if MustGetFlagString(options.RUN_ANALYZE) != "" {
+		// The data may have been restored by an earlier run with --phase
+		if !shouldRestorePhase(PHASE_DATA) && !isMetadataOnly {
+			filteredDataEntries = getFilteredDataEntries()
+			for _, entries := range filteredDataEntries {
+				totalTablesRestored += len(entries)
+			}
+		}
+		if totalTablesRestored > 0 {
+			if MustGetFlagBool(options.WITH_STATS) {
+				gplog.Warn("Backup %s has no statistics, running ANALYZE on restored tables instead", globalFPInfo.Timestamp)
+			}
+			runAnalyze(filteredDataEntries)
+		}
 	}
+	recordPhaseDuration(PHASE_STATISTICS, phaseStart)
+	completeRestorePhase(PHASE_STATISTICS)
 }
 
 func createDatabase(metadataFilename string) {
-	objectTypes := []string{"SESSION GUCS", "DATABASE GUC", "DATABASE", "DATABASE METADATA"}
 	dbName := backupConfig.DatabaseName
-	gplog.Info("Creating database")
-	statements := GetRestoreMetadataStatements("global", metadataFilename, objectTypes, []string{})
 	if MustGetFlagString(options.REDIRECT_DB) != "" {
-		quotedDBName := utils.QuoteIdent(connectionPool, MustGetFlagString(options.REDIRECT_DB))
-		dbName = quotedDBName
-		statements = toc.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, quotedDBName)
+		dbName = getQuotedRedirectDatabase()
 	}
+	gplog.Info("Creating database")
+	statements := getCreateDatabaseStatements(metadataFilename)
 	numErrors := ExecuteRestoreMetadataStatements(statements, "", nil, utils.PB_NONE, false)
 
 	if numErrors > 0 {
@@ -194,27 +335,125 @@ func createDatabase(metadataFilename string) {
 	}
 }
 
+func getCreateDatabaseStatements(metadataFilename string) []toc.StatementWithType {
+	objectTypes := []string{"SESSION GUCS", "DATABASE", "DATABASE METADATA"}
+	statements := GetRestoreMetadataStatements("global", metadataFilename, objectTypes, []string{})
+	if MustGetFlagString(options.REDIRECT_DB) != "" {
+		statements = toc.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, getQuotedRedirectDatabase())
+	}
+	return editCreateDatabaseStatement(statements)
+}
+
+/*
+ * The CREATE DATABASE statement in the metadata file only names the settings
+ * that differ from template0 of the backed up cluster, so with
+ * --create-db-with-options it is replaced by one naming every setting
+ * recorded in the backup config.
+ */
+func editCreateDatabaseStatement(statements []toc.StatementWithType) []toc.StatementWithType {
+	if !MustGetFlagBool(options.CREATE_DB_OPTIONS) {
+		return statements
+	}
+	dbName := backupConfig.DatabaseName
+	if MustGetFlagString(options.REDIRECT_DB) != "" {
+		dbName = getQuotedRedirectDatabase()
+	}
+	for i, statement := range statements {
+		if statement.ObjectType == "DATABASE" {
+			statements[i].Statement = GetCreateDatabaseWithOptionsStatement(dbName, backupConfig)
+		}
+	}
+	return statements
+}
+
+func GetCreateDatabaseWithOptionsStatement(dbName string, config *history.BackupConfig) string {
+	statement := fmt.Sprintf("\n\nCREATE DATABASE %s TEMPLATE template0", dbName)
+	if config.DatabaseTablespace != "" {
+		statement += fmt.Sprintf(" TABLESPACE %s", config.DatabaseTablespace)
+	}
+	statement += fmt.Sprintf(" ENCODING '%s'", config.DatabaseEncoding)
+	// GPDB versions before 6 do not record a locale per database
+	if config.DatabaseCollate != "" {
+		statement += fmt.Sprintf(" LC_COLLATE '%s'", config.DatabaseCollate)
+	}
+	if config.DatabaseCType != "" {
+		statement += fmt.Sprintf(" LC_CTYPE '%s'", config.DatabaseCType)
+	}
+	return statement + ";"
+}
+
 func restoreGlobal(metadataFilename string) {
-	objectTypes := []string{"SESSION GUCS", "DATABASE GUC", "DATABASE METADATA", "RESOURCE QUEUE", "RESOURCE GROUP", "ROLE", "ROLE GUCS", "ROLE GRANT", "TABLESPACE"}
+	if backupConfig.GlobalsFile {
+		restoreClusterGlobals()
+	}
+	gplog.Info("Restoring global metadata")
+	statements := getGlobalStatements(metadataFilename)
+	numErrors := ExecuteRestoreMetadataStatements(statements, "Global objects", nil, utils.PB_VERBOSE, false)
+
+	if numErrors > 0 {
+		gplog.Info("Global database metadata restore completed with failures")
+	} else {
+		gplog.Info("Global database metadata restore complete")
+	}
+}
+
+func getGlobalStatements(metadataFilename string) []toc.StatementWithType {
+	objectTypes := []string{"SESSION GUCS", "DATABASE METADATA", "RESOURCE QUEUE", "RESOURCE GROUP", "ROLE", "ROLE GRANT", "TABLESPACE"}
 	if MustGetFlagBool(options.CREATE_DB) {
 		objectTypes = append(objectTypes, "DATABASE")
 	}
-	gplog.Info("Restoring global metadata")
 	statements := GetRestoreMetadataStatements("global", metadataFilename, objectTypes, []string{})
 	if MustGetFlagString(options.REDIRECT_DB) != "" {
-		quotedDBName := utils.QuoteIdent(connectionPool, MustGetFlagString(options.REDIRECT_DB))
-		statements = toc.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, quotedDBName)
+		statements = toc.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, getQuotedRedirectDatabase())
 	}
-	statements = toc.RemoveActiveRole(connectionPool.User, statements)
-	numErrors := ExecuteRestoreMetadataStatements(statements, "Global objects", nil, utils.PB_VERBOSE, false)
+	return editStatementsForTransformers(removeActiveRole(editCreateDatabaseStatement(statements)))
+}
+
+/*
+ * Names are quoted by the restore database, except when writing a restore
+ * script with --to-file, which does not connect to a database.
+ */
+func getQuotedRedirectDatabase() string {
+	if connectionPool == nil {
+		return utils.QuoteIdentWithoutConnection(MustGetFlagString(options.REDIRECT_DB))
+	}
+	return utils.QuoteIdent(connectionPool, MustGetFlagString(options.REDIRECT_DB))
+}
+
+/*
+ * The role restoring the backup already exists, so it is not created again.
+ * Without a connection the role that will run the statements is not known,
+ * so no role is removed.
+ */
+func removeActiveRole(statements []toc.StatementWithType) []toc.StatementWithType {
+	if connectionPool == nil {
+		return statements
+	}
+	return toc.RemoveActiveRole(connectionPool.User, statements)
+}
+
+/*
+ * Restores the cluster-level global objects in the globals file of a backup
+ * taken with --with-globals, before anything in the restore database.
+ */
+func restoreClusterGlobals() {
+	globalsFilename := globalFPInfo.GetGlobalsFilePath()
+	gplog.Info("Restoring cluster-level global metadata from %s", globalsFilename)
+	statements := getClusterGlobalStatements()
+	numErrors := ExecuteRestoreMetadataStatements(statements, "Cluster-level global objects", nil, utils.PB_VERBOSE, false)
 
 	if numErrors > 0 {
-		gplog.Info("Global database metadata restore completed with failures")
+		gplog.Info("Cluster-level global metadata restore completed with failures")
 	} else {
-		gplog.Info("Global database metadata restore complete")
+		gplog.Info("Cluster-level global metadata restore complete")
 	}
 }
 
+func getClusterGlobalStatements() []toc.StatementWithType {
+	statements := GetRestoreMetadataStatements("cluster", globalFPInfo.GetGlobalsFilePath(), []string{}, []string{})
+	return removeActiveRole(statements)
+}
+
 func verifyIncrementalState() {
 	lastRestorePlanEntry := backupConfig.RestorePlan[len(backupConfig.RestorePlan)-1]
 	tableFQNsToRestore := lastRestorePlanEntry.TableFQNs
@@ -279,15 +518,9 @@ func restorePredata(metadataFilename string) {
 		return
 	}
 	gplog.Info("Restoring pre-data metadata")
-	// if not incremental restore - assume database is empty and just filter based on user input
-	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
-	var schemaStatements []toc.StatementWithType
-	if opts.RedirectSchema == "" {
-		schemaStatements = GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{"SCHEMA"}, []string{}, filters)
-	}
-	statements := GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{}, []string{"SCHEMA"}, filters)
-
-	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	runStatus.SetPhase("Pre-data metadata")
+	defer setPhaseStatementTimeout(PHASE_PREDATA, MustGetFlagInt(options.STATEMENT_TIMEOUT_PRE))()
+	schemaStatements, statements := getPredataStatements(metadataFilename)
 	progressBar := utils.NewProgressBar(len(schemaStatements)+len(statements), "Pre-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
 
@@ -304,18 +537,155 @@ func restorePredata(metadataFilename string) {
 	}
 }
 
-func restoreSequenceValues(metadataFilename string) {
-	if wasTerminated {
+/*
+ * Returns the statements creating schemas separately from the other pre-data
+ * statements, as schemas are created before everything else.
+ */
+func getPredataStatements(metadataFilename string) ([]toc.StatementWithType, []toc.StatementWithType) {
+	// if not incremental restore - assume database is empty and just filter based on user input
+	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+	var schemaStatements []toc.StatementWithType
+	if opts.RedirectSchema == "" {
+		schemaStatements = GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{"SCHEMA"}, []string{}, filters)
+	}
+	statements := GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{}, []string{"SCHEMA"}, filters)
+
+	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	editStatementsForSchemaRenames(schemaStatements)
+	editStatementsForSchemaRenames(statements)
+	editStatementsForDDLTranslation(statements)
+	editStatementsForExtensionVersions(statements, getExtensionVersionsPolicy())
+	editStatementsForRedactedCredentials(statements, getRedactedCredentials())
+	statements = editStatementsForConflicts(statements)
+	statements = editStatementsForACLMode(statements)
+	schemaStatements = editStatementsForACLMode(schemaStatements)
+	schemaStatements = filterStatementsForExcludedObjectTypes(schemaStatements)
+	statements = filterStatementsForExcludedObjectTypes(statements)
+	return editStatementsForTransformers(filterStatementsForRetry(schemaStatements)), editStatementsForTransformers(filterStatementsForRetry(statements))
+}
+
+func getExcludedObjectTypes() []string {
+	objectTypes := make([]string, 0)
+	for _, objectType := range MustGetFlagStringSlice(options.EXCLUDE_OBJECT_TYPE) {
+		objectTypes = append(objectTypes, strings.ToUpper(strings.TrimSpace(objectType)))
+	}
+	return objectTypes
+}
+
+/*
+ * Leaves out the statements for objects of the types given by
+ * --exclude-object-type, and records each object left out for the report.
+ */
+func filterStatementsForExcludedObjectTypes(statements []toc.StatementWithType) []toc.StatementWithType {
+	objectTypes := getExcludedObjectTypes()
+	if len(objectTypes) == 0 {
+		return statements
+	}
+	statements, excluded := ExcludeStatementsOfObjectTypes(statements, objectTypes)
+	excludedObjects = append(excludedObjects, excluded...)
+	return statements
+}
+
+/*
+ * Returns the statements for objects not of the given types, and a line for
+ * each object of those types, which may have several statements, such as an
+ * index and the comment on it.
+ */
+func ExcludeStatementsOfObjectTypes(statements []toc.StatementWithType, objectTypes []string) ([]toc.StatementWithType, []string) {
+	filteredStatements := make([]toc.StatementWithType, 0, len(statements))
+	excluded := make([]string, 0)
+	excludedSet := make(map[string]bool)
+	for _, statement := range statements {
+		if !utils.Exists(objectTypes, statement.ObjectType) {
+			filteredStatements = append(filteredStatements, statement)
+			continue
+		}
+		object := statement.Name
+		if statement.Schema != "" {
+			object = statement.Schema + "." + statement.Name
+		}
+		object = fmt.Sprintf("%s %s", statement.ObjectType, object)
+		if !excludedSet[object] {
+			excludedSet[object] = true
+			excluded = append(excluded, object)
+		}
+	}
+	return filteredStatements, excluded
+}
+
+/*
+ * The backed up versions of extensions are rarely available in a database of
+ * another major version, so --translate-ddl creates their default versions
+ * unless --extension-versions is given.
+ */
+func getExtensionVersionsPolicy() string {
+	if MustGetFlagBool(options.TRANSLATE_DDL) && !cmdFlags.Changed(options.EXTENSION_VERSIONS) {
+		return EXTENSION_VERSIONS_UPGRADE
+	}
+	return MustGetFlagString(options.EXTENSION_VERSIONS)
+}
+
+/*
+ * With --extension-versions upgrade, extensions are created at the default
+ * version available in the restore database rather than the backed up one.
+ * Backups taken before extension versions were recorded always do this.
+ */
+func editStatementsForExtensionVersions(statements []toc.StatementWithType, policy string) {
+	if policy != EXTENSION_VERSIONS_UPGRADE {
+		return
+	}
+	for i, statement := range statements {
+		if statement.ObjectType == "EXTENSION" {
+			statements[i].Statement = extensionVersionPattern.ReplaceAllString(statement.Statement, "")
+		}
+	}
+}
+
+/*
+ * Puts the credentials that gpbackup --redact-credentials moved out of the
+ * metadata file back into the statements creating foreign servers and user
+ * mappings.  Without the credentials, those objects are created with the
+ * placeholders in place of their credentials.
+ */
+func editStatementsForRedactedCredentials(statements []toc.StatementWithType, credentials map[string]string) {
+	if len(credentials) == 0 {
 		return
 	}
-	gplog.Info("Restoring sequence values")
+	for i, statement := range statements {
+		if statement.ObjectType == "FOREIGN SERVER" || statement.ObjectType == "USER MAPPING" {
+			statements[i].Statement = utils.RestoreCredentials(statement.Statement, credentials)
+		}
+	}
+}
+
+func getRedactedCredentials() map[string]string {
+	keyFilename := MustGetFlagString(options.CREDENTIALS_KEY_FILE)
+	if !backupConfig.CredentialsFile {
+		if keyFilename != "" {
+			gplog.Warn("Backup %s has no credentials file, so --credentials-key-file is ignored", globalFPInfo.Timestamp)
+		}
+		return nil
+	}
+	if keyFilename == "" {
+		gplog.Warn("Credentials of foreign servers and user mappings were redacted from backup %s.  Use --credentials-key-file to restore them.", globalFPInfo.Timestamp)
+		return nil
+	}
+	key, err := utils.ReadCredentialsKey(keyFilename)
+	gplog.FatalOnError(err)
+	credentials, err := utils.ReadCredentialsFile(globalFPInfo.GetCredentialsFilePath(), key)
+	gplog.FatalOnError(err)
+	gplog.Verbose("Restoring %d redacted credentials", len(credentials))
+	return credentials
+}
 
+func getSequenceValueStatements(metadataFilename string) []toc.StatementWithType {
 	// if not incremental restore - assume database is empty and just filter based on user input
 	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
 
 	// Extract out the setval calls for each SEQUENCE object
 	var sequenceValueStatements []toc.StatementWithType
 	statements := GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{"SEQUENCE"}, []string{}, filters)
+	statements = filterStatementsForRetry(statements)
 	re := regexp.MustCompile(`SELECT pg_catalog.setval\(.*`)
 	for _, statement := range statements {
 		matches := re.FindStringSubmatch(statement.Statement)
@@ -324,24 +694,7 @@ func restoreSequenceValues(metadataFilename string) {
 			sequenceValueStatements = append(sequenceValueStatements, statement)
 		}
 	}
-
-	numErrors := int32(0)
-	if len(sequenceValueStatements) == 0 {
-		gplog.Verbose("No sequence values to restore")
-	} else {
-		progressBar := utils.NewProgressBar(len(sequenceValueStatements), "Sequence values restored: ", utils.PB_VERBOSE)
-		progressBar.Start()
-		numErrors = ExecuteRestoreMetadataStatements(sequenceValueStatements, "Sequence values", progressBar, utils.PB_VERBOSE, true)
-		progressBar.Finish()
-	}
-
-	if wasTerminated {
-		gplog.Info("Sequence values restore incomplete")
-	} else if numErrors > 0 {
-		gplog.Info("Sequence values restore completed with failures")
-	} else {
-		gplog.Info("Sequence values restore complete")
-	}
+	return sequenceValueStatements
 }
 
 func editStatementsRedirectSchema(statements []toc.StatementWithType, redirectSchema string) {
@@ -365,6 +718,62 @@ func restoreData() (int, map[string][]toc.MasterDataEntry) {
 	if wasTerminated {
 		return -1, nil
 	}
+
+	totalTables := 0
+	var totalBytes int64
+	filteredDataEntries := getFilteredDataEntries()
+	for _, dataEntries := range filteredDataEntries {
+		totalTables += len(dataEntries)
+		for _, dataEntry := range dataEntries {
+			totalBytes += dataEntry.Size
+		}
+	}
+	objectCounts["Tables"] = totalTables
+	if MustGetFlagBool(options.TRUNCATE_TABLE) {
+		confirmTruncateTables(filteredDataEntries)
+	}
+	runStatus.StartData(int64(totalTables), totalBytes)
+	byteProgress := utils.UseByteProgress()
+	if byteProgress && totalBytes == 0 && totalTables > 0 {
+		// Backups taken without --progress=bytes do not record table sizes
+		gplog.Verbose("Table sizes were not recorded in this backup, so restore progress will be shown in tables")
+		byteProgress = false
+	}
+	var dataProgressBar utils.ProgressBar
+	if byteProgress {
+		dataProgressBar = utils.NewByteProgressBar(totalBytes, "Data restored: ", utils.PB_INFO)
+	} else {
+		dataProgressBar = utils.NewProgressBar(totalTables, "Tables restored: ", utils.PB_INFO)
+	}
+	dataProgressBar.Start()
+
+	gucStatements := setGUCsForConnection(nil, 0)
+	numErrors := int32(0)
+	for timestamp, entries := range filteredDataEntries {
+		gplog.Verbose("Restoring data for %d tables from backup with timestamp: %s", len(entries), timestamp)
+		numErrors = restoreDataFromTimestamp(GetBackupFPInfoForTimestamp(timestamp), entries, gucStatements, dataProgressBar, byteProgress)
+	}
+
+	dataProgressBar.Finish()
+	if len(rejectedRows) > 0 {
+		gplog.Warn("Rows of %d tables were rejected and logged to their error logs", len(rejectedRows))
+	}
+	if wasTerminated {
+		gplog.Info("Data restore incomplete")
+	} else if numErrors > 0 {
+		gplog.Info("Data restore completed with failures")
+	} else {
+		gplog.Info("Data restore complete")
+	}
+
+	return totalTables, filteredDataEntries
+}
+
+/*
+ * Returns the data entries of the tables to restore from each backup in the
+ * restore plan, keyed by backup timestamp.
+ */
+func getFilteredDataEntries() map[string][]toc.MasterDataEntry {
 	restorePlan := backupConfig.RestorePlan
 	restorePlanEntries := make([]history.RestorePlanEntry, 0)
 	if MustGetFlagBool(options.INCREMENTAL) {
@@ -376,7 +785,6 @@ func restoreData() (int, map[string][]toc.MasterDataEntry) {
 		}
 	}
 
-	totalTables := 0
 	filteredDataEntries := make(map[string][]toc.MasterDataEntry)
 	for _, entry := range restorePlanEntries {
 		fpInfo := GetBackupFPInfoForTimestamp(entry.Timestamp)
@@ -384,29 +792,73 @@ func restoreData() (int, map[string][]toc.MasterDataEntry) {
 		restorePlanTableFQNs := entry.TableFQNs
 		filteredDataEntriesForTimestamp := tocfile.GetDataEntriesMatching(opts.IncludedSchemas,
 			opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations, restorePlanTableFQNs)
+		if tocEditDataTables != nil {
+			filteredDataEntriesForTimestamp = FilterTOCEditDataEntries(filteredDataEntriesForTimestamp, tocEditDataTables)
+		}
+		filteredDataEntriesForTimestamp = editDataEntriesForConflicts(filteredDataEntriesForTimestamp)
+		if retryObjects != nil {
+			filteredDataEntriesForTimestamp = FilterRetryDataEntries(filteredDataEntriesForTimestamp, retryObjects)
+		}
 		filteredDataEntries[entry.Timestamp] = filteredDataEntriesForTimestamp
-		totalTables += len(filteredDataEntriesForTimestamp)
 	}
-	dataProgressBar := utils.NewProgressBar(totalTables, "Tables restored: ", utils.PB_INFO)
-	dataProgressBar.Start()
+	return filteredDataEntries
+}
 
-	gucStatements := setGUCsForConnection(nil, 0)
-	numErrors := int32(0)
-	for timestamp, entries := range filteredDataEntries {
-		gplog.Verbose("Restoring data for %d tables from backup with timestamp: %s", len(entries), timestamp)
-		numErrors = restoreDataFromTimestamp(GetBackupFPInfoForTimestamp(timestamp), entries, gucStatements, dataProgressBar)
+/*
+ * Records the tables to restore whose data was excluded from the backup with
+ * --exclude-table-data, which have no data files, for the report.
+ */
+func recordDataExcludedTables() {
+	entries := globalTOC.GetDataExcludedEntriesMatching(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+	if len(entries) == 0 {
+		return
+	}
+	gplog.Info("Skipping the data of %d table(s) whose data was excluded from the backup", len(entries))
+	for _, entry := range entries {
+		dataExcludedTables = append(dataExcludedTables, getRestoreTableFQN(entry.Schema, entry.Name))
 	}
+}
 
-	dataProgressBar.Finish()
+/*
+ * Compares the number of rows in each restored table against the number of
+ * rows recorded in the TOC at backup time.  Tables whose data failed to
+ * restore are skipped, as they have already been reported as errors.
+ */
+func validateRowCounts(filteredDataEntries map[string][]toc.MasterDataEntry) {
 	if wasTerminated {
-		gplog.Info("Data restore incomplete")
-	} else if numErrors > 0 {
-		gplog.Info("Data restore completed with failures")
-	} else {
-		gplog.Info("Data restore complete")
+		return
 	}
+	gplog.Info("Validating row counts of restored tables")
 
-	return totalTables, filteredDataEntries
+	for _, dataEntries := range filteredDataEntries {
+		for _, entry := range dataEntries {
+			tableFQN := getRestoreTableFQN(entry.Schema, entry.Name)
+			if _, ok := errorTablesData[tableFQN]; ok {
+				continue
+			}
+			rowCount, err := GetTableRowCount(connectionPool, tableFQN, 0)
+			if err != nil {
+				gplog.Error(err.Error())
+				rowCountMismatches = append(rowCountMismatches, fmt.Sprintf("%s: unable to count rows", tableFQN))
+				continue
+			}
+			// Rows rejected with --segment-reject-limit are reported separately
+			expectedRowCount := entry.RowsCopied - getRejectedRows(tableFQN)
+			if rowCount != expectedRowCount {
+				gplog.Error("Expected %d rows in table %s, but found %d", expectedRowCount, tableFQN, rowCount)
+				rowCountMismatches = append(rowCountMismatches, fmt.Sprintf("%s: expected %d rows, found %d", tableFQN, expectedRowCount, rowCount))
+			}
+		}
+	}
+	sort.Strings(rowCountMismatches)
+
+	if wasTerminated {
+		gplog.Info("Row count validation incomplete")
+	} else if len(rowCountMismatches) > 0 {
+		gplog.Info("Row count validation found %d mismatched table(s)", len(rowCountMismatches))
+	} else {
+		gplog.Info("Row count validation complete")
+	}
 }
 
 func restorePostdata(metadataFilename string) {
@@ -414,11 +866,10 @@ func restorePostdata(metadataFilename string) {
 		return
 	}
 	gplog.Info("Restoring post-data metadata")
+	runStatus.SetPhase("Post-data metadata")
+	defer setPhaseStatementTimeout(PHASE_POSTDATA, MustGetFlagInt(options.STATEMENT_TIMEOUT_POST))()
 
-	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
-
-	statements := GetRestoreMetadataStatementsFiltered("postdata", metadataFilename, []string{}, []string{}, filters)
-	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	statements := getPostdataStatements(metadataFilename)
 	firstBatch, secondBatch, thirdBatch := BatchPostdataStatements(statements)
 	progressBar := utils.NewProgressBar(len(statements), "Post-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
@@ -437,17 +888,28 @@ func restorePostdata(metadataFilename string) {
 	}
 }
 
+func getPostdataStatements(metadataFilename string) []toc.StatementWithType {
+	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+
+	statements := GetRestoreMetadataStatementsFiltered("postdata", metadataFilename, []string{}, []string{REFRESH_MATVIEW_OBJECT_TYPE}, filters)
+	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	editStatementsForSchemaRenames(statements)
+	editStatementsForDDLTranslation(statements)
+	statements = editStatementsForConflicts(statements)
+	statements = editStatementsForACLMode(statements)
+	statements = filterStatementsForExcludedObjectTypes(statements)
+	return editStatementsForTransformers(filterStatementsForRetry(statements))
+}
+
 func restoreStatistics() {
 	if wasTerminated {
 		return
 	}
 	statisticsFilename := globalFPInfo.GetStatisticsFilePath()
 	gplog.Info("Restoring query planner statistics from %s", statisticsFilename)
+	runStatus.SetPhase("Statistics")
 
-	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
-
-	statements := GetRestoreMetadataStatementsFiltered("statistics", statisticsFilename, []string{}, []string{}, filters)
-	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	statements := getStatisticsStatements()
 	numErrors := ExecuteRestoreMetadataStatements(statements, "Table statistics", nil, utils.PB_VERBOSE, false)
 
 	if numErrors > 0 {
@@ -457,28 +919,55 @@ func restoreStatistics() {
 	}
 }
 
+func getStatisticsStatements() []toc.StatementWithType {
+	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+
+	statements := GetRestoreMetadataStatementsFiltered("statistics", globalFPInfo.GetStatisticsFilePath(), []string{}, []string{}, filters)
+	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	editStatementsForSchemaRenames(statements)
+	statements = editStatementsForConflicts(statements)
+	return editStatementsForTransformers(filterStatementsForRetry(statements))
+}
+
 func runAnalyze(filteredDataEntries map[string][]toc.MasterDataEntry) {
 	if wasTerminated {
 		return
 	}
 	gplog.Info("Running ANALYZE on restored tables")
+	runStatus.SetPhase("Analyze")
 
+	analyzeStatements := getAnalyzeStatements(filteredDataEntries)
+	progressBar := utils.NewProgressBar(len(analyzeStatements), "Tables analyzed: ", utils.PB_VERBOSE)
+	progressBar.Start()
+	numErrors := ExecuteStatements(analyzeStatements, progressBar, connectionPool.NumConns > 1)
+	progressBar.Finish()
+
+	if wasTerminated {
+		gplog.Info("ANALYZE on restored tables incomplete")
+	} else if numErrors > 0 {
+		gplog.Info("ANALYZE on restored tables completed with failures")
+	} else {
+		gplog.Info("ANALYZE on restored tables complete")
+	}
+
+}
+
+const (
+	EXTENSION_VERSIONS_PIN     = "pin"
+	EXTENSION_VERSIONS_UPGRADE = "upgrade"
+)
+
+var extensionVersionPattern = regexp.MustCompile(` VERSION '(?:[^']|'')*'`)
+
+func getAnalyzeStatements(filteredDataEntries map[string][]toc.MasterDataEntry) []toc.StatementWithType {
 	var analyzeStatements []toc.StatementWithType
+	rootPartitionOnly := MustGetFlagString(options.RUN_ANALYZE) == RUN_ANALYZE_ROOTPARTITION
 	for _, dataEntries := range filteredDataEntries {
 		for _, entry := range dataEntries {
-			tableSchema := entry.Schema
-			if opts.RedirectSchema != "" {
-				tableSchema = opts.RedirectSchema
+			if rootPartitionOnly && entry.PartitionRoot != "" {
+				continue
 			}
-			tableFQN := utils.MakeFQN(tableSchema, entry.Name)
-			analyzeCommand := fmt.Sprintf("ANALYZE %s", tableFQN)
-
-			newAnalyzeStatement := toc.StatementWithType{
-				Schema:    tableSchema,
-				Name:      entry.Name,
-				Statement: analyzeCommand,
-			}
-			analyzeStatements = append(analyzeStatements, newAnalyzeStatement)
+			analyzeStatements = append(analyzeStatements, getAnalyzeStatement(entry.Schema, entry.Name, "ANALYZE"))
 		}
 	}
 
@@ -486,61 +975,63 @@ func runAnalyze(filteredDataEntries map[string][]toc.MasterDataEntry) {
 	// automatically. Against GPDB 4.3, we must extract the root partitions
 	// from the leaf partition info and run ANALYZE ROOTPARTITION on the root
 	// partitions. These particular ANALYZE ROOTPARTITION statements should run
-	// last so add them to the end of the analyzeStatements list.
-	if connectionPool.Version.Is("4") {
+	// last so add them to the end of the analyzeStatements list.  With
+	// --run-analyze=rootpartition, only the root partitions are analyzed.
+	if isRestoreDatabaseGPDB4() || rootPartitionOnly {
 		// Create root partition set
 		partitionRootSet := map[toc.StatementWithType]struct{}{}
 		for _, dataEntries := range filteredDataEntries {
 			for _, entry := range dataEntries {
 				if entry.PartitionRoot != "" {
-					tableSchema := entry.Schema
-					if opts.RedirectSchema != "" {
-						tableSchema = opts.RedirectSchema
-					}
-					rootFQN := utils.MakeFQN(tableSchema, entry.PartitionRoot)
-					analyzeCommand := fmt.Sprintf("ANALYZE ROOTPARTITION %s", rootFQN)
-					rootStatement := toc.StatementWithType{
-						Schema:    tableSchema,
-						Name:      entry.PartitionRoot,
-						Statement: analyzeCommand,
-					}
-
+					rootStatement := getAnalyzeStatement(entry.Schema, entry.PartitionRoot, "ANALYZE ROOTPARTITION")
 					if _, ok := partitionRootSet[rootStatement]; !ok {
 						partitionRootSet[rootStatement] = struct{}{}
+						analyzeStatements = append(analyzeStatements, rootStatement)
 					}
 				}
 			}
 		}
-
-		for rootAnalyzeStatement, _ := range partitionRootSet {
-			analyzeStatements = append(analyzeStatements, rootAnalyzeStatement)
-		}
 	}
+	return analyzeStatements
+}
 
-	progressBar := utils.NewProgressBar(len(analyzeStatements), "Tables analyzed: ", utils.PB_VERBOSE)
-	progressBar.Start()
-	numErrors := ExecuteStatements(analyzeStatements, progressBar, connectionPool.NumConns > 1)
-	progressBar.Finish()
-
-	if wasTerminated {
-		gplog.Info("ANALYZE on restored tables incomplete")
-	} else if numErrors > 0 {
-		gplog.Info("ANALYZE on restored tables completed with failures")
-	} else {
-		gplog.Info("ANALYZE on restored tables complete")
+func getAnalyzeStatement(schema string, name string, command string) toc.StatementWithType {
+	return toc.StatementWithType{
+		ObjectType: ANALYZE_OBJECT_TYPE,
+		Schema:     getRestoreSchema(schema),
+		Name:       name,
+		Statement:  fmt.Sprintf("%s %s", command, getRestoreTableFQN(schema, name)),
 	}
+}
 
+/*
+ * Without a connection, the restore database is assumed to be the same major
+ * version as the database that was backed up.
+ */
+func isRestoreDatabaseGPDB4() bool {
+	if connectionPool == nil {
+		return strings.HasPrefix(backupConfig.DatabaseVersion, "4.")
+	}
+	return connectionPool.Version.Is("4")
 }
 
 func DoTeardown() {
 	restoreFailed := false
+	var runSummary *report.RunSummary
+	errMsg := ""
 	defer func() {
+		runStatus.Finish(restoreFailed)
 		DoCleanup(restoreFailed)
 
 		errorCode := gplog.GetErrorCode()
 		if errorCode == 0 {
 			gplog.Info("Restore completed successfully")
 		}
+		if errorCode == 0 && len(slaViolations) > 0 {
+			gplog.Warn("Restore missed %d SLA target(s)", len(slaViolations))
+			errorCode = report.SLAViolationExitCode
+		}
+		logRunSummary(runSummary, errorCode, errMsg)
 		os.Exit(errorCode)
 
 	}()
@@ -570,20 +1061,44 @@ func DoTeardown() {
 	if errStr != "" {
 		fmt.Println(errStr)
 	}
-	errMsg := report.ParseErrorMessage(errStr)
+	errMsg = report.ParseErrorMessage(errStr)
 
-	if globalFPInfo.Timestamp != "" {
+	if globalFPInfo.Timestamp != "" && (MustGetFlagBool(options.DRY_RUN) || MustGetFlagString(options.TO_FILE) != "" || MustGetFlagString(options.EXTRACT_TABLE) != "") {
+		// A dry run, restore script, or extracted table restores nothing, so there is no history or report to write
+		cleanupPluginForRestore()
+	} else if globalFPInfo.Timestamp != "" {
+		writeRestoreHistory(restoreFailed)
 		_, statErr := os.Stat(globalFPInfo.GetDirForContent(-1))
 		if statErr != nil { // Even if this isn't os.IsNotExist, don't try to write a report file in case of further errors
 			return
 		}
 		reportFilename := globalFPInfo.GetRestoreReportFilePath(restoreStartTime)
-		report.WriteRestoreReportFile(reportFilename, globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, errMsg)
-		report.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gprestore", !restoreFailed)
-		if pluginConfig != nil {
-			pluginConfig.CleanupPluginForRestore(globalCluster, globalFPInfo)
-			pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
+		if !restoreFailed {
+			slaViolations = getSLAViolations()
+		}
+		if MustGetFlagBool(options.TABLE_TIMINGS) {
+			writeTableTimings()
 		}
+		report.WriteRestoreReportFile(reportFilename, globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, errMsg, report.RestoreReportContents{
+			RowCountMismatches: rowCountMismatches,
+			RejectedRows:       FormatRejectedRows(rejectedRows),
+			RelationConflicts:  relationConflicts,
+			ExcludedObjects:    excludedObjects,
+			DataExcludedTables: dataExcludedTables,
+			SLAViolations:      slaViolations,
+			AnalyzeTimings:     FormatAnalyzeTimings(analyzeTimings),
+			DeadlockRetries:    FormatDeadlockRetries(deadlockRetries),
+			SequenceChanges:    sequenceChanges,
+			TableTimings:       tableTimings,
+			RestoreTimings:     getRestoreTimings(),
+			ResourceUsage:      getResourceUsage(),
+		})
+		summary := getRunSummary(gplog.GetErrorCode())
+		summary.ReportFile = reportFilename
+		runSummary = &summary
+		report.EmailReport(globalCluster, reportFilename, summary)
+		report.SendWebhookNotifications(globalCluster, reportFilename, summary, errMsg)
+		cleanupPluginForRestore()
 		if len(errorTablesMetadata) > 0 {
 			// tables with metadata errors
 			writeErrorTables(true)
@@ -592,9 +1107,177 @@ func DoTeardown() {
 			// tables with data errors
 			writeErrorTables(false)
 		}
+		writeFailedObjects()
+		writeConflictMapping()
+		writeStatementTransforms()
+	}
+}
+
+func cleanupPluginForRestore() {
+	if pluginConfig != nil {
+		pluginConfig.CleanupPluginForRestore(globalCluster, globalFPInfo)
+		pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
 	}
 }
 
+/*
+ * Records the restore in the restore history file of the cluster restored to.
+ * Nothing is recorded if the restore failed before the backup configuration
+ * was read, as the source and target databases are not yet known.
+ */
+func writeRestoreHistory(restoreFailed bool) {
+	if backupConfig == nil || opts == nil || connectionPool == nil {
+		return
+	}
+	sourceDatabase := utils.UnquoteIdent(backupConfig.DatabaseName)
+	targetDatabase := sourceDatabase
+	if redirectDB := MustGetFlagString(options.REDIRECT_DB); redirectDB != "" {
+		targetDatabase = redirectDB
+	}
+	restoreConfig := history.RestoreConfig{
+		Timestamp:        restoreStartTime,
+		BackupTimestamp:  globalFPInfo.Timestamp,
+		BackupDir:        MustGetFlagString(options.BACKUP_DIR),
+		SourceDatabase:   sourceDatabase,
+		TargetDatabase:   targetDatabase,
+		TargetCluster:    fmt.Sprintf("%s:%d", connectionPool.Host, connectionPool.Port),
+		IncludeRelations: opts.IncludedRelations,
+		IncludeSchemas:   opts.IncludedSchemas,
+		ExcludeRelations: opts.ExcludedRelations,
+		ExcludeSchemas:   opts.ExcludedSchemas,
+		RedirectSchema:   opts.RedirectSchema,
+		DataOnly:         MustGetFlagBool(options.DATA_ONLY),
+		MetadataOnly:     MustGetFlagBool(options.METADATA_ONLY),
+		Incremental:      MustGetFlagBool(options.INCREMENTAL),
+		Status:           history.BackupStatusSucceed,
+	}
+	if pluginConfig != nil {
+		restoreConfig.Plugin = pluginConfig.ExecutablePath
+	}
+	if restoreFailed {
+		restoreConfig.Status = history.BackupStatusFailed
+	}
+	err := history.WriteRestoreHistory(globalFPInfo.GetRestoreHistoryFilePath(), &restoreConfig)
+	if err != nil {
+		gplog.Error(fmt.Sprintf("Unable to write restore history: %v", err))
+	}
+}
+
+/*
+ * Checks the restore against the SLA targets for the database, if any, and
+ * logs a warning for each target that was missed.  The throughput is only
+ * checked for unfiltered restores, as it is based on the size of the backup.
+ */
+func getSLAViolations() []string {
+	if slaTargets == nil || backupConfig == nil {
+		return nil
+	}
+	startTime, _ := time.ParseInLocation("20060102150405", restoreStartTime, operating.System.Local)
+	backupTime, _ := time.ParseInLocation("20060102150405", globalFPInfo.Timestamp, operating.System.Local)
+	numBytes := int64(-1)
+	isFiltered := len(opts.IncludedSchemas) > 0 || len(opts.ExcludedSchemas) > 0 || len(opts.IncludedRelations) > 0 || len(opts.ExcludedRelations) > 0
+	if backupConfig.BackupSize > 0 && !isFiltered {
+		numBytes = backupConfig.BackupSize
+	}
+	violations := slaTargets.GetViolations(operating.System.Now().Sub(startTime), numBytes, startTime.Sub(backupTime))
+	for _, violation := range violations {
+		gplog.Warn("SLA violation: %s", violation)
+	}
+	return violations
+}
+
+func getResourceUsage() *report.ResourceUsage {
+	resourceUsage := report.NewResourceUsage(utils.GetPeakMemoryUsage(), true)
+	if backupConfig != nil && backupConfig.SingleDataFile && !MustGetFlagBool(options.METADATA_ONLY) {
+		for _, fpInfo := range GetBackupFPInfoListFromRestorePlan() {
+			resourceUsage.AddHelperUsage(globalCluster, utils.GetHelperResourceUsageOnSegments(globalCluster, fpInfo))
+		}
+	}
+	return resourceUsage
+}
+
+/*
+ * If the summary was already gathered for the email report, only the final
+ * exit status is updated so that the report file it names is kept.
+ */
+func logRunSummary(summary *report.RunSummary, errorCode int, errMsg string) {
+	defer func() {
+		if err := recover(); err != nil {
+			gplog.Warn("Unable to write run summary: %v", err)
+		}
+	}()
+
+	if summary == nil {
+		newSummary := getRunSummary(errorCode)
+		summary = &newSummary
+	}
+	summary.ExitCode = errorCode
+	summary.Status = report.GetRunStatus(errorCode, wasTerminated)
+	if errMsg != "" {
+		summary.Errors = []string{errMsg}
+	}
+	report.LogRunSummary(*summary)
+	if machineOutput != nil {
+		err := report.WriteMachineOutput(machineOutput, *summary)
+		if err != nil {
+			gplog.Warn("Unable to write machine output: %v", err)
+		}
+	}
+}
+
+func getRunSummary(errorCode int) report.RunSummary {
+	summary := report.RunSummary{
+		Utility:       "gprestore",
+		RunID:         globalFPInfo.Timestamp,
+		Type:          "full",
+		Status:        report.GetRunStatus(errorCode, wasTerminated),
+		Bytes:         -1,
+		ObjectCounts:  objectCounts,
+		ErrorCount:    len(errorTablesMetadata) + len(errorTablesData) + len(rowCountMismatches),
+		ExitCode:      errorCode,
+		SLAViolations: slaViolations,
+		Timings:       getRestoreTimings(),
+	}
+	if connectionPool != nil {
+		summary.Database = connectionPool.DBName
+	}
+	if MustGetFlagBool(options.INCREMENTAL) {
+		summary.Type = "incremental"
+	} else if MustGetFlagBool(options.DATA_ONLY) {
+		summary.Type = "data-only"
+	} else if MustGetFlagBool(options.METADATA_ONLY) {
+		summary.Type = "metadata-only"
+	}
+	if errorCode == 2 && summary.ErrorCount == 0 {
+		summary.ErrorCount = 1
+	}
+	for table := range errorTablesMetadata {
+		summary.FailedObjects = append(summary.FailedObjects, table)
+	}
+	for table := range errorTablesData {
+		summary.FailedObjects = append(summary.FailedObjects, table)
+	}
+	sort.Strings(summary.FailedObjects)
+	summary.FailedObjects = append(summary.FailedObjects, rowCountMismatches...)
+	if restoreStartTime != "" {
+		startTime, _ := time.ParseInLocation("20060102150405", restoreStartTime, operating.System.Local)
+		summary.Duration = operating.System.Now().Sub(startTime)
+	}
+	if backupConfig != nil && MustGetFlagString(options.PLUGIN_CONFIG) == "" {
+		summary.Bytes = 0
+		for _, fpInfo := range GetBackupFPInfoListFromRestorePlan() {
+			size, err := utils.GetBackupSizeOnAllHosts(globalCluster, fpInfo)
+			if err != nil {
+				gplog.Verbose(err.Error())
+				summary.Bytes = -1
+				break
+			}
+			summary.Bytes += size
+		}
+	}
+	return summary
+}
+
 func writeErrorTables(isMetadata bool) {
 	var errorTables *map[string]Empty
 	var errorFilename string
@@ -638,7 +1321,7 @@ func DoCleanup(restoreFailed bool) {
 	}()
 
 	gplog.Verbose("Beginning cleanup")
-	if backupConfig != nil && backupConfig.SingleDataFile {
+	if backupConfig != nil && backupConfig.SingleDataFile && MustGetFlagString(options.TO_FILE) == "" && MustGetFlagString(options.EXTRACT_TABLE) == "" {
 		fpInfoList := GetBackupFPInfoListFromRestorePlan()
 		for _, fpInfo := range fpInfoList {
 			if restoreFailed {
@@ -654,4 +1337,7 @@ func DoCleanup(restoreFailed bool) {
 	if connectionPool != nil {
 		connectionPool.Close()
 	}
+	if s3PluginConfigFile != "" {
+		_ = utils.RemoveFileIfExists(s3PluginConfigFile)
+	}
 }
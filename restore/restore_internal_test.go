@@ -1,7 +1,14 @@
 package restore
 
 import (
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -55,4 +62,289 @@ var _ = Describe("restore internal tests", func() {
 			Expect(statements).To(Equal(expectedStatements))
 		})
 	})
+	Describe("statementQueue", func() {
+		index1 := toc.StatementWithType{ObjectType: "INDEX", Name: "index1"}
+		index2 := toc.StatementWithType{ObjectType: "INDEX", Name: "index2"}
+		comment := toc.StatementWithType{ObjectType: "INDEX METADATA", Name: "index1"}
+		It("returns statements in their original order when there are no limits", func() {
+			queue := newStatementQueue([]toc.StatementWithType{index1, index2, comment}, map[string]int{})
+			for _, expected := range []toc.StatementWithType{index1, index2, comment} {
+				statement, ok := queue.next()
+				Expect(ok).To(BeTrue())
+				Expect(statement).To(Equal(expected))
+			}
+			_, ok := queue.next()
+			Expect(ok).To(BeFalse())
+		})
+		It("skips over statements whose object type is at its limit", func() {
+			queue := newStatementQueue([]toc.StatementWithType{index1, index2, comment}, map[string]int{"INDEX": 1})
+			statement, _ := queue.next()
+			Expect(statement).To(Equal(index1))
+			statement, _ = queue.next()
+			Expect(statement).To(Equal(comment))
+			queue.done(index1)
+			statement, _ = queue.next()
+			Expect(statement).To(Equal(index2))
+		})
+	})
+	Describe("conflict resolution", func() {
+		BeforeEach(func() {
+			opts = &options.Options{}
+			skippedRelations = make(map[string]Empty)
+			renamedRelations = make(map[string]string)
+		})
+		AfterEach(func() {
+			skippedRelations = make(map[string]Empty)
+			renamedRelations = make(map[string]string)
+		})
+		Describe("AddSuffixToIdentifier", func() {
+			It("appends the suffix to an unquoted identifier", func() {
+				Expect(AddSuffixToIdentifier("foo", "_restored")).To(Equal("foo_restored"))
+			})
+			It("appends the suffix inside the quotes of a quoted identifier", func() {
+				Expect(AddSuffixToIdentifier(`"Foo Bar"`, "_restored")).To(Equal(`"Foo Bar_restored"`))
+			})
+		})
+		Describe("editStatementsForExtensionVersions", func() {
+			statements := func() []toc.StatementWithType {
+				return []toc.StatementWithType{
+					{Name: "ext1", ObjectType: "EXTENSION", Statement: "CREATE EXTENSION IF NOT EXISTS ext1 WITH SCHEMA public VERSION '1.0';"},
+					{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i int);"},
+				}
+			}
+			It("keeps the backed up versions with the pin policy", func() {
+				edited := statements()
+				editStatementsForExtensionVersions(edited, "pin")
+				Expect(edited).To(Equal(statements()))
+			})
+			It("removes the versions from CREATE EXTENSION statements with the upgrade policy", func() {
+				edited := statements()
+				editStatementsForExtensionVersions(edited, "upgrade")
+				Expect(edited[0].Statement).To(Equal("CREATE EXTENSION IF NOT EXISTS ext1 WITH SCHEMA public;"))
+				Expect(edited[1]).To(Equal(statements()[1]))
+			})
+		})
+		Describe("getExtensionVersionsPolicy", func() {
+			It("pins the backed up versions by default", func() {
+				Expect(getExtensionVersionsPolicy()).To(Equal(EXTENSION_VERSIONS_PIN))
+			})
+			It("creates the default versions when translating DDL", func() {
+				_ = cmdFlags.Set(options.TRANSLATE_DDL, "true")
+				Expect(getExtensionVersionsPolicy()).To(Equal(EXTENSION_VERSIONS_UPGRADE))
+			})
+			It("keeps an explicit policy when translating DDL", func() {
+				_ = cmdFlags.Set(options.TRANSLATE_DDL, "true")
+				_ = cmdFlags.Set(options.EXTENSION_VERSIONS, EXTENSION_VERSIONS_PIN)
+				Expect(getExtensionVersionsPolicy()).To(Equal(EXTENSION_VERSIONS_PIN))
+			})
+		})
+		Describe("editStatementsForRedactedCredentials", func() {
+			statements := func() []toc.StatementWithType {
+				return []toc.StatementWithType{
+					{Name: "srv", ObjectType: "FOREIGN SERVER", Statement: "CREATE SERVER srv FOREIGN DATA WRAPPER fdw OPTIONS (password 'gpbackup_redacted_credential_1');"},
+					{Name: "admin ON srv", ObjectType: "USER MAPPING", Statement: "CREATE USER MAPPING FOR admin SERVER srv OPTIONS (password 'gpbackup_redacted_credential_2');"},
+					{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i text DEFAULT 'gpbackup_redacted_credential_1');"},
+				}
+			}
+			It("puts the credentials back into foreign servers and user mappings", func() {
+				edited := statements()
+				editStatementsForRedactedCredentials(edited, map[string]string{
+					"'gpbackup_redacted_credential_1'": "'secret1'",
+					"'gpbackup_redacted_credential_2'": "'secret2'",
+				})
+				Expect(edited[0].Statement).To(Equal("CREATE SERVER srv FOREIGN DATA WRAPPER fdw OPTIONS (password 'secret1');"))
+				Expect(edited[1].Statement).To(Equal("CREATE USER MAPPING FOR admin SERVER srv OPTIONS (password 'secret2');"))
+				Expect(edited[2]).To(Equal(statements()[2]))
+			})
+			It("leaves the statements unchanged without credentials", func() {
+				edited := statements()
+				editStatementsForRedactedCredentials(edited, nil)
+				Expect(edited).To(Equal(statements()))
+			})
+		})
+		Describe("editStatementsForConflicts", func() {
+			It("removes skipped relations and the objects that depend on them", func() {
+				skippedRelations["public.foo"] = Empty{}
+				statements := []toc.StatementWithType{
+					{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i int);"},
+					{Schema: "public", Name: "foo_idx", ObjectType: "INDEX", ReferenceObject: "public.foo", Statement: "CREATE INDEX foo_idx ON public.foo USING btree (i);"},
+					{Schema: "public", Name: "bar", ObjectType: "TABLE", Statement: "CREATE TABLE public.bar (i int);"},
+				}
+				Expect(editStatementsForConflicts(statements)).To(Equal(statements[2:]))
+			})
+			It("substitutes the new names of renamed relations", func() {
+				renamedRelations["public.foo"] = "public.foo_restored"
+				renamedRelations["public.foo_idx"] = "public.foo_idx_restored"
+				statements := []toc.StatementWithType{
+					{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i int);"},
+					{Schema: "public", Name: "foobar", ObjectType: "TABLE", Statement: "CREATE TABLE public.foobar (i int);"},
+					{Schema: "public", Name: "foo_idx", ObjectType: "INDEX", ReferenceObject: "public.foo", Statement: "CREATE INDEX foo_idx ON public.foo USING btree (i);"},
+					{Schema: "public", Name: "foo_pkey", ObjectType: "CONSTRAINT", ReferenceObject: "public.foo", Statement: "ALTER TABLE ONLY public.foo ADD CONSTRAINT foo_pkey PRIMARY KEY (i);"},
+					{Schema: "public", Name: "fooview", ObjectType: "VIEW", Statement: "CREATE VIEW public.fooview AS SELECT foo.i FROM public.foo;"},
+				}
+				Expect(editStatementsForConflicts(statements)).To(Equal([]toc.StatementWithType{
+					{Schema: "public", Name: "foo_restored", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo_restored (i int);"},
+					{Schema: "public", Name: "foobar", ObjectType: "TABLE", Statement: "CREATE TABLE public.foobar (i int);"},
+					{Schema: "public", Name: "foo_idx_restored", ObjectType: "INDEX", ReferenceObject: "public.foo_restored", Statement: "CREATE INDEX foo_idx_restored ON public.foo_restored USING btree (i);"},
+					{Schema: "public", Name: "foo_pkey_restored", ObjectType: "CONSTRAINT", ReferenceObject: "public.foo_restored", Statement: "ALTER TABLE ONLY public.foo_restored ADD CONSTRAINT foo_pkey_restored PRIMARY KEY (i);"},
+					{Schema: "public", Name: "fooview", ObjectType: "VIEW", Statement: "CREATE VIEW public.fooview AS SELECT foo.i FROM public.foo_restored;"},
+				}))
+			})
+		})
+		Describe("renameLeafPartition", func() {
+			It("replaces the root name at the start of the leaf name", func() {
+				newLeaf, ok := renameLeafPartition("foo_1_prt_1", "foo", "foo_restored")
+				Expect(ok).To(BeTrue())
+				Expect(newLeaf).To(Equal("foo_restored_1_prt_1"))
+			})
+			It("quotes the new leaf name if the old one was quoted", func() {
+				newLeaf, ok := renameLeafPartition(`"Foo_1_prt_1"`, `"Foo"`, `"Foo_restored"`)
+				Expect(ok).To(BeTrue())
+				Expect(newLeaf).To(Equal(`"Foo_restored_1_prt_1"`))
+			})
+			It("does not rename a leaf whose name does not start with the root name", func() {
+				_, ok := renameLeafPartition("bar_1_prt_1", "foo", "foo_restored")
+				Expect(ok).To(BeFalse())
+			})
+		})
+		Describe("editDataEntriesForConflicts", func() {
+			It("removes the entries for skipped tables, taking the redirect schema into account", func() {
+				opts.RedirectSchema = "other"
+				skippedRelations["other.foo"] = Empty{}
+				entries := []toc.MasterDataEntry{{Schema: "public", Name: "foo"}, {Schema: "public", Name: "bar"}}
+				Expect(editDataEntriesForConflicts(entries)).To(Equal(entries[1:]))
+			})
+		})
+		Describe("getRestoreTableFQN", func() {
+			It("returns the new name of a renamed table", func() {
+				renamedRelations["public.foo"] = "public.foo_restored"
+				Expect(getRestoreTableFQN("public", "foo")).To(Equal("public.foo_restored"))
+				Expect(getRestoreTableFQN("public", "bar")).To(Equal("public.bar"))
+			})
+		})
+	})
+	Describe("getAnalyzeStatements", func() {
+		dataEntries := map[string][]toc.MasterDataEntry{
+			"20170101010101": {
+				{Schema: "public", Name: "foo"},
+				{Schema: "public", Name: "sales_1_prt_1", PartitionRoot: "sales"},
+				{Schema: "public", Name: "sales_1_prt_2", PartitionRoot: "sales"},
+			},
+		}
+		BeforeEach(func() {
+			opts = &options.Options{}
+			backupConfig = &history.BackupConfig{DatabaseVersion: "6.0.0"}
+		})
+		AfterEach(func() {
+			_ = cmdFlags.Set(options.RUN_ANALYZE, "")
+		})
+		It("analyzes each restored table", func() {
+			_ = cmdFlags.Set(options.RUN_ANALYZE, RUN_ANALYZE_ALL)
+			statements := getAnalyzeStatements(dataEntries)
+			Expect(statements).To(ContainElement(toc.StatementWithType{ObjectType: "ANALYZE", Schema: "public", Name: "foo", Statement: "ANALYZE public.foo"}))
+			Expect(statements).To(ContainElement(toc.StatementWithType{ObjectType: "ANALYZE", Schema: "public", Name: "sales_1_prt_1", Statement: "ANALYZE public.sales_1_prt_1"}))
+		})
+		It("analyzes only the root partition of leaf partitions with rootpartition", func() {
+			_ = cmdFlags.Set(options.RUN_ANALYZE, RUN_ANALYZE_ROOTPARTITION)
+			Expect(getAnalyzeStatements(dataEntries)).To(Equal([]toc.StatementWithType{
+				{ObjectType: "ANALYZE", Schema: "public", Name: "foo", Statement: "ANALYZE public.foo"},
+				{ObjectType: "ANALYZE", Schema: "public", Name: "sales", Statement: "ANALYZE ROOTPARTITION public.sales"},
+			}))
+		})
+	})
+	Describe("getPartitionRootAnalyzeStatements", func() {
+		BeforeEach(func() {
+			opts = &options.Options{}
+			backupConfig = &history.BackupConfig{DatabaseVersion: "6.0.0"}
+		})
+		It("analyzes the root partition of the loaded leaf partitions once each", func() {
+			leafPartitions := []toc.MasterDataEntry{
+				{Schema: "public", Name: "sales_1_prt_2", PartitionRoot: "sales"},
+				{Schema: "other", Name: "orders_1_prt_1", PartitionRoot: "orders"},
+				{Schema: "public", Name: "sales_1_prt_1", PartitionRoot: "sales"},
+			}
+			Expect(getPartitionRootAnalyzeStatements(leafPartitions)).To(Equal([]toc.StatementWithType{
+				{ObjectType: "ANALYZE", Schema: "other", Name: "orders", Statement: "ANALYZE ROOTPARTITION other.orders"},
+				{ObjectType: "ANALYZE", Schema: "public", Name: "sales", Statement: "ANALYZE ROOTPARTITION public.sales"},
+			}))
+		})
+		It("analyzes nothing when no leaf partitions were loaded", func() {
+			Expect(getPartitionRootAnalyzeStatements([]toc.MasterDataEntry{{Schema: "public", Name: "foo"}})).To(BeEmpty())
+		})
+	})
+	Describe("GetCreateDatabaseWithOptionsStatement", func() {
+		It("names every setting of the database recorded at backup time", func() {
+			config := &history.BackupConfig{DatabaseEncoding: "UTF8", DatabaseCollate: "en_US.utf8", DatabaseCType: "en_US.utf8", DatabaseTablespace: "pg_default"}
+			Expect(GetCreateDatabaseWithOptionsStatement("newdb", config)).To(Equal("\n\nCREATE DATABASE newdb TEMPLATE template0 TABLESPACE pg_default ENCODING 'UTF8' LC_COLLATE 'en_US.utf8' LC_CTYPE 'en_US.utf8';"))
+		})
+		It("leaves out the locale for backups of GPDB versions without a locale per database", func() {
+			config := &history.BackupConfig{DatabaseEncoding: "LATIN1", DatabaseTablespace: "fastspace"}
+			Expect(GetCreateDatabaseWithOptionsStatement("testdb", config)).To(Equal("\n\nCREATE DATABASE testdb TEMPLATE template0 TABLESPACE fastspace ENCODING 'LATIN1';"))
+		})
+	})
+	Describe("getTableDataSources", func() {
+		fpInfo := filepath.NewFilePathInfo(cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, DataDir: "/data/gpseg-1"}}), "", "20170101010101", "gpseg")
+		BeforeEach(func() {
+			backupConfig = &history.BackupConfig{}
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -1", InputCommand: "gzip -d -c", Extension: ".gz"})
+		})
+		It("reads the data of a table from its own file", func() {
+			sources, _ := getTableDataSources(&fpInfo, toc.MasterDataEntry{Oid: 3456})
+			Expect(sources).To(Equal([]string{"<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"}))
+		})
+		It("reads the data of a split table from the file of each stream", func() {
+			sources, _ := getTableDataSources(&fpInfo, toc.MasterDataEntry{Oid: 3456, Streams: 2})
+			Expect(sources).To(Equal([]string{
+				"<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456_0.gz",
+				"<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456_1.gz",
+			}))
+		})
+	})
+	Describe("FormatAnalyzeTimings", func() {
+		It("lists the tables with the longest ANALYZE first", func() {
+			timings := []AnalyzeTiming{
+				{Table: "public.small", Duration: 12345 * time.Microsecond},
+				{Table: "public.big", Duration: 2500 * time.Millisecond},
+			}
+			Expect(FormatAnalyzeTimings(timings)).To(Equal([]string{"public.big: 2.5s", "public.small: 12ms"}))
+		})
+	})
+	Describe("ExcludeStatementsOfObjectTypes", func() {
+		It("leaves out the statements of the excluded types and lists each object once", func() {
+			table := toc.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i integer);"}
+			index := toc.StatementWithType{Schema: "public", Name: "foo_idx", ObjectType: "INDEX", Statement: "CREATE INDEX foo_idx ON public.foo USING btree (i);"}
+			indexComment := toc.StatementWithType{Schema: "public", Name: "foo_idx", ObjectType: "INDEX", Statement: "COMMENT ON INDEX public.foo_idx IS 'an index';"}
+			trigger := toc.StatementWithType{Schema: "public", Name: "foo_trigger", ObjectType: "TRIGGER", Statement: "CREATE TRIGGER foo_trigger AFTER INSERT ON public.foo FOR EACH ROW EXECUTE PROCEDURE public.f();"}
+
+			statements, excluded := ExcludeStatementsOfObjectTypes([]toc.StatementWithType{table, index, indexComment, trigger}, []string{"INDEX", "TRIGGER"})
+			Expect(statements).To(Equal([]toc.StatementWithType{table}))
+			Expect(excluded).To(Equal([]string{"INDEX public.foo_idx", "TRIGGER public.foo_trigger"}))
+		})
+	})
+	Describe("adaptiveScheduler", func() {
+		It("lets no more workers than the limit run at once, and releases waiting workers when closed", func() {
+			scheduler := newAdaptiveScheduler(2, 4)
+			scheduler.acquire()
+			scheduler.acquire()
+
+			acquired := make(chan bool)
+			go func() {
+				scheduler.acquire()
+				acquired <- true
+			}()
+			Consistently(acquired, "100ms").ShouldNot(Receive())
+
+			scheduler.release()
+			Eventually(acquired).Should(Receive())
+
+			go func() {
+				scheduler.acquire()
+				acquired <- true
+			}()
+			Consistently(acquired, "100ms").ShouldNot(Receive())
+
+			scheduler.close()
+			Eventually(acquired).Should(Receive())
+		})
+	})
 })
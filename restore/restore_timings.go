@@ -0,0 +1,64 @@
+package restore
+
+/*
+ * This file contains functions for recording how the time of a restore was
+ * spent, which is included in the restore report so that --jobs can be tuned
+ * based on how busy each connection was.
+ */
+
+import (
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+var restoreTimingsMutex sync.Mutex
+
+func recordPhaseDuration(phase string, start time.Time) {
+	restoreTimingsMutex.Lock()
+	defer restoreTimingsMutex.Unlock()
+	restoreTimings.Phases = append(restoreTimings.Phases, report.PhaseTiming{Phase: phase, Duration: time.Since(start)})
+}
+
+/*
+ * Records the time a connection spent running a statement or loading the
+ * data of a table, and keeps the statement if it is among the slowest.
+ * Statements are nil for table data, which is listed in the report by
+ * --table-timings instead.
+ */
+func recordConnectionBusy(whichConn int, duration time.Duration, statement *toc.StatementWithType) {
+	restoreTimingsMutex.Lock()
+	defer restoreTimingsMutex.Unlock()
+	for len(restoreTimings.ConnectionBusy) <= whichConn {
+		restoreTimings.ConnectionBusy = append(restoreTimings.ConnectionBusy, 0)
+	}
+	restoreTimings.ConnectionBusy[whichConn] += duration
+	if statement != nil {
+		object := statement.Name
+		if statement.Schema != "" {
+			object = utils.MakeFQN(statement.Schema, statement.Name)
+		}
+		restoreTimings.SlowestStatements = report.AddStatementTiming(restoreTimings.SlowestStatements, report.StatementTiming{
+			ObjectType: statement.ObjectType,
+			Object:     object,
+			Duration:   duration,
+		})
+	}
+}
+
+/*
+ * Returns nil if nothing was timed, as when the restore fails before any
+ * phase completes.
+ */
+func getRestoreTimings() *report.RestoreTimings {
+	restoreTimingsMutex.Lock()
+	defer restoreTimingsMutex.Unlock()
+	if len(restoreTimings.Phases) == 0 && len(restoreTimings.ConnectionBusy) == 0 {
+		return nil
+	}
+	timings := restoreTimings
+	return &timings
+}
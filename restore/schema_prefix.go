@@ -0,0 +1,156 @@
+package restore
+
+/*
+ * This file contains functions for --schema-prefix and --schema-suffix, which
+ * restore every schema in the backup under a new name made by adding the
+ * prefix and suffix to its name, so that a copy of the schemas can be restored
+ * alongside the originals in the same database.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+// The longest identifier that the database stores without truncating it
+const MAX_IDENTIFIER_LENGTH = 63
+
+/*
+ * Returns the quoted name of the schema with the given quoted name after
+ * adding the prefix and suffix to it.
+ */
+func GetPrefixedSchemaName(schema string, prefix string, suffix string) string {
+	return utils.QuoteIdentWithoutConnection(prefix + utils.UnquoteIdent(schema) + suffix)
+}
+
+func isSchemaRenameRun() bool {
+	return MustGetFlagString(options.SCHEMA_PREFIX) != "" || MustGetFlagString(options.SCHEMA_SUFFIX) != ""
+}
+
+/*
+ * Returns the schema into which the objects of the given schema in the backup
+ * will be restored, taking --redirect-schema, --schema-prefix, and
+ * --schema-suffix into account.
+ */
+func getRestoreSchema(schema string) string {
+	if opts.RedirectSchema != "" {
+		return opts.RedirectSchema
+	}
+	if isSchemaRenameRun() {
+		return GetPrefixedSchemaName(schema, MustGetFlagString(options.SCHEMA_PREFIX), MustGetFlagString(options.SCHEMA_SUFFIX))
+	}
+	return schema
+}
+
+/*
+ * Returns the new name of each schema in the backup, by its old name.
+ */
+func getSchemaRenames() map[string]string {
+	schemaRenames := make(map[string]string)
+	if !isSchemaRenameRun() || globalTOC == nil {
+		return schemaRenames
+	}
+	for _, entry := range globalTOC.PredataEntries {
+		if entry.ObjectType == "SCHEMA" {
+			schemaRenames[entry.Schema] = getRestoreSchema(entry.Schema)
+		}
+	}
+	return schemaRenames
+}
+
+func ValidateSchemaRenames(schemaRenames map[string]string) {
+	for _, newSchema := range schemaRenames {
+		if len(utils.UnquoteIdent(newSchema)) > MAX_IDENTIFIER_LENGTH {
+			gplog.Fatal(errors.Errorf("Cannot restore into schema %s, as its name is longer than %d bytes", newSchema, MAX_IDENTIFIER_LENGTH), "")
+		}
+	}
+}
+
+/*
+ * Renames the schemas of the statements, and the schemas named in their text
+ * either as the qualifier of a name or after the SCHEMA keyword.  The public
+ * schema is not created by the backup, as it always exists, so a statement
+ * creating it under its new name is added.
+ *
+ * Schema names are replaced wherever they appear in the text of a statement,
+ * including in string literals and function bodies, so a literal such as
+ * 'public.foo' is renamed as well.
+ */
+func RenameSchemasInStatements(statements []toc.StatementWithType, schemaRenames map[string]string) {
+	if len(schemaRenames) == 0 {
+		return
+	}
+	renamePattern := getSchemaRenamePattern(schemaRenames)
+	for i, statement := range statements {
+		if newSchema, ok := schemaRenames[statement.Schema]; ok {
+			statements[i].Schema = newSchema
+			if statement.ObjectType == "SCHEMA" {
+				statements[i].Name = newSchema
+				if statement.Schema == "public" && strings.TrimSpace(statement.Statement) == "" {
+					statements[i].Statement = fmt.Sprintf("\n\nCREATE SCHEMA %s;", newSchema)
+					continue
+				}
+			}
+		}
+		if statement.ReferenceObject != "" {
+			statements[i].ReferenceObject = replaceSchemaNames(statement.ReferenceObject, renamePattern, schemaRenames)
+		}
+		statements[i].Statement = replaceSchemaNames(statement.Statement, renamePattern, schemaRenames)
+	}
+}
+
+/*
+ * Returns a pattern matching the old name of any schema, optionally after the
+ * SCHEMA keyword, trying longer names first so that a name is not matched by
+ * a prefix of itself.
+ */
+func getSchemaRenamePattern(schemaRenames map[string]string) *regexp.Regexp {
+	oldNames := make([]string, 0, len(schemaRenames))
+	for oldName := range schemaRenames {
+		oldNames = append(oldNames, oldName)
+	}
+	sort.Slice(oldNames, func(i, j int) bool {
+		if len(oldNames[i]) != len(oldNames[j]) {
+			return len(oldNames[i]) > len(oldNames[j])
+		}
+		return oldNames[i] < oldNames[j]
+	})
+	for i, oldName := range oldNames {
+		oldNames[i] = regexp.QuoteMeta(oldName)
+	}
+	return regexp.MustCompile(fmt.Sprintf(`(SCHEMA )?(%s)`, strings.Join(oldNames, "|")))
+}
+
+func replaceSchemaNames(statement string, renamePattern *regexp.Regexp, schemaRenames map[string]string) string {
+	var result strings.Builder
+	last := 0
+	for _, match := range renamePattern.FindAllStringSubmatchIndex(statement, -1) {
+		start, nameStart, end := match[0], match[4], match[5]
+		afterKeyword := match[2] != -1 && (start == 0 || !isIdentifierChar(statement[start-1]))
+		if nameStart > 0 && (isIdentifierChar(statement[nameStart-1]) || statement[nameStart-1] == '.') {
+			continue
+		}
+		isQualifier := end < len(statement) && statement[end] == '.'
+		isSchemaName := afterKeyword && (end == len(statement) || !isIdentifierChar(statement[end]))
+		if !isQualifier && !isSchemaName {
+			continue
+		}
+		result.WriteString(statement[last:nameStart])
+		result.WriteString(schemaRenames[statement[nameStart:end]])
+		last = end
+	}
+	result.WriteString(statement[last:])
+	return result.String()
+}
+
+func editStatementsForSchemaRenames(statements []toc.StatementWithType) {
+	RenameSchemasInStatements(statements, getSchemaRenames())
+}
@@ -0,0 +1,68 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/schema_prefix tests", func() {
+	Describe("GetPrefixedSchemaName", func() {
+		It("adds the prefix and suffix to the schema name", func() {
+			Expect(restore.GetPrefixedSchemaName("sales", "staging_", "")).To(Equal("staging_sales"))
+			Expect(restore.GetPrefixedSchemaName("sales", "", "_copy")).To(Equal("sales_copy"))
+		})
+		It("quotes the new name if it needs quoting", func() {
+			Expect(restore.GetPrefixedSchemaName(`"Sales"`, "staging_", "")).To(Equal(`"staging_Sales"`))
+			Expect(restore.GetPrefixedSchemaName("sales", "Staging-", "")).To(Equal(`"Staging-sales"`))
+		})
+	})
+	Describe("RenameSchemasInStatements", func() {
+		schemaRenames := map[string]string{"public": "staging_public", "sales": "staging_sales", `"Sales"`: `"staging_Sales"`}
+		It("renames the schemas of objects and those they reference", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "sales", Name: "orders", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE sales.orders (\n\ti integer\n) DISTRIBUTED BY (i);"},
+				{Schema: "sales", Name: "myview", ObjectType: "VIEW", Statement: "\n\nCREATE VIEW sales.myview AS  SELECT orders.i\n   FROM sales.orders JOIN public.sales ON true JOIN \"Sales\".t ON true;"},
+				{Schema: "sales", Name: "orders_idx", ObjectType: "INDEX", ReferenceObject: "sales.orders", Statement: "\n\nCREATE INDEX orders_idx ON sales.orders USING btree (i);"},
+			}
+
+			restore.RenameSchemasInStatements(statements, schemaRenames)
+
+			Expect(statements).To(Equal([]toc.StatementWithType{
+				{Schema: "staging_sales", Name: "orders", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE staging_sales.orders (\n\ti integer\n) DISTRIBUTED BY (i);"},
+				{Schema: "staging_sales", Name: "myview", ObjectType: "VIEW", Statement: "\n\nCREATE VIEW staging_sales.myview AS  SELECT orders.i\n   FROM staging_sales.orders JOIN staging_public.sales ON true JOIN \"staging_Sales\".t ON true;"},
+				{Schema: "staging_sales", Name: "orders_idx", ObjectType: "INDEX", ReferenceObject: "staging_sales.orders", Statement: "\n\nCREATE INDEX orders_idx ON staging_sales.orders USING btree (i);"},
+			}))
+		})
+		It("renames the schemas themselves, and creates the renamed public schema", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "public", Name: "public", ObjectType: "SCHEMA", Statement: "\n"},
+				{Schema: "public", Name: "public", ObjectType: "SCHEMA", Statement: "\n\nCOMMENT ON SCHEMA public IS 'standard public schema';"},
+				{Schema: "sales", Name: "sales", ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA sales;"},
+				{Schema: "sales", Name: "sales", ObjectType: "SCHEMA", Statement: "\n\nALTER SCHEMA sales OWNER TO testrole;"},
+			}
+
+			restore.RenameSchemasInStatements(statements, schemaRenames)
+
+			Expect(statements).To(Equal([]toc.StatementWithType{
+				{Schema: "staging_public", Name: "staging_public", ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA staging_public;"},
+				{Schema: "staging_public", Name: "staging_public", ObjectType: "SCHEMA", Statement: "\n\nCOMMENT ON SCHEMA staging_public IS 'standard public schema';"},
+				{Schema: "staging_sales", Name: "staging_sales", ObjectType: "SCHEMA", Statement: "\n\nCREATE SCHEMA staging_sales;"},
+				{Schema: "staging_sales", Name: "staging_sales", ObjectType: "SCHEMA", Statement: "\n\nALTER SCHEMA staging_sales OWNER TO testrole;"},
+			}))
+		})
+		It("does not rename other identifiers containing a schema name", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "sales", Name: "t", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE sales.t (\n\tsales integer,\n\tpublic_id integer\n) DISTRIBUTED BY (sales);"},
+				{Schema: "sales", Name: "v", ObjectType: "VIEW", Statement: "\n\nCREATE VIEW sales.v AS  SELECT t.sales, pg_catalog.now() FROM sales.t;"},
+			}
+
+			restore.RenameSchemasInStatements(statements, schemaRenames)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLE staging_sales.t (\n\tsales integer,\n\tpublic_id integer\n) DISTRIBUTED BY (sales);"))
+			Expect(statements[1].Statement).To(Equal("\n\nCREATE VIEW staging_sales.v AS  SELECT t.sales, pg_catalog.now() FROM staging_sales.t;"))
+		})
+	})
+})
@@ -0,0 +1,179 @@
+package restore
+
+/*
+ * This file contains functions for restoring the values of sequences.  The
+ * values recorded in the TOC once the data of the backup was copied are used
+ * if there are any, and otherwise the setval calls of the metadata file.  A
+ * data-only restore only advances sequences, so that a sequence that is
+ * further along in the restore database than in the backup does not hand out
+ * values that existing rows already use, unless --exact-sequence-values is
+ * specified.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+var setvalRegex = regexp.MustCompile(`SELECT pg_catalog\.setval\('.*', (-?\d+), (true|false)\);`)
+
+type currentSequenceValue struct {
+	LastVal   int64
+	IsCalled  bool
+	Increment int64
+}
+
+func restoreSequenceValues(metadataFilename string, exact bool) {
+	if wasTerminated {
+		return
+	}
+	gplog.Info("Restoring sequence values")
+	sequenceValues := getSequenceValues(metadataFilename)
+
+	numErrors := 0
+	if len(sequenceValues) == 0 {
+		gplog.Verbose("No sequence values to restore")
+	} else {
+		progressBar := utils.NewProgressBar(len(sequenceValues), "Sequence values restored: ", utils.PB_VERBOSE)
+		progressBar.Start()
+		for _, value := range sequenceValues {
+			if wasTerminated {
+				break
+			}
+			if !restoreSequenceValue(value, exact) {
+				numErrors++
+			}
+			progressBar.Increment()
+		}
+		progressBar.Finish()
+	}
+
+	if wasTerminated {
+		gplog.Info("Sequence values restore incomplete")
+	} else if numErrors > 0 {
+		gplog.Info("Sequence values restore completed with failures")
+	} else {
+		gplog.Info("Sequence values restore complete")
+	}
+}
+
+func getSequenceValues(metadataFilename string) []toc.SequenceValue {
+	if len(globalTOC.SequenceValues) == 0 {
+		return ParseSequenceValueStatements(getSequenceValueStatements(metadataFilename))
+	}
+	values := globalTOC.GetSequenceValuesMatching(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+	if retryObjects == nil {
+		return values
+	}
+	retrySet := make(map[string]bool)
+	for _, object := range retryObjects {
+		if object.ObjectType == "SEQUENCE" {
+			retrySet[utils.MakeFQN(object.Schema, object.Name)] = true
+		}
+	}
+	retryValues := make([]toc.SequenceValue, 0)
+	for _, value := range values {
+		if retrySet[utils.MakeFQN(getRestoreSchema(value.Schema), value.Name)] {
+			retryValues = append(retryValues, value)
+		}
+	}
+	return retryValues
+}
+
+/*
+ * Backups taken before sequence values were recorded in the TOC only have
+ * them in the setval calls of the metadata file.
+ */
+func ParseSequenceValueStatements(statements []toc.StatementWithType) []toc.SequenceValue {
+	values := make([]toc.SequenceValue, 0, len(statements))
+	for _, statement := range statements {
+		matches := setvalRegex.FindStringSubmatch(statement.Statement)
+		if len(matches) != 3 {
+			continue
+		}
+		lastVal, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values = append(values, toc.SequenceValue{Schema: statement.Schema, Name: statement.Name, LastVal: lastVal, IsCalled: matches[2] == "true"})
+	}
+	return values
+}
+
+/*
+ * Returns false if the value could not be restored, which is fatal unless
+ * --on-error-continue is specified.
+ */
+func restoreSequenceValue(value toc.SequenceValue, exact bool) bool {
+	schema := getRestoreSchema(value.Schema)
+	fqn := utils.MakeFQN(schema, value.Name)
+	statement := fmt.Sprintf("SELECT pg_catalog.setval('%s', %d, %v);", utils.EscapeSingleQuotes(fqn), value.LastVal, value.IsCalled)
+	current := currentSequenceValue{}
+	query := fmt.Sprintf("SELECT last_value AS lastval, is_called AS iscalled, increment_by AS increment FROM %s", fqn)
+	err := connectionPool.Get(&current, query)
+	if err != nil {
+		return handleSequenceValueError(schema, value.Name, statement, err)
+	}
+	comparison := CompareSequenceValues(toc.SequenceValue{LastVal: current.LastVal, IsCalled: current.IsCalled}, value, current.Increment)
+	if comparison == 0 {
+		return true
+	}
+	if comparison < 0 && !exact {
+		gplog.Verbose("Sequence %s is ahead of its value in the backup, so it is left at %d", fqn, current.LastVal)
+		sequenceChanges = append(sequenceChanges, fmt.Sprintf("%s: left at %d, ahead of %d in the backup", fqn, current.LastVal, value.LastVal))
+		return true
+	}
+	_, err = connectionPool.Exec(statement)
+	if err != nil {
+		return handleSequenceValueError(schema, value.Name, statement, err)
+	}
+	change := "advanced"
+	if comparison < 0 {
+		change = "reset"
+	}
+	sequenceChanges = append(sequenceChanges, fmt.Sprintf("%s: %s from %d to %d", fqn, change, current.LastVal, value.LastVal))
+	return true
+}
+
+func handleSequenceValueError(schema string, name string, statement string, err error) bool {
+	errMsg := fmt.Sprintf("Error encountered while restoring the value of sequence %s", utils.MakeFQN(schema, name))
+	if !MustGetFlagBool(options.ON_ERROR_CONTINUE) {
+		gplog.Fatal(err, errMsg)
+	}
+	gplog.Verbose("%s: %s", errMsg, err.Error())
+	recordFailedObject(FailedObject{ObjectType: "SEQUENCE", Schema: schema, Name: name, Error: err.Error(), Statement: statement})
+	return false
+}
+
+/*
+ * Returns 1 if setting a sequence to the given value would advance it, -1 if
+ * it would move it back, and 0 if it would leave it where it is.  A sequence
+ * whose last value has been handed out is further along than one at the same
+ * value whose last value has not, and a sequence with a negative increment
+ * advances toward lower values.
+ */
+func CompareSequenceValues(current toc.SequenceValue, value toc.SequenceValue, increment int64) int {
+	comparison := 0
+	switch {
+	case value.LastVal > current.LastVal:
+		comparison = 1
+	case value.LastVal < current.LastVal:
+		comparison = -1
+	case value.IsCalled && !current.IsCalled:
+		return 1
+	case !value.IsCalled && current.IsCalled:
+		return -1
+	default:
+		return 0
+	}
+	if increment < 0 {
+		comparison = -comparison
+	}
+	return comparison
+}
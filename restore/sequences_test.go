@@ -0,0 +1,48 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/sequences tests", func() {
+	Describe("ParseSequenceValueStatements", func() {
+		It("parses the value of each setval call", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "public", Name: "foo_seq", ObjectType: "SEQUENCE", Statement: "SELECT pg_catalog.setval('public.foo_seq', 42, true);"},
+				{Schema: "public", Name: "bar_seq", ObjectType: "SEQUENCE", Statement: "SELECT pg_catalog.setval('public.bar_seq', -5, false);"},
+			}
+			Expect(restore.ParseSequenceValueStatements(statements)).To(Equal([]toc.SequenceValue{
+				{Schema: "public", Name: "foo_seq", LastVal: 42, IsCalled: true},
+				{Schema: "public", Name: "bar_seq", LastVal: -5, IsCalled: false},
+			}))
+		})
+		It("skips statements that are not setval calls", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "public", Name: "foo_seq", ObjectType: "SEQUENCE", Statement: "CREATE SEQUENCE public.foo_seq;"},
+			}
+			Expect(restore.ParseSequenceValueStatements(statements)).To(BeEmpty())
+		})
+	})
+	Describe("CompareSequenceValues", func() {
+		It("advances a sequence that is behind its value in the backup", func() {
+			Expect(restore.CompareSequenceValues(toc.SequenceValue{LastVal: 1}, toc.SequenceValue{LastVal: 42, IsCalled: true}, 1)).To(Equal(1))
+		})
+		It("moves back a sequence that is ahead of its value in the backup", func() {
+			Expect(restore.CompareSequenceValues(toc.SequenceValue{LastVal: 90, IsCalled: true}, toc.SequenceValue{LastVal: 42, IsCalled: true}, 1)).To(Equal(-1))
+		})
+		It("treats a sequence whose value has been used as further along", func() {
+			Expect(restore.CompareSequenceValues(toc.SequenceValue{LastVal: 42}, toc.SequenceValue{LastVal: 42, IsCalled: true}, 1)).To(Equal(1))
+			Expect(restore.CompareSequenceValues(toc.SequenceValue{LastVal: 42, IsCalled: true}, toc.SequenceValue{LastVal: 42}, 1)).To(Equal(-1))
+		})
+		It("advances a sequence with a negative increment toward lower values", func() {
+			Expect(restore.CompareSequenceValues(toc.SequenceValue{LastVal: -1}, toc.SequenceValue{LastVal: -42, IsCalled: true}, -1)).To(Equal(1))
+		})
+		It("leaves a sequence at its value in the backup", func() {
+			Expect(restore.CompareSequenceValues(toc.SequenceValue{LastVal: 42, IsCalled: true}, toc.SequenceValue{LastVal: 42, IsCalled: true}, 1)).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,84 @@
+package restore
+
+/*
+ * This file contains functions for restoring the configuration settings of
+ * the database and of roles, set with ALTER DATABASE ... SET and ALTER ROLE
+ * ... [IN DATABASE ...] SET, in a phase of their own after the database and
+ * roles they refer to are created.
+ */
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+var settingPattern = regexp.MustCompile(` SET (\S+) TO `)
+
+/*
+ * The settings of roles are only restored along with the roles themselves,
+ * with --with-globals.
+ */
+func getSettingsStatements(metadataFilename string) []toc.StatementWithType {
+	objectTypes := []string{"SESSION GUCS", "DATABASE GUC"}
+	if MustGetFlagBool(options.WITH_GLOBALS) {
+		objectTypes = append(objectTypes, "ROLE GUCS")
+	}
+	statements := GetRestoreMetadataStatements("global", metadataFilename, objectTypes, []string{})
+	if MustGetFlagString(options.REDIRECT_DB) != "" {
+		statements = toc.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, getQuotedRedirectDatabase())
+	}
+	if MustGetFlagBool(options.SKIP_UNKNOWN_GUCS) {
+		statements = FilterUnknownSettingStatements(statements, getKnownSettings(connectionPool))
+	}
+	return statements
+}
+
+func restoreSettings(metadataFilename string) {
+	gplog.Info("Restoring configuration settings")
+	statements := getSettingsStatements(metadataFilename)
+	numErrors := ExecuteRestoreMetadataStatements(statements, "Configuration settings", nil, utils.PB_VERBOSE, false)
+
+	if numErrors > 0 {
+		gplog.Info("Configuration settings restore completed with failures")
+	} else {
+		gplog.Info("Configuration settings restore complete")
+	}
+}
+
+func getKnownSettings(connectionPool *dbconn.DBConn) map[string]bool {
+	names := dbconn.MustSelectStringSlice(connectionPool, "SELECT lower(name) AS string FROM pg_settings")
+	knownSettings := make(map[string]bool, len(names))
+	for _, name := range names {
+		knownSettings[name] = true
+	}
+	return knownSettings
+}
+
+/*
+ * Removes the database and role settings of parameters that the restore
+ * database does not have, such as those removed in a later GPDB version,
+ * which would otherwise fail to restore.  Parameters with a '.' in their name
+ * are placeholders for extensions, which can always be set.
+ */
+func FilterUnknownSettingStatements(statements []toc.StatementWithType, knownSettings map[string]bool) []toc.StatementWithType {
+	filteredStatements := make([]toc.StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		if statement.ObjectType == "DATABASE GUC" || statement.ObjectType == "ROLE GUCS" {
+			if match := settingPattern.FindStringSubmatch(statement.Statement); match != nil {
+				name := strings.ToLower(match[1])
+				if !strings.Contains(name, ".") && !knownSettings[name] {
+					gplog.Warn("Skipping setting of parameter %s for %s, as the parameter does not exist in the restore database", match[1], statement.Name)
+					continue
+				}
+			}
+		}
+		filteredStatements = append(filteredStatements, statement)
+	}
+	return filteredStatements
+}
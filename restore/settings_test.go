@@ -0,0 +1,32 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("restore/settings tests", func() {
+	Describe("FilterUnknownSettingStatements", func() {
+		knownSettings := map[string]bool{"search_path": true, "datestyle": true, "statement_timeout": true}
+		sessionGUCs := toc.StatementWithType{ObjectType: "SESSION GUCS", Statement: "SET gp_removed_guc = on;"}
+		searchPath := toc.StatementWithType{ObjectType: "DATABASE GUC", Name: "testdb", Statement: "\nALTER DATABASE testdb SET search_path TO public, myschema;"}
+		dateStyle := toc.StatementWithType{ObjectType: "ROLE GUCS", Name: "testrole", Statement: "\n\nALTER ROLE testrole SET DateStyle TO ISO, MDY;"}
+		inDatabase := toc.StatementWithType{ObjectType: "ROLE GUCS", Name: "testrole", Statement: "\n\nALTER ROLE testrole IN DATABASE testdb SET statement_timeout TO '10s';"}
+		extension := toc.StatementWithType{ObjectType: "DATABASE GUC", Name: "testdb", Statement: "\nALTER DATABASE testdb SET myapp.mode TO 'strict';"}
+		removed := toc.StatementWithType{ObjectType: "ROLE GUCS", Name: "testrole", Statement: "\n\nALTER ROLE testrole IN DATABASE testdb SET gp_removed_guc TO 'on';"}
+
+		It("keeps the settings of known parameters and of extension placeholders", func() {
+			statements := []toc.StatementWithType{sessionGUCs, searchPath, dateStyle, inDatabase, extension}
+			Expect(restore.FilterUnknownSettingStatements(statements, knownSettings)).To(Equal(statements))
+		})
+		It("skips the settings of unknown parameters", func() {
+			statements := []toc.StatementWithType{searchPath, removed}
+			Expect(restore.FilterUnknownSettingStatements(statements, knownSettings)).To(Equal([]toc.StatementWithType{searchPath}))
+			Expect(logfile).To(Say("Skipping setting of parameter gp_removed_guc for testrole, as the parameter does not exist in the restore database"))
+		})
+	})
+})
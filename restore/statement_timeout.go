@@ -0,0 +1,53 @@
+package restore
+
+/*
+ * This file contains functions for limiting how long each statement of the
+ * pre-data and post-data phases may run with --statement-timeout-predata and
+ * --statement-timeout-postdata, so that one slow statement such as a CREATE
+ * INDEX cannot hold up the restore indefinitely.  A statement cancelled by
+ * the timeout is recorded as a failed object, as with --on-error-continue, so
+ * that it can be run again later with --retry-failed.
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/jackc/pgconn"
+)
+
+const QUERY_CANCELED = "57014"
+
+/*
+ * Statements cancelled for other reasons, such as by pg_cancel_backend, have
+ * the same error code but a different message.
+ */
+func IsStatementTimeoutError(err error) bool {
+	pgErr, ok := err.(*pgconn.PgError)
+	return ok && pgErr.Code == QUERY_CANCELED && strings.Contains(pgErr.Message, "statement timeout")
+}
+
+/*
+ * Sets the timeout on every connection.  A timeout of 0 removes it.
+ */
+func setStatementTimeout(seconds int) {
+	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
+		connectionPool.MustExec(fmt.Sprintf("SET statement_timeout = %d", seconds*1000), connNum)
+	}
+}
+
+/*
+ * Sets the timeout of a phase and returns a function that removes it, to be
+ * deferred until the phase is finished.
+ */
+func setPhaseStatementTimeout(phase string, seconds int) func() {
+	if seconds == 0 {
+		return func() {}
+	}
+	gplog.Verbose("Setting a statement timeout of %d seconds for the %s phase", seconds, phase)
+	setStatementTimeout(seconds)
+	return func() {
+		setStatementTimeout(0)
+	}
+}
@@ -0,0 +1,27 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/statement_timeout tests", func() {
+	Describe("IsStatementTimeoutError", func() {
+		It("returns true for a statement cancelled by the statement timeout", func() {
+			err := &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"}
+			Expect(restore.IsStatementTimeoutError(err)).To(BeTrue())
+		})
+		It("returns false for a statement cancelled by the user", func() {
+			err := &pgconn.PgError{Code: "57014", Message: "canceling statement due to user request"}
+			Expect(restore.IsStatementTimeoutError(err)).To(BeFalse())
+		})
+		It("returns false for any other error", func() {
+			Expect(restore.IsStatementTimeoutError(&pgconn.PgError{Code: "42P07"})).To(BeFalse())
+			Expect(restore.IsStatementTimeoutError(errors.New("statement timeout"))).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,58 @@
+package restore
+
+/*
+ * This file contains functions for --status, which prints the progress of a
+ * running restore from the status file that it keeps up to date.
+ */
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func DoStatus() {
+	SetLoggerVerbosity()
+	backupTimestamp := MustGetFlagString(options.TIMESTAMP)
+
+	conn := dbconn.NewDBConnFromEnvironment("postgres")
+	conn.MustConnect(1)
+	segConfig := cluster.MustGetSegmentConfiguration(conn)
+	conn.Close()
+	globalCluster = cluster.NewCluster(segConfig)
+	segPrefix, err := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), backupTimestamp)
+	gplog.FatalOnError(err)
+	fpInfo := filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), backupTimestamp, segPrefix)
+
+	statusFilename, err := GetLatestRestoreStatusFile(fpInfo)
+	gplog.FatalOnError(err)
+	status, err := utils.ReadRunStatus(statusFilename)
+	gplog.FatalOnError(err)
+	fmt.Fprint(operating.System.Stdout, utils.FormatRunStatus(status, time.Now()))
+}
+
+/*
+ * A backup may be restored several times, so the status file of the restore
+ * with the latest timestamp is used.
+ */
+func GetLatestRestoreStatusFile(fpInfo filepath.FilePathInfo) (string, error) {
+	pattern := fpInfo.GetRestoreStatusFilePath("*")
+	statusFiles, err := operating.System.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(statusFiles) == 0 {
+		return "", errors.Errorf("No restore of backup %s has been started", fpInfo.Timestamp)
+	}
+	sort.Strings(statusFiles)
+	return statusFiles[len(statusFiles)-1], nil
+}
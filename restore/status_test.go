@@ -0,0 +1,43 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/restore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/status tests", func() {
+	var fpInfo filepath.FilePathInfo
+	BeforeEach(func() {
+		fpInfo = filepath.NewFilePathInfo(cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, DataDir: "/data/gpseg-1"}}), "", "20170101010101", "gpseg")
+	})
+	AfterEach(func() {
+		operating.InitializeSystemFunctions()
+	})
+	Describe("GetLatestRestoreStatusFile", func() {
+		It("returns the status file of the latest restore of the backup", func() {
+			var globPattern string
+			operating.System.Glob = func(pattern string) ([]string, error) {
+				globPattern = pattern
+				return []string{"gprestore_20170101010101_20170103010101_status.yaml", "gprestore_20170101010101_20170102010101_status.yaml"}, nil
+			}
+
+			statusFile, err := restore.GetLatestRestoreStatusFile(fpInfo)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(globPattern).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gprestore_20170101010101_*_status.yaml"))
+			Expect(statusFile).To(Equal("gprestore_20170101010101_20170103010101_status.yaml"))
+		})
+		It("returns an error if the backup has not been restored", func() {
+			operating.System.Glob = func(pattern string) ([]string, error) { return []string{}, nil }
+
+			_, err := restore.GetLatestRestoreStatusFile(fpInfo)
+
+			Expect(err).To(MatchError("No restore of backup 20170101010101 has been started"))
+		})
+	})
+})
@@ -0,0 +1,68 @@
+package restore
+
+/*
+ * This file contains functions for restoring backups stored in S3 with
+ * --storage s3, which writes a plugin config naming gpbackup_helper as the
+ * plugin executable and then restores exactly as it would with
+ * --plugin-config.
+ */
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+var s3FlagNames = []string{options.S3_BUCKET, options.S3_ENDPOINT, options.S3_FOLDER, options.S3_REGION}
+
+func getS3Settings() utils.S3Settings {
+	return utils.S3Settings{
+		Bucket:     MustGetFlagString(options.S3_BUCKET),
+		Folder:     MustGetFlagString(options.S3_FOLDER),
+		Region:     MustGetFlagString(options.S3_REGION),
+		Endpoint:   MustGetFlagString(options.S3_ENDPOINT),
+		PartSizeMB: utils.DefaultS3PartSizeMB,
+	}
+}
+
+func validateStorageFlags(flags *pflag.FlagSet) {
+	if MustGetFlagString(options.STORAGE) != utils.STORAGE_S3 {
+		for _, flagName := range s3FlagNames {
+			if flags.Changed(flagName) {
+				gplog.Fatal(errors.Errorf("Cannot use --%s without --storage s3", flagName), "")
+			}
+		}
+		return
+	}
+	for _, flagName := range []string{options.PLUGIN_CONFIG, options.BACKUP_DIR} {
+		if flags.Changed(flagName) {
+			gplog.Fatal(errors.Errorf("Cannot use --%s with --storage s3", flagName), "")
+		}
+	}
+}
+
+func validateStorageFlagValues() {
+	err := utils.ValidateStorage(MustGetFlagString(options.STORAGE))
+	gplog.FatalOnError(err)
+	if MustGetFlagString(options.STORAGE) == utils.STORAGE_S3 {
+		err = getS3Settings().Validate()
+		gplog.FatalOnError(err)
+	}
+}
+
+/*
+ * Sets --plugin-config to the plugin config for --storage s3, so that the
+ * restore uses it as it would any other.
+ */
+func configureS3Storage() {
+	if MustGetFlagString(options.STORAGE) != utils.STORAGE_S3 || s3PluginConfigFile != "" {
+		return
+	}
+	var err error
+	s3PluginConfigFile, err = utils.WriteS3PluginConfig(getS3Settings())
+	gplog.FatalOnError(err)
+	_ = cmdFlags.Set(options.PLUGIN_CONFIG, s3PluginConfigFile)
+	gplog.Info("Using S3 bucket %s for backup storage", MustGetFlagString(options.S3_BUCKET))
+}
@@ -0,0 +1,182 @@
+package restore
+
+/*
+ * This file contains functions for --verify-table-definitions, which checks
+ * that tables created outside of gprestore, such as by schema migrations,
+ * match the backup before a data-only restore loads any data into them.
+ */
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+type TableColumn struct {
+	TableName string
+	Name      string
+	Type      string
+}
+
+/*
+ * Splits a list of quoted identifiers separated by commas, such as the
+ * attribute string of a data entry, without splitting quoted identifiers
+ * that contain commas.
+ */
+func SplitIdentifierList(list string) []string {
+	list = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(list), "("), ")")
+	identifiers := make([]string, 0)
+	if list == "" {
+		return identifiers
+	}
+	inQuotes := false
+	start := 0
+	for i, char := range list {
+		if char == '"' {
+			inQuotes = !inQuotes
+		} else if char == ',' && !inQuotes {
+			identifiers = append(identifiers, strings.TrimSpace(list[start:i]))
+			start = i + 1
+		}
+	}
+	return append(identifiers, strings.TrimSpace(list[start:]))
+}
+
+/*
+ * Returns the definition of each column in a CREATE TABLE statement written
+ * by gpbackup, keyed by the quoted column name, where each definition starts
+ * with the type of the column and is followed by its other clauses.
+ */
+func ParseColumnDefinitions(createStatement string) map[string]string {
+	columns := make(map[string]string)
+	for _, line := range strings.Split(createStatement, "\n") {
+		if !strings.HasPrefix(line, "\t") {
+			continue
+		}
+		line = strings.TrimSuffix(strings.TrimPrefix(line, "\t"), ",")
+		nameEnd := strings.Index(line, " ")
+		if strings.HasPrefix(line, `"`) {
+			// Quoted names may contain spaces, and quotes in them are doubled
+			nameEnd = -1
+			for i := 1; i < len(line); i++ {
+				if line[i] == '"' {
+					if i+1 < len(line) && line[i+1] == '"' {
+						i++
+						continue
+					}
+					nameEnd = i + 1
+					break
+				}
+			}
+		}
+		if nameEnd <= 0 || nameEnd >= len(line) {
+			continue
+		}
+		// Columns of typed tables take their types from the composite type
+		definition := strings.TrimSpace(line[nameEnd:])
+		if !strings.HasPrefix(definition, "WITH OPTIONS") {
+			columns[line[:nameEnd]] = definition
+		}
+	}
+	return columns
+}
+
+/*
+ * Compares the columns of each table in the restore database against the
+ * columns that were backed up, returning a description of each difference.
+ * The backed up type of a column is only checked if the CREATE TABLE
+ * statement of its table is in the backup, as it is not for data-only
+ * backups.
+ */
+func CompareTableDefinitions(entries []toc.MasterDataEntry, backupDefinitions map[string]map[string]string, restoreColumns []TableColumn) []string {
+	columnsByTable := make(map[string]map[string]string)
+	for _, column := range restoreColumns {
+		if columnsByTable[column.TableName] == nil {
+			columnsByTable[column.TableName] = make(map[string]string)
+		}
+		columnsByTable[column.TableName][column.Name] = column.Type
+	}
+
+	mismatches := make([]string, 0)
+	for _, entry := range entries {
+		backupFQN := utils.MakeFQN(entry.Schema, entry.Name)
+		restoreFQN := getRestoreTableFQN(entry.Schema, entry.Name)
+		columnTypes, ok := columnsByTable[restoreFQN]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("Table %s does not exist", restoreFQN))
+			continue
+		}
+		for _, column := range SplitIdentifierList(entry.AttributeString) {
+			restoreType, ok := columnTypes[column]
+			if !ok {
+				mismatches = append(mismatches, fmt.Sprintf("Table %s has no column %s", restoreFQN, column))
+				continue
+			}
+			definition, ok := backupDefinitions[backupFQN][column]
+			if !ok {
+				continue
+			}
+			if definition != restoreType && !strings.HasPrefix(definition, restoreType+" ") {
+				mismatches = append(mismatches, fmt.Sprintf("Column %s of table %s has type %s, but the backup has %s", column, restoreFQN, restoreType, definition))
+			}
+		}
+	}
+	return mismatches
+}
+
+func GetRestoreTableColumns(connectionPool *dbconn.DBConn, tables []string) []TableColumn {
+	columns := make([]TableColumn, 0)
+	if len(tables) == 0 {
+		return columns
+	}
+	query := fmt.Sprintf(`
+SELECT
+	quote_ident(n.nspname) || '.' || quote_ident(c.relname) AS tablename,
+	quote_ident(a.attname) AS name,
+	pg_catalog.format_type(a.atttypid, a.atttypmod) AS type
+FROM pg_attribute a
+JOIN pg_class c ON c.oid = a.attrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE a.attnum > 0
+	AND NOT a.attisdropped
+	AND quote_ident(n.nspname) || '.' || quote_ident(c.relname) IN (%s)
+ORDER BY c.oid, a.attnum`, utils.SliceToQuotedString(tables))
+	err := connectionPool.Select(&columns, query)
+	gplog.FatalOnError(err, fmt.Sprintf("Query was: %s", query))
+	return columns
+}
+
+func verifyTableDefinitions(metadataFilename string, filteredDataEntries map[string][]toc.MasterDataEntry) {
+	gplog.Info("Verifying table definitions in the restore database")
+	entries := make([]toc.MasterDataEntry, 0)
+	restoreTables := make([]string, 0)
+	for _, timestampEntries := range filteredDataEntries {
+		for _, entry := range timestampEntries {
+			entries = append(entries, entry)
+			restoreTables = append(restoreTables, getRestoreTableFQN(entry.Schema, entry.Name))
+		}
+	}
+
+	backupDefinitions := make(map[string]map[string]string)
+	if !backupConfig.DataOnly {
+		for _, statement := range GetRestoreMetadataStatements("predata", metadataFilename, []string{"TABLE"}, []string{}) {
+			backupDefinitions[utils.MakeFQN(statement.Schema, statement.Name)] = ParseColumnDefinitions(statement.Statement)
+		}
+	}
+
+	mismatches := CompareTableDefinitions(entries, backupDefinitions, GetRestoreTableColumns(connectionPool, restoreTables))
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		for _, mismatch := range mismatches {
+			gplog.Error("%s", mismatch)
+		}
+		gplog.Fatal(errors.Errorf("%d table definition(s) in the restore database do not match the backup", len(mismatches)), "")
+	}
+	gplog.Info("Table definitions of %d tables match the backup", len(entries))
+}
@@ -0,0 +1,86 @@
+package restore
+
+import (
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/table_definitions tests", func() {
+	BeforeEach(func() {
+		opts = &options.Options{}
+	})
+	Describe("SplitIdentifierList", func() {
+		It("splits an attribute string into column names", func() {
+			Expect(SplitIdentifierList("(a,b,c)")).To(Equal([]string{"a", "b", "c"}))
+		})
+		It("does not split quoted names containing commas", func() {
+			Expect(SplitIdentifierList(`(a,"b,c","d""e")`)).To(Equal([]string{"a", `"b,c"`, `"d""e"`}))
+		})
+		It("returns no names for an empty attribute string", func() {
+			Expect(SplitIdentifierList("")).To(BeEmpty())
+		})
+	})
+	Describe("ParseColumnDefinitions", func() {
+		It("parses the columns of a CREATE TABLE statement", func() {
+			statement := `
+
+CREATE TABLE public.foo (
+	i integer NOT NULL,
+	"first name" character varying(20) DEFAULT 'x'::character varying,
+	ts timestamp without time zone
+) DISTRIBUTED BY (i);`
+			Expect(ParseColumnDefinitions(statement)).To(Equal(map[string]string{
+				"i":            "integer NOT NULL",
+				`"first name"`: "character varying(20) DEFAULT 'x'::character varying",
+				"ts":           "timestamp without time zone",
+			}))
+		})
+		It("skips the columns of typed tables", func() {
+			statement := "CREATE TABLE public.foo OF public.mytype (\n\ti WITH OPTIONS DEFAULT 1\n) DISTRIBUTED RANDOMLY;"
+			Expect(ParseColumnDefinitions(statement)).To(BeEmpty())
+		})
+	})
+	Describe("CompareTableDefinitions", func() {
+		entries := []toc.MasterDataEntry{{Schema: "public", Name: "foo", AttributeString: "(i,j)"}}
+		backupDefinitions := map[string]map[string]string{
+			"public.foo": {"i": "integer NOT NULL", "j": "character varying(20)"},
+		}
+		It("finds no differences between matching tables", func() {
+			restoreColumns := []TableColumn{
+				{TableName: "public.foo", Name: "i", Type: "integer"},
+				{TableName: "public.foo", Name: "j", Type: "character varying(20)"},
+				{TableName: "public.foo", Name: "k", Type: "text"},
+			}
+			Expect(CompareTableDefinitions(entries, backupDefinitions, restoreColumns)).To(BeEmpty())
+		})
+		It("reports missing tables, missing columns, and changed types", func() {
+			restoreColumns := []TableColumn{
+				{TableName: "public.foo", Name: "i", Type: "bigint"},
+			}
+			missingTable := toc.MasterDataEntry{Schema: "public", Name: "bar", AttributeString: "(a)"}
+			Expect(CompareTableDefinitions(append(entries, missingTable), backupDefinitions, restoreColumns)).To(Equal([]string{
+				"Column i of table public.foo has type bigint, but the backup has integer NOT NULL",
+				"Table public.foo has no column j",
+				"Table public.bar does not exist",
+			}))
+		})
+		It("only checks column names when the backup has no table definitions", func() {
+			restoreColumns := []TableColumn{
+				{TableName: "public.foo", Name: "i", Type: "bigint"},
+				{TableName: "public.foo", Name: "j", Type: "text"},
+			}
+			Expect(CompareTableDefinitions(entries, map[string]map[string]string{}, restoreColumns)).To(BeEmpty())
+		})
+		It("checks the redirected table", func() {
+			opts.RedirectSchema = "other"
+			restoreColumns := []TableColumn{
+				{TableName: "other.foo", Name: "i", Type: "integer"},
+				{TableName: "other.foo", Name: "j", Type: "character varying(20)"},
+			}
+			Expect(CompareTableDefinitions(entries, backupDefinitions, restoreColumns)).To(BeEmpty())
+		})
+	})
+})
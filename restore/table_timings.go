@@ -0,0 +1,38 @@
+package restore
+
+/*
+ * This file contains functions for --table-timings, which records how long
+ * the data of each table took to restore.
+ */
+
+import (
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/toc"
+)
+
+var tableTimingsMutex sync.Mutex
+
+func recordTableTiming(entry toc.MasterDataEntry, tableName string, duration time.Duration) {
+	tableTimingsMutex.Lock()
+	defer tableTimingsMutex.Unlock()
+	tableTimings = append(tableTimings, report.TableTiming{
+		Table:        tableName,
+		CopyDuration: duration,
+		Bytes:        entry.Size,
+		Rows:         entry.RowsCopied,
+	})
+}
+
+func writeTableTimings() {
+	timingsFilename := globalFPInfo.GetRestoreTableTimingsFilePath(restoreStartTime)
+	err := report.WriteTableTimingsFile(timingsFilename, tableTimings)
+	if err != nil {
+		gplog.Warn("Unable to write table timings to %s: %v", timingsFilename, err)
+		return
+	}
+	gplog.Info("Table timings written to %s", timingsFilename)
+}
@@ -0,0 +1,182 @@
+package restore
+
+/*
+ * This file contains functions for --to-file, which writes the statements of a
+ * restore to a psql script instead of executing them, using only the backup
+ * files on the master and without connecting to a database.
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/pkg/errors"
+)
+
+func DoRestoreToFile() {
+	SetLoggerVerbosity()
+	restoreStartTime = history.CurrentTimestamp()
+	backupTimestamp := MustGetFlagString(options.TIMESTAMP)
+	gplog.Info("Restore Key = %s", backupTimestamp)
+
+	var err error
+	opts, err = options.NewOptions(cmdFlags)
+	gplog.FatalOnError(err)
+	opts.IncludedRelations, err = options.QuoteTableNamesWithoutConnection(opts.GetIncludedTables())
+	gplog.FatalOnError(err)
+	opts.ExcludedRelations, err = options.QuoteTableNamesWithoutConnection(opts.GetExcludedTables())
+	gplog.FatalOnError(err)
+
+	globalCluster = getMasterOnlyCluster()
+	segPrefix, err := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), backupTimestamp)
+	gplog.FatalOnError(err)
+	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), backupTimestamp, segPrefix)
+	readBackupConfig()
+	validateBackupMetadata()
+	if MustGetFlagBool(options.TO_FILE_DATA) && backupConfig.SingleDataFile {
+		gplog.Fatal(errors.Errorf("Cannot use --to-file-data with a backup taken with --single-data-file, as its data is read by gpbackup_helper"), "")
+	}
+	if retryFile := MustGetFlagString(options.RETRY_FAILED); retryFile != "" {
+		retryObjects, err = ReadFailedObjectsFile(retryFile)
+		gplog.FatalOnError(err)
+	}
+
+	var getDataSection func(map[string][]toc.MasterDataEntry) RestoreSection
+	if MustGetFlagBool(options.TO_FILE_DATA) && isPostgresRestoreScript() {
+		validateInlineDataRestore()
+		getDataSection = GetInlineDataSection
+	} else if MustGetFlagBool(options.TO_FILE_DATA) {
+		getDataSection = getCopyStatementsSection
+	}
+	sections := getRestoreSections(getDataSection, getConnectStatements())
+	scriptFilename := MustGetFlagString(options.TO_FILE)
+	scriptFile, err := os.Create(scriptFilename)
+	gplog.FatalOnError(err)
+	scriptWriter := bufio.NewWriter(scriptFile)
+	err = WriteRestoreScript(scriptWriter, getRestoreScriptHeader(backupTimestamp), MustGetFlagBool(options.ON_ERROR_CONTINUE), sections)
+	gplog.FatalOnError(err)
+	err = scriptWriter.Flush()
+	gplog.FatalOnError(err)
+	err = scriptFile.Close()
+	gplog.FatalOnError(err)
+	gplog.Info("Restore script written to %s", scriptFilename)
+}
+
+/*
+ * Only the master data directory is needed to find the backup files when
+ * --backup-dir is not used, and the segments are never contacted.
+ */
+func getMasterOnlyCluster() *cluster.Cluster {
+	masterDataDir := operating.System.Getenv("MASTER_DATA_DIRECTORY")
+	if MustGetFlagString(options.BACKUP_DIR) == "" && masterDataDir == "" {
+		gplog.Fatal(errors.Errorf("Cannot find the backup without --backup-dir when MASTER_DATA_DIRECTORY is not set"), "")
+	}
+	return cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, Hostname: "localhost", DataDir: masterDataDir}})
+}
+
+/*
+ * When the script creates the database, psql must connect to it before the
+ * rest of the script runs.  The session GUCs are set as they would be on
+ * each restore connection.
+ */
+func getConnectStatements() []string {
+	statements := make([]string, 0)
+	if MustGetFlagBool(options.CREATE_DB) {
+		dbName := backupConfig.DatabaseName
+		if MustGetFlagString(options.REDIRECT_DB) != "" {
+			dbName = getQuotedRedirectDatabase()
+		}
+		statements = append(statements, fmt.Sprintf(`\connect %s`, dbName))
+	}
+	gucStatements := GetRestoreMetadataStatements("global", globalFPInfo.GetMetadataFilePath(), []string{"SESSION GUCS"}, []string{})
+	if isPostgresRestoreScript() {
+		gucStatements = ConvertStatementsForPostgres(gucStatements, getKeptGreenplumSyntax())
+	}
+	return append(statements, getStatementStrings(gucStatements)...)
+}
+
+/*
+ * The data is read from the backup files of every segment of the backup, so
+ * the directories of all segments must be readable under --backup-dir.
+ */
+func validateInlineDataRestore() {
+	if MustGetFlagString(options.BACKUP_DIR) == "" {
+		gplog.Fatal(errors.Errorf("Cannot use --to-file-data with --to-file-format postgres without --backup-dir"), "")
+	}
+	if backupConfig.Dedup {
+		gplog.Fatal(errors.Errorf("Cannot use --to-file-data with --to-file-format postgres with a backup taken with --dedup"), "")
+	}
+	if backupConfig.SegmentCount == 0 {
+		gplog.Fatal(errors.Errorf("Cannot use --to-file-data with --to-file-format postgres with a backup that does not record its segment count"), "")
+	}
+}
+
+func getRestoreScriptHeader(backupTimestamp string) []string {
+	if isPostgresRestoreScript() {
+		return []string{"--", fmt.Sprintf("-- PostgreSQL database dump converted from backup %s", backupTimestamp), "--"}
+	}
+	return []string{fmt.Sprintf("-- Restore script for backup %s", backupTimestamp)}
+}
+
+func getCopyStatementsSection(filteredDataEntries map[string][]toc.MasterDataEntry) RestoreSection {
+	return RestoreSection{Title: "Data", Statements: GetCopyStatements(filteredDataEntries)}
+}
+
+/*
+ * Returns the COPY statement restoring the data of each table in the same
+ * order as GetDataLoadPlan.  The statements read the backup files on each
+ * segment, so the script must be run against a cluster with as many segments
+ * as the backup.
+ */
+func GetCopyStatements(filteredDataEntries map[string][]toc.MasterDataEntry) []string {
+	statements := make([]string, 0)
+	for _, timestamp := range getSortedTimestamps(filteredDataEntries) {
+		fpInfo := GetBackupFPInfoForTimestamp(timestamp)
+		for _, entry := range getDataEntriesInLoadOrder(filteredDataEntries[timestamp]) {
+			destinationToRead, pipeThroughProgram := getTableDataSource(&fpInfo, entry)
+			tableName := getRestoreTableFQN(entry.Schema, entry.Name)
+			statements = append(statements, GetCopyTableInQuery(tableName, entry.AttributeString, destinationToRead, false, pipeThroughProgram))
+		}
+	}
+	return statements
+}
+
+/*
+ * psql stops at the first error, as gprestore does, unless --on-error-continue
+ * is used.
+ */
+func WriteRestoreScript(writer io.Writer, header []string, onErrorContinue bool, sections []RestoreSection) error {
+	_, _ = fmt.Fprintln(writer, strings.Join(header, "\n"))
+	if !onErrorContinue {
+		_, _ = fmt.Fprintln(writer, `\set ON_ERROR_STOP on`)
+	}
+	for _, section := range sections {
+		for i, statement := range section.Statements {
+			section.Statements[i] = terminateStatement(statement)
+		}
+	}
+	return writeRestoreSections(writer, sections)
+}
+
+/*
+ * Statements generated by gprestore, such as ANALYZE, are executed without a
+ * terminating semicolon, which psql needs.  Statements may be preceded by
+ * comments, so only their last line is checked for a psql command or comment.
+ */
+func terminateStatement(statement string) string {
+	lastLine := statement[strings.LastIndex(statement, "\n")+1:]
+	if strings.HasSuffix(statement, ";") || strings.HasPrefix(lastLine, `\`) || strings.HasPrefix(lastLine, "--") {
+		return statement
+	}
+	return statement + ";"
+}
@@ -0,0 +1,63 @@
+package restore
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("restore/to_file tests", func() {
+	BeforeEach(func() {
+		opts = &options.Options{}
+		backupConfig = &history.BackupConfig{}
+	})
+	Describe("GetCopyStatements", func() {
+		BeforeEach(func() {
+			globalCluster = cluster.NewCluster([]cluster.SegConfig{{ContentID: -1, Hostname: "localhost", DataDir: "/data/master"}})
+		})
+		It("copies the data of each table from its backup files largest first", func() {
+			dataEntries := map[string][]toc.MasterDataEntry{
+				"20170101010101": {
+					{Schema: "public", Name: "small", Oid: 1, AttributeString: "(i)", Size: 10, Uncompressed: true},
+					{Schema: "public", Name: "large", Oid: 2, AttributeString: "(i,j)", Size: 1000, Uncompressed: true},
+				},
+			}
+			Expect(GetCopyStatements(dataEntries)).To(Equal([]string{
+				"COPY public.large(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_2 | cat -' WITH CSV DELIMITER ',' ON SEGMENT;",
+				"COPY public.small(i) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1 | cat -' WITH CSV DELIMITER ',' ON SEGMENT;",
+			}))
+		})
+	})
+	Describe("WriteRestoreScript", func() {
+		sections := func() []RestoreSection {
+			return []RestoreSection{
+				{Title: "Restore database session", Statements: []string{`\connect newdb`, "SET client_encoding = 'UTF8';"}},
+				{Title: "ANALYZE", Statements: []string{"ANALYZE public.foo"}},
+			}
+		}
+		It("writes a psql script that stops on the first error", func() {
+			buffer := NewBuffer()
+			WriteRestoreScript(buffer, []string{"-- Restore script for backup 20170101010101"}, false, sections())
+			Expect(string(buffer.Contents())).To(Equal(`-- Restore script for backup 20170101010101
+\set ON_ERROR_STOP on
+
+-- Restore database session (2)
+\connect newdb
+SET client_encoding = 'UTF8';
+
+-- ANALYZE (1)
+ANALYZE public.foo;
+`))
+		})
+		It("does not stop on errors with --on-error-continue", func() {
+			buffer := NewBuffer()
+			WriteRestoreScript(buffer, []string{"-- Restore script for backup 20170101010101"}, true, sections())
+			Expect(string(buffer.Contents())).ToNot(ContainSubstring("ON_ERROR_STOP"))
+		})
+	})
+})
@@ -0,0 +1,257 @@
+package restore
+
+/*
+ * This file contains functions for --list-toc and --toc-edit, which write the
+ * entries of a backup to a list that can be edited to skip or reorder them,
+ * like pg_restore -l and -L, and restore only the entries of the edited list.
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const TOC_LIST_DATA_SECTION = "data"
+
+type tocListSection struct {
+	name    string
+	entries *[]toc.MetadataEntry
+}
+
+/*
+ * The metadata sections of the TOC in the order in which they are restored.
+ * The data section is restored between predata and postdata.
+ */
+func getTOCListSections(tocContents *toc.TOC) []tocListSection {
+	return []tocListSection{
+		{"cluster", &tocContents.ClusterEntries},
+		{"global", &tocContents.GlobalEntries},
+		{"predata", &tocContents.PredataEntries},
+		{"postdata", &tocContents.PostdataEntries},
+		{"statistics", &tocContents.StatisticsEntries},
+	}
+}
+
+/*
+ * The entries kept by an edited TOC list.  Metadata holds the kept entries of
+ * each metadata section in the listed order, and DataTables the position in
+ * the list of each table whose data is kept.
+ */
+type TOCEdit struct {
+	Metadata   map[string][]toc.MetadataEntry
+	DataTables map[string]int
+}
+
+func tocListDescription(objectType string, schema string, name string) string {
+	return fmt.Sprintf("%s; %s; %s", objectType, schema, name)
+}
+
+/*
+ * Returns the id and description of each entry of the backup, keyed by id.
+ * An id names the section of the entry and its position in the section.
+ */
+func getTOCListEntries(tocContents *toc.TOC, dataEntries []toc.MasterDataEntry) (ids []string, descriptions map[string]string) {
+	ids = make([]string, 0)
+	descriptions = make(map[string]string)
+	addEntry := func(section string, index int, description string) {
+		id := fmt.Sprintf("%s:%d", section, index)
+		ids = append(ids, id)
+		// Editors often strip trailing spaces, such as those left by empty names
+		descriptions[id] = strings.TrimSpace(description)
+	}
+	for _, section := range getTOCListSections(tocContents) {
+		if section.name == "postdata" {
+			for i, entry := range dataEntries {
+				addEntry(TOC_LIST_DATA_SECTION, i, tocListDescription("TABLE DATA", entry.Schema, entry.Name))
+			}
+		}
+		for i, entry := range *section.entries {
+			addEntry(section.name, i, tocListDescription(entry.ObjectType, entry.Schema, entry.Name))
+		}
+	}
+	return ids, descriptions
+}
+
+/*
+ * Writes a line for each entry of the backup, in the order in which the
+ * entries are restored.
+ */
+func WriteTOCList(writer io.Writer, header []string, tocContents *toc.TOC, dataEntries []toc.MasterDataEntry) error {
+	for _, line := range header {
+		_, err := fmt.Fprintf(writer, "; %s\n", line)
+		if err != nil {
+			return err
+		}
+	}
+	ids, descriptions := getTOCListEntries(tocContents, dataEntries)
+	for _, id := range ids {
+		_, err := fmt.Fprintf(writer, "%s; %s\n", id, descriptions[id])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * Reads an edited TOC list.  Lines that are blank or start with ';' are
+ * skipped.  The description of each entry must still match the backup, so
+ * that a list written for a different backup is not applied by mistake.
+ * Entries can only be reordered within their section, as the sections are
+ * always restored in the same order.
+ */
+func ReadTOCEdit(reader io.Reader, filename string, tocContents *toc.TOC, dataEntries []toc.MasterDataEntry) (*TOCEdit, error) {
+	_, descriptions := getTOCListEntries(tocContents, dataEntries)
+	sections := getTOCListSections(tocContents)
+	sectionEntries := make(map[string][]toc.MetadataEntry)
+	for _, section := range sections {
+		sectionEntries[section.name] = *section.entries
+	}
+
+	edit := &TOCEdit{Metadata: make(map[string][]toc.MetadataEntry), DataTables: make(map[string]int)}
+	for _, section := range sections {
+		edit.Metadata[section.name] = make([]toc.MetadataEntry, 0)
+	}
+	listed := make(map[string]bool)
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		idAndDescription := strings.SplitN(line, ";", 2)
+		id := strings.TrimSpace(idAndDescription[0])
+		description, ok := descriptions[id]
+		if !ok {
+			return nil, errors.Errorf("Line %d of %s refers to entry %s, which is not in the backup", lineNum, filename, id)
+		}
+		if len(idAndDescription) < 2 || strings.TrimSpace(idAndDescription[1]) != description {
+			return nil, errors.Errorf("Line %d of %s does not match entry %s of the backup; the list may be from a different backup", lineNum, filename, id)
+		}
+		if listed[id] {
+			return nil, errors.Errorf("Line %d of %s lists entry %s more than once", lineNum, filename, id)
+		}
+		listed[id] = true
+
+		sectionAndIndex := strings.SplitN(id, ":", 2)
+		index, _ := strconv.Atoi(sectionAndIndex[1])
+		if sectionAndIndex[0] == TOC_LIST_DATA_SECTION {
+			entry := dataEntries[index]
+			edit.DataTables[utils.MakeFQN(entry.Schema, entry.Name)] = len(edit.DataTables)
+		} else {
+			edit.Metadata[sectionAndIndex[0]] = append(edit.Metadata[sectionAndIndex[0]], sectionEntries[sectionAndIndex[0]][index])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return edit, nil
+}
+
+/*
+ * Replaces the metadata entries of the TOC with the entries kept by the edit,
+ * so that every statement restored from the metadata files follows the list.
+ */
+func (edit *TOCEdit) ApplyToMetadata(tocContents *toc.TOC) {
+	for _, section := range getTOCListSections(tocContents) {
+		*section.entries = edit.Metadata[section.name]
+	}
+}
+
+/*
+ * Keeps only the data entries of the tables in the edited list.
+ */
+func FilterTOCEditDataEntries(entries []toc.MasterDataEntry, dataTables map[string]int) []toc.MasterDataEntry {
+	filteredEntries := make([]toc.MasterDataEntry, 0)
+	for _, entry := range entries {
+		if _, ok := dataTables[utils.MakeFQN(entry.Schema, entry.Name)]; ok {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	return filteredEntries
+}
+
+/*
+ * Returns the data entries in the order of the edited list.
+ */
+func SortDataEntriesByTOCEdit(dataEntries []toc.MasterDataEntry, dataTables map[string]int) []toc.MasterDataEntry {
+	sortedEntries := make([]toc.MasterDataEntry, len(dataEntries))
+	copy(sortedEntries, dataEntries)
+	sort.SliceStable(sortedEntries, func(i int, j int) bool {
+		return dataTables[utils.MakeFQN(sortedEntries[i].Schema, sortedEntries[i].Name)] <
+			dataTables[utils.MakeFQN(sortedEntries[j].Schema, sortedEntries[j].Name)]
+	})
+	return sortedEntries
+}
+
+/*
+ * Returns the data entries of every table in the restore plan, whichever
+ * backup in the plan holds its data.
+ */
+func getTOCListDataEntries() []toc.MasterDataEntry {
+	dataEntries := make([]toc.MasterDataEntry, 0)
+	for _, entry := range backupConfig.RestorePlan {
+		fpInfo := GetBackupFPInfoForTimestamp(entry.Timestamp)
+		tocfile := toc.NewTOC(fpInfo.GetTOCFilePath())
+		dataEntries = append(dataEntries, tocfile.GetDataEntriesMatching([]string{}, []string{}, []string{}, []string{}, entry.TableFQNs)...)
+	}
+	return dataEntries
+}
+
+func applyTOCEdit(filename string) {
+	listFile, err := os.Open(filename)
+	gplog.FatalOnError(err)
+	defer listFile.Close()
+	edit, err := ReadTOCEdit(listFile, filename, globalTOC, getTOCListDataEntries())
+	gplog.FatalOnError(err)
+	edit.ApplyToMetadata(globalTOC)
+	tocEditDataTables = edit.DataTables
+	gplog.Verbose("Restoring only the entries listed in %s", filename)
+}
+
+func DoListTOC() {
+	SetLoggerVerbosity()
+	backupTimestamp := MustGetFlagString(options.TIMESTAMP)
+	gplog.Info("Restore Key = %s", backupTimestamp)
+
+	var err error
+	opts, err = options.NewOptions(cmdFlags)
+	gplog.FatalOnError(err)
+
+	globalCluster = getMasterOnlyCluster()
+	segPrefix, err := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), backupTimestamp)
+	gplog.FatalOnError(err)
+	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), backupTimestamp, segPrefix)
+	readBackupConfig()
+	validateBackupMetadata()
+
+	header := []string{
+		fmt.Sprintf("Entries of backup %s of database %s", backupTimestamp, backupConfig.DatabaseName),
+		"Delete entries or comment them out with ';' to skip them, or move entries",
+		"within their section to change the order in which they are restored, then",
+		"restore with --toc-edit to restore only the listed entries.",
+	}
+	listFilename := MustGetFlagString(options.LIST_TOC)
+	listFile, err := os.Create(listFilename)
+	gplog.FatalOnError(err)
+	listWriter := bufio.NewWriter(listFile)
+	err = WriteTOCList(listWriter, header, globalTOC, getTOCListDataEntries())
+	gplog.FatalOnError(err)
+	err = listWriter.Flush()
+	gplog.FatalOnError(err)
+	err = listFile.Close()
+	gplog.FatalOnError(err)
+	gplog.Info("TOC list written to %s", listFilename)
+}
@@ -0,0 +1,99 @@
+package restore_test
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/toc_edit tests", func() {
+	var (
+		tocContents *toc.TOC
+		dataEntries []toc.MasterDataEntry
+	)
+	BeforeEach(func() {
+		tocContents = &toc.TOC{
+			GlobalEntries: []toc.MetadataEntry{{ObjectType: "SESSION GUCS", StartByte: 0, EndByte: 10}},
+			PredataEntries: []toc.MetadataEntry{
+				{Schema: "public", Name: "foo", ObjectType: "TABLE", StartByte: 10, EndByte: 20},
+				{Schema: "public", Name: "bar", ObjectType: "TABLE", StartByte: 20, EndByte: 30},
+				{Schema: "public", Name: "myfunc(integer)", ObjectType: "FUNCTION", StartByte: 30, EndByte: 40},
+			},
+			PostdataEntries: []toc.MetadataEntry{{Schema: "public", Name: "foo_idx", ObjectType: "INDEX", ReferenceObject: "public.foo", StartByte: 40, EndByte: 50}},
+		}
+		tocContents.InitializeMetadataEntryMap()
+		dataEntries = []toc.MasterDataEntry{{Schema: "public", Name: "foo", Oid: 1}, {Schema: "public", Name: "bar", Oid: 2}}
+	})
+	Describe("WriteTOCList", func() {
+		It("writes a line for each entry in the order in which the entries are restored", func() {
+			buffer := bytes.NewBuffer([]byte(""))
+			err := restore.WriteTOCList(buffer, []string{"Entries of backup 20170101010101"}, tocContents, dataEntries)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buffer.String()).To(Equal(`; Entries of backup 20170101010101
+global:0; SESSION GUCS; ;
+predata:0; TABLE; public; foo
+predata:1; TABLE; public; bar
+predata:2; FUNCTION; public; myfunc(integer)
+data:0; TABLE DATA; public; foo
+data:1; TABLE DATA; public; bar
+postdata:0; INDEX; public; foo_idx
+`))
+		})
+	})
+	Describe("ReadTOCEdit", func() {
+		It("keeps only the listed entries in the listed order", func() {
+			list := `; Entries of backup 20170101010101
+global:0; SESSION GUCS; ;
+
+predata:2; FUNCTION; public; myfunc(integer)
+predata:1; TABLE; public; bar
+;predata:0; TABLE; public; foo
+data:1; TABLE DATA; public; bar
+;data:0; TABLE DATA; public; foo
+`
+			edit, err := restore.ReadTOCEdit(strings.NewReader(list), "toc_list", tocContents, dataEntries)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(edit.Metadata["global"]).To(Equal(tocContents.GlobalEntries))
+			Expect(edit.Metadata["predata"]).To(Equal([]toc.MetadataEntry{tocContents.PredataEntries[2], tocContents.PredataEntries[1]}))
+			Expect(edit.Metadata["postdata"]).To(BeEmpty())
+			Expect(edit.DataTables).To(Equal(map[string]int{"public.bar": 0}))
+
+			edit.ApplyToMetadata(tocContents)
+			Expect(tocContents.PredataEntries).To(Equal([]toc.MetadataEntry{
+				{Schema: "public", Name: "myfunc(integer)", ObjectType: "FUNCTION", StartByte: 30, EndByte: 40},
+				{Schema: "public", Name: "bar", ObjectType: "TABLE", StartByte: 20, EndByte: 30},
+			}))
+			Expect(tocContents.PostdataEntries).To(BeEmpty())
+		})
+		It("returns an error for an entry that is not in the backup", func() {
+			_, err := restore.ReadTOCEdit(strings.NewReader("predata:3; TABLE; public; baz\n"), "toc_list", tocContents, dataEntries)
+			Expect(err).To(MatchError("Line 1 of toc_list refers to entry predata:3, which is not in the backup"))
+		})
+		It("returns an error for an entry that does not match the backup", func() {
+			_, err := restore.ReadTOCEdit(strings.NewReader("; header\npredata:0; TABLE; public; baz\n"), "toc_list", tocContents, dataEntries)
+			Expect(err).To(MatchError("Line 2 of toc_list does not match entry predata:0 of the backup; the list may be from a different backup"))
+		})
+		It("returns an error for an entry listed more than once", func() {
+			_, err := restore.ReadTOCEdit(strings.NewReader("data:0; TABLE DATA; public; foo\ndata:0; TABLE DATA; public; foo\n"), "toc_list", tocContents, dataEntries)
+			Expect(err).To(MatchError("Line 2 of toc_list lists entry data:0 more than once"))
+		})
+	})
+	Describe("FilterTOCEditDataEntries", func() {
+		It("keeps the data entries of the listed tables", func() {
+			Expect(restore.FilterTOCEditDataEntries(dataEntries, map[string]int{"public.bar": 0})).To(Equal([]toc.MasterDataEntry{{Schema: "public", Name: "bar", Oid: 2}}))
+		})
+	})
+	Describe("SortDataEntriesByTOCEdit", func() {
+		It("orders the data entries as they are listed", func() {
+			dataTables := map[string]int{"public.bar": 0, "public.foo": 1}
+			Expect(restore.SortDataEntriesByTOCEdit(dataEntries, dataTables)).To(Equal([]toc.MasterDataEntry{
+				{Schema: "public", Name: "bar", Oid: 2}, {Schema: "public", Name: "foo", Oid: 1},
+			}))
+		})
+	})
+})
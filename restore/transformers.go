@@ -0,0 +1,234 @@
+package restore
+
+/*
+ * This file contains structs and functions for statement transformers, which
+ * rewrite the metadata statements of a restore before they are run, such as
+ * to change storage options or to remove clauses that the restore database
+ * does not support.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"plugin"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/pkg/errors"
+)
+
+// The symbol that a plugin given by --transform-plugin must export
+const TRANSFORM_PLUGIN_SYMBOL = "TransformStatement"
+
+/*
+ * A StatementTransformer is given the statements of a section at once, and
+ * returns the statements to run in their place in the same order.  A
+ * statement returned with an empty Statement is not run.
+ */
+type StatementTransformer struct {
+	Name      string
+	Transform func(statements []toc.StatementWithType) ([]toc.StatementWithType, error)
+}
+
+type TransformedStatement struct {
+	Transformer string `json:"transformer"`
+	Schema      string `json:"schema"`
+	Name        string `json:"name"`
+	ObjectType  string `json:"object_type"`
+	Original    string `json:"original"`
+	Transformed string `json:"transformed"`
+}
+
+/*
+ * Transformers may be registered by code embedding gprestore before DoSetup
+ * is called, or given by --transform-plugin and --transform-program.  They
+ * are run in the order in which they are registered.
+ */
+func RegisterStatementTransformer(transformer StatementTransformer) error {
+	if transformer.Name == "" || transformer.Transform == nil {
+		return errors.Errorf("Statement transformer %s must have a name and a function to transform statements", transformer.Name)
+	}
+	for _, registeredTransformer := range transformers {
+		if registeredTransformer.Name == transformer.Name {
+			return errors.Errorf("A statement transformer named %s is already registered", transformer.Name)
+		}
+	}
+	transformers = append(transformers, transformer)
+	return nil
+}
+
+/*
+ * The plugin must be built with the same version of Go and of gpbackup as
+ * gprestore, and export a function
+ *
+ *   func TransformStatement(statement toc.StatementWithType) (toc.StatementWithType, error)
+ *
+ * which is called for each statement.
+ */
+func NewPluginTransformer(filename string) (StatementTransformer, error) {
+	transformPlugin, err := plugin.Open(filename)
+	if err != nil {
+		return StatementTransformer{}, errors.Errorf("Unable to load transform plugin %s: %v", filename, err)
+	}
+	symbol, err := transformPlugin.Lookup(TRANSFORM_PLUGIN_SYMBOL)
+	if err != nil {
+		return StatementTransformer{}, errors.Errorf("Transform plugin %s does not export %s", filename, TRANSFORM_PLUGIN_SYMBOL)
+	}
+	transformStatement, ok := symbol.(func(toc.StatementWithType) (toc.StatementWithType, error))
+	if !ok {
+		return StatementTransformer{}, errors.Errorf("%s in transform plugin %s is not a func(toc.StatementWithType) (toc.StatementWithType, error)", TRANSFORM_PLUGIN_SYMBOL, filename)
+	}
+	return StatementTransformer{
+		Name: filename,
+		Transform: func(statements []toc.StatementWithType) ([]toc.StatementWithType, error) {
+			var err error
+			transformed := make([]toc.StatementWithType, len(statements))
+			for i, statement := range statements {
+				transformed[i], err = transformStatement(statement)
+				if err != nil {
+					return nil, errors.Errorf("Transform plugin %s failed for %s %s: %v", filename, statement.ObjectType, statement.Name, err)
+				}
+			}
+			return transformed, nil
+		},
+	}, nil
+}
+
+/*
+ * The program is run once for the statements of each section.  It is given
+ * them on standard input as JSON objects with the fields Schema, Name,
+ * ObjectType, ReferenceObject, and Statement, one per line, and must write
+ * the statements to run in their place to standard output in the same form
+ * and order.
+ */
+func NewProgramTransformer(program string) StatementTransformer {
+	return StatementTransformer{
+		Name: program,
+		Transform: func(statements []toc.StatementWithType) ([]toc.StatementWithType, error) {
+			var input bytes.Buffer
+			encoder := json.NewEncoder(&input)
+			for _, statement := range statements {
+				if err := encoder.Encode(statement); err != nil {
+					return nil, err
+				}
+			}
+			var stderr bytes.Buffer
+			cmd := exec.Command(program)
+			cmd.Stdin = &input
+			cmd.Stderr = &stderr
+			output, err := cmd.Output()
+			if err != nil {
+				return nil, errors.Errorf("Transform program %s failed: %v: %s", program, err, strings.TrimSpace(stderr.String()))
+			}
+			transformed := make([]toc.StatementWithType, 0, len(statements))
+			decoder := json.NewDecoder(bytes.NewReader(output))
+			for {
+				var statement toc.StatementWithType
+				err = decoder.Decode(&statement)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return nil, errors.Errorf("Invalid output from transform program %s: %v", program, err)
+				}
+				transformed = append(transformed, statement)
+			}
+			return transformed, nil
+		},
+	}
+}
+
+func registerStatementTransformersFromFlags() {
+	if filename := MustGetFlagString(options.TRANSFORM_PLUGIN); filename != "" {
+		transformer, err := NewPluginTransformer(filename)
+		gplog.FatalOnError(err)
+		err = RegisterStatementTransformer(transformer)
+		gplog.FatalOnError(err)
+	}
+	if program := MustGetFlagString(options.TRANSFORM_PROGRAM); program != "" {
+		err := RegisterStatementTransformer(NewProgramTransformer(program))
+		gplog.FatalOnError(err)
+	}
+}
+
+/*
+ * Runs the statements through each transformer in turn, returning the
+ * statements to run and each change that the transformers made.  Statements
+ * emptied by a transformer are left out, and are not given to the later
+ * transformers.
+ */
+func TransformStatements(statements []toc.StatementWithType, transformers []StatementTransformer) ([]toc.StatementWithType, []TransformedStatement, error) {
+	changes := make([]TransformedStatement, 0)
+	for _, transformer := range transformers {
+		if len(statements) == 0 {
+			break
+		}
+		// Transformers may edit the statements they are given in place
+		input := make([]toc.StatementWithType, len(statements))
+		copy(input, statements)
+		transformed, err := transformer.Transform(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(transformed) != len(statements) {
+			return nil, nil, errors.Errorf("Statement transformer %s returned %d statements for %d statements", transformer.Name, len(transformed), len(statements))
+		}
+		kept := make([]toc.StatementWithType, 0, len(transformed))
+		for i, statement := range transformed {
+			if statement.Statement != statements[i].Statement {
+				changes = append(changes, TransformedStatement{
+					Transformer: transformer.Name,
+					Schema:      statements[i].Schema,
+					Name:        statements[i].Name,
+					ObjectType:  statements[i].ObjectType,
+					Original:    statements[i].Statement,
+					Transformed: statement.Statement,
+				})
+			}
+			if strings.TrimSpace(statement.Statement) != "" {
+				kept = append(kept, statement)
+			}
+		}
+		statements = kept
+	}
+	return statements, changes, nil
+}
+
+func editStatementsForTransformers(statements []toc.StatementWithType) []toc.StatementWithType {
+	if len(transformers) == 0 {
+		return statements
+	}
+	statements, changes, err := TransformStatements(statements, transformers)
+	gplog.FatalOnError(err)
+	for _, change := range changes {
+		if strings.TrimSpace(change.Transformed) == "" {
+			gplog.Verbose("Statement transformer %s removed the statement for %s %s", change.Transformer, change.ObjectType, change.Name)
+		} else {
+			gplog.Verbose("Statement transformer %s changed the statement for %s %s", change.Transformer, change.ObjectType, change.Name)
+		}
+	}
+	transformChanges = append(transformChanges, changes...)
+	return statements
+}
+
+func writeStatementTransforms() {
+	if len(transformChanges) == 0 {
+		return
+	}
+	transformsFilename := globalFPInfo.GetStatementTransformsFilePath(restoreStartTime)
+	contents, err := json.MarshalIndent(transformChanges, "", "  ")
+	gplog.FatalOnError(err)
+	transformsFile, err := os.OpenFile(transformsFilename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	gplog.FatalOnError(err)
+	_, err = transformsFile.Write(append(contents, '\n'))
+	gplog.FatalOnError(err)
+	err = transformsFile.Close()
+	gplog.FatalOnError(err)
+	err = os.Chmod(transformsFilename, 0444)
+	gplog.FatalOnError(err)
+	gplog.Info("%d statements were changed by statement transformers; the original and transformed statements are listed in %s", len(transformChanges), transformsFilename)
+}
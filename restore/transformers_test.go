@@ -0,0 +1,131 @@
+package restore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/transformers tests", func() {
+	replaceTransformer := func(name string, old string, new string) restore.StatementTransformer {
+		return restore.StatementTransformer{Name: name, Transform: func(statements []toc.StatementWithType) ([]toc.StatementWithType, error) {
+			for i := range statements {
+				statements[i].Statement = strings.Replace(statements[i].Statement, old, new, -1)
+			}
+			return statements, nil
+		}}
+	}
+	var statements []toc.StatementWithType
+	BeforeEach(func() {
+		statements = []toc.StatementWithType{
+			{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i integer) WITH (appendonly=true) DISTRIBUTED BY (i);"},
+			{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "ALTER TABLE public.foo OWNER TO testrole;"},
+		}
+	})
+	AfterEach(func() {
+		restore.SetStatementTransformers(nil)
+	})
+	Describe("RegisterStatementTransformer", func() {
+		It("registers a transformer", func() {
+			Expect(restore.RegisterStatementTransformer(replaceTransformer("storage", "appendonly", "appendoptimized"))).To(Succeed())
+		})
+		It("rejects a transformer without a function", func() {
+			err := restore.RegisterStatementTransformer(restore.StatementTransformer{Name: "storage"})
+			Expect(err).To(MatchError("Statement transformer storage must have a name and a function to transform statements"))
+		})
+		It("rejects a transformer with the name of a registered one", func() {
+			Expect(restore.RegisterStatementTransformer(replaceTransformer("storage", "appendonly", "appendoptimized"))).To(Succeed())
+			err := restore.RegisterStatementTransformer(replaceTransformer("storage", "true", "false"))
+			Expect(err).To(MatchError("A statement transformer named storage is already registered"))
+		})
+	})
+	Describe("TransformStatements", func() {
+		It("records each statement that a transformer changes", func() {
+			transformed, changes, err := restore.TransformStatements(statements, []restore.StatementTransformer{replaceTransformer("storage", "appendonly", "appendoptimized")})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(transformed[0].Statement).To(Equal("CREATE TABLE public.foo (i integer) WITH (appendoptimized=true) DISTRIBUTED BY (i);"))
+			Expect(transformed[1].Statement).To(Equal("ALTER TABLE public.foo OWNER TO testrole;"))
+			Expect(changes).To(Equal([]restore.TransformedStatement{{
+				Transformer: "storage", Schema: "public", Name: "foo", ObjectType: "TABLE",
+				Original:    "CREATE TABLE public.foo (i integer) WITH (appendonly=true) DISTRIBUTED BY (i);",
+				Transformed: "CREATE TABLE public.foo (i integer) WITH (appendoptimized=true) DISTRIBUTED BY (i);",
+			}}))
+		})
+		It("runs the transformers in turn and leaves out emptied statements", func() {
+			transformers := []restore.StatementTransformer{
+				replaceTransformer("owners", "ALTER TABLE public.foo OWNER TO testrole;", ""),
+				replaceTransformer("storage", "appendonly=true", "appendonly=false"),
+			}
+
+			transformed, changes, err := restore.TransformStatements(statements, transformers)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(transformed).To(HaveLen(1))
+			Expect(transformed[0].Statement).To(Equal("CREATE TABLE public.foo (i integer) WITH (appendonly=false) DISTRIBUTED BY (i);"))
+			Expect(changes).To(HaveLen(2))
+			Expect(changes[0].Transformer).To(Equal("owners"))
+			Expect(changes[0].Transformed).To(Equal(""))
+			Expect(changes[1].Transformer).To(Equal("storage"))
+		})
+		It("fails if a transformer does not return a statement for each statement", func() {
+			dropAll := restore.StatementTransformer{Name: "drop", Transform: func(statements []toc.StatementWithType) ([]toc.StatementWithType, error) {
+				return []toc.StatementWithType{}, nil
+			}}
+
+			_, _, err := restore.TransformStatements(statements, []restore.StatementTransformer{dropAll})
+
+			Expect(err).To(MatchError("Statement transformer drop returned 0 statements for 2 statements"))
+		})
+		It("fails if a transformer fails", func() {
+			failing := restore.StatementTransformer{Name: "failing", Transform: func(statements []toc.StatementWithType) ([]toc.StatementWithType, error) {
+				return nil, errors.New("unsupported statement")
+			}}
+
+			_, _, err := restore.TransformStatements(statements, []restore.StatementTransformer{failing})
+
+			Expect(err).To(MatchError("unsupported statement"))
+		})
+	})
+	Describe("NewProgramTransformer", func() {
+		var dir string
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "transform_program")
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(dir)
+		})
+		writeProgram := func(script string) string {
+			program := path.Join(dir, "transform.sh")
+			Expect(ioutil.WriteFile(program, []byte("#!/bin/sh\n"+script+"\n"), 0755)).To(Succeed())
+			return program
+		}
+		It("rewrites the statements with the program", func() {
+			program := writeProgram("sed 's/appendonly=true/appendonly=false/'")
+
+			transformed, err := restore.NewProgramTransformer(program).Transform(statements)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(transformed).To(HaveLen(2))
+			Expect(transformed[0]).To(Equal(toc.StatementWithType{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "CREATE TABLE public.foo (i integer) WITH (appendonly=false) DISTRIBUTED BY (i);"}))
+			Expect(transformed[1]).To(Equal(statements[1]))
+		})
+		It("fails if the program fails", func() {
+			program := writeProgram("echo 'no rules file' >&2; exit 1")
+
+			_, err := restore.NewProgramTransformer(program).Transform(statements)
+
+			Expect(err).To(MatchError(ContainSubstring("no rules file")))
+		})
+	})
+})
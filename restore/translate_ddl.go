@@ -0,0 +1,166 @@
+package restore
+
+/*
+ * This file contains functions for --translate-ddl, which restores a backup
+ * into a database of a different major version of GPDB by rewriting the DDL
+ * known to be incompatible with the restore database.  The translation is
+ * best effort: other objects may still fail to restore.
+ */
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+var (
+	appendOptimizedPattern   = regexp.MustCompile(`\bappendoptimized=`)
+	replicatedPattern        = regexp.MustCompile(`DISTRIBUTED REPLICATED`)
+	columnCollationPattern   = regexp.MustCompile(` COLLATE (?:[\w$]+\.)?(?:"(?:[^"]|"")+"|[\w$]+)`)
+	errorTablePattern        = regexp.MustCompile(`\nLOG ERRORS INTO [^\n]+`)
+	oidsStorageOptionPattern = regexp.MustCompile(`(?i)(, )?\boids=(true|false)\b(, )?`)
+	emptyStorageOptions      = regexp.MustCompile(`WITH \(\) ?`)
+)
+
+/*
+ * A rewrite of DDL that the major version of GPDB the backup was taken on
+ * accepts but that of the restore database does not.  AppliesTo is given the
+ * major versions of the backup and restore databases.
+ */
+type DDLTranslation struct {
+	Description string
+	ObjectTypes []string
+	AppliesTo   func(backupMajor int, restoreMajor int) bool
+	Translate   func(statement string) string
+}
+
+var ddlTranslations = []DDLTranslation{
+	{
+		Description: "Replaced the appendoptimized storage option with appendonly",
+		ObjectTypes: []string{"TABLE", "MATERIALIZED VIEW"},
+		AppliesTo: func(backupMajor int, restoreMajor int) bool {
+			return backupMajor >= 6 && restoreMajor < 6
+		},
+		Translate: func(statement string) string {
+			return appendOptimizedPattern.ReplaceAllString(statement, "appendonly=")
+		},
+	},
+	{
+		Description: "Replaced DISTRIBUTED REPLICATED, which needs GPDB 6, with DISTRIBUTED RANDOMLY",
+		ObjectTypes: []string{"TABLE", "MATERIALIZED VIEW"},
+		AppliesTo: func(backupMajor int, restoreMajor int) bool {
+			return backupMajor >= 6 && restoreMajor < 6
+		},
+		Translate: func(statement string) string {
+			return replicatedPattern.ReplaceAllString(statement, "DISTRIBUTED RANDOMLY")
+		},
+	},
+	{
+		Description: "Removed the collations of columns, which need GPDB 6",
+		ObjectTypes: []string{"TABLE"},
+		AppliesTo: func(backupMajor int, restoreMajor int) bool {
+			return backupMajor >= 6 && restoreMajor < 6
+		},
+		Translate: func(statement string) string {
+			return columnCollationPattern.ReplaceAllString(statement, "")
+		},
+	},
+	{
+		Description: "Replaced LOG ERRORS INTO an error table, which was removed in GPDB 5, with LOG ERRORS",
+		ObjectTypes: []string{"TABLE"},
+		AppliesTo: func(backupMajor int, restoreMajor int) bool {
+			return backupMajor < 5 && restoreMajor >= 5
+		},
+		Translate: func(statement string) string {
+			return errorTablePattern.ReplaceAllString(statement, "\nLOG ERRORS")
+		},
+	},
+	{
+		Description: "Removed the oids storage option, which was removed in GPDB 7",
+		ObjectTypes: []string{"TABLE", "MATERIALIZED VIEW"},
+		AppliesTo: func(backupMajor int, restoreMajor int) bool {
+			return backupMajor < 7 && restoreMajor >= 7
+		},
+		Translate: func(statement string) string {
+			statement = oidsStorageOptionPattern.ReplaceAllStringFunc(statement, func(option string) string {
+				if strings.HasPrefix(option, ", ") && strings.HasSuffix(option, ", ") {
+					return ", "
+				}
+				return ""
+			})
+			return emptyStorageOptions.ReplaceAllString(statement, "")
+		},
+	},
+}
+
+/*
+ * Returns the translations needed to restore a backup of the given major
+ * version into a database of the given major version, which are none if the
+ * versions are the same.
+ */
+func GetDDLTranslations(backupMajor int, restoreMajor int) []DDLTranslation {
+	translations := make([]DDLTranslation, 0)
+	if backupMajor == restoreMajor {
+		return translations
+	}
+	for _, translation := range ddlTranslations {
+		if translation.AppliesTo(backupMajor, restoreMajor) {
+			translations = append(translations, translation)
+		}
+	}
+	return translations
+}
+
+/*
+ * Applies the translations to the statements, returning for each translation
+ * that changed any statement the objects it changed.
+ */
+func TranslateStatements(statements []toc.StatementWithType, translations []DDLTranslation) map[string][]string {
+	translated := make(map[string][]string)
+	for i, statement := range statements {
+		for _, translation := range translations {
+			if !utils.Exists(translation.ObjectTypes, statement.ObjectType) {
+				continue
+			}
+			newStatement := translation.Translate(statements[i].Statement)
+			if newStatement != statements[i].Statement {
+				statements[i].Statement = newStatement
+				translated[translation.Description] = append(translated[translation.Description], utils.MakeFQN(statement.Schema, statement.Name))
+			}
+		}
+	}
+	return translated
+}
+
+func getDDLTranslations() []DDLTranslation {
+	if !MustGetFlagBool(options.TRANSLATE_DDL) || connectionPool == nil {
+		return []DDLTranslation{}
+	}
+	backupMajor, _ := strconv.Atoi(strings.Split(backupConfig.DatabaseVersion, ".")[0])
+	return GetDDLTranslations(backupMajor, int(connectionPool.Version.SemVer.Major))
+}
+
+func editStatementsForDDLTranslation(statements []toc.StatementWithType) {
+	translations := getDDLTranslations()
+	if len(translations) == 0 {
+		return
+	}
+	translated := TranslateStatements(statements, translations)
+	descriptions := make([]string, 0, len(translated))
+	for description := range translated {
+		descriptions = append(descriptions, description)
+	}
+	sort.Strings(descriptions)
+	for _, description := range descriptions {
+		gplog.Info("%s for %d object(s)", description, len(translated[description]))
+		for _, object := range translated[description] {
+			gplog.Verbose("%s for %s", description, object)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/translate_ddl tests", func() {
+	Describe("GetDDLTranslations", func() {
+		It("translates nothing between the same major versions", func() {
+			Expect(restore.GetDDLTranslations(6, 6)).To(BeEmpty())
+		})
+		It("translates only the DDL that the restore database does not accept", func() {
+			Expect(restore.GetDDLTranslations(6, 5)).To(HaveLen(3))
+			Expect(restore.GetDDLTranslations(4, 6)).To(HaveLen(1))
+			Expect(restore.GetDDLTranslations(5, 6)).To(BeEmpty())
+		})
+	})
+	Describe("TranslateStatements", func() {
+		It("rewrites GPDB 6 table DDL for GPDB 5", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: `
+
+CREATE TABLE public.foo (
+	i integer,
+	t text COLLATE pg_catalog."C"
+) WITH (appendoptimized=true, orientation=column) DISTRIBUTED REPLICATED;`},
+				{Schema: "public", Name: "foo_view", ObjectType: "VIEW", Statement: "\n\nCREATE VIEW public.foo_view AS SELECT 'DISTRIBUTED REPLICATED'::text;"},
+			}
+
+			translated := restore.TranslateStatements(statements, restore.GetDDLTranslations(6, 5))
+
+			Expect(statements[0].Statement).To(Equal(`
+
+CREATE TABLE public.foo (
+	i integer,
+	t text
+) WITH (appendonly=true, orientation=column) DISTRIBUTED RANDOMLY;`))
+			Expect(statements[1].Statement).To(Equal("\n\nCREATE VIEW public.foo_view AS SELECT 'DISTRIBUTED REPLICATED'::text;"))
+			Expect(translated).To(HaveLen(3))
+			Expect(translated["Replaced the appendoptimized storage option with appendonly"]).To(Equal([]string{"public.foo"}))
+		})
+		It("rewrites the error tables of GPDB 4 external tables", func() {
+			statements := []toc.StatementWithType{{Schema: "public", Name: "ext", ObjectType: "TABLE", Statement: `
+
+CREATE READABLE EXTERNAL TABLE public.ext (
+	i integer
+) LOCATION (
+	'gpfdist://host:8080/file.txt'
+)
+FORMAT 'text'
+LOG ERRORS INTO public.ext_errors
+SEGMENT REJECT LIMIT 10 ROWS;`}}
+
+			restore.TranslateStatements(statements, restore.GetDDLTranslations(4, 6))
+
+			Expect(statements[0].Statement).To(ContainSubstring("FORMAT 'text'\nLOG ERRORS\nSEGMENT REJECT LIMIT 10 ROWS;"))
+		})
+		It("removes the oids storage option for GPDB 7", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (i integer) WITH (appendonly=true, oids=false, compresstype=zlib) DISTRIBUTED RANDOMLY;"},
+				{Schema: "public", Name: "bar", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.bar (i integer) WITH (OIDS=FALSE) DISTRIBUTED RANDOMLY;"},
+			}
+
+			translated := restore.TranslateStatements(statements, restore.GetDDLTranslations(6, 7))
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLE public.foo (i integer) WITH (appendonly=true, compresstype=zlib) DISTRIBUTED RANDOMLY;"))
+			Expect(statements[1].Statement).To(Equal("\n\nCREATE TABLE public.bar (i integer) DISTRIBUTED RANDOMLY;"))
+			Expect(translated["Removed the oids storage option, which was removed in GPDB 7"]).To(Equal([]string{"public.foo", "public.bar"}))
+		})
+	})
+})
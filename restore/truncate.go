@@ -0,0 +1,156 @@
+package restore
+
+/*
+ * This file contains functions for --truncate-table, which removes the
+ * existing data of each table before its data is restored, so that data can
+ * be reloaded into existing tables with --data-only.
+ */
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func TruncateTable(tableFQN string, cascade bool, whichConn int) error {
+	gplog.Verbose("Truncating table %s prior to restoring data", tableFQN)
+	query := "TRUNCATE " + tableFQN
+	if cascade {
+		query += " CASCADE"
+	}
+	_, err := connectionPool.Exec(query, whichConn)
+	return err
+}
+
+/*
+ * The table is truncated in the same transaction in which its data is
+ * loaded, so that if the load fails, the table keeps its previous data.
+ */
+func restoreTruncatedTableData(fpInfo *filepath.FilePathInfo, entry toc.MasterDataEntry, tableName string, whichConn int) error {
+	err := connectionPool.Begin(whichConn)
+	if err != nil {
+		return err
+	}
+	err = TruncateTable(tableName, MustGetFlagBool(options.TRUNCATE_CASCADE), whichConn)
+	if err == nil {
+		err = restoreSingleTableData(fpInfo, entry, tableName, whichConn)
+	}
+	if err != nil {
+		_ = connectionPool.Rollback(whichConn)
+		return err
+	}
+	return connectionPool.Commit(whichConn)
+}
+
+/*
+ * Returns the tables with foreign keys referencing any of the given tables,
+ * directly or through other referencing tables, other than the given tables
+ * themselves.
+ */
+func GetTablesReferencing(connectionPool *dbconn.DBConn, tableFQNs []string) ([]string, error) {
+	isKnown := make(map[string]bool, len(tableFQNs))
+	for _, tableFQN := range tableFQNs {
+		isKnown[tableFQN] = true
+	}
+	referencingTables := make([]string, 0)
+	tablesToCheck := tableFQNs
+	for len(tablesToCheck) > 0 {
+		regclasses := make([]string, len(tablesToCheck))
+		for i, tableFQN := range tablesToCheck {
+			regclasses[i] = fmt.Sprintf("'%s'::regclass", utils.EscapeSingleQuotes(tableFQN))
+		}
+		query := fmt.Sprintf(`
+	SELECT DISTINCT quote_ident(n.nspname) || '.' || quote_ident(c.relname) AS name
+	FROM pg_constraint con
+		JOIN pg_class c ON con.conrelid = c.oid
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+	WHERE con.contype = 'f'
+		AND con.confrelid IN (%s)
+	ORDER BY name`, strings.Join(regclasses, ", "))
+		results := make([]string, 0)
+		err := connectionPool.Select(&results, query)
+		if err != nil {
+			return nil, err
+		}
+		tablesToCheck = make([]string, 0)
+		for _, tableFQN := range results {
+			if !isKnown[tableFQN] {
+				isKnown[tableFQN] = true
+				referencingTables = append(referencingTables, tableFQN)
+				tablesToCheck = append(tablesToCheck, tableFQN)
+			}
+		}
+	}
+	sort.Strings(referencingTables)
+	return referencingTables, nil
+}
+
+/*
+ * Truncating one restored table with CASCADE would remove the data already
+ * restored into any other restored table referencing it, so the tables with
+ * foreign keys between them cannot be restored together with CASCADE.
+ */
+func CheckTruncateCascade(connectionPool *dbconn.DBConn, tableFQNs []string) error {
+	for _, tableFQN := range tableFQNs {
+		referencingTables, err := GetTablesReferencing(connectionPool, []string{tableFQN})
+		if err != nil {
+			return err
+		}
+		for _, referencingTable := range referencingTables {
+			if utils.Exists(tableFQNs, referencingTable) {
+				return errors.Errorf("Cannot use --truncate-cascade to restore both table %s and table %s, which references it, as truncating %s would remove the restored data of %s",
+					tableFQN, referencingTable, tableFQN, referencingTable)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * Lists the tables that will be emptied before their data is restored, and
+ * when run from a terminal, asks for confirmation before any is truncated.
+ */
+func confirmTruncateTables(filteredDataEntries map[string][]toc.MasterDataEntry) {
+	tableFQNs := make([]string, 0)
+	for _, dataEntries := range filteredDataEntries {
+		for _, entry := range dataEntries {
+			tableFQN := getRestoreTableFQN(entry.Schema, entry.Name)
+			if !utils.Exists(tableFQNs, tableFQN) {
+				tableFQNs = append(tableFQNs, tableFQN)
+			}
+		}
+	}
+	if len(tableFQNs) == 0 {
+		return
+	}
+	sort.Strings(tableFQNs)
+	gplog.Warn("The existing data of %d tables will be removed before their data is restored", len(tableFQNs))
+	for _, tableFQN := range tableFQNs {
+		gplog.Verbose("Table %s will be truncated", tableFQN)
+	}
+	if MustGetFlagBool(options.TRUNCATE_CASCADE) {
+		err := CheckTruncateCascade(connectionPool, tableFQNs)
+		gplog.FatalOnError(err)
+		referencingTables, err := GetTablesReferencing(connectionPool, tableFQNs)
+		gplog.FatalOnError(err)
+		if len(referencingTables) > 0 {
+			gplog.Warn("The data of the following tables, which reference the tables being restored, will also be removed and will not be restored: %s", strings.Join(referencingTables, ", "))
+		}
+	}
+	if !utils.IsInteractive() {
+		return
+	}
+	fmt.Printf("Truncate %d tables in database %s before restoring their data? [y/N] ", len(tableFQNs), connectionPool.DBName)
+	if !utils.Confirm(os.Stdin) {
+		gplog.Fatal(errors.Errorf("Restore canceled; no tables were truncated"), "")
+	}
+}
@@ -0,0 +1,47 @@
+package restore_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gpbackup/restore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/truncate tests", func() {
+	Describe("TruncateTable", func() {
+		It("truncates the table", func() {
+			mock.ExpectExec(`TRUNCATE public.foo$`).WillReturnResult(sqlmock.NewResult(0, 0))
+			Expect(restore.TruncateTable("public.foo", false, 0)).To(Succeed())
+		})
+		It("truncates the table and the tables referencing it with cascade", func() {
+			mock.ExpectExec(`TRUNCATE public.foo CASCADE`).WillReturnResult(sqlmock.NewResult(0, 0))
+			Expect(restore.TruncateTable("public.foo", true, 0)).To(Succeed())
+		})
+	})
+	Describe("GetTablesReferencing", func() {
+		It("returns the tables referencing the given tables directly or indirectly", func() {
+			mock.ExpectQuery(`'public.foo'::regclass, 'public.bar'::regclass`).WillReturnRows(
+				sqlmock.NewRows([]string{"name"}).AddRow("public.bar").AddRow("public.child"))
+			mock.ExpectQuery(`'public.child'::regclass\)`).WillReturnRows(
+				sqlmock.NewRows([]string{"name"}).AddRow("public.grandchild"))
+			mock.ExpectQuery(`'public.grandchild'::regclass\)`).WillReturnRows(
+				sqlmock.NewRows([]string{"name"}).AddRow("public.child"))
+
+			referencingTables, err := restore.GetTablesReferencing(connectionPool, []string{"public.foo", "public.bar"})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(referencingTables).To(Equal([]string{"public.child", "public.grandchild"}))
+		})
+	})
+	Describe("CheckTruncateCascade", func() {
+		It("returns an error if a restored table references another restored table", func() {
+			mock.ExpectQuery(`'public.foo'::regclass\)`).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("public.bar"))
+			mock.ExpectQuery(`'public.bar'::regclass\)`).WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+			err := restore.CheckTruncateCascade(connectionPool, []string{"public.foo", "public.bar"})
+
+			Expect(err).To(MatchError("Cannot use --truncate-cascade to restore both table public.foo and table public.bar, which references it, as truncating public.foo would remove the restored data of public.bar"))
+		})
+	})
+})
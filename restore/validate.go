@@ -2,11 +2,15 @@ package restore
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
@@ -17,6 +21,57 @@ import (
  * This file contains functions related to validating user input.
  */
 
+/*
+ * An incremental backup is restored by restoring the data of each table from
+ * the most recent backup in its restore plan that backed it up, starting from
+ * the full backup the incremental backups were taken on top of, so every
+ * backup in the plan must still be present.  Checking them before anything is
+ * restored keeps a restore from failing once the metadata has been restored.
+ */
+func validateRestorePlan() {
+	restorePlan := backupConfig.RestorePlan
+	// --incremental only restores the data of the incremental backup itself
+	if len(restorePlan) < 2 || backupConfig.MetadataOnly || MustGetFlagBool(options.METADATA_ONLY) || MustGetFlagBool(options.INCREMENTAL) {
+		return
+	}
+	incrementals := make([]string, 0, len(restorePlan)-1)
+	for _, entry := range restorePlan[1:] {
+		incrementals = append(incrementals, entry.Timestamp)
+	}
+	gplog.Info("Backup %s is an incremental backup, so the data of each table will be restored from the most recent of full backup %s and incremental backups %s that contains it",
+		globalFPInfo.Timestamp, restorePlan[0].Timestamp, strings.Join(incrementals, ", "))
+	for _, entry := range restorePlan {
+		gplog.Verbose("Backup %s holds the data of %d tables to restore", entry.Timestamp, len(entry.TableFQNs))
+	}
+
+	missingBackups := FindMissingRestorePlanBackups(restorePlan, func(timestamp string) bool {
+		segPrefix, err := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), timestamp)
+		if err != nil {
+			return false
+		}
+		fpInfo := filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), timestamp, segPrefix)
+		return iohelper.FileExistsAndIsReadable(fpInfo.GetTOCFilePath())
+	})
+	if len(missingBackups) > 0 {
+		gplog.Fatal(errors.Errorf("Backup %s depends on backups %s, which could not be found. Restore these backups to the backup directory before restoring it.",
+			globalFPInfo.Timestamp, strings.Join(missingBackups, ", ")), "")
+	}
+}
+
+/*
+ * Returns the timestamps of the backups in the restore plan that are not
+ * present, in the order they were taken.
+ */
+func FindMissingRestorePlanBackups(restorePlan []history.RestorePlanEntry, isPresent func(timestamp string) bool) []string {
+	missingBackups := make([]string, 0)
+	for _, entry := range restorePlan {
+		if !isPresent(entry.Timestamp) {
+			missingBackups = append(missingBackups, entry.Timestamp)
+		}
+	}
+	return missingBackups
+}
+
 func validateFilterListsInBackupSet() {
 	ValidateIncludeSchemasInBackupSet(opts.IncludedSchemas)
 	ValidateExcludeSchemasInBackupSet(opts.ExcludedSchemas)
@@ -225,12 +280,18 @@ END AS string;`, utils.EscapeSingleQuotes(unquotedDBName))
 }
 
 func ValidateBackupFlagCombinations() {
-	if backupConfig.SingleDataFile && MustGetFlagInt(options.JOBS) != 1 {
+	if jobs := MustGetFlagString(options.JOBS); backupConfig.SingleDataFile && ((jobs != "1" && jobs != utils.JobsAuto) || MustGetFlagInt(options.JOBS_MAX) != 1) {
 		gplog.Fatal(errors.Errorf("Cannot use jobs flag when restoring backups with a single data file per segment."), "")
 	}
 	if (backupConfig.IncludeTableFiltered || backupConfig.DataOnly) && MustGetFlagBool(options.WITH_GLOBALS) {
 		gplog.Fatal(errors.Errorf("Global metadata is not backed up in table-filtered or data-only backups."), "")
 	}
+	if MustGetFlagBool(options.RESTORE_GLOBALS) && !backupConfig.GlobalsFile {
+		gplog.Fatal(errors.Errorf("Cannot use --restore-globals, as backup %s was not taken with --with-globals.  Use --with-globals to restore its global metadata.", backupConfig.Timestamp), "")
+	}
+	if MustGetFlagBool(options.CREATE_DB_OPTIONS) && backupConfig.DatabaseEncoding == "" {
+		gplog.Fatal(errors.Errorf("Cannot use --create-db-with-options, as backup %s does not record the encoding and locale of the database.  Use --create-db to create the database from the statement in the backup.", backupConfig.Timestamp), "")
+	}
 	if backupConfig.MetadataOnly && MustGetFlagBool(options.DATA_ONLY) {
 		gplog.Fatal(errors.Errorf("Cannot use data-only flag when restoring metadata-only backup"), "")
 	}
@@ -251,6 +312,9 @@ func validateBackupFlagPluginCombinations() {
 func ValidateFlagCombinations(flags *pflag.FlagSet) {
 	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.WITH_GLOBALS)
 	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.CREATE_DB)
+	if flags.Changed(options.CREATE_DB_OPTIONS) && !flags.Changed(options.CREATE_DB) {
+		gplog.Fatal(errors.Errorf("Cannot use --create-db-with-options without --create-db"), "")
+	}
 	options.CheckExclusiveFlags(flags, options.DEBUG, options.QUIET, options.VERBOSE)
 
 	options.CheckExclusiveFlags(flags, options.INCLUDE_SCHEMA, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE)
@@ -261,6 +325,8 @@ func ValidateFlagCombinations(flags *pflag.FlagSet) {
 	options.CheckExclusiveFlags(flags, options.PLUGIN_CONFIG, options.BACKUP_DIR)
 	options.CheckExclusiveFlags(flags, options.TRUNCATE_TABLE, options.METADATA_ONLY, options.INCREMENTAL)
 	options.CheckExclusiveFlags(flags, options.TRUNCATE_TABLE, options.REDIRECT_SCHEMA)
+	options.CheckExclusiveFlags(flags, options.SCHEMA_PREFIX, options.REDIRECT_SCHEMA)
+	options.CheckExclusiveFlags(flags, options.SCHEMA_SUFFIX, options.REDIRECT_SCHEMA)
 
 	if flags.Changed(options.REDIRECT_SCHEMA) {
 		// Redirect schema not compatible with any exclude flags
@@ -276,11 +342,147 @@ func ValidateFlagCombinations(flags *pflag.FlagSet) {
 	}
 	if flags.Changed(options.TRUNCATE_TABLE) &&
 		!(flags.Changed(options.INCLUDE_RELATION) || flags.Changed(options.INCLUDE_RELATION_FILE)) &&
-		!flags.Changed(options.DATA_ONLY) {
-		gplog.Fatal(errors.Errorf("Cannot use --truncate-table without --include-table or --include-table-file and without --data-only"), "")
+		!flags.Changed(options.DATA_ONLY) && !flags.Changed(options.IMPORT_TABLE) {
+		gplog.Fatal(errors.Errorf("Cannot use --truncate-table without --include-table, --include-table-file, or --import-table and without --data-only"), "")
+	}
+	if flags.Changed(options.TRUNCATE_CASCADE) && !flags.Changed(options.TRUNCATE_TABLE) {
+		gplog.Fatal(errors.Errorf("Cannot use --truncate-cascade without --truncate-table"), "")
 	}
 	if flags.Changed(options.INCREMENTAL) && !flags.Changed(options.DATA_ONLY) {
 		gplog.Fatal(errors.Errorf("Cannot use --incremental without --data-only"), "")
 	}
-	options.CheckExclusiveFlags(flags, options.RUN_ANALYZE, options.WITH_STATS)
+	if flags.Changed(options.VERIFY_TABLE_DEFS) && !flags.Changed(options.DATA_ONLY) {
+		gplog.Fatal(errors.Errorf("Cannot use --verify-table-definitions without --data-only"), "")
+	}
+	if flags.Changed(options.EXACT_SEQ_VALUES) && !flags.Changed(options.DATA_ONLY) {
+		gplog.Fatal(errors.Errorf("Cannot use --exact-sequence-values without --data-only"), "")
+	}
+	options.CheckExclusiveFlags(flags, options.VALIDATE_ROWCOUNTS, options.METADATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.SEGMENT_REJECT_LIMIT, options.METADATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.ANALYZE_PARTITION_ROOTS, options.METADATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.ANALYZE_PARTITION_ROOTS, options.RUN_ANALYZE)
+	options.CheckExclusiveFlags(flags, options.TRANSLATE_DDL, options.TO_FILE)
+	options.CheckExclusiveFlags(flags, options.REFRESH_MATVIEWS, options.METADATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.ON_CONFLICT, options.DATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.ON_CONFLICT, options.INCREMENTAL)
+	options.CheckExclusiveFlags(flags, options.ON_CONFLICT, options.TRUNCATE_TABLE)
+	options.CheckExclusiveFlags(flags, options.JOBS, options.JOBS_MIN)
+	options.CheckExclusiveFlags(flags, options.JOBS, options.JOBS_MAX)
+	if flags.Changed(options.JOBS_MIN) != flags.Changed(options.JOBS_MAX) {
+		gplog.Fatal(errors.Errorf("Cannot use --jobs-min without --jobs-max, or --jobs-max without --jobs-min"), "")
+	}
+	if minJobs, maxJobs := MustGetFlagInt(options.JOBS_MIN), MustGetFlagInt(options.JOBS_MAX); minJobs < 1 || minJobs > maxJobs {
+		gplog.Fatal(errors.Errorf("Invalid values %d and %d for --jobs-min and --jobs-max.  --jobs-min must be at least 1 and no greater than --jobs-max.", minJobs, maxJobs), "")
+	}
+	options.CheckExclusiveFlags(flags, options.RETRY_FAILED, options.CREATE_DB)
+	options.CheckExclusiveFlags(flags, options.RETRY_FAILED, options.WITH_GLOBALS)
+	options.CheckExclusiveFlags(flags, options.RETRY_FAILED, options.INCREMENTAL)
+	options.CheckExclusiveFlags(flags, options.RETRY_FAILED, options.ON_CONFLICT)
+	options.CheckExclusiveFlags(flags, options.RESTORE_GLOBALS, options.WITH_GLOBALS)
+	options.CheckExclusiveFlags(flags, options.RESTORE_GLOBALS, options.DATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.RESTORE_GLOBALS, options.RETRY_FAILED)
+	options.CheckExclusiveFlags(flags, options.DRY_RUN, options.ON_CONFLICT)
+	options.CheckExclusiveFlags(flags, options.STATUS, options.DRY_RUN, options.TO_FILE)
+	for _, flagName := range []string{options.DRY_RUN, options.ON_CONFLICT, options.INCREMENTAL, options.TRUNCATE_TABLE, options.VALIDATE_ROWCOUNTS, options.SEGMENT_REJECT_LIMIT, options.PLUGIN_CONFIG, options.STORAGE, options.SKIP_UNKNOWN_GUCS, options.REFRESH_MATVIEWS,
+		options.STATEMENT_TIMEOUT_PRE, options.STATEMENT_TIMEOUT_POST} {
+		options.CheckExclusiveFlags(flags, options.TO_FILE, flagName)
+	}
+	for _, flagName := range []string{options.TOC_EDIT, options.STATUS, options.DRY_RUN, options.TO_FILE, options.PLUGIN_CONFIG, options.STORAGE} {
+		options.CheckExclusiveFlags(flags, options.LIST_TOC, flagName)
+	}
+	if MustGetFlagString(options.ACL_MODE) == ACL_MODE_MERGE && flags.Changed(options.TO_FILE) {
+		gplog.Fatal(errors.Errorf("Cannot use --acl-mode merge with --to-file, as merging privileges requires the roles of the restore database"), "")
+	}
+	if flags.Changed(options.TO_FILE_DATA) && !flags.Changed(options.TO_FILE) {
+		gplog.Fatal(errors.Errorf("Cannot use --to-file-data without --to-file"), "")
+	}
+	options.CheckExclusiveFlags(flags, options.TO_FILE_DATA, options.METADATA_ONLY)
+	if flags.Changed(options.TO_FILE_FORMAT) && !flags.Changed(options.TO_FILE) {
+		gplog.Fatal(errors.Errorf("Cannot use --to-file-format without --to-file"), "")
+	}
+	if flags.Changed(options.KEEP_GREENPLUM_SYNTAX) && MustGetFlagString(options.TO_FILE_FORMAT) != TO_FILE_FORMAT_POSTGRES {
+		gplog.Fatal(errors.Errorf("Cannot use --keep-greenplum-syntax without --to-file-format postgres"), "")
+	}
+	for _, flagName := range []string{options.EXTRACT_FORMAT, options.EXTRACT_OUTPUT} {
+		if flags.Changed(flagName) && !flags.Changed(options.EXTRACT_TABLE) {
+			gplog.Fatal(errors.Errorf("Cannot use --%s without --extract-table", flagName), "")
+		}
+	}
+	if flags.Changed(options.EXTRACT_TABLE) && !flags.Changed(options.EXTRACT_OUTPUT) {
+		gplog.Fatal(errors.Errorf("Cannot use --extract-table without --output"), "")
+	}
+	for _, flagName := range []string{options.DRY_RUN, options.TO_FILE, options.LIST_TOC, options.STATUS, options.TOC_EDIT, options.PLUGIN_CONFIG, options.STORAGE, options.METADATA_ONLY,
+		options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE,
+		options.EXCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.INCLUDE_PARTITION, options.RETRY_FAILED, options.PHASE} {
+		options.CheckExclusiveFlags(flags, options.EXTRACT_TABLE, flagName)
+	}
+	if flags.Changed(options.IMPORT_TABLE) != flags.Changed(options.IMPORT_FILE) {
+		gplog.Fatal(errors.Errorf("Cannot use --import-table without --import-file, or --import-file without --import-table"), "")
+	}
+	if flags.Changed(options.IMPORT_HEADER) && !flags.Changed(options.IMPORT_TABLE) {
+		gplog.Fatal(errors.Errorf("Cannot use --import-header without --import-table"), "")
+	}
+	if flags.Changed(options.IMPORT_TABLE) && !flags.Changed(options.REDIRECT_DB) {
+		gplog.Fatal(errors.Errorf("Cannot use --import-table without --redirect-db"), "")
+	}
+	for _, flagName := range []string{options.TIMESTAMP, options.DRY_RUN, options.TO_FILE, options.LIST_TOC, options.STATUS, options.TOC_EDIT, options.EXTRACT_TABLE, options.PLUGIN_CONFIG, options.STORAGE,
+		options.DATA_ONLY, options.METADATA_ONLY, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE, options.EXCLUDE_SCHEMA,
+		options.EXCLUDE_SCHEMA_FILE, options.EXCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.INCLUDE_PARTITION, options.INCREMENTAL, options.RETRY_FAILED, options.PHASE, options.CREATE_DB} {
+		options.CheckExclusiveFlags(flags, options.IMPORT_TABLE, flagName)
+	}
+	for _, flagName := range []string{options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE,
+		options.EXCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.REDIRECT_SCHEMA, options.SCHEMA_PREFIX, options.SCHEMA_SUFFIX, options.ON_CONFLICT, options.TO_FILE} {
+		options.CheckExclusiveFlags(flags, options.INCLUDE_PARTITION, flagName)
+	}
+	if flags.Changed(options.EXCHANGE_PARTITION) && !(flags.Changed(options.INCLUDE_PARTITION) && flags.Changed(options.DATA_ONLY)) {
+		gplog.Fatal(errors.Errorf("Cannot use --exchange-partition without --include-partition and --data-only"), "")
+	}
+	options.CheckExclusiveFlags(flags, options.EXCHANGE_PARTITION, options.INCREMENTAL)
+	options.CheckExclusiveFlags(flags, options.EXCHANGE_PARTITION, options.TRUNCATE_TABLE)
+	options.CheckExclusiveFlags(flags, options.EXCLUDE_OBJECT_TYPE, options.DATA_ONLY)
+	for _, flagName := range []string{options.DATA_ONLY, options.METADATA_ONLY, options.INCREMENTAL, options.ON_CONFLICT, options.RETRY_FAILED,
+		options.DRY_RUN, options.TO_FILE, options.LIST_TOC, options.STATUS, options.ALL_DATABASES, options.INCLUDE_DATABASE} {
+		options.CheckExclusiveFlags(flags, options.PHASE, flagName)
+	}
+	if flags.Changed(options.PHASE) && !utils.Exists(MustGetFlagStringSlice(options.PHASE), PHASE_PREDATA) {
+		for _, flagName := range []string{options.CREATE_DB, options.WITH_GLOBALS, options.RESTORE_GLOBALS} {
+			if flags.Changed(flagName) {
+				gplog.Fatal(errors.Errorf("Cannot use --%s without restoring the %s phase", flagName, PHASE_PREDATA), "")
+			}
+		}
+	}
+	// --status writes the status to stdout, which --machine-output keeps for the summary
+	options.CheckExclusiveFlags(flags, options.MACHINE_OUTPUT, options.STATUS)
+	if utils.Exists(getExcludedObjectTypes(), "TABLE") {
+		gplog.Fatal(errors.Errorf("Cannot exclude tables with --exclude-object-type; use --exclude-table instead"), "")
+	}
+	validateStorageFlags(flags)
+	validateMultiDatabaseFlags(flags)
+	if flags.Changed(options.CONFLICT_SUFFIX) && MustGetFlagString(options.ON_CONFLICT) != CONFLICT_SUFFIX {
+		gplog.Fatal(errors.Errorf("Cannot use --conflict-suffix without --on-conflict suffix"), "")
+	}
+}
+
+func ValidateExtensionVersionsPolicy(policy string) error {
+	if policy != EXTENSION_VERSIONS_PIN && policy != EXTENSION_VERSIONS_UPGRADE {
+		return errors.Errorf("Invalid value '%s' for --extension-versions.  Valid values are 'pin' and 'upgrade'.", policy)
+	}
+	return nil
+}
+
+func ValidateRunAnalyzeMode(mode string) error {
+	if mode != "" && mode != RUN_ANALYZE_ALL && mode != RUN_ANALYZE_ROOTPARTITION {
+		return errors.Errorf("Invalid value '%s' for --run-analyze.  Valid values are 'all' and 'rootpartition'.", mode)
+	}
+	return nil
+}
+
+func ValidateConflictFlagValues(policy string, suffix string) error {
+	if policy != "" && policy != CONFLICT_SKIP && policy != CONFLICT_REPLACE && policy != CONFLICT_SUFFIX {
+		return errors.Errorf("Invalid value '%s' for --on-conflict.  Valid values are 'skip', 'replace', and 'suffix'.", policy)
+	}
+	if policy == CONFLICT_SUFFIX && !regexp.MustCompile(`^[a-z0-9_]+$`).MatchString(suffix) {
+		return errors.Errorf("Invalid conflict suffix '%s'.  The suffix may only contain lowercase letters, digits, and underscores.", suffix)
+	}
+	return nil
 }
@@ -380,6 +380,19 @@ var _ = Describe("restore/validate tests", func() {
 			Entry("truncate combos", "--truncate-table --include-table-file /tmp/file2", true),
 			Entry("truncate combos", "--truncate-table --include-table schema.table2 --redirect-db foodb", true),
 			Entry("truncate combos", "--truncate-table --include-table schema.table2 --redirect-schema schema2", false),
+			Entry("truncate combos", "--truncate-cascade --include-table schema.table2", false),
+			Entry("truncate combos", "--truncate-table --truncate-cascade --include-table schema.table2", true),
+			Entry("--segment-reject-limit combos", "--segment-reject-limit 100 --data-only", true),
+			Entry("--segment-reject-limit combos", "--segment-reject-limit 100 --metadata-only", false),
+			Entry("--segment-reject-limit combos", "--segment-reject-limit 100 --to-file /tmp/restore.sql", false),
+			Entry("--analyze-partition-roots combos", "--analyze-partition-roots --data-only", true),
+			Entry("--analyze-partition-roots combos", "--analyze-partition-roots --metadata-only", false),
+			Entry("--analyze-partition-roots combos", "--analyze-partition-roots --run-analyze=all", false),
+			Entry("--translate-ddl combos", "--translate-ddl --data-only", true),
+			Entry("--translate-ddl combos", "--translate-ddl --to-file /tmp/restore.sql", false),
+			Entry("--refresh-materialized-views combos", "--refresh-materialized-views populated --data-only", true),
+			Entry("--refresh-materialized-views combos", "--refresh-materialized-views all --metadata-only", false),
+			Entry("--refresh-materialized-views combos", "--refresh-materialized-views all --to-file /tmp/restore.sql", false),
 
 			/*
 			 * Below are various different redirect-schema combinations
@@ -395,6 +408,202 @@ var _ = Describe("restore/validate tests", func() {
 			Entry("--redirect-schema combos", "--redirect-schema schema1 --exclude-schema-file /tmp/file2", false),
 			Entry("--redirect-schema combos", "--redirect-schema schema1 --include-table schema.table2 --metadata-only", true),
 			Entry("--redirect-schema combos", "--redirect-schema schema1 --include-table schema.table2 --data-only", true),
+			Entry("--schema-prefix combos", "--schema-prefix staging_", true),
+			Entry("--schema-prefix combos", "--schema-prefix staging_ --schema-suffix _copy", true),
+			Entry("--schema-prefix combos", "--schema-prefix staging_ --redirect-schema schema1 --include-schema schema2", false),
+			Entry("--schema-suffix combos", "--schema-suffix _copy --redirect-schema schema1 --include-schema schema2", false),
+
+			/*
+			 * Below are various different on-conflict combinations
+			 */
+			Entry("--on-conflict combos", "--on-conflict skip", true),
+			Entry("--on-conflict combos", "--on-conflict suffix --conflict-suffix _old", true),
+			Entry("--on-conflict combos", "--on-conflict skip --conflict-suffix _old", false),
+			Entry("--on-conflict combos", "--conflict-suffix _old", false),
+			Entry("--on-conflict combos", "--on-conflict replace --data-only", false),
+			Entry("--on-conflict combos", "--on-conflict replace --incremental", false),
+			Entry("--on-conflict combos", "--on-conflict replace --truncate-table", false),
+
+			/*
+			 * Below are various different --acl-mode combinations
+			 */
+			Entry("--acl-mode combos", "--acl-mode merge", true),
+			Entry("--acl-mode combos", "--acl-mode skip --to-file /tmp/restore.sql", true),
+			Entry("--acl-mode combos", "--acl-mode merge --to-file /tmp/restore.sql", false),
+
+			/*
+			 * Below are various different jobs-min and jobs-max combinations
+			 */
+			Entry("--jobs-min/--jobs-max combos", "--jobs-min 2 --jobs-max 8", true),
+			Entry("--jobs-min/--jobs-max combos", "--jobs-min 4 --jobs-max 4", true),
+			Entry("--jobs-min/--jobs-max combos", "--jobs-min 8 --jobs-max 2", false),
+			Entry("--jobs-min/--jobs-max combos", "--jobs-min 0 --jobs-max 2", false),
+			Entry("--jobs-min/--jobs-max combos", "--jobs-max 8", false),
+			Entry("--jobs-min/--jobs-max combos", "--jobs 4 --jobs-min 2 --jobs-max 8", false),
+			Entry("--jobs-min/--jobs-max combos", "--jobs auto --jobs-min 2 --jobs-max 8", false),
+
+			/*
+			 * Below are various different verify-table-definitions combinations
+			 */
+			Entry("--verify-table-definitions combos", "--verify-table-definitions", false),
+			Entry("--verify-table-definitions combos", "--verify-table-definitions --data-only", true),
+			Entry("--exact-sequence-values combos", "--exact-sequence-values", false),
+			Entry("--exact-sequence-values combos", "--exact-sequence-values --data-only", true),
+			Entry("--exact-sequence-values combos", "--exact-sequence-values --data-only --incremental", true),
+
+			/*
+			 * Below are various different retry-failed combinations
+			 */
+			Entry("--retry-failed combos", "--retry-failed /tmp/failed_objects.json", true),
+			Entry("--retry-failed combos", "--retry-failed /tmp/failed_objects.json --include-schema schema1 --on-error-continue", true),
+			Entry("--retry-failed combos", "--retry-failed /tmp/failed_objects.json --create-db", false),
+			Entry("--retry-failed combos", "--retry-failed /tmp/failed_objects.json --with-globals", false),
+			Entry("--retry-failed combos", "--retry-failed /tmp/failed_objects.json --incremental --data-only", false),
+			Entry("--retry-failed combos", "--retry-failed /tmp/failed_objects.json --on-conflict skip", false),
+
+			Entry("multi-database combos", "--all-databases --include-database sales", false),
+			Entry("multi-database combos", "--all-databases --redirect-db testdb", false),
+			Entry("multi-database combos", "--include-database sales --include-table public.foo", false),
+			Entry("multi-database combos", "--include-database sales --include-database hr --include-schema public", true),
+
+			Entry("--restore-globals combos", "--restore-globals --with-globals", false),
+			Entry("--restore-globals combos", "--restore-globals --data-only", false),
+			Entry("--restore-globals combos", "--restore-globals --retry-failed /tmp/failed_objects.json", false),
+			Entry("--restore-globals combos", "--restore-globals --create-db", true),
+			Entry("--restore-globals combos", "--restore-globals --metadata-only", true),
+
+			Entry("--create-db-with-options combos", "--create-db --create-db-with-options", true),
+			Entry("--create-db-with-options combos", "--create-db-with-options", false),
+
+			Entry("--dry-run combos", "--dry-run", true),
+			Entry("--dry-run combos", "--dry-run --include-schema schema1 --redirect-schema schema2", true),
+			Entry("--dry-run combos", "--dry-run --on-conflict skip", false),
+			Entry("--dry-run combos", "--dry-run --all-databases", false),
+			Entry("--status combos", "--status", true),
+			Entry("--status combos", "--status --dry-run", false),
+			Entry("--status combos", "--status --to-file /tmp/restore.sql", false),
+			Entry("--machine-output combos", "--machine-output --quiet", true),
+			Entry("--machine-output combos", "--machine-output --status", false),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql", true),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql --to-file-data --create-db --redirect-db newdb", true),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql --dry-run", false),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql --on-conflict skip", false),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql --statement-timeout-postdata 600", false),
+			Entry("--statement-timeout combos", "--statement-timeout-predata 60 --statement-timeout-postdata 600 --jobs 4", true),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql --plugin-config /tmp/plugin.yaml", false),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql --all-databases", false),
+			Entry("--to-file combos", "--to-file-data", false),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql --to-file-data --metadata-only", false),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql --to-file-format postgres --keep-greenplum-syntax distributed-by", true),
+			Entry("--to-file combos", "--to-file-format postgres", false),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql --keep-greenplum-syntax distributed-by", false),
+			Entry("--extract-table combos", "--extract-table public.foo --output /tmp/extract", true),
+			Entry("--extract-table combos", "--extract-table public.foo --format parquet --output /tmp/extract --backup-dir /tmp", true),
+			Entry("--extract-table combos", "--extract-table public.foo", false),
+			Entry("--extract-table combos", "--format parquet", false),
+			Entry("--extract-table combos", "--output /tmp/extract", false),
+			Entry("--extract-table combos", "--extract-table public.foo --output /tmp/extract --to-file /tmp/restore.sql", false),
+			Entry("--extract-table combos", "--extract-table public.foo --output /tmp/extract --include-table public.bar", false),
+			Entry("--extract-table combos", "--extract-table public.foo --output /tmp/extract --plugin-config /tmp/plugin.yaml", false),
+			Entry("--import-table combos", "--import-table public.foo --import-file /tmp/foo.csv --redirect-db foodb", true),
+			Entry("--import-table combos", "--import-table public.foo --import-file /tmp/foo.csv --import-file /tmp/foo2.csv --import-header --truncate-table --redirect-db foodb", true),
+			Entry("--import-table combos", "--import-table public.foo --redirect-db foodb", false),
+			Entry("--import-table combos", "--import-file /tmp/foo.csv --redirect-db foodb", false),
+			Entry("--import-table combos", "--import-header --redirect-db foodb", false),
+			Entry("--import-table combos", "--import-table public.foo --import-file /tmp/foo.csv", false),
+			Entry("--import-table combos", "--import-table public.foo --import-file /tmp/foo.csv --redirect-db foodb --timestamp 20170101010101", false),
+			Entry("--import-table combos", "--import-table public.foo --import-file /tmp/foo.csv --redirect-db foodb --include-table public.bar", false),
+			Entry("--import-table combos", "--import-table public.foo --import-file /tmp/foo.csv --redirect-db foodb --extract-table public.foo --output /tmp/extract", false),
+			Entry("--to-file combos", "--to-file /tmp/restore.sql --create-db --skip-unknown-gucs", false),
+			Entry("--list-toc combos", "--list-toc /tmp/toc_list", true),
+			Entry("--list-toc combos", "--list-toc /tmp/toc_list --toc-edit /tmp/toc_list", false),
+			Entry("--list-toc combos", "--list-toc /tmp/toc_list --to-file /tmp/restore.sql", false),
+			Entry("--list-toc combos", "--list-toc /tmp/toc_list --dry-run", false),
+			Entry("--toc-edit combos", "--toc-edit /tmp/toc_list --to-file /tmp/restore.sql", true),
+
+			Entry("--include-partition combos", "--include-partition public.foo_1_prt_1 --include-table public.bar", true),
+			Entry("--include-partition combos", "--include-partition public.foo_1_prt_1 --include-schema public", false),
+			Entry("--include-partition combos", "--include-partition public.foo_1_prt_1 --exclude-table public.bar", false),
+			Entry("--include-partition combos", "--include-partition public.foo_1_prt_1 --redirect-schema other --include-table public.bar", false),
+			Entry("--include-partition combos", "--include-partition public.foo_1_prt_1 --on-conflict skip", false),
+			Entry("--exchange-partition combos", "--exchange-partition --include-partition public.foo_1_prt_1 --data-only", true),
+			Entry("--exchange-partition combos", "--exchange-partition --include-partition public.foo_1_prt_1", false),
+			Entry("--exchange-partition combos", "--exchange-partition --data-only", false),
+			Entry("--exchange-partition combos", "--exchange-partition --include-partition public.foo_1_prt_1 --data-only --truncate-table", false),
+
+			Entry("--exclude-object-type combos", "--exclude-object-type INDEX,TRIGGER,RULE", true),
+			Entry("--exclude-object-type combos", "--exclude-object-type index --exclude-object-type trigger", true),
+			Entry("--exclude-object-type combos", "--exclude-object-type INDEX --data-only", false),
+			Entry("--exclude-object-type combos", "--exclude-object-type INDEX,table", false),
+
+			Entry("--phase combos", "--phase predata,data", true),
+			Entry("--phase combos", "--phase predata --create-db", true),
+			Entry("--phase combos", "--phase postdata --create-db", false),
+			Entry("--phase combos", "--phase data --data-only", false),
+			Entry("--phase combos", "--phase predata --on-conflict skip", false),
+
+			Entry("--run-analyze combos", "--run-analyze --with-stats", true),
+			Entry("--run-analyze combos", "--run-analyze=rootpartition --jobs 4", true),
+
+			Entry("--storage combos", "--storage s3 --s3-bucket bucket --s3-folder gpdb", true),
+			Entry("--storage combos", "--s3-bucket bucket", false),
+			Entry("--storage combos", "--storage s3 --s3-bucket bucket --plugin-config /tmp/plugin.yaml", false),
 		)
 	})
+	Describe("FindMissingRestorePlanBackups", func() {
+		restorePlan := []history.RestorePlanEntry{
+			{Timestamp: "20170101010101", TableFQNs: []string{"public.heap"}},
+			{Timestamp: "20170102010101", TableFQNs: []string{"public.ao1"}},
+			{Timestamp: "20170103010101", TableFQNs: []string{"public.ao2"}},
+		}
+		It("returns no backups when every backup in the restore plan is present", func() {
+			missing := restore.FindMissingRestorePlanBackups(restorePlan, func(string) bool { return true })
+			Expect(missing).To(BeEmpty())
+		})
+		It("returns the backups in the restore plan that are not present", func() {
+			present := map[string]bool{"20170102010101": true}
+			missing := restore.FindMissingRestorePlanBackups(restorePlan, func(timestamp string) bool { return present[timestamp] })
+			Expect(missing).To(Equal([]string{"20170101010101", "20170103010101"}))
+		})
+	})
+	Describe("ValidateRunAnalyzeMode", func() {
+		It("passes for each valid mode", func() {
+			for _, mode := range []string{"", "all", "rootpartition"} {
+				Expect(restore.ValidateRunAnalyzeMode(mode)).To(Succeed())
+			}
+		})
+		It("returns an error for an invalid mode", func() {
+			err := restore.ValidateRunAnalyzeMode("leaves")
+			Expect(err).To(MatchError("Invalid value 'leaves' for --run-analyze.  Valid values are 'all' and 'rootpartition'."))
+		})
+	})
+	Describe("ValidateExtensionVersionsPolicy", func() {
+		It("passes for each valid policy", func() {
+			for _, policy := range []string{"pin", "upgrade"} {
+				Expect(restore.ValidateExtensionVersionsPolicy(policy)).To(Succeed())
+			}
+		})
+		It("returns an error for an invalid policy", func() {
+			err := restore.ValidateExtensionVersionsPolicy("latest")
+			Expect(err).To(MatchError("Invalid value 'latest' for --extension-versions.  Valid values are 'pin' and 'upgrade'."))
+		})
+	})
+	Describe("ValidateConflictFlagValues", func() {
+		It("passes when --on-conflict is not specified", func() {
+			Expect(restore.ValidateConflictFlagValues("", "_restored")).To(Succeed())
+		})
+		It("passes for each valid policy", func() {
+			for _, policy := range []string{"skip", "replace", "suffix"} {
+				Expect(restore.ValidateConflictFlagValues(policy, "_restored")).To(Succeed())
+			}
+		})
+		It("returns an error for an invalid policy", func() {
+			err := restore.ValidateConflictFlagValues("rename", "_restored")
+			Expect(err).To(MatchError("Invalid value 'rename' for --on-conflict.  Valid values are 'skip', 'replace', and 'suffix'."))
+		})
+		It("returns an error for a suffix containing characters other than lowercase letters, digits, and underscores", func() {
+			err := restore.ValidateConflictFlagValues("suffix", "-Old")
+			Expect(err).To(MatchError("Invalid conflict suffix '-Old'.  The suffix may only contain lowercase letters, digits, and underscores."))
+		})
+	})
 })
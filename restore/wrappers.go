@@ -15,6 +15,7 @@ import (
 	"github.com/greenplum-db/gpbackup/report"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 )
 
 /*
@@ -63,10 +64,31 @@ func SetLoggerVerbosity() {
 
 func CreateConnectionPool(unquotedDBName string) {
 	connectionPool = dbconn.NewDBConnFromEnvironment(unquotedDBName)
-	connectionPool.MustConnect(MustGetFlagInt(options.JOBS))
+	connectionPool.MustConnect(GetNumJobs())
 	utils.ValidateGPDBVersionCompatibility(connectionPool)
 }
 
+/*
+ * With --jobs auto, the number of jobs is picked from the cluster the first
+ * time it is needed and reused for later connection pools.  Backups with a
+ * single data file per segment are always restored with one job.
+ */
+func GetNumJobs() int {
+	if cmdFlags.Changed(options.JOBS_MAX) {
+		return MustGetFlagInt(options.JOBS_MAX)
+	}
+	if MustGetFlagString(options.JOBS) != utils.JobsAuto {
+		return utils.GetNumJobs(MustGetFlagString(options.JOBS), "postgres")
+	}
+	if backupConfig != nil && backupConfig.SingleDataFile {
+		return 1
+	}
+	if autoJobs == 0 {
+		autoJobs = utils.GetNumJobs(utils.JobsAuto, "postgres")
+	}
+	return autoJobs
+}
+
 func InitializeConnectionPool(backupTimestamp string, restoreTimestamp string, unquotedDBName string) {
 	CreateConnectionPool(unquotedDBName)
 	setupQuery := fmt.Sprintf("SET application_name TO 'gprestore_%s_%s';", backupTimestamp, restoreTimestamp)
@@ -106,6 +128,10 @@ SET default_with_oids = off;
 		}
 	}
 	setupQuery += SetMaxCsvLineLengthQuery(connectionPool)
+	if isResizeRestore() {
+		// Rows are loaded on the segment that reads them and redistributed afterwards
+		setupQuery += "SET gp_enable_segment_copy_checking = off;\n"
+	}
 
 	// Always disable gp_autostats_mode to prevent automatic ANALYZE
 	// during COPY FROM SEGMENT. ANALYZE should be run separately.
@@ -134,19 +160,60 @@ func SetMaxCsvLineLengthQuery(connectionPool *dbconn.DBConn) string {
 }
 
 func InitializeBackupConfig() {
+	readBackupConfig()
+	report.EnsureDatabaseVersionCompatibility(backupConfig.DatabaseVersion, connectionPool.Version, MustGetFlagBool(options.TRANSLATE_DDL))
+}
+
+func readBackupConfig() {
 	backupConfig = history.ReadConfigFile(globalFPInfo.GetConfigFilePath())
+	if backupConfig.UnchangedSince != "" {
+		gplog.Fatal(errors.Errorf("Backup %s recorded no changes since backup %s and has no files of its own. Restore backup %s instead.",
+			backupConfig.Timestamp, backupConfig.UnchangedSince, backupConfig.UnchangedSince), "")
+	}
 	utils.InitializePipeThroughParameters(backupConfig.Compressed, backupConfig.CompressionType, 0)
-	report.EnsureBackupVersionCompatibility(backupConfig.BackupVersion, version)
-	report.EnsureDatabaseVersionCompatibility(backupConfig.DatabaseVersion, connectionPool.Version)
+	report.EnsureBackupVersionCompatibility(backupConfig.BackupVersion, version, backupConfig.FormatVersion)
 }
 
 func BackupConfigurationValidation() {
+	ValidateResizeRestore()
 	if !backupConfig.MetadataOnly {
 		gplog.Verbose("Gathering information on backup directories")
 		VerifyBackupDirectoriesExistOnAllHosts()
 	}
+	validateBackupMetadata()
+	if isResizeRestore() && !backupConfig.MetadataOnly && !MustGetFlagBool(options.METADATA_ONLY) {
+		VerifyResizeBackupFileCountOnSegments(getBackupFileCount())
+	}
+}
 
-	VerifyMetadataFilePaths(MustGetFlagBool(options.WITH_STATS))
+/*
+ * Returns the number of files in the backup directory of each segment.
+ */
+func getBackupFileCount() int {
+	backupFileCount := 2 // 1 for the actual data file, 1 for the segment TOC file
+	if !backupConfig.SingleDataFile {
+		backupFileCount = len(globalTOC.DataEntries)
+	}
+	if backupConfig.Dedup && len(globalTOC.DataEntries) > 0 {
+		backupFileCount++ // 1 for the chunk index file
+	}
+	return backupFileCount
+}
+
+/*
+ * With --run-analyze, a backup without statistics is analyzed instead of
+ * failing the restore for its missing statistics file.
+ */
+func isStatisticsFileNeeded() bool {
+	return MustGetFlagBool(options.WITH_STATS) && (backupConfig.WithStatistics || MustGetFlagString(options.RUN_ANALYZE) == "")
+}
+
+/*
+ * Reads the TOC of the backup and validates the restore flags against it,
+ * which needs only the metadata files on the master.
+ */
+func validateBackupMetadata() {
+	VerifyMetadataFilePaths(isStatisticsFileNeeded())
 
 	tocFilename := globalFPInfo.GetTOCFilePath()
 	globalTOC = toc.NewTOC(tocFilename)
@@ -158,8 +225,13 @@ func BackupConfigurationValidation() {
 	}
 
 	ValidateBackupFlagCombinations()
+	validateRestorePlan()
 
 	validateFilterListsInBackupSet()
+
+	if tocEditFile := MustGetFlagString(options.TOC_EDIT); tocEditFile != "" {
+		applyTOCEdit(tocEditFile)
+	}
 }
 
 func SetRestorePlanForLegacyBackup(toc *toc.TOC, backupTimestamp string, backupConfig *history.BackupConfig) {
@@ -194,14 +266,20 @@ func RecoverMetadataFilesUsingPlugin() {
 
 	metadataFiles := []string{globalFPInfo.GetConfigFilePath(), globalFPInfo.GetMetadataFilePath(),
 		globalFPInfo.GetBackupReportFilePath()}
-	if MustGetFlagBool(options.WITH_STATS) {
-		metadataFiles = append(metadataFiles, globalFPInfo.GetStatisticsFilePath())
-	}
 	for _, filename := range metadataFiles {
 		pluginConfig.MustRestoreFile(filename)
 	}
 
 	InitializeBackupConfig()
+	if isStatisticsFileNeeded() {
+		pluginConfig.MustRestoreFile(globalFPInfo.GetStatisticsFilePath())
+	}
+	if backupConfig.GlobalsFile && (MustGetFlagBool(options.RESTORE_GLOBALS) || MustGetFlagBool(options.WITH_GLOBALS)) {
+		pluginConfig.MustRestoreFile(globalFPInfo.GetGlobalsFilePath())
+	}
+	if backupConfig.CredentialsFile && MustGetFlagString(options.CREDENTIALS_KEY_FILE) != "" {
+		pluginConfig.MustRestoreFile(globalFPInfo.GetCredentialsFilePath())
+	}
 
 	var fpInfoList []filepath.FilePathInfo
 	if backupConfig.MetadataOnly {
@@ -236,6 +314,24 @@ func FindHistoricalPluginVersion(timestamp string) string {
 	return historicalPluginVersion
 }
 
+/*
+ * A backup taken with --skip-if-unchanged that found no changes is restored
+ * from the backup it is unchanged since.  Returns the timestamp of that
+ * backup, or an empty string if the given backup has files of its own.
+ */
+func FindUnchangedSinceTimestamp(timestamp string) string {
+	if !iohelper.FileExistsAndIsReadable(globalFPInfo.GetBackupHistoryFilePath()) {
+		return ""
+	}
+	hist, err := history.NewHistory(globalFPInfo.GetBackupHistoryFilePath())
+	gplog.FatalOnError(err)
+	foundBackupConfig := hist.FindBackupConfig(timestamp)
+	if foundBackupConfig == nil {
+		return ""
+	}
+	return foundBackupConfig.UnchangedSince
+}
+
 /*
  * Metadata and/or data restore wrapper functions
  */
@@ -334,6 +430,7 @@ func RestoreSchemas(schemaStatements []toc.StatementWithType, progressBar utils.
 				errMsg := fmt.Sprintf("Error encountered while creating schema %s", schema.Name)
 				if MustGetFlagBool(options.ON_ERROR_CONTINUE) {
 					gplog.Verbose(fmt.Sprintf("%s: %s", errMsg, err.Error()))
+					recordFailedObject(FailedObject{ObjectType: schema.ObjectType, Schema: schema.Schema, Name: schema.Name, Error: err.Error(), Statement: strings.TrimSpace(schema.Statement)})
 					numErrors++
 				} else {
 					gplog.Fatal(err, errMsg)
@@ -377,9 +474,3 @@ func GetExistingSchemas() ([]string, error) {
 	err := connectionPool.Select(&existingSchemas, query)
 	return existingSchemas, err
 }
-
-func TruncateTable(tableFQN string, whichConn int) error {
-	gplog.Verbose("Truncating table %s prior to restoring data", tableFQN)
-	_, err := connectionPool.Exec(`TRUNCATE `+tableFQN, whichConn)
-	return err
-}
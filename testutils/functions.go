@@ -236,6 +236,7 @@ var objNameToClassID = map[string]uint32{
 	"OPERATOR CLASS":            2616,
 	"OPERATOR FAMILY":           2753,
 	"OPERATOR":                  2617,
+	"POLICY":                    3256,
 	"PROTOCOL":                  7175,
 	"RESOURCE GROUP":            6436,
 	"RESOURCE QUEUE":            6026,
@@ -0,0 +1,146 @@
+package toc
+
+/*
+ * This file contains structs and functions for the TOC progress file, to
+ * which each TOC entry is appended as it is added during a backup, so that a
+ * backup that crashes before writing its TOC leaves a record of how far it
+ * got for --resume and for anyone investigating the failure.
+ */
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+// The number of entries appended between each sync of the progress file
+const ProgressBatchSize = 100
+
+/*
+ * Each line of the progress file holds one entry as JSON, with the section
+ * to which it was added.  Data entries have the section "data".
+ */
+type ProgressEntry struct {
+	Section  string
+	Metadata *MetadataEntry   `json:",omitempty"`
+	Data     *MasterDataEntry `json:",omitempty"`
+}
+
+func (entry ProgressEntry) Description() string {
+	if entry.Data != nil {
+		return fmt.Sprintf("data entry for table %s", utils.MakeFQN(entry.Data.Schema, entry.Data.Name))
+	} else if entry.Metadata != nil {
+		name := entry.Metadata.Name
+		if entry.Metadata.Schema != "" {
+			name = utils.MakeFQN(entry.Metadata.Schema, entry.Metadata.Name)
+		}
+		return fmt.Sprintf("%s entry for %s %s", entry.Section, entry.Metadata.ObjectType, name)
+	}
+	return fmt.Sprintf("%s entry", entry.Section)
+}
+
+type ProgressFile struct {
+	file      *os.File
+	writer    *bufio.Writer
+	batchSize int
+	pending   int
+	mutex     sync.Mutex
+}
+
+func NewProgressFile(filename string, batchSize int) (*ProgressFile, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &ProgressFile{file: file, writer: bufio.NewWriter(file), batchSize: batchSize}, nil
+}
+
+func (progressFile *ProgressFile) Append(entry ProgressEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	progressFile.mutex.Lock()
+	defer progressFile.mutex.Unlock()
+	_, err = progressFile.writer.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	progressFile.pending++
+	if progressFile.pending >= progressFile.batchSize {
+		return progressFile.sync()
+	}
+	return nil
+}
+
+func (progressFile *ProgressFile) Sync() error {
+	progressFile.mutex.Lock()
+	defer progressFile.mutex.Unlock()
+	return progressFile.sync()
+}
+
+func (progressFile *ProgressFile) sync() error {
+	progressFile.pending = 0
+	err := progressFile.writer.Flush()
+	if err != nil {
+		return err
+	}
+	return progressFile.file.Sync()
+}
+
+func (progressFile *ProgressFile) Close() error {
+	err := progressFile.Sync()
+	closeErr := progressFile.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+/*
+ * A crash can leave the last line of the file incomplete, so a last line
+ * that cannot be parsed is ignored.
+ */
+func ReadProgressFile(filename string) ([]ProgressEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]ProgressEntry, 0)
+	reader := bufio.NewReader(file)
+	for lineNum := 1; ; lineNum++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && len(line) == 0 {
+			break
+		}
+		var entry ProgressEntry
+		err = json.Unmarshal(line, &entry)
+		if err != nil {
+			if readErr != nil {
+				// The incomplete last line
+				break
+			}
+			return nil, errors.Errorf("Invalid entry on line %d of TOC progress file %s", lineNum, filename)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+/*
+ * Returns the number of entries in each section of the progress file.
+ */
+func CountProgressEntries(entries []ProgressEntry) map[string]int {
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		counts[entry.Section]++
+	}
+	return counts
+}
@@ -0,0 +1,75 @@
+package toc_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("toc/progress tests", func() {
+	var progressFilename string
+	BeforeEach(func() {
+		file, err := ioutil.TempFile("/tmp", "gpbackup_test_toc_progress*")
+		Expect(err).To(Not(HaveOccurred()))
+		_ = file.Close()
+		progressFilename = file.Name()
+	})
+	AfterEach(func() {
+		_ = os.Remove(progressFilename)
+	})
+	It("records the entries added to a TOC as they are added", func() {
+		progressFile, err := toc.NewProgressFile(progressFilename, 1)
+		Expect(err).To(Not(HaveOccurred()))
+		tocfile := &toc.TOC{}
+		tocfile.InitializeMetadataEntryMap()
+		tocfile.SetProgressFile(progressFile)
+		tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "public", Name: "foo", ObjectType: "TABLE"}, 0, 25)
+		tocfile.AddDataEntry(toc.MasterDataEntry{Schema: "public", Name: "foo", Oid: 16384, RowsCopied: 10, Streams: 2})
+
+		// The entries are synced after each batch, so they can be read before the file is closed
+		entries, err := toc.ReadProgressFile(progressFilename)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(entries).To(Equal([]toc.ProgressEntry{
+			{Section: "predata", Metadata: &toc.MetadataEntry{Schema: "public", Name: "foo", ObjectType: "TABLE", StartByte: 0, EndByte: 25}},
+			{Section: "data", Data: &toc.MasterDataEntry{Schema: "public", Name: "foo", Oid: 16384, RowsCopied: 10, Streams: 2}},
+		}))
+		Expect(toc.CountProgressEntries(entries)).To(Equal(map[string]int{"predata": 1, "data": 1}))
+		tocfile.CloseProgressFile()
+	})
+	It("holds entries back until a batch is complete or the file is synced", func() {
+		progressFile, err := toc.NewProgressFile(progressFilename, 2)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(progressFile.Append(toc.ProgressEntry{Section: "global", Metadata: &toc.MetadataEntry{Name: "foo", ObjectType: "ROLE"}})).To(Succeed())
+
+		entries, err := toc.ReadProgressFile(progressFilename)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(entries).To(BeEmpty())
+
+		Expect(progressFile.Close()).To(Succeed())
+		entries, err = toc.ReadProgressFile(progressFilename)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(entries).To(HaveLen(1))
+	})
+	It("ignores an incomplete last line left by a crash", func() {
+		contents := `{"Section":"predata","Metadata":{"Schema":"public","Name":"foo","ObjectType":"TABLE","ReferenceObject":"","StartByte":0,"EndByte":25}}
+{"Section":"predata","Metadata":{"Schema":"pub`
+		Expect(ioutil.WriteFile(progressFilename, []byte(contents), 0644)).To(Succeed())
+
+		entries, err := toc.ReadProgressFile(progressFilename)
+
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Description()).To(Equal("predata entry for TABLE public.foo"))
+	})
+	It("returns an error for an invalid line before the last", func() {
+		Expect(ioutil.WriteFile(progressFilename, []byte("not an entry\n{\"Section\":\"data\"}\n"), 0644)).To(Succeed())
+
+		_, err := toc.ReadProgressFile(progressFilename)
+
+		Expect(err).To(MatchError("Invalid entry on line 1 of TOC progress file " + progressFilename))
+	})
+})
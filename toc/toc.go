@@ -7,22 +7,37 @@ import (
 	"regexp"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/utils"
 	"gopkg.in/yaml.v2"
 )
 
+/*
+ * ClusterEntries are the entries for cluster-level global objects in a
+ * separate globals file, which are only written there with --with-globals;
+ * otherwise those objects are in GlobalEntries with the rest of the global
+ * metadata.  DataExcludedEntries are the tables whose metadata is backed up
+ * but whose data was excluded with --exclude-table-data, so they have no
+ * data files.
+ */
 type TOC struct {
 	metadataEntryMap    map[string]*[]MetadataEntry
+	progressFile        *ProgressFile
+	FormatVersion       int `yaml:",omitempty"`
 	GlobalEntries       []MetadataEntry
+	ClusterEntries      []MetadataEntry `yaml:",omitempty"`
 	PredataEntries      []MetadataEntry
 	PostdataEntries     []MetadataEntry
 	StatisticsEntries   []MetadataEntry
 	DataEntries         []MasterDataEntry
+	DataExcludedEntries []MasterDataEntry `yaml:",omitempty"`
+	SequenceValues      []SequenceValue   `yaml:",omitempty"`
 	IncrementalMetadata IncrementalEntries
 }
 
 type SegmentTOC struct {
-	DataEntries map[uint]SegmentDataEntry
+	FormatVersion int `yaml:",omitempty"`
+	DataEntries   map[uint]SegmentDataEntry
 }
 
 type MetadataEntry struct {
@@ -41,15 +56,33 @@ type MasterDataEntry struct {
 	AttributeString string
 	RowsCopied      int64
 	PartitionRoot   string
+	Uncompressed    bool   `yaml:",omitempty"`
+	Size            int64  `yaml:",omitempty"`
+	Streams         int    `yaml:",omitempty"`
+	DataFile        string `yaml:",omitempty"`
+}
+
+/*
+ * The value of a sequence once the data of the backup was copied, which
+ * matches the data of the tables that use the sequence more closely than the
+ * value written to the metadata file before the data was copied.
+ */
+type SequenceValue struct {
+	Schema   string
+	Name     string
+	LastVal  int64
+	IsCalled bool
 }
 
 type SegmentDataEntry struct {
 	StartByte uint64
 	EndByte   uint64
+	Checksum  string `yaml:",omitempty"`
 }
 
 type IncrementalEntries struct {
-	AO map[string]AOEntry
+	AO   map[string]AOEntry
+	Heap map[string]HeapEntry `yaml:",omitempty"`
 }
 
 type AOEntry struct {
@@ -57,25 +90,96 @@ type AOEntry struct {
 	LastDDLTimestamp string
 }
 
+/*
+ * The Modcount of a heap table is the sum over all segments of the tuples
+ * inserted, updated, and deleted as counted by the statistics collector.  The
+ * relfilenode is tracked as well, as TRUNCATE does not affect those counts.
+ */
+type HeapEntry struct {
+	Modcount         int64
+	RelFileNode      uint32
+	LastDDLTimestamp string
+}
+
+/*
+ * The shims that translate the TOC and segment TOC files of each older format
+ * version into the next one, applied in turn when the files are read.  Fields
+ * that are unknown to this version, as written by a later gpbackup in a
+ * compatible format, are ignored.  Format 1 TOCs differ from format 2 only in
+ * not recording their format, so they need no shim.
+ */
+var (
+	tocFormatShims        = map[int]func(toc *TOC){}
+	segmentTOCFormatShims = map[int]func(toc *SegmentTOC){}
+)
+
+func getFormatVersion(formatVersion int) int {
+	if formatVersion == 0 {
+		return history.UNVERSIONED_FORMAT_VERSION
+	}
+	return formatVersion
+}
+
+func (toc *TOC) translateFormat() {
+	for formatVersion := getFormatVersion(toc.FormatVersion); formatVersion < history.CURRENT_FORMAT_VERSION; formatVersion++ {
+		if shim, ok := tocFormatShims[formatVersion]; ok {
+			shim(toc)
+		}
+	}
+}
+
+func (toc *SegmentTOC) translateFormat() {
+	for formatVersion := getFormatVersion(toc.FormatVersion); formatVersion < history.CURRENT_FORMAT_VERSION; formatVersion++ {
+		if shim, ok := segmentTOCFormatShims[formatVersion]; ok {
+			shim(toc)
+		}
+	}
+}
+
 func NewTOC(filename string) *TOC {
 	toc := &TOC{}
 	contents, err := ioutil.ReadFile(filename)
 	gplog.FatalOnError(err)
 	err = yaml.Unmarshal(contents, toc)
 	gplog.FatalOnError(err)
+	toc.translateFormat()
 	return toc
 }
 
 func NewSegmentTOC(filename string) *SegmentTOC {
-	toc := &SegmentTOC{}
 	contents, err := ioutil.ReadFile(filename)
 	gplog.FatalOnError(err)
-	err = yaml.Unmarshal(contents, toc)
+	toc, err := ParseSegmentTOC(contents)
 	gplog.FatalOnError(err)
 	return toc
 }
 
+func ParseSegmentTOC(contents []byte) (*SegmentTOC, error) {
+	toc := &SegmentTOC{}
+	err := yaml.Unmarshal(contents, toc)
+	if err != nil {
+		return nil, err
+	}
+	toc.translateFormat()
+	return toc, nil
+}
+
+/*
+ * Returns the size of the uncompressed data in the single data file of the
+ * segment, which ends with the data of the last table.
+ */
+func (toc *SegmentTOC) DataSize() uint64 {
+	var dataSize uint64
+	for _, entry := range toc.DataEntries {
+		if entry.EndByte > dataSize {
+			dataSize = entry.EndByte
+		}
+	}
+	return dataSize
+}
+
 func (toc *TOC) WriteToFileAndMakeReadOnly(filename string) {
+	toc.FormatVersion = history.CURRENT_FORMAT_VERSION
 	contents, err := yaml.Marshal(toc)
 	gplog.FatalOnError(err)
 	err = utils.WriteToFileAndMakeReadOnly(filename, contents)
@@ -83,6 +187,7 @@ func (toc *TOC) WriteToFileAndMakeReadOnly(filename string) {
 }
 
 func (toc *SegmentTOC) WriteToFileAndMakeReadOnly(filename string) error {
+	toc.FormatVersion = history.CURRENT_FORMAT_VERSION
 	contents, err := yaml.Marshal(toc)
 	if err != nil {
 		return err
@@ -98,6 +203,20 @@ type StatementWithType struct {
 	Statement       string
 }
 
+/*
+ * Returns the data file of each table that has one in the directory layout,
+ * by oid.  Tables backed up in the oid layout have no entry.
+ */
+func GetDataFiles(dataEntries []MasterDataEntry) map[uint32]string {
+	dataFiles := make(map[uint32]string)
+	for _, entry := range dataEntries {
+		if entry.DataFile != "" {
+			dataFiles[entry.Oid] = entry.DataFile
+		}
+	}
+	return dataFiles
+}
+
 func GetIncludedPartitionRoots(tocDataEntries []MasterDataEntry, includeRelations []string) []string {
 	if len(includeRelations) == 0 {
 		return []string{}
@@ -121,19 +240,39 @@ func GetIncludedPartitionRoots(tocDataEntries []MasterDataEntry, includeRelation
 }
 
 func (toc *TOC) GetSQLStatementForObjectTypes(section string, metadataFile io.ReaderAt, includeObjectTypes []string, excludeObjectTypes []string, includeSchemas []string, excludeSchemas []string, includeRelations []string, excludeRelations []string) []StatementWithType {
-	entries := *toc.metadataEntryMap[section]
+	entries := toc.GetMetadataEntriesMatching(section, includeObjectTypes, excludeObjectTypes, includeSchemas, excludeSchemas, includeRelations, excludeRelations)
 
-	objectSet, schemaSet, relationSet := constructFilterSets(includeObjectTypes, excludeObjectTypes, includeSchemas, excludeSchemas, includeRelations, excludeRelations)
 	statements := make([]StatementWithType, 0)
 	for _, entry := range entries {
+		contents := make([]byte, entry.EndByte-entry.StartByte)
+		_, err := metadataFile.ReadAt(contents, int64(entry.StartByte))
+		gplog.FatalOnError(err)
+		statements = append(statements, StatementWithType{Schema: entry.Schema, Name: entry.Name, ObjectType: entry.ObjectType, ReferenceObject: entry.ReferenceObject, Statement: string(contents)})
+	}
+	return statements
+}
+
+func (toc *TOC) GetMetadataEntriesMatching(section string, includeObjectTypes []string, excludeObjectTypes []string, includeSchemas []string, excludeSchemas []string, includeRelations []string, excludeRelations []string) []MetadataEntry {
+	objectSet, schemaSet, relationSet := constructFilterSets(includeObjectTypes, excludeObjectTypes, includeSchemas, excludeSchemas, includeRelations, excludeRelations)
+	matchingEntries := make([]MetadataEntry, 0)
+	for _, entry := range *toc.metadataEntryMap[section] {
 		if shouldIncludeStatement(entry, objectSet, schemaSet, relationSet) {
-			contents := make([]byte, entry.EndByte-entry.StartByte)
-			_, err := metadataFile.ReadAt(contents, int64(entry.StartByte))
-			gplog.FatalOnError(err)
-			statements = append(statements, StatementWithType{Schema: entry.Schema, Name: entry.Name, ObjectType: entry.ObjectType, ReferenceObject: entry.ReferenceObject, Statement: string(contents)})
+			matchingEntries = append(matchingEntries, entry)
 		}
 	}
-	return statements
+	return matchingEntries
+}
+
+func (toc *TOC) GetSequenceValuesMatching(includeSchemas []string, excludeSchemas []string, includeRelations []string, excludeRelations []string) []SequenceValue {
+	objectSet, schemaSet, relationSet := constructFilterSets([]string{}, []string{}, includeSchemas, excludeSchemas, includeRelations, excludeRelations)
+	matchingValues := make([]SequenceValue, 0)
+	for _, value := range toc.SequenceValues {
+		entry := MetadataEntry{Schema: value.Schema, Name: value.Name, ObjectType: "SEQUENCE"}
+		if shouldIncludeStatement(entry, objectSet, schemaSet, relationSet) {
+			matchingValues = append(matchingValues, value)
+		}
+	}
+	return matchingValues
 }
 
 func constructFilterSets(includeObjectTypes []string, excludeObjectTypes []string, includeSchemas []string, excludeSchemas []string, includeRelations []string, excludeRelations []string) (*utils.FilterSet, *utils.FilterSet, *utils.FilterSet) {
@@ -187,7 +326,38 @@ func getLeafPartitions(tableFQNs []string, tocDataEntries []MasterDataEntry) (le
 
 func (toc *TOC) GetDataEntriesMatching(includeSchemas []string, excludeSchemas []string,
 	includeTableFQNs []string, excludeTableFQNs []string, restorePlanTableFQNs []string) []MasterDataEntry {
+	schemaSet, tableSet := toc.constructDataFilterSets(includeSchemas, excludeSchemas, includeTableFQNs, excludeTableFQNs)
+	restorePlanTableSet := utils.NewSet(restorePlanTableFQNs)
 
+	matchingEntries := make([]MasterDataEntry, 0)
+	for _, entry := range toc.DataEntries {
+		tableFQN := utils.MakeFQN(entry.Schema, entry.Name)
+
+		validSchema := schemaSet.MatchesFilter(entry.Schema)
+		validRestorePlan := restorePlanTableSet.MatchesFilter(tableFQN)
+		validTable := tableSet.MatchesFilter(tableFQN)
+		if validRestorePlan && validSchema && validTable {
+			matchingEntries = append(matchingEntries, entry)
+		}
+	}
+	return matchingEntries
+}
+
+func (toc *TOC) GetDataExcludedEntriesMatching(includeSchemas []string, excludeSchemas []string,
+	includeTableFQNs []string, excludeTableFQNs []string) []MasterDataEntry {
+	schemaSet, tableSet := toc.constructDataFilterSets(includeSchemas, excludeSchemas, includeTableFQNs, excludeTableFQNs)
+
+	matchingEntries := make([]MasterDataEntry, 0)
+	for _, entry := range toc.DataExcludedEntries {
+		if schemaSet.MatchesFilter(entry.Schema) && tableSet.MatchesFilter(utils.MakeFQN(entry.Schema, entry.Name)) {
+			matchingEntries = append(matchingEntries, entry)
+		}
+	}
+	return matchingEntries
+}
+
+func (toc *TOC) constructDataFilterSets(includeSchemas []string, excludeSchemas []string,
+	includeTableFQNs []string, excludeTableFQNs []string) (*utils.FilterSet, *utils.FilterSet) {
 	schemaSet := utils.NewIncludeSet([]string{})
 	if len(includeSchemas) > 0 {
 		schemaSet = utils.NewIncludeSet(includeSchemas)
@@ -203,25 +373,11 @@ func (toc *TOC) GetDataEntriesMatching(includeSchemas []string, excludeSchemas [
 		excludeTableFQNs = append(excludeTableFQNs, getLeafPartitions(excludeTableFQNs, toc.DataEntries)...)
 		tableSet = utils.NewExcludeSet(excludeTableFQNs)
 	}
-
-	restorePlanTableSet := utils.NewSet(restorePlanTableFQNs)
-
-	matchingEntries := make([]MasterDataEntry, 0)
-	for _, entry := range toc.DataEntries {
-		tableFQN := utils.MakeFQN(entry.Schema, entry.Name)
-
-		validSchema := schemaSet.MatchesFilter(entry.Schema)
-		validRestorePlan := restorePlanTableSet.MatchesFilter(tableFQN)
-		validTable := tableSet.MatchesFilter(tableFQN)
-		if validRestorePlan && validSchema && validTable {
-			matchingEntries = append(matchingEntries, entry)
-		}
-	}
-	return matchingEntries
+	return schemaSet, tableSet
 }
 
 func SubstituteRedirectDatabaseInStatements(statements []StatementWithType, oldQuotedName string, newQuotedName string) []StatementWithType {
-	shouldReplace := map[string]bool{"DATABASE GUC": true, "DATABASE": true, "DATABASE METADATA": true}
+	shouldReplace := map[string]bool{"DATABASE GUC": true, "DATABASE": true, "DATABASE METADATA": true, "ROLE GUCS": true}
 	pattern := regexp.MustCompile(fmt.Sprintf("DATABASE %s(;| OWNER| SET| TO| FROM| IS| TEMPLATE)", regexp.QuoteMeta(oldQuotedName)))
 	for i := range statements {
 		if shouldReplace[statements[i].ObjectType] {
@@ -243,8 +399,9 @@ func RemoveActiveRole(activeUser string, statements []StatementWithType) []State
 }
 
 func (toc *TOC) InitializeMetadataEntryMap() {
-	toc.metadataEntryMap = make(map[string]*[]MetadataEntry, 4)
+	toc.metadataEntryMap = make(map[string]*[]MetadataEntry, 5)
 	toc.metadataEntryMap["global"] = &toc.GlobalEntries
+	toc.metadataEntryMap["cluster"] = &toc.ClusterEntries
 	toc.metadataEntryMap["predata"] = &toc.PredataEntries
 	toc.metadataEntryMap["postdata"] = &toc.PostdataEntries
 	toc.metadataEntryMap["statistics"] = &toc.StatisticsEntries
@@ -263,13 +420,62 @@ func (toc *TOC) AddMetadataEntry(section string, entry MetadataEntry, start, end
 	entry.StartByte = start
 	entry.EndByte = end
 	*toc.metadataEntryMap[section] = append(*toc.metadataEntryMap[section], entry)
+	toc.recordProgress(ProgressEntry{Section: section, Metadata: &entry})
 }
 
 func (toc *TOC) AddMasterDataEntry(schema string, name string, oid uint32, attributeString string, rowsCopied int64, PartitionRoot string) {
-	toc.DataEntries = append(toc.DataEntries, MasterDataEntry{schema, name, oid, attributeString, rowsCopied, PartitionRoot})
+	toc.AddDataEntry(MasterDataEntry{Schema: schema, Name: name, Oid: oid, AttributeString: attributeString, RowsCopied: rowsCopied, PartitionRoot: PartitionRoot})
+}
+
+func (toc *TOC) AddDataEntry(entry MasterDataEntry) {
+	toc.DataEntries = append(toc.DataEntries, entry)
+	toc.recordProgress(ProgressEntry{Section: "data", Data: &entry})
+}
+
+/*
+ * Entries added after SetProgressFile is called are also appended to the
+ * progress file.  The progress file only aids recovery, so the backup goes on
+ * without it if it cannot be written.
+ */
+func (toc *TOC) SetProgressFile(progressFile *ProgressFile) {
+	toc.progressFile = progressFile
+}
+
+func (toc *TOC) SyncProgressFile() {
+	if toc.progressFile == nil {
+		return
+	}
+	if err := toc.progressFile.Sync(); err != nil {
+		toc.stopRecordingProgress(err)
+	}
+}
+
+func (toc *TOC) CloseProgressFile() {
+	if toc.progressFile == nil {
+		return
+	}
+	if err := toc.progressFile.Close(); err != nil {
+		gplog.Warn("Unable to write TOC progress file: %v", err)
+	}
+	toc.progressFile = nil
+}
+
+func (toc *TOC) recordProgress(entry ProgressEntry) {
+	if toc.progressFile == nil {
+		return
+	}
+	if err := toc.progressFile.Append(entry); err != nil {
+		toc.stopRecordingProgress(err)
+	}
+}
+
+func (toc *TOC) stopRecordingProgress(err error) {
+	gplog.Warn("Unable to write TOC progress file; TOC entries will no longer be recorded as they are added: %v", err)
+	_ = toc.progressFile.file.Close()
+	toc.progressFile = nil
 }
 
-func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64) {
+func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64, checksum string) {
 	// We use uint for oid since the flags package does not have a uint32 flag
-	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte}
+	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte, checksum}
 }
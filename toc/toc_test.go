@@ -370,6 +370,11 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 			statements := toc.SubstituteRedirectDatabaseInStatements([]toc.StatementWithType{gucs}, "somedatabase", "newdatabase")
 			Expect(statements[0].Statement).To(Equal("ALTER DATABASE newdatabase SET fsync TO off;\n"))
 		})
+		It("can substitute a database name in a role GUC statement for the database", func() {
+			roleGUCs := toc.StatementWithType{ObjectType: "ROLE GUCS", Statement: "\n\nALTER ROLE testrole IN DATABASE somedatabase SET search_path TO public;"}
+			statements := toc.SubstituteRedirectDatabaseInStatements([]toc.StatementWithType{roleGUCs}, "somedatabase", "newdatabase")
+			Expect(statements[0].Statement).To(Equal("\n\nALTER ROLE testrole IN DATABASE newdatabase SET search_path TO public;"))
+		})
 		It("doesn't modify a statement of the wrong type", func() {
 			statements := toc.SubstituteRedirectDatabaseInStatements([]toc.StatementWithType{wrongCreate}, "somedatabase", "newdatabase")
 			Expect(statements[0].Statement).To(Equal("CREATE DATABASE somedatabase;\n"))
@@ -398,6 +403,43 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 			Expect(resultStatements).To(Equal([]toc.StatementWithType{user1, user2}))
 		})
 	})
+	Describe("GetDataFiles", func() {
+		It("returns the data file of each entry that has one by oid", func() {
+			entries := []toc.MasterDataEntry{
+				{Schema: "public", Name: "foo", Oid: 1, DataFile: "public/foo"},
+				{Schema: "public", Name: "bar", Oid: 2},
+			}
+			Expect(toc.GetDataFiles(entries)).To(Equal(map[uint32]string{1: "public/foo"}))
+		})
+	})
+	Describe("GetDataExcludedEntriesMatching", func() {
+		audit := toc.MasterDataEntry{Schema: "public", Name: "audit", Oid: 1}
+		scratch := toc.MasterDataEntry{Schema: "scratch", Name: "work", Oid: 2}
+		excludedTOC := &toc.TOC{DataExcludedEntries: []toc.MasterDataEntry{audit, scratch}}
+		It("returns all entries when there are no filters", func() {
+			Expect(excludedTOC.GetDataExcludedEntriesMatching(nil, nil, nil, nil)).To(Equal([]toc.MasterDataEntry{audit, scratch}))
+		})
+		It("returns the entries in the included schemas", func() {
+			Expect(excludedTOC.GetDataExcludedEntriesMatching([]string{"scratch"}, nil, nil, nil)).To(Equal([]toc.MasterDataEntry{scratch}))
+		})
+		It("does not return the entries of excluded tables", func() {
+			Expect(excludedTOC.GetDataExcludedEntriesMatching(nil, nil, nil, []string{"public.audit"})).To(Equal([]toc.MasterDataEntry{scratch}))
+		})
+	})
+	Describe("GetSequenceValuesMatching", func() {
+		fooSeq := toc.SequenceValue{Schema: "public", Name: "foo_seq", LastVal: 5, IsCalled: true}
+		barSeq := toc.SequenceValue{Schema: "other", Name: "bar_seq", LastVal: 1}
+		sequenceTOC := &toc.TOC{SequenceValues: []toc.SequenceValue{fooSeq, barSeq}}
+		It("returns all sequence values when there are no filters", func() {
+			Expect(sequenceTOC.GetSequenceValuesMatching(nil, nil, nil, nil)).To(Equal([]toc.SequenceValue{fooSeq, barSeq}))
+		})
+		It("returns the sequence values in the included schemas", func() {
+			Expect(sequenceTOC.GetSequenceValuesMatching([]string{"other"}, nil, nil, nil)).To(Equal([]toc.SequenceValue{barSeq}))
+		})
+		It("does not return the sequence values of excluded relations", func() {
+			Expect(sequenceTOC.GetSequenceValuesMatching(nil, nil, nil, []string{"public.foo_seq"})).To(Equal([]toc.SequenceValue{barSeq}))
+		})
+	})
 	Describe("GetIncludedPartitionRoots", func() {
 		It("does not return anything if relations are not leaf partitions", func() {
 			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "")
@@ -440,4 +482,22 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 			Expect(roots).To(BeEmpty())
 		})
 	})
+	Describe("ParseSegmentTOC", func() {
+		It("returns the data size of the segment as the end of its last table", func() {
+			segmentTOC, err := toc.ParseSegmentTOC([]byte(`dataentries:
+  16384:
+    startbyte: 0
+    endbyte: 120
+  16390:
+    startbyte: 120
+    endbyte: 300
+`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(segmentTOC.DataSize()).To(Equal(uint64(300)))
+		})
+		It("returns an error if the table of contents cannot be parsed", func() {
+			_, err := toc.ParseSegmentTOC([]byte("dataentries: ["))
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	path "path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -114,7 +115,7 @@ func VerifyHelperVersionOnSegments(version string, c *cluster.Cluster) {
 	}
 }
 
-func StartGpbackupHelpers(c *cluster.Cluster, fpInfo filepath.FilePathInfo, operation string, pluginConfigFile string, compressStr string, onErrorContinue bool, isFilter bool, wasTerminated *bool) {
+func StartGpbackupHelpers(c *cluster.Cluster, fpInfo filepath.FilePathInfo, operation string, pluginConfigFile string, agentFlagsStr string, onErrorContinue bool, isFilter bool, wasTerminated *bool) {
 	// A mutex lock for cleaning up and starting gpbackup helpers prevents a
 	// race condition that causes gpbackup_helpers to be orphaned if
 	// gpbackup_helper cleanup happens before they are started.
@@ -145,7 +146,7 @@ func StartGpbackupHelpers(c *cluster.Cluster, fpInfo filepath.FilePathInfo, oper
 		scriptFile := fpInfo.GetSegmentHelperFilePath(contentID, "script")
 		pipeFile := fpInfo.GetSegmentPipeFilePath(contentID)
 		backupFile := fpInfo.GetTableBackupFilePath(contentID, 0, GetPipeThroughProgram().Extension, true)
-		helperCmdStr := fmt.Sprintf("gpbackup_helper %s --toc-file %s --oid-file %s --pipe-file %s --data-file %s --content %d%s%s%s%s", operation, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, compressStr, onErrorContinueStr, filterStr)
+		helperCmdStr := fmt.Sprintf("gpbackup_helper %s --toc-file %s --oid-file %s --pipe-file %s --data-file %s --content %d%s%s%s%s", operation, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, agentFlagsStr, onErrorContinueStr, filterStr)
 		// we run these commands in sequence to ensure that any failure is critical; the last command ensures the agent process was successfully started
 		return fmt.Sprintf(`cat << HEREDOC > %[1]s && chmod +x %[1]s && ( nohup %[1]s &> /dev/null &)
 #!/bin/bash
@@ -164,9 +165,12 @@ HEREDOC
 func CleanUpHelperFilesOnAllHosts(c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
 	remoteOutput := c.GenerateAndExecuteCommand("Removing oid list and helper script files from segment data directories", cluster.ON_SEGMENTS, func(contentID int) string {
 		errorFile := fmt.Sprintf("%s_error", fpInfo.GetSegmentPipeFilePath(contentID))
+		usageFile := fmt.Sprintf("%s_usage", fpInfo.GetSegmentPipeFilePath(contentID))
+		heartbeatFile := fmt.Sprintf("%s_heartbeat", fpInfo.GetSegmentPipeFilePath(contentID))
+		checkpointFile := fmt.Sprintf("%s_checkpoint", fpInfo.GetSegmentPipeFilePath(contentID))
 		oidFile := fpInfo.GetSegmentHelperFilePath(contentID, "oid")
 		scriptFile := fpInfo.GetSegmentHelperFilePath(contentID, "script")
-		return fmt.Sprintf("rm -f %s && rm -f %s && rm -f %s", errorFile, oidFile, scriptFile)
+		return fmt.Sprintf("rm -f %s && rm -f %s && rm -f %s && rm -f %s && rm -f %s && rm -f %s", errorFile, usageFile, heartbeatFile, checkpointFile, oidFile, scriptFile)
 	})
 	errMsg := fmt.Sprintf("Unable to remove segment helper file(s). See %s for a complete list of segments with errors and remove manually.",
 		gplog.GetLogFilePath())
@@ -206,16 +210,18 @@ func CheckAgentErrorsOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo
 	})
 
 	numErrors := 0
-	for contentID, cmd := range remoteOutput.Commands {
+	errorSegments := make([]string, 0)
+	for _, cmd := range remoteOutput.Commands {
 		if strings.TrimSpace(cmd.Stdout) == "error" {
-			gplog.Verbose("Error occurred with helper agent on segment %d on host %s.", contentID, c.GetHostForContent(contentID))
+			gplog.Verbose("Error occurred with helper agent on segment %d on host %s.", cmd.Content, c.GetHostForContent(cmd.Content))
+			errorSegments = append(errorSegments, fmt.Sprintf("segment %d on host %s", cmd.Content, c.GetHostForContent(cmd.Content)))
 			numErrors++
 		}
 	}
 	if numErrors > 0 {
 		helperLogName := fpInfo.GetHelperLogPath()
-		return errors.Errorf("Encountered errors with %d helper agent(s).  See %s for a complete list of segments with errors, and see %s on the corresponding hosts for detailed error messages.",
-			numErrors, gplog.GetLogFilePath(), helperLogName)
+		return errors.Errorf("Encountered errors with %d helper agent(s) (%s).  See %s for a complete list of segments with errors, and see %s on the corresponding hosts for detailed error messages.",
+			numErrors, strings.Join(errorSegments, ", "), gplog.GetLogFilePath(), helperLogName)
 	}
 	return nil
 }
@@ -229,3 +235,92 @@ func CreateSkipFileOnSegments(oid string, tableName string, c *cluster.Cluster,
 		return fmt.Sprintf("Could not create skip file %s_skip_%s on segments", fpInfo.GetSegmentPipeFilePath(contentID), oid)
 	})
 }
+
+/*
+ * Returns the total size in bytes of the backup directories for the given
+ * timestamp on the master and all segments.
+ */
+func GetBackupSizeOnAllHosts(c *cluster.Cluster, fpInfo filepath.FilePathInfo) (int64, error) {
+	remoteOutput := c.GenerateAndExecuteCommand("Calculating size of backup files", cluster.ON_SEGMENTS|cluster.INCLUDE_MASTER, func(contentID int) string {
+		return fmt.Sprintf("du -sb %s | cut -f1", fpInfo.GetDirForContent(contentID))
+	})
+	if remoteOutput.NumErrors > 0 {
+		return 0, errors.Errorf("Unable to calculate size of backup files on %d segment(s)", remoteOutput.NumErrors)
+	}
+	var totalSize int64
+	for _, command := range remoteOutput.Commands {
+		size, err := strconv.ParseInt(strings.TrimSpace(command.Stdout), 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("Unable to parse size of backup files for segment %d: %s", command.Content, command.Stdout)
+		}
+		totalSize += size
+	}
+	return totalSize, nil
+}
+
+/*
+ * Returns the size in bytes of the backup directory for the given timestamp
+ * on the master, without contacting the segment hosts.
+ */
+func GetBackupSizeOnMaster(c *cluster.Cluster, fpInfo filepath.FilePathInfo) (int64, error) {
+	output, err := c.ExecuteLocalCommand(fmt.Sprintf("du -sb %s | cut -f1", fpInfo.GetDirForContent(-1)))
+	if err != nil {
+		return 0, errors.Errorf("Unable to calculate size of backup files on master: %v", err)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("Unable to parse size of backup files on master: %s", output)
+	}
+	return size, nil
+}
+
+/*
+ * Returns the total size in bytes of the data files of each table on all
+ * segments, including the files of each stream of split tables.
+ */
+func GetDataFileSizesOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) (map[uint32]int64, error) {
+	remoteOutput := c.GenerateAndExecuteCommand("Calculating size of data files", cluster.ON_SEGMENTS, func(contentID int) string {
+		return fmt.Sprintf("cd %s && find . -maxdepth 1 -name 'gpbackup_%d_%s_*' -printf '%%f %%s\\n'", fpInfo.GetDirForContent(contentID), contentID, fpInfo.Timestamp)
+	})
+	if remoteOutput.NumErrors > 0 {
+		return nil, errors.Errorf("Unable to calculate size of data files on %d segment(s)", remoteOutput.NumErrors)
+	}
+	sizes := make(map[uint32]int64)
+	for _, command := range remoteOutput.Commands {
+		prefix := fmt.Sprintf("gpbackup_%d_%s_", command.Content, fpInfo.Timestamp)
+		for oid, size := range ParseDataFileSizes(command.Stdout, prefix) {
+			sizes[oid] += size
+		}
+	}
+	return sizes, nil
+}
+
+/*
+ * Parses lines of the form "<filename> <size>", where each filename is the
+ * prefix followed by the oid of a table and an optional stream number and
+ * extension, into the total size of the files of each table.
+ */
+func ParseDataFileSizes(output string, prefix string) map[uint32]int64 {
+	sizes := make(map[uint32]int64)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], prefix) {
+			continue
+		}
+		suffix := strings.TrimPrefix(fields[0], prefix)
+		oidEnd := strings.IndexFunc(suffix, func(char rune) bool { return char < '0' || char > '9' })
+		if oidEnd == -1 {
+			oidEnd = len(suffix)
+		}
+		oid, err := strconv.ParseUint(suffix[:oidEnd], 10, 32)
+		if err != nil {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes[uint32(oid)] += size
+	}
+	return sizes
+}
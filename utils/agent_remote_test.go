@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
@@ -146,7 +147,116 @@ var _ = Describe("agent remote", func() {
 			expectedCmd1 := fmt.Sprintf(`if [[ -f %[1]s ]]; then echo 'error'; fi; rm -f %[1]s`, errorFile1)
 			Expect(cc[1].CommandString).To(ContainSubstring(expectedCmd1))
 		})
+		It("names the segments and hosts whose agents had errors", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{{Content: 0, Stdout: ""}, {Content: 1, Stdout: "error\n"}}
+			err := utils.CheckAgentErrorsOnSegments(testCluster, fpInfo)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("Encountered errors with 1 helper agent(s) (segment 1 on host remotehost1)."))
+		})
+
+	})
+	Describe("ParseHelperHeartbeat", func() {
+		It("parses the heartbeat of a running agent", func() {
+			status, oid := utils.ParseHelperHeartbeat("running 2 16384\n", 15)
+			Expect(status).To(Equal(utils.HELPER_RUNNING))
+			Expect(oid).To(Equal(uint32(16384)))
+		})
+		It("reports an agent whose heartbeat is too old as unresponsive", func() {
+			status, oid := utils.ParseHelperHeartbeat("running 16 16384\n", 15)
+			Expect(status).To(Equal(utils.HELPER_UNRESPONSIVE))
+			Expect(oid).To(Equal(uint32(16384)))
+		})
+		It("reports an agent whose process is gone as stopped", func() {
+			status, oid := utils.ParseHelperHeartbeat("stopped 1 16384\n", 15)
+			Expect(status).To(Equal(utils.HELPER_STOPPED))
+			Expect(oid).To(Equal(uint32(16384)))
+		})
+		It("reports an agent with an error file", func() {
+			status, _ := utils.ParseHelperHeartbeat("error\n", 15)
+			Expect(status).To(Equal(utils.HELPER_ERROR))
+		})
+		It("returns no status for an agent without a heartbeat file or with unparseable output", func() {
+			status, _ := utils.ParseHelperHeartbeat("", 15)
+			Expect(status).To(Equal(""))
+			status, _ = utils.ParseHelperHeartbeat("running 16384\n", 15)
+			Expect(status).To(Equal(""))
+		})
+	})
+	Describe("CheckHelperHeartbeatsOnSegments", func() {
+		It("returns the heartbeats of the agents that have one", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{{Content: 0, Stdout: "stopped 3 16384\n"}, {Content: 1, Stdout: ""}}
+			heartbeats := utils.CheckHelperHeartbeatsOnSegments(testCluster, fpInfo, 15)
+			Expect(heartbeats).To(Equal([]utils.HelperHeartbeat{{ContentID: 0, Status: utils.HELPER_STOPPED, Oid: 16384}}))
+			Expect(heartbeats[0].IsDead()).To(BeTrue())
+
+			cc := testExecutor.ClusterCommands[0]
+			heartbeatFile := fmt.Sprintf(`/data/gpseg0/gpbackup_0_11112233445566_pipe_%d_heartbeat`, fpInfo.PID)
+			Expect(cc[0].CommandString).To(ContainSubstring(fmt.Sprintf(`read PID OID 2>/dev/null < %s`, heartbeatFile)))
+		})
+	})
+	Describe("GetHelperResourceUsageOnSegments", func() {
+		It("reads the usage reported by the agent on each segment", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{{Content: 0, Stdout: "3072 1024 0 1500000000\n"}, {Content: 1, Stdout: ""}}
+			segmentUsage := utils.GetHelperResourceUsageOnSegments(testCluster, fpInfo)
+			Expect(segmentUsage).To(Equal(map[int]utils.HelperResourceUsage{
+				0: {BytesRead: 3072, BytesWritten: 1024, CPUTime: 1500 * time.Millisecond},
+			}))
 
+			cc := testExecutor.ClusterCommands[0]
+			usageFile := fmt.Sprintf(`/data/gpseg0/gpbackup_0_11112233445566_pipe_%d_usage`, fpInfo.PID)
+			Expect(cc[0].CommandString).To(ContainSubstring(fmt.Sprintf(`if [[ -f %[1]s ]]; then cat %[1]s; fi; rm -f %[1]s`, usageFile)))
+		})
+		It("skips segments whose usage cannot be parsed", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{{Content: 0, Stdout: "3072 1024\n"}, {Content: 1, Stdout: "10 20 0 30\n"}}
+			segmentUsage := utils.GetHelperResourceUsageOnSegments(testCluster, fpInfo)
+			Expect(segmentUsage).To(Equal(map[int]utils.HelperResourceUsage{
+				1: {BytesRead: 10, BytesWritten: 20, CPUTime: 30},
+			}))
+		})
+	})
+	Describe("GetBackupSizeOnAllHosts", func() {
+		It("sums the size of the backup directories on the master and segments", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{{Content: -1, Stdout: "1024\n"}, {Content: 0, Stdout: "2048\n"}, {Content: 1, Stdout: "4096\n"}}
+			size, err := utils.GetBackupSizeOnAllHosts(testCluster, fpInfo)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(size).To(Equal(int64(7168)))
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0].CommandString).To(ContainSubstring("du -sb /data/gpseg-1/backups/11112233/11112233445566 | cut -f1"))
+		})
+		It("returns an error if the size cannot be calculated on a segment", func() {
+			remoteOutput.NumErrors = 1
+			_, err := utils.GetBackupSizeOnAllHosts(testCluster, fpInfo)
+			Expect(err).To(MatchError("Unable to calculate size of backup files on 1 segment(s)"))
+		})
+	})
+	Describe("GetBackupSizeOnMaster", func() {
+		It("measures only the backup directory on the master", func() {
+			testExecutor.LocalOutput = "1024\n"
+			size, err := utils.GetBackupSizeOnMaster(testCluster, fpInfo)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(size).To(Equal(int64(1024)))
+
+			Expect(testExecutor.LocalCommands).To(Equal([]string{"du -sb /data/gpseg-1/backups/11112233/11112233445566 | cut -f1"}))
+			Expect(testExecutor.ClusterCommands).To(BeEmpty())
+		})
+		It("returns an error if the size cannot be calculated", func() {
+			testExecutor.LocalError = errors.New("du: cannot access")
+			_, err := utils.GetBackupSizeOnMaster(testCluster, fpInfo)
+			Expect(err).To(MatchError("Unable to calculate size of backup files on master: du: cannot access"))
+		})
+	})
+	Describe("ParseDataFileSizes", func() {
+		It("adds up the sizes of the data files of each table", func() {
+			output := `gpbackup_0_20170101010101_16384.gz 100
+gpbackup_0_20170101010101_16385_0.gz 30
+gpbackup_0_20170101010101_16385_1.gz 40
+gpbackup_0_20170101010101_toc.yaml 10
+gpbackup_0_20170101010101_pipe_16386 0
+`
+			sizes := utils.ParseDataFileSizes(output, "gpbackup_0_20170101010101_")
+			Expect(sizes).To(Equal(map[uint32]int64{16384: 100, 16385: 70}))
+		})
 	})
 })
 
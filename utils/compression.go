@@ -1,6 +1,13 @@
 package utils
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+)
 
 var (
 	pipeThroughProgram PipeThroughProgram
@@ -14,9 +21,12 @@ type PipeThroughProgram struct {
 }
 
 func InitializePipeThroughParameters(compress bool, compressionType string, compressionLevel int) {
+	pipeThroughProgram = NewPipeThroughProgram(compress, compressionType, compressionLevel)
+}
+
+func NewPipeThroughProgram(compress bool, compressionType string, compressionLevel int) PipeThroughProgram {
 	if !compress {
-		pipeThroughProgram = PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""}
-		return
+		return PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""}
 	}
 
 	// backward compatibility for inputs without compressionType
@@ -25,14 +35,32 @@ func InitializePipeThroughParameters(compress bool, compressionType string, comp
 	}
 
 	if compressionType == "gzip" {
-		pipeThroughProgram = PipeThroughProgram{Name: "gzip", OutputCommand: fmt.Sprintf("gzip -c -%d", compressionLevel), InputCommand: "gzip -d -c", Extension: ".gz"}
-		return
+		return PipeThroughProgram{Name: "gzip", OutputCommand: fmt.Sprintf("gzip -c -%d", compressionLevel), InputCommand: "gzip -d -c", Extension: ".gz"}
 	}
 
 	if compressionType == "zstd" {
-		pipeThroughProgram = PipeThroughProgram{Name: "zstd", OutputCommand: fmt.Sprintf("zstd --compress -%d -c", compressionLevel), InputCommand: "zstd --decompress -c", Extension: ".zst"}
-		return
+		return PipeThroughProgram{Name: "zstd", OutputCommand: fmt.Sprintf("zstd --compress -%d -c", compressionLevel), InputCommand: "zstd --decompress -c", Extension: ".zst"}
 	}
+	return PipeThroughProgram{}
+}
+
+/*
+ * Returns the program that compresses data on several cores: gpbackup_helper
+ * for gzip, whose output is read back with gzip as usual, or zstd with its own
+ * threads.
+ */
+func NewParallelPipeThroughProgram(compressionType string, compressionLevel int, compressionWorkers int) PipeThroughProgram {
+	program := NewPipeThroughProgram(true, compressionType, compressionLevel)
+	if compressionWorkers <= 1 {
+		return program
+	}
+	if program.Name == "gzip" {
+		program.OutputCommand = fmt.Sprintf("%s/bin/gpbackup_helper --compress --compression-level %d --compression-workers %d",
+			operating.System.Getenv("GPHOME"), compressionLevel, compressionWorkers)
+	} else if program.Name == "zstd" {
+		program.OutputCommand = fmt.Sprintf("zstd --compress -%d -T%d -c", compressionLevel, compressionWorkers)
+	}
+	return program
 }
 
 func GetPipeThroughProgram() PipeThroughProgram {
@@ -42,3 +70,43 @@ func GetPipeThroughProgram() PipeThroughProgram {
 func SetPipeThroughProgram(compression PipeThroughProgram) {
 	pipeThroughProgram = compression
 }
+
+/*
+ * Parses lines of the form "schema.table:level" into a map from table name to
+ * the program used to compress that table's data.  A level of "none" disables
+ * compression for the table; any other level must be valid for the backup's
+ * compression type, and is compressed with the backup's number of workers.
+ */
+func ParseCompressionOverrides(lines []string, compressionType string, compressionWorkers int) (map[string]PipeThroughProgram, error) {
+	overrides := make(map[string]PipeThroughProgram)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		separator := strings.LastIndex(line, ":")
+		if separator == -1 {
+			return nil, errors.Errorf("Invalid compression override '%s'.  Overrides must be in the format <schema>.<table>:<level>", line)
+		}
+		tableName := strings.TrimSpace(line[:separator])
+		levelStr := strings.TrimSpace(line[separator+1:])
+		err := ValidateFQNs([]string{tableName})
+		if err != nil {
+			return nil, err
+		}
+		if strings.ToLower(levelStr) == "none" {
+			overrides[tableName] = NewPipeThroughProgram(false, "", 0)
+			continue
+		}
+		level, err := strconv.Atoi(levelStr)
+		if err != nil {
+			return nil, errors.Errorf("Invalid compression level '%s' for table %s", levelStr, tableName)
+		}
+		err = ValidateCompressionTypeAndLevel(compressionType, level)
+		if err != nil {
+			return nil, err
+		}
+		overrides[tableName] = NewParallelPipeThroughProgram(compressionType, level, compressionWorkers)
+	}
+	return overrides, nil
+}
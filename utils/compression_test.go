@@ -10,6 +10,7 @@ import (
 	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("utils/compression tests", func() {
@@ -70,4 +71,47 @@ var _ = Describe("utils/compression tests", func() {
 			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
 		})
 	})
+	Describe("NewParallelPipeThroughProgram", func() {
+		AfterEach(func() {
+			operating.System = operating.InitializeSystemFunctions()
+		})
+		It("compresses gzip data with gpbackup_helper when given several workers", func() {
+			operating.System.Getenv = func(key string) string { return "/usr/local/greenplum-db" }
+			program := utils.NewParallelPipeThroughProgram("gzip", 3, 4)
+			Expect(program).To(Equal(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "/usr/local/greenplum-db/bin/gpbackup_helper --compress --compression-level 3 --compression-workers 4",
+				InputCommand: "gzip -d -c", Extension: ".gz"}))
+		})
+		It("compresses zstd data with zstd threads when given several workers", func() {
+			program := utils.NewParallelPipeThroughProgram("zstd", 3, 4)
+			Expect(program).To(Equal(utils.PipeThroughProgram{Name: "zstd", OutputCommand: "zstd --compress -3 -T4 -c", InputCommand: "zstd --decompress -c", Extension: ".zst"}))
+		})
+		It("uses the usual program when given a single worker", func() {
+			Expect(utils.NewParallelPipeThroughProgram("gzip", 3, 1)).To(Equal(utils.NewPipeThroughProgram(true, "gzip", 3)))
+		})
+	})
+	Describe("ParseCompressionOverrides", func() {
+		gzipLevel9 := utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -9", InputCommand: "gzip -d -c", Extension: ".gz"}
+		noCompression := utils.PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""}
+		It("parses compression levels and disabled compression for tables", func() {
+			overrides, err := utils.ParseCompressionOverrides([]string{"public.blobs:none", "", "public.logs: 9"}, "gzip", 1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(overrides).To(Equal(map[string]utils.PipeThroughProgram{"public.blobs": noCompression, "public.logs": gzipLevel9}))
+		})
+		It("returns an error if a line has no compression level", func() {
+			_, err := utils.ParseCompressionOverrides([]string{"public.blobs"}, "gzip", 1)
+			Expect(err).To(MatchError("Invalid compression override 'public.blobs'.  Overrides must be in the format <schema>.<table>:<level>"))
+		})
+		It("returns an error if a table is not fully-qualified", func() {
+			_, err := utils.ParseCompressionOverrides([]string{"blobs:none"}, "gzip", 1)
+			Expect(err).To(HaveOccurred())
+		})
+		It("returns an error if the compression level is not a number", func() {
+			_, err := utils.ParseCompressionOverrides([]string{"public.blobs:high"}, "gzip", 1)
+			Expect(err).To(MatchError("Invalid compression level 'high' for table public.blobs"))
+		})
+		It("returns an error if the compression level is invalid for the compression type", func() {
+			_, err := utils.ParseCompressionOverrides([]string{"public.blobs:15"}, "gzip", 1)
+			Expect(err).To(MatchError("compression type 'gzip' only allows compression levels between 1 and 9, but the provided level is 15"))
+		})
+	})
 })
@@ -0,0 +1,203 @@
+package utils
+
+/*
+ * This file contains functions for --redact-credentials, which keeps the
+ * credentials in the options of foreign servers and user mappings out of the
+ * metadata file, optionally moving them to a file encrypted with the key in
+ * --credentials-key-file so that gprestore can put them back.
+ */
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	credentialOptionNames   = []string{"password", "passwd", "secret", "token", "credential", "access_key", "accesskey", "api_key", "apikey"}
+	redactedCredentialRegex = regexp.MustCompile(`'gpbackup_redacted_credential_\d+'`)
+)
+
+/*
+ * Returns whether the value of an option with the given name is a credential.
+ */
+func IsCredentialOption(name string) bool {
+	name = strings.ToLower(strings.Trim(name, `"`))
+	if name == "pwd" {
+		return true
+	}
+	for _, credentialName := range credentialOptionNames {
+		if strings.Contains(name, credentialName) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Replaces the values of credential options in a list of options, as built
+ * with quote_ident and quote_literal, with placeholders.  The placeholder and
+ * the quoted value that it replaced are stored in credentials.
+ */
+func RedactCredentialOptions(optionList string, credentials map[string]string) string {
+	redacted := make([]string, 0)
+	rest := optionList
+	for rest != "" {
+		name, value, remainder := nextOption(rest)
+		if name == "" || value == "" {
+			// The list could not be parsed, so it is left as it is
+			return optionList
+		}
+		if IsCredentialOption(name) {
+			placeholder := fmt.Sprintf("'gpbackup_redacted_credential_%d'", len(credentials)+1)
+			credentials[placeholder] = value
+			value = placeholder
+		}
+		redacted = append(redacted, fmt.Sprintf("%s %s", name, value))
+		rest = strings.TrimPrefix(remainder, ", ")
+	}
+	return strings.Join(redacted, ", ")
+}
+
+/*
+ * Returns the quoted name and the quoted value of the first option in a list
+ * of options, and the rest of the list.
+ */
+func nextOption(optionList string) (string, string, string) {
+	nameEnd := strings.Index(optionList, " ")
+	if strings.HasPrefix(optionList, `"`) {
+		nameEnd = -1
+		for i := 1; i < len(optionList); i++ {
+			if optionList[i] == '"' {
+				if i+1 < len(optionList) && optionList[i+1] == '"' {
+					i++
+					continue
+				}
+				nameEnd = i + 1
+				break
+			}
+		}
+	}
+	if nameEnd <= 0 || nameEnd >= len(optionList) || optionList[nameEnd] != ' ' {
+		return "", "", ""
+	}
+	name := optionList[:nameEnd]
+	literal := optionList[nameEnd+1:]
+
+	// quote_literal doubles quotes, and doubles backslashes in E'' strings
+	start := 0
+	escapeString := false
+	if strings.HasPrefix(literal, "E'") {
+		start = 1
+		escapeString = true
+	}
+	if len(literal) <= start || literal[start] != '\'' {
+		return "", "", ""
+	}
+	for i := start + 1; i < len(literal); i++ {
+		if escapeString && literal[i] == '\\' {
+			i++
+			continue
+		}
+		if literal[i] == '\'' {
+			if i+1 < len(literal) && literal[i+1] == '\'' {
+				i++
+				continue
+			}
+			return name, literal[:i+1], literal[i+1:]
+		}
+	}
+	return "", "", ""
+}
+
+/*
+ * Puts the credentials back in place of their placeholders in a statement.
+ * Placeholders without a stored credential are left in place.
+ */
+func RestoreCredentials(statement string, credentials map[string]string) string {
+	return redactedCredentialRegex.ReplaceAllStringFunc(statement, func(placeholder string) string {
+		if value, ok := credentials[placeholder]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+/*
+ * The key is derived from the contents of the key file, so that any secret,
+ * such as a passphrase or random bytes, can be used as the key file.
+ */
+func ReadCredentialsKey(keyFilename string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(keyFilename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read credentials key file %s", keyFilename)
+	}
+	if len(strings.TrimSpace(string(contents))) == 0 {
+		return nil, errors.Errorf("Credentials key file %s is empty", keyFilename)
+	}
+	key := sha256.Sum256(contents)
+	return key[:], nil
+}
+
+/*
+ * The credentials are encrypted with AES-256-GCM, with the nonce written
+ * before the encrypted credentials.
+ */
+func WriteCredentialsFile(filename string, credentials map[string]string, key []byte) error {
+	contents, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	gcm, err := newCredentialsCipher(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	encrypted := gcm.Seal(nonce, nonce, contents, nil)
+	return ioutil.WriteFile(filename, encrypted, 0600)
+}
+
+func ReadCredentialsFile(filename string, key []byte) (map[string]string, error) {
+	encrypted, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read credentials file %s", filename)
+	}
+	gcm, err := newCredentialsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted) < gcm.NonceSize() {
+		return nil, errors.Errorf("Credentials file %s is truncated", filename)
+	}
+	nonce, encrypted := encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():]
+	contents, err := gcm.Open(nil, nonce, encrypted, nil)
+	if err != nil {
+		return nil, errors.Errorf("Unable to decrypt credentials file %s; check that the key file is the one used for the backup", filename)
+	}
+	credentials := make(map[string]string)
+	err = json.Unmarshal(contents, &credentials)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse credentials file %s", filename)
+	}
+	return credentials, nil
+}
+
+func newCredentialsCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
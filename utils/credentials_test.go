@@ -0,0 +1,105 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/credentials tests", func() {
+	Describe("IsCredentialOption", func() {
+		It("matches options that hold credentials", func() {
+			for _, name := range []string{"password", `"PASSWORD"`, "aws_secret_key", "access_key_id", "pwd", "auth_token"} {
+				Expect(utils.IsCredentialOption(name)).To(BeTrue(), name)
+			}
+		})
+		It("does not match other options", func() {
+			for _, name := range []string{"host", "dbname", "user", "port", "pwd_hint"} {
+				Expect(utils.IsCredentialOption(name)).To(BeFalse(), name)
+			}
+		})
+	})
+	Describe("RedactCredentialOptions", func() {
+		var credentials map[string]string
+		BeforeEach(func() {
+			credentials = make(map[string]string)
+		})
+		It("replaces the values of credential options with placeholders", func() {
+			redacted := utils.RedactCredentialOptions("host 'localhost', password 'secret', user 'admin'", credentials)
+
+			Expect(redacted).To(Equal("host 'localhost', password 'gpbackup_redacted_credential_1', user 'admin'"))
+			Expect(credentials).To(Equal(map[string]string{"'gpbackup_redacted_credential_1'": "'secret'"}))
+		})
+		It("handles doubled quotes, escape strings, and quoted option names", func() {
+			redacted := utils.RedactCredentialOptions(`"Password" 'it''s, secret', secret_key E'a\\'' b', dbname 'db'`, credentials)
+
+			Expect(redacted).To(Equal(`"Password" 'gpbackup_redacted_credential_1', secret_key 'gpbackup_redacted_credential_2', dbname 'db'`))
+			Expect(credentials["'gpbackup_redacted_credential_1'"]).To(Equal(`'it''s, secret'`))
+			Expect(credentials["'gpbackup_redacted_credential_2'"]).To(Equal(`E'a\\'' b'`))
+		})
+		It("leaves an option list that cannot be parsed unchanged", func() {
+			Expect(utils.RedactCredentialOptions("password secret", credentials)).To(Equal("password secret"))
+			Expect(credentials).To(BeEmpty())
+		})
+	})
+	Describe("RestoreCredentials", func() {
+		It("replaces placeholders with their credentials", func() {
+			statement := "CREATE USER MAPPING FOR admin SERVER srv OPTIONS (user 'admin', password 'gpbackup_redacted_credential_1');"
+			credentials := map[string]string{"'gpbackup_redacted_credential_1'": "'it''s'"}
+
+			Expect(utils.RestoreCredentials(statement, credentials)).To(Equal("CREATE USER MAPPING FOR admin SERVER srv OPTIONS (user 'admin', password 'it''s');"))
+		})
+		It("leaves placeholders without a credential in place", func() {
+			statement := "CREATE SERVER srv FOREIGN DATA WRAPPER fdw OPTIONS (password 'gpbackup_redacted_credential_2');"
+
+			Expect(utils.RestoreCredentials(statement, map[string]string{})).To(Equal(statement))
+		})
+	})
+	Describe("credentials file", func() {
+		var tempDir string
+		var keyFilename, credentialsFilename string
+		BeforeEach(func() {
+			tempDir, _ = ioutil.TempDir("", "credentials")
+			keyFilename = path.Join(tempDir, "key")
+			credentialsFilename = path.Join(tempDir, "gpbackup_20170101010101_credentials.enc")
+			_ = ioutil.WriteFile(keyFilename, []byte("passphrase\n"), 0600)
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(tempDir)
+		})
+		It("reads back the credentials it writes", func() {
+			credentials := map[string]string{"'gpbackup_redacted_credential_1'": "'secret'"}
+			key, err := utils.ReadCredentialsKey(keyFilename)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = utils.WriteCredentialsFile(credentialsFilename, credentials, key)
+			Expect(err).ToNot(HaveOccurred())
+			contents, _ := ioutil.ReadFile(credentialsFilename)
+			Expect(string(contents)).ToNot(ContainSubstring("secret"))
+
+			readCredentials, err := utils.ReadCredentialsFile(credentialsFilename, key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readCredentials).To(Equal(credentials))
+		})
+		It("fails to read the credentials with a different key", func() {
+			key, _ := utils.ReadCredentialsKey(keyFilename)
+			_ = utils.WriteCredentialsFile(credentialsFilename, map[string]string{"'gpbackup_redacted_credential_1'": "'secret'"}, key)
+			_ = ioutil.WriteFile(keyFilename, []byte("other passphrase\n"), 0600)
+			otherKey, _ := utils.ReadCredentialsKey(keyFilename)
+
+			_, err := utils.ReadCredentialsFile(credentialsFilename, otherKey)
+			Expect(err).To(MatchError(ContainSubstring("Unable to decrypt credentials file")))
+		})
+		It("rejects an empty key file", func() {
+			_ = ioutil.WriteFile(keyFilename, []byte("\n"), 0600)
+
+			_, err := utils.ReadCredentialsKey(keyFilename)
+			Expect(err).To(MatchError(ContainSubstring("is empty")))
+		})
+	})
+})
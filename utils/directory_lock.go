@@ -0,0 +1,258 @@
+package utils
+
+/*
+ * This file contains structs and functions for the lock file that keeps two
+ * runs of gpbackup from writing to the same backup directory at once.  The
+ * file records which process holds the lock, and the holder rewrites it
+ * periodically as a heartbeat, so that a lock left behind by a process that
+ * was killed or whose host went down can be detected and taken over.
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	DirectoryLockFilename = "gpbackup.lock"
+	// A lock whose heartbeat is older than this is considered abandoned
+	DirectoryLockStaleAfter = time.Minute
+)
+
+var (
+	directoryLockHeartbeatInterval = 10 * time.Second
+	directoryLockRetryInterval     = 5 * time.Second
+)
+
+type DirectoryLockHolder struct {
+	Utility   string `yaml:"utility"`
+	Timestamp string `yaml:"timestamp"`
+	Host      string `yaml:"host"`
+	Pid       int    `yaml:"pid"`
+	StartTime string `yaml:"start_time"`
+	Heartbeat string `yaml:"heartbeat"`
+}
+
+type DirectoryLock struct {
+	filename string
+	holder   DirectoryLockHolder
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+}
+
+func (holder DirectoryLockHolder) String() string {
+	startTime := holder.StartTime
+	if parsedTime, err := time.ParseInLocation("20060102150405", holder.StartTime, operating.System.Local); err == nil {
+		startTime = parsedTime.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprintf("%s with timestamp %s (pid %d on host %s, started at %s)", holder.Utility, holder.Timestamp, holder.Pid, holder.Host, startTime)
+}
+
+/*
+ * A lock is stale if its heartbeat has not been updated recently, or if it is
+ * held by a process on this host that no longer exists.
+ */
+func (holder DirectoryLockHolder) IsStale(now time.Time, hostname string, isProcessRunning func(pid int) bool) bool {
+	heartbeat, err := time.ParseInLocation("20060102150405", holder.Heartbeat, operating.System.Local)
+	if err != nil || now.Sub(heartbeat) > DirectoryLockStaleAfter {
+		return true
+	}
+	return holder.Host == hostname && !isProcessRunning(holder.Pid)
+}
+
+func ReadDirectoryLockHolder(filename string) (DirectoryLockHolder, error) {
+	holder := DirectoryLockHolder{}
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return holder, err
+	}
+	err = yaml.Unmarshal(contents, &holder)
+	return holder, err
+}
+
+/*
+ * Takes the lock on the backup directory, waiting up to wait for the process
+ * holding it to finish, and taking over a stale lock.  Returns an error
+ * describing the holder if the lock could not be taken.
+ */
+func AcquireDirectoryLock(directory string, utility string, timestamp string, wait time.Duration) (*DirectoryLock, error) {
+	hostname, err := operating.System.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	lock := &DirectoryLock{
+		filename: fmt.Sprintf("%s/%s", directory, DirectoryLockFilename),
+		holder: DirectoryLockHolder{
+			Utility:   utility,
+			Timestamp: timestamp,
+			Host:      hostname,
+			Pid:       operating.System.Getpid(),
+			StartTime: operating.System.Now().Format("20060102150405"),
+		},
+		stop: make(chan struct{}),
+	}
+	deadline := operating.System.Now().Add(wait)
+	waiting := false
+	for {
+		created, err := lock.tryCreate()
+		if err != nil {
+			return nil, err
+		} else if created {
+			break
+		}
+		holder, err := ReadDirectoryLockHolder(lock.filename)
+		if os.IsNotExist(err) {
+			// The holder released the lock after we tried to create it
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read lock file %s", lock.filename)
+		}
+		if holder.IsStale(operating.System.Now(), hostname, isProcessRunning) {
+			gplog.Warn("Removing stale lock on backup directory %s held by %s", directory, holder)
+			err = RemoveStaleDirectoryLock(lock.filename, holder)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Unable to remove stale lock file %s", lock.filename)
+			}
+			continue
+		}
+		if !operating.System.Now().Before(deadline) {
+			return nil, errors.Errorf("Backup directory %s is in use by %s.  Wait for it to finish and try again.", directory, holder)
+		}
+		if !waiting {
+			gplog.Info("Waiting for %s to finish using backup directory %s", holder, directory)
+			waiting = true
+		}
+		time.Sleep(directoryLockRetryInterval)
+	}
+	lock.startHeartbeat()
+	return lock, nil
+}
+
+/*
+ * Another process waiting for the lock may have removed the same stale lock
+ * file and taken the lock since staleHolder was read from it, so the lock
+ * file is moved aside and removed only if it still names staleHolder.  The
+ * lock file of a process that took the lock in the meantime is moved back.
+ */
+func RemoveStaleDirectoryLock(filename string, staleHolder DirectoryLockHolder) error {
+	asideFilename := fmt.Sprintf("%s.%d.stale", filename, operating.System.Getpid())
+	err := os.Rename(filename, asideFilename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer os.Remove(asideFilename)
+	holder, err := ReadDirectoryLockHolder(asideFilename)
+	if err == nil && holder == staleHolder {
+		return nil
+	}
+	err = os.Link(asideFilename, filename)
+	if os.IsExist(err) {
+		// The process that took the lock already replaced the file with its heartbeat
+		return nil
+	}
+	return err
+}
+
+/*
+ * The lock file is written under a temporary name and linked into place,
+ * which fails if the lock file exists, so that only one process can take the
+ * lock even if several find the directory unlocked at once, and the lock file
+ * is never seen half written.
+ */
+func (lock *DirectoryLock) tryCreate() (bool, error) {
+	tempFilename, err := lock.writeTempFile()
+	if err != nil {
+		return false, errors.Wrapf(err, "Unable to create lock file %s", lock.filename)
+	}
+	defer os.Remove(tempFilename)
+	err = os.Link(tempFilename, lock.filename)
+	if os.IsExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "Unable to create lock file %s", lock.filename)
+	}
+	return true, nil
+}
+
+func (lock *DirectoryLock) writeTempFile() (string, error) {
+	lock.holder.Heartbeat = operating.System.Now().Format("20060102150405")
+	contents, err := yaml.Marshal(lock.holder)
+	if err != nil {
+		return "", err
+	}
+	tempFilename := fmt.Sprintf("%s.%d.tmp", lock.filename, lock.holder.Pid)
+	return tempFilename, ioutil.WriteFile(tempFilename, contents, 0644)
+}
+
+func (lock *DirectoryLock) startHeartbeat() {
+	lock.stopped.Add(1)
+	go func() {
+		defer lock.stopped.Done()
+		ticker := time.NewTicker(directoryLockHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-lock.stop:
+				return
+			case <-ticker.C:
+				if !lock.writeHeartbeat() {
+					return
+				}
+			}
+		}
+	}()
+}
+
+/*
+ * The file is replaced rather than rewritten, so it is never read half
+ * written.  If another process took over the lock because the heartbeat was
+ * not updated in time, the heartbeat stops rather than replace its lock.
+ */
+func (lock *DirectoryLock) writeHeartbeat() bool {
+	holder, err := ReadDirectoryLockHolder(lock.filename)
+	if err == nil && (holder.Host != lock.holder.Host || holder.Pid != lock.holder.Pid) {
+		gplog.Warn("The lock file %s was taken over by %s", lock.filename, holder)
+		return false
+	}
+	tempFilename, err := lock.writeTempFile()
+	if err == nil {
+		err = os.Rename(tempFilename, lock.filename)
+	}
+	if err != nil {
+		gplog.Verbose("Unable to update lock file %s: %v", lock.filename, err)
+	}
+	return true
+}
+
+/*
+ * Removes the lock file, unless another process has taken over the lock
+ * because this one stopped updating its heartbeat.  May be called on a nil
+ * lock and more than once.
+ */
+func (lock *DirectoryLock) Release() {
+	if lock == nil || lock.stop == nil {
+		return
+	}
+	close(lock.stop)
+	lock.stopped.Wait()
+	lock.stop = nil
+	holder, err := ReadDirectoryLockHolder(lock.filename)
+	if err != nil || holder.Host != lock.holder.Host || holder.Pid != lock.holder.Pid {
+		return
+	}
+	err = os.Remove(lock.filename)
+	if err != nil && !os.IsNotExist(err) {
+		gplog.Warn("Unable to remove lock file %s: %v", lock.filename, err)
+	}
+}
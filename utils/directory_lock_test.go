@@ -0,0 +1,101 @@
+package utils_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/directory_lock tests", func() {
+	Describe("IsStale", func() {
+		now := time.Date(2017, 1, 1, 1, 1, 1, 0, time.Local)
+		isRunning := func(pid int) bool { return pid == 1234 }
+		It("is not stale with a recent heartbeat from a running process", func() {
+			holder := utils.DirectoryLockHolder{Host: "mdw", Pid: 1234, Heartbeat: "20170101010031"}
+			Expect(holder.IsStale(now, "mdw", isRunning)).To(BeFalse())
+		})
+		It("is stale with an old heartbeat", func() {
+			holder := utils.DirectoryLockHolder{Host: "smdw", Pid: 1234, Heartbeat: "20170101005901"}
+			Expect(holder.IsStale(now, "mdw", isRunning)).To(BeTrue())
+		})
+		It("is stale if the process holding it on this host is gone", func() {
+			holder := utils.DirectoryLockHolder{Host: "mdw", Pid: 5678, Heartbeat: "20170101010031"}
+			Expect(holder.IsStale(now, "mdw", isRunning)).To(BeTrue())
+		})
+		It("is not stale if a process on another host has a recent heartbeat", func() {
+			holder := utils.DirectoryLockHolder{Host: "smdw", Pid: 5678, Heartbeat: "20170101010031"}
+			Expect(holder.IsStale(now, "mdw", isRunning)).To(BeFalse())
+		})
+	})
+	Describe("AcquireDirectoryLock", func() {
+		var directory string
+		BeforeEach(func() {
+			var err error
+			directory, err = ioutil.TempDir("/tmp", "gpbackup_test_lock")
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(directory)
+		})
+		It("rejects a second run while the directory is locked, and allows it once the lock is released", func() {
+			lock, err := utils.AcquireDirectoryLock(directory, "gpbackup", "20170101010101", 0)
+			Expect(err).ToNot(HaveOccurred())
+			holder, err := utils.ReadDirectoryLockHolder(directory + "/gpbackup.lock")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(holder.Pid).To(Equal(os.Getpid()))
+			Expect(holder.Timestamp).To(Equal("20170101010101"))
+
+			_, err = utils.AcquireDirectoryLock(directory, "gpbackup", "20170101010102", 0)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix(fmt.Sprintf("Backup directory %s is in use by gpbackup with timestamp 20170101010101 (pid %d", directory, os.Getpid())))
+
+			lock.Release()
+			Expect(directory + "/gpbackup.lock").ToNot(BeAnExistingFile())
+			lock, err = utils.AcquireDirectoryLock(directory, "gpbackup", "20170101010102", 0)
+			Expect(err).ToNot(HaveOccurred())
+			lock.Release()
+		})
+		It("takes over a lock whose heartbeat stopped", func() {
+			staleLock := "utility: gpbackup\ntimestamp: \"20170101010101\"\nhost: otherhost\npid: 1234\nstart_time: \"20170101010101\"\nheartbeat: \"20170101010101\"\n"
+			Expect(ioutil.WriteFile(directory+"/gpbackup.lock", []byte(staleLock), 0644)).To(Succeed())
+
+			lock, err := utils.AcquireDirectoryLock(directory, "gpbackup", "20170101010102", 0)
+
+			Expect(err).ToNot(HaveOccurred())
+			holder, err := utils.ReadDirectoryLockHolder(directory + "/gpbackup.lock")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(holder.Timestamp).To(Equal("20170101010102"))
+			lock.Release()
+		})
+		It("does not remove a lock taken by another process after the stale lock was read", func() {
+			staleHolder := utils.DirectoryLockHolder{Utility: "gpbackup", Timestamp: "20170101010101", Host: "otherhost", Pid: 1234, StartTime: "20170101010101", Heartbeat: "20170101010101"}
+			freshLock := "utility: gpbackup\ntimestamp: \"20170101010102\"\nhost: otherhost\npid: 5678\nstart_time: \"20170101010102\"\nheartbeat: \"20170101010102\"\n"
+			Expect(ioutil.WriteFile(directory+"/gpbackup.lock", []byte(freshLock), 0644)).To(Succeed())
+
+			err := utils.RemoveStaleDirectoryLock(directory+"/gpbackup.lock", staleHolder)
+
+			Expect(err).ToNot(HaveOccurred())
+			holder, err := utils.ReadDirectoryLockHolder(directory + "/gpbackup.lock")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(holder.Pid).To(Equal(5678))
+			files, _ := ioutil.ReadDir(directory)
+			Expect(files).To(HaveLen(1))
+		})
+		It("does not remove a lock taken over by another process", func() {
+			lock, err := utils.AcquireDirectoryLock(directory, "gpbackup", "20170101010101", 0)
+			Expect(err).ToNot(HaveOccurred())
+			otherLock := "utility: gpbackup\ntimestamp: \"20170101010102\"\nhost: otherhost\npid: 1234\n"
+			Expect(ioutil.WriteFile(directory+"/gpbackup.lock", []byte(otherLock), 0644)).To(Succeed())
+
+			lock.Release()
+
+			Expect(directory + "/gpbackup.lock").To(BeAnExistingFile())
+		})
+	})
+})
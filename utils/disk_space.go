@@ -0,0 +1,131 @@
+package utils
+
+/*
+ * This file contains functions for checking that the segment hosts have
+ * enough free space for a backup or restore before it starts, so that it
+ * fails right away with the hosts that are short of space instead of hours
+ * in when a disk fills up.
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/pkg/errors"
+)
+
+/*
+ * The free space of the filesystem holding the directory of a segment.
+ * Several segments on a host may share one filesystem.
+ */
+type FreeSpace struct {
+	MountPoint string
+	Available  int64
+}
+
+/*
+ * The space required and available on one filesystem of a segment host.
+ */
+type DiskSpaceCheck struct {
+	Host       string
+	MountPoint string
+	Required   int64
+	Available  int64
+}
+
+func (check DiskSpaceCheck) Shortfall() int64 {
+	return check.Required - check.Available
+}
+
+/*
+ * Parses the output of "df -Pk" for a single directory, whose last line holds
+ * the filesystem, its size, used, and available kilobytes, its capacity, and
+ * its mount point.
+ */
+func ParseFreeSpace(output string) (FreeSpace, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 6 {
+		return FreeSpace{}, errors.Errorf("Invalid df output: %s", output)
+	}
+	available, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return FreeSpace{}, errors.Errorf("Invalid df output: %s", output)
+	}
+	return FreeSpace{MountPoint: strings.Join(fields[5:], " "), Available: available * 1024}, nil
+}
+
+/*
+ * Returns the free space of the directory of each segment, keyed by content.
+ * Segments whose free space cannot be checked are left out with a warning,
+ * as the check must not keep a backup or restore from running.
+ */
+func GetFreeSpaceOnSegments(c *cluster.Cluster, dirForContent func(int) string) map[int]FreeSpace {
+	remoteOutput := c.GenerateAndExecuteCommand("Checking free space on segment hosts", cluster.ON_SEGMENTS, func(contentID int) string {
+		return fmt.Sprintf("df -Pk %s", dirForContent(contentID))
+	})
+
+	freeSpace := make(map[int]FreeSpace)
+	for _, command := range remoteOutput.Commands {
+		if command.Error != nil {
+			gplog.Warn("Unable to check free space of %s on segment %d on host %s: %s", dirForContent(command.Content), command.Content, command.Host, strings.TrimSpace(command.Stderr))
+			continue
+		}
+		segmentFreeSpace, err := ParseFreeSpace(command.Stdout)
+		if err != nil {
+			gplog.Warn("Unable to check free space of %s on segment %d on host %s: %v", dirForContent(command.Content), command.Content, command.Host, err)
+			continue
+		}
+		freeSpace[command.Content] = segmentFreeSpace
+	}
+	return freeSpace
+}
+
+/*
+ * Adds up the space required by the segments that share each filesystem of
+ * each host, and returns the filesystems without enough free space, sorted by
+ * host and mount point.
+ */
+func GetDiskSpaceShortfalls(c *cluster.Cluster, freeSpace map[int]FreeSpace, required map[int]int64) []DiskSpaceCheck {
+	checks := make(map[string]*DiskSpaceCheck)
+	for contentID, segmentFreeSpace := range freeSpace {
+		host := c.GetHostForContent(contentID)
+		key := host + ":" + segmentFreeSpace.MountPoint
+		if _, ok := checks[key]; !ok {
+			checks[key] = &DiskSpaceCheck{Host: host, MountPoint: segmentFreeSpace.MountPoint, Available: segmentFreeSpace.Available}
+		}
+		checks[key].Required += required[contentID]
+	}
+
+	shortfalls := make([]DiskSpaceCheck, 0)
+	for _, check := range checks {
+		if check.Shortfall() > 0 {
+			shortfalls = append(shortfalls, *check)
+		}
+	}
+	sort.Slice(shortfalls, func(i int, j int) bool {
+		if shortfalls[i].Host != shortfalls[j].Host {
+			return shortfalls[i].Host < shortfalls[j].Host
+		}
+		return shortfalls[i].MountPoint < shortfalls[j].MountPoint
+	})
+	return shortfalls
+}
+
+func FormatDiskSpaceShortfalls(shortfalls []DiskSpaceCheck) string {
+	var buffer bytes.Buffer
+	tabWriter := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tabWriter, "HOST\tFILESYSTEM\tREQUIRED\tAVAILABLE\tSHORTFALL")
+	for _, check := range shortfalls {
+		_, _ = fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\n", check.Host, check.MountPoint,
+			FormatSize(check.Required), FormatSize(check.Available), FormatSize(check.Shortfall()))
+	}
+	_ = tabWriter.Flush()
+	return strings.TrimRight(buffer.String(), "\n")
+}
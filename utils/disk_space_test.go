@@ -0,0 +1,72 @@
+package utils_test
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/disk_space tests", func() {
+	Describe("ParseFreeSpace", func() {
+		It("parses the available space and mount point of the last line of df output", func() {
+			output := `Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/sdb1        103081248 52428800  50652448      51% /data backups
+`
+			freeSpace, err := utils.ParseFreeSpace(output)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(freeSpace).To(Equal(utils.FreeSpace{MountPoint: "/data backups", Available: 50652448 * 1024}))
+		})
+		It("returns an error if the output cannot be parsed", func() {
+			_, err := utils.ParseFreeSpace("df: /data: No such file or directory")
+			Expect(err).To(MatchError("Invalid df output: df: /data: No such file or directory"))
+		})
+	})
+	Describe("GetDiskSpaceShortfalls", func() {
+		var testCluster *cluster.Cluster
+		BeforeEach(func() {
+			testCluster = cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"},
+				{ContentID: 0, Hostname: "host1", DataDir: "/data/gpseg0"},
+				{ContentID: 1, Hostname: "host1", DataDir: "/data/gpseg1"},
+				{ContentID: 2, Hostname: "host2", DataDir: "/data/gpseg2"},
+			})
+		})
+		It("adds up the space required by the segments sharing a filesystem", func() {
+			freeSpace := map[int]utils.FreeSpace{
+				0: {MountPoint: "/data", Available: 150},
+				1: {MountPoint: "/data", Available: 150},
+				2: {MountPoint: "/data", Available: 150},
+			}
+			required := map[int]int64{0: 100, 1: 100, 2: 100}
+			shortfalls := utils.GetDiskSpaceShortfalls(testCluster, freeSpace, required)
+			Expect(shortfalls).To(Equal([]utils.DiskSpaceCheck{{Host: "host1", MountPoint: "/data", Required: 200, Available: 150}}))
+			Expect(shortfalls[0].Shortfall()).To(Equal(int64(50)))
+		})
+		It("checks segments on separate filesystems of a host separately", func() {
+			freeSpace := map[int]utils.FreeSpace{
+				0: {MountPoint: "/data1", Available: 150},
+				1: {MountPoint: "/data2", Available: 50},
+				2: {MountPoint: "/data", Available: 150},
+			}
+			required := map[int]int64{0: 100, 1: 100, 2: 100}
+			shortfalls := utils.GetDiskSpaceShortfalls(testCluster, freeSpace, required)
+			Expect(shortfalls).To(Equal([]utils.DiskSpaceCheck{{Host: "host1", MountPoint: "/data2", Required: 100, Available: 50}}))
+		})
+		It("skips segments whose free space could not be checked", func() {
+			freeSpace := map[int]utils.FreeSpace{2: {MountPoint: "/data", Available: 150}}
+			required := map[int]int64{0: 100, 1: 100, 2: 100}
+			Expect(utils.GetDiskSpaceShortfalls(testCluster, freeSpace, required)).To(BeEmpty())
+		})
+	})
+	Describe("FormatDiskSpaceShortfalls", func() {
+		It("formats a table of the filesystems without enough free space", func() {
+			shortfalls := []utils.DiskSpaceCheck{
+				{Host: "host1", MountPoint: "/data", Required: 3 * 1024 * 1024 * 1024, Available: 1024 * 1024 * 1024},
+			}
+			Expect(utils.FormatDiskSpaceShortfalls(shortfalls)).To(Equal(`HOST   FILESYSTEM  REQUIRED  AVAILABLE  SHORTFALL
+host1  /data       3.0 GB    1.0 GB     2.0 GB`))
+		})
+	})
+})
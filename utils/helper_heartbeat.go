@@ -0,0 +1,141 @@
+package utils
+
+/*
+ * This file contains functions for checking on the gpbackup_helper agents of
+ * a single data file backup through the heartbeat files they write, and for
+ * restarting agents that died.
+ */
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+)
+
+const (
+	HELPER_RUNNING      = "running"
+	HELPER_STOPPED      = "stopped"
+	HELPER_UNRESPONSIVE = "unresponsive"
+	HELPER_ERROR        = "error"
+)
+
+type HelperHeartbeat struct {
+	ContentID int
+	Status    string
+	Oid       uint32
+}
+
+/*
+ * A helper died if its process is gone without having cleaned up after
+ * itself, or it stopped updating its heartbeat.  A helper that reported an
+ * error is not dead, as it exited on its own.
+ */
+func (heartbeat HelperHeartbeat) IsDead() bool {
+	return heartbeat.Status == HELPER_STOPPED || heartbeat.Status == HELPER_UNRESPONSIVE
+}
+
+/*
+ * Parses the output of the heartbeat check of one segment, which is empty if
+ * the helper has no heartbeat file, "error" if it left an error file, and
+ * otherwise whether its process is running, the age of its heartbeat in
+ * seconds, and the oid of the table it is working on.
+ */
+func ParseHelperHeartbeat(output string, timeout int) (string, uint32) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return "", 0
+	}
+	if fields[0] == HELPER_ERROR {
+		return HELPER_ERROR, 0
+	}
+	if len(fields) != 3 {
+		return "", 0
+	}
+	age, ageErr := strconv.Atoi(fields[1])
+	oid, oidErr := strconv.ParseUint(fields[2], 10, 32)
+	if ageErr != nil || oidErr != nil {
+		return "", 0
+	}
+	if fields[0] == HELPER_STOPPED {
+		return HELPER_STOPPED, uint32(oid)
+	}
+	if fields[0] == HELPER_RUNNING && age > timeout {
+		return HELPER_UNRESPONSIVE, uint32(oid)
+	}
+	return HELPER_RUNNING, uint32(oid)
+}
+
+/*
+ * Returns the heartbeat of each helper that has a heartbeat or error file.
+ * The heartbeat file is checked again if the process is gone, as a helper
+ * that finishes removes the file just before it exits.  Segments that cannot
+ * be checked are skipped, as the COPY to them fails on its own.
+ */
+func CheckHelperHeartbeatsOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo, timeout int) []HelperHeartbeat {
+	remoteOutput := c.GenerateAndExecuteCommand("Checking heartbeats of segment agents", cluster.ON_SEGMENTS, func(contentID int) string {
+		pipeFile := fpInfo.GetSegmentPipeFilePath(contentID)
+		heartbeatFile := fmt.Sprintf("%s_heartbeat", pipeFile)
+		return fmt.Sprintf(`STATE=; if [[ -f %[1]s_error ]]; then echo %[3]s; elif read PID OID 2>/dev/null < %[2]s; then if kill -0 $PID 2>/dev/null; then STATE=%[4]s; elif [[ -f %[2]s ]]; then STATE=%[5]s; fi; fi; if [[ -n "$STATE" ]]; then echo $STATE $(( $(date +%%s) - $(stat -c %%Y %[2]s 2>/dev/null || date +%%s) )) $OID; fi`,
+			pipeFile, heartbeatFile, HELPER_ERROR, HELPER_RUNNING, HELPER_STOPPED)
+	})
+
+	heartbeats := make([]HelperHeartbeat, 0)
+	for _, command := range remoteOutput.Commands {
+		if command.Error != nil {
+			gplog.Verbose("Unable to check heartbeat of helper agent on segment %d: %s", command.Content, command.Stderr)
+			continue
+		}
+		status, oid := ParseHelperHeartbeat(command.Stdout, timeout)
+		if status != "" {
+			heartbeats = append(heartbeats, HelperHeartbeat{ContentID: command.Content, Status: status, Oid: oid})
+		}
+	}
+	return heartbeats
+}
+
+/*
+ * A COPY to a segment whose helper died before opening the pipe of the table
+ * waits on the pipe forever, so the pipes left on the segment are read and
+ * discarded to let the COPY finish.  The readers give up after a while in
+ * case nothing writes to a pipe.
+ */
+func DrainSegmentPipes(c *cluster.Cluster, fpInfo filepath.FilePathInfo, heartbeats []HelperHeartbeat) {
+	drainContents := make(map[int]bool)
+	for _, heartbeat := range heartbeats {
+		drainContents[heartbeat.ContentID] = true
+	}
+	remoteOutput := c.GenerateAndExecuteCommand("Draining segment data pipes of dead agents", cluster.ON_SEGMENTS, func(contentID int) string {
+		if !drainContents[contentID] {
+			return "true"
+		}
+		return fmt.Sprintf("for PIPE in %s_[0-9]*; do if [[ -p $PIPE ]]; then ( nohup timeout 300 cat $PIPE &> /dev/null &); fi; done", fpInfo.GetSegmentPipeFilePath(contentID))
+	})
+	c.CheckClusterError(remoteOutput, "Unable to drain segment data pipes", func(contentID int) string {
+		return "Unable to drain segment data pipes"
+	}, true)
+}
+
+/*
+ * Kills the helpers on all segments and removes their pipes and heartbeat and
+ * error files, so that they can be started again to resume from their
+ * checkpoints.  The helpers are killed outright, as a helper that stopped
+ * responding may not handle a termination signal.
+ */
+func StopGpbackupHelpersForRestart(c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
+	helperMutex.Lock()
+	defer helperMutex.Unlock()
+
+	remoteOutput := c.GenerateAndExecuteCommand("Stopping segment agent processes for restart", cluster.ON_SEGMENTS, func(contentID int) string {
+		tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
+		pipeFile := fpInfo.GetSegmentPipeFilePath(contentID)
+		procPattern := fmt.Sprintf("gpbackup_helper --backup-agent --toc-file %s", tocFile)
+		return fmt.Sprintf("PIDS=`ps ux | grep \"%s\" | grep -v grep | awk '{print $2}'`; if [[ ! -z \"$PIDS\" ]]; then kill -9 $PIDS; fi; rm -f %[2]s_[0-9]* %[2]s_error %[2]s_heartbeat %[2]s_heartbeat.tmp", procPattern, pipeFile)
+	})
+	c.CheckClusterError(remoteOutput, "Unable to stop agent processes for restart", func(contentID int) string {
+		return "Unable to stop agent process for restart"
+	})
+}
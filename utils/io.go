@@ -6,10 +6,12 @@ package utils
  */
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 )
@@ -86,6 +88,25 @@ func (file *FileWithByteCount) MustPrint(s string) {
 	file.ByteCount += uint64(bytesWritten)
 }
 
+/*
+ * Reads the answer to a yes or no question.  Any answer other than yes is
+ * taken as no.
+ */
+func Confirm(input io.Reader) bool {
+	answer, _ := bufio.NewReader(input).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+/*
+ * Questions are only asked when stdin is a terminal, so that a run from a
+ * script or scheduler never waits for an answer.
+ */
+func IsInteractive() bool {
+	fileInfo, err := os.Stdin.Stat()
+	return err == nil && fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
 func CopyFile(src, dest string) error {
 	info, err := os.Stat(src)
 	if err == nil {
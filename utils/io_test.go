@@ -3,6 +3,7 @@ package utils_test
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
@@ -49,6 +50,17 @@ var _ = Describe("utils/io tests", func() {
 			file.MustPrintf("message")
 		})
 	})
+	Describe("Confirm", func() {
+		It("accepts yes", func() {
+			Expect(utils.Confirm(strings.NewReader("y\n"))).To(BeTrue())
+			Expect(utils.Confirm(strings.NewReader(" Yes \n"))).To(BeTrue())
+		})
+		It("rejects any other answer", func() {
+			Expect(utils.Confirm(strings.NewReader("\n"))).To(BeFalse())
+			Expect(utils.Confirm(strings.NewReader("no\n"))).To(BeFalse())
+			Expect(utils.Confirm(strings.NewReader(""))).To(BeFalse())
+		})
+	})
 	Describe("CopyFile", func() {
 		var sourceFilePath = "/tmp/test_file.txt"
 		var destFilePath = "/tmp/dest_test_file.txt"
@@ -0,0 +1,143 @@
+package utils
+
+/*
+ * This file contains structs and functions for --jobs auto, which picks the
+ * number of parallel connections from the size of the cluster and the
+ * resource settings of the database instead of requiring a fixed number.
+ */
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/pkg/errors"
+)
+
+const (
+	JobsAuto = "auto"
+
+	// The number of COPY processes that the automatic job count aims to run at
+	// once on each segment host, as each job runs one process per segment.
+	autoJobsProcessesPerHost = 16
+	autoJobsMin              = 2
+	autoJobsMax              = 32
+)
+
+/*
+ * Returns the number of jobs in a --jobs value, or 0 if the value is "auto".
+ */
+func ParseJobs(value string) (int, error) {
+	if value == JobsAuto {
+		return 0, nil
+	}
+	jobs, err := strconv.Atoi(value)
+	if err != nil || jobs < 1 {
+		return 0, errors.Errorf(`Invalid value %s for --jobs.  Must be a positive integer or "auto".`, value)
+	}
+	return jobs, nil
+}
+
+/*
+ * ConcurrencyLimit is the number of statements that the resource group or
+ * resource queue of the current user may run at once, and
+ * ConnectionsAvailable is the number of connections left under
+ * max_connections on the master.  Either is -1 if there is no limit.
+ */
+type ClusterCapacity struct {
+	NumHosts             int
+	MaxSegmentsPerHost   int
+	ConcurrencyLimit     int
+	ConnectionsAvailable int
+}
+
+/*
+ * The job count starts from enough jobs to run autoJobsProcessesPerHost COPY
+ * processes on the busiest host, plus one job for every four hosts, as the
+ * data of each table is spread more thinly across larger clusters.  That
+ * count is kept between autoJobsMin and autoJobsMax, and is then lowered to
+ * fit the concurrency limit of the user and half of the free connections, so
+ * that the jobs do not queue behind each other or lock out other sessions.
+ */
+func ComputeAutoJobs(capacity ClusterCapacity) int {
+	jobs := autoJobsMin
+	if capacity.MaxSegmentsPerHost > 0 {
+		jobs = autoJobsProcessesPerHost/capacity.MaxSegmentsPerHost + capacity.NumHosts/4
+	}
+	if jobs < autoJobsMin {
+		jobs = autoJobsMin
+	} else if jobs > autoJobsMax {
+		jobs = autoJobsMax
+	}
+	if capacity.ConcurrencyLimit > 0 && jobs > capacity.ConcurrencyLimit {
+		jobs = capacity.ConcurrencyLimit
+	}
+	if capacity.ConnectionsAvailable >= 0 && jobs > capacity.ConnectionsAvailable/2 {
+		jobs = capacity.ConnectionsAvailable / 2
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	return jobs
+}
+
+func GetClusterCapacity(connection *dbconn.DBConn) ClusterCapacity {
+	capacity := ClusterCapacity{ConcurrencyLimit: -1, ConnectionsAvailable: -1}
+
+	hostQuery := `SELECT count(*) AS segments FROM gp_segment_configuration WHERE role = 'p' AND content >= 0 GROUP BY hostname`
+	segmentsPerHost := make([]int, 0)
+	err := connection.Select(&segmentsPerHost, hostQuery)
+	gplog.FatalOnError(err, fmt.Sprintf("Query was: %s", hostQuery))
+	capacity.NumHosts = len(segmentsPerHost)
+	for _, segments := range segmentsPerHost {
+		if segments > capacity.MaxSegmentsPerHost {
+			capacity.MaxSegmentsPerHost = segments
+		}
+	}
+
+	resourceManager := "queue"
+	if connection.Version.AtLeast("5") {
+		resourceManager = dbconn.MustSelectString(connection, "SELECT current_setting('gp_resource_manager') AS string")
+	}
+	var limitQuery string
+	if resourceManager == "group" {
+		limitQuery = `SELECT coalesce(max(c.value::int), -1) AS string
+	FROM pg_roles r
+	JOIN pg_resgroupcapability c ON c.resgroupid = r.rolresgroup
+	WHERE r.rolname = current_user AND c.reslimittype = 1`
+	} else {
+		// Superusers are not held by resource queues
+		limitQuery = `SELECT coalesce(max(CASE WHEN r.rolsuper THEN -1 ELSE q.rsqcountlimit::int END), -1) AS string
+	FROM pg_roles r
+	LEFT JOIN pg_resqueue q ON q.oid = r.rolresqueue
+	WHERE r.rolname = current_user`
+	}
+	capacity.ConcurrencyLimit, err = strconv.Atoi(dbconn.MustSelectString(connection, limitQuery))
+	gplog.FatalOnError(err)
+
+	connectionQuery := `SELECT current_setting('max_connections')::int - (SELECT count(*) FROM pg_stat_activity)::int AS string`
+	capacity.ConnectionsAvailable, err = strconv.Atoi(dbconn.MustSelectString(connection, connectionQuery))
+	gplog.FatalOnError(err)
+
+	return capacity
+}
+
+/*
+ * Returns the number of jobs for a --jobs value, connecting to the database
+ * to pick the number if the value is "auto".
+ */
+func GetNumJobs(value string, dbname string) int {
+	jobs, err := ParseJobs(value)
+	gplog.FatalOnError(err)
+	if jobs > 0 {
+		return jobs
+	}
+	connection := dbconn.NewDBConnFromEnvironment(dbname)
+	connection.MustConnect(1)
+	defer connection.Close()
+	capacity := GetClusterCapacity(connection)
+	jobs = ComputeAutoJobs(capacity)
+	gplog.Info("Using %d jobs for %d segment hosts with up to %d segments per host", jobs, capacity.NumHosts, capacity.MaxSegmentsPerHost)
+	return jobs
+}
@@ -0,0 +1,55 @@
+package utils_test
+
+import (
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/jobs tests", func() {
+	Describe("ParseJobs", func() {
+		It("parses a number of jobs", func() {
+			jobs, err := utils.ParseJobs("4")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(jobs).To(Equal(4))
+		})
+		It("returns 0 for auto", func() {
+			jobs, err := utils.ParseJobs("auto")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(jobs).To(Equal(0))
+		})
+		It("rejects values that are not positive integers", func() {
+			for _, value := range []string{"0", "-2", "four", ""} {
+				_, err := utils.ParseJobs(value)
+				Expect(err).To(MatchError(ContainSubstring("Invalid value %s for --jobs", value)))
+			}
+		})
+	})
+	Describe("ComputeAutoJobs", func() {
+		It("runs enough jobs to keep each host busy", func() {
+			capacity := utils.ClusterCapacity{NumHosts: 2, MaxSegmentsPerHost: 4, ConcurrencyLimit: -1, ConnectionsAvailable: -1}
+			Expect(utils.ComputeAutoJobs(capacity)).To(Equal(4))
+		})
+		It("adds jobs for larger clusters", func() {
+			capacity := utils.ClusterCapacity{NumHosts: 16, MaxSegmentsPerHost: 4, ConcurrencyLimit: -1, ConnectionsAvailable: -1}
+			Expect(utils.ComputeAutoJobs(capacity)).To(Equal(8))
+		})
+		It("keeps the number of jobs between the floor and the cap", func() {
+			capacity := utils.ClusterCapacity{NumHosts: 1, MaxSegmentsPerHost: 24, ConcurrencyLimit: -1, ConnectionsAvailable: -1}
+			Expect(utils.ComputeAutoJobs(capacity)).To(Equal(2))
+			capacity = utils.ClusterCapacity{NumHosts: 200, MaxSegmentsPerHost: 1, ConcurrencyLimit: -1, ConnectionsAvailable: -1}
+			Expect(utils.ComputeAutoJobs(capacity)).To(Equal(32))
+		})
+		It("does not exceed the concurrency limit of the user", func() {
+			capacity := utils.ClusterCapacity{NumHosts: 2, MaxSegmentsPerHost: 2, ConcurrencyLimit: 5, ConnectionsAvailable: -1}
+			Expect(utils.ComputeAutoJobs(capacity)).To(Equal(5))
+		})
+		It("uses no more than half of the free connections, and at least one job", func() {
+			capacity := utils.ClusterCapacity{NumHosts: 2, MaxSegmentsPerHost: 2, ConcurrencyLimit: -1, ConnectionsAvailable: 6}
+			Expect(utils.ComputeAutoJobs(capacity)).To(Equal(3))
+			capacity.ConnectionsAvailable = 1
+			Expect(utils.ComputeAutoJobs(capacity)).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,137 @@
+package utils
+
+/*
+ * This file contains structs and functions for changing the log level of a
+ * running gpbackup or gprestore, by sending it SIGHUP or by writing to its log
+ * level control file, so that a long run can be diagnosed without stopping it.
+ */
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+)
+
+// How often the log level control file is checked
+var LogLevelPollInterval = 5 * time.Second
+
+// The log level names, indexed by gplog verbosity
+var logLevelNames = []string{"quiet", "info", "verbose", "debug"}
+
+/*
+ * The log level only changes what is printed to the terminal, as the log file
+ * always receives debug messages.  All methods may be called on a nil
+ * LogLevelControl.
+ */
+type LogLevelControl struct {
+	procDesc string
+	filename string
+	mutex    sync.Mutex
+}
+
+func NewLogLevelControl(procDesc string) *LogLevelControl {
+	return &LogLevelControl{procDesc: procDesc}
+}
+
+/*
+ * Handles SIGHUP for the life of the process, moving the log level from info
+ * to verbose to debug and back to info, and checks the control file every
+ * LogLevelPollInterval once one is set.  Windows has no SIGHUP, so there the
+ * log level can only be changed with the control file.
+ */
+func InitializeLogLevelHandler(procDesc string) *LogLevelControl {
+	control := NewLogLevelControl(procDesc)
+	signalChan := make(chan os.Signal, 1)
+	if len(logLevelSignals) > 0 {
+		signal.Notify(signalChan, logLevelSignals...)
+	}
+	go func() {
+		ticker := time.NewTicker(LogLevelPollInterval)
+		for {
+			select {
+			case <-signalChan:
+				control.setVerbosity(NextLogVerbosity(gplog.GetVerbosity()), "Received SIGHUP")
+			case <-ticker.C:
+				control.CheckControlFile()
+			}
+		}
+	}()
+	return control
+}
+
+func (control *LogLevelControl) SetControlFile(filename string) {
+	if control == nil {
+		return
+	}
+	control.mutex.Lock()
+	control.filename = filename
+	control.mutex.Unlock()
+	gplog.Verbose("Send SIGHUP or write info, verbose, or debug to %s to change the log level of the %s", filename, control.procDesc)
+}
+
+/*
+ * A control file naming a log level sets that level, and an empty one moves
+ * to the next level as SIGHUP does, so that touching the file is enough.  The
+ * file is removed once read so that it can be written again for the next
+ * change.
+ */
+func (control *LogLevelControl) CheckControlFile() {
+	if control == nil {
+		return
+	}
+	control.mutex.Lock()
+	filename := control.filename
+	control.mutex.Unlock()
+	if filename == "" {
+		return
+	}
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			gplog.Warn("Unable to read log level control file %s: %v", filename, err)
+		}
+		return
+	}
+	_ = os.Remove(filename)
+	level := strings.TrimSpace(string(contents))
+	verbosity := NextLogVerbosity(gplog.GetVerbosity())
+	if level != "" {
+		verbosity, err = ParseLogVerbosity(level)
+		if err != nil {
+			gplog.Warn("Ignoring log level control file %s: %v", filename, err)
+			return
+		}
+	}
+	control.setVerbosity(verbosity, "Read log level control file")
+}
+
+func (control *LogLevelControl) setVerbosity(verbosity int, reason string) {
+	gplog.SetVerbosity(verbosity)
+	gplog.Info("%s, changed log level of the %s to %s", reason, control.procDesc, logLevelNames[verbosity])
+}
+
+/*
+ * Quiet moves to info rather than verbose, as a quiet run being diagnosed
+ * needs its info messages as well.
+ */
+func NextLogVerbosity(verbosity int) int {
+	if verbosity < gplog.LOGINFO || verbosity >= gplog.LOGDEBUG {
+		return gplog.LOGINFO
+	}
+	return verbosity + 1
+}
+
+func ParseLogVerbosity(level string) (int, error) {
+	for verbosity, name := range logLevelNames {
+		if strings.EqualFold(level, name) {
+			return verbosity, nil
+		}
+	}
+	return 0, errors.Errorf("Invalid log level '%s'.  Valid log levels are '%s'.", level, strings.Join(logLevelNames, "', '"))
+}
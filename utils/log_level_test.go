@@ -0,0 +1,85 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("utils/log_level tests", func() {
+	Describe("NextLogVerbosity", func() {
+		It("moves from info to verbose to debug and back to info", func() {
+			Expect(utils.NextLogVerbosity(gplog.LOGINFO)).To(Equal(gplog.LOGVERBOSE))
+			Expect(utils.NextLogVerbosity(gplog.LOGVERBOSE)).To(Equal(gplog.LOGDEBUG))
+			Expect(utils.NextLogVerbosity(gplog.LOGDEBUG)).To(Equal(gplog.LOGINFO))
+		})
+		It("moves from quiet to info", func() {
+			Expect(utils.NextLogVerbosity(gplog.LOGERROR)).To(Equal(gplog.LOGINFO))
+		})
+	})
+	Describe("ParseLogVerbosity", func() {
+		It("parses each log level regardless of case", func() {
+			Expect(utils.ParseLogVerbosity("quiet")).To(Equal(gplog.LOGERROR))
+			Expect(utils.ParseLogVerbosity("info")).To(Equal(gplog.LOGINFO))
+			Expect(utils.ParseLogVerbosity("Verbose")).To(Equal(gplog.LOGVERBOSE))
+			Expect(utils.ParseLogVerbosity("DEBUG")).To(Equal(gplog.LOGDEBUG))
+		})
+		It("rejects an unknown log level", func() {
+			_, err := utils.ParseLogVerbosity("trace")
+			Expect(err).To(MatchError("Invalid log level 'trace'.  Valid log levels are 'quiet', 'info', 'verbose', 'debug'."))
+		})
+	})
+	Describe("CheckControlFile", func() {
+		var tempDir string
+		var filename string
+		var control *utils.LogLevelControl
+		BeforeEach(func() {
+			tempDir, _ = ioutil.TempDir("", "log_level")
+			filename = path.Join(tempDir, "gprestore_20170101010101_20170102010101_log_level")
+			control = utils.NewLogLevelControl("restore process")
+			control.SetControlFile(filename)
+			gplog.SetVerbosity(gplog.LOGINFO)
+		})
+		AfterEach(func() {
+			gplog.SetVerbosity(gplog.LOGINFO)
+			_ = os.RemoveAll(tempDir)
+		})
+		It("sets the log level named in the control file and removes it", func() {
+			_ = ioutil.WriteFile(filename, []byte("debug\n"), 0644)
+
+			control.CheckControlFile()
+
+			Expect(gplog.GetVerbosity()).To(Equal(gplog.LOGDEBUG))
+			Expect(filename).ToNot(BeAnExistingFile())
+			Expect(stdout).To(Say("Read log level control file, changed log level of the restore process to debug"))
+		})
+		It("moves to the next log level for an empty control file", func() {
+			_ = ioutil.WriteFile(filename, []byte{}, 0644)
+
+			control.CheckControlFile()
+
+			Expect(gplog.GetVerbosity()).To(Equal(gplog.LOGVERBOSE))
+		})
+		It("leaves the log level unchanged for an invalid control file", func() {
+			_ = ioutil.WriteFile(filename, []byte("trace"), 0644)
+
+			control.CheckControlFile()
+
+			Expect(gplog.GetVerbosity()).To(Equal(gplog.LOGINFO))
+			Expect(filename).ToNot(BeAnExistingFile())
+			Expect(stdout).To(Say("Ignoring log level control file"))
+		})
+		It("leaves the log level unchanged without a control file", func() {
+			control.CheckControlFile()
+
+			Expect(gplog.GetVerbosity()).To(Equal(gplog.LOGINFO))
+		})
+	})
+})
@@ -0,0 +1,84 @@
+package utils
+
+/*
+ * This file contains functions for backing up or restoring several databases
+ * in one invocation.  Each database is handled by a separate run of the same
+ * utility in its own process, so that each run has its own connections,
+ * timestamp, report, and cleanup, exactly as if it had been run by hand.
+ */
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+)
+
+/*
+ * Returns the database names in a comma-separated --dbname value, without
+ * empty names or surrounding whitespace.
+ */
+func SplitDatabaseNames(dbNames string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(dbNames, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+/*
+ * Returns the given arguments without the given flags and their values,
+ * whether a value is passed as a separate argument or after an "=".  The
+ * arguments must already have been passed through options.HandleSingleDashes.
+ */
+func RemoveFlagsFromArgs(args []string, boolFlags []string, valueFlags []string) []string {
+	boolFlagSet := NewSet(boolFlags)
+	valueFlagSet := NewSet(valueFlags)
+	filteredArgs := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			filteredArgs = append(filteredArgs, args[i])
+			continue
+		}
+		name := strings.TrimPrefix(args[i], "--")
+		hasValue := strings.Contains(name, "=")
+		name = strings.SplitN(name, "=", 2)[0]
+		if boolFlagSet.MatchesFilter(name) {
+			continue
+		}
+		if valueFlagSet.MatchesFilter(name) {
+			if !hasValue {
+				i++ // Skip the value as well
+			}
+			continue
+		}
+		filteredArgs = append(filteredArgs, args[i])
+	}
+	return filteredArgs
+}
+
+/*
+ * Runs the executable of the current process with the given arguments,
+ * passing through its output, and returns its exit code.
+ */
+func RunSelfWithArgs(args []string) int {
+	executable, err := os.Executable()
+	if err != nil {
+		executable = os.Args[0]
+	}
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	gplog.Error("Unable to run %s: %v", executable, err)
+	return 2
+}
@@ -0,0 +1,35 @@
+package utils_test
+
+import (
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/multi_database tests", func() {
+	Describe("SplitDatabaseNames", func() {
+		It("splits a comma-separated list of databases", func() {
+			Expect(utils.SplitDatabaseNames("sales, hr,,finance")).To(Equal([]string{"sales", "hr", "finance"}))
+		})
+		It("returns a single database", func() {
+			Expect(utils.SplitDatabaseNames("sales")).To(Equal([]string{"sales"}))
+		})
+	})
+	Describe("RemoveFlagsFromArgs", func() {
+		It("removes flags with separate values, flags with values after an equals sign, and boolean flags", func() {
+			args := []string{"--dbname", "sales,hr", "--all-databases", "--jobs", "4", "--timestamp=20170101010101", "--with-stats"}
+
+			filteredArgs := utils.RemoveFlagsFromArgs(args, []string{"all-databases"}, []string{"dbname", "timestamp"})
+
+			Expect(filteredArgs).To(Equal([]string{"--jobs", "4", "--with-stats"}))
+		})
+		It("does not remove flags whose names begin with the name of a removed flag", func() {
+			args := []string{"--include-database", "sales", "--include-database-file", "/tmp/file"}
+
+			filteredArgs := utils.RemoveFlagsFromArgs(args, []string{}, []string{"include-database"})
+
+			Expect(filteredArgs).To(Equal([]string{"--include-database-file", "/tmp/file"}))
+		})
+	})
+})
@@ -0,0 +1,193 @@
+package utils
+
+/*
+ * This file contains a gzip writer that compresses blocks of its input on
+ * several cores at once, in the same way as pigz.  Each block is compressed
+ * on its own, primed with the end of the previous block so that the ratio
+ * stays close to that of gzip, and the compressed blocks are joined into a
+ * single deflate stream, so the output is a standard gzip member that gunzip
+ * and any other gzip reader can decompress.
+ */
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	parallelGzipBlockSize = 128 * 1024
+	// The largest distance a deflate stream can refer back
+	parallelGzipDictSize = 32 * 1024
+)
+
+type parallelGzipBlock struct {
+	done   chan struct{}
+	output []byte
+	err    error
+}
+
+type ParallelGzipWriter struct {
+	writer        io.Writer
+	level         int
+	block         []byte
+	dict          []byte
+	crc           uint32
+	size          uint32
+	headerWritten bool
+	pending       chan *parallelGzipBlock
+	err           error
+}
+
+func NewParallelGzipWriter(writer io.Writer, level int, workers int) (*ParallelGzipWriter, error) {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return nil, errors.Errorf("Invalid gzip compression level %d", level)
+	}
+	if workers < 1 {
+		return nil, errors.Errorf("Invalid number of compression workers %d", workers)
+	}
+	gzipWriter := &ParallelGzipWriter{level: level, pending: make(chan *parallelGzipBlock, workers)}
+	gzipWriter.Reset(writer)
+	return gzipWriter, nil
+}
+
+/*
+ * Discards the state of the writer, which must have been closed, and starts a
+ * new gzip member written to writer.
+ */
+func (gzipWriter *ParallelGzipWriter) Reset(writer io.Writer) {
+	gzipWriter.writer = writer
+	gzipWriter.block = make([]byte, 0, parallelGzipBlockSize)
+	gzipWriter.dict = nil
+	gzipWriter.crc = 0
+	gzipWriter.size = 0
+	gzipWriter.headerWritten = false
+	gzipWriter.err = nil
+}
+
+func (gzipWriter *ParallelGzipWriter) Write(p []byte) (int, error) {
+	if gzipWriter.err != nil {
+		return 0, gzipWriter.err
+	}
+	gzipWriter.crc = crc32.Update(gzipWriter.crc, crc32.IEEETable, p)
+	gzipWriter.size += uint32(len(p))
+	written := 0
+	for written < len(p) {
+		numBytes := copy(gzipWriter.block[len(gzipWriter.block):cap(gzipWriter.block)], p[written:])
+		gzipWriter.block = gzipWriter.block[:len(gzipWriter.block)+numBytes]
+		written += numBytes
+		if len(gzipWriter.block) == cap(gzipWriter.block) {
+			gzipWriter.compressBlock(false)
+			if gzipWriter.err != nil {
+				return written, gzipWriter.err
+			}
+		}
+	}
+	return written, nil
+}
+
+/*
+ * Compresses the current block on a worker.  Once every worker is busy, the
+ * oldest block is written out first, so that blocks are written in order and
+ * at most one block per worker is held in memory.
+ */
+func (gzipWriter *ParallelGzipWriter) compressBlock(last bool) {
+	if len(gzipWriter.pending) == cap(gzipWriter.pending) {
+		gzipWriter.writeBlock(<-gzipWriter.pending)
+	}
+	block := &parallelGzipBlock{done: make(chan struct{})}
+	data, dict, level := gzipWriter.block, gzipWriter.dict, gzipWriter.level
+	go func() {
+		defer close(block.done)
+		block.output, block.err = deflateBlock(data, dict, level, last)
+	}()
+	gzipWriter.pending <- block
+
+	// Only the last block can be shorter than the dictionary
+	gzipWriter.dict = data
+	if len(data) > parallelGzipDictSize {
+		gzipWriter.dict = data[len(data)-parallelGzipDictSize:]
+	}
+	gzipWriter.block = make([]byte, 0, parallelGzipBlockSize)
+}
+
+/*
+ * Blocks other than the last end with a sync flush instead of a final block,
+ * which leaves the deflate stream at a byte boundary so that the next block
+ * can follow it directly.
+ */
+func deflateBlock(data []byte, dict []byte, level int, last bool) ([]byte, error) {
+	var buffer bytes.Buffer
+	flateWriter, err := flate.NewWriterDict(&buffer, level, dict)
+	if err != nil {
+		return nil, err
+	}
+	_, err = flateWriter.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	if last {
+		err = flateWriter.Close()
+	} else {
+		err = flateWriter.Flush()
+	}
+	return buffer.Bytes(), err
+}
+
+func (gzipWriter *ParallelGzipWriter) writeBlock(block *parallelGzipBlock) {
+	<-block.done
+	if gzipWriter.err != nil {
+		return
+	}
+	if block.err != nil {
+		gzipWriter.err = block.err
+		return
+	}
+	if !gzipWriter.headerWritten {
+		gzipWriter.headerWritten = true
+		gzipWriter.write(gzipHeader(gzipWriter.level))
+	}
+	gzipWriter.write(block.output)
+}
+
+func (gzipWriter *ParallelGzipWriter) write(p []byte) {
+	if gzipWriter.err == nil {
+		_, gzipWriter.err = gzipWriter.writer.Write(p)
+	}
+}
+
+/*
+ * The header has no file name or modification time, like that of gzip -c
+ * reading from a pipe.
+ */
+func gzipHeader(level int) []byte {
+	header := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}
+	if level == flate.BestCompression {
+		header[8] = 2
+	} else if level == flate.BestSpeed {
+		header[8] = 4
+	}
+	return header
+}
+
+/*
+ * Compresses the rest of the input as the last block and writes the trailer
+ * of the gzip member.  Does not close the underlying writer.
+ */
+func (gzipWriter *ParallelGzipWriter) Close() error {
+	if gzipWriter.err == nil {
+		gzipWriter.compressBlock(true)
+	}
+	for len(gzipWriter.pending) > 0 {
+		gzipWriter.writeBlock(<-gzipWriter.pending)
+	}
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer[:4], gzipWriter.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], gzipWriter.size)
+	gzipWriter.write(trailer)
+	return gzipWriter.err
+}
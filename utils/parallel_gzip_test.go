@@ -0,0 +1,68 @@
+package utils_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/parallel_gzip tests", func() {
+	decompress := func(compressed []byte) string {
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		Expect(err).ToNot(HaveOccurred())
+		contents, err := ioutil.ReadAll(reader)
+		Expect(err).ToNot(HaveOccurred())
+		return string(contents)
+	}
+	It("writes data spanning many blocks as a single gzip member", func() {
+		data := strings.Repeat("1|alpha|beta\n2|gamma|delta\n", 40000)
+		var buffer bytes.Buffer
+		gzipWriter, err := utils.NewParallelGzipWriter(&buffer, 1, 4)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < len(data); i += 10000 {
+			end := i + 10000
+			if end > len(data) {
+				end = len(data)
+			}
+			_, err = gzipWriter.Write([]byte(data[i:end]))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(gzipWriter.Close()).To(Succeed())
+
+		reader, err := gzip.NewReader(&buffer)
+		Expect(err).ToNot(HaveOccurred())
+		reader.Multistream(false)
+		contents, err := ioutil.ReadAll(reader)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(Equal(data))
+		Expect(buffer.Len()).To(Equal(0))
+	})
+	It("writes a valid gzip member for empty input", func() {
+		var buffer bytes.Buffer
+		gzipWriter, err := utils.NewParallelGzipWriter(&buffer, 6, 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gzipWriter.Close()).To(Succeed())
+		Expect(decompress(buffer.Bytes())).To(Equal(""))
+	})
+	It("starts another gzip member after a reset", func() {
+		var buffer bytes.Buffer
+		gzipWriter, err := utils.NewParallelGzipWriter(&buffer, 9, 2)
+		Expect(err).ToNot(HaveOccurred())
+		_, _ = gzipWriter.Write([]byte("first member\n"))
+		Expect(gzipWriter.Close()).To(Succeed())
+		gzipWriter.Reset(&buffer)
+		_, _ = gzipWriter.Write([]byte("second member\n"))
+		Expect(gzipWriter.Close()).To(Succeed())
+		Expect(decompress(buffer.Bytes())).To(Equal("first member\nsecond member\n"))
+	})
+	It("returns an error for an invalid number of workers", func() {
+		_, err := utils.NewParallelGzipWriter(&bytes.Buffer{}, 1, 0)
+		Expect(err).To(MatchError("Invalid number of compression workers 0"))
+	})
+})
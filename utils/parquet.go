@@ -0,0 +1,327 @@
+package utils
+
+/*
+ * This file contains a minimal Parquet file writer for extracting the data of
+ * a table from a backup.  Every column is written as an optional UTF8 string,
+ * as the data of a backup is in CSV form and carries no column types, without
+ * compression and with one data page per column in each row group.  The file
+ * metadata is encoded with the Thrift compact protocol, as the Parquet format
+ * requires.
+ */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// The number of rows buffered in memory before a row group is written
+var ParquetRowGroupSize = 100000
+
+const (
+	parquetMagic = "PAR1"
+
+	parquetTypeByteArray      = 6
+	parquetRepetitionOptional = 1
+	parquetConvertedTypeUTF8  = 0
+	parquetEncodingPlain      = 0
+	parquetEncodingRLE        = 3
+	parquetCodecUncompressed  = 0
+	parquetPageTypeData       = 0
+
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+type parquetColumnChunk struct {
+	offset int64
+	size   int64
+}
+
+type parquetRowGroup struct {
+	numRows int64
+	chunks  []parquetColumnChunk
+}
+
+/*
+ * Rows are buffered column by column until ParquetRowGroupSize rows have been
+ * written, so memory use is bounded by the size of a row group.
+ */
+type ParquetWriter struct {
+	writer    io.Writer
+	columns   []string
+	offset    int64
+	numRows   int64
+	present   [][]bool
+	values    []bytes.Buffer
+	rowGroups []parquetRowGroup
+}
+
+func NewParquetWriter(writer io.Writer, columns []string) (*ParquetWriter, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("Cannot write a Parquet file without columns")
+	}
+	parquetWriter := &ParquetWriter{
+		writer:  writer,
+		columns: columns,
+		present: make([][]bool, len(columns)),
+		values:  make([]bytes.Buffer, len(columns)),
+	}
+	err := parquetWriter.write([]byte(parquetMagic))
+	if err != nil {
+		return nil, err
+	}
+	return parquetWriter, nil
+}
+
+/*
+ * A nil value is written as NULL.
+ */
+func (parquetWriter *ParquetWriter) WriteRow(values []*string) error {
+	if len(values) != len(parquetWriter.columns) {
+		return errors.Errorf("Row has %d values, but the Parquet file has %d columns", len(values), len(parquetWriter.columns))
+	}
+	for i, value := range values {
+		parquetWriter.present[i] = append(parquetWriter.present[i], value != nil)
+		if value != nil {
+			var length [4]byte
+			binary.LittleEndian.PutUint32(length[:], uint32(len(*value)))
+			parquetWriter.values[i].Write(length[:])
+			parquetWriter.values[i].WriteString(*value)
+		}
+	}
+	if len(parquetWriter.present[0]) >= ParquetRowGroupSize {
+		return parquetWriter.writeRowGroup()
+	}
+	return nil
+}
+
+/*
+ * Writes any buffered rows and the file metadata.  The underlying writer is
+ * not closed.
+ */
+func (parquetWriter *ParquetWriter) Close() error {
+	err := parquetWriter.writeRowGroup()
+	if err != nil {
+		return err
+	}
+	metadata := parquetWriter.encodeFileMetadata()
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(metadata)))
+	for _, contents := range [][]byte{metadata, length[:], []byte(parquetMagic)} {
+		err = parquetWriter.write(contents)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (parquetWriter *ParquetWriter) write(contents []byte) error {
+	_, err := parquetWriter.writer.Write(contents)
+	parquetWriter.offset += int64(len(contents))
+	return err
+}
+
+func (parquetWriter *ParquetWriter) writeRowGroup() error {
+	numRows := len(parquetWriter.present[0])
+	if numRows == 0 {
+		return nil
+	}
+	rowGroup := parquetRowGroup{numRows: int64(numRows), chunks: make([]parquetColumnChunk, len(parquetWriter.columns))}
+	for i := range parquetWriter.columns {
+		page := encodeDefinitionLevels(parquetWriter.present[i])
+		page = append(page, parquetWriter.values[i].Bytes()...)
+		header := encodePageHeader(len(page), numRows)
+		rowGroup.chunks[i] = parquetColumnChunk{offset: parquetWriter.offset, size: int64(len(header) + len(page))}
+		for _, contents := range [][]byte{header, page} {
+			err := parquetWriter.write(contents)
+			if err != nil {
+				return err
+			}
+		}
+		parquetWriter.present[i] = parquetWriter.present[i][:0]
+		parquetWriter.values[i].Reset()
+	}
+	parquetWriter.rowGroups = append(parquetWriter.rowGroups, rowGroup)
+	parquetWriter.numRows += int64(numRows)
+	return nil
+}
+
+/*
+ * The definition levels of an optional column are 1 for a value and 0 for a
+ * NULL, written as runs of the RLE/bit-packing hybrid encoding with a bit
+ * width of 1 and preceded by their length.
+ */
+func encodeDefinitionLevels(present []bool) []byte {
+	var runs []byte
+	for start := 0; start < len(present); {
+		end := start
+		for end < len(present) && present[end] == present[start] {
+			end++
+		}
+		runs = appendVarint(runs, uint64(end-start)<<1)
+		if present[start] {
+			runs = append(runs, 1)
+		} else {
+			runs = append(runs, 0)
+		}
+		start = end
+	}
+	levels := make([]byte, 4, 4+len(runs))
+	binary.LittleEndian.PutUint32(levels, uint32(len(runs)))
+	return append(levels, runs...)
+}
+
+func encodePageHeader(pageSize int, numValues int) []byte {
+	thrift := &thriftCompactWriter{}
+	thrift.structBegin()
+	thrift.i32Field(1, parquetPageTypeData)
+	thrift.i32Field(2, int32(pageSize))
+	thrift.i32Field(3, int32(pageSize))
+	thrift.structField(5)
+	thrift.i32Field(1, int32(numValues))
+	thrift.i32Field(2, parquetEncodingPlain)
+	thrift.i32Field(3, parquetEncodingRLE)
+	thrift.i32Field(4, parquetEncodingRLE)
+	thrift.structEnd()
+	thrift.structEnd()
+	return thrift.buf.Bytes()
+}
+
+func (parquetWriter *ParquetWriter) encodeFileMetadata() []byte {
+	thrift := &thriftCompactWriter{}
+	thrift.structBegin()
+	thrift.i32Field(1, 1)
+
+	thrift.listField(2, thriftStruct, len(parquetWriter.columns)+1)
+	thrift.structBegin()
+	thrift.stringField(4, "schema")
+	thrift.i32Field(5, int32(len(parquetWriter.columns)))
+	thrift.structEnd()
+	for _, column := range parquetWriter.columns {
+		thrift.structBegin()
+		thrift.i32Field(1, parquetTypeByteArray)
+		thrift.i32Field(3, parquetRepetitionOptional)
+		thrift.stringField(4, column)
+		thrift.i32Field(6, parquetConvertedTypeUTF8)
+		thrift.structEnd()
+	}
+
+	thrift.i64Field(3, parquetWriter.numRows)
+
+	thrift.listField(4, thriftStruct, len(parquetWriter.rowGroups))
+	for _, rowGroup := range parquetWriter.rowGroups {
+		thrift.structBegin()
+		thrift.listField(1, thriftStruct, len(rowGroup.chunks))
+		var totalSize int64
+		for i, chunk := range rowGroup.chunks {
+			totalSize += chunk.size
+			thrift.structBegin()
+			thrift.i64Field(2, chunk.offset)
+			thrift.structField(3)
+			thrift.i32Field(1, parquetTypeByteArray)
+			thrift.listField(2, thriftI32, 2)
+			thrift.zigzag(parquetEncodingPlain)
+			thrift.zigzag(parquetEncodingRLE)
+			thrift.listField(3, thriftBinary, 1)
+			thrift.binary(parquetWriter.columns[i])
+			thrift.i32Field(4, parquetCodecUncompressed)
+			thrift.i64Field(5, rowGroup.numRows)
+			thrift.i64Field(6, chunk.size)
+			thrift.i64Field(7, chunk.size)
+			thrift.i64Field(9, chunk.offset)
+			thrift.structEnd()
+			thrift.structEnd()
+		}
+		thrift.i64Field(2, totalSize)
+		thrift.i64Field(3, rowGroup.numRows)
+		thrift.structEnd()
+	}
+
+	thrift.stringField(6, "gpbackup")
+	thrift.structEnd()
+	return thrift.buf.Bytes()
+}
+
+/*
+ * Writes the subset of the Thrift compact protocol used by the Parquet file
+ * metadata.  Field ids are written as deltas from the previous field of the
+ * same struct, so the id of the last field of each enclosing struct is kept.
+ */
+type thriftCompactWriter struct {
+	buf       bytes.Buffer
+	lastField []int16
+}
+
+func (thrift *thriftCompactWriter) structBegin() {
+	thrift.lastField = append(thrift.lastField, 0)
+}
+
+func (thrift *thriftCompactWriter) structEnd() {
+	thrift.buf.WriteByte(0)
+	thrift.lastField = thrift.lastField[:len(thrift.lastField)-1]
+}
+
+func (thrift *thriftCompactWriter) fieldHeader(id int16, fieldType byte) {
+	last := &thrift.lastField[len(thrift.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		thrift.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		thrift.buf.WriteByte(fieldType)
+		thrift.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (thrift *thriftCompactWriter) structField(id int16) {
+	thrift.fieldHeader(id, thriftStruct)
+	thrift.structBegin()
+}
+
+func (thrift *thriftCompactWriter) i32Field(id int16, value int32) {
+	thrift.fieldHeader(id, thriftI32)
+	thrift.zigzag(int64(value))
+}
+
+func (thrift *thriftCompactWriter) i64Field(id int16, value int64) {
+	thrift.fieldHeader(id, thriftI64)
+	thrift.zigzag(value)
+}
+
+func (thrift *thriftCompactWriter) stringField(id int16, value string) {
+	thrift.fieldHeader(id, thriftBinary)
+	thrift.binary(value)
+}
+
+func (thrift *thriftCompactWriter) listField(id int16, elementType byte, size int) {
+	thrift.fieldHeader(id, thriftList)
+	if size < 15 {
+		thrift.buf.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		thrift.buf.WriteByte(0xf0 | elementType)
+		thrift.buf.Write(appendVarint(nil, uint64(size)))
+	}
+}
+
+func (thrift *thriftCompactWriter) binary(value string) {
+	thrift.buf.Write(appendVarint(nil, uint64(len(value))))
+	thrift.buf.WriteString(value)
+}
+
+func (thrift *thriftCompactWriter) zigzag(value int64) {
+	thrift.buf.Write(appendVarint(nil, uint64((value<<1)^(value>>63))))
+}
+
+func appendVarint(contents []byte, value uint64) []byte {
+	for value >= 0x80 {
+		contents = append(contents, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(contents, byte(value))
+}
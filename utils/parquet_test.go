@@ -0,0 +1,269 @@
+package utils_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/parquet tests", func() {
+	Describe("ParquetWriter", func() {
+		value := func(contents string) *string { return &contents }
+		It("writes the rows and the file metadata", func() {
+			buffer := &bytes.Buffer{}
+			writer, err := utils.NewParquetWriter(buffer, []string{"id"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(writer.WriteRow([]*string{value("7")})).To(Succeed())
+			Expect(writer.WriteRow([]*string{nil})).To(Succeed())
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(buffer.String()).To(Equal("PAR1" +
+				// Page header and data page: definition levels 1 then 0, and the value "7"
+				"\x15\x00\x15\x1a\x15\x1a,\x15\x04\x15\x00\x15\x06\x15\x06\x00\x00\x04\x00\x00\x00\x02\x01\x02\x00\x01\x00\x00\x007" +
+				// File metadata: the schema, 2 rows, and one row group with one column chunk
+				"\x15\x02\x19,H\x06schema\x15\x02\x00\x15\f%\x02\x18\x02id%\x00\x00\x16\x04\x19\x1c\x19\x1c&\b\x1c\x15\f\x19%\x00\x06\x19\x18\x02id\x15\x00\x16\x04\x16<\x16<&\b\x00\x00\x16<\x16\x04\x00(\bgpbackup\x00" +
+				"J\x00\x00\x00PAR1"))
+		})
+		It("writes a row group whenever enough rows are buffered", func() {
+			defer func(size int) { utils.ParquetRowGroupSize = size }(utils.ParquetRowGroupSize)
+			utils.ParquetRowGroupSize = 1
+			buffer := &bytes.Buffer{}
+			writer, _ := utils.NewParquetWriter(buffer, []string{"id"})
+
+			Expect(writer.WriteRow([]*string{value("7")})).To(Succeed())
+
+			Expect(buffer.String()).To(HaveSuffix("\x01\x00\x00\x007"))
+		})
+		It("writes a file that a Parquet reader decodes back into the same rows", func() {
+			defer func(size int) { utils.ParquetRowGroupSize = size }(utils.ParquetRowGroupSize)
+			utils.ParquetRowGroupSize = 100
+			columns := []string{"id", "name", "note"}
+			rows := make([][]*string, 0)
+			random := rand.New(rand.NewSource(1))
+			for i := 0; i < 250; i++ {
+				row := []*string{value(fmt.Sprintf("%d", i)), value(fmt.Sprintf("naïve, \"quoted\"\n%d", i)), nil}
+				if random.Intn(3) == 0 {
+					row[1] = nil
+				}
+				if random.Intn(4) == 0 {
+					row[2] = value("")
+				}
+				rows = append(rows, row)
+			}
+			buffer := &bytes.Buffer{}
+			writer, err := utils.NewParquetWriter(buffer, columns)
+			Expect(err).ToNot(HaveOccurred())
+			for _, row := range rows {
+				Expect(writer.WriteRow(row)).To(Succeed())
+			}
+			Expect(writer.Close()).To(Succeed())
+
+			readColumns, readRows := readParquetFile(buffer.Bytes())
+
+			Expect(readColumns).To(Equal(columns))
+			Expect(readRows).To(Equal(rows))
+		})
+		It("returns an error for a row with the wrong number of values", func() {
+			writer, _ := utils.NewParquetWriter(&bytes.Buffer{}, []string{"id", "name"})
+			Expect(writer.WriteRow([]*string{value("7")})).To(MatchError("Row has 1 values, but the Parquet file has 2 columns"))
+		})
+		It("returns an error without columns", func() {
+			_, err := utils.NewParquetWriter(&bytes.Buffer{}, []string{})
+			Expect(err).To(MatchError("Cannot write a Parquet file without columns"))
+		})
+	})
+})
+
+/*
+ * A Parquet reader for the files written by ParquetWriter, written from the
+ * Parquet format and Thrift compact protocol specifications rather than from
+ * the writer, so that the file layout is checked and not just its bytes.  It
+ * only supports optional byte array columns in uncompressed version 1 data
+ * pages with PLAIN values.
+ */
+func readParquetFile(contents []byte) ([]string, [][]*string) {
+	Expect(string(contents[:4])).To(Equal("PAR1"))
+	Expect(string(contents[len(contents)-4:])).To(Equal("PAR1"))
+	metadataLength := int(binary.LittleEndian.Uint32(contents[len(contents)-8:]))
+	metadataStart := len(contents) - 8 - metadataLength
+	metadataReader := &thriftCompactReader{contents: contents[metadataStart : len(contents)-8]}
+	metadata := metadataReader.readStruct()
+	Expect(metadataReader.offset).To(Equal(metadataLength))
+
+	// The root of the schema is followed by one optional BYTE_ARRAY UTF8 element per column
+	schema := metadata[2].([]interface{})
+	root := schema[0].(map[int16]interface{})
+	columns := make([]string, 0)
+	for _, element := range schema[1:] {
+		field := element.(map[int16]interface{})
+		Expect(field[1]).To(Equal(int64(6)))
+		Expect(field[3]).To(Equal(int64(1)))
+		Expect(field[6]).To(Equal(int64(0)))
+		columns = append(columns, string(field[4].([]byte)))
+	}
+	Expect(root[5]).To(Equal(int64(len(columns))))
+
+	rows := make([][]*string, 0)
+	for _, rowGroupValue := range metadata[4].([]interface{}) {
+		rowGroup := rowGroupValue.(map[int16]interface{})
+		numRows := int(rowGroup[3].(int64))
+		groupRows := make([][]*string, numRows)
+		for i := range groupRows {
+			groupRows[i] = make([]*string, len(columns))
+		}
+		for i, chunkValue := range rowGroup[1].([]interface{}) {
+			chunkMetadata := chunkValue.(map[int16]interface{})[3].(map[int16]interface{})
+			Expect(chunkMetadata[3]).To(Equal([]interface{}{[]byte(columns[i])}))
+			Expect(chunkMetadata[4]).To(Equal(int64(0)))
+			Expect(chunkMetadata[5]).To(Equal(int64(numRows)))
+			pageOffset := int(chunkMetadata[9].(int64))
+			chunkSize := int(chunkMetadata[7].(int64))
+			Expect(pageOffset + chunkSize).To(BeNumerically("<=", metadataStart))
+			for row, value := range readParquetDataPage(contents[pageOffset:pageOffset+chunkSize], numRows) {
+				groupRows[row][i] = value
+			}
+		}
+		rows = append(rows, groupRows...)
+	}
+	Expect(metadata[3]).To(Equal(int64(len(rows))))
+	return columns, rows
+}
+
+func readParquetDataPage(chunk []byte, numValues int) []*string {
+	headerReader := &thriftCompactReader{contents: chunk}
+	header := headerReader.readStruct()
+	Expect(header[1]).To(Equal(int64(0)))
+	Expect(header[2]).To(Equal(header[3]))
+	dataPageHeader := header[5].(map[int16]interface{})
+	Expect(dataPageHeader[1]).To(Equal(int64(numValues)))
+	Expect(dataPageHeader[2]).To(Equal(int64(0)))
+	Expect(dataPageHeader[3]).To(Equal(int64(3)))
+	page := chunk[headerReader.offset:]
+	Expect(len(page)).To(Equal(int(header[2].(int64))))
+
+	levelsLength := int(binary.LittleEndian.Uint32(page))
+	levels := readRLEBitPackedHybrid(page[4:4+levelsLength], numValues)
+	plainValues := page[4+levelsLength:]
+	values := make([]*string, numValues)
+	for i, level := range levels {
+		if level == 0 {
+			continue
+		}
+		length := int(binary.LittleEndian.Uint32(plainValues))
+		value := string(plainValues[4 : 4+length])
+		values[i] = &value
+		plainValues = plainValues[4+length:]
+	}
+	Expect(plainValues).To(BeEmpty())
+	return values
+}
+
+// Decodes definition levels with a bit width of 1
+func readRLEBitPackedHybrid(contents []byte, numValues int) []int {
+	levels := make([]int, 0, numValues)
+	for len(levels) < numValues {
+		header, n := binary.Uvarint(contents)
+		Expect(n).To(BeNumerically(">", 0))
+		contents = contents[n:]
+		if header&1 == 0 {
+			for i := uint64(0); i < header>>1; i++ {
+				levels = append(levels, int(contents[0]))
+			}
+			contents = contents[1:]
+		} else {
+			numBytes := int(header >> 1)
+			for _, packed := range contents[:numBytes] {
+				for bit := uint(0); bit < 8; bit++ {
+					levels = append(levels, int(packed>>bit)&1)
+				}
+			}
+			contents = contents[numBytes:]
+		}
+	}
+	Expect(contents).To(BeEmpty())
+	return levels[:numValues]
+}
+
+/*
+ * Structs are decoded into maps of field id to value, with integers as
+ * int64, binary as []byte, and lists as []interface{}.
+ */
+type thriftCompactReader struct {
+	contents []byte
+	offset   int
+}
+
+func (thrift *thriftCompactReader) readByte() byte {
+	value := thrift.contents[thrift.offset]
+	thrift.offset++
+	return value
+}
+
+func (thrift *thriftCompactReader) readVarint() uint64 {
+	value, n := binary.Uvarint(thrift.contents[thrift.offset:])
+	Expect(n).To(BeNumerically(">", 0))
+	thrift.offset += n
+	return value
+}
+
+func (thrift *thriftCompactReader) readZigzag() int64 {
+	value := thrift.readVarint()
+	return int64(value>>1) ^ -int64(value&1)
+}
+
+func (thrift *thriftCompactReader) readStruct() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var fieldID int16
+	for {
+		header := thrift.readByte()
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			fieldID += delta
+		} else {
+			fieldID = int16(thrift.readZigzag())
+		}
+		fields[fieldID] = thrift.readValue(header & 0x0f)
+	}
+}
+
+func (thrift *thriftCompactReader) readValue(valueType byte) interface{} {
+	switch valueType {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(thrift.readByte()))
+	case 4, 5, 6:
+		return thrift.readZigzag()
+	case 8:
+		length := int(thrift.readVarint())
+		value := thrift.contents[thrift.offset : thrift.offset+length]
+		thrift.offset += length
+		return value
+	case 9, 10:
+		header := thrift.readByte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(thrift.readVarint())
+		}
+		elements := make([]interface{}, size)
+		for i := range elements {
+			elements[i] = thrift.readValue(header & 0x0f)
+		}
+		return elements
+	case 12:
+		return thrift.readStruct()
+	}
+	Fail(fmt.Sprintf("Unsupported Thrift compact type %d", valueType))
+	return nil
+}
@@ -0,0 +1,96 @@
+package utils
+
+/*
+ * This file contains structs and functions for pausing the data copy of a
+ * running gpbackup or gprestore with SIGUSR1 and resuming it with SIGUSR2.
+ */
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+)
+
+/*
+ * While paused, the tables that are already being copied are finished but no
+ * new table is started until the copy is resumed.  A pause requested before
+ * the data copy begins holds the first tables.  All methods may be called on a
+ * nil DataCopyPause.
+ */
+type DataCopyPause struct {
+	paused   bool
+	cond     *sync.Cond
+	onChange func(paused bool)
+}
+
+func NewDataCopyPause(onChange func(paused bool)) *DataCopyPause {
+	return &DataCopyPause{
+		cond:     sync.NewCond(&sync.Mutex{}),
+		onChange: onChange,
+	}
+}
+
+/*
+ * Handles SIGUSR1 and SIGUSR2 for the life of the process, calling onChange
+ * whenever the data copy is paused or resumed.  Windows has neither signal, so
+ * there the data copy is never paused.
+ */
+func InitializePauseSignalHandler(procDesc string, onChange func(paused bool)) *DataCopyPause {
+	pause := NewDataCopyPause(onChange)
+	signalChan := make(chan os.Signal, 1)
+	if len(pauseSignals) == 0 {
+		return pause
+	}
+	signal.Notify(signalChan, pauseSignals...)
+	go func() {
+		for sig := range signalChan {
+			if sig == pauseSignals[0] {
+				gplog.Info("Received SIGUSR1, pausing data copy of %s once in-progress tables finish; send SIGUSR2 to resume", procDesc)
+				pause.SetPaused(true)
+			} else {
+				gplog.Info("Received SIGUSR2, resuming data copy of %s", procDesc)
+				pause.SetPaused(false)
+			}
+		}
+	}()
+	return pause
+}
+
+func (pause *DataCopyPause) SetPaused(paused bool) {
+	if pause == nil {
+		return
+	}
+	pause.cond.L.Lock()
+	changed := pause.paused != paused
+	pause.paused = paused
+	pause.cond.L.Unlock()
+	pause.cond.Broadcast()
+	if changed && pause.onChange != nil {
+		pause.onChange(paused)
+	}
+}
+
+func (pause *DataCopyPause) IsPaused() bool {
+	if pause == nil {
+		return false
+	}
+	pause.cond.L.Lock()
+	defer pause.cond.L.Unlock()
+	return pause.paused
+}
+
+/*
+ * Called by each worker before it starts copying a table.
+ */
+func (pause *DataCopyPause) WaitWhilePaused() {
+	if pause == nil {
+		return
+	}
+	pause.cond.L.Lock()
+	defer pause.cond.L.Unlock()
+	for pause.paused {
+		pause.cond.Wait()
+	}
+}
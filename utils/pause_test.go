@@ -0,0 +1,44 @@
+package utils_test
+
+import (
+	"time"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/pause tests", func() {
+	Describe("DataCopyPause", func() {
+		It("holds workers while paused and releases them when resumed", func() {
+			pause := utils.NewDataCopyPause(nil)
+			pause.SetPaused(true)
+			started := make(chan struct{})
+			go func() {
+				pause.WaitWhilePaused()
+				close(started)
+			}()
+
+			Consistently(started, 100*time.Millisecond).ShouldNot(BeClosed())
+			pause.SetPaused(false)
+			Eventually(started).Should(BeClosed())
+		})
+		It("only reports changes in the paused state", func() {
+			changes := make([]bool, 0)
+			pause := utils.NewDataCopyPause(func(paused bool) { changes = append(changes, paused) })
+
+			pause.SetPaused(true)
+			pause.SetPaused(true)
+			pause.SetPaused(false)
+
+			Expect(changes).To(Equal([]bool{true, false}))
+			Expect(pause.IsPaused()).To(BeFalse())
+		})
+		It("never holds workers for a nil pause", func() {
+			var pause *utils.DataCopyPause
+			pause.WaitWhilePaused()
+			Expect(pause.IsPaused()).To(BeFalse())
+		})
+	})
+})
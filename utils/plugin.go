@@ -20,8 +20,14 @@ import (
 )
 
 const RequiredPluginVersion = "0.3.0"
+const MultipartPluginVersion = "0.5.0"
 const SecretKeyFile = ".encrypt"
 
+const (
+	DefaultMultipartChunkSizeMB = 64
+	DefaultMultipartParallelism = 4
+)
+
 type PluginConfig struct {
 	ExecutablePath      string            `yaml:"executablepath"`
 	ConfigPath          string            `yaml:"-"`
@@ -59,6 +65,10 @@ func ReadPluginConfig(configFile string) (*PluginConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	_, _, err = config.GetMultipartSettings()
+	if err != nil {
+		return nil, err
+	}
 	configFilename := path.Base(configFile)
 	config.ConfigPath = path.Join("/tmp", configFilename)
 	return config, nil
@@ -90,6 +100,16 @@ func (plugin *PluginConfig) MustRestoreFile(filenamePath string) {
 	gplog.FatalOnError(err, string(output))
 }
 
+func (plugin *PluginConfig) DeleteBackup(timestamp string) error {
+	command := fmt.Sprintf("%s delete_backup %s %s", plugin.ExecutablePath, plugin.ConfigPath, timestamp)
+	gplog.Debug("%s", command)
+	output, err := exec.Command("bash", "-c", command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ERROR: Plugin failed to delete backup %s. %s", timestamp, string(output))
+	}
+	return nil
+}
+
 func (plugin *PluginConfig) CheckPluginExistsOnAllHosts(c *cluster.Cluster) string {
 	plugin.checkPluginAPIVersion(c)
 
@@ -150,6 +170,13 @@ func (plugin *PluginConfig) checkPluginAPIVersion(c *cluster.Cluster) {
 		cluster.LogFatalClusterError("Plugin API version incorrect",
 			cluster.ON_HOSTS|cluster.INCLUDE_MASTER, numIncorrect)
 	}
+	if plugin.UsesMultipartUpload() {
+		multipartVersion, _ := semver.Make(MultipartPluginVersion)
+		if !version.GE(multipartVersion) {
+			gplog.Fatal(fmt.Errorf("Plugin API version %s does not support multipart upload; "+
+				"version %s or later is required to use multipart_upload", version, MultipartPluginVersion), "")
+		}
+	}
 }
 
 func (plugin *PluginConfig) getPluginNativeVersion(c *cluster.Cluster) string {
@@ -444,6 +471,37 @@ func (plugin *PluginConfig) UsesEncryption() bool {
 		(plugin.Options["replication"] == "on" && plugin.Options["remote_password_encryption"] == "on")
 }
 
+/*
+ * Plugins implementing API version 0.5.0 or later can receive the data of a
+ * segment as parts uploaded in parallel, rather than as a single stream to
+ * backup_data, when multipart_upload is enabled in the plugin config.
+ */
+func (plugin *PluginConfig) UsesMultipartUpload() bool {
+	return plugin.Options["multipart_upload"] == "on"
+}
+
+/*
+ * Returns the size of each part in bytes and the number of parts that each
+ * segment may upload at once.
+ */
+func (plugin *PluginConfig) GetMultipartSettings() (chunkSize int, parallelism int, err error) {
+	chunkSizeMB := DefaultMultipartChunkSizeMB
+	parallelism = DefaultMultipartParallelism
+	if value, ok := plugin.Options["multipart_chunk_size_mb"]; ok {
+		chunkSizeMB, err = strconv.Atoi(value)
+		if err != nil || chunkSizeMB < 1 {
+			return 0, 0, fmt.Errorf("multipart_chunk_size_mb must be a positive integer, not '%s'", value)
+		}
+	}
+	if value, ok := plugin.Options["multipart_parallelism"]; ok {
+		parallelism, err = strconv.Atoi(value)
+		if err != nil || parallelism < 1 {
+			return 0, 0, fmt.Errorf("multipart_parallelism must be a positive integer, not '%s'", value)
+		}
+	}
+	return chunkSizeMB * 1024 * 1024, parallelism, nil
+}
+
 func (plugin *PluginConfig) GetPluginName(c *cluster.Cluster) (pluginName string, err error) {
 	pluginCall := fmt.Sprintf("%s --version", plugin.ExecutablePath)
 	output, err := c.ExecuteLocalCommand(pluginCall)
@@ -258,6 +258,22 @@ options:
 				_ = subject.CheckPluginExistsOnAllHosts(testCluster)
 			})
 		})
+		When("multipart upload is enabled", func() {
+			It("succeeds when the version supports multipart upload", func() {
+				subject.Options["multipart_upload"] = "on"
+				for i := range executor.ClusterOutputs[0].Commands {
+					executor.ClusterOutputs[0].Commands[i].Stdout = utils.MultipartPluginVersion
+				}
+
+				_ = subject.CheckPluginExistsOnAllHosts(testCluster)
+			})
+			It("panics with message when the version does not support multipart upload", func() {
+				subject.Options["multipart_upload"] = "on"
+				defer testhelper.ShouldPanicWithMessage("does not support multipart upload")
+
+				_ = subject.CheckPluginExistsOnAllHosts(testCluster)
+			})
+		})
 		When("version inconsistent", func() {
 			It("panics with message", func() {
 				executor.ClusterOutputs[0].Commands[0].Stdout = "99.99.9999"
@@ -281,6 +297,41 @@ options:
 			Expect(subject.UsesEncryption()).To(BeTrue())
 		})
 	})
+	Describe("UsesMultipartUpload", func() {
+		It("returns false when multipart upload is not in config", func() {
+			Expect(subject.UsesMultipartUpload()).To(BeFalse())
+		})
+		It("returns true when multipart upload is on in config", func() {
+			subject.Options["multipart_upload"] = "on"
+			Expect(subject.UsesMultipartUpload()).To(BeTrue())
+		})
+	})
+	Describe("GetMultipartSettings", func() {
+		It("returns the defaults when no settings are in config", func() {
+			chunkSize, parallelism, err := subject.GetMultipartSettings()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chunkSize).To(Equal(utils.DefaultMultipartChunkSizeMB * 1024 * 1024))
+			Expect(parallelism).To(Equal(utils.DefaultMultipartParallelism))
+		})
+		It("returns the settings in config", func() {
+			subject.Options["multipart_chunk_size_mb"] = "8"
+			subject.Options["multipart_parallelism"] = "16"
+			chunkSize, parallelism, err := subject.GetMultipartSettings()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chunkSize).To(Equal(8 * 1024 * 1024))
+			Expect(parallelism).To(Equal(16))
+		})
+		It("returns an error when the chunk size is not a positive integer", func() {
+			subject.Options["multipart_chunk_size_mb"] = "0"
+			_, _, err := subject.GetMultipartSettings()
+			Expect(err).To(MatchError("multipart_chunk_size_mb must be a positive integer, not '0'"))
+		})
+		It("returns an error when the parallelism is not a positive integer", func() {
+			subject.Options["multipart_parallelism"] = "many"
+			_, _, err := subject.GetMultipartSettings()
+			Expect(err).To(MatchError("multipart_parallelism must be a positive integer, not 'many'"))
+		})
+	})
 	Describe("GetSecretKey", func() {
 		It("returns a secret key when one exists for the given name", func() {
 			mdd := testCluster.GetDirForContent(-1)
@@ -404,5 +455,16 @@ hostname: "myhostname"`), nil
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("plugin config file is formatted incorrectly"))
 		})
+		It("returns an error if the multipart settings are invalid", func() {
+			operating.System.ReadFile = func(string) ([]byte, error) {
+				return []byte(`executablepath: "/bin/bash"
+options:
+  multipart_upload: "on"
+  multipart_parallelism: "-1"`), nil
+			}
+
+			_, err := utils.ReadPluginConfig("myconfigpath")
+			Expect(err).To(MatchError("multipart_parallelism must be a positive integer, not '-1'"))
+		})
 	})
 })
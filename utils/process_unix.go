@@ -0,0 +1,16 @@
+// +build !windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+var pauseSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2}
+var logLevelSignals = []os.Signal{syscall.SIGHUP}
+
+func isProcessRunning(pid int) bool {
+	err := syscall.Kill(pid, syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,22 @@
+// +build windows
+
+package utils
+
+import (
+	"os"
+)
+
+var pauseSignals = []os.Signal{}
+var logLevelSignals = []os.Signal{}
+
+/*
+ * On Windows, FindProcess fails if there is no process with the given pid.
+ */
+func isProcessRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = process.Release()
+	return true
+}
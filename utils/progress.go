@@ -0,0 +1,141 @@
+package utils
+
+/*
+ * This file contains structs and functions for the progress file, in which a
+ * run records each phase that it enters and the data of each table that it
+ * restores, so that tools orchestrating runs can follow them from another
+ * process without parsing the log file.
+ *
+ * The progress file is in JSON Lines format, with one ProgressEvent appended
+ * per line as the run goes on.  Version 1 of the events has these fields:
+ *
+ *   version  the version of the event format, 1
+ *   time     when the event happened, as YYYYMMDDHHMMSS
+ *   event    "phase" when the run enters a phase, "table" when the data of a
+ *            table is restored or fails to be, or "finish" when the run ends
+ *   phase    the phase entered, for "phase" events
+ *   table    the fully-qualified name of the table, for "table" events
+ *   state    "Succeeded" or "Failed", for "table" and "finish" events
+ *   error    why the table failed, for "table" events that failed
+ *
+ * Readers should ignore the fields and events that they do not know, as later
+ * versions may add them.
+ */
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	PROGRESS_FORMAT_VERSION = 1
+
+	ProgressEventPhase  = "phase"
+	ProgressEventTable  = "table"
+	ProgressEventFinish = "finish"
+)
+
+type ProgressEvent struct {
+	Version int    `json:"version"`
+	Time    string `json:"time"`
+	Event   string `json:"event"`
+	Phase   string `json:"phase,omitempty"`
+	Table   string `json:"table,omitempty"`
+	State   string `json:"state,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type PhaseTransition struct {
+	Phase string
+	Time  string
+}
+
+/*
+ * The progress of a run as recorded in its progress file.  State is Running
+ * until the run records that it finished.  TablesFailed maps each table that
+ * failed to its error.
+ */
+type RunProgress struct {
+	State           string
+	Phases          []PhaseTransition
+	TablesSucceeded []string
+	TablesFailed    map[string]string
+}
+
+func (progress RunProgress) CurrentPhase() string {
+	if len(progress.Phases) == 0 {
+		return ""
+	}
+	return progress.Phases[len(progress.Phases)-1].Phase
+}
+
+/*
+ * A last line without a newline is still being written by the run, so it is
+ * left for the next read.
+ */
+func ParseRunProgress(reader io.Reader) (RunProgress, error) {
+	progress := RunProgress{State: RunStateRunning, Phases: make([]PhaseTransition, 0), TablesSucceeded: make([]string, 0), TablesFailed: make(map[string]string)}
+	bufReader := bufio.NewReader(reader)
+	for lineNum := 1; ; lineNum++ {
+		line, err := bufReader.ReadString('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return progress, err
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		event := ProgressEvent{}
+		if err = json.Unmarshal([]byte(line), &event); err != nil {
+			return progress, errors.Wrapf(err, "Invalid progress event on line %d", lineNum)
+		}
+		switch event.Event {
+		case ProgressEventPhase:
+			progress.Phases = append(progress.Phases, PhaseTransition{Phase: event.Phase, Time: event.Time})
+		case ProgressEventTable:
+			if event.State == RunStateSucceeded {
+				progress.TablesSucceeded = append(progress.TablesSucceeded, event.Table)
+			} else {
+				progress.TablesFailed[event.Table] = event.Error
+			}
+		case ProgressEventFinish:
+			progress.State = event.State
+		}
+	}
+	return progress, nil
+}
+
+func ReadRunProgress(filename string) (RunProgress, error) {
+	progressFile, err := os.Open(filename)
+	if err != nil {
+		return RunProgress{}, errors.Wrapf(err, "Unable to read progress file %s", filename)
+	}
+	defer progressFile.Close()
+	return ParseRunProgress(progressFile)
+}
+
+/*
+ * Errors writing the progress file are ignored, as it must never stop the
+ * run, but no more events are written after one, so that the file does not
+ * end with a partial line followed by further events.
+ */
+func appendProgressEvent(progressFile *os.File, event ProgressEvent) *os.File {
+	event.Version = PROGRESS_FORMAT_VERSION
+	event.Time = time.Now().Format("20060102150405")
+	contents, err := json.Marshal(event)
+	if err == nil {
+		_, err = progressFile.Write(append(contents, '\n'))
+	}
+	if err != nil {
+		_ = progressFile.Close()
+		return nil
+	}
+	return progressFile
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/pkg/errors"
 	"gopkg.in/cheggaaa/pb.v1"
 )
 
@@ -34,7 +35,39 @@ const (
 	INCR_PERCENT = 10
 )
 
+/*
+ * The following constants are the valid values of --progress, which selects
+ * whether data progress is shown as a count of tables or as a number of bytes
+ * with the throughput and estimated time remaining, or whether no progress
+ * bars are shown at all.
+ */
+const (
+	PROGRESS_OBJECTS = "objects"
+	PROGRESS_BYTES   = "bytes"
+	PROGRESS_NONE    = "none"
+)
+
+var progressMode = PROGRESS_OBJECTS
+
+func ValidateProgressMode(mode string) error {
+	if mode != PROGRESS_OBJECTS && mode != PROGRESS_BYTES && mode != PROGRESS_NONE {
+		return errors.Errorf("Invalid value '%s' for --progress.  Valid values are 'bytes', 'objects', and 'none'.", mode)
+	}
+	return nil
+}
+
+func SetProgressMode(mode string) {
+	progressMode = mode
+}
+
+func UseByteProgress() bool {
+	return progressMode == PROGRESS_BYTES
+}
+
 func NewProgressBar(count int, prefix string, showProgressBar int) ProgressBar {
+	if progressMode == PROGRESS_NONE {
+		showProgressBar = PB_NONE
+	}
 	progressBar := pb.New(count).Prefix(prefix)
 	progressBar.ShowTimeLeft = false
 	progressBar.SetMaxWidth(100)
@@ -48,6 +81,24 @@ func NewProgressBar(count int, prefix string, showProgressBar int) ProgressBar {
 	return progressBar
 }
 
+/*
+ * A byte progress bar is advanced with Add() by the size of each object as it
+ * completes, and shows the throughput and estimated time remaining.  It is
+ * only shown in info mode, as there is no verbose equivalent.
+ */
+func NewByteProgressBar(numBytes int64, prefix string, showProgressBar int) ProgressBar {
+	if progressMode == PROGRESS_NONE {
+		showProgressBar = PB_NONE
+	}
+	progressBar := pb.New64(numBytes).Prefix(prefix).SetUnits(pb.U_BYTES)
+	progressBar.ShowSpeed = true
+	progressBar.ShowTimeLeft = true
+	progressBar.SetMaxWidth(120)
+	progressBar.SetRefreshRate(time.Millisecond * 200)
+	progressBar.NotPrint = !(showProgressBar >= PB_INFO && numBytes > 0 && gplog.GetVerbosity() == gplog.LOGINFO)
+	return progressBar
+}
+
 type ProgressBar interface {
 	Start() *pb.ProgressBar
 	Finish()
@@ -99,6 +99,44 @@ var _ = Describe("utils/log tests", func() {
 			})
 		})
 	})
+	Describe("progress mode", func() {
+		AfterEach(func() {
+			utils.SetProgressMode(utils.PROGRESS_OBJECTS)
+		})
+		It("will not print any progress bar in none mode", func() {
+			gplog.SetVerbosity(gplog.LOGINFO)
+			utils.SetProgressMode(utils.PROGRESS_NONE)
+			progressBar := utils.NewProgressBar(10, "test progress bar", utils.PB_VERBOSE)
+			infoPb, ok := progressBar.(*pb.ProgressBar)
+			Expect(ok).To(BeTrue())
+			Expect(infoPb.NotPrint).To(Equal(true))
+		})
+		It("creates a byte progress bar that shows throughput and time remaining", func() {
+			gplog.SetVerbosity(gplog.LOGINFO)
+			progressBar := utils.NewByteProgressBar(1024, "test progress bar", utils.PB_INFO)
+			infoPb, ok := progressBar.(*pb.ProgressBar)
+			Expect(ok).To(BeTrue())
+			Expect(infoPb.Units).To(Equal(pb.U_BYTES))
+			Expect(infoPb.ShowSpeed).To(BeTrue())
+			Expect(infoPb.ShowTimeLeft).To(BeTrue())
+			Expect(infoPb.NotPrint).To(Equal(false))
+		})
+		It("will not print a byte progress bar with verbosity LOGVERBOSE", func() {
+			gplog.SetVerbosity(gplog.LOGVERBOSE)
+			progressBar := utils.NewByteProgressBar(1024, "test progress bar", utils.PB_INFO)
+			infoPb, _ := progressBar.(*pb.ProgressBar)
+			Expect(infoPb.NotPrint).To(Equal(true))
+		})
+		It("reports whether progress is shown in bytes", func() {
+			Expect(utils.UseByteProgress()).To(BeFalse())
+			utils.SetProgressMode(utils.PROGRESS_BYTES)
+			Expect(utils.UseByteProgress()).To(BeTrue())
+		})
+		It("returns an error for an invalid mode", func() {
+			Expect(utils.ValidateProgressMode("bytes")).To(Succeed())
+			Expect(utils.ValidateProgressMode("rows")).To(MatchError("Invalid value 'rows' for --progress.  Valid values are 'bytes', 'objects', and 'none'."))
+		})
+	})
 	Describe("Increment", func() {
 		var vPb *utils.VerboseProgressBar
 		BeforeEach(func() {
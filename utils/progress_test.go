@@ -0,0 +1,83 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/progress tests", func() {
+	Describe("ParseRunProgress", func() {
+		It("reads the phases and tables of a finished run", func() {
+			contents := `{"version":1,"time":"20170101010101","event":"phase","phase":"Starting"}
+{"version":1,"time":"20170101010102","event":"phase","phase":"Data"}
+{"version":1,"time":"20170101010103","event":"table","table":"public.foo","state":"Succeeded"}
+{"version":1,"time":"20170101010104","event":"table","table":"public.bar","state":"Failed","error":"relation does not exist"}
+{"version":1,"time":"20170101010105","event":"finish","state":"Failed"}
+`
+			progress, err := utils.ParseRunProgress(strings.NewReader(contents))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(progress.State).To(Equal(utils.RunStateFailed))
+			Expect(progress.Phases).To(Equal([]utils.PhaseTransition{{Phase: "Starting", Time: "20170101010101"}, {Phase: "Data", Time: "20170101010102"}}))
+			Expect(progress.CurrentPhase()).To(Equal("Data"))
+			Expect(progress.TablesSucceeded).To(Equal([]string{"public.foo"}))
+			Expect(progress.TablesFailed).To(Equal(map[string]string{"public.bar": "relation does not exist"}))
+		})
+		It("leaves out a last line that is still being written", func() {
+			contents := `{"version":1,"time":"20170101010101","event":"phase","phase":"Data"}
+{"version":1,"time":"20170101010103","event":"tab`
+
+			progress, err := utils.ParseRunProgress(strings.NewReader(contents))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(progress.State).To(Equal(utils.RunStateRunning))
+			Expect(progress.TablesSucceeded).To(BeEmpty())
+		})
+		It("ignores the events and fields of later versions", func() {
+			contents := `{"version":2,"time":"20170101010101","event":"checkpoint","segments":4}
+`
+			progress, err := utils.ParseRunProgress(strings.NewReader(contents))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(progress.Phases).To(BeEmpty())
+		})
+	})
+	Describe("StatusTracker progress file", func() {
+		var tempDir string
+		BeforeEach(func() {
+			tempDir, _ = ioutil.TempDir("", "progress")
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(tempDir)
+		})
+		It("records the phases and tables of the run", func() {
+			filename := path.Join(tempDir, "gprestore_20170101010101_20170102010101_progress.jsonl")
+			tracker := utils.NewStatusTracker(path.Join(tempDir, "status.yaml"), "gprestore", "20170102010101", "testdb")
+			Expect(tracker.RecordProgressTo(filename)).To(Succeed())
+			tracker.SetPhase("Pre-data metadata")
+			tracker.StartData(2, 0)
+			tracker.AddTableResult("public.foo", nil)
+			tracker.AddTableResult("public.bar", errors.New("disk full"))
+			tracker.Finish(true)
+
+			progress, err := utils.ReadRunProgress(filename)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(progress.State).To(Equal(utils.RunStateFailed))
+			Expect(progress.Phases).To(HaveLen(3))
+			Expect(progress.Phases[0].Phase).To(Equal("Starting"))
+			Expect(progress.Phases[1].Phase).To(Equal("Pre-data metadata"))
+			Expect(progress.Phases[2].Phase).To(Equal("Data"))
+			Expect(progress.TablesSucceeded).To(Equal([]string{"public.foo"}))
+			Expect(progress.TablesFailed).To(Equal(map[string]string{"public.bar": "disk full"}))
+		})
+	})
+})
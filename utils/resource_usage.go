@@ -0,0 +1,86 @@
+package utils
+
+/*
+ * This file contains structs and functions for measuring the resources used by
+ * gpbackup, gprestore, and gpbackup_helper.  Each helper agent writes its usage
+ * to a file next to its pipes when it finishes, in the same way that it signals
+ * errors, and gpbackup and gprestore collect those files for the report.
+ */
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/pkg/errors"
+)
+
+/*
+ * BytesRead and BytesWritten are the bytes read from and written to the data
+ * file or plugin by a backup agent, or the reverse for a restore agent, so the
+ * uncompressed side of the transfer is always the pipe.  NetworkBytes is the
+ * number of those bytes that were sent to or received from a plugin.
+ */
+type HelperResourceUsage struct {
+	BytesRead    int64
+	BytesWritten int64
+	NetworkBytes int64
+	CPUTime      time.Duration
+}
+
+func (usage HelperResourceUsage) String() string {
+	return fmt.Sprintf("%d %d %d %d", usage.BytesRead, usage.BytesWritten, usage.NetworkBytes, usage.CPUTime.Nanoseconds())
+}
+
+func ParseHelperResourceUsage(usageStr string) (HelperResourceUsage, error) {
+	fields := strings.Fields(usageStr)
+	if len(fields) != 4 {
+		return HelperResourceUsage{}, errors.Errorf("Invalid helper resource usage: %s", usageStr)
+	}
+	values := make([]int64, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return HelperResourceUsage{}, errors.Errorf("Invalid helper resource usage: %s", usageStr)
+		}
+		values[i] = value
+	}
+	return HelperResourceUsage{BytesRead: values[0], BytesWritten: values[1], NetworkBytes: values[2], CPUTime: time.Duration(values[3])}, nil
+}
+
+func (usage *HelperResourceUsage) Add(other HelperResourceUsage) {
+	usage.BytesRead += other.BytesRead
+	usage.BytesWritten += other.BytesWritten
+	usage.NetworkBytes += other.NetworkBytes
+	usage.CPUTime += other.CPUTime
+}
+
+/*
+ * Returns the usage reported by the helper agent of each segment, keyed by
+ * content ID.  Segments whose agent did not report its usage are omitted.
+ */
+func GetHelperResourceUsageOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) map[int]HelperResourceUsage {
+	remoteOutput := c.GenerateAndExecuteCommand("Collecting resource usage of segment agents", cluster.ON_SEGMENTS, func(contentID int) string {
+		usageFile := fmt.Sprintf("%s_usage", fpInfo.GetSegmentPipeFilePath(contentID))
+		return fmt.Sprintf("if [[ -f %[1]s ]]; then cat %[1]s; fi; rm -f %[1]s", usageFile)
+	})
+
+	segmentUsage := make(map[int]HelperResourceUsage)
+	for _, command := range remoteOutput.Commands {
+		usageStr := strings.TrimSpace(command.Stdout)
+		if command.Error != nil || usageStr == "" {
+			continue
+		}
+		usage, err := ParseHelperResourceUsage(usageStr)
+		if err != nil {
+			gplog.Verbose("Unable to read resource usage of helper agent on segment %d: %v", command.Content, err)
+			continue
+		}
+		segmentUsage[command.Content] = usage
+	}
+	return segmentUsage
+}
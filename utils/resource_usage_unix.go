@@ -0,0 +1,39 @@
+// +build !windows
+
+package utils
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+/*
+ * Returns the user and system CPU time of this process and of any child
+ * processes, such as plugins, that it has waited for.
+ */
+func GetCPUTime() time.Duration {
+	var cpuTime time.Duration
+	for _, who := range []int{syscall.RUSAGE_SELF, syscall.RUSAGE_CHILDREN} {
+		var rusage syscall.Rusage
+		if err := syscall.Getrusage(who, &rusage); err == nil {
+			cpuTime += time.Duration(rusage.Utime.Nano() + rusage.Stime.Nano())
+		}
+	}
+	return cpuTime
+}
+
+/*
+ * Returns the peak resident set size of this process in bytes.  Maxrss is in
+ * kilobytes, except on macOS where it is already in bytes.
+ */
+func GetPeakMemoryUsage() int64 {
+	var rusage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage); err != nil {
+		return 0
+	}
+	if runtime.GOOS == "darwin" {
+		return int64(rusage.Maxrss)
+	}
+	return int64(rusage.Maxrss) * 1024
+}
@@ -0,0 +1,19 @@
+// +build windows
+
+package utils
+
+import (
+	"time"
+)
+
+/*
+ * Resource usage is not measured on Windows, where gpbackup only runs with
+ * --client-mode.
+ */
+func GetCPUTime() time.Duration {
+	return 0
+}
+
+func GetPeakMemoryUsage() int64 {
+	return 0
+}
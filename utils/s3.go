@@ -0,0 +1,294 @@
+package utils
+
+/*
+ * This file contains structs and functions for storing backups in Amazon S3,
+ * or in an object store with an S3-compatible API such as MinIO or Ceph,
+ * without an external plugin.  gpbackup and gprestore write a plugin config
+ * for the --s3-* flags that names gpbackup_helper as the plugin executable,
+ * and gpbackup_helper implements the plugin API with the client in this file,
+ * so --storage s3 follows the same code paths as any other plugin.
+ */
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	STORAGE_LOCAL = "local"
+	STORAGE_S3    = "s3"
+
+	DefaultS3PartSizeMB = 64
+	MinS3PartSizeMB     = 5
+	MaxS3PartSizeMB     = 5120
+	defaultS3Region     = "us-east-1"
+)
+
+type S3Settings struct {
+	Bucket      string
+	Folder      string
+	Region      string
+	Endpoint    string
+	PartSizeMB  int
+	SSE         string
+	SSEKMSKeyID string
+}
+
+func ValidateStorage(storage string) error {
+	if storage != STORAGE_LOCAL && storage != STORAGE_S3 {
+		return errors.Errorf("Invalid value '%s' for --storage.  Valid values are '%s' and '%s'.", storage, STORAGE_LOCAL, STORAGE_S3)
+	}
+	return nil
+}
+
+func (settings S3Settings) Validate() error {
+	if settings.Bucket == "" {
+		return errors.New("--s3-bucket must be specified when using --storage s3")
+	}
+	if settings.PartSizeMB < MinS3PartSizeMB || settings.PartSizeMB > MaxS3PartSizeMB {
+		return errors.Errorf("--s3-part-size must be between %d and %d megabytes", MinS3PartSizeMB, MaxS3PartSizeMB)
+	}
+	if settings.SSE != "" && settings.SSE != "AES256" && settings.SSE != "aws:kms" {
+		return errors.Errorf("Invalid value '%s' for --s3-sse.  Valid values are 'AES256' and 'aws:kms'.", settings.SSE)
+	}
+	if settings.SSEKMSKeyID != "" && settings.SSE != "aws:kms" {
+		return errors.New("--s3-sse-kms-key-id can only be used with --s3-sse aws:kms")
+	}
+	if settings.Endpoint != "" {
+		if _, err := settings.endpointURL(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * Writes a plugin config for the given settings to a temporary file and
+ * returns its path.  Credentials are not written to the config, as it is
+ * copied to every host and backed up with the backup; gpbackup_helper finds
+ * them on each host through the AWS SDK instead.
+ */
+func WriteS3PluginConfig(settings S3Settings) (string, error) {
+	gphome := operating.System.Getenv("GPHOME")
+	if gphome == "" {
+		return "", errors.New("GPHOME must be set to use --storage s3")
+	}
+	config := PluginConfig{
+		ExecutablePath: path.Join(gphome, "bin", "gpbackup_helper"),
+		Options: map[string]string{
+			"storage":      STORAGE_S3,
+			"bucket":       settings.Bucket,
+			"folder":       settings.Folder,
+			"region":       settings.Region,
+			"endpoint":     settings.Endpoint,
+			"part_size_mb": strconv.Itoa(settings.PartSizeMB),
+		},
+	}
+	if settings.SSE != "" {
+		config.Options["server_side_encryption"] = settings.SSE
+	}
+	if settings.SSEKMSKeyID != "" {
+		config.Options["sse_kms_key_id"] = settings.SSEKMSKeyID
+	}
+	contents, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	configFile, err := ioutil.TempFile("", "gpbackup_s3_config_*.yaml")
+	if err != nil {
+		return "", err
+	}
+	_, err = configFile.Write(contents)
+	if err != nil {
+		_ = configFile.Close()
+		return "", err
+	}
+	return configFile.Name(), configFile.Close()
+}
+
+/*
+ * Reads the settings from a plugin config written by WriteS3PluginConfig and
+ * copied to this host.
+ */
+func ReadS3SettingsFromPluginConfig(configFile string) (S3Settings, error) {
+	contents, err := operating.System.ReadFile(configFile)
+	if err != nil {
+		return S3Settings{}, err
+	}
+	config := PluginConfig{}
+	err = yaml.Unmarshal(contents, &config)
+	if err != nil {
+		return S3Settings{}, errors.Errorf("Unable to parse plugin config %s: %v", configFile, err)
+	}
+	if config.Options["storage"] != STORAGE_S3 {
+		return S3Settings{}, errors.Errorf("Plugin config %s is not an S3 storage config", configFile)
+	}
+	partSizeMB, err := strconv.Atoi(config.Options["part_size_mb"])
+	if err != nil {
+		partSizeMB = DefaultS3PartSizeMB
+	}
+	settings := S3Settings{
+		Bucket:      config.Options["bucket"],
+		Folder:      config.Options["folder"],
+		Region:      config.Options["region"],
+		Endpoint:    config.Options["endpoint"],
+		PartSizeMB:  partSizeMB,
+		SSE:         config.Options["server_side_encryption"],
+		SSEKMSKeyID: config.Options["sse_kms_key_id"],
+	}
+	return settings, settings.Validate()
+}
+
+/*
+ * Objects are stored under the same directory structure as the backup files
+ * on local disk, <folder>/backups/<YYYYMMDD>/<timestamp>/<filename>, so that
+ * each backup can be found and deleted by its timestamp.
+ */
+func (settings S3Settings) ObjectKey(filePath string) string {
+	timestampDir := path.Base(path.Dir(filePath))
+	return path.Join(settings.BackupPrefix(timestampDir), path.Base(filePath))
+}
+
+func (settings S3Settings) BackupPrefix(timestamp string) string {
+	dayDir := timestamp
+	if len(timestamp) >= 8 {
+		dayDir = timestamp[:8]
+	}
+	return path.Join(settings.Folder, "backups", dayDir, timestamp)
+}
+
+func (settings S3Settings) endpointURL() (*url.URL, error) {
+	endpoint := settings.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Host == "" {
+		return nil, errors.Errorf("Invalid S3 endpoint '%s'", settings.Endpoint)
+	}
+	return endpointURL, nil
+}
+
+/*
+ * Credentials, and the region if it is not given, are found by the AWS SDK in
+ * the environment, the shared credentials and config files, or the instance
+ * role of the host, as for the AWS CLI.
+ */
+type S3Client struct {
+	Settings S3Settings
+	service  *s3.S3
+	uploader *s3manager.Uploader
+}
+
+func NewS3Client(settings S3Settings) (*S3Client, error) {
+	config := aws.NewConfig()
+	if settings.Region != "" {
+		config = config.WithRegion(settings.Region)
+	}
+	// S3-compatible stores address buckets by path, which needs no DNS configuration
+	if settings.Endpoint != "" {
+		config = config.WithEndpoint(settings.Endpoint).WithS3ForcePathStyle(true)
+	}
+	s3Session, err := session.NewSessionWithOptions(session.Options{Config: *config, SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to create S3 session")
+	}
+	if aws.StringValue(s3Session.Config.Region) == "" {
+		s3Session.Config.Region = aws.String(defaultS3Region)
+	}
+	service := s3.New(s3Session)
+	// Every segment uploads at once, so each uploads one part at a time to bound its memory use
+	uploader := s3manager.NewUploaderWithClient(service, func(uploader *s3manager.Uploader) {
+		uploader.PartSize = int64(settings.PartSizeMB) * 1024 * 1024
+		uploader.Concurrency = 1
+	})
+	return &S3Client{Settings: settings, service: service, uploader: uploader}, nil
+}
+
+func (client *S3Client) CheckBucket() error {
+	_, err := client.service.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(client.Settings.Bucket)})
+	if err != nil {
+		return errors.Wrapf(err, "Unable to access S3 bucket %s", client.Settings.Bucket)
+	}
+	return nil
+}
+
+/*
+ * Streams the reader to the given key, in a single request if it holds no
+ * more than one part and in a multipart upload otherwise.
+ */
+func (client *S3Client) Upload(key string, reader io.Reader) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(client.Settings.Bucket),
+		Key:    aws.String(key),
+		Body:   reader,
+	}
+	if client.Settings.SSE != "" {
+		input.ServerSideEncryption = aws.String(client.Settings.SSE)
+	}
+	if client.Settings.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(client.Settings.SSEKMSKeyID)
+	}
+	_, err := client.uploader.Upload(input)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to upload %s to S3", key)
+	}
+	return nil
+}
+
+/*
+ * The caller must close the returned reader.
+ */
+func (client *S3Client) Download(key string) (io.ReadCloser, error) {
+	output, err := client.service.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(client.Settings.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to download %s from S3", key)
+	}
+	return output.Body, nil
+}
+
+/*
+ * Deletes every object whose key is under the given prefix and returns the
+ * number of objects deleted.
+ */
+func (client *S3Client) DeletePrefix(prefix string) (int, error) {
+	keys := make([]string, 0)
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(client.Settings.Bucket),
+		Prefix: aws.String(strings.TrimSuffix(prefix, "/") + "/"),
+	}
+	err := client.service.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "Unable to list objects under %s in S3", prefix)
+	}
+	for i, key := range keys {
+		_, err = client.service.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(client.Settings.Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return i, errors.Wrapf(err, "Unable to delete %s from S3", key)
+		}
+	}
+	return len(keys), nil
+}
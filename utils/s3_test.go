@@ -0,0 +1,215 @@
+package utils_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+/*
+ * An in-memory S3 bucket, addressed by path, that implements the requests
+ * that S3Client makes through the AWS SDK.
+ */
+type fakeS3Server struct {
+	mutex    sync.Mutex
+	bucket   string
+	objects  map[string][]byte
+	parts    map[int][]byte
+	requests []string
+}
+
+func (server *fakeS3Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	Expect(request.Header.Get("Authorization")).To(HavePrefix("AWS4-HMAC-SHA256 Credential=ACCESSKEY/"))
+	key := strings.TrimPrefix(request.URL.Path, "/"+server.bucket+"/")
+	query := request.URL.Query()
+	body, _ := ioutil.ReadAll(request.Body)
+	server.requests = append(server.requests, request.Method+" "+request.URL.RawQuery)
+
+	switch {
+	case request.Method == "PUT" && query.Get("partNumber") != "":
+		var partNumber int
+		_, _ = fmt.Sscanf(query.Get("partNumber"), "%d", &partNumber)
+		server.parts[partNumber] = body
+		writer.Header().Set("ETag", fmt.Sprintf(`"etag%d"`, partNumber))
+	case request.Method == "PUT":
+		server.objects[key] = body
+	case request.Method == "POST" && query["uploads"] != nil:
+		server.parts = make(map[int][]byte)
+		_, _ = writer.Write([]byte("<InitiateMultipartUploadResult><UploadId>upload1</UploadId></InitiateMultipartUploadResult>"))
+	case request.Method == "POST":
+		complete := struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}{}
+		Expect(xml.Unmarshal(body, &complete)).To(Succeed())
+		object := make([]byte, 0)
+		for i, part := range complete.Parts {
+			Expect(part.PartNumber).To(Equal(i + 1))
+			Expect(part.ETag).To(Equal(fmt.Sprintf(`"etag%d"`, i+1)))
+			object = append(object, server.parts[part.PartNumber]...)
+		}
+		server.objects[key] = object
+		_, _ = writer.Write([]byte("<CompleteMultipartUploadResult></CompleteMultipartUploadResult>"))
+	case request.Method == "GET" && query.Get("list-type") == "2":
+		keys := make([]string, 0)
+		for objectKey := range server.objects {
+			if strings.HasPrefix(objectKey, query.Get("prefix")) {
+				keys = append(keys, objectKey)
+			}
+		}
+		sort.Strings(keys)
+		_, _ = writer.Write([]byte("<ListBucketResult><IsTruncated>false</IsTruncated>"))
+		for _, objectKey := range keys {
+			_, _ = writer.Write([]byte("<Contents><Key>" + objectKey + "</Key></Contents>"))
+		}
+		_, _ = writer.Write([]byte("</ListBucketResult>"))
+	case request.Method == "GET":
+		object, ok := server.objects[key]
+		if !ok {
+			writer.WriteHeader(http.StatusNotFound)
+			_, _ = writer.Write([]byte("<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>"))
+			return
+		}
+		_, _ = writer.Write(object)
+	case request.Method == "DELETE":
+		delete(server.objects, key)
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+var _ = Describe("utils/s3 tests", func() {
+	AfterEach(func() {
+		operating.InitializeSystemFunctions()
+	})
+	Describe("S3Settings", func() {
+		var settings utils.S3Settings
+		BeforeEach(func() {
+			settings = utils.S3Settings{Bucket: "bucket", Folder: "gpdb", PartSizeMB: utils.DefaultS3PartSizeMB}
+		})
+		It("stores files under the day and timestamp of the backup", func() {
+			Expect(settings.ObjectKey("/data/backups/20180101/20180101010101/gpbackup_0_20180101010101")).To(Equal("gpdb/backups/20180101/20180101010101/gpbackup_0_20180101010101"))
+			Expect(settings.BackupPrefix("20180101010101")).To(Equal("gpdb/backups/20180101/20180101010101"))
+		})
+		It("accepts valid settings", func() {
+			settings.SSE = "aws:kms"
+			settings.SSEKMSKeyID = "key"
+			settings.Endpoint = "http://localhost:9000"
+			Expect(settings.Validate()).To(Succeed())
+		})
+		It("requires a bucket", func() {
+			settings.Bucket = ""
+			Expect(settings.Validate()).To(MatchError("--s3-bucket must be specified when using --storage s3"))
+		})
+		It("rejects a part size smaller than S3 allows", func() {
+			settings.PartSizeMB = 4
+			Expect(settings.Validate()).To(MatchError("--s3-part-size must be between 5 and 5120 megabytes"))
+		})
+		It("rejects an unknown server-side encryption", func() {
+			settings.SSE = "rot13"
+			Expect(settings.Validate()).To(MatchError("Invalid value 'rot13' for --s3-sse.  Valid values are 'AES256' and 'aws:kms'."))
+		})
+		It("rejects a KMS key without KMS encryption", func() {
+			settings.SSE = "AES256"
+			settings.SSEKMSKeyID = "key"
+			Expect(settings.Validate()).To(MatchError("--s3-sse-kms-key-id can only be used with --s3-sse aws:kms"))
+		})
+	})
+	Describe("WriteS3PluginConfig", func() {
+		It("writes a plugin config that names gpbackup_helper and can be read back", func() {
+			operating.System.Getenv = func(name string) string {
+				if name == "GPHOME" {
+					return "/usr/local/gpdb"
+				}
+				return ""
+			}
+			settings := utils.S3Settings{Bucket: "bucket", Folder: "gpdb", Region: "us-west-2", Endpoint: "http://minio:9000", PartSizeMB: 16, SSE: "AES256"}
+
+			configFile, err := utils.WriteS3PluginConfig(settings)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(configFile)
+
+			operating.System.ReadFile = ioutil.ReadFile
+			config, err := utils.ReadPluginConfig(configFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.ExecutablePath).To(Equal("/usr/local/gpdb/bin/gpbackup_helper"))
+			readSettings, err := utils.ReadS3SettingsFromPluginConfig(configFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readSettings).To(Equal(settings))
+		})
+		It("returns an error when GPHOME is not set", func() {
+			operating.System.Getenv = func(string) string { return "" }
+			_, err := utils.WriteS3PluginConfig(utils.S3Settings{Bucket: "bucket"})
+			Expect(err).To(MatchError("GPHOME must be set to use --storage s3"))
+		})
+	})
+	Describe("S3Client", func() {
+		var server *fakeS3Server
+		var httpServer *httptest.Server
+		var client *utils.S3Client
+		BeforeEach(func() {
+			server = &fakeS3Server{bucket: "bucket", objects: make(map[string][]byte)}
+			httpServer = httptest.NewServer(server)
+			_ = os.Setenv("AWS_ACCESS_KEY_ID", "ACCESSKEY")
+			_ = os.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+			var err error
+			client, err = utils.NewS3Client(utils.S3Settings{Bucket: "bucket", Region: "us-east-1", Endpoint: httpServer.URL, PartSizeMB: utils.MinS3PartSizeMB})
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			httpServer.Close()
+			_ = os.Unsetenv("AWS_ACCESS_KEY_ID")
+			_ = os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+		})
+		It("uploads data smaller than a part in a single request", func() {
+			Expect(client.Upload("backups/file", strings.NewReader("small data"))).To(Succeed())
+
+			Expect(server.objects["backups/file"]).To(Equal([]byte("small data")))
+			Expect(server.requests).To(Equal([]string{"PUT "}))
+		})
+		It("uploads data larger than a part in a multipart upload and downloads it", func() {
+			data := bytes.Repeat([]byte("0123456789"), 1200*1024)
+
+			Expect(client.Upload("backups/data file", bytes.NewReader(data))).To(Succeed())
+			Expect(server.parts).To(HaveLen(3))
+			Expect(server.objects["backups/data file"]).To(Equal(data))
+
+			reader, err := client.Download("backups/data file")
+			Expect(err).ToNot(HaveOccurred())
+			downloaded, _ := ioutil.ReadAll(reader)
+			_ = reader.Close()
+			Expect(downloaded).To(Equal(data))
+		})
+		It("returns the S3 error for a missing object", func() {
+			_, err := client.Download("backups/missing")
+			Expect(err).To(MatchError(HavePrefix("Unable to download backups/missing from S3: NoSuchKey: The specified key does not exist.")))
+		})
+		It("deletes only the objects under a prefix", func() {
+			server.objects["gpdb/backups/20180101/20180101010101/file1"] = []byte("1")
+			server.objects["gpdb/backups/20180101/20180101010101/file2"] = []byte("2")
+			server.objects["gpdb/backups/20180101/20180101010102/file1"] = []byte("3")
+
+			numDeleted, err := client.DeletePrefix("gpdb/backups/20180101/20180101010101")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(numDeleted).To(Equal(2))
+			Expect(server.objects).To(HaveLen(1))
+			Expect(server.objects).To(HaveKey("gpdb/backups/20180101/20180101010102/file1"))
+		})
+	})
+})
@@ -0,0 +1,266 @@
+package utils
+
+/*
+ * This file contains structs and functions for the status file that a running
+ * gpbackup or gprestore keeps up to date, so that --status can report on the
+ * run from another process.
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	RunStateRunning   = "Running"
+	RunStateSucceeded = "Succeeded"
+	RunStateFailed    = "Failed"
+)
+
+/*
+ * BytesTotal is 0 if the sizes of the tables are not known, in which case the
+ * estimated completion time is based on the number of tables instead.
+ */
+type RunStatus struct {
+	Utility         string `yaml:"utility"`
+	Timestamp       string `yaml:"timestamp"`
+	Database        string `yaml:"database"`
+	Pid             int    `yaml:"pid"`
+	State           string `yaml:"state"`
+	Phase           string `yaml:"phase"`
+	StartTime       string `yaml:"start_time"`
+	UpdateTime      string `yaml:"update_time"`
+	DataStartTime   string `yaml:"data_start_time,omitempty"`
+	Paused          bool   `yaml:"paused,omitempty"`
+	TablesCompleted int64  `yaml:"tables_completed"`
+	TablesTotal     int64  `yaml:"tables_total"`
+	BytesCompleted  int64  `yaml:"bytes_completed"`
+	BytesTotal      int64  `yaml:"bytes_total"`
+	Errors          int64  `yaml:"errors"`
+}
+
+/*
+ * Rewrites the status file whenever the status changes.  The file is written
+ * to a temporary file and renamed over the previous one so that readers never
+ * see a partial status.  Errors writing the file are ignored, as the status
+ * file must never stop the run.  All methods may be called on a nil tracker.
+ */
+type StatusTracker struct {
+	filename     string
+	status       RunStatus
+	mutex        sync.Mutex
+	progressFile *os.File
+}
+
+func NewStatusTracker(filename string, utility string, timestamp string, database string) *StatusTracker {
+	now := time.Now().Format("20060102150405")
+	tracker := &StatusTracker{
+		filename: filename,
+		status: RunStatus{
+			Utility:    utility,
+			Timestamp:  timestamp,
+			Database:   database,
+			Pid:        os.Getpid(),
+			State:      RunStateRunning,
+			Phase:      "Starting",
+			StartTime:  now,
+			UpdateTime: now,
+		},
+	}
+	tracker.write()
+	return tracker
+}
+
+/*
+ * Also records the phases of the run, and the tables passed to AddTableResult,
+ * in the given progress file, starting with the current phase.
+ */
+func (tracker *StatusTracker) RecordProgressTo(filename string) error {
+	if tracker == nil {
+		return nil
+	}
+	progressFile, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.progressFile = appendProgressEvent(progressFile, ProgressEvent{Event: ProgressEventPhase, Phase: tracker.status.Phase})
+	return nil
+}
+
+func (tracker *StatusTracker) SetPhase(phase string) {
+	tracker.update(func(status *RunStatus) {
+		status.Phase = phase
+		tracker.recordProgress(ProgressEvent{Event: ProgressEventPhase, Phase: phase})
+	})
+}
+
+/*
+ * Starts the data phase, whose progress is used to estimate the completion
+ * time of the run.
+ */
+func (tracker *StatusTracker) StartData(tablesTotal int64, bytesTotal int64) {
+	tracker.update(func(status *RunStatus) {
+		if status.Phase != "Data" {
+			tracker.recordProgress(ProgressEvent{Event: ProgressEventPhase, Phase: "Data"})
+		}
+		status.Phase = "Data"
+		status.DataStartTime = time.Now().Format("20060102150405")
+		status.TablesTotal += tablesTotal
+		status.BytesTotal += bytesTotal
+	})
+}
+
+func (tracker *StatusTracker) SetPaused(paused bool) {
+	tracker.update(func(status *RunStatus) {
+		status.Paused = paused
+	})
+}
+
+func (tracker *StatusTracker) AddTableCompleted(numBytes int64) {
+	tracker.update(func(status *RunStatus) {
+		status.TablesCompleted++
+		status.BytesCompleted += numBytes
+	})
+}
+
+/*
+ * Records whether the data of a table was restored in the progress file, which
+ * the status file does not list the tables of.
+ */
+func (tracker *StatusTracker) AddTableResult(table string, tableErr error) {
+	if tracker == nil {
+		return
+	}
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	event := ProgressEvent{Event: ProgressEventTable, Table: table, State: RunStateSucceeded}
+	if tableErr != nil {
+		event.State = RunStateFailed
+		event.Error = tableErr.Error()
+	}
+	tracker.recordProgress(event)
+}
+
+func (tracker *StatusTracker) AddError() {
+	tracker.update(func(status *RunStatus) {
+		status.Errors++
+	})
+}
+
+func (tracker *StatusTracker) Finish(failed bool) {
+	tracker.update(func(status *RunStatus) {
+		status.State = RunStateSucceeded
+		if failed {
+			status.State = RunStateFailed
+		}
+		status.Phase = "Finished"
+		tracker.recordProgress(ProgressEvent{Event: ProgressEventFinish, State: status.State})
+		if tracker.progressFile != nil {
+			_ = tracker.progressFile.Close()
+			tracker.progressFile = nil
+		}
+	})
+}
+
+func (tracker *StatusTracker) update(updateFunc func(status *RunStatus)) {
+	if tracker == nil {
+		return
+	}
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	updateFunc(&tracker.status)
+	tracker.status.UpdateTime = time.Now().Format("20060102150405")
+	tracker.write()
+}
+
+// Must be called with the mutex held
+func (tracker *StatusTracker) recordProgress(event ProgressEvent) {
+	if tracker.progressFile != nil {
+		tracker.progressFile = appendProgressEvent(tracker.progressFile, event)
+	}
+}
+
+func (tracker *StatusTracker) write() {
+	contents, err := yaml.Marshal(tracker.status)
+	if err != nil {
+		return
+	}
+	tempFilename := tracker.filename + ".tmp"
+	if err = ioutil.WriteFile(tempFilename, contents, 0644); err != nil {
+		return
+	}
+	_ = os.Rename(tempFilename, tracker.filename)
+}
+
+func ReadRunStatus(filename string) (RunStatus, error) {
+	status := RunStatus{}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return status, errors.Wrapf(err, "Unable to read status file %s", filename)
+	}
+	err = yaml.Unmarshal(contents, &status)
+	if err != nil {
+		return status, errors.Wrapf(err, "Unable to parse status file %s", filename)
+	}
+	return status, nil
+}
+
+/*
+ * Returns the estimated time remaining in the data phase, from the rate at
+ * which bytes, or tables if the sizes are not known, have been completed so
+ * far, or -1 if there is not enough progress to estimate it.
+ */
+func EstimateTimeRemaining(status RunStatus, now time.Time) time.Duration {
+	if status.Phase != "Data" || status.DataStartTime == "" {
+		return -1
+	}
+	dataStartTime, err := time.ParseInLocation("20060102150405", status.DataStartTime, operating.System.Local)
+	if err != nil {
+		return -1
+	}
+	completed, total := status.TablesCompleted, status.TablesTotal
+	if status.BytesTotal > 0 {
+		completed, total = status.BytesCompleted, status.BytesTotal
+	}
+	elapsed := now.Sub(dataStartTime)
+	if completed <= 0 || total <= 0 || elapsed <= 0 {
+		return -1
+	}
+	if completed >= total {
+		return 0
+	}
+	return time.Duration(float64(elapsed) * float64(total-completed) / float64(completed)).Round(time.Second)
+}
+
+func FormatRunStatus(status RunStatus, now time.Time) string {
+	phase := status.Phase
+	if status.Paused && status.State == RunStateRunning {
+		phase += " (paused with SIGUSR1, send SIGUSR2 to resume)"
+	}
+	lines := []string{
+		fmt.Sprintf("%s %s of database %s: %s", status.Utility, status.Timestamp, status.Database, status.State),
+		fmt.Sprintf("Phase: %s", phase),
+		fmt.Sprintf("Tables completed: %d of %d", status.TablesCompleted, status.TablesTotal),
+	}
+	if status.BytesTotal > 0 {
+		lines = append(lines, fmt.Sprintf("Data completed: %s of %s", FormatSize(status.BytesCompleted), FormatSize(status.BytesTotal)))
+	}
+	lines = append(lines, fmt.Sprintf("Errors: %d", status.Errors))
+	if remaining := EstimateTimeRemaining(status, now); remaining >= 0 && status.State == RunStateRunning {
+		lines = append(lines, fmt.Sprintf("Estimated completion: %s (%s remaining)", now.Add(remaining).Format("2006-01-02 15:04:05"), remaining))
+	}
+	if updateTime, err := time.ParseInLocation("20060102150405", status.UpdateTime, operating.System.Local); err == nil {
+		lines = append(lines, fmt.Sprintf("Last updated: %s", updateTime.Format("2006-01-02 15:04:05")))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
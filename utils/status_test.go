@@ -0,0 +1,106 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/status tests", func() {
+	now := time.Date(2017, time.January, 1, 2, 0, 0, 0, time.Local)
+	Describe("StatusTracker", func() {
+		var tempDir string
+		BeforeEach(func() {
+			tempDir, _ = ioutil.TempDir("", "status")
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(tempDir)
+		})
+		It("writes the status of the run whenever it changes", func() {
+			filename := path.Join(tempDir, "gpbackup_20170101010101_status.yaml")
+			tracker := utils.NewStatusTracker(filename, "gpbackup", "20170101010101", "testdb")
+			tracker.StartData(4, 4000)
+			tracker.AddTableCompleted(1000)
+			tracker.AddError()
+
+			status, err := utils.ReadRunStatus(filename)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.Utility).To(Equal("gpbackup"))
+			Expect(status.Database).To(Equal("testdb"))
+			Expect(status.State).To(Equal(utils.RunStateRunning))
+			Expect(status.Phase).To(Equal("Data"))
+			Expect(status.TablesCompleted).To(Equal(int64(1)))
+			Expect(status.TablesTotal).To(Equal(int64(4)))
+			Expect(status.BytesCompleted).To(Equal(int64(1000)))
+			Expect(status.BytesTotal).To(Equal(int64(4000)))
+			Expect(status.Errors).To(Equal(int64(1)))
+		})
+		It("records whether the run failed when it finishes", func() {
+			filename := path.Join(tempDir, "gpbackup_20170101010101_status.yaml")
+			tracker := utils.NewStatusTracker(filename, "gpbackup", "20170101010101", "testdb")
+			tracker.Finish(true)
+
+			status, err := utils.ReadRunStatus(filename)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.State).To(Equal(utils.RunStateFailed))
+			Expect(status.Phase).To(Equal("Finished"))
+		})
+		It("does nothing for a nil tracker", func() {
+			var tracker *utils.StatusTracker
+			tracker.SetPhase("Metadata")
+			tracker.Finish(false)
+		})
+	})
+	Describe("EstimateTimeRemaining", func() {
+		It("estimates the time remaining from the bytes completed", func() {
+			status := utils.RunStatus{Phase: "Data", DataStartTime: "20170101013000", BytesCompleted: 1000, BytesTotal: 4000, TablesCompleted: 3, TablesTotal: 4}
+			Expect(utils.EstimateTimeRemaining(status, now)).To(Equal(90 * time.Minute))
+		})
+		It("estimates the time remaining from the tables completed when sizes are not known", func() {
+			status := utils.RunStatus{Phase: "Data", DataStartTime: "20170101013000", TablesCompleted: 3, TablesTotal: 4}
+			Expect(utils.EstimateTimeRemaining(status, now)).To(Equal(10 * time.Minute))
+		})
+		It("cannot estimate the time remaining before any data is completed", func() {
+			status := utils.RunStatus{Phase: "Data", DataStartTime: "20170101013000", TablesTotal: 4}
+			Expect(utils.EstimateTimeRemaining(status, now)).To(Equal(time.Duration(-1)))
+		})
+		It("cannot estimate the time remaining outside of the data phase", func() {
+			status := utils.RunStatus{Phase: "Metadata"}
+			Expect(utils.EstimateTimeRemaining(status, now)).To(Equal(time.Duration(-1)))
+		})
+	})
+	Describe("FormatRunStatus", func() {
+		It("prints the progress and estimated completion of a running backup", func() {
+			status := utils.RunStatus{Utility: "gpbackup", Timestamp: "20170101010101", Database: "testdb", State: utils.RunStateRunning,
+				Phase: "Data", UpdateTime: "20170101015959", DataStartTime: "20170101013000", TablesCompleted: 3, TablesTotal: 4, Errors: 0}
+
+			Expect(utils.FormatRunStatus(status, now)).To(Equal(`gpbackup 20170101010101 of database testdb: Running
+Phase: Data
+Tables completed: 3 of 4
+Errors: 0
+Estimated completion: 2017-01-01 02:10:00 (10m0s remaining)
+Last updated: 2017-01-01 01:59:59
+`))
+		})
+		It("shows that the data copy of a running backup is paused", func() {
+			status := utils.RunStatus{Utility: "gpbackup", Timestamp: "20170101010101", Database: "testdb", State: utils.RunStateRunning,
+				Phase: "Data", Paused: true, UpdateTime: "20170101015959"}
+
+			Expect(utils.FormatRunStatus(status, now)).To(ContainSubstring("Phase: Data (paused with SIGUSR1, send SIGUSR2 to resume)\n"))
+		})
+		It("does not print an estimated completion for a finished backup", func() {
+			status := utils.RunStatus{Utility: "gpbackup", Timestamp: "20170101010101", Database: "testdb", State: utils.RunStateSucceeded,
+				Phase: "Finished", UpdateTime: "20170101015959", TablesCompleted: 4, TablesTotal: 4}
+
+			Expect(utils.FormatRunStatus(status, now)).ToNot(ContainSubstring("Estimated completion"))
+		})
+	})
+})
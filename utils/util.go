@@ -7,9 +7,11 @@ package utils
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"os/signal"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -132,6 +134,53 @@ func ValidateCompressionTypeAndLevel(compressionType string, compressionLevel in
 	return nil
 }
 
+/*
+ * Parses a human-readable size such as "500MB" or "2 TB" into a number of
+ * bytes.  Units follow pg_size_pretty and are powers of 1024; a value with no
+ * unit is treated as a number of bytes.
+ */
+func ParseSize(sizeStr string) (int64, error) {
+	sizeFormat := regexp.MustCompile(`^\s*(\d+)\s*([a-zA-Z]*)\s*$`)
+	matches := sizeFormat.FindStringSubmatch(sizeStr)
+	if matches == nil {
+		return 0, errors.Errorf("Invalid size '%s'.  Sizes must be a whole number optionally followed by a unit of B, kB, MB, GB, or TB.", sizeStr)
+	}
+	multipliers := map[string]int64{
+		"":   1,
+		"b":  1,
+		"kb": 1 << 10,
+		"mb": 1 << 20,
+		"gb": 1 << 30,
+		"tb": 1 << 40,
+	}
+	multiplier, ok := multipliers[strings.ToLower(matches[2])]
+	if !ok {
+		return 0, errors.Errorf("Invalid size '%s'.  Sizes must be a whole number optionally followed by a unit of B, kB, MB, GB, or TB.", sizeStr)
+	}
+	value, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil || value > math.MaxInt64/multiplier {
+		return 0, errors.Errorf("Size '%s' is too large", sizeStr)
+	}
+	return value * multiplier, nil
+}
+
+/*
+ * Formats a number of bytes for display, using the same units as ParseSize.
+ */
+func FormatSize(numBytes int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	size := float64(numBytes)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", numBytes, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
 func InitializeSignalHandler(cleanupFunc func(bool), procDesc string, termFlag *bool) {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
@@ -146,6 +195,23 @@ func InitializeSignalHandler(cleanupFunc func(bool), procDesc string, termFlag *
 	}()
 }
 
+/*
+ * With --machine-output, stdout is kept for the JSON summary of the run.  The
+ * logger writes to the stdout it was created with, so it is replaced with one
+ * that writes to stderr and appends to the same log file, and os.Stdout is
+ * pointed at stderr for the progress bars and any other output.  Returns the
+ * original stdout.
+ */
+func RedirectOutputToStderr(program string) *os.File {
+	stdout := os.Stdout
+	logFileName := gplog.GetLogFilePath()
+	logFile, err := os.OpenFile(logFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	gplog.FatalOnError(err)
+	gplog.SetLogger(gplog.NewLogger(os.Stderr, os.Stderr, logFile, logFileName, gplog.GetVerbosity(), program, gplog.GetLogFileVerbosity()))
+	os.Stdout = os.Stderr
+	return stdout
+}
+
 // TODO: Uniquely identify COPY commands in the multiple data file case to allow terminating sessions
 func TerminateHangingCopySessions(connectionPool *dbconn.DBConn, fpInfo filepath.FilePathInfo, appName string) {
 	copyFileName := fpInfo.GetSegmentPipePathForCopyCommand()
@@ -211,6 +277,35 @@ func QuoteIdent(connectionPool *dbconn.DBConn, ident string) string {
 	return dbconn.MustSelectString(connectionPool, fmt.Sprintf(`SELECT quote_ident('%s')`, EscapeSingleQuotes(ident)))
 }
 
+/*
+ * Quotes an identifier as quote_ident does, for use when there is no
+ * connection to the database.  Only the keywords reserved in every supported
+ * version are recognized, so the result may differ from quote_ident for
+ * identifiers that match keywords reserved in a particular version only.
+ */
+func QuoteIdentWithoutConnection(ident string) string {
+	if regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`).MatchString(ident) && !reservedKeywords[ident] {
+		return ident
+	}
+	return fmt.Sprintf(`"%s"`, strings.Replace(ident, `"`, `""`, -1))
+}
+
+var reservedKeywords = map[string]bool{
+	"all": true, "analyse": true, "analyze": true, "and": true, "any": true, "array": true, "as": true,
+	"asc": true, "asymmetric": true, "both": true, "case": true, "cast": true, "check": true,
+	"collate": true, "column": true, "constraint": true, "create": true, "current_date": true,
+	"current_role": true, "current_time": true, "current_timestamp": true, "current_user": true,
+	"default": true, "deferrable": true, "desc": true, "distinct": true, "do": true, "else": true,
+	"end": true, "except": true, "false": true, "for": true, "foreign": true, "from": true,
+	"grant": true, "group": true, "having": true, "in": true, "initially": true, "intersect": true,
+	"into": true, "leading": true, "limit": true, "localtime": true, "localtimestamp": true,
+	"not": true, "null": true, "offset": true, "on": true, "only": true, "or": true, "order": true,
+	"placing": true, "primary": true, "references": true, "select": true, "session_user": true,
+	"some": true, "symmetric": true, "table": true, "then": true, "to": true, "trailing": true,
+	"true": true, "union": true, "unique": true, "user": true, "using": true, "when": true,
+	"where": true, "with": true,
+}
+
 func SliceToQuotedString(slice []string) string {
 	quotedStrings := make([]string, len(slice))
 	for i, str := range slice {
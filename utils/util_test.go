@@ -159,6 +159,49 @@ var _ = Describe("utils/util tests", func() {
 			Expect(err).To(MatchError("compression type 'zstd' only allows compression levels between 1 and 19, but the provided level is 20"))
 		})
 	})
+	Describe("ParseSize", func() {
+		It("parses a size with no unit as a number of bytes", func() {
+			size, err := utils.ParseSize("1024")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(size).To(Equal(int64(1024)))
+		})
+		It("parses sizes with units in a case-insensitive manner", func() {
+			size, err := utils.ParseSize("10kB")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(size).To(Equal(int64(10 * 1024)))
+			size, err = utils.ParseSize("5 mb")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(size).To(Equal(int64(5 * 1024 * 1024)))
+			size, err = utils.ParseSize("2TB")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(size).To(Equal(int64(2 * 1024 * 1024 * 1024 * 1024)))
+		})
+		It("returns an error for an unknown unit", func() {
+			_, err := utils.ParseSize("10PB")
+			Expect(err).To(MatchError("Invalid size '10PB'.  Sizes must be a whole number optionally followed by a unit of B, kB, MB, GB, or TB."))
+		})
+		It("returns an error for a negative or fractional size", func() {
+			_, err := utils.ParseSize("-1GB")
+			Expect(err).To(HaveOccurred())
+			_, err = utils.ParseSize("1.5GB")
+			Expect(err).To(HaveOccurred())
+		})
+		It("returns an error for a size that overflows", func() {
+			_, err := utils.ParseSize("99999999999TB")
+			Expect(err).To(MatchError("Size '99999999999TB' is too large"))
+		})
+	})
+	Describe("FormatSize", func() {
+		It("formats sizes smaller than 1kB as a number of bytes", func() {
+			Expect(utils.FormatSize(0)).To(Equal("0 B"))
+			Expect(utils.FormatSize(1023)).To(Equal("1023 B"))
+		})
+		It("formats larger sizes with one decimal place in the largest fitting unit", func() {
+			Expect(utils.FormatSize(1536)).To(Equal("1.5 kB"))
+			Expect(utils.FormatSize(5 * 1024 * 1024)).To(Equal("5.0 MB"))
+			Expect(utils.FormatSize(2048 * 1024 * 1024 * 1024 * 1024)).To(Equal("2048.0 TB"))
+		})
+	})
 	Describe("UnquoteIdent", func() {
 		It("returns unchanged ident when passed a single char", func() {
 			dbname := `a`
@@ -191,6 +234,22 @@ var _ = Describe("utils/util tests", func() {
 			Expect(resultString).To(Equal(`"test`))
 		})
 	})
+	Describe("QuoteIdentWithoutConnection", func() {
+		It("returns unchanged ident when passed a lowercase ident", func() {
+			Expect(utils.QuoteIdentWithoutConnection(`my_table$1`)).To(Equal(`my_table$1`))
+		})
+		It("quotes an ident with uppercase letters or special characters", func() {
+			Expect(utils.QuoteIdentWithoutConnection(`MyTable`)).To(Equal(`"MyTable"`))
+			Expect(utils.QuoteIdentWithoutConnection(`my table`)).To(Equal(`"my table"`))
+			Expect(utils.QuoteIdentWithoutConnection(`1table`)).To(Equal(`"1table"`))
+		})
+		It("quotes a reserved keyword", func() {
+			Expect(utils.QuoteIdentWithoutConnection(`order`)).To(Equal(`"order"`))
+		})
+		It("escapes double quotes", func() {
+			Expect(utils.QuoteIdentWithoutConnection(`my"table`)).To(Equal(`"my""table"`))
+		})
+	})
 	Describe("SliceToQuotedString", func() {
 		It("quotes and joins a slice of strings into a single string", func() {
 			inputStrings := []string{"string1", "string2", "string3"}